@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"emil/internal/audit"
+	"emil/internal/models"
+	"emil/internal/signing"
+)
+
+// runAudit implements "emil audit verify": it checks that an audit log written
+// with -audit-log has not been altered and, given the run reports written
+// with it, that it still holds the entries they anchored
+func runAudit(args []string) error {
+	if len(args) == 0 || args[0] != "verify" {
+		return fmt.Errorf("usage: emil audit verify -log file [-key public.pem] [report...]")
+	}
+
+	flags := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	logFile := flags.String("log", "emil-audit.jsonl", "Audit log written by -audit-log")
+	keyFile := flags.String("key", "", "Ed25519 public key (PKIX PEM) matching the -sign-key the reports were signed with; each report's signature is checked before its anchor is trusted")
+	flags.Parse(args[1:])
+
+	entries, err := audit.Verify(*logFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err != nil {
+		return &partialError{err.Error()}
+	}
+	fmt.Printf("%s: %d entries, chain intact\n", *logFile, entries)
+	if flags.NArg() == 0 {
+		return nil
+	}
+
+	var key ed25519.PublicKey
+	if *keyFile != "" {
+		if key, err = signing.LoadPublicKey(*keyFile); err != nil {
+			return err
+		}
+	}
+	failed := 0
+	for _, path := range flags.Args() {
+		anchor, err := reportAnchor(path, key)
+		if err == nil {
+			_, err = audit.VerifyAnchor(*logFile, anchor.Sequence, anchor.Hash)
+		}
+		if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: entry %d matches\n", path, anchor.Sequence)
+	}
+	if failed > 0 {
+		return &partialError{fmt.Sprintf("%d reports do not match the audit log", failed)}
+	}
+	return nil
+}
+
+// reportAnchor reads the audit log head a run report recorded, checking the
+// report's signature first if a key is given
+func reportAnchor(path string, key ed25519.PublicKey) (*models.AuditAnchor, error) {
+	if key != nil {
+		if err := signing.VerifyFile(key, path); err != nil {
+			return nil, err
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	var report models.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse report: %w", err)
+	}
+	if report.Audit == nil {
+		return nil, fmt.Errorf("report was written without -audit-log")
+	}
+	return report.Audit, nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"emil/internal/config"
+	"emil/internal/converter"
+	"emil/internal/discovery"
+	"emil/internal/manager"
+	"emil/internal/models"
+	"emil/internal/sample"
+)
+
+// benchResult is the outcome of one benchmark run
+type benchResult struct {
+	renderer string
+	workers  int
+	stats    models.Stats
+	elapsed  time.Duration
+}
+
+// runBench implements "emil bench": it converts a synthetic corpus with each
+// combination of renderer and worker count and compares the throughput, so
+// hosts can be sized before real runs
+func runBench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	count := flags.Int("n", 60, "Number of messages in the synthetic corpus")
+	workerList := flags.String("workers", defaultBenchWorkers(), "Comma-separated worker counts to compare")
+	rendererList := flags.String("renderers", converter.RendererChrome+","+converter.RendererBasic, "Comma-separated renderers to compare; unavailable ones are skipped")
+	kinds := flags.String("kinds", strings.Join(sample.WorkloadKinds, ","), "Comma-separated kinds of message in the corpus: "+strings.Join(sample.Kinds, ", "))
+	seed := flags.Uint64("seed", 1, "Seed of the synthetic corpus; the same seed always produces the same messages")
+	dir := flags.String("dir", "", "Directory for the corpus and its PDFs (default: a temporary directory, removed afterwards)")
+	tempDir := flags.String("temp-dir", "", "Directory for temporary render files (default: system temp directory)")
+	flags.Parse(args)
+
+	var workerCounts []int
+	for _, value := range splitList(*workerList) {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid worker count %q", value)
+		}
+		workerCounts = append(workerCounts, n)
+	}
+	renderers := splitList(*rendererList)
+	if err := converter.CheckRendererOrder(renderers); err != nil {
+		return err
+	}
+	if err := sample.CheckKinds(splitList(*kinds)); err != nil {
+		return err
+	}
+	if *count < 1 || len(workerCounts) == 0 {
+		return fmt.Errorf("usage: emil bench [-n messages] [-workers 1,2,4] [-renderers chrome,basic]")
+	}
+
+	root := *dir
+	if root == "" {
+		var err error
+		if root, err = os.MkdirTemp("", "emil-bench-"); err != nil {
+			return fmt.Errorf("failed to create benchmark directory: %w", err)
+		}
+		defer os.RemoveAll(root)
+	}
+
+	runTemp, _, err := converter.SetupTempDir(*tempDir)
+	if err != nil {
+		return err
+	}
+	defer converter.RemoveTempDir(runTemp)
+	defer converter.CloseBrowser()
+
+	var results []benchResult
+	var corpusBytes int64
+	for _, renderer := range renderers {
+		if len(converter.DetectRenderers(benchConfig("", 1, renderer))) == 0 {
+			fmt.Printf("Skipping %s: not available on this host\n", renderer)
+			continue
+		}
+		for _, workers := range workerCounts {
+			runDir := filepath.Join(root, fmt.Sprintf("%s-%d", renderer, workers))
+			paths, err := sample.Generate(runDir, *count, splitList(*kinds), *seed)
+			if err != nil {
+				return err
+			}
+			if corpusBytes == 0 {
+				corpusBytes = totalSize(paths)
+			}
+
+			fmt.Printf("\nConverting with %s and %d workers\n", renderer, workers)
+			cfg := benchConfig(runDir, workers, renderer)
+			cfg.TempDir, cfg.RunTempDir = *tempDir, runTemp
+			mgr := manager.NewManager(cfg, nil, nil)
+			start := time.Now()
+			if err := mgr.Start(); err != nil {
+				return err
+			}
+			results = append(results, benchResult{renderer: renderer, workers: workers, stats: mgr.Stats(), elapsed: time.Since(start)})
+		}
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("none of the renderers %v is available", renderers)
+	}
+
+	fmt.Printf("\nHost: %d CPUs, %s/%s\n", runtime.NumCPU(), runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("Corpus: %d messages (%s), %.2f MB\n\n", *count, *kinds, float64(corpusBytes)/(1024*1024))
+	return writeBenchTable(os.Stdout, results)
+}
+
+// writeBenchTable prints the benchmark results, fastest marked per renderer
+func writeBenchTable(w io.Writer, results []benchResult) error {
+	fastest := make(map[string]float64)
+	for _, result := range results {
+		fastest[result.renderer] = max(fastest[result.renderer], result.filesPerSec())
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "RENDERER\tWORKERS\tCONVERTED\tFAILED\tSECONDS\tFILES/S\tMB/S\t")
+	for _, result := range results {
+		mark := ""
+		if result.filesPerSec() == fastest[result.renderer] {
+			mark = "fastest"
+		}
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%.1f\t%.2f\t%.2f\t%s\n",
+			result.renderer, result.workers, result.stats.Successful, result.stats.Failed,
+			result.elapsed.Seconds(), result.filesPerSec(),
+			float64(result.stats.TotalFileSize)/(1024*1024)/result.elapsed.Seconds(), mark)
+	}
+	return table.Flush()
+}
+
+// filesPerSec returns the run's throughput in converted files per second
+func (r benchResult) filesPerSec() float64 {
+	return float64(r.stats.Successful) / r.elapsed.Seconds()
+}
+
+// benchConfig returns the default options with a single renderer, no retries
+// and no progress bar
+func benchConfig(dir string, workers int, renderer string) *config.Config {
+	return &config.Config{
+		SourceDir:       dir,
+		WorkerCount:     workers,
+		RecursiveScan:   true,
+		Symlinks:        discovery.SymlinksFiles,
+		MaxMemoryPct:    75,
+		ProgressMode:    manager.ProgressNone,
+		Retry:           config.RetryOptions{MaxAttempts: 1},
+		UnwrapJournals:  true,
+		ShowARC:         true,
+		Locale:          "en",
+		HTMLPartPolicy:  converter.HTMLPartFirst,
+		QuoteMode:       converter.QuoteShow,
+		DetectLanguage:  true,
+		RendererOrder:   []string{renderer},
+		RenderWait:      converter.RenderWaitIdle,
+		RenderWaitMS:    5000,
+		SaveAttachments: true,
+		ThumbnailImages: true,
+		InlineAttachKB:  64,
+		HeaderAnomalies: true,
+	}
+}
+
+// defaultBenchWorkers compares one worker, half the cores and all of them
+func defaultBenchWorkers() string {
+	counts := []int{1, max(runtime.NumCPU()/2, 1), runtime.NumCPU()}
+	slices.Sort(counts)
+	counts = slices.Compact(counts)
+
+	list := ""
+	for i, n := range counts {
+		if i > 0 {
+			list += ","
+		}
+		list += strconv.Itoa(n)
+	}
+	return list
+}
+
+// totalSize returns the combined size of the files
+func totalSize(paths []string) int64 {
+	var total int64
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"emil/internal/models"
+)
+
+// Exit codes
+const (
+	exitOK      = 0 // Every file was handled
+	exitPartial = 1 // Some files failed or a -fail-on condition was met
+	exitFatal   = 2 // The run could not start, or was interrupted or aborted by a security alert
+)
+
+// partialError reports a command that ran to completion but found problems
+type partialError struct {
+	msg string
+}
+
+func (e *partialError) Error() string { return e.msg }
+
+// commandExit logs a subcommand's error and returns its exit code
+func commandExit(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	log.Printf("Error: %v", err)
+
+	var partial *partialError
+	if errors.As(err, &partial) {
+		return exitPartial
+	}
+	return exitFatal
+}
+
+// failPolicy decides which run outcomes exit with exitPartial
+type failPolicy struct {
+	anyFailure    bool
+	threshold     float64 // Share of files that may fail, when set
+	hasThreshold  bool
+	securityAlert bool
+	truncated     bool
+}
+
+// parseFailOn parses a -fail-on value
+func parseFailOn(value string) (failPolicy, error) {
+	var policy failPolicy
+	for _, item := range splitList(value) {
+		switch {
+		case item == "any":
+			policy.anyFailure = true
+		case item == "security-alert":
+			policy.securityAlert = true
+		case item == "truncated":
+			policy.truncated = true
+		case item == "none":
+		case strings.HasPrefix(item, "threshold:"):
+			number := strings.TrimSuffix(strings.TrimPrefix(item, "threshold:"), "%")
+			percent, err := strconv.ParseFloat(number, 64)
+			if err != nil || percent < 0 || percent > 100 {
+				return policy, fmt.Errorf("invalid -fail-on threshold %q (expected a percentage, e.g. threshold:5%%)", item)
+			}
+			policy.threshold = percent / 100
+			policy.hasThreshold = true
+		default:
+			return policy, fmt.Errorf("unsupported -fail-on condition %q (available: any, threshold:N%%, security-alert, truncated, none)", item)
+		}
+	}
+	return policy, nil
+}
+
+// check returns why the run counts as failed, or "" if it doesn't
+func (p failPolicy) check(stats models.Stats) string {
+	if p.anyFailure && stats.Failed > 0 {
+		return fmt.Sprintf("%d files failed to convert", stats.Failed)
+	}
+	if p.hasThreshold && stats.Processed > 0 {
+		if rate := float64(stats.Failed) / float64(stats.Processed); rate > p.threshold {
+			return fmt.Sprintf("%.1f%% of files failed to convert (limit %.1f%%)", rate*100, p.threshold*100)
+		}
+	}
+	if p.securityAlert && stats.SecurityAlerts > 0 {
+		return fmt.Sprintf("%d security alerts were raised", stats.SecurityAlerts)
+	}
+	if p.truncated && stats.Truncated > 0 {
+		return fmt.Sprintf("%d messages were cut off at the page limit", stats.Truncated)
+	}
+	return ""
+}
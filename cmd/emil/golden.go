@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"emil/internal/config"
+	"emil/internal/converter"
+	"emil/internal/golden"
+)
+
+// runGolden implements "emil golden": it converts each fixture EML and
+// compares the text and structure of its PDF with the fixture's golden file,
+// so rendering changes are reviewed as differences rather than eyeballed
+func runGolden(args []string) error {
+	flags := flag.NewFlagSet("golden", flag.ExitOnError)
+	dir := flags.String("dir", filepath.Join("testdata", "golden"), "Directory of fixture EML files and their .golden.json files")
+	renderer := flags.String("renderer", converter.RendererBasic, "Renderer the fixtures are converted with")
+	update := flags.Bool("update", false, "Record the current output as the golden files instead of comparing")
+	flags.Parse(args)
+
+	if err := converter.CheckRendererOrder([]string{*renderer}); err != nil {
+		return err
+	}
+	fixtures, err := filepath.Glob(filepath.Join(*dir, "*.eml"))
+	if err != nil {
+		return fmt.Errorf("failed to list fixtures: %w", err)
+	}
+	if len(fixtures) == 0 {
+		return fmt.Errorf("no fixture EML files in %s", *dir)
+	}
+
+	work, err := os.MkdirTemp("", "emil-golden-")
+	if err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer os.RemoveAll(work)
+	runTemp, _, err := converter.SetupTempDir("")
+	if err != nil {
+		return err
+	}
+	defer converter.RemoveTempDir(runTemp)
+	defer converter.CloseBrowser()
+
+	// Saved attachment paths would differ between runs
+	cfg := benchConfig(work, 1, *renderer)
+	cfg.SaveAttachments = false
+	cfg.RunTempDir = runTemp
+	if len(converter.DetectRenderers(cfg)) == 0 {
+		return fmt.Errorf("renderer %s is not available on this host", *renderer)
+	}
+
+	var differ int
+	for _, fixture := range fixtures {
+		name := filepath.Base(fixture)
+		goldenPath := strings.TrimSuffix(fixture, ".eml") + ".golden.json"
+
+		features, err := convertFixture(fixture, work, cfg)
+		if err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			differ++
+			continue
+		}
+		if *update {
+			if err := golden.Save(goldenPath, features); err != nil {
+				return err
+			}
+			fmt.Printf("%s: recorded\n", name)
+			continue
+		}
+
+		want, err := golden.Load(goldenPath)
+		if err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			differ++
+			continue
+		}
+		diffs := golden.Compare(want, features)
+		if len(diffs) == 0 {
+			fmt.Printf("%s: ok\n", name)
+			continue
+		}
+		differ++
+		for _, diff := range diffs {
+			fmt.Printf("%s: %s\n", name, diff)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Checked %d fixtures: %d differ or failed\n", len(fixtures), differ)
+	if differ > 0 {
+		return &partialError{fmt.Sprintf("%d fixtures differ from their golden files or failed to convert", differ)}
+	}
+	return nil
+}
+
+// convertFixture converts a copy of a fixture in the work directory and
+// extracts the features of its PDF
+func convertFixture(fixture, work string, cfg *config.Config) (golden.Features, error) {
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		return golden.Features{}, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	path := filepath.Join(work, filepath.Base(fixture))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return golden.Features{}, fmt.Errorf("failed to copy fixture: %w", err)
+	}
+
+	result, err := converter.ConvertEMLToPDF(path, cfg, nil, nil)
+	if err != nil {
+		return golden.Features{}, fmt.Errorf("conversion failed: %w", err)
+	}
+	return golden.Extract(result.Renderer, converter.OutputFiles(path))
+}
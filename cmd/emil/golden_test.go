@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"emil/internal/converter"
+	"emil/internal/golden"
+)
+
+var updateGolden = flag.Bool("update", false, "Record the current output as the golden files instead of comparing")
+
+// TestGolden converts the fixtures in testdata/golden with the basic renderer
+// and compares each with its golden file, as emil golden does. Record intended
+// changes with go test ./cmd/emil -run TestGolden -update.
+func TestGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("..", "..", "testdata", "golden", "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures in testdata/golden")
+	}
+
+	runTemp, _, err := converter.SetupTempDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer converter.RemoveTempDir(runTemp)
+
+	work := t.TempDir()
+	cfg := benchConfig(work, 1, converter.RendererBasic)
+	cfg.SaveAttachments = false
+	cfg.RunTempDir = runTemp
+	if len(converter.DetectRenderers(cfg)) == 0 {
+		t.Skip("the basic renderer is not available")
+	}
+
+	for _, fixture := range fixtures {
+		name := strings.TrimSuffix(filepath.Base(fixture), ".eml")
+		t.Run(name, func(t *testing.T) {
+			goldenPath := strings.TrimSuffix(fixture, ".eml") + ".golden.json"
+			features, err := convertFixture(fixture, work, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *updateGolden {
+				if err := golden.Save(goldenPath, features); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := golden.Load(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, diff := range golden.Compare(want, features) {
+				t.Error(diff)
+			}
+		})
+	}
+}
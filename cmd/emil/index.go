@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"emil/internal/metadata"
+)
+
+// runIndex implements "emil index": it writes the metadata of every EML file
+// as JSON lines or CSV without rendering any PDFs
+func runIndex(args []string) error {
+	flags := flag.NewFlagSet("index", flag.ExitOnError)
+	srcDir := flags.String("src", ".", "Source directory to scan for EML files")
+	recursive := flags.Bool("recursive", true, "Recursively scan directories")
+	format := flags.String("format", metadata.FormatJSON, "Output format: json (one object per line) or csv")
+	output := flags.String("o", "", "Write the index to this file (default: standard output)")
+	flags.Parse(args)
+
+	if err := metadata.CheckFormat(*format); err != nil {
+		return err
+	}
+
+	files, err := metadata.FindEMLFiles(*srcDir, *recursive)
+	if err != nil {
+		return fmt.Errorf("file discovery failed: %w", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create index file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	writer := metadata.NewWriter(out, *format)
+	failed := 0
+	for _, path := range files {
+		msg, err := metadata.Extract(path)
+		if err != nil {
+			// Unparsable files stay in the index with the reason
+			msg = &metadata.Message{Path: path, Error: err.Error()}
+			failed++
+		}
+		if err := writer.Write(msg); err != nil {
+			return fmt.Errorf("failed to write index: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Indexed %d EML files (%d could not be parsed)\n", len(files), failed)
+	return nil
+}
@@ -9,18 +9,38 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"emil/internal/backends"
 	"emil/internal/config"
 	"emil/internal/converter"
+	"emil/internal/discovery"
 	"emil/internal/manager"
+	"emil/internal/manifest"
+	"emil/internal/migration"
+	"emil/internal/models"
+	"emil/internal/ocr"
+	"emil/internal/reputation"
+	"emil/internal/routing"
+	"emil/internal/sandbox"
 	"emil/internal/security"
+	"emil/internal/signing"
+	"emil/internal/slots"
+	"emil/internal/statsd"
 	"emil/internal/util"
 )
 
 func main() {
+	os.Exit(run())
+}
+
+// run runs the command and returns its exit code
+func run() int {
 	// Application start time
 	startTime := time.Now()
 
@@ -30,36 +50,326 @@ func main() {
 	// Configure garbage collection for better performance
 	debug.SetGCPercent(100) // Default is 100, lower means more aggressive GC
 
+	// journald timestamps every line itself
+	if os.Getenv("JOURNAL_STREAM") != "" {
+		log.SetFlags(0)
+	}
+
+	// Run a subcommand if one was given
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "audit":
+			return commandExit(runAudit(os.Args[2:]))
+		case "bench":
+			return commandExit(runBench(os.Args[2:]))
+		case "gen-sample":
+			return commandExit(runGenSample(os.Args[2:]))
+		case "golden":
+			return commandExit(runGolden(os.Args[2:]))
+		case "index":
+			return commandExit(runIndex(os.Args[2:]))
+		case "report":
+			return commandExit(runReport(os.Args[2:]))
+		case "service":
+			return commandExit(runService(os.Args[2:]))
+		case "validate":
+			return commandExit(runValidate(os.Args[2:]))
+		case "verify":
+			return commandExit(runVerify(os.Args[2:]))
+		}
+	}
+
 	// Parse command line flags
-	srcDir := flag.String("src", ".", "Source directory to scan for EML files")
+	var srcDirs sourceFlags
+	flag.Var(&srcDirs, "src", "Source directory to scan for EML files (default \".\"); repeat, or separate with \""+string(os.PathListSeparator)+"\", to convert several in one run, each optionally labeled as label=dir")
 	workerCount := flag.Int("workers", runtime.NumCPU(), "Initial number of worker threads")
 	verbose := flag.Bool("verbose", false, "Enable verbose output")
 	recursive := flag.Bool("recursive", true, "Recursively scan directories")
+	symlinks := flag.String("symlinks", "files", "Symbolic links in the source tree: files (follow links to files only), follow (files and directories, skipping cycles), skip")
+	extensions := flag.String("ext", ".eml", "Comma-separated file extensions to convert, e.g. .eml,.mht,.txt")
+	sniff := flag.Bool("sniff", false, "Also convert files with other extensions, or none, that start like an RFC 822 message")
+	oneFilesystem := flag.Bool("one-file-system", false, "Don't descend into directories on other filesystems (mount points)")
+	walkWorkers := flag.Int("walk-workers", 8, "Directories read at once while discovering files, for deep trees on network shares (1 = one at a time)")
 	diagnose := flag.Bool("diagnose", false, "Show diagnostic information")
 	maxMemPct := flag.Int("max-mem", 75, "Maximum memory usage percentage target")
+	largeFileMB := flag.Int("large-file-mb", 32, "Files at least this large, in MB, start only while there is memory headroom for them, one at a time otherwise (0 = no admission control)")
 	testMode := flag.Bool("test", false, "Test mode - convert only the first EML file found and exit")
+	progressMode := flag.String("progress", "files", "Progress display: files (count of files), bytes (source bytes, for very uneven file sizes), spinner (no total) or none")
+	batchSize := flag.Int("batch-size", 1, "Small files a worker claims at once and converts with one Chrome tab, for archives of mostly short messages (1 = one at a time)")
+	batchMaxKB := flag.Int("batch-max-kb", 16, "Largest file, in KB, that is converted in a batch")
+	textWorkers := flag.Int("text-workers", 0, "Extra workers that convert only messages without HTML, which never need Chrome, so heavy renders can't starve them (0 = no text lane)")
+	queueDepth := flag.Int("queue-depth", 0, "Tasks queued ahead of the workers in each lane (0 = sized from the worker count and the average file size)")
+	retryAttempts := flag.Int("retry-attempts", 4, "Conversion attempts per file, including the first (1 = no retries)")
+	retryBackoffMS := flag.Int("retry-backoff-ms", 500, "Delay before the first retry in milliseconds, doubled for each further retry")
+	retryMaxBackoffMS := flag.Int("retry-max-backoff-ms", 30000, "Longest delay between attempts in milliseconds (0 = no limit)")
+	retryJitter := flag.Float64("retry-jitter", 0.2, "Fraction of each retry delay that is randomized, from 0 to 1")
+	ioProfile := flag.String("io-profile", "normal", "How hard to press on storage: gentle (small reads, 4 open files, paced attachment writes, for production mail stores with QoS alarms), normal or aggressive (large reads, no limit on open files)")
+	ioRetryAttempts := flag.Int("io-retry-attempts", 3, "Tries per file operation when a network share reports a transient error such as a stale handle (1 = no retries)")
+	ioRetryBackoffMS := flag.Int("io-retry-backoff-ms", 100, "Delay before the first file operation retry in milliseconds, doubled for each further retry")
+	retryClasses := flag.String("retry-classes", strings.Join(converter.DefaultRetryClasses, ","), "Comma-separated error classes that are retried: io, descriptors, parse, config, hook, render, panic, other")
+	maxFiles := flag.Int("max-files", 0, "Convert at most this many files and leave the rest for the next run, which needs -checkpoint (0 = no limit)")
+	maxBytes := flag.String("max-bytes", "", "Convert at most this much source data, e.g. 20G or 500M, and leave the rest for the next run, which needs -checkpoint (empty = no limit)")
+	maxDuration := flag.Duration("max-duration", 0, "Stop starting new files after this long, e.g. 6h, letting conversions in progress finish and leaving the rest for the next run, which needs -checkpoint (0 = no limit)")
+	checkpointFile := flag.String("checkpoint", "", "Record each converted file in this file and skip files it lists that haven't changed since, so a run stopped at a budget or interrupted is continued by the next one")
+	tempDir := flag.String("temp-dir", "", "Directory for temporary render files, e.g. a tmpfs such as /dev/shm (default: system temp directory)")
+
+	// Add rendering options
+	extraHeaders := flag.String("headers", "", "Comma-separated list of extra headers to show, e.g. Reply-To,X-Mailer,List-Id")
+
+	templateFile := flag.String("template", "", "Custom Go html/template file for the rendered document")
+	cssFile := flag.String("css", "", "CSS file appended to the built-in styles of the rendered document")
+	locale := flag.String("locale", "en", "Language of field labels ("+strings.Join(converter.SupportedLocales(), ", ")+")")
+	timezone := flag.String("timezone", "", "IANA zone to show dates in, e.g. Europe/Berlin, with the original offset beside converted header dates (default: as written)")
+	htmlParts := flag.String("html-parts", converter.HTMLPartFirst, "Which HTML part to render when a message has several: first, largest, last or all (as sections)")
+	quoteMode := flag.String("quotes", converter.QuoteShow, "How to render quoted reply text: show, mark (style distinctly) or collapse (replace with a line count)")
+	fontFile := flag.String("font", "", "Unicode TTF font used for right-to-left text and symbols in the fallback renderer")
+	emojiDir := flag.String("emoji-dir", "", "Directory of emoji PNG images (Twemoji or Noto file names) drawn inline by the fallback renderer")
+	detectLanguage := flag.Bool("detect-language", true, "Detect the script and language of each message and pick fonts and date formats for it in the fallback renderer")
+	pdfUA := flag.Bool("pdf-ua", false, "Write accessibility-tagged PDFs (PDF/UA-1) with headings, paragraphs, lists and image descriptions; needs the chrome or remote-chrome renderer")
+	showARC := flag.Bool("arc", true, "Show the ARC chain (forwarding servers and their authentication results) of messages relayed by mailing lists and gateways")
+	showHops := flag.Bool("hops", false, "Add an appendix tracing the message's route from its Received headers (host, IP, time and delay of each hop)")
+	rawSource := flag.Bool("raw-source", false, "Add an appendix with the raw MIME source of the message, line-numbered with long lines folded, for inspecting boundaries and encodings")
+	rawSourceKB := flag.Int("raw-source-kb", 0, "Show only the first this many KB of the source with -raw-source (0 = all of it)")
+	unwrapJournals := flag.Bool("journal", true, "Unwrap Exchange, Google, Mimecast and Proofpoint journal reports and show envelope recipients, including Bcc")
+
+	// Add renderer options
+	rendererOrder := flag.String("renderer-order", strings.Join(converter.DefaultRendererOrder, ","), "Comma-separated rendering backends to try, most preferred first: chrome, remote-chrome, gotenberg, wkhtmltopdf, basic")
+	gotenbergURL := flag.String("gotenberg", "", "Base URL of a Gotenberg server used by the gotenberg renderer, e.g. http://localhost:3000")
+	renderWait := flag.String("render-wait", converter.RenderWaitIdle, "What Chrome waits for before printing: idle (no network requests and fonts loaded), fonts or none")
+	renderWaitMS := flag.Int("render-wait-ms", 5000, "Maximum time Chrome waits for the page to load before printing, in milliseconds")
+	chromePath := flag.String("chrome", "", "Path to the Chrome or Chromium binary (default: search the usual locations)")
+	chromeRemote := flag.String("chrome-remote", "", "DevTools URL of a Chrome used by the remote-chrome renderer, e.g. ws://localhost:9222")
+	chromeNoSandbox := flag.Bool("chrome-no-sandbox", false, "Run Chrome without its sandbox, e.g. in containers without user namespaces (always off as root)")
+	chromeJS := flag.Bool("chrome-js", false, "Allow JavaScript in rendered emails")
+	maxRenders := flag.Int("max-renders", 0, "Most Chrome renders running at once, to bound Chrome's memory independently of -workers (0 = one per worker)")
+	chromeMaxFailures := flag.Int("chrome-max-failures", 3, "Consecutive failures of a renderer after which the rest of the run skips it (0 = never)")
+
+	// Add output routing options
+	routesFile := flag.String("routes", "", "JSON file of rules routing outputs into per-sender or per-custodian directory trees")
+	organizeBy := flag.String("organize-by", "", "Sort outputs into date folders from the Date header: year, year/month or year/month/day")
+	organizeDir := flag.String("organize-dir", "", "Root of the date-organized output tree (default: the source directory)")
+	manifestFile := flag.String("manifest", "", "CSV or JSON manifest giving files a priority, custodian and output directory")
 
 	// Add attachment options
 	saveAttachments := flag.Bool("attachments", true, "Save email attachments")
 	attachmentDir := flag.String("attachment-dir", "", "Directory for saving attachments (default: alongside PDFs)")
+	thumbnails := flag.Bool("thumbnails", true, "Render a thumbnail gallery of image attachments")
+	attachmentAllow := flag.String("attachment-allow", "", "Comma-separated attachment extensions to save, e.g. .pdf,.docx,.xlsx (default: any not blocked)")
+	attachmentBlock := flag.String("attachment-block", "", "Comma-separated attachment extensions never saved to disk, e.g. .exe,.js,.scr")
+	maxAttachmentMB := flag.Int("max-attachment-mb", 0, "Don't save attachments larger than this many MB (0 = no limit)")
+	maxAttachTotalMB := flag.Int("max-message-attachments-mb", 0, "Stop saving a message's attachments once they total this many MB (0 = no limit)")
+	attachmentMode := flag.String("attachment-mode", "copy", "How attachments are written: copy (one per message), hardlink (stored once, hard linked per message) or store (stored once, listed in a per-message attachments.json)")
+	attachmentStore := flag.String("attachment-store", "", "Directory deduplicated attachments are stored in by content hash (default: _attachment_store in the message's source directory, one per -src)")
+	attachmentSync := flag.String("attachment-fsync", "none", "When saved attachments are flushed to disk: none (left to the OS), file (each attachment) or dir (each attachment and the directory entries naming them)")
+	saveInline := flag.Bool("save-inline", false, "Also save inline parts shown in the body, such as signature images and logos, to the attachment directory")
+	inlineAttachKB := flag.Int("inline-attachment-kb", 64, "Treat inline images the HTML body doesn't show as attachments from this many KB (0 = never)")
+
+	// Add output size options
+	maxPDFMB := flag.Int("max-pdf-mb", 0, "Split output PDFs larger than this many MB into numbered parts (0 = no limit)")
+	maxPDFPages := flag.Int("max-pdf-pages", 0, "Split output PDFs with more pages than this into numbered parts (0 = no limit)")
+	truncatePages := flag.Int("truncate-pages", 0, "Cut message bodies off after this many pages with a notice, so runaway newsletters don't render thousands of pages (0 = no limit)")
+	inlineMaxPixels := flag.Int("inline-image-max-pixels", 0, "Downscale inline images whose longest edge is larger than this many pixels before rendering, saving the originals with the attachments (0 = no limit)")
+	inlineMaxKB := flag.Int("inline-image-max-kb", 0, "Downscale inline images larger than this many KB before rendering, saving the originals with the attachments (0 = no limit)")
+
+	// Add packaging options
+	packageZip := flag.Bool("zip", false, "Also bundle each message's PDF, saved attachments, raw EML and a metadata.json into a ZIP beside the PDF")
+	sidecar := flag.Bool("sidecar", false, "Write each message's headers, participants, attachment inventory with hashes, scan results and conversion details to a .json file next to its PDF")
+	mergePerFolder := flag.Bool("merge-per-folder", false, "Also combine the PDFs converted in each folder into one chronological PDF with a table of contents and bookmarks (requires Ghostscript)")
+
+	// Add optimization options
+	optimize := flag.Bool("optimize", false, "Compress, deduplicate and linearize output PDFs (requires Ghostscript and/or qpdf)")
+	optimizeDPI := flag.Int("optimize-dpi", 150, "Resolution images are downsampled to when optimizing")
+
+	// Add records management options
+	xmpCustodian := flag.String("xmp-custodian", "", "Custodian written into each PDF's XMP metadata")
+	xmpMatter := flag.String("xmp-matter", "", "Matter number written into each PDF's XMP metadata")
+	xmpRetention := flag.String("xmp-retention", "", "Retention class written into each PDF's XMP metadata")
+	xmpLegalHold := flag.Bool("xmp-legal-hold", false, "Flag each PDF as under legal hold in its XMP metadata")
+	xmpExtra := flag.String("xmp", "", "Additional XMP properties as comma-separated name=value pairs, e.g. department=Finance,region=EU")
+	preserveTimes := flag.String("preserve-times", "", "Set the mtime of PDFs and attachments from the message's Date header (date) or the source file (source)")
+	preserveOwner := flag.Bool("preserve-owner", false, "Copy the source file's permissions, and owner where permitted, to PDFs and attachments")
 
 	// Add security options
 	scanAttachments := flag.Bool("scan", false, "Scan attachments for viruses using ClamAV")
-	clamdAddress := flag.String("clamd", "localhost:3310", "ClamAV daemon address")
+	scanOutput := flag.Bool("scan-output", false, "Check each PDF written for JavaScript, launch actions and embedded files, and with ClamAV under -scan, before counting it converted; PDFs that fail are removed")
+	clamdAddress := flag.String("clamd", "localhost:3310", "ClamAV daemon address, or several separated by commas to spread scans across them")
+	clamdStreams := flag.Int("clamd-streams", 4, "Attachments streamed to each ClamAV daemon at once")
+	clamdChunkKB := flag.Int("clamd-chunk-kb", 64, "Size, in KB, of the chunks attachments are streamed to ClamAV in")
+	sandboxURL := flag.String("sandbox", "", "Base URL of an external sandbox's API to detonate attachments in, in the background; verdicts are merged into the -report at the end of the run (the API token is read from EMIL_SANDBOX_TOKEN)")
+	sandboxAPI := flag.String("sandbox-api", "cuckoo", "API the -sandbox speaks: cuckoo, cape, or http for adapters to vendor sandboxes")
+	sandboxSubmit := flag.String("sandbox-submit", "hash", "What is sent to the -sandbox for each attachment: hash (only its SHA-256) or file (the attachment itself, which cuckoo and cape need)")
+	sandboxTypes := flag.String("sandbox-types", strings.Join(sandbox.DefaultTypes, ","), "Comma-separated extensions of the attachments submitted to the -sandbox")
+	sandboxWait := flag.Duration("sandbox-wait", 10*time.Minute, "How long the run waits for outstanding -sandbox verdicts once the files are converted; attachments without one are reported as pending")
+	reputationSpecs := flag.String("reputation", "", "Comma-separated reputation providers body links and relay HELO names are checked against: list:PATH, dnsbl:ZONE or http:URL (token in EMIL_REPUTATION_TOKEN)")
+	alertActions := flag.String("alert-actions", "", "What to do with a message's outputs for each security alert severity, e.g. critical=quarantine,warning=annotate (severities: info, warning, critical; actions: report, annotate, quarantine, skip, abort; default annotate)")
+	quarantineDir := flag.String("quarantine-dir", "", "Where outputs quarantined by -alert-actions are written, mirroring the source tree (default \"quarantine\" under the source directory)")
+
+	// Add OCR options
+	ocrEnabled := flag.Bool("ocr", false, "Run OCR on image-only emails and scanned attachments using Tesseract")
+	ocrLanguage := flag.String("ocr-lang", "eng", "Tesseract language code(s) for OCR, e.g. eng+deu")
+
+	// Add reporting options
+	htmlReportFile := flag.String("html-report", "", "Write a self-contained HTML summary of the run (failures, alerts, largest, slowest and costliest files, costliest senders, throughput) to this path")
+	securityReport := flag.String("security-report", "", "Write an index of the run's security findings (threats, attachment hashes, sender domains, affected files) to this path as JSON, with an HTML version beside it")
+	auditLog := flag.String("audit-log", "", "Append a hash-chained record of every conversion (user, host, time, source and output SHA-256) to this file")
+	headerAnomalies := flag.Bool("header-anomalies", true, "Record header anomalies (missing or future Date, duplicate Message-ID, Received time travel, Return-Path not matching From) in the -sidecar and -report")
+	historyFile := flag.String("history", "", "Append this run's statistics and per-file outcomes to this run history file, for emil report history")
+	failOn := flag.String("fail-on", "any", "When to exit with status 1: any (a file failed), threshold:N% (more than N% of files failed), security-alert, truncated (a body was cut off), none; comma-separated to combine")
+	signKey := flag.String("sign-key", "", "Ed25519 private key (PKCS#8 PEM, e.g. from openssl genpkey -algorithm ed25519) used to write a .sig signature next to each report")
+	reportFile := flag.String("report", "", "Write a JSON report of every converted file to this path")
+	checkDuplicates := flag.Bool("check-duplicates", false, "After the run, check for distinct sources converted to the same output path or to byte-identical PDFs, and exit with status 1 if any are found")
+	expectIDs := flag.String("expect-ids", "", "File of the Message-IDs a mailbox migration must deliver, one per line; converted messages are checked against it and missing or unexpected ones reported")
+
+	// Add monitoring options
+	dashboardAddress := flag.String("dashboard", "", "Serve a live web dashboard (queue, workers, throughput, recent failures and security alerts), /healthz and /readyz, and /api/pause, /api/resume and /api/tune on this address during the run, e.g. localhost:8080 (the control endpoints need the token in EMIL_DASHBOARD_TOKEN unless bound to loopback; on any other address every endpoint but the page itself needs it, and the page is opened as /#token=...)")
+
+	// Add notification options
+	notifyTo := flag.String("notify", "", "Comma-separated addresses emailed a summary (counts, failures, security alerts, reports attached) when the run finishes")
+	notifyFrom := flag.String("notify-from", "emil@localhost", "Sender address of the summary email")
+	smtpAddress := flag.String("smtp", "localhost:25", "SMTP server for -notify as host:port")
+	smtpUser := flag.String("smtp-user", "", "SMTP login for -notify; the password is read from EMIL_SMTP_PASSWORD")
+
+	// Add metrics options
+	statsdAddress := flag.String("statsd", "", "Send conversion counts, failures by error class and timings to this statsd or DogStatsD server, e.g. localhost:8125")
+	statsdPrefix := flag.String("statsd-prefix", "emil", "Prefix of every metric name")
+	statsdFormat := flag.String("statsd-format", statsd.FormatDogStatsD, "Metric format: dogstatsd (with tags) or statsd (no tags)")
+	statsdTags := flag.String("statsd-tags", "", "Comma-separated DogStatsD tags added to every metric, e.g. env:prod,team:records")
 
 	flag.Parse()
 
+	sources, err := parseSources(srcDirs)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
 	// Create configuration
 	cfg := &config.Config{
-		SourceDir:       *srcDir,
-		WorkerCount:     *workerCount,
-		Verbose:         *verbose,
-		RecursiveScan:   *recursive,
-		MaxMemoryPct:    *maxMemPct,
-		SaveAttachments: *saveAttachments,
-		AttachmentDir:   *attachmentDir,
-		ScanAttachments: *scanAttachments,
-		ClamdAddress:    *clamdAddress,
+		SourceDir:      sources[0].Dir,
+		Sources:        sources,
+		WorkerCount:    *workerCount,
+		Verbose:        *verbose,
+		RecursiveScan:  *recursive,
+		Symlinks:       *symlinks,
+		OneFilesystem:  *oneFilesystem,
+		Extensions:     splitList(*extensions),
+		SniffContent:   *sniff,
+		WalkWorkers:    *walkWorkers,
+		MaxMemoryPct:   *maxMemPct,
+		LargeFileMB:    *largeFileMB,
+		TempDir:        *tempDir,
+		ProgressMode:   *progressMode,
+		BatchSize:      *batchSize,
+		BatchMaxKB:     *batchMaxKB,
+		TextWorkers:    *textWorkers,
+		QueueDepth:     *queueDepth,
+		IOProfile:      *ioProfile,
+		ExtraHeaders:   splitList(*extraHeaders),
+		UnwrapJournals: *unwrapJournals,
+		ShowARC:        *showARC,
+		ShowHops:       *showHops,
+		RawSource:      *rawSource,
+		RawSourceKB:    *rawSourceKB,
+		TemplateFile:   *templateFile,
+		CSSFile:        *cssFile,
+		Locale:         *locale,
+		Timezone:       *timezone,
+		HTMLPartPolicy: *htmlParts,
+		QuoteMode:      *quoteMode,
+		FontFile:       *fontFile,
+		EmojiDir:       *emojiDir,
+		DetectLanguage: *detectLanguage,
+		PDFUA:          *pdfUA,
+		RendererOrder:  splitList(*rendererOrder),
+		GotenbergURL:   *gotenbergURL,
+		RenderWait:     *renderWait,
+		RenderWaitMS:   *renderWaitMS,
+		MaxRenders:     *maxRenders,
+		Chrome: config.ChromeOptions{
+			ExecPath:    *chromePath,
+			RemoteURL:   *chromeRemote,
+			NoSandbox:   *chromeNoSandbox,
+			JavaScript:  *chromeJS,
+			MaxFailures: *chromeMaxFailures,
+		},
+		Retry: config.RetryOptions{
+			MaxAttempts:  *retryAttempts,
+			BackoffMS:    *retryBackoffMS,
+			MaxBackoffMS: *retryMaxBackoffMS,
+			Jitter:       *retryJitter,
+			Classes:      splitList(*retryClasses),
+		},
+		IORetry: config.IORetryOptions{
+			Attempts:  *ioRetryAttempts,
+			BackoffMS: *ioRetryBackoffMS,
+		},
+		Budget: config.BudgetOptions{
+			MaxFiles:    *maxFiles,
+			MaxDuration: *maxDuration,
+		},
+		OrganizeBy:       *organizeBy,
+		OrganizeDir:      *organizeDir,
+		SaveAttachments:  *saveAttachments,
+		AttachmentDir:    *attachmentDir,
+		ThumbnailImages:  *thumbnails,
+		AttachmentAllow:  splitList(*attachmentAllow),
+		AttachmentBlock:  splitList(*attachmentBlock),
+		MaxAttachmentMB:  *maxAttachmentMB,
+		MaxAttachTotalMB: *maxAttachTotalMB,
+		AttachmentMode:   *attachmentMode,
+		AttachmentStore:  *attachmentStore,
+		AttachmentSync:   *attachmentSync,
+		SaveInline:       *saveInline,
+		InlineAttachKB:   *inlineAttachKB,
+		MaxPDFMB:         *maxPDFMB,
+		MaxPDFPages:      *maxPDFPages,
+		TruncatePages:    *truncatePages,
+		InlineMaxPixels:  *inlineMaxPixels,
+		InlineMaxKB:      *inlineMaxKB,
+		PackageZip:       *packageZip,
+		MergePerFolder:   *mergePerFolder,
+		WriteSidecar:     *sidecar,
+		OptimizePDF:      *optimize,
+		OptimizeImageDPI: *optimizeDPI,
+		XMPProperties:    xmpProperties(*xmpCustodian, *xmpMatter, *xmpRetention, *xmpLegalHold),
+		PreserveTimes:    *preserveTimes,
+		PreserveOwner:    *preserveOwner,
+		ScanAttachments:  *scanAttachments,
+		ScanOutput:       *scanOutput,
+		ClamdAddress:     *clamdAddress,
+		ClamdStreams:     *clamdStreams,
+		ClamdChunkKB:     *clamdChunkKB,
+		QuarantineDir:    *quarantineDir,
+		SandboxURL:       *sandboxURL,
+		SandboxAPI:       *sandboxAPI,
+		SandboxSubmit:    *sandboxSubmit,
+		SandboxTypes:     splitList(*sandboxTypes),
+		SandboxToken:     os.Getenv("EMIL_SANDBOX_TOKEN"),
+		SandboxWait:      *sandboxWait,
+		Reputation:       splitList(*reputationSpecs),
+		ReputationToken:  os.Getenv("EMIL_REPUTATION_TOKEN"),
+		OCREnabled:       *ocrEnabled,
+		OCRLanguage:      *ocrLanguage,
+		ReportFile:       *reportFile,
+		HTMLReportFile:   *htmlReportFile,
+		SecurityReport:   *securityReport,
+		HistoryFile:      *historyFile,
+		AuditLogFile:     *auditLog,
+		CheckpointFile:   *checkpointFile,
+		SigningKeyFile:   *signKey,
+		HeaderAnomalies:  *headerAnomalies,
+		CheckDuplicates:  *checkDuplicates,
+		DashboardAddress: *dashboardAddress,
+		DashboardToken:   os.Getenv("EMIL_DASHBOARD_TOKEN"),
+		NotifyTo:         splitList(*notifyTo),
+		NotifyFrom:       *notifyFrom,
+		SMTPAddress:      *smtpAddress,
+		SMTPUsername:     *smtpUser,
+		SMTPPassword:     os.Getenv("EMIL_SMTP_PASSWORD"),
+		StatsdAddress:    *statsdAddress,
+		StatsdPrefix:     *statsdPrefix,
+		StatsdFormat:     *statsdFormat,
+		StatsdTags:       splitList(*statsdTags),
 	}
 
 	// Print initial information
@@ -69,30 +379,319 @@ func main() {
 	var scanner *security.Scanner
 	if cfg.ScanAttachments {
 		var err error
-		scanner, err = security.NewScanner(true, cfg.ClamdAddress)
+		scanner, err = security.NewScanner(true, cfg.ClamdAddress, security.ScanOptions{
+			Streams:   cfg.ClamdStreams,
+			ChunkSize: cfg.ClamdChunkKB * 1024,
+		})
 		if err != nil {
 			log.Printf("Warning: Failed to initialize virus scanner: %v", err)
 			log.Printf("Continuing without virus scanning")
 			scanner = nil
 			cfg.ScanAttachments = false
-		} else if cfg.Verbose {
-			fmt.Println("Virus scanning enabled")
+		} else if cfg.Verbose && scanner.IsEnabled() {
+			fmt.Printf("Virus scanning enabled (%d ClamAV daemons, %d scans at once)\n", scanner.Instances(), scanner.Streams())
+		}
+	}
+
+	// Validate the failure policy before starting
+	policy, err := parseFailOn(*failOn)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+	if cfg.AlertActions, err = converter.ParseAlertActions(splitList(*alertActions)); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+	if cfg.SandboxURL != "" {
+		err := sandbox.CheckOptions(sandbox.Options{URL: cfg.SandboxURL, API: cfg.SandboxAPI, Submit: cfg.SandboxSubmit})
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return exitFatal
+		}
+	}
+	if _, err := reputation.New(cfg.Reputation, cfg.ReputationToken); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the signing key before starting
+	if cfg.SigningKeyFile != "" {
+		if _, err := signing.LoadPrivateKey(cfg.SigningKeyFile); err != nil {
+			log.Printf("Error: %v", err)
+			return exitFatal
+		}
+		if cfg.ReportFile == "" && cfg.HTMLReportFile == "" && cfg.SecurityReport == "" {
+			log.Printf("Warning: -sign-key has no effect without -report, -html-report or -security-report")
+		}
+	}
+
+	// Load the routing rules before starting
+	if *routesFile != "" {
+		if cfg.Routes, err = routing.Load(*routesFile); err != nil {
+			log.Printf("Error: %v", err)
+			return exitFatal
+		}
+	}
+	if *expectIDs != "" {
+		if cfg.ExpectedIDs, err = migration.Load(*expectIDs); err != nil {
+			log.Printf("Error: %v", err)
+			return exitFatal
+		}
+	}
+	if *manifestFile != "" {
+		if cfg.Manifest, err = manifest.Load(*manifestFile, cfg.SourceDir); err != nil {
+			log.Printf("Error: %v", err)
+			return exitFatal
+		}
+	}
+
+	// Validate the retry policy before starting
+	if err := converter.CheckRetryClasses(cfg.Retry.Classes); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+	if cfg.Retry.MaxAttempts < 1 {
+		log.Printf("Error: -retry-attempts must be at least 1")
+		return exitFatal
+	}
+	if cfg.BatchSize < 0 || cfg.BatchMaxKB < 0 {
+		log.Printf("Error: -batch-size and -batch-max-kb can't be negative")
+		return exitFatal
+	}
+	if cfg.WalkWorkers < 0 {
+		log.Printf("Error: -walk-workers can't be negative")
+		return exitFatal
+	}
+	if cfg.LargeFileMB < 0 {
+		log.Printf("Error: -large-file-mb can't be negative")
+		return exitFatal
+	}
+	if cfg.TextWorkers < 0 {
+		log.Printf("Error: -text-workers can't be negative")
+		return exitFatal
+	}
+	if cfg.QueueDepth < 0 {
+		log.Printf("Error: -queue-depth can't be negative")
+		return exitFatal
+	}
+	if _, err := converter.LookupIOProfile(cfg.IOProfile); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+	if cfg.IORetry.Attempts < 1 {
+		log.Printf("Error: -io-retry-attempts must be at least 1")
+		return exitFatal
+	}
+
+	// Validate the run's budget before starting
+	if cfg.Budget.MaxBytes, err = parseByteSize(*maxBytes); err != nil {
+		log.Printf("Error: invalid -max-bytes: %v", err)
+		return exitFatal
+	}
+	if cfg.Budget.MaxFiles < 0 || cfg.Budget.MaxDuration < 0 {
+		log.Printf("Error: -max-files and -max-duration can't be negative")
+		return exitFatal
+	}
+	budgeted := cfg.Budget.MaxFiles > 0 || cfg.Budget.MaxBytes > 0 || cfg.Budget.MaxDuration > 0
+	if budgeted && cfg.CheckpointFile == "" {
+		log.Printf("Error: -max-files, -max-bytes and -max-duration need -checkpoint, so the next run knows which files are left")
+		return exitFatal
+	}
+
+	// Validate the progress display before starting
+	if err := manager.CheckProgressMode(cfg.ProgressMode); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the attachment mode before starting
+	if err := converter.CheckAttachmentMode(cfg.AttachmentMode); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+	if err := converter.CheckAttachmentSync(cfg.AttachmentSync); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the symlink policy before starting
+	if err := discovery.CheckSymlinks(cfg.Symlinks); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the date organization before starting
+	if err := converter.CheckOrganizeBy(cfg.OrganizeBy); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the XMP properties before starting
+	if err := addXMPProperties(cfg, *xmpExtra); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the timestamp source before starting
+	if err := converter.CheckPreserveTimes(cfg.PreserveTimes); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the label locale before starting
+	if _, err := converter.LabelsFor(cfg.Locale); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the display zone before starting
+	if err := converter.CheckTimezone(cfg.Timezone); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the custom template before starting
+	if cfg.TemplateFile != "" {
+		if _, err := converter.LoadTemplate(cfg.TemplateFile); err != nil {
+			log.Printf("Error: %v", err)
+			return exitFatal
+		}
+	}
+
+	// Validate the custom stylesheet before starting
+	if cfg.CSSFile != "" {
+		if _, err := converter.LoadStylesheet(cfg.CSSFile); err != nil {
+			log.Printf("Error: %v", err)
+			return exitFatal
+		}
+	}
+
+	// Validate the HTML part policy before starting
+	if err := converter.CheckHTMLPartPolicy(cfg.HTMLPartPolicy); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the renderer order before starting
+	if err := converter.CheckRendererOrder(cfg.RendererOrder); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the render wait policy before starting
+	if err := converter.CheckRenderWait(cfg.RenderWait); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the quote mode before starting
+	if err := converter.CheckQuoteMode(cfg.QuoteMode); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the metric format before starting
+	if err := statsd.CheckFormat(cfg.StatsdFormat); err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+
+	// Validate the fallback renderer font before starting
+	if cfg.FontFile != "" {
+		if _, err := os.Stat(cfg.FontFile); err != nil {
+			log.Printf("Error: font file %s: %v", cfg.FontFile, err)
+			return exitFatal
+		}
+	}
+
+	// Validate the emoji sprite directory before starting
+	if cfg.EmojiDir != "" {
+		if info, err := os.Stat(cfg.EmojiDir); err != nil || !info.IsDir() {
+			log.Printf("Error: emoji directory %s not found", cfg.EmojiDir)
+			return exitFatal
+		}
+	}
+
+	// Create this run's temp directory, removed again when the run ends
+	runTemp, warning, err := converter.SetupTempDir(cfg.TempDir)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return exitFatal
+	}
+	if warning != "" {
+		log.Printf("Warning: %s", warning)
+	}
+	cfg.RunTempDir = runTemp
+	defer converter.RemoveTempDir(runTemp)
+	fileLimit, fileBudget := converter.SetupDescriptorBudget(cfg.WorkerCount*2 + cfg.TextWorkers)
+	cfg.DescriptorSlots = slots.New(fileBudget)
+
+	// Probe the renderers once for the whole run
+	cfg.Renderers = backends.New()
+
+	// Remove temp directories and Chrome processes left by runs that were killed
+	if removed := converter.CleanupStaleRenderFiles(cfg.TempDir); removed > 0 && cfg.Verbose {
+		fmt.Printf("Removed %d stale render directories\n", removed)
+	}
+
+	// Check for PDF optimization tools if needed
+	if cfg.OptimizePDF && !converter.OptimizerAvailable() {
+		log.Printf("Warning: Neither Ghostscript nor qpdf is available, disabling PDF optimization")
+		cfg.OptimizePDF = false
+	}
+
+	// Check for Ghostscript if merging
+	if cfg.MergePerFolder && !converter.MergeAvailable() {
+		log.Printf("Warning: Ghostscript is not available, disabling -merge-per-folder")
+		cfg.MergePerFolder = false
+	}
+
+	// Initialize OCR engine if needed
+	var ocrEngine *ocr.Engine
+	if cfg.OCREnabled {
+		ocrEngine = ocr.NewEngine(true, cfg.OCRLanguage, converter.TempDir(cfg))
+		cfg.OCREnabled = ocrEngine.IsEnabled()
+		if cfg.OCREnabled && cfg.Verbose {
+			fmt.Println("OCR enabled")
 		}
 	}
 
+	// Close the shared Chrome instance when done
+	defer converter.CloseBrowser()
+
 	if *testMode {
 		fmt.Println("Running in TEST MODE - will convert only the first EML file found")
-		if err := runTestMode(*srcDir, *recursive, cfg, scanner); err != nil {
-			log.Fatalf("Test failed: %v", err)
+		if err := runTestMode(cfg.SourceDir, *recursive, cfg, scanner, ocrEngine); err != nil {
+			log.Printf("Test failed: %v", err)
+			return exitPartial
 		}
-		return
+		return exitOK
 	}
 
-	fmt.Printf("Scanning directory: %s\n", cfg.SourceDir)
+	for _, source := range cfg.SourceList() {
+		if len(cfg.Sources) > 1 {
+			fmt.Printf("Scanning directory: %s (%s)\n", source.Dir, source.Label)
+		} else {
+			fmt.Printf("Scanning directory: %s\n", source.Dir)
+		}
+	}
 	fmt.Printf("Workers: %d (auto-scaling enabled)\n", cfg.WorkerCount)
 	fmt.Printf("Memory limit: %d%%\n", cfg.MaxMemoryPct)
+	if fileLimit > 0 {
+		fmt.Printf("Open file limit: %d (%d for conversions)\n", fileLimit, fileBudget)
+		if fileBudget < cfg.WorkerCount {
+			log.Printf("Warning: an open file limit of %d leaves %d workers %d files at once; raise ulimit -n or lower -workers", fileLimit, cfg.WorkerCount, fileBudget)
+		}
+	}
 	fmt.Printf("Attachment handling: %v\n", cfg.SaveAttachments)
 	fmt.Printf("Virus scanning: %v\n", cfg.ScanAttachments)
+	fmt.Printf("OCR: %v\n", cfg.OCREnabled)
+	renderers := converter.DetectRenderers(cfg)
+	fmt.Printf("Renderers: %s\n", strings.Join(renderers, ", "))
+	if cfg.PDFUA && !slices.ContainsFunc(renderers, converter.TagsPDF) {
+		log.Printf("Warning: -pdf-ua needs the chrome or remote-chrome renderer, and neither is available; PDFs will not be tagged")
+	}
 
 	// Enable diagnostic monitor if requested
 	if *diagnose {
@@ -102,15 +701,21 @@ func main() {
 	}
 
 	// Create and start the manager
-	mgr := manager.NewManager(cfg, scanner)
+	mgr := manager.NewManager(cfg, scanner, ocrEngine)
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
+	var interrupted atomic.Bool
 	go func() {
-		sig := <-sigChan
-		fmt.Printf("\nReceived signal %v, shutting down gracefully...\n", sig)
+		select {
+		case sig := <-sigChan:
+			fmt.Printf("\nReceived signal %v, shutting down gracefully...\n", sig)
+		case <-serviceStopRequested():
+			fmt.Println("Service is stopping, shutting down gracefully...")
+		}
+		interrupted.Store(true)
 		mgr.Stop()
 
 		// Log diagnostics before exit if enabled
@@ -119,9 +724,13 @@ func main() {
 		}
 	}()
 
+	// Pause and resume intake on SIGUSR1 and SIGUSR2
+	handlePauseSignals(mgr)
+
 	// Start processing
 	if err := mgr.Start(); err != nil {
-		log.Fatalf("Error: %v", err)
+		log.Printf("Error: %v", err)
+		return exitFatal
 	}
 
 	// Get final stats
@@ -146,18 +755,131 @@ func main() {
 		float64(stats.TotalFileSize)/(1024*1024), mbPerSec)
 	fmt.Printf("Successful: %d\n", stats.Successful)
 	fmt.Printf("Failed: %d\n", stats.Failed)
+	if stats.SecurityAlerts > 0 {
+		counts := stats.AlertCounts
+		fmt.Printf("Security alerts: %d (%d critical, %d warning, %d info)\n",
+			stats.SecurityAlerts, counts.Critical, counts.Warning, counts.Info)
+	}
+	if stats.Quarantined > 0 {
+		fmt.Printf("Quarantined by the alert policy: %d\n", stats.Quarantined)
+	}
+	if stats.Withheld > 0 {
+		fmt.Printf("Outputs withheld by the alert policy: %d\n", stats.Withheld)
+	}
+	if stats.Truncated > 0 {
+		fmt.Printf("Truncated at the page limit: %d\n", stats.Truncated)
+	}
+	if stats.EmptyBodies > 0 {
+		fmt.Printf("Messages with no body: %d\n", stats.EmptyBodies)
+	}
+	if stats.Anomalous > 0 {
+		fmt.Printf("Messages with header anomalies: %d\n", stats.Anomalous)
+	}
+	if stats.Threads > 0 {
+		fmt.Printf("Conversation threads: %d\n", stats.Threads)
+	}
+	if stats.Requeued > 0 {
+		fmt.Printf("Requeued after a worker stopped responding: %d\n", stats.Requeued)
+	}
+	if stats.FDExhausted > 0 {
+		fmt.Printf("Failed for lack of file descriptors (raise ulimit -n or lower -workers): %d\n", stats.FDExhausted)
+	}
+	if stats.Checkpointed > 0 {
+		fmt.Printf("Skipped, converted by earlier runs: %d\n", stats.Checkpointed)
+	}
+	if stats.Deferred > 0 {
+		fmt.Printf("Left for the next run at the budget: %d\n", stats.Deferred)
+	}
 
 	// Show worker scaling metrics
 	fmt.Printf("Worker scaling: min=%d, max=%d\n", stats.MinWorkers, stats.MaxWorkers)
+	printLatency(stats)
+	printScanning(stats.Scanning)
+	printSandbox(stats.Sandbox)
 
 	// Log final diagnostics if enabled
 	if *diagnose {
 		util.LogFullDiagnostics(startTime)
 	}
+
+	// Exit with a status scripts can act on
+	if interrupted.Load() {
+		fmt.Println("Run was interrupted")
+		return exitFatal
+	}
+	if stats.Aborted != "" {
+		fmt.Printf("Run was aborted by a %s\n", stats.Aborted)
+		return exitFatal
+	}
+	if reason := policy.check(stats); reason != "" {
+		fmt.Printf("Run failed: %s\n", reason)
+		return exitPartial
+	}
+	if check := stats.Migration; check != nil {
+		if len(check.Missing) > 0 || len(check.Extra) > 0 || len(check.WithoutID) > 0 {
+			fmt.Printf("Migration incomplete: %d missing, %d not expected, %d without a Message-ID\n",
+				len(check.Missing), len(check.Extra), len(check.WithoutID))
+			return exitPartial
+		}
+		fmt.Printf("Migration complete: all %d expected messages converted\n", check.Expected)
+	}
+	if check := stats.Duplicates; check != nil && check.Found() > 0 {
+		fmt.Printf("Duplicate outputs: %d paths shared by several sources, %d sets of identical PDFs\n",
+			len(check.Collisions), len(check.Identical))
+		return exitPartial
+	}
+	return exitOK
+}
+
+// printLatency shows the conversion time percentiles of each renderer path
+// and the slowest files
+func printLatency(stats models.Stats) {
+	if len(stats.Latency) == 0 {
+		return
+	}
+	round := func(d time.Duration) time.Duration {
+		if d >= time.Second {
+			return d.Round(100 * time.Millisecond)
+		}
+		return d.Round(time.Millisecond)
+	}
+
+	fmt.Println("Conversion times (p50 / p90 / p99, max):")
+	for _, path := range stats.Latency {
+		fmt.Printf("  %-14s %6d files  %s / %s / %s, max %s\n", path.Path, path.Files,
+			round(path.P50), round(path.P90), round(path.P99), round(path.Max))
+	}
+	fmt.Println("Slowest files:")
+	for _, file := range stats.SlowestFiles {
+		fmt.Printf("  %8s  %-10s %s\n", round(file.Duration), file.Renderer, file.Path)
+	}
+}
+
+// printScanning shows how long virus scans took and waited for clamd
+func printScanning(scans models.ScanSummary) {
+	if scans.Scans == 0 {
+		return
+	}
+	average := scans.Time / time.Duration(scans.Scans)
+	fmt.Printf("Virus scans: %d (%.2f MB), average %s, longest %s, waiting for a free stream %s in total\n",
+		scans.Scans, float64(scans.Bytes)/(1024*1024), average.Round(time.Millisecond),
+		scans.Max.Round(time.Millisecond), scans.Wait.Round(time.Millisecond))
+	if scans.Failed > 0 {
+		fmt.Printf("Virus scans clamd couldn't complete: %d\n", scans.Failed)
+	}
+}
+
+// printSandbox shows the verdicts of the attachments detonated in the sandbox
+func printSandbox(verdicts models.SandboxSummary) {
+	if verdicts.Submitted == 0 {
+		return
+	}
+	fmt.Printf("Sandbox verdicts: %d attachments, %d malicious, %d suspicious, %d clean, %d pending, %d failed\n",
+		verdicts.Submitted, verdicts.Malicious, verdicts.Suspicious, verdicts.Clean, verdicts.Pending, verdicts.Failed)
 }
 
 // runTestMode finds the first EML file and converts it
-func runTestMode(dir string, recursive bool, cfg *config.Config, scanner *security.Scanner) error {
+func runTestMode(dir string, recursive bool, cfg *config.Config, scanner *security.Scanner, ocrEngine *ocr.Engine) error {
 	fmt.Printf("Looking for EML files in %s\n", dir)
 
 	var firstEMLFile string
@@ -194,7 +916,7 @@ func runTestMode(dir string, recursive bool, cfg *config.Config, scanner *securi
 	fmt.Printf("Converting to PDF...\n")
 
 	startTime := time.Now()
-	result, err := converter.ConvertEMLToPDF(firstEMLFile, cfg, scanner)
+	result, err := converter.ConvertEMLToPDF(firstEMLFile, cfg, scanner, ocrEngine)
 	elapsed := time.Since(startTime).Round(time.Millisecond)
 
 	if err != nil {
@@ -208,6 +930,7 @@ func runTestMode(dir string, recursive bool, cfg *config.Config, scanner *securi
 
 	fmt.Printf("Conversion successful in %s\n", elapsed)
 	fmt.Printf("PDF saved to: %s\n", absPath)
+	fmt.Printf("Rendered with: %s\n", result.Renderer)
 
 	// Check if the file exists and get its size
 	info, err := os.Stat(result.OutputPath)
@@ -217,6 +940,24 @@ func runTestMode(dir string, recursive bool, cfg *config.Config, scanner *securi
 
 	fmt.Printf("PDF file size: %s\n", formatBytes(info.Size()))
 
+	// Display which HTML part was rendered when there were several
+	if result.BodyPart != "" {
+		fmt.Printf("Body rendered from: %s\n", result.BodyPart)
+	}
+
+	// Display optimization savings
+	if result.OptimizedBytes > 0 {
+		fmt.Printf("Optimization saved: %s\n", formatBytes(result.OptimizedBytes))
+	}
+
+	// Display split parts if the PDF exceeded the size limits
+	if len(result.OutputParts) > 1 {
+		fmt.Printf("PDF split into %d parts:\n", len(result.OutputParts))
+		for _, part := range result.OutputParts {
+			fmt.Printf("  - %s\n", part)
+		}
+	}
+
 	// Display attachment information if available
 	if len(result.Attachments) > 0 {
 		fmt.Printf("\nAttachments saved to: %s\n", filepath.Dir(result.Attachments[0].SavedPath))
@@ -232,6 +973,11 @@ func runTestMode(dir string, recursive bool, cfg *config.Config, scanner *securi
 		}
 	}
 
+	// Display OCR information if available
+	if len(result.OCRResults) > 0 {
+		fmt.Printf("\nImages recognized with OCR: %d\n", len(result.OCRResults))
+	}
+
 	// Display security alerts if any
 	if len(result.SecurityAlerts) > 0 {
 		fmt.Printf("\nSecurity alerts: %d\n", len(result.SecurityAlerts))
@@ -243,6 +989,130 @@ func runTestMode(dir string, recursive bool, cfg *config.Config, scanner *securi
 	return nil
 }
 
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// sourceFlags collects the values of a repeated -src flag
+type sourceFlags []string
+
+func (s *sourceFlags) String() string { return strings.Join(*s, string(os.PathListSeparator)) }
+
+func (s *sourceFlags) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// parseSources reads the -src values into labeled source directories. Each
+// value holds one or more directories separated like PATH, each optionally
+// written as label=dir; unlabeled directories are labeled with their name,
+// numbered when two share one.
+func parseSources(values []string) ([]config.Source, error) {
+	if len(values) == 0 {
+		values = []string{"."}
+	}
+
+	var sources []config.Source
+	labels := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for _, value := range values {
+		for _, item := range filepath.SplitList(value) {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			label, dir, labeled := strings.Cut(item, "=")
+			if !labeled {
+				label, dir = "", item
+			}
+			if label = strings.TrimSpace(label); labeled && label == "" {
+				return nil, fmt.Errorf("invalid -src %q: empty label", item)
+			}
+
+			abs, err := filepath.Abs(dir)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -src %q: %w", item, err)
+			}
+			if dirs[abs] {
+				return nil, fmt.Errorf("-src %s is given twice", dir)
+			}
+			dirs[abs] = true
+
+			if !labeled {
+				label = filepath.Base(abs)
+				for n := 2; labels[label]; n++ {
+					label = fmt.Sprintf("%s-%d", filepath.Base(abs), n)
+				}
+			} else if labels[label] {
+				return nil, fmt.Errorf("-src label %q is used twice", label)
+			}
+			labels[label] = true
+			// Absolute, so the audit log names sources wherever emil verify runs
+			sources = append(sources, config.Source{Dir: abs, Label: label})
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("-src names no directory")
+	}
+	return sources, nil
+}
+
+// xmpProperties returns the records management properties set by their own flags
+func xmpProperties(custodian, matter, retention string, legalHold bool) map[string]string {
+	properties := map[string]string{}
+	if custodian != "" {
+		properties["custodian"] = custodian
+	}
+	if matter != "" {
+		properties["matterNumber"] = matter
+	}
+	if retention != "" {
+		properties["retentionClass"] = retention
+	}
+	if legalHold {
+		properties["legalHold"] = "True"
+	}
+	return properties
+}
+
+// addXMPProperties adds the name=value pairs given with -xmp to the
+// configured XMP properties and checks every name
+func addXMPProperties(cfg *config.Config, pairs string) error {
+	for _, pair := range splitList(pairs) {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid -xmp property %q (expected name=value)", pair)
+		}
+		cfg.XMPProperties[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return converter.CheckXMPProperties(cfg.XMPProperties)
+}
+
+// parseByteSize parses a size such as 500M or 20G, in powers of 1024, or a
+// plain number of bytes. Empty means no size.
+func parseByteSize(size string) (int64, error) {
+	value := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B")
+	if value == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	if i := strings.IndexByte("KMGT", value[len(value)-1]); i >= 0 {
+		multiplier <<= 10 * (i + 1)
+		value = value[:len(value)-1]
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("%q is not a size (expected e.g. 500M or 20G)", size)
+	}
+	return int64(number * float64(multiplier)), nil
+}
+
 // formatBytes returns a human-readable byte string
 func formatBytes(bytes int64) string {
 	const unit = 1024
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+import "emil/internal/manager"
+
+// handlePauseSignals does nothing where SIGUSR1 and SIGUSR2 don't exist; use
+// the dashboard's /api/pause and /api/resume instead
+func handlePauseSignals(mgr *manager.Manager) {}
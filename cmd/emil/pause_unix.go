@@ -0,0 +1,26 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"emil/internal/manager"
+)
+
+// handlePauseSignals pauses intake on SIGUSR1 and resumes it on SIGUSR2
+func handlePauseSignals(mgr *manager.Manager) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGUSR1 {
+				mgr.Pause()
+			} else {
+				mgr.Resume()
+			}
+		}
+	}()
+}
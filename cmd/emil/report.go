@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"emil/internal/history"
+	"emil/internal/signing"
+)
+
+// runReport implements "emil report": it summarizes runs recorded with
+// -history and checks signed reports
+func runReport(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "history":
+			return runReportHistory(args[1:])
+		case "verify":
+			return runReportVerify(args[1:])
+		}
+	}
+	return fmt.Errorf("usage: emil report history [-history file] [-last n] [-run id] | emil report verify -key public.pem report...")
+}
+
+// runReportHistory compares the runs recorded with -history
+func runReportHistory(args []string) error {
+	flags := flag.NewFlagSet("report history", flag.ExitOnError)
+	historyFile := flags.String("history", "emil-history.jsonl", "Run history file written by -history")
+	last := flags.Int("last", 20, "Show only the most recent runs (0 = all)")
+	runID := flags.String("run", "", "List the per-file outcomes of the run with this ID instead")
+	flags.Parse(args)
+
+	if *runID != "" {
+		return history.WriteFiles(os.Stdout, *historyFile, *runID)
+	}
+
+	runs, err := history.Load(*historyFile, *last)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("no runs recorded in %s", *historyFile)
+	}
+	return history.WriteComparison(os.Stdout, runs)
+}
+
+// runReportVerify checks reports against the signatures written with -sign-key
+func runReportVerify(args []string) error {
+	flags := flag.NewFlagSet("report verify", flag.ExitOnError)
+	keyFile := flags.String("key", "", "Ed25519 public key (PKIX PEM, e.g. from openssl pkey -pubout) matching the -sign-key used")
+	flags.Parse(args)
+
+	if *keyFile == "" || flags.NArg() == 0 {
+		return fmt.Errorf("usage: emil report verify -key public.pem report...")
+	}
+	key, err := signing.LoadPublicKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, path := range flags.Args() {
+		if err := signing.VerifyFile(key, path); err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: signature valid\n", path)
+	}
+	if failed > 0 {
+		return &partialError{fmt.Sprintf("%d reports failed verification", failed)}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// How long a conversion is given to finish its reports after the service is
+// asked to stop, before it is killed
+const serviceStopTimeout = 2 * time.Minute
+
+// serviceStopEnv tells a conversion started by emil service run to shut down
+// gracefully when its standard input closes. Windows can't send a child a
+// signal, so the service stops its conversions this way on every platform.
+const serviceStopEnv = "EMIL_SERVICE_STOP"
+
+// serviceInstall holds the flags of emil service install
+type serviceInstall struct {
+	name       string
+	schedule   string
+	interval   time.Duration
+	user       string
+	unitDir    string
+	conversion []string
+}
+
+// runService implements "emil service install", which registers emil with the
+// system's service manager, and "emil service run", which the installed
+// service runs to convert on an interval until it is stopped
+func runService(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "install":
+			return runServiceInstall(args[1:])
+		case "run":
+			return runServiceRun(args[1:])
+		}
+	}
+	return fmt.Errorf("usage: emil service install|run [flags] -- [conversion flags]")
+}
+
+// runServiceInstall implements "emil service install": a systemd timer or
+// long-running service on Linux, a Windows service on Windows
+func runServiceInstall(args []string) error {
+	var opts serviceInstall
+	flags := flag.NewFlagSet("service install", flag.ExitOnError)
+	flags.StringVar(&opts.name, "name", "emil", "Name of the service (and systemd timer)")
+	flags.StringVar(&opts.schedule, "schedule", "daily", "systemd OnCalendar expression for when the conversion runs, e.g. hourly or \"*-*-* 02:00\"; ignored with -interval")
+	flags.DurationVar(&opts.interval, "interval", 0, "Install a long-running service that starts a conversion this often, e.g. 1h, instead of a systemd timer (default 24h on Windows, where there is no timer)")
+	flags.StringVar(&opts.user, "user", "", "User the conversion runs as (default: root, or LocalSystem on Windows)")
+	flags.StringVar(&opts.unitDir, "unit-dir", "/etc/systemd/system", "Directory the systemd unit files are written to")
+	flags.Parse(args)
+	opts.conversion = flags.Args()
+
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	return installService(opts, exe)
+}
+
+// runServiceRun implements "emil service run": it runs a conversion with the
+// flags after -- every interval until the service manager, or an interrupt,
+// stops it
+func runServiceRun(args []string) error {
+	flags := flag.NewFlagSet("service run", flag.ExitOnError)
+	name := flags.String("name", "emil", "Name the service was installed as, which is also its event log source on Windows")
+	interval := flags.Duration("interval", time.Hour, "Time from the start of one conversion to the start of the next")
+	retryDelay := flags.Duration("retry-delay", 5*time.Minute, "Delay before a conversion that could not run (exit status 2) is tried again")
+	flags.Parse(args)
+	if *interval <= 0 {
+		return fmt.Errorf("-interval must be positive")
+	}
+
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	conversion := flags.Args()
+	return runManaged(*name, func(ctx context.Context, logs io.Writer) error {
+		return serveConversions(ctx, exe, conversion, *interval, *retryDelay, logs)
+	})
+}
+
+// serveConversions runs a conversion every interval until ctx is done, sending
+// its output to logs. A conversion in progress is asked to stop gracefully.
+func serveConversions(ctx context.Context, exe string, args []string, interval, retryDelay time.Duration, logs io.Writer) error {
+	for {
+		started := time.Now()
+		code, err := runConversion(ctx, exe, args, logs)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		wait := interval - time.Since(started)
+		switch {
+		case err != nil:
+			log.Printf("Conversion could not start: %v", err)
+			wait = retryDelay
+		case code == exitFatal:
+			log.Printf("Conversion failed with exit status %d", code)
+			wait = retryDelay
+		default:
+			log.Printf("Conversion finished with exit status %d", code)
+		}
+		if wait < 0 {
+			wait = 0
+		}
+		log.Printf("Next conversion at %s", time.Now().Add(wait).Format(time.RFC3339))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// runConversion runs one conversion and returns its exit status. When ctx is
+// done, it closes the conversion's standard input, which stops it as SIGTERM
+// would, and kills it if it hasn't exited after serviceStopTimeout.
+func runConversion(ctx context.Context, exe string, args []string, logs io.Writer) (int, error) {
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Stdout, cmd.Stderr = logs, logs
+	cmd.Env = append(os.Environ(), serviceStopEnv+"=stdin")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	cmd.Cancel = stdin.Close
+	cmd.WaitDelay = serviceStopTimeout
+
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	// Wait reports a graceful stop as the context's error; the exit status
+	// is what counts
+	err = cmd.Wait()
+	if cmd.ProcessState != nil && cmd.ProcessState.Exited() {
+		return cmd.ProcessState.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// serviceStopRequested returns a channel that is closed when the service that
+// started this conversion stops, or nil when it wasn't started by one
+func serviceStopRequested() <-chan struct{} {
+	if os.Getenv(serviceStopEnv) != "stdin" {
+		return nil
+	}
+	stop := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, os.Stdin)
+		close(stop)
+	}()
+	return stop
+}
+
+// serveUntilSignal runs serve until it returns or an interrupt or SIGTERM
+// arrives, calling stopping when one does
+func serveUntilSignal(serve func(ctx context.Context, logs io.Writer) error, stopping func()) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stopping()
+	}()
+	return serve(ctx, os.Stdout)
+}
+
+// serviceArgs returns the arguments the installed service starts emil with
+func serviceArgs(opts serviceInstall) []string {
+	args := []string{"service", "run", "-name", opts.name, "-interval", opts.interval.String(), "--"}
+	return append(args, opts.conversion...)
+}
+
+// systemdUnits returns the units that run exe as opts asks: a oneshot service
+// and the timer that starts it, or with an interval a long-running service
+// and no timer
+func systemdUnits(opts serviceInstall, exe string) (service, timer string) {
+	args := opts.conversion
+	if opts.interval > 0 {
+		args = serviceArgs(opts)
+	}
+	command := []string{systemdQuote(exe)}
+	for _, arg := range args {
+		command = append(command, systemdQuote(arg))
+	}
+
+	var unit strings.Builder
+	fmt.Fprintf(&unit, "[Unit]\nDescription=Emil EML to PDF conversion (%s)\n", opts.name)
+	fmt.Fprintf(&unit, "After=network-online.target\nWants=network-online.target\n\n")
+	if opts.interval > 0 {
+		// emil service run reports when it is ready and stopping, and stops
+		// the conversion in progress itself
+		fmt.Fprintf(&unit, "[Service]\nType=notify\nNotifyAccess=main\nExecStart=%s\n", strings.Join(command, " "))
+	} else {
+		fmt.Fprintf(&unit, "[Service]\nType=oneshot\nExecStart=%s\n", strings.Join(command, " "))
+	}
+	if opts.user != "" {
+		fmt.Fprintf(&unit, "User=%s\n", opts.user)
+	}
+	// SIGTERM lets the run finish its reports; failed runs are retried
+	if opts.interval > 0 {
+		fmt.Fprintf(&unit, "KillMode=mixed\nKillSignal=SIGTERM\nTimeoutStopSec=%d\n", int((serviceStopTimeout + 30*time.Second).Seconds()))
+		fmt.Fprintf(&unit, "Restart=on-failure\nRestartSec=30s\n")
+	} else {
+		fmt.Fprintf(&unit, "KillSignal=SIGTERM\nTimeoutStopSec=120\n")
+		fmt.Fprintf(&unit, "Restart=on-failure\nRestartSec=5min\n")
+	}
+	fmt.Fprintf(&unit, "Nice=10\nIOSchedulingClass=best-effort\nIOSchedulingPriority=7\n")
+	fmt.Fprintf(&unit, "StandardOutput=journal\nStandardError=journal\nSyslogIdentifier=%s\n", opts.name)
+	if opts.interval > 0 {
+		fmt.Fprintf(&unit, "\n[Install]\nWantedBy=multi-user.target\n")
+		return unit.String(), ""
+	}
+
+	timer = fmt.Sprintf("[Unit]\nDescription=Run %s on a schedule\n\n[Timer]\nOnCalendar=%s\nPersistent=true\n\n[Install]\nWantedBy=timers.target\n",
+		opts.name, opts.schedule)
+	return unit.String(), timer
+}
+
+// executablePath returns the path of the running emil binary
+func executablePath() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the emil binary: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", fmt.Errorf("failed to find the emil binary: %w", err)
+	}
+	return exe, nil
+}
+
+// systemdQuote quotes an ExecStart argument, escaping the characters systemd
+// expands
+func systemdQuote(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\;") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
@@ -0,0 +1,66 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// installService writes the systemd units for opts
+func installService(opts serviceInstall, exe string) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("emil service install supports systemd on Linux and the service manager on Windows only; elsewhere schedule emil service run with the system's own tools")
+	}
+
+	service, timer := systemdUnits(opts, exe)
+	servicePath := filepath.Join(opts.unitDir, opts.name+".service")
+	if err := os.WriteFile(servicePath, []byte(service), 0644); err != nil {
+		return fmt.Errorf("failed to write service unit: %w", err)
+	}
+	if timer == "" {
+		fmt.Printf("Wrote %s\n", servicePath)
+		fmt.Printf("Enable with:\n  systemctl daemon-reload\n  systemctl enable --now %s.service\n", opts.name)
+		fmt.Printf("Follow runs with:\n  journalctl -u %s.service -f\n", opts.name)
+		return nil
+	}
+
+	timerPath := filepath.Join(opts.unitDir, opts.name+".timer")
+	if err := os.WriteFile(timerPath, []byte(timer), 0644); err != nil {
+		return fmt.Errorf("failed to write timer unit: %w", err)
+	}
+	fmt.Printf("Wrote %s and %s\n", servicePath, timerPath)
+	fmt.Printf("Enable with:\n  systemctl daemon-reload\n  systemctl enable --now %s.timer\n", opts.name)
+	fmt.Printf("Follow runs with:\n  journalctl -u %s.service -f\n", opts.name)
+	return nil
+}
+
+// runManaged runs serve until SIGTERM, telling systemd when the service is
+// ready and when it is stopping
+func runManaged(name string, serve func(ctx context.Context, logs io.Writer) error) error {
+	sdNotify("READY=1")
+	return serveUntilSignal(serve, func() { sdNotify("STOPPING=1") })
+}
+
+// sdNotify sends a state change to systemd when it started emil with
+// Type=notify, and does nothing otherwise
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:] // Abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(state))
+}
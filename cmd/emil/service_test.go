@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSystemdUnits(t *testing.T) {
+	opts := serviceInstall{name: "emil-archive", schedule: "hourly", conversion: []string{"-src", "/srv/mail dir"}}
+
+	service, timer := systemdUnits(opts, "/usr/bin/emil")
+	for _, want := range []string{"Type=oneshot", `ExecStart=/usr/bin/emil -src "/srv/mail dir"`} {
+		if !strings.Contains(service, want) {
+			t.Errorf("timer service unit lacks %q:\n%s", want, service)
+		}
+	}
+	if !strings.Contains(timer, "OnCalendar=hourly") {
+		t.Errorf("timer unit lacks the schedule:\n%s", timer)
+	}
+
+	opts.interval = time.Hour
+	service, timer = systemdUnits(opts, "/usr/bin/emil")
+	for _, want := range []string{
+		"Type=notify",
+		`ExecStart=/usr/bin/emil service run -name emil-archive -interval 1h0m0s -- -src "/srv/mail dir"`,
+		"KillMode=mixed",
+		"WantedBy=multi-user.target",
+	} {
+		if !strings.Contains(service, want) {
+			t.Errorf("long-running service unit lacks %q:\n%s", want, service)
+		}
+	}
+	if timer != "" {
+		t.Errorf("long-running service has a timer:\n%s", timer)
+	}
+}
+
+func TestRunConversionStopsOnCancel(t *testing.T) {
+	// cat stands in for a conversion: it runs until its standard input closes
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat is not available")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int, 1)
+	go func() {
+		code, err := runConversion(ctx, cat, nil, io.Discard)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- code
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case code := <-done:
+		if code != exitOK {
+			t.Errorf("exit status = %d, want %d after a graceful stop", code, exitOK)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("conversion did not stop when its input closed")
+	}
+}
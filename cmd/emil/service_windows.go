@@ -0,0 +1,162 @@
+//go:build windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// installService registers emil service run with the service control manager,
+// starting automatically and restarted when it fails, and its event log source
+func installService(opts serviceInstall, exe string) error {
+	if opts.interval <= 0 {
+		opts.interval = 24 * time.Hour
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(opts.name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists", opts.name)
+	}
+	s, err := m.CreateService(opts.name, exe, mgr.Config{
+		DisplayName:      fmt.Sprintf("Emil EML to PDF conversion (%s)", opts.name),
+		Description:      fmt.Sprintf("Converts EML files to PDF every %s", opts.interval),
+		StartType:        mgr.StartAutomatic,
+		DelayedAutoStart: true,
+		ServiceStartName: opts.user,
+	}, serviceArgs(opts)...)
+	if err != nil {
+		return fmt.Errorf("failed to create service %s: %w", opts.name, err)
+	}
+	defer s.Close()
+
+	// Restart after a crash or an exit with an error, backing off, and forget
+	// failures after a day
+	restarts := []mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Minute},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Minute},
+	}
+	if err := s.SetRecoveryActions(restarts, uint32((24 * time.Hour).Seconds())); err != nil {
+		return fmt.Errorf("failed to set the recovery actions of %s: %w", opts.name, err)
+	}
+	if err := s.SetRecoveryActionsOnNonCrashFailures(true); err != nil {
+		return fmt.Errorf("failed to set the recovery actions of %s: %w", opts.name, err)
+	}
+
+	if err := eventlog.InstallAsEventCreate(opts.name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil &&
+		!strings.Contains(err.Error(), "exists") {
+		return fmt.Errorf("failed to add event log source %s: %w", opts.name, err)
+	}
+
+	fmt.Printf("Installed service %s\n", opts.name)
+	fmt.Printf("Start it with:\n  sc.exe start %s\n", opts.name)
+	fmt.Printf("Its output is in the Application event log, source %s\n", opts.name)
+	return nil
+}
+
+// runManaged runs serve under the service control manager, sending emil's log
+// and the conversions' output to the event log. Run from a console, it runs
+// serve until interrupted instead.
+func runManaged(name string, serve func(ctx context.Context, logs io.Writer) error) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("failed to detect the service manager: %w", err)
+	}
+	if !isService {
+		return serveUntilSignal(serve, func() {})
+	}
+
+	events, err := eventlog.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open event log source %s: %w", name, err)
+	}
+	defer events.Close()
+	logs := &eventWriter{events: events}
+	log.SetOutput(logs)
+	log.SetFlags(0)
+
+	return svc.Run(name, &windowsService{serve: serve, logs: logs})
+}
+
+// windowsService answers the service control manager while serve runs
+type windowsService struct {
+	serve func(ctx context.Context, logs io.Writer) error
+	logs  io.Writer
+}
+
+// Execute implements svc.Handler
+func (s *windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.serve(ctx, s.logs) }()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				log.Printf("Error: %v", err)
+				// A service-specific exit code, which triggers the recovery actions
+				return true, exitFatal
+			}
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32(serviceStopTimeout / time.Millisecond)}
+				cancel()
+			}
+		}
+	}
+}
+
+// eventWriter writes each line written to it as an event, an error event for
+// lines starting with "Error"
+type eventWriter struct {
+	mu     sync.Mutex
+	events *eventlog.Log
+	line   []byte
+}
+
+func (w *eventWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.line = append(w.line, p...)
+	for {
+		end := bytes.IndexByte(w.line, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		text := strings.TrimSpace(string(w.line[:end]))
+		w.line = w.line[end+1:]
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "Error") {
+			w.events.Error(1, text)
+		} else {
+			w.events.Info(1, text)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"emil/internal/metadata"
+	"emil/internal/validate"
+)
+
+// runValidate implements "emil validate": it parses every EML file and lists
+// the problems found without writing any PDFs
+func runValidate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	srcDir := flags.String("src", ".", "Source directory to scan for EML files")
+	recursive := flags.Bool("recursive", true, "Recursively scan directories")
+	format := flags.String("format", "text", "Output format: text or json (one object per line)")
+	output := flags.String("o", "", "Write the results to this file (default: standard output)")
+	all := flags.Bool("all", false, "List files without issues too")
+	flags.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unsupported validate format %q (available: text, json)", *format)
+	}
+
+	files, err := metadata.FindEMLFiles(*srcDir, *recursive)
+	if err != nil {
+		return fmt.Errorf("file discovery failed: %w", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create results file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+
+	var failed, warned int
+	for _, path := range files {
+		result := validate.Check(path)
+		switch {
+		case result.HasErrors():
+			failed++
+		case len(result.Issues) > 0:
+			warned++
+		case !*all:
+			continue
+		}
+
+		if *format == "json" {
+			if err := encoder.Encode(result); err != nil {
+				return fmt.Errorf("failed to write results: %w", err)
+			}
+			continue
+		}
+		if len(result.Issues) == 0 {
+			fmt.Fprintf(out, "%s: ok\n", path)
+		}
+		for _, issue := range result.Issues {
+			fmt.Fprintf(out, "%s: %s %s: %s\n", path, issue.Severity, issue.Kind, issue.Detail)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Checked %d EML files: %d with errors, %d with warnings only\n", len(files), failed, warned)
+	if failed > 0 {
+		return &partialError{fmt.Sprintf("%d files have errors", failed)}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"emil/internal/archive"
+	"emil/internal/config"
+	"emil/internal/discovery"
+	"emil/internal/manager"
+)
+
+// runVerify implements "emil verify": it checks that every message the run
+// would have converted has an intact PDF, and that files match the audit log
+// when one is given. The discovery flags match the run's, so verify finds
+// the same messages and leaves out the same output directories.
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	srcDir := flags.String("src", ".", "Directory of converted EML files to check")
+	recursive := flags.Bool("recursive", true, "Recursively scan directories")
+	symlinks := flags.String("symlinks", discovery.SymlinksFiles, "Symbolic links in the source tree, as given to the run: files, follow or skip")
+	oneFilesystem := flags.Bool("one-filesystem", false, "Stay on the source directory's filesystem, as given to the run")
+	extensions := flags.String("ext", ".eml", "Comma-separated file extensions the run converted")
+	sniff := flags.Bool("sniff", false, "Also check files with other extensions, or none, that start like an RFC 822 message, as the run's -sniff did")
+	attachmentDir := flags.String("attachment-dir", "", "The run's -attachment-dir, left out of the check")
+	attachmentStore := flags.String("attachment-store", "", "The run's -attachment-store, left out of the check")
+	quarantineDir := flags.String("quarantine-dir", "", "The run's -quarantine-dir, left out of the check")
+	auditLog := flags.String("audit-log", "", "Audit log written by -audit-log; source and PDF hashes are compared with it")
+	format := flags.String("format", "text", "Output format: text or json (one object per line)")
+	output := flags.String("o", "", "Write the results to this file (default: standard output)")
+	flags.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unsupported verify format %q (available: text, json)", *format)
+	}
+	if err := discovery.CheckSymlinks(*symlinks); err != nil {
+		return err
+	}
+
+	var manifest archive.Manifest
+	if *auditLog != "" {
+		var err error
+		if manifest, err = archive.LoadManifest(*auditLog); err != nil {
+			return err
+		}
+	}
+
+	source, err := filepath.Abs(*srcDir)
+	if err != nil {
+		return fmt.Errorf("invalid -src %q: %w", *srcDir, err)
+	}
+	cfg := &config.Config{
+		SourceDir:       source,
+		RecursiveScan:   *recursive,
+		Symlinks:        *symlinks,
+		OneFilesystem:   *oneFilesystem,
+		Extensions:      splitList(*extensions),
+		SniffContent:    *sniff,
+		AttachmentDir:   *attachmentDir,
+		AttachmentStore: *attachmentStore,
+		QuarantineDir:   *quarantineDir,
+	}
+	var files []string
+	err = discovery.Walk(source, manager.DiscoveryOptions(cfg), func(path string, _ os.FileInfo) error {
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("file discovery failed: %w", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create results file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	encoder := json.NewEncoder(out)
+
+	counts := make(map[string]int)
+	failed := 0
+	for _, path := range files {
+		problems := archive.Check(path, manifest)
+		if len(problems) > 0 {
+			failed++
+		}
+		for _, problem := range problems {
+			counts[problem.Kind]++
+			if *format == "json" {
+				if err := encoder.Encode(problem); err != nil {
+					return fmt.Errorf("failed to write results: %w", err)
+				}
+				continue
+			}
+			target := problem.Source
+			if problem.Output != "" {
+				target = problem.Output
+			}
+			fmt.Fprintf(out, "%s: %s: %s\n", target, problem.Kind, problem.Detail)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Checked %d messages: %d with problems", len(files), failed)
+	for _, kind := range []string{archive.KindMissing, archive.KindCorrupt, archive.KindHashMismatch, archive.KindSourceChange, archive.KindUnrecorded} {
+		if counts[kind] > 0 {
+			fmt.Fprintf(os.Stderr, ", %d %s", counts[kind], kind)
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+	if failed > 0 {
+		return &partialError{fmt.Sprintf("%d files have problems", failed)}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"emil/internal/audit"
+	"emil/internal/converter"
+	"emil/internal/models"
+)
+
+// Kinds of problem found in an archive
+const (
+	KindMissing      = "missing"        // No PDF for a source EML
+	KindCorrupt      = "corrupt"        // The PDF is empty or truncated
+	KindHashMismatch = "hash-mismatch"  // The PDF differs from the one recorded in the audit log
+	KindSourceChange = "source-changed" // The EML differs from the one recorded in the audit log
+	KindUnrecorded   = "unrecorded"     // The audit log has no successful conversion of the EML
+)
+
+// Bytes read from each end of a PDF to check its markers
+const pdfMarkerWindow = 1024
+
+// Problem is one gap or corruption found for a source EML
+type Problem struct {
+	Source string `json:"source"`
+	Output string `json:"output,omitempty"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// Manifest maps the absolute path of a source EML to its latest successful
+// conversion
+type Manifest map[string]audit.Entry
+
+// LoadManifest reads the latest successful conversion of each file from an audit log
+func LoadManifest(auditLog string) (Manifest, error) {
+	entries, err := audit.Read(auditLog)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make(Manifest)
+	for _, entry := range entries {
+		if entry.Status == string(models.StatusComplete) {
+			manifest[absPath(entry.Source.Path)] = entry
+		}
+	}
+	return manifest, nil
+}
+
+// absPath returns path made absolute, or as it is if that fails. Paths in
+// audit logs written before sources were recorded absolute are taken as
+// relative to the working directory.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Check verifies the outputs of one source EML, comparing hashes with the
+// manifest when one is given
+func Check(source string, manifest Manifest) []Problem {
+	var problems []Problem
+	add := func(output, kind, format string, args ...any) {
+		problems = append(problems, Problem{Source: source, Output: output, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	// Outputs recorded in the audit log are checked where they were written,
+	// which routing rules may have put away from the source
+	key := absPath(source)
+	outputs := converter.OutputFiles(source)
+	if entry, ok := manifest[key]; ok && len(entry.Outputs) > 0 {
+		outputs = nil
+		for _, recorded := range entry.Outputs {
+			outputs = append(outputs, recorded.Path)
+		}
+	}
+	if len(outputs) == 0 {
+		add(converter.PDFPath(source), KindMissing, "no PDF was found")
+	}
+	for _, output := range outputs {
+		// Missing recorded outputs are reported with the audit log comparison
+		if err := CheckPDF(output); err != nil && !os.IsNotExist(err) {
+			add(output, KindCorrupt, "%v", err)
+		}
+	}
+
+	if manifest == nil {
+		return problems
+	}
+	entry, ok := manifest[key]
+	if !ok {
+		add("", KindUnrecorded, "the audit log has no successful conversion of this file")
+		return problems
+	}
+	if digest := audit.Digest(source); digest.SHA256 != entry.Source.SHA256 {
+		add("", KindSourceChange, "SHA-256 is %s, audit log recorded %s", digest.SHA256, entry.Source.SHA256)
+	}
+	for _, recorded := range entry.Outputs {
+		digest := audit.Digest(recorded.Path)
+		switch {
+		case digest.Error != "":
+			add(recorded.Path, KindMissing, "recorded in the audit log but unreadable: %s", digest.Error)
+		case digest.SHA256 != recorded.SHA256:
+			add(recorded.Path, KindHashMismatch, "SHA-256 is %s, audit log recorded %s", digest.SHA256, recorded.SHA256)
+		}
+	}
+	return problems
+}
+
+// CheckPDF fails if a file doesn't start with a PDF header or end with an
+// end-of-file marker, as happens when a write was cut short
+func CheckPDF(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("file is empty")
+	}
+
+	head := make([]byte, min(pdfMarkerWindow, info.Size()))
+	if _, err := io.ReadFull(file, head); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if !bytes.HasPrefix(head, []byte("%PDF-")) {
+		return fmt.Errorf("file has no PDF header")
+	}
+
+	tail := make([]byte, min(pdfMarkerWindow, info.Size()))
+	if _, err := file.ReadAt(tail, info.Size()-int64(len(tail))); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return fmt.Errorf("file has no end-of-file marker (truncated)")
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// genesisHash is the previous hash of the first entry in a log
+const genesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Entry records one conversion. Each entry holds the hash of the entry
+// before it, so removing, reordering or editing lines breaks the chain. The
+// chain has no key: someone who can write the log can cut its end off, or
+// rewrite it with a fresh chain, without breaking it. Each run therefore
+// records the sequence and hash of the log's last entry in its report (see
+// Head), and VerifyAnchor checks the log against such an anchor.
+type Entry struct {
+	Sequence     int64        `json:"seq"`
+	Time         time.Time    `json:"time"`
+	User         string       `json:"user"`
+	Host         string       `json:"host"`
+	Version      string       `json:"version"` // emil build that did the conversion
+	Source       FileDigest   `json:"source"`
+	Outputs      []FileDigest `json:"outputs,omitempty"`
+	Status       string       `json:"status"`
+	Error        string       `json:"error,omitempty"`
+	PreviousHash string       `json:"prev_hash"`
+	Hash         string       `json:"hash"` // SHA-256 of the entry with this field empty
+}
+
+// FileDigest identifies a file by path, size and content hash
+type FileDigest struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"` // Empty if the file could not be read
+	Error  string `json:"error,omitempty"`
+}
+
+// Log appends hash-chained entries to an audit file. It is safe for
+// concurrent use.
+type Log struct {
+	mu       sync.Mutex
+	file     *os.File
+	sequence int64
+	lastHash string
+	size     int64 // Length of the log, where a partly written entry is cut off
+	broken   error // Why the log can't take more entries after a failed write
+	user     string
+	host     string
+	version  string
+}
+
+// Open opens the audit log at path for appending, creating it if needed. An
+// existing log must be intact, so new entries continue its chain.
+func Open(path, version string) (*Log, error) {
+	last, err := verify(path, nil)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	log := &Log{file: file, lastHash: genesisHash, size: info.Size(), version: version}
+	if last != nil {
+		log.sequence = last.Sequence
+		log.lastHash = last.Hash
+	}
+	if current, err := user.Current(); err == nil {
+		log.user = current.Username
+	}
+	log.host, _ = os.Hostname()
+	return log, nil
+}
+
+// Record hashes the source and output files and appends an entry for them
+func (l *Log) Record(source string, outputs []string, status, errMsg string) error {
+	entry := Entry{
+		Source: Digest(source),
+		Status: status,
+		Error:  errMsg,
+	}
+	for _, output := range outputs {
+		entry.Outputs = append(entry.Outputs, Digest(output))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.broken != nil {
+		return l.broken
+	}
+
+	// The log's head only moves once the entry is written
+	entry.Sequence = l.sequence + 1
+	entry.Time = time.Now().UTC()
+	entry.User = l.user
+	entry.Host = l.host
+	entry.Version = l.version
+	entry.PreviousHash = l.lastHash
+	entry.Hash = entryHash(entry)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		// Cut off whatever part of the entry was written, so the next one
+		// continues the chain on a line of its own
+		if truncErr := l.file.Truncate(l.size); truncErr != nil {
+			l.broken = fmt.Errorf("audit log has a partly written entry after a failed write: %w", truncErr)
+		}
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	l.sequence, l.lastHash = entry.Sequence, entry.Hash
+	l.size += int64(len(data)) + 1
+	return nil
+}
+
+// Head returns the sequence and hash of the last entry written, which is 0
+// and the genesis hash for an empty log
+func (l *Log) Head() (int64, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sequence, l.lastHash
+}
+
+// Close flushes the log to disk and closes it
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.file.Sync(); err != nil {
+		l.file.Close()
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	return l.file.Close()
+}
+
+// Digest hashes a file, recording why if it cannot be read
+func Digest(path string) FileDigest {
+	digest := FileDigest{Path: path}
+	file, err := os.Open(path)
+	if err != nil {
+		digest.Error = err.Error()
+		return digest
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		digest.Error = err.Error()
+		return digest
+	}
+	digest.Size = size
+	digest.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return digest
+}
+
+// Verify checks that every entry in the audit log is unaltered and chained
+// to the one before it, returning the number of entries
+func Verify(path string) (int64, error) {
+	last, err := verify(path, nil)
+	if err != nil {
+		return 0, err
+	}
+	if last == nil {
+		return 0, nil
+	}
+	return last.Sequence, nil
+}
+
+// VerifyAnchor verifies the audit log like Verify and checks that its entry
+// sequence still has hash, as recorded outside the log by Head. This catches
+// a log cut short before that entry or rewritten with a fresh chain, which
+// the chain alone can't show.
+func VerifyAnchor(path string, sequence int64, hash string) (int64, error) {
+	anchored := genesisHash
+	last, err := verify(path, func(entry Entry) {
+		if entry.Sequence == sequence {
+			anchored = entry.Hash
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	var entries int64
+	if last != nil {
+		entries = last.Sequence
+	}
+	if entries < sequence {
+		return entries, fmt.Errorf("audit log ends at entry %d but entry %d was anchored; entries were removed", entries, sequence)
+	}
+	if anchored != hash {
+		return entries, fmt.Errorf("audit log entry %d does not match its anchor; the log was rewritten", sequence)
+	}
+	return entries, nil
+}
+
+// Read verifies the audit log and returns its entries, oldest first
+func Read(path string) ([]Entry, error) {
+	var entries []Entry
+	if _, err := verify(path, func(entry Entry) { entries = append(entries, entry) }); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// verify checks the chain, passing each entry to visit (if not nil), and
+// returns the last entry (nil for an empty log)
+func verify(path string, visit func(Entry)) (*Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var last *Entry
+	previous := genesisHash
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("audit log line %d is corrupt: %w", line, err)
+		}
+		if entry.Sequence != int64(line) {
+			return nil, fmt.Errorf("audit log line %d has sequence %d; entries were removed or reordered", line, entry.Sequence)
+		}
+		if entry.PreviousHash != previous {
+			return nil, fmt.Errorf("audit log line %d does not follow the entry before it", line)
+		}
+		if entryHash(entry) != entry.Hash {
+			return nil, fmt.Errorf("audit log line %d was altered", line)
+		}
+		previous = entry.Hash
+		last = &entry
+		if visit != nil {
+			visit(entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return last, nil
+}
+
+// entryHash returns the SHA-256 of an entry's JSON with the hash field empty
+func entryHash(entry Entry) string {
+	entry.Hash = ""
+	data, _ := json.Marshal(entry)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeLog records n entries in a new audit log and returns its path and head
+func writeLog(t *testing.T, n int) (string, int64, string) {
+	t.Helper()
+	dir := t.TempDir()
+	source := filepath.Join(dir, "a.eml")
+	if err := os.WriteFile(source, []byte("Subject: a\r\n\r\nbody\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "audit.jsonl")
+	log, err := Open(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := log.Record(source, nil, "complete", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sequence, hash := log.Head()
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path, sequence, hash
+}
+
+// rewriteLines replaces the log's lines with edit's result
+func rewriteLines(t *testing.T, path string, edit func([]string) []string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := edit(strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyDetectsEdits(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func([]string) []string
+	}{
+		{"edited", func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"complete"`, `"failed"`, 1)
+			return lines
+		}},
+		{"removed", func(lines []string) []string { return append(lines[:1], lines[2:]...) }},
+		{"reordered", func(lines []string) []string {
+			lines[0], lines[1] = lines[1], lines[0]
+			return lines
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, _, _ := writeLog(t, 3)
+			if _, err := Verify(path); err != nil {
+				t.Fatalf("Verify of an intact log: %v", err)
+			}
+			rewriteLines(t, path, tt.edit)
+			if _, err := Verify(path); err == nil {
+				t.Error("Verify accepted an altered log")
+			}
+		})
+	}
+}
+
+func TestVerifyAnchor(t *testing.T) {
+	path, sequence, hash := writeLog(t, 3)
+	if entries, err := VerifyAnchor(path, sequence, hash); err != nil || entries != 3 {
+		t.Fatalf("VerifyAnchor of an intact log = %d, %v; want 3 entries", entries, err)
+	}
+
+	// Later runs append to the log without breaking earlier anchors
+	log, err := Open(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Record(path, nil, "complete", ""); err != nil {
+		t.Fatal(err)
+	}
+	log.Close()
+	if _, err := VerifyAnchor(path, sequence, hash); err != nil {
+		t.Fatalf("VerifyAnchor after a later run: %v", err)
+	}
+
+	// Cutting the end off leaves an intact chain, which only the anchor shows
+	rewriteLines(t, path, func(lines []string) []string { return lines[:2] })
+	if _, err := Verify(path); err != nil {
+		t.Fatalf("Verify of a truncated log: %v", err)
+	}
+	if _, err := VerifyAnchor(path, sequence, hash); err == nil {
+		t.Error("VerifyAnchor accepted a truncated log")
+	}
+
+	// So does rewriting the log with a fresh chain
+	other, _, _ := writeLog(t, 3)
+	if _, err := VerifyAnchor(other, sequence, hash); err == nil {
+		t.Error("VerifyAnchor accepted a rewritten log")
+	}
+}
+
+func TestFailedWriteKeepsHead(t *testing.T) {
+	path, sequence, hash := writeLog(t, 2)
+	log, err := Open(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	// A handle that can't be written makes the next entry fail
+	writable := log.file
+	if log.file, err = os.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Record(path, nil, "complete", ""); err == nil {
+		t.Fatal("Record succeeded on a read-only log")
+	}
+	log.file.Close()
+	log.file = writable
+
+	if gotSequence, gotHash := log.Head(); gotSequence != sequence || gotHash != hash {
+		t.Errorf("Head after a failed write = %d, %s; want %d, %s", gotSequence, gotHash, sequence, hash)
+	}
+	if _, err := VerifyAnchor(path, sequence, hash); err != nil {
+		t.Errorf("VerifyAnchor after a failed write: %v", err)
+	}
+}
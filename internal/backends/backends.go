@@ -0,0 +1,97 @@
+// Package backends keeps what a run has learned about its rendering
+// backends, shared by all of its conversions: which were found available,
+// and which it has given up on after repeated failures.
+package backends
+
+import (
+	"log"
+	"sync"
+)
+
+// Tracker holds one run's view of its backends. A nil Tracker remembers
+// nothing: backends are probed on every use and never given up on.
+type Tracker struct {
+	mu        sync.Mutex
+	available map[string]bool
+	breakers  map[string]*Breaker
+}
+
+// New returns a tracker for a run that hasn't probed any backend yet
+func New() *Tracker {
+	return &Tracker{
+		available: make(map[string]bool),
+		breakers:  make(map[string]*Breaker),
+	}
+}
+
+// Available reports whether a backend can be used, calling probe the first
+// time the run asks about it
+func (t *Tracker) Available(name string, probe func() bool) bool {
+	if t == nil {
+		return probe()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ok, checked := t.available[name]
+	if !checked {
+		ok = probe()
+		t.available[name] = ok
+	}
+	return ok
+}
+
+// Breaker returns the circuit breaker for a backend
+func (t *Tracker) Breaker(name string) *Breaker {
+	if t == nil {
+		return &Breaker{name: name}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.breakers[name]
+	if !ok {
+		b = &Breaker{name: name}
+		t.breakers[name] = b
+	}
+	return b
+}
+
+// Breaker stops trying a backend once it has failed several times in a row,
+// so the rest of the run doesn't pay for attempts that won't succeed
+type Breaker struct {
+	name     string
+	mu       sync.Mutex
+	failures int  // Consecutive failures
+	open     bool // The backend is no longer tried
+}
+
+// Allow reports whether the backend should be tried
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.open
+}
+
+// Success resets the failure count
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+// Failure counts a failed render and opens the breaker once the threshold
+// is reached (0 = never), logging a single warning when it does
+func (b *Breaker) Failure(threshold int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.open || threshold <= 0 || b.failures < threshold {
+		return
+	}
+
+	b.open = true
+	log.Printf("WARNING: %s rendering failed %d times in a row (last error: %v). "+
+		"Remaining files in this run will use the next renderer in -renderer-order.", b.name, b.failures, err)
+}
@@ -0,0 +1,47 @@
+package backends
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAvailableProbesOncePerTracker(t *testing.T) {
+	probes := 0
+	probe := func() bool {
+		probes++
+		return true
+	}
+
+	tracker := New()
+	tracker.Available("chrome", probe)
+	tracker.Available("chrome", probe)
+	if probes != 1 {
+		t.Errorf("probed %d times in one run, want 1", probes)
+	}
+
+	New().Available("chrome", probe)
+	if probes != 2 {
+		t.Errorf("a new run reused the last run's probe")
+	}
+}
+
+func TestBreakerIsPerTracker(t *testing.T) {
+	failed := errors.New("render failed")
+
+	tracker := New()
+	for range 3 {
+		tracker.Breaker("chrome").Failure(3, failed)
+	}
+	if tracker.Breaker("chrome").Allow() {
+		t.Error("breaker still allows chrome after 3 failures in a row")
+	}
+	if !New().Breaker("chrome").Allow() {
+		t.Error("a new run inherited the last run's open breaker")
+	}
+
+	var none *Tracker
+	none.Breaker("chrome").Failure(1, failed)
+	if !none.Breaker("chrome").Allow() {
+		t.Error("a nil tracker gave up on a renderer")
+	}
+}
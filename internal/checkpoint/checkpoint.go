@@ -0,0 +1,121 @@
+package checkpoint
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry records one source file that was converted. The checkpoint file
+// holds one JSON object per line, appended as files finish, so a run that is
+// killed loses at most the line being written.
+type Entry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Checkpoint remembers the files earlier runs converted, so a run stopped at
+// a budget or interrupted leaves the rest to the next one. It is safe for
+// concurrent use.
+type Checkpoint struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[string]Entry
+}
+
+// Open reads the checkpoint at path and opens it for appending, creating it
+// if needed. A line cut off when a run was killed is ignored, which costs
+// converting that one file again.
+func Open(path string) (*Checkpoint, error) {
+	done, complete, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint: %w", err)
+	}
+	// End a cut-off line, so the next entry starts on its own
+	if !complete {
+		if _, err := file.Write([]byte{'\n'}); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write checkpoint: %w", err)
+		}
+	}
+	return &Checkpoint{file: file, done: done}, nil
+}
+
+// load reads the entries of a checkpoint file by path, the latest entry of
+// a file winning, and whether the file ends with a complete line
+func load(path string) (map[string]Entry, bool, error) {
+	done := make(map[string]Entry)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return done, true, nil
+		}
+		return nil, false, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		var entry Entry
+		if len(line) == 0 || json.Unmarshal(line, &entry) != nil || entry.Path == "" {
+			continue
+		}
+		done[entry.Path] = entry
+	}
+	return done, len(data) == 0 || data[len(data)-1] == '\n', nil
+}
+
+// Done reports whether a file was converted by an earlier run and hasn't
+// changed since, going by its size and modification time
+func (c *Checkpoint) Done(path string, size int64, modTime time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.done[path]
+	return ok && entry.Size == size && entry.ModTime.Equal(modTime)
+}
+
+// Len returns how many files the checkpoint holds
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.done)
+}
+
+// Record appends a converted file to the checkpoint
+func (c *Checkpoint) Record(path string, size int64, modTime time.Time) error {
+	entry := Entry{Path: path, Size: size, ModTime: modTime}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint entry: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	c.done[path] = entry
+	return nil
+}
+
+// Close flushes the checkpoint to disk and closes it
+func (c *Checkpoint) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.file.Sync(); err != nil {
+		c.file.Close()
+		return fmt.Errorf("failed to flush checkpoint: %w", err)
+	}
+	if err := c.file.Close(); err != nil {
+		return fmt.Errorf("failed to close checkpoint: %w", err)
+	}
+	return nil
+}
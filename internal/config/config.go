@@ -1,18 +1,282 @@
 package config
 
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"emil/internal/backends"
+	"emil/internal/hooks"
+	"emil/internal/manifest"
+	"emil/internal/migration"
+	"emil/internal/models"
+	"emil/internal/reputation"
+	"emil/internal/routing"
+	"emil/internal/sandbox"
+	"emil/internal/security"
+	"emil/internal/slots"
+)
+
 // Config holds application configuration
 type Config struct {
 	SourceDir     string
+	Sources       []Source // Every directory converted when there are several, SourceDir first (empty = SourceDir alone)
 	WorkerCount   int
 	Verbose       bool
 	RecursiveScan bool
-	MaxMemoryPct  int // Added field for memory percentage limit
+	Symlinks      string   // Symbolic link policy for discovery: "files", "follow" or "skip"
+	OneFilesystem bool     // Whether discovery stays on the source directory's filesystem
+	Extensions    []string // File extensions discovered as messages (empty = ".eml")
+	SniffContent  bool     // Whether files with other extensions, or none, are discovered when they look like RFC 822 messages
+	WalkWorkers   int      // Directories discovery reads at once (0 or 1 = one at a time)
+	MaxMemoryPct  int      // Added field for memory percentage limit
+	LargeFileMB   int      // Files at least this large, in MB, wait for memory headroom before starting (0 = no admission control)
+	TempDir       string   // Directory for temporary render files, e.g. a tmpfs (empty = system temp dir)
+	ProgressMode  string   // Progress display: "files", "bytes", "spinner" or "none" (empty = files)
+	BatchSize     int      // Small files a worker claims at once and converts with one Chrome tab (0 or 1 = one at a time)
+	BatchMaxKB    int      // Largest file, in KB, that is batched (0 = 16)
+	TextWorkers   int      // Workers that convert only messages without HTML, which never need Chrome (0 = no text lane)
+	QueueDepth    int      // Tasks queued ahead of the workers in each lane (0 = sized from the worker count and file sizes)
+	IOProfile     string   // How hard conversions press on storage: "gentle", "normal" or "aggressive" (empty = normal)
+	Retry         RetryOptions
+	IORetry       IORetryOptions
+	Budget        BudgetOptions
+
+	// Open files the conversions share, set up by a run from IOProfile (nil = no limit)
+	FileSlots *slots.Limiter
+
+	// Files the conversions hold open at once, kept under the process's limit
+	// on open files; set up by a run from converter.SetupDescriptorBudget
+	// (nil = no limit)
+	DescriptorSlots *slots.Limiter
+
+	// This run's own directory under TempDir, set up by a run with
+	// converter.SetupTempDir and removed when it ends (empty = TempDir)
+	RunTempDir string
+
+	// Rendering options
+	ExtraHeaders   []string // Additional headers to show after From/To/Cc/Subject/Date
+	UnwrapJournals bool     // Whether to render the original message inside journal reports
+	ShowARC        bool     // Whether the ARC chain of forwarded messages is shown in the appendix
+	ShowHops       bool     // Whether the route traced from the Received headers is shown in the appendix
+	RawSource      bool     // Whether the raw MIME source is shown, line-numbered, in the appendix
+	RawSourceKB    int      // Kilobytes of the source shown (0 = all of it)
+	TemplateFile   string   // Custom html/template file for the rendered document (empty = built-in layout)
+	CSSFile        string   // Stylesheet appended after the built-in styles
+	Locale         string   // Language of field labels, e.g. "en", "de", "fr"
+	Timezone       string   // IANA zone dates are shown in, e.g. "Europe/Berlin" (empty = the zone each was written in)
+	HTMLPartPolicy string   // Which HTML part to render when there are several: "first", "largest", "last" or "all"
+	QuoteMode      string   // How quoted reply text is rendered: "show", "mark" or "collapse"
+	FontFile       string   // Unicode TTF font for right-to-left text and symbols in the fallback renderer (empty = search system fonts)
+	EmojiDir       string   // Directory of emoji PNG sprites (Twemoji or Noto naming) for the fallback renderer
+	DetectLanguage bool     // Whether the fallback renderer picks fonts and date formats from the body's script and language
+	PDFUA          bool     // Whether PDFs are tagged for accessibility (PDF/UA-1); only the Chrome renderers can tag them
+
+	// Renderer options
+	RendererOrder []string // Rendering backends to try, most preferred first, e.g. "chrome", "gotenberg", "basic"
+	GotenbergURL  string   // Base URL of a Gotenberg server (empty = not used)
+	RenderWait    string   // What to wait for before printing: "idle" (network and fonts), "fonts" or "none"
+	RenderWaitMS  int      // Maximum time to wait before printing, in milliseconds
+	MaxRenders    int      // Chrome renders running at once (0 = one per worker)
+	Chrome        ChromeOptions
+
+	// Chrome renders the conversions share, set up by a run from MaxRenders
+	// and changed by /api/tune (nil = no limit)
+	RenderSlots *slots.Limiter
+
+	// Which renderers the run found available and which it has given up on
+	// after repeated failures, set up by a run (nil = probed on every use and
+	// never given up on)
+	Renderers *backends.Tracker
+
+	// Output routing options
+	Routes      *routing.Rules // Rules sending outputs to per-sender or per-custodian trees (nil = outputs beside sources)
+	OrganizeBy  string         // Date folders outputs are sorted into: "year", "year/month" or "year/month/day" (empty = mirror source folders)
+	OrganizeDir string         // Root of the date-organized tree (empty = the source directory)
+
+	// Manifest options
+	Manifest *manifest.Manifest // Per-file priorities, custodians and output directories from a collection tool (nil = none)
 
 	// Attachment handling options
-	SaveAttachments bool   // Whether to extract and save attachments
-	AttachmentDir   string // Directory to save attachments in (if empty, use same dir as PDF)
+	SaveAttachments  bool     // Whether to extract and save attachments
+	AttachmentDir    string   // Directory to save attachments in (if empty, use same dir as PDF)
+	ThumbnailImages  bool     // Whether to render a thumbnail gallery of image attachments
+	AttachmentAllow  []string // Attachment extensions saved, e.g. ".pdf" (empty = any not blocked)
+	AttachmentBlock  []string // Attachment extensions never saved, e.g. ".exe"
+	MaxAttachmentMB  int      // Largest attachment saved, in megabytes (0 = no limit)
+	MaxAttachTotalMB int      // Most attachment megabytes saved per message (0 = no limit)
+	AttachmentMode   string   // How saved attachments are written: "copy", "hardlink" or "store" (deduplicated)
+	AttachmentStore  string   // Content-addressed store for deduplicated attachments (empty = _attachment_store in the message's source directory)
+	AttachmentSync   string   // When saved attachments are flushed to disk: "none", "file" (each one) or "dir" (each one and its directory entry)
+	SaveInline       bool     // Whether to also save inline parts, such as signature images, with the attachments
+	InlineAttachKB   int      // Inline images the body doesn't show are attachments from this many kilobytes (0 = never)
+
+	// Output size limits
+	MaxPDFMB      int // Split PDFs larger than this many megabytes into parts (0 = no limit)
+	MaxPDFPages   int // Split PDFs with more pages than this into parts (0 = no limit)
+	TruncatePages int // Cut message bodies off after this many pages with a notice (0 = no limit)
+
+	// Inline image limits; larger images are downscaled before rendering and
+	// their originals saved with the attachments
+	InlineMaxPixels int // Longest edge in pixels (0 = no limit)
+	InlineMaxKB     int // Encoded size in kilobytes (0 = no limit)
+
+	// Packaging options
+	PackageZip     bool // Whether to bundle each message's PDF, attachments, raw EML and metadata.json into a ZIP
+	MergePerFolder bool // Whether to combine each folder's PDFs into one chronological PDF with a table of contents
+	WriteSidecar   bool // Whether to write each message's metadata as JSON next to its PDF
+
+	// Output optimization options
+	OptimizePDF      bool // Whether to compress and linearize PDFs after rendering
+	OptimizeImageDPI int  // Resolution images are downsampled to when optimizing
+
+	// Records management options
+	XMPProperties map[string]string // XMP properties written into every PDF, e.g. custodian or legalHold (empty = none)
+	PreserveTimes string            // Set output mtimes from the message "date" or the "source" file (empty = time of conversion)
+	PreserveOwner bool              // Whether to copy the source file's owner and permissions to outputs
 
 	// Security options
 	ScanAttachments bool   // Whether to scan attachments with ClamAV
-	ClamdAddress    string // Address of ClamAV daemon (default: localhost:3310)
+	ScanOutput      bool   // Whether to check the written PDFs for active content, and with ClamAV when scanning, before counting them converted
+	ClamdAddress    string // Address of ClamAV daemon, or several separated by commas (default: localhost:3310)
+	ClamdStreams    int    // Scans streamed to each ClamAV daemon at once (0 = 4)
+	ClamdChunkKB    int    // Size, in KB, of the chunks attachments are streamed to ClamAV in (0 = 64)
+
+	// Attachment scan results the conversions share by content, set up by a
+	// run so shared attachments are scanned once per run (nil = none kept)
+	ScanVerdicts *security.Verdicts
+
+	// What is done with a message's outputs for each security alert severity
+	// ("info", "warning" or "critical"): "report", "annotate", "quarantine",
+	// "skip" or "abort" (missing = annotate)
+	AlertActions  map[string]string
+	QuarantineDir string // Where quarantined outputs are written (empty = "quarantine" under the source directory)
+
+	// External sandbox attachments are detonated in (empty SandboxURL = none)
+	SandboxURL    string          // Base URL of the sandbox's API
+	SandboxAPI    string          // API it speaks: "cuckoo", "cape" or "http" (empty = cuckoo)
+	SandboxSubmit string          // What is sent for each attachment: "hash" or "file" (empty = hash)
+	SandboxTypes  []string        // Extensions of the attachments submitted (empty = executables, scripts, macro documents and archives)
+	SandboxToken  string          // API token (empty = none)
+	SandboxWait   time.Duration   // How long the run waits for outstanding verdicts once the files are converted
+	SandboxClient *sandbox.Client // Client the conversions submit to, set up by a run from the options above (nil = none)
+
+	// Reputation providers body links and relay HELO names are checked
+	// against: "list:PATH", "dnsbl:ZONE" or "http:URL" (empty = none)
+	Reputation        []string
+	ReputationToken   string              // Token for the http providers (empty = none)
+	ReputationChecker *reputation.Checker // Checker the conversions share, set up by a run from the two above (nil = no checks)
+
+	// OCR options
+	OCREnabled  bool   // Whether to run OCR on image-only bodies and scanned attachments
+	OCRLanguage string // Tesseract language code(s), e.g. "eng" or "eng+deu"
+
+	// Reporting options
+	ReportFile     string // JSON report of per-file outcomes written at the end of the run (empty = no report)
+	HTMLReportFile string // Self-contained HTML summary of the run for sharing (empty = no report)
+	SecurityReport string // JSON index of the run's security findings, written with an HTML version beside it (empty = no report)
+	HistoryFile    string // Run history file each run's statistics are appended to (empty = not recorded)
+	AuditLogFile   string // Append-only, hash-chained log of every conversion for chain-of-custody review (empty = none)
+	SigningKeyFile string // Ed25519 private key (PKCS#8 PEM) used to sign the reports (empty = unsigned)
+	CheckpointFile string // File of the sources converted so far, skipped by later runs (empty = convert everything)
+
+	// Whether header anomalies (missing Date, duplicate Message-ID, Received
+	// time travel and the like) are recorded in the sidecar and report
+	HeaderAnomalies bool
+
+	// Migration options
+	ExpectedIDs *migration.Checklist // Message-IDs a mailbox migration must deliver, checked against the converted messages (nil = not checked)
+
+	// Whether the outputs are audited after the run for distinct sources that
+	// were converted to the same path or to byte-identical PDFs
+	CheckDuplicates bool
+
+	// Monitoring options
+	DashboardAddress string // Address serving a live web dashboard during the run, e.g. localhost:8080 (empty = none)
+	DashboardToken   string // Bearer token the dashboard's control endpoints require; the command reads it from EMIL_DASHBOARD_TOKEN (empty = loopback only)
+
+	// Notification options
+	NotifyTo     []string // Addresses emailed a run summary when the run finishes (empty = no email)
+	NotifyFrom   string   // Sender of the summary email
+	SMTPAddress  string   // SMTP server as host:port, e.g. smtp.example.com:587
+	SMTPUsername string   // SMTP login (empty = no authentication)
+	SMTPPassword string   // SMTP password; the command reads it from EMIL_SMTP_PASSWORD
+
+	// Metrics options
+	StatsdAddress string   // statsd or DogStatsD server receiving conversion metrics, e.g. localhost:8125 (empty = none)
+	StatsdPrefix  string   // Prefix of every metric name, e.g. "emil"
+	StatsdFormat  string   // Wire format: "dogstatsd" (with tags) or "statsd"
+	StatsdTags    []string // DogStatsD tags added to every metric, e.g. "env:prod"
+
+	// Library options
+	Hooks        *hooks.Hooks              // Callbacks around conversion stages, set by embedding programs (nil = none)
+	ProgressFunc func(models.StatusUpdate) // Called with every worker status update, in order, from a single goroutine (nil = none)
+}
+
+// Source is one directory a run converts, with the label its files carry in
+// naming templates and reports
+type Source struct {
+	Dir   string
+	Label string // e.g. a custodian or mount, unique within the run
+}
+
+// SourceList returns the directories the run converts
+func (c *Config) SourceList() []Source {
+	if len(c.Sources) > 0 {
+		return c.Sources
+	}
+	return []Source{{Dir: c.SourceDir, Label: filepath.Base(c.SourceDir)}}
+}
+
+// SourceOf returns the source directory a discovered file is in, the
+// innermost one if sources are nested
+func (c *Config) SourceOf(path string) Source {
+	sources := c.SourceList()
+	found := sources[0]
+	longest := -1
+	for _, source := range sources {
+		rel, err := filepath.Rel(source.Dir, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(filepath.Clean(source.Dir)) > longest {
+			found, longest = source, len(filepath.Clean(source.Dir))
+		}
+	}
+	return found
+}
+
+// RetryOptions controls how failed conversions are retried
+type RetryOptions struct {
+	MaxAttempts  int      // Conversion attempts per file, including the first (0 = 4; 1 = no retries)
+	BackoffMS    int      // Delay before the first retry in milliseconds, doubled for each further retry (0 = 500)
+	MaxBackoffMS int      // Longest delay between attempts in milliseconds (0 = no limit)
+	Jitter       float64  // Fraction of each delay that is randomized, from 0 to 1, so workers don't retry in step
+	Classes      []string // Error classes that are retried, e.g. "render" (empty = io, render and other)
+}
+
+// BudgetOptions limits how much one run takes on, e.g. to fit a nightly
+// window. Files past the budget are left for the next run, which finds them
+// through the checkpoint.
+type BudgetOptions struct {
+	MaxFiles    int           // Most files converted (0 = no limit)
+	MaxBytes    int64         // Most source bytes converted; the first file is taken even if larger (0 = no limit)
+	MaxDuration time.Duration // Time after which no more files are started; conversions in progress finish (0 = no limit)
+}
+
+// IORetryOptions controls how single file operations are retried when a
+// network share such as NFS or SMB reports a transient error, before the
+// conversion itself fails
+type IORetryOptions struct {
+	Attempts  int // Tries per file operation, including the first (0 = 3; 1 = no retries)
+	BackoffMS int // Delay before the first retry in milliseconds, doubled for each further retry (0 = 100)
+}
+
+// ChromeOptions configures the headless Chrome shared by all conversions
+type ChromeOptions struct {
+	ExecPath    string // Chrome binary to run (empty = search the usual locations)
+	RemoteURL   string // DevTools URL of a Chrome to use instead, e.g. ws://chrome:9222 (empty = not used)
+	NoSandbox   bool   // Disable the Chrome sandbox; always disabled when running as root
+	JavaScript  bool   // Allow scripts in rendered emails
+	MaxFailures int    // Consecutive failures of a renderer before the run skips it (0 = never)
 }
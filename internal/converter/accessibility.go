@@ -0,0 +1,182 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+	xhtml "golang.org/x/net/html"
+)
+
+// langPattern matches the language tags written into the PDF catalog
+var langPattern = regexp.MustCompile(`^[A-Za-z]{2,8}(?:-[A-Za-z0-9]{1,8})*$`)
+
+// TagsPDF reports whether a renderer can write tagged PDFs with a structure
+// tree, which PDF/UA requires. Only Chrome builds one from the document's
+// accessibility tree.
+func TagsPDF(renderer string) bool {
+	return renderer == RendererChrome || renderer == RendererRemote
+}
+
+// accessibleRenderers narrows the renderer order to those that tag their
+// PDFs. If none is available the order is kept, and the PDFs are untagged.
+func accessibleRenderers(renderers []string) []string {
+	var tagging []string
+	for _, renderer := range renderers {
+		if TagsPDF(renderer) {
+			tagging = append(tagging, renderer)
+		}
+	}
+	if len(tagging) == 0 {
+		return renderers
+	}
+	return tagging
+}
+
+// documentLanguage returns the language tag of a document: the detected
+// language of the message, or the language of its labels
+func documentLanguage(detected language, locale string) string {
+	for _, tag := range []string{detected.Code, locale} {
+		if langPattern.MatchString(tag) {
+			return tag
+		}
+	}
+	return "en"
+}
+
+// accessibilityCatalog returns the catalog entries PDF/UA requires beyond
+// the structure tree: the document language, and the title shown in the
+// viewer's title bar instead of the file name
+func accessibilityCatalog(lang string) string {
+	return fmt.Sprintf("/Lang (%s) /ViewerPreferences << /DisplayDocTitle true >>", lang)
+}
+
+// writeHTMLParagraphs converts a plain text body to paragraphs, one per run
+// of lines between blank lines, so screen readers can move between them
+func writeHTMLParagraphs(buffer *bytes.Buffer, text string) {
+	for _, para := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		if strings.TrimSpace(para) == "" {
+			continue
+		}
+		lines := strings.Split(strings.Trim(para, "\n"), "\n")
+		for i, line := range lines {
+			lines[i] = html.EscapeString(line)
+		}
+		buffer.WriteString("<p>" + strings.Join(lines, "<br>\n") + "</p>\n")
+	}
+}
+
+// makeAccessible prepares a complete HTML document for a tagged PDF: it sets
+// the document language, gives images without alt text a description, marks
+// layout tables as presentation so they aren't read as data, and renumbers
+// headings so no level is skipped. Documents that fail to parse are returned
+// unchanged.
+func makeAccessible(document string, envelope *enmime.Envelope, lang string, labels Labels) string {
+	doc, err := xhtml.Parse(strings.NewReader(document))
+	if err != nil {
+		return document
+	}
+
+	// Inline parts are named by their Content-ID, which cid: URLs refer to
+	inlineNames := make(map[string]string)
+	for _, part := range envelope.Inlines {
+		if part.ContentID != "" && part.FileName != "" {
+			inlineNames[strings.Trim(part.ContentID, "<>")] = part.FileName
+		}
+	}
+
+	level := 0
+	var walk func(n *xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		if n.Type == xhtml.ElementNode {
+			switch n.Data {
+			case "html":
+				setAttr(n, "lang", lang)
+			case "img":
+				if !hasAttr(n, "alt") {
+					setAttr(n, "alt", imageAlt(n, inlineNames, labels))
+				}
+			case "table":
+				rows := tableRows(n)
+				columns := 0
+				for _, row := range rows {
+					columns = max(columns, len(row))
+				}
+				if !isDataTable(n, rows, columns) {
+					setAttr(n, "role", "presentation")
+				}
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				// A heading may go at most one level deeper than the one before it
+				heading := int(n.Data[1] - '0')
+				heading = min(heading, level+1)
+				n.Data = "h" + strconv.Itoa(heading)
+				n.DataAtom = 0
+				level = heading
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var out bytes.Buffer
+	if err := xhtml.Render(&out, doc); err != nil {
+		return document
+	}
+	return out.String()
+}
+
+// imageAlt describes an image that has no alt text. Images of at most one
+// pixel are tracking beacons, which get an empty alt so they're skipped as
+// decoration; others are named after their file.
+func imageAlt(img *xhtml.Node, inlineNames map[string]string, labels Labels) string {
+	if getAttr(img, "width") == "1" || getAttr(img, "height") == "1" ||
+		getAttr(img, "width") == "0" || getAttr(img, "height") == "0" {
+		return ""
+	}
+	if title := strings.TrimSpace(getAttr(img, "title")); title != "" {
+		return title
+	}
+
+	src := strings.TrimSpace(getAttr(img, "src"))
+	if cid, ok := strings.CutPrefix(src, "cid:"); ok {
+		if name := inlineNames[cid]; name != "" {
+			return labels.InlineImage + ": " + name
+		}
+		return labels.InlineImage
+	}
+	if u, err := url.Parse(src); err == nil && u.Scheme != "data" {
+		if name := path.Base(u.Path); name != "." && name != "/" {
+			return labels.InlineImage + ": " + name
+		}
+	}
+	return labels.InlineImage
+}
+
+// hasAttr reports whether an element has an attribute, even an empty one
+func hasAttr(n *xhtml.Node, key string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// setAttr sets an attribute, replacing any earlier value
+func setAttr(n *xhtml.Node, key, value string) {
+	for i, attr := range n.Attr {
+		if attr.Key == key {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, xhtml.Attribute{Key: key, Val: value})
+}
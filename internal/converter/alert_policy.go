@@ -0,0 +1,175 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"emil/internal/config"
+	"emil/internal/models"
+)
+
+// What is done with a message's outputs when it raises a security alert,
+// from least to most drastic
+const (
+	AlertReport     = "report"     // Listed in the reports only
+	AlertAnnotate   = "annotate"   // Also listed at the top of the PDF
+	AlertQuarantine = "quarantine" // The PDF and attachments are written under the quarantine directory instead
+	AlertSkip       = "skip"       // No PDF is written and saved attachments are removed; the file fails
+	AlertAbort      = "abort"      // Like skip, and the run stops taking new files
+)
+
+// alertActionRank orders the actions, so a message with several alerts gets
+// the most drastic
+var alertActionRank = map[string]int{
+	AlertReport:     1,
+	AlertAnnotate:   2,
+	AlertQuarantine: 3,
+	AlertSkip:       4,
+	AlertAbort:      5,
+}
+
+// DefaultAlertActions are the actions taken for severities not configured
+var DefaultAlertActions = map[string]string{
+	models.SeverityInfo:     AlertAnnotate,
+	models.SeverityWarning:  AlertAnnotate,
+	models.SeverityCritical: AlertAnnotate,
+}
+
+// Name of the quarantine directory under the source directory, when none is
+// configured
+const defaultQuarantineDir = "quarantine"
+
+// ParseAlertActions parses severity=action pairs, e.g.
+// "critical=quarantine,warning=annotate"; severities left out keep their
+// default action
+func ParseAlertActions(items []string) (map[string]string, error) {
+	actions := make(map[string]string, len(DefaultAlertActions))
+	for severity, action := range DefaultAlertActions {
+		actions[severity] = action
+	}
+	for _, item := range items {
+		severity, action, ok := strings.Cut(item, "=")
+		severity, action = strings.TrimSpace(severity), strings.TrimSpace(action)
+		if !ok {
+			return nil, fmt.Errorf("invalid alert action %q (expected severity=action, e.g. critical=quarantine)", item)
+		}
+		if _, known := DefaultAlertActions[severity]; !known {
+			return nil, fmt.Errorf("unknown alert severity %q (use info, warning or critical)", severity)
+		}
+		if _, known := alertActionRank[action]; !known {
+			return nil, fmt.Errorf("unknown alert action %q (use report, annotate, quarantine, skip or abort)", action)
+		}
+		actions[severity] = action
+	}
+	return actions, nil
+}
+
+// actionFor returns the action configured for an alert's severity
+func actionFor(actions map[string]string, alert models.SecurityAlert) string {
+	if action, ok := actions[alert.Severity]; ok {
+		return action
+	}
+	if action, ok := DefaultAlertActions[alert.Severity]; ok {
+		return action
+	}
+	return AlertAnnotate
+}
+
+// alertAction returns the most drastic action the alerts call for and the
+// first alert calling for it, or "" if there are no alerts
+func alertAction(actions map[string]string, alerts []models.SecurityAlert) (string, models.SecurityAlert) {
+	strongest, cause := "", models.SecurityAlert{}
+	for _, alert := range alerts {
+		if action := actionFor(actions, alert); alertActionRank[action] > alertActionRank[strongest] {
+			strongest, cause = action, alert
+		}
+	}
+	return strongest, cause
+}
+
+// annotatedAlerts returns the alerts whose severity's action lists them in
+// the PDF
+func annotatedAlerts(actions map[string]string, alerts []models.SecurityAlert) []models.SecurityAlert {
+	var shown []models.SecurityAlert
+	for _, alert := range alerts {
+		if actionFor(actions, alert) != AlertReport {
+			shown = append(shown, alert)
+		}
+	}
+	return shown
+}
+
+// quarantinePath returns where an output goes in quarantine: the same path
+// relative to the message's source directory, under the quarantine
+// directory
+func quarantinePath(path, emlPath string, cfg *config.Config) string {
+	source := cfg.SourceOf(emlPath)
+	dir := cfg.QuarantineDir
+	if dir == "" {
+		dir = filepath.Join(source.Dir, defaultQuarantineDir)
+	}
+	rel, err := filepath.Rel(source.Dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(path)
+	}
+	return filepath.Join(dir, rel)
+}
+
+// quarantineAttachments moves a message's saved attachments into
+// quarantine, next to where its PDF will be written. Attachments in the
+// content-addressed store are shared with other messages and stay; the
+// manifest pointing at them moves.
+func quarantineAttachments(results []AttachmentResult, attachmentDir, emlPath string, cfg *config.Config) error {
+	files := newFileIO(cfg)
+	target := quarantinePath(attachmentDir, emlPath, cfg)
+	for i := range results {
+		result := &results[i]
+		if result.SavedPath == "" || filepath.Dir(result.SavedPath) != filepath.Clean(attachmentDir) {
+			continue
+		}
+		if err := files.mkdirAllRetry(target); err != nil {
+			return err
+		}
+		moved := filepath.Join(target, filepath.Base(result.SavedPath))
+		if err := files.renameRetry(result.SavedPath, moved); err != nil {
+			return err
+		}
+		result.SavedPath = moved
+	}
+
+	// A shared -attachment-dir holds other messages' attachments too
+	if cfg.AttachmentDir != "" {
+		return nil
+	}
+	manifest := filepath.Join(attachmentDir, storeManifestName)
+	if _, err := os.Stat(manifest); err == nil {
+		if err := files.mkdirAllRetry(target); err != nil {
+			return err
+		}
+		if err := files.renameRetry(manifest, filepath.Join(target, storeManifestName)); err != nil {
+			return err
+		}
+	}
+	os.Remove(attachmentDir)
+	return nil
+}
+
+// withholdAttachments removes the attachments a message saved, when its
+// alerts withhold its outputs. Stored attachments shared with other
+// messages stay.
+func withholdAttachments(results []AttachmentResult, attachmentDir string, cfg *config.Config) {
+	for i := range results {
+		result := &results[i]
+		if result.SavedPath == "" || filepath.Dir(result.SavedPath) != filepath.Clean(attachmentDir) {
+			continue
+		}
+		os.Remove(result.SavedPath)
+		result.SavedPath = ""
+	}
+	if cfg.AttachmentDir == "" {
+		os.Remove(filepath.Join(attachmentDir, storeManifestName))
+		os.Remove(attachmentDir)
+	}
+}
@@ -0,0 +1,131 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// HTML part policies choose the body when a message has several HTML parts
+const (
+	HTMLPartFirst   = "first"   // The first HTML part, as enmime selects it
+	HTMLPartLargest = "largest" // The largest text/html part
+	HTMLPartLast    = "last"    // The last text/html part, usually the richest alternative
+	HTMLPartAll     = "all"     // Every HTML part, each rendered as its own section
+)
+
+// htmlVariantTypes are HTML flavours only used when no plain text/html part exists,
+// or when every part is rendered
+var htmlVariantTypes = []string{"text/watch-html", "text/x-amp-html"}
+
+// CheckHTMLPartPolicy validates a -html-parts value
+func CheckHTMLPartPolicy(policy string) error {
+	switch policy {
+	case HTMLPartFirst, HTMLPartLargest, HTMLPartLast, HTMLPartAll:
+		return nil
+	}
+	return fmt.Errorf("unsupported HTML part policy %q (available: %s, %s, %s, %s)",
+		policy, HTMLPartFirst, HTMLPartLargest, HTMLPartLast, HTMLPartAll)
+}
+
+// htmlBodyParts returns the HTML body candidates in document order
+func htmlBodyParts(envelope *enmime.Envelope) []*enmime.Part {
+	if envelope.Root == nil {
+		return nil
+	}
+	return envelope.Root.DepthMatchAll(func(p *enmime.Part) bool {
+		if p.Disposition == "attachment" {
+			return false
+		}
+		return p.ContentType == "text/html" || isHTMLVariant(p.ContentType)
+	})
+}
+
+// isHTMLVariant reports whether a content type is a special-purpose HTML flavour
+func isHTMLVariant(contentType string) bool {
+	for _, variant := range htmlVariantTypes {
+		if contentType == variant {
+			return true
+		}
+	}
+	return false
+}
+
+// selectHTMLBody applies the HTML part policy to the envelope, returning a
+// description of the chosen part for the report. Messages with a single HTML
+// part are left alone and return "".
+func selectHTMLBody(envelope *enmime.Envelope, policy string, labels Labels) string {
+	parts := htmlBodyParts(envelope)
+	if len(parts) < 2 {
+		return ""
+	}
+
+	if policy == HTMLPartAll {
+		envelope.HTML = htmlSections(parts, labels)
+		return fmt.Sprintf("all %d HTML parts", len(parts))
+	}
+
+	// Special-purpose variants only count when there's nothing else
+	var standard []*enmime.Part
+	for _, p := range parts {
+		if !isHTMLVariant(p.ContentType) {
+			standard = append(standard, p)
+		}
+	}
+	if len(standard) == 0 {
+		standard = parts
+	}
+
+	chosen := standard[0]
+	switch policy {
+	case HTMLPartLargest:
+		for _, p := range standard[1:] {
+			if len(p.Content) > len(chosen.Content) {
+				chosen = p
+			}
+		}
+	case HTMLPartLast:
+		chosen = standard[len(standard)-1]
+	case HTMLPartFirst, "":
+		// Keep enmime's own choice of body
+		return describePart(parts, firstHTMLPart(parts))
+	}
+
+	envelope.HTML = string(chosen.Content)
+	return describePart(parts, chosen)
+}
+
+// firstHTMLPart returns the first text/html part, which is the one enmime uses
+func firstHTMLPart(parts []*enmime.Part) *enmime.Part {
+	for _, p := range parts {
+		if p.ContentType == "text/html" {
+			return p
+		}
+	}
+	return nil
+}
+
+// describePart identifies the chosen part among the candidates
+func describePart(parts []*enmime.Part, chosen *enmime.Part) string {
+	if chosen == nil {
+		return ""
+	}
+	return fmt.Sprintf("part %s (%s, %s) of %d HTML parts",
+		chosen.PartID, chosen.ContentType, formatBytes(int64(len(chosen.Content))), len(parts))
+}
+
+// htmlSections joins every HTML part into one body, each under its own heading
+func htmlSections(parts []*enmime.Part, labels Labels) string {
+	var buffer bytes.Buffer
+	for i, p := range parts {
+		buffer.WriteString("<section class=\"html-alternative\">\n")
+		heading := fmt.Sprintf(labels.Part, i+1, len(parts)) + " (" + p.ContentType + ")"
+		buffer.WriteString("<h3 class=\"html-alternative-label\">" + html.EscapeString(heading) + "</h3>\n")
+		buffer.WriteString(strings.TrimSpace(string(p.Content)))
+		buffer.WriteString("\n</section>\n")
+	}
+	return buffer.String()
+}
@@ -0,0 +1,112 @@
+package converter
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/jhillyerd/enmime"
+)
+
+const (
+	// How far a Date may lie ahead of the conversion or of delivery before
+	// it's flagged, allowing for servers with wrong time zones
+	futureDateTolerance = 24 * time.Hour
+
+	// How far a hop may be timed before the previous one before the
+	// Received chain is flagged, allowing for clocks a little out of step
+	timeTravelTolerance = 5 * time.Minute
+)
+
+// Headers RFC 5322 allows at most once
+var singletonHeaders = []string{"Date", "From", "Sender", "Reply-To", "To", "Cc", "Subject", "Message-ID"}
+
+// HeaderAnomaly is a structural oddity in a message's headers. None stops a
+// conversion; together they point to forged, replayed or mishandled mail.
+type HeaderAnomaly struct {
+	Code   string `json:"code"`   // e.g. "missing-date", "duplicate-message-id", "received-time-travel"
+	Detail string `json:"detail"` // What was found, e.g. the dates involved
+}
+
+// String formats the anomaly for reports, e.g. "missing-date: no Date header"
+func (a HeaderAnomaly) String() string {
+	return a.Code + ": " + a.Detail
+}
+
+// detectAnomalies checks a message's headers for structural oddities: a
+// missing or unparsable Date, a Date in the future or after delivery,
+// repeated headers that must be unique, a missing Message-ID, Received
+// headers timed out of order, and a Return-Path domain unrelated to the
+// From domain
+func detectAnomalies(envelope *enmime.Envelope, now time.Time) []HeaderAnomaly {
+	var anomalies []HeaderAnomaly
+	add := func(code, format string, args ...any) {
+		anomalies = append(anomalies, HeaderAnomaly{Code: code, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	for _, name := range singletonHeaders {
+		if n := len(envelope.GetHeaderValues(name)); n > 1 {
+			add("duplicate-"+strings.ToLower(name), "%d %s headers", n, name)
+		}
+	}
+	if strings.TrimSpace(envelope.GetHeader("Message-ID")) == "" {
+		add("missing-message-id", "no Message-ID header")
+	}
+
+	hops := parseReceived(envelope)
+	date := strings.TrimSpace(envelope.GetHeader("Date"))
+	if date == "" {
+		add("missing-date", "no Date header")
+	} else if sent, err := mail.ParseDate(date); err != nil {
+		add("invalid-date", "unparsable Date %q", date)
+	} else {
+		if sent.After(now.Add(futureDateTolerance)) {
+			add("future-date", "Date %s is after the conversion time", sent.Format(time.RFC3339))
+		}
+		// The last server to receive the message delivered it
+		for i := len(hops) - 1; i >= 0; i-- {
+			if !hops[i].at.IsZero() {
+				if sent.After(hops[i].at.Add(futureDateTolerance)) {
+					add("date-after-delivery", "Date %s is after delivery at %s", sent.Format(time.RFC3339), hops[i].at.Format(time.RFC3339))
+				}
+				break
+			}
+		}
+	}
+
+	for _, hop := range hops {
+		if hop.delayKnown && time.Duration(hop.DelaySeconds)*time.Second < -timeTravelTolerance {
+			add("received-time-travel", "hop %d (%s) is timed %s before hop %d", hop.Number, hop.By, -time.Duration(hop.DelaySeconds)*time.Second, hop.Number-1)
+		}
+	}
+
+	var returnPath, from string
+	if addr, err := mail.ParseAddress(envelope.GetHeader("Return-Path")); err == nil {
+		returnPath = addressDomain(addr.Address)
+	}
+	if list, err := envelope.AddressList("From"); err == nil && len(list) > 0 {
+		from = addressDomain(list[0].Address)
+	}
+	if returnPath != "" && from != "" && !relatedDomains(returnPath, from) {
+		add("return-path-mismatch", "Return-Path domain %s differs from From domain %s", returnPath, from)
+	}
+
+	return anomalies
+}
+
+// addressDomain returns the lower-cased domain of an address. The null
+// Return-Path of a bounce doesn't parse, so it has none.
+func addressDomain(address string) string {
+	_, domain, ok := strings.Cut(address, "@")
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
+
+// relatedDomains reports whether two domains are the same or one is a
+// subdomain of the other, as bounce domains of senders' own servers usually are
+func relatedDomains(a, b string) bool {
+	return a == b || strings.HasSuffix(a, "."+b) || strings.HasSuffix(b, "."+a)
+}
@@ -0,0 +1,184 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// ARCSet is one instance of an Authenticated Received Chain (RFC 8617): the
+// authentication results a forwarding server saw, its signature over the
+// message and its seal over the chain so far. Servers that add a set are
+// usually mailing lists and security gateways, which break SPF and DKIM.
+type ARCSet struct {
+	Instance        int      // i= tag; 1 is the first server that added a set
+	Domain          string   // d= tag of the seal: the domain of the sealing server
+	Selector        string   // s= tag of the seal
+	ChainValidation string   // cv= tag of the seal: "none", "pass" or "fail"
+	AuthServID      string   // Server that recorded the results, from ARC-Authentication-Results
+	Results         []string // Authentication results as method=result, e.g. "dkim=pass"
+	Missing         []string // Headers of the set that aren't present
+}
+
+// parseARC reads the ARC sets of a message, first hop first. It returns nil
+// for messages without ARC headers.
+func parseARC(envelope *enmime.Envelope) []ARCSet {
+	sets := make(map[int]*ARCSet)
+	present := make(map[int]map[string]bool)
+	set := func(instance int, header string) *ARCSet {
+		if sets[instance] == nil {
+			sets[instance] = &ARCSet{Instance: instance}
+			present[instance] = make(map[string]bool)
+		}
+		present[instance][header] = true
+		return sets[instance]
+	}
+
+	for _, value := range envelope.GetHeaderValues("ARC-Seal") {
+		tags := parseTagList(value)
+		instance, ok := arcInstance(tags["i"])
+		if !ok {
+			continue
+		}
+		seal := set(instance, "ARC-Seal")
+		seal.Domain = tags["d"]
+		seal.Selector = tags["s"]
+		seal.ChainValidation = strings.ToLower(tags["cv"])
+	}
+	for _, value := range envelope.GetHeaderValues("ARC-Message-Signature") {
+		tags := parseTagList(value)
+		instance, ok := arcInstance(tags["i"])
+		if !ok {
+			continue
+		}
+		signature := set(instance, "ARC-Message-Signature")
+		if signature.Domain == "" {
+			signature.Domain = tags["d"]
+		}
+	}
+	for _, value := range envelope.GetHeaderValues("ARC-Authentication-Results") {
+		// "i=1; mx.example.com; spf=pass smtp.mailfrom=...; dkim=pass header.d=..."
+		fields := strings.Split(unfold(value), ";")
+		tag, number, _ := strings.Cut(strings.TrimSpace(fields[0]), "=")
+		instance, ok := arcInstance(number)
+		if !ok || strings.TrimSpace(tag) != "i" {
+			continue
+		}
+		results := set(instance, "ARC-Authentication-Results")
+		if len(fields) > 1 {
+			results.AuthServID = strings.TrimSpace(fields[1])
+		}
+		for _, field := range fields[2:] {
+			if result := strings.Fields(field); len(result) > 0 && strings.Contains(result[0], "=") {
+				results.Results = append(results.Results, strings.ToLower(result[0]))
+			}
+		}
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+
+	chain := make([]ARCSet, 0, len(sets))
+	for instance, arc := range sets {
+		for _, header := range []string{"ARC-Seal", "ARC-Message-Signature", "ARC-Authentication-Results"} {
+			if !present[instance][header] {
+				arc.Missing = append(arc.Missing, header)
+			}
+		}
+		chain = append(chain, *arc)
+	}
+	sort.Slice(chain, func(i, j int) bool { return chain[i].Instance < chain[j].Instance })
+	return chain
+}
+
+// arcInstance parses the i= tag of an ARC header, which runs from 1 to 50
+func arcInstance(value string) (int, bool) {
+	instance, err := strconv.Atoi(strings.TrimSpace(value))
+	return instance, err == nil && instance >= 1 && instance <= 50
+}
+
+// parseTagList reads a DKIM-style "tag=value; tag=value" list
+func parseTagList(value string) map[string]string {
+	tags := make(map[string]string)
+	for _, field := range strings.Split(unfold(value), ";") {
+		name, tagValue, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(tagValue)
+	}
+	return tags
+}
+
+// unfold joins the lines of a folded header value
+func unfold(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// fields returns the set's values as labelled rows for rendering
+func (a ARCSet) fields() []HeaderField {
+	var fields []HeaderField
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, HeaderField{Name: name, Value: value})
+		}
+	}
+
+	sealer := a.Domain
+	if a.Selector != "" {
+		sealer += " (s=" + a.Selector + ")"
+	}
+	add("Instance", fmt.Sprintf("i=%d", a.Instance))
+	add("Sealed by", sealer)
+	add("Chain validation", a.ChainValidation)
+	add("Results from", a.AuthServID)
+	add("Results", strings.Join(a.Results, ", "))
+	add("Missing", strings.Join(a.Missing, ", "))
+	return fields
+}
+
+// broken reports whether a set shows the chain was broken when it was added
+func (a ARCSet) broken() bool {
+	return a.ChainValidation == "fail" || len(a.Missing) > 0
+}
+
+// writeHTMLARC adds the ARC chain section to the HTML buffer
+func writeHTMLARC(buffer *bytes.Buffer, chain []ARCSet, labels Labels) {
+	buffer.WriteString("<div class=\"arc-chain\">\n")
+	buffer.WriteString("<h3>" + html.EscapeString(labels.AuthChain) + "</h3>\n")
+	for _, arc := range chain {
+		class := "arc-set"
+		if arc.broken() {
+			class += " arc-broken"
+		}
+		buffer.WriteString("<div class=\"" + class + "\">\n")
+		for _, field := range arc.fields() {
+			addHeader(buffer, field.Name, field.Value)
+		}
+		buffer.WriteString("</div>\n")
+	}
+	buffer.WriteString("</div>\n")
+}
+
+// addPDFARC adds the ARC chain section to the PDF
+func addPDFARC(pdf *gofpdf.Fpdf, chain []ARCSet, labels Labels) {
+	pdf.Ln(10)
+	pdf.SetFont("Arial", "B", 12)
+	pdf.Cell(0, 10, labels.AuthChain+":")
+	pdf.Ln(10)
+
+	for _, arc := range chain {
+		if arc.broken() {
+			pdf.SetTextColor(180, 0, 0)
+		}
+		addPDFFields(pdf, arc.fields())
+		pdf.SetTextColor(0, 0, 0)
+		pdf.Ln(3)
+	}
+}
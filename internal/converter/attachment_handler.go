@@ -2,9 +2,11 @@ package converter
 
 import (
 	"fmt"
-	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/jhillyerd/enmime"
 
@@ -17,100 +19,185 @@ type AttachmentResult struct {
 	Size        int64
 	ContentType string
 	SavedPath   string
+	SHA256      string // Content hash, set when attachments are deduplicated
+	Skipped     string // Why the attachment was not written to disk (empty = saved)
+	Inline      bool   // An inline part, such as a signature image, saved with -save-inline
 	ScanResult  *security.ScanResult
 }
 
+// AttachmentPolicy limits which attachments are written to disk. Attachments
+// it skips are still listed in the PDF and the report.
+type AttachmentPolicy struct {
+	Allow           []string // Extensions saved, e.g. ".pdf" (empty = any not blocked)
+	Block           []string // Extensions never saved, e.g. ".exe"
+	MaxBytes        int64    // Largest attachment saved (0 = no limit)
+	MaxMessageBytes int64    // Most attachment bytes saved per message (0 = no limit)
+	Mode            string   // How saved attachments are written: copy, hardlink or store (empty = copy)
+	StoreDir        string   // Content-addressed store used by the hardlink and store modes
+	SaveInline      bool     // Also save the inline parts shown in the body, such as signature images
+	Sync            string   // When saved attachments are flushed to disk: none, file or dir (empty = none)
+
+	files    fileIO             // How the attachments are written to storage
+	verdicts *security.Verdicts // Scan results of the run, by content
+}
+
+// skipReason returns why an attachment is not saved, or "" if it may be.
+// saved is the number of bytes already saved for the message.
+func (p AttachmentPolicy) skipReason(filename string, size, saved int64) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if containsExtension(p.Block, ext) {
+		return fmt.Sprintf("blocked type %s", ext)
+	}
+	if len(p.Allow) > 0 && !containsExtension(p.Allow, ext) {
+		if ext == "" {
+			return "type not allowed (no extension)"
+		}
+		return fmt.Sprintf("type %s not allowed", ext)
+	}
+	if p.MaxBytes > 0 && size > p.MaxBytes {
+		return fmt.Sprintf("larger than %s", formatBytes(p.MaxBytes))
+	}
+	if p.MaxMessageBytes > 0 && saved+size > p.MaxMessageBytes {
+		return fmt.Sprintf("message attachments over %s", formatBytes(p.MaxMessageBytes))
+	}
+	return ""
+}
+
+// containsExtension reports whether ext is in the list, which may be given
+// with or without leading dots and in any case
+func containsExtension(list []string, ext string) bool {
+	for _, item := range list {
+		if "."+strings.ToLower(strings.TrimPrefix(item, ".")) == ext {
+			return true
+		}
+	}
+	return false
+}
+
 // HandleAttachments extracts and optionally scans email attachments
-func HandleAttachments(envelope *enmime.Envelope, outputDir string, scan bool, scanner *security.Scanner) ([]AttachmentResult, error) {
+func HandleAttachments(envelope *enmime.Envelope, outputDir string, policy AttachmentPolicy, scan bool, scanner *security.Scanner) ([]AttachmentResult, error) {
 	results := []AttachmentResult{}
+	var saved int64
+
+	parts := envelope.Attachments
+	var inline []*enmime.Part
+	if policy.SaveInline {
+		inline = inlineParts(envelope)
+		parts = slices.Concat(parts, inline)
+	}
 
 	// If no attachments, return empty result
-	if len(envelope.Attachments) == 0 {
+	if len(parts) == 0 {
 		return results, nil
 	}
 
 	// Ensure output directory exists
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
+	if err := policy.files.mkdirAllRetry(outputDir); err != nil {
 		return nil, fmt.Errorf("failed to create attachment directory: %w", err)
 	}
 
 	// Process each attachment
-	for _, att := range envelope.Attachments {
+	for i, att := range parts {
 		// Create basic result
 		result := AttachmentResult{
 			Filename:    sanitizeFilename(att.FileName),
 			Size:        int64(len(att.Content)),
 			ContentType: att.ContentType,
 		}
+		if i >= len(envelope.Attachments) {
+			result.Inline = true
+			result.Filename = sanitizeFilename(partFilename(att, slices.Index(inline, att)+1))
+		}
 
-		// Determine safe output path
-		result.SavedPath = filepath.Join(outputDir, result.Filename)
-
-		// Ensure unique filename
-		result.SavedPath = ensureUniqueFilename(result.SavedPath)
-
-		// Save the attachment
-		if err := os.WriteFile(result.SavedPath, att.Content, 0644); err != nil {
-			return results, fmt.Errorf("failed to save attachment %s: %w", att.FileName, err)
+		// Leave out attachments the policy doesn't allow
+		if result.Skipped = policy.skipReason(result.Filename, result.Size, saved); result.Skipped != "" {
+			results = append(results, result)
+			continue
 		}
+		saved += result.Size
 
-		// Scan for viruses if requested
-		if scan && scanner != nil && scanner.IsEnabled() {
-			scanResult, err := scanner.ScanFile(result.SavedPath)
-			if err != nil {
-				return results, fmt.Errorf("failed to scan attachment %s: %w", att.FileName, err)
-			}
-			result.ScanResult = scanResult
-
-			// If infected, optionally rename or quarantine
-			if scanResult.Infected {
-				// Add .infected extension
-				infectedPath := result.SavedPath + ".infected"
-				if err := os.Rename(result.SavedPath, infectedPath); err != nil {
-					return results, fmt.Errorf("failed to mark infected file %s: %w", att.FileName, err)
-				}
-				result.SavedPath = infectedPath
-			}
+		// Write the attachment, once per run when deduplicating
+		if err := saveAttachment(&result, att.Content, outputDir, policy); err != nil {
+			return results, fmt.Errorf("failed to save attachment %s: %w", att.FileName, err)
 		}
 
 		// Add to results
 		results = append(results, result)
 	}
 
+	// Scan for viruses if requested
+	if scan && scanner != nil && scanner.IsEnabled() {
+		if err := scanAttachments(results, scanner, policy); err != nil {
+			return results, err
+		}
+	}
+
+	if policy.Mode == AttachmentsStore {
+		if err := policy.files.writeStoreManifest(outputDir, results); err != nil {
+			return results, err
+		}
+	}
+	if err := policy.files.syncDir(outputDir, policy.Sync); err != nil {
+		return results, fmt.Errorf("failed to flush attachment directory: %w", err)
+	}
 	return results, nil
 }
 
-// sanitizeFilename makes a filename safe for use on the filesystem
-func sanitizeFilename(filename string) string {
-	// Replace invalid characters with underscore
-	invalid := []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|"}
-	result := filename
+// saveAttachment writes an attachment according to the storage mode and
+// records where it went
+func saveAttachment(result *AttachmentResult, content []byte, outputDir string, policy AttachmentPolicy) error {
+	if policy.Mode == "" || policy.Mode == AttachmentsCopy {
+		// Numbered if another attachment already has the name
+		path, err := policy.files.writeUnique(longPath(filepath.Join(outputDir, result.Filename)), content, 0644, policy.Sync)
+		result.SavedPath = path
+		return err
+	}
 
-	for _, char := range invalid {
-		result = strings.ReplaceAll(result, char, "_")
+	stored, digest, err := policy.files.storeAttachment(policy.StoreDir, content, strings.ToLower(filepath.Ext(result.Filename)), policy.Sync)
+	if err != nil {
+		return err
+	}
+	result.SHA256 = digest
+	if policy.Mode == AttachmentsStore {
+		result.SavedPath = stored
+		return nil
 	}
 
-	return result
+	path, err := policy.files.linkUnique(stored, longPath(filepath.Join(outputDir, result.Filename)), content, policy.Sync)
+	result.SavedPath = path
+	return err
 }
 
-// ensureUniqueFilename ensures the filename doesn't conflict with existing files
-func ensureUniqueFilename(path string) string {
-	// If file doesn't exist, return original
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return path
-	}
+// Name used when nothing usable is left of a filename
+const fallbackFilename = "attachment"
 
-	// File exists, add number to make unique
-	dir := filepath.Dir(path)
-	ext := filepath.Ext(path)
-	name := strings.TrimSuffix(filepath.Base(path), ext)
+// sanitizeFilename makes a filename from an email safe to create inside the
+// attachment directory. Path separators, characters Windows forbids, control
+// and invisible formatting characters (such as right-to-left overrides used
+// to disguise extensions) become underscores; leading dots, which would hide
+// the file or form "..", and trailing dots and spaces, which Windows drops,
+// are removed. The result is never empty and fits the filesystem's name limit.
+func sanitizeFilename(filename string) string {
+	result := cleanFilename(filename)
+	if result == "" {
+		return fallbackFilename
+	}
+	return portableName(result)
+}
 
-	counter := 1
-	for {
-		newPath := filepath.Join(dir, fmt.Sprintf("%s_%d%s", name, counter, ext))
-		if _, err := os.Stat(newPath); os.IsNotExist(err) {
-			return newPath
+// cleanFilename does the character replacement and trimming of
+// sanitizeFilename, returning "" when nothing is left
+func cleanFilename(filename string) string {
+	result := strings.Map(func(r rune) rune {
+		switch {
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r), r == utf8.RuneError:
+			return '_'
 		}
-		counter++
-	}
+		return r
+	}, filename)
+
+	result = strings.TrimLeft(strings.TrimSpace(result), ".")
+	return strings.TrimRight(result, ". ")
 }
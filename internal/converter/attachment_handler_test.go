@@ -0,0 +1,73 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	long := strings.Repeat("a", 300) + ".pdf"
+	shortened := portableName(long)
+
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"plain", "report.pdf", "report.pdf"},
+		{"empty", "", fallbackFilename},
+		{"spaces only", "   ", fallbackFilename},
+		{"dot dot", "..", fallbackFilename},
+		{"dots only", "....", fallbackFilename},
+		{"parent path", "../../etc/passwd", "_.._etc_passwd"},
+		{"windows path", `..\..\boot.ini`, `_.._boot.ini`},
+		{"leading dot", ".bashrc", "bashrc"},
+		{"leading dots and space", " ..hidden.txt", "hidden.txt"},
+		{"trailing dots and spaces", "invoice.pdf. . ", "invoice.pdf"},
+		{"forbidden characters", `a:b*c?"<>|d.txt`, "a_b_c_____d.txt"},
+		{"reserved name", "CON", "CON_"},
+		{"reserved name lower case", "nul.txt", "nul_.txt"},
+		{"reserved name with extensions", "com1.tar.gz", "com1_.tar.gz"},
+		{"reserved prefix", "CONSOLE.txt", "CONSOLE.txt"},
+		{"control characters", "a\x00b\tc\r\n.txt", "a_b_c__.txt"},
+		{"delete character", "a\x7fb.txt", "a_b.txt"},
+		{"right-to-left override", "invoice\u202efdp.exe", "invoice_fdp.exe"},
+		{"bidi isolate", "photo\u2066gpj.scr", "photo_gpj.scr"},
+		{"zero width space", "pay\u200broll.xlsx", "pay_roll.xlsx"},
+		{"invalid UTF-8", "\xffname.txt", "_name.txt"},
+		{"unicode", "Résumé 履歴書.docx", "Résumé 履歴書.docx"},
+		{"over-long name", long, shortened},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeFilename(tt.filename); got != tt.want {
+				t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+
+	if len(shortened) > maxNameBytes || !strings.HasSuffix(shortened, ".pdf") {
+		t.Errorf("over-long name shortened to %d bytes as %q, want at most %d ending in .pdf", len(shortened), shortened, maxNameBytes)
+	}
+}
+
+func TestPlaceholderValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Quarterly report", "Quarterly report"},
+		{"", "untitled"},
+		{"  ", "untitled"},
+		{"...", "untitled"},
+		{"Re: a/b", "Re_ a_b"},
+		{strings.Repeat("x", 100), strings.Repeat("x", maxPlaceholderRunes)},
+	}
+
+	for _, tt := range tests {
+		if got := placeholderValue(tt.value); got != tt.want {
+			t.Errorf("placeholderValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
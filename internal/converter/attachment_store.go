@@ -0,0 +1,173 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"emil/internal/security"
+)
+
+// How saved attachments are written to disk
+const (
+	AttachmentsCopy     = "copy"     // A separate copy per message
+	AttachmentsHardlink = "hardlink" // One stored copy, hard linked into each message's directory
+	AttachmentsStore    = "store"    // One stored copy, referenced from a manifest in each message's directory
+)
+
+// Name of the per-message manifest written in store mode
+const storeManifestName = "attachments.json"
+
+// Name of the default store directory, created in the source directory
+const defaultStoreDir = "_attachment_store"
+
+// CheckAttachmentMode validates an attachment storage mode
+func CheckAttachmentMode(mode string) error {
+	switch mode {
+	case "", AttachmentsCopy, AttachmentsHardlink, AttachmentsStore:
+		return nil
+	}
+	return fmt.Errorf("invalid attachment mode %q (use %s, %s or %s)", mode, AttachmentsCopy, AttachmentsHardlink, AttachmentsStore)
+}
+
+// storeEntry describes one attachment in a store-mode manifest
+type storeEntry struct {
+	Filename   string `json:"filename"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256,omitempty"`
+	StoredPath string `json:"stored_path,omitempty"`
+	Skipped    string `json:"skipped,omitempty"`
+	Infected   bool   `json:"infected,omitempty"`
+}
+
+// storeAttachment writes content to the content-addressed store unless an
+// identical object is already there, returning its path and SHA-256. The
+// object is flushed according to the fsync policy.
+func (f fileIO) storeAttachment(storeDir string, content []byte, ext, policy string) (string, string, error) {
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	path := filepath.Join(storeDir, digest[:2], digest+ext)
+
+	if info, err := os.Stat(path); err == nil && info.Size() == int64(len(content)) {
+		return path, digest, nil
+	}
+	if err := f.mkdirAllRetry(filepath.Dir(path)); err != nil {
+		return "", "", fmt.Errorf("failed to create attachment store: %w", err)
+	}
+
+	// Write to a temporary name first so other workers never see a partial object
+	release := f.openSlot()
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		release()
+		return "", "", fmt.Errorf("failed to write to attachment store: %w", err)
+	}
+	err = f.writeContent(tmp, content, policy)
+	release()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to write to attachment store: %w", err)
+	}
+	os.Chmod(tmp.Name(), 0644)
+	if err := f.renameRetry(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", "", fmt.Errorf("failed to write to attachment store: %w", err)
+	}
+	if err := f.syncDir(filepath.Dir(path), policy); err != nil {
+		return "", "", fmt.Errorf("failed to flush attachment store: %w", err)
+	}
+	return path, digest, nil
+}
+
+// scanStored scans an attachment, reusing the result for content scanned
+// earlier in the run
+func scanStored(scanner *security.Scanner, verdicts *security.Verdicts, path, digest string) (*security.ScanResult, error) {
+	if cached, ok := verdicts.Lookup(digest); ok {
+		return cached, nil
+	}
+	result, err := scanner.ScanFile(path)
+	if err != nil {
+		return nil, err
+	}
+	verdicts.Record(digest, result)
+	return result, nil
+}
+
+// scanAttachments scans a message's saved attachments, as many at once as
+// the scanner has clamd streams, and marks the infected ones. A copy or link
+// in the message's directory gets an .infected extension; a store-mode
+// object is shared with other messages, so it keeps its name and the
+// infection is recorded in the message's manifest instead.
+func scanAttachments(results []AttachmentResult, scanner *security.Scanner, policy AttachmentPolicy) error {
+	var pending []int
+	for i, result := range results {
+		if result.SavedPath != "" {
+			pending = append(pending, i)
+		}
+	}
+
+	errs := make([]error, len(results))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(len(pending), scanner.Streams()); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				result := &results[i]
+				scanResult, err := scanStored(scanner, policy.verdicts, result.SavedPath, result.SHA256)
+				if err != nil {
+					errs[i] = fmt.Errorf("failed to scan attachment %s: %w", result.Filename, err)
+					continue
+				}
+				result.ScanResult = scanResult
+				if !scanResult.Infected || policy.Mode == AttachmentsStore {
+					continue
+				}
+
+				// Add .infected extension
+				infectedPath := result.SavedPath + ".infected"
+				if err := policy.files.renameRetry(result.SavedPath, infectedPath); err != nil {
+					errs[i] = fmt.Errorf("failed to mark infected file %s: %w", result.Filename, err)
+					continue
+				}
+				result.SavedPath = infectedPath
+			}
+		}()
+	}
+	for _, i := range pending {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// writeStoreManifest records where each of a message's attachments is stored
+func (f fileIO) writeStoreManifest(outputDir string, results []AttachmentResult) error {
+	entries := make([]storeEntry, 0, len(results))
+	for _, result := range results {
+		entries = append(entries, storeEntry{
+			Filename:   result.Filename,
+			Size:       result.Size,
+			SHA256:     result.SHA256,
+			StoredPath: result.SavedPath,
+			Skipped:    result.Skipped,
+			Infected:   result.ScanResult != nil && result.ScanResult.Infected,
+		})
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode attachment manifest: %w", err)
+	}
+	if err := f.writeFileRetry(filepath.Join(outputDir, storeManifestName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write attachment manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// When saved attachments are flushed to disk
+const (
+	AttachmentSyncNone = "none" // Left to the operating system
+	AttachmentSyncFile = "file" // Each attachment before it is closed
+	AttachmentSyncDir  = "dir"  // Each attachment and the directory entries naming them
+)
+
+// Size of the buffered writers attachments are copied through
+const attachmentBufferSize = 64 * 1024
+
+// attachmentWriters pools the buffered writers attachments are copied
+// through, so saving thousands of attachments doesn't allocate a buffer for
+// each
+var attachmentWriters = sync.Pool{
+	New: func() any { return bufio.NewWriterSize(nil, attachmentBufferSize) },
+}
+
+// CheckAttachmentSync validates an attachment fsync policy
+func CheckAttachmentSync(policy string) error {
+	switch policy {
+	case "", AttachmentSyncNone, AttachmentSyncFile, AttachmentSyncDir:
+		return nil
+	}
+	return fmt.Errorf("invalid attachment fsync policy %q (use %s, %s or %s)", policy, AttachmentSyncNone, AttachmentSyncFile, AttachmentSyncDir)
+}
+
+// syncsFiles reports whether a policy flushes each attachment
+func syncsFiles(policy string) bool {
+	return policy == AttachmentSyncFile || policy == AttachmentSyncDir
+}
+
+// streamTo copies an attachment from r into file through a pooled buffered
+// writer, flushing the file to disk if the policy asks for it. The file is
+// left open.
+func (f fileIO) streamTo(file *os.File, r io.Reader, policy string) error {
+	w := attachmentWriters.Get().(*bufio.Writer)
+	w.Reset(file)
+	defer func() {
+		w.Reset(nil)
+		attachmentWriters.Put(w)
+	}()
+
+	if err := f.copyInBursts(w, r); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if syncsFiles(policy) {
+		return file.Sync()
+	}
+	return nil
+}
+
+// writeContent streams content to a new file, flushed according to the
+// policy, and closes it; the file is removed if anything fails
+func (f fileIO) writeContent(file *os.File, content []byte, policy string) error {
+	if err := f.streamTo(file, bytes.NewReader(content), policy); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
+
+// syncDir flushes a directory's entries to disk under the dir policy, so the
+// names of attachments written into it survive a crash. Windows can't sync
+// directories; its filesystems commit names as they are created.
+func (f fileIO) syncDir(dir, policy string) error {
+	if policy != AttachmentSyncDir || runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := f.openRetry(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
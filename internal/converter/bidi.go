@@ -0,0 +1,300 @@
+package converter
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jhillyerd/enmime"
+)
+
+const (
+	directionLTR = "ltr"
+	directionRTL = "rtl"
+)
+
+// rtlLanguages are Content-Language prefixes written right to left
+var rtlLanguages = []string{"ar", "he", "iw", "fa", "ur", "yi", "ps", "ku", "sd"}
+
+// messageDirection determines whether a message is written right to left
+func messageDirection(envelope *enmime.Envelope) string {
+	language := strings.ToLower(strings.TrimSpace(envelope.GetHeader("Content-Language")))
+	for _, prefix := range rtlLanguages {
+		if language == prefix || strings.HasPrefix(language, prefix+"-") {
+			return directionRTL
+		}
+	}
+
+	text := envelope.Text
+	if text == "" && envelope.HTML != "" {
+		text = parseHTML(envelope.HTML)
+	}
+	return textDirection(envelope.GetHeader("Subject") + "\n" + text)
+}
+
+// textDirection returns the direction of the majority of strong characters
+func textDirection(text string) string {
+	var rtl, ltr int
+	for _, r := range text {
+		switch {
+		case isRTLRune(r):
+			rtl++
+		case unicode.IsLetter(r):
+			ltr++
+		}
+	}
+	if rtl > ltr {
+		return directionRTL
+	}
+	return directionLTR
+}
+
+// containsRTL reports whether the text has any right-to-left characters
+func containsRTL(text string) bool {
+	for _, r := range text {
+		if isRTLRune(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRTLRune reports whether a rune belongs to a right-to-left script
+func isRTLRune(r rune) bool {
+	return (r >= 0x0590 && r <= 0x08FF) || // Hebrew, Arabic, Syriac, Thaana and extensions
+		(r >= 0xFB1D && r <= 0xFDFF) || // Hebrew and Arabic presentation forms A
+		(r >= 0xFE70 && r <= 0xFEFF) // Arabic presentation forms B
+}
+
+// mirroredRunes swaps paired punctuation inside right-to-left runs
+var mirroredRunes = map[rune]rune{
+	'(': ')', ')': '(', '[': ']', ']': '[', '{': '}', '}': '{', '<': '>', '>': '<', '«': '»', '»': '«',
+}
+
+// Bidi classes used when reordering a line
+const (
+	bidiRTL = iota
+	bidiLTR
+	bidiNumber
+	bidiNeutral
+)
+
+// visualOrder reorders one line of a right-to-left paragraph for display by a
+// renderer that draws glyphs left to right. Latin words and numbers keep their
+// internal order; everything else is laid out right to left.
+func visualOrder(line string) string {
+	runes := []rune(line)
+	classes := make([]int, len(runes))
+	for i, r := range runes {
+		classes[i] = bidiClass(r)
+	}
+
+	// Neutrals inside a Latin phrase or a number take its direction,
+	// the rest follow the paragraph
+	for i, class := range classes {
+		if class != bidiNeutral {
+			continue
+		}
+		before, after := neighbourClass(classes, i, -1), neighbourClass(classes, i, 1)
+		if before == after && (before == bidiLTR || (before == bidiNumber && isNumberSeparator(runes[i]))) {
+			classes[i] = before
+		} else {
+			classes[i] = bidiRTL
+		}
+	}
+
+	// Lay the runs out right to left, reversing the right-to-left ones
+	out := make([]rune, 0, len(runes))
+	for end := len(runes); end > 0; {
+		start := end - 1
+		for start > 0 && classes[start-1] == classes[end-1] {
+			start--
+		}
+		if classes[start] != bidiRTL {
+			out = append(out, runes[start:end]...)
+		} else {
+			for j := end - 1; j >= start; j-- {
+				r := runes[j]
+				if m, ok := mirroredRunes[r]; ok {
+					r = m
+				}
+				out = append(out, r)
+			}
+		}
+		end = start
+	}
+	return string(out)
+}
+
+// bidiClass returns the simplified bidi class of a rune
+func bidiClass(r rune) int {
+	switch {
+	case isRTLRune(r):
+		return bidiRTL
+	case unicode.IsDigit(r):
+		return bidiNumber
+	case unicode.IsLetter(r):
+		return bidiLTR
+	default:
+		return bidiNeutral
+	}
+}
+
+// neighbourClass returns the class of the nearest non-neutral rune in a direction
+func neighbourClass(classes []int, i, step int) int {
+	for j := i + step; j >= 0 && j < len(classes); j += step {
+		if classes[j] != bidiNeutral {
+			return classes[j]
+		}
+	}
+	return bidiRTL
+}
+
+// isNumberSeparator reports whether a rune can sit inside a number, as in 1,000.50 or 12:30
+func isNumberSeparator(r rune) bool {
+	return strings.ContainsRune(",.:/-", r)
+}
+
+// arabicForms lists the isolated, final, initial and medial presentation forms
+// of each Arabic letter. Letters with no initial or medial form only join on
+// their right-hand side.
+var arabicForms = map[rune][4]rune{
+	0x0621: {0xFE80, 0, 0, 0},
+	0x0622: {0xFE81, 0xFE82, 0, 0},
+	0x0623: {0xFE83, 0xFE84, 0, 0},
+	0x0624: {0xFE85, 0xFE86, 0, 0},
+	0x0625: {0xFE87, 0xFE88, 0, 0},
+	0x0626: {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C},
+	0x0627: {0xFE8D, 0xFE8E, 0, 0},
+	0x0628: {0xFE8F, 0xFE90, 0xFE91, 0xFE92},
+	0x0629: {0xFE93, 0xFE94, 0, 0},
+	0x062A: {0xFE95, 0xFE96, 0xFE97, 0xFE98},
+	0x062B: {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C},
+	0x062C: {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0},
+	0x062D: {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4},
+	0x062E: {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8},
+	0x062F: {0xFEA9, 0xFEAA, 0, 0},
+	0x0630: {0xFEAB, 0xFEAC, 0, 0},
+	0x0631: {0xFEAD, 0xFEAE, 0, 0},
+	0x0632: {0xFEAF, 0xFEB0, 0, 0},
+	0x0633: {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4},
+	0x0634: {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8},
+	0x0635: {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC},
+	0x0636: {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0},
+	0x0637: {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4},
+	0x0638: {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8},
+	0x0639: {0xFEC9, 0xFECA, 0xFECB, 0xFECC},
+	0x063A: {0xFECD, 0xFECE, 0xFECF, 0xFED0},
+	0x0641: {0xFED1, 0xFED2, 0xFED3, 0xFED4},
+	0x0642: {0xFED5, 0xFED6, 0xFED7, 0xFED8},
+	0x0643: {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC},
+	0x0644: {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0},
+	0x0645: {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4},
+	0x0646: {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8},
+	0x0647: {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC},
+	0x0648: {0xFEED, 0xFEEE, 0, 0},
+	0x0649: {0xFEEF, 0xFEF0, 0, 0},
+	0x064A: {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4},
+	0x067E: {0xFB56, 0xFB57, 0xFB58, 0xFB59}, // Peh
+	0x0686: {0xFB7A, 0xFB7B, 0xFB7C, 0xFB7D}, // Tcheh
+	0x0698: {0xFB8A, 0xFB8B, 0, 0},           // Jeh
+	0x06A9: {0xFB8E, 0xFB8F, 0xFB90, 0xFB91}, // Keheh
+	0x06AF: {0xFB92, 0xFB93, 0xFB94, 0xFB95}, // Gaf
+	0x06CC: {0xFBFC, 0xFBFD, 0xFBFE, 0xFBFF}, // Farsi yeh
+}
+
+// lamAlefForms maps the alef following a lam to the isolated and final ligature
+var lamAlefForms = map[rune][2]rune{
+	0x0622: {0xFEF5, 0xFEF6},
+	0x0623: {0xFEF7, 0xFEF8},
+	0x0625: {0xFEF9, 0xFEFA},
+	0x0627: {0xFEFB, 0xFEFC},
+}
+
+const (
+	arabicLam     = 0x0644
+	arabicTatweel = 0x0640
+)
+
+// shapeArabic replaces Arabic letters with their contextual presentation forms,
+// which fonts need when the renderer does no shaping of its own
+func shapeArabic(text string) string {
+	runes := []rune(text)
+	if !containsRTL(text) {
+		return text
+	}
+
+	out := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		forms, ok := arabicForms[r]
+		if !ok {
+			out = append(out, r)
+			continue
+		}
+
+		prev := neighbourLetter(runes, i, -1)
+		joinsPrev := prev != 0 && (prev == arabicTatweel || joinsLeft(prev))
+
+		// Lam followed by alef becomes a single ligature
+		if r == arabicLam {
+			if nextIdx := neighbourIndex(runes, i, 1); nextIdx >= 0 {
+				if lig, ok := lamAlefForms[runes[nextIdx]]; ok {
+					if joinsPrev {
+						out = append(out, lig[1])
+					} else {
+						out = append(out, lig[0])
+					}
+					out = append(out, runes[i+1:nextIdx]...) // Keep any marks in between
+					i = nextIdx
+					continue
+				}
+			}
+		}
+
+		next := neighbourLetter(runes, i, 1)
+		_, nextIsArabic := arabicForms[next]
+		joinsNext := joinsLeft(r) && (next == arabicTatweel || (nextIsArabic && next != 0x0621))
+
+		form := forms[0]
+		switch {
+		case joinsPrev && joinsNext:
+			form = forms[3]
+		case joinsPrev:
+			form = forms[1]
+		case joinsNext:
+			form = forms[2]
+		}
+		if form == 0 {
+			form = forms[0]
+		}
+		out = append(out, form)
+	}
+	return string(out)
+}
+
+// joinsLeft reports whether a letter connects to the letter that follows it
+func joinsLeft(r rune) bool {
+	if r == arabicTatweel {
+		return true
+	}
+	forms, ok := arabicForms[r]
+	return ok && forms[2] != 0
+}
+
+// neighbourIndex finds the nearest non-mark rune in a direction, or -1
+func neighbourIndex(runes []rune, i, step int) int {
+	for j := i + step; j >= 0 && j < len(runes); j += step {
+		if !unicode.Is(unicode.Mn, runes[j]) {
+			return j
+		}
+	}
+	return -1
+}
+
+// neighbourLetter returns the nearest non-mark rune in a direction, or 0
+func neighbourLetter(runes []rune, i, step int) rune {
+	if j := neighbourIndex(runes, i, step); j >= 0 {
+		return runes[j]
+	}
+	return 0
+}
@@ -0,0 +1,27 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"emil/internal/config"
+)
+
+// RendererHealth fails when every HTML renderer found at startup has since
+// been given up on after repeated failures, leaving only the basic layout
+func RendererHealth(cfg *config.Config) error {
+	var disabled []string
+	for _, name := range DetectRenderers(cfg) {
+		if name == RendererBasic {
+			continue
+		}
+		if cfg.Renderers.Breaker(name).Allow() {
+			return nil
+		}
+		disabled = append(disabled, name)
+	}
+	if len(disabled) > 0 {
+		return fmt.Errorf("%s disabled after repeated failures", strings.Join(disabled, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+
+	"emil/internal/config"
+)
+
+// Reaper timings for the shared browser
+const (
+	reapInterval    = 30 * time.Second
+	browserIdleTime = 5 * time.Minute // An unused browser is closed after this long
+)
+
+// browser is the headless Chrome instance shared by all conversions, and all
+// runs, in the process. Each render opens its own tab, so workers never pay
+// for a browser start-up.
+type browser struct {
+	remote   bool // Connect to -chrome-remote instead of starting Chrome
+	mu       sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	base     string    // Directory the browser's run directory is created in (empty = system temp dir)
+	runDir   string    // The browser's own run directory holding its profile, removed when it closes
+	active   int       // Renders currently using the browser
+	holders  int       // Runs holding the browser open with HoldBrowser
+	lastUsed time.Time // When the last render finished
+	stopReap chan struct{}
+}
+
+var sharedBrowser browser
+
+// allocatorOptions returns the Chrome flags for rendering untrusted email
+func allocatorOptions(opts config.ChromeOptions) []chromedp.ExecAllocatorOption {
+	allocOpts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.DisableGPU,
+		chromedp.Flag("headless", true),
+		chromedp.Flag("incognito", true),
+		chromedp.Flag("disk-cache-size", "1"),
+		chromedp.Flag("media-cache-size", "1"),
+		chromedp.Flag("disable-application-cache", true),
+		chromedp.Flag("disable-plugins", true),
+	)
+
+	// Containers often mount a tiny /dev/shm, which crashes Chrome on large pages
+	if free, ok := freeSpace("/dev/shm"); ok && free < minTempFreeBytes {
+		allocOpts = append(allocOpts, chromedp.Flag("disable-dev-shm-usage", true))
+	}
+
+	if opts.ExecPath != "" {
+		allocOpts = append(allocOpts, chromedp.ExecPath(opts.ExecPath))
+	}
+
+	// Chrome refuses to start its sandbox as root, so it is only dropped there
+	// or when asked to, e.g. in containers without user namespaces
+	if opts.NoSandbox || os.Geteuid() == 0 {
+		allocOpts = append(allocOpts, chromedp.NoSandbox)
+	}
+
+	return allocOpts
+}
+
+// acquire returns the browser context for a render, starting Chrome with its
+// files under base on first use or after it has exited. Callers must call
+// release when done.
+func (b *browser) acquire(opts config.ChromeOptions, base string) (context.Context, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ctx == nil || b.ctx.Err() != nil || !b.running() {
+		b.closeLocked()
+		if err := b.startLocked(opts, base); err != nil {
+			return nil, err
+		}
+	}
+
+	b.active++
+	return b.ctx, nil
+}
+
+// release marks a render as finished
+func (b *browser) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.active--
+	b.lastUsed = time.Now()
+}
+
+// startLocked starts Chrome with its own user data directory in a run
+// directory of its own, which outlives the run that started it, and records
+// its PID there, so a later run can clean up after a crash. Callers hold mu.
+func (b *browser) startLocked(opts config.ChromeOptions, base string) error {
+	if b.remote {
+		return b.connectLocked(opts)
+	}
+
+	runDir, err := newRunDir(base)
+	if err != nil {
+		return err
+	}
+	dataDir, err := os.MkdirTemp(runDir, chromeTempPrefix+"*")
+	if err != nil {
+		os.RemoveAll(runDir)
+		return fmt.Errorf("failed to create browser profile directory: %w", err)
+	}
+
+	// Chrome's own temp files, including shared memory when /dev/shm is
+	// too small, go to its run directory too
+	allocOpts := append(allocatorOptions(opts),
+		chromedp.UserDataDir(dataDir),
+		chromedp.Env("TMPDIR="+runDir),
+	)
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(context.Background(), allocOpts...)
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	cancel := func() {
+		cancelBrowser()
+		cancelAlloc()
+	}
+
+	// Ensure that the browser is started
+	if err := chromedp.Run(browserCtx); err != nil {
+		cancel()
+		os.RemoveAll(runDir)
+		return fmt.Errorf("failed to start browser: %w", err)
+	}
+
+	if process := chromedp.FromContext(browserCtx).Browser.Process(); process != nil {
+		if err := writeChromePID(dataDir, process.Pid); err != nil {
+			cancel()
+			os.RemoveAll(runDir)
+			return err
+		}
+	}
+
+	b.ctx, b.cancel, b.base, b.runDir = browserCtx, cancel, base, runDir
+	b.lastUsed = time.Now()
+
+	if b.stopReap == nil {
+		b.stopReap = make(chan struct{})
+		go b.reap(b.stopReap)
+	}
+	return nil
+}
+
+// connectLocked attaches to the remote Chrome. Callers hold mu.
+func (b *browser) connectLocked(opts config.ChromeOptions) error {
+	allocCtx, cancelAlloc := chromedp.NewRemoteAllocator(context.Background(), opts.RemoteURL)
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	cancel := func() {
+		cancelBrowser()
+		cancelAlloc()
+	}
+
+	if err := chromedp.Run(browserCtx); err != nil {
+		cancel()
+		return fmt.Errorf("failed to connect to remote browser: %w", err)
+	}
+
+	b.ctx, b.cancel = browserCtx, cancel
+	b.lastUsed = time.Now()
+	return nil
+}
+
+// running reports whether the browser process is still alive. Callers hold mu.
+func (b *browser) running() bool {
+	process := chromedp.FromContext(b.ctx).Browser.Process()
+	return process == nil || processAlive(process.Pid)
+}
+
+// closeLocked stops the browser and removes its profile. Callers hold mu.
+func (b *browser) closeLocked() {
+	if b.cancel != nil {
+		// Cancelling waits for Chrome to exit
+		b.cancel()
+	}
+	if b.runDir != "" {
+		os.RemoveAll(b.runDir)
+	}
+	b.ctx, b.cancel, b.runDir = nil, nil, ""
+}
+
+// reset closes the browser so the next render starts a fresh one
+func (b *browser) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closeLocked()
+}
+
+// reap periodically closes a browser that has crashed or sat unused, and
+// removes temp directories left by runs that were killed
+func (b *browser) reap(stop chan struct{}) {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		b.mu.Lock()
+		if b.ctx != nil && b.active == 0 &&
+			(!b.running() || time.Since(b.lastUsed) > browserIdleTime) {
+			b.closeLocked()
+		}
+		base := b.base
+		b.mu.Unlock()
+
+		CleanupStaleRenderFiles(base)
+	}
+}
+
+// CloseBrowser shuts down the shared Chrome instance, if one was started
+func CloseBrowser() {
+	sharedBrowser.mu.Lock()
+	defer sharedBrowser.mu.Unlock()
+
+	sharedBrowser.shutdownLocked()
+}
+
+// HoldBrowser keeps the shared Chrome instance open for a run. The returned
+// function lets it go again, shutting the browser down once no run holds it
+// and no render is using it; otherwise the reaper closes it when idle.
+func HoldBrowser() (release func()) {
+	sharedBrowser.mu.Lock()
+	sharedBrowser.holders++
+	sharedBrowser.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			sharedBrowser.mu.Lock()
+			defer sharedBrowser.mu.Unlock()
+
+			sharedBrowser.holders--
+			if sharedBrowser.holders == 0 && sharedBrowser.active == 0 {
+				sharedBrowser.shutdownLocked()
+			}
+		})
+	}
+}
+
+// shutdownLocked stops the reaper and closes the browser. Callers hold mu.
+func (b *browser) shutdownLocked() {
+	if b.stopReap != nil {
+		close(b.stopReap)
+		b.stopReap = nil
+	}
+	b.closeLocked()
+}
@@ -0,0 +1,128 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Prefixes of the temp directories created inside a run directory
+const (
+	htmlTempPrefix    = "emil-html-"
+	chromeTempPrefix  = "emil-chrome-"
+	chromePIDFileName = "emil-chrome.pid"
+)
+
+// ownedTempPattern returns the os.MkdirTemp pattern for a directory owned by this process
+func ownedTempPattern(prefix string) string {
+	return prefix + strconv.Itoa(os.Getpid()) + "-*"
+}
+
+// CleanupStaleRenderFiles removes the run directories under base (empty = the
+// system temp directory) left by emil runs that are no longer running,
+// killing any Chrome they left behind. It returns the number of directories
+// removed.
+func CleanupStaleRenderFiles(base string) int {
+	if base == "" {
+		base = os.TempDir()
+	}
+
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return 0
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || !strings.HasPrefix(name, runTempPrefix) {
+			continue
+		}
+
+		owner := ownerPID(strings.TrimPrefix(name, runTempPrefix))
+		if owner == 0 || owner == os.Getpid() || processAlive(owner) {
+			continue
+		}
+
+		dir := filepath.Join(base, name)
+		if profiles, err := filepath.Glob(filepath.Join(dir, chromeTempPrefix+"*")); err == nil {
+			for _, profile := range profiles {
+				killOrphanedChrome(profile)
+			}
+		}
+		if os.RemoveAll(dir) == nil {
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// ownerPID parses the owner PID from the part of a temp directory name after its prefix
+func ownerPID(rest string) int {
+	pid, _, _ := strings.Cut(rest, "-")
+	n, err := strconv.Atoi(pid)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// killOrphanedChrome kills the browser recorded in a Chrome user data directory,
+// as long as the process still belongs to that directory
+func killOrphanedChrome(dir string) {
+	data, err := os.ReadFile(filepath.Join(dir, chromePIDFileName))
+	if err != nil {
+		return
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || !processAlive(pid) || !processUsesDir(pid, dir) {
+		return
+	}
+
+	if process, err := os.FindProcess(pid); err == nil {
+		process.Kill()
+	}
+}
+
+// writeChromePID records the browser PID in its user data directory
+func writeChromePID(dir string, pid int) error {
+	if err := os.WriteFile(filepath.Join(dir, chromePIDFileName), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return fmt.Errorf("failed to record browser PID: %w", err)
+	}
+	return nil
+}
+
+// processAlive reports whether a process with the PID exists
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// FindProcess only succeeds for running processes on Windows
+		return true
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// processUsesDir reports whether a process was started with the directory on
+// its command line, guarding against PIDs that have since been reused
+func processUsesDir(pid int, dir string) bool {
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		// No /proc outside Linux; ask ps instead
+		cmdline, err = exec.Command("ps", "-o", "command=", "-p", strconv.Itoa(pid)).Output()
+		if err != nil {
+			return false
+		}
+	}
+	return bytes.Contains(cmdline, []byte(dir))
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"html"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,9 +13,13 @@ import (
 
 	"github.com/jhillyerd/enmime"
 	"github.com/jung-kurt/gofpdf"
+	xhtml "golang.org/x/net/html"
 
 	"emil/internal/config"
+	"emil/internal/models"
+	"emil/internal/ocr"
 	"emil/internal/security"
+	"emil/internal/threading"
 )
 
 // ConversionResult contains information about a converted file
@@ -24,35 +30,189 @@ type ConversionResult struct {
 	Error          error
 	Duration       time.Duration
 	Attachments    []AttachmentResult
-	SecurityAlerts []string
+	SecurityAlerts []models.SecurityAlert
+	AlertAction    string // What the alert policy did with the outputs (empty = no alerts)
+	OCRResults     []ocr.Result
+	OutputParts    []string // All files written when the PDF was split into parts
+	OptimizedBytes int64    // Bytes saved by the optimization pass
+	Journal        *JournalInfo
+	BodyPart       string // Which HTML part was rendered when there were several
+	Renderer       string // Backend that produced the PDF, e.g. "chrome" or "basic"
+	MessageID      string // Message-ID header of the converted message
+	Sender         string // Address the message is from, lower-cased
+	Tagged         bool   // The PDF has a structure tree and PDF/UA identification
+	Truncated      bool   // The body was cut off at the page limit
+	EmptyBody      bool   // The message had no body, so a notice was rendered in its place
+	Anomalies      []HeaderAnomaly
+	Delivery       *DeliveryReport
+	Thread         models.ThreadKey // What the message's thread is worked out from at the end of the run
+
+	SkippedAttachments []string // Attachments the attachment policy left out, with the reason
+	PackagePath        string   // ZIP bundle of the outputs, raw message and metadata (empty = not packaged)
+	SidecarPath        string   // JSON metadata written next to the PDF (empty = none)
+}
+
+// documentContent holds everything rendered into the PDF alongside the envelope
+type documentContent struct {
+	Labels       Labels
+	Direction    string // Text direction of the message, "ltr" or "rtl"
+	FontFile     string // Unicode TTF font for right-to-left text and symbols in the fallback renderer
+	EmojiDir     string // Emoji PNG sprites for the fallback renderer
+	QuoteMode    string // How quoted reply text is rendered, see QuoteShow
+	CustomCSS    string // Appended after the built-in styles
+	ExtraHeaders []HeaderField
+	Alerts       []models.SecurityAlert // Security alerts listed at the top (nil = none)
+	Journal      *JournalInfo
+	Delivery     *DeliveryReport
+	ARC          []ARCSet // Forwarding and authentication chain, shown in the appendix (nil = not shown)
+	Hops         []Hop    // Route traced from the Received headers, shown in the appendix (nil = not shown)
+	Attachments  []AttachmentResult
+	OCRResults   []ocr.Result
+	Thumbnails   []thumbnail
+
+	// Dominant script and language, choosing fonts and date formats in the
+	// fallback renderer (zero = not detected)
+	Language language
+
+	// Whether the document is structured for a tagged PDF: a title heading
+	// and plain text split into paragraphs
+	Accessible bool
+
+	// Body pages rendered before the rest is cut off with a notice (0 = no limit)
+	MaxPages int
+
+	// Whether the message has no body, so a notice is shown in its place
+	EmptyBody bool
+
+	// Start of the MIME source, shown in the appendix (nil = not shown)
+	RawSource *rawSource
+
+	// Zone dates are shown in (nil = the zone each was written in)
+	Zone *time.Location
+
+	// Inline images embedded in the HTML body, as data URIs keyed by
+	// Content-ID, and the limits data URI images in the body are shrunk to
+	InlineImages map[string]string
+	ImageLimits  inlineImageLimits
 }
 
 // ConvertEMLToPDF converts an EML file to PDF format with advanced options
-func ConvertEMLToPDF(emlPath string, cfg *config.Config, scanner *security.Scanner) (*ConversionResult, error) {
+func ConvertEMLToPDF(emlPath string, cfg *config.Config, scanner *security.Scanner, ocrEngine *ocr.Engine) (*ConversionResult, error) {
+	return convertEML(emlPath, cfg, scanner, ocrEngine, nil)
+}
+
+// convertEML converts an EML file, rendering in the session's Chrome tab
+// when it has one (nil = a tab of its own)
+func convertEML(emlPath string, cfg *config.Config, scanner *security.Scanner, ocrEngine *ocr.Engine, session *Session) (*ConversionResult, error) {
 	startTime := time.Now()
 	result := &ConversionResult{
 		InputPath: emlPath,
 	}
 
-	// Read and parse the EML file
-	file, err := os.Open(emlPath)
+	// Read and parse the EML file, holding one of the run's open file slots
+	// until it is parsed
+	files := newFileIO(cfg)
+	release := files.openSlot()
+	defer release()
+	file, err := files.openRetry(emlPath)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to open eml file: %w", err)
+		result.Error = classify(ErrorClassIO, fmt.Errorf("failed to open eml file: %w", err))
 		return result, result.Error
 	}
 	defer file.Close()
+	source := files.readAhead(file)
+
+	// The message is read whole when a hook rewrites it or its source is shown
+	message := source
+	var raw []byte
+	if (cfg.Hooks != nil && cfg.Hooks.PreParse != nil) || cfg.RawSource {
+		raw, err = io.ReadAll(source)
+		if err != nil {
+			result.Error = classify(ErrorClassIO, fmt.Errorf("failed to read eml file: %w", err))
+			return result, result.Error
+		}
+		if cfg.Hooks != nil && cfg.Hooks.PreParse != nil {
+			if raw, err = cfg.Hooks.PreParse(emlPath, raw); err != nil {
+				result.Error = classify(ErrorClassHook, fmt.Errorf("pre-parse hook failed: %w", err))
+				return result, result.Error
+			}
+		}
+		message = bytes.NewReader(raw)
+	}
 
 	// Parse the email
-	envelope, err := enmime.ReadEnvelope(file)
+	envelope, err := enmime.ReadEnvelope(message)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to parse eml content: %w", err)
+		result.Error = classify(ErrorClassParse, fmt.Errorf("failed to parse eml content: %w", err))
 		return result, result.Error
 	}
+	file.Close()
+	release()
 
-	// Create PDF output file in the same directory
-	pdfPath := strings.TrimSuffix(emlPath, filepath.Ext(emlPath)) + ".pdf"
+	// Unwrap journal reports so the original message is rendered
+	if cfg.UnwrapJournals {
+		inner, journal, err := unwrapJournal(envelope)
+		if err != nil {
+			// Render the wrapper itself rather than failing
+			if cfg.Verbose {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		} else {
+			envelope = inner
+			result.Journal = journal
+		}
+	}
+
+	if cfg.Hooks != nil && cfg.Hooks.PostParse != nil {
+		if err := cfg.Hooks.PostParse(emlPath, envelope); err != nil {
+			result.Error = classify(ErrorClassHook, fmt.Errorf("post-parse hook failed: %w", err))
+			return result, result.Error
+		}
+	}
+
+	result.MessageID = strings.TrimSpace(envelope.GetHeader("Message-ID"))
+	if from, err := envelope.AddressList("From"); err == nil && len(from) > 0 {
+		result.Sender = strings.ToLower(from[0].Address)
+	}
+	result.Thread = threading.KeyOf(envelope)
+	if cfg.HeaderAnomalies {
+		result.Anomalies = detectAnomalies(envelope, time.Now())
+	}
+
+	// Create the PDF beside the source, unless a routing rule places it elsewhere
+	pdfPath, claim, err := outputPDFPath(emlPath, envelope, cfg)
+	if err != nil {
+		result.Error = classify(ErrorClassIO, err)
+		return result, result.Error
+	}
+	pdfPath = longPath(pdfPath)
 	result.OutputPath = pdfPath
 
+	// A name claimed for the PDF is given up again if the conversion fails,
+	// so its retry gets the same one
+	if claim != nil {
+		defer func() {
+			if result.Error != nil {
+				releaseClaim(pdfPath, claim)
+			}
+		}()
+	}
+
+	// Settle which parts are attachments before saving or embedding them
+	classifyParts(envelope, int64(cfg.InlineAttachKB)*1024)
+
+	// Downscale oversized inline images, keeping the originals with the attachments
+	imageLimits := inlineImageLimits{
+		MaxPixels: cfg.InlineMaxPixels,
+		MaxBytes:  int64(cfg.InlineMaxKB) * 1024,
+	}
+	var inlineImages map[string]string
+	if imageLimits.enabled() {
+		var originals []*enmime.Part
+		inlineImages, originals = shrinkInlineImages(envelope, imageLimits)
+		envelope.Attachments = append(envelope.Attachments, originals...)
+	}
+
 	// Determine attachment directory
 	attachmentDir := cfg.AttachmentDir
 	if attachmentDir == "" {
@@ -61,8 +221,23 @@ func ConvertEMLToPDF(emlPath string, cfg *config.Config, scanner *security.Scann
 	}
 
 	// Handle attachments if enabled
-	if cfg.SaveAttachments && len(envelope.Attachments) > 0 {
-		attachResults, err := HandleAttachments(envelope, attachmentDir, cfg.ScanAttachments, scanner)
+	if cfg.SaveAttachments && (len(envelope.Attachments) > 0 || cfg.SaveInline) {
+		policy := AttachmentPolicy{
+			Allow:           cfg.AttachmentAllow,
+			Block:           cfg.AttachmentBlock,
+			MaxBytes:        int64(cfg.MaxAttachmentMB) * 1024 * 1024,
+			MaxMessageBytes: int64(cfg.MaxAttachTotalMB) * 1024 * 1024,
+			Mode:            cfg.AttachmentMode,
+			StoreDir:        cfg.AttachmentStore,
+			SaveInline:      cfg.SaveInline,
+			Sync:            cfg.AttachmentSync,
+			files:           files,
+			verdicts:        cfg.ScanVerdicts,
+		}
+		if policy.StoreDir == "" {
+			policy.StoreDir = filepath.Join(cfg.SourceOf(emlPath).Dir, defaultStoreDir)
+		}
+		attachResults, err := HandleAttachments(envelope, attachmentDir, policy, cfg.ScanAttachments, scanner)
 		if err != nil {
 			// Just log the error but continue with conversion
 			if cfg.Verbose {
@@ -73,44 +248,445 @@ func ConvertEMLToPDF(emlPath string, cfg *config.Config, scanner *security.Scann
 
 		// Check for security alerts
 		for _, att := range attachResults {
+			if att.Skipped != "" {
+				result.SkippedAttachments = append(result.SkippedAttachments, att.Filename+": "+att.Skipped)
+			}
 			if att.ScanResult != nil && att.ScanResult.Infected {
+				// The hash identifies the malware in the security report
+				sum := att.SHA256
+				if sum == "" {
+					sum, _ = fileSHA256(att.SavedPath)
+				}
 				for _, threat := range att.ScanResult.Threats {
-					alert := fmt.Sprintf("Security threat in %s: %s", att.Filename, threat)
-					result.SecurityAlerts = append(result.SecurityAlerts, alert)
+					result.SecurityAlerts = append(result.SecurityAlerts, models.SecurityAlert{
+						Severity:   models.SeverityCritical,
+						Message:    fmt.Sprintf("Security threat in %s: %s", att.Filename, threat),
+						Attachment: att.Filename,
+						Threat:     threat,
+						SHA256:     sum,
+					})
 				}
 			}
+
+			// A saved attachment that should have been scanned but wasn't
+			// can't be counted as clean
+			if cfg.ScanAttachments && scanner != nil && scanner.IsEnabled() && att.SavedPath != "" && att.ScanResult == nil {
+				result.SecurityAlerts = append(result.SecurityAlerts, models.SecurityAlert{
+					Severity:   models.SeverityWarning,
+					Message:    fmt.Sprintf("Attachment %s could not be scanned", att.Filename),
+					Attachment: att.Filename,
+				})
+			}
 		}
 	}
 
-	// Check if we have HTML content to render with Chrome
-	if envelope.HTML != "" {
-		// Create a complete HTML document with headers, styles and email content
-		htmlContent := buildCompleteHTML(envelope, result.Attachments)
+	// Look the message's links and relays up in the reputation providers
+	result.SecurityAlerts = append(result.SecurityAlerts, checkReputation(envelope, cfg.ReputationChecker, cfg.Verbose)...)
 
-		// Try to use chromedp for rich HTML rendering
-		if err := renderHTMLToPDF(htmlContent, pdfPath); err == nil {
-			result.Success = true
-			result.Duration = time.Since(startTime)
-			return result, nil // Successful HTML conversion
-		} else if cfg.Verbose {
-			fmt.Printf("Advanced HTML conversion failed, falling back to basic PDF: %v\n", err)
+	// Act on the alerts by the policy for their severity
+	action, cause := alertAction(cfg.AlertActions, result.SecurityAlerts)
+	result.AlertAction = action
+	switch action {
+	case AlertSkip, AlertAbort:
+		withholdAttachments(result.Attachments, attachmentDir, cfg)
+		result.OutputPath = ""
+		result.Error = classify(ErrorClassSecurity, fmt.Errorf("outputs withheld by the alert policy: %s", cause))
+		return result, result.Error
+	case AlertQuarantine:
+		if err := quarantineAttachments(result.Attachments, attachmentDir, emlPath, cfg); err != nil {
+			result.Error = classify(ErrorClassIO, fmt.Errorf("failed to quarantine attachments: %w", err))
+			return result, result.Error
 		}
+		pdfPath = quarantinePath(pdfPath, emlPath, cfg)
+		if err := files.mkdirAllRetry(filepath.Dir(pdfPath)); err != nil {
+			result.Error = classify(ErrorClassIO, fmt.Errorf("failed to create quarantine directory: %w", err))
+			return result, result.Error
+		}
+		result.OutputPath = pdfPath
+	}
+
+	// Run OCR on image-only bodies and scanned attachments if enabled
+	if ocrEngine.IsEnabled() {
+		result.OCRResults = recognizeImages(envelope, ocrEngine, cfg.Verbose)
 	}
 
-	// Fallback to basic PDF generation with gofpdf
-	err = convertToBasicPDF(envelope, pdfPath, result.Attachments)
+	labels, err := LabelsFor(cfg.Locale)
 	if err != nil {
-		result.Error = err
-		return result, err
+		result.Error = classify(ErrorClassConfig, err)
+		return result, result.Error
+	}
+
+	// Bounces and read receipts carry a machine-readable report
+	result.Delivery = parseDeliveryReport(envelope)
+
+	// Pick the HTML body when the message has several HTML parts
+	result.BodyPart = selectHTMLBody(envelope, cfg.HTMLPartPolicy, labels)
+
+	content := documentContent{
+		Labels:       labels,
+		Direction:    messageDirection(envelope),
+		FontFile:     cfg.FontFile,
+		EmojiDir:     cfg.EmojiDir,
+		QuoteMode:    cfg.QuoteMode,
+		ExtraHeaders: collectExtraHeaders(envelope, cfg.ExtraHeaders),
+		Journal:      result.Journal,
+		Delivery:     result.Delivery,
+		Attachments:  listedAttachments(result.Attachments),
+		OCRResults:   result.OCRResults,
+		Alerts:       annotatedAlerts(cfg.AlertActions, result.SecurityAlerts),
+	}
+	if cfg.ShowARC {
+		content.ARC = parseARC(envelope)
+	}
+	content.Zone = loadZone(cfg.Timezone)
+	if cfg.ShowHops {
+		content.Hops = hopsInZone(parseReceived(envelope), content.Zone)
+	}
+	if cfg.RawSource {
+		content.RawSource = buildRawSource(raw, int64(cfg.RawSourceKB)*1024)
+	}
+	if cfg.DetectLanguage {
+		content.Language = detectLanguage(envelope)
+	}
+	content.Accessible = cfg.PDFUA
+	content.MaxPages = cfg.TruncatePages
+	content.EmptyBody = isEmptyBody(envelope)
+	result.EmptyBody = content.EmptyBody
+	content.InlineImages = inlineImages
+	content.ImageLimits = imageLimits
+
+	// Load the user stylesheet if one is configured
+	if cfg.CSSFile != "" {
+		css, err := LoadStylesheet(cfg.CSSFile)
+		if err != nil {
+			result.Error = classify(ErrorClassConfig, err)
+			return result, result.Error
+		}
+		content.CustomCSS = css
+	}
+
+	// Build thumbnails for image attachments if enabled
+	if cfg.ThumbnailImages {
+		content.Thumbnails = buildThumbnails(envelope)
+	}
+
+	// Split oversized PDFs into parts if limits are set
+	limits := splitLimits{
+		MaxBytes: int64(cfg.MaxPDFMB) * 1024 * 1024,
+		MaxPages: cfg.MaxPDFPages,
+	}
+	wait := renderWait{
+		Policy: cfg.RenderWait,
+		Max:    time.Duration(cfg.RenderWaitMS) * time.Millisecond,
+	}
+
+	// Create a complete HTML document with headers, styles and email content.
+	// Tagged PDFs come only from Chrome, so plain text is rendered as HTML too.
+	var htmlContent string
+	lang := documentLanguage(content.Language, cfg.Locale)
+	if envelope.HTML != "" || cfg.PDFUA {
+		htmlContent = buildCompleteHTML(envelope, content)
+		if cfg.TemplateFile != "" {
+			tmpl, err := loadTemplate(cfg.TemplateFile, content.Zone)
+			if err != nil {
+				result.Error = classify(ErrorClassConfig, err)
+				return result, result.Error
+			}
+			if htmlContent, err = renderTemplate(tmpl, envelope, content); err != nil {
+				result.Error = classify(ErrorClassConfig, err)
+				return result, result.Error
+			}
+		}
+
+		if cfg.Hooks != nil && cfg.Hooks.PreRender != nil {
+			if htmlContent, err = cfg.Hooks.PreRender(emlPath, htmlContent); err != nil {
+				result.Error = classify(ErrorClassHook, fmt.Errorf("pre-render hook failed: %w", err))
+				return result, result.Error
+			}
+		}
+		if cfg.PDFUA {
+			htmlContent = makeAccessible(htmlContent, envelope, lang, labels)
+		}
+	}
+
+	// Use the first renderer in the preference order that succeeds. Plain
+	// text messages have no HTML to render and always use the basic layout.
+	renderers := DetectRenderers(cfg)
+	if htmlContent == "" {
+		renderers = []string{RendererBasic}
+	} else if cfg.PDFUA {
+		renderers = accessibleRenderers(renderers)
+	}
+
+	var lastErr error
+	for _, renderer := range renderers {
+		if renderer == RendererBasic {
+			// Basic PDF generation with gofpdf
+			parts, truncated, err := convertToBasicPDF(envelope, pdfPath, content, limits, files)
+			if err != nil {
+				result.Error = classify(ErrorClassRender, err)
+				return result, result.Error
+			}
+			result.setOutputParts(parts)
+			result.Truncated = truncated
+			result.Renderer = renderer
+			break
+		}
+
+		breaker := cfg.Renderers.Breaker(renderer)
+		if !breaker.Allow() {
+			continue
+		}
+		parts, truncated, err := renderHTMLWith(renderer, htmlContent, pdfPath, envelope.GetHeader("Subject"), labels, limits, wait, cfg, session)
+		if err != nil {
+			breaker.Failure(cfg.Chrome.MaxFailures, err)
+			lastErr = err
+			if cfg.Verbose {
+				fmt.Printf("Rendering with %s failed, trying the next renderer: %v\n", renderer, err)
+			}
+			continue
+		}
+		breaker.Success()
+		result.setOutputParts(parts)
+		result.Truncated = truncated
+		result.Renderer = renderer
+		break
+	}
+
+	if result.Renderer == "" {
+		err := fmt.Errorf("no renderer in the preference order succeeded")
+		if lastErr != nil {
+			err = fmt.Errorf("%w (last error: %v)", err, lastErr)
+		}
+		result.Error = classify(ErrorClassRender, err)
+		return result, result.Error
+	}
+	if cfg.PDFUA {
+		result.Tagged = TagsPDF(result.Renderer)
+		if !result.Tagged && cfg.Verbose {
+			fmt.Printf("Warning: %s was rendered with %s, which can't write tagged PDFs; it is not PDF/UA\n", emlPath, result.Renderer)
+		}
+	}
+
+	// Shrink the written PDFs if optimization is enabled
+	if cfg.OptimizePDF {
+		for _, path := range result.outputFiles() {
+			saved, err := optimizePDF(path, cfg.OptimizeImageDPI, result.Tagged)
+			if err != nil {
+				// Keep the unoptimized PDF
+				if cfg.Verbose {
+					fmt.Printf("Warning: PDF optimization failed for %s: %v\n", path, err)
+				}
+				continue
+			}
+			result.OptimizedBytes += saved
+		}
+	}
+
+	// Tag the finished PDFs for records management, with the envelope of a
+	// journaled message, and identify tagged PDFs as PDF/UA
+	properties := cfg.XMPProperties
+	if result.Journal != nil {
+		properties = maps.Clone(cfg.XMPProperties)
+		if properties == nil {
+			properties = make(map[string]string)
+		}
+		maps.Copy(properties, result.Journal.xmpProperties())
+	}
+	if len(properties) > 0 || result.Tagged {
+		packet := buildXMP(envelope.GetHeader("Subject"), properties, result.Tagged)
+		var catalog string
+		if result.Tagged {
+			catalog = accessibilityCatalog(lang)
+		}
+		for _, path := range result.outputFiles() {
+			if err := embedXMP(path, packet, catalog); err != nil {
+				result.Error = classify(ErrorClassRender, fmt.Errorf("failed to embed XMP metadata: %w", err))
+				return result, result.Error
+			}
+		}
+	}
+
+	// Check the finished PDFs before counting them converted. One that fails
+	// is never kept: the outputs are withheld as under skip, or the run
+	// aborted if the policy says so for the finding's severity.
+	if cfg.ScanOutput {
+		if alerts := checkOutputs(result.outputFiles(), scanner); len(alerts) > 0 {
+			result.SecurityAlerts = append(result.SecurityAlerts, alerts...)
+			action, cause := alertAction(cfg.AlertActions, alerts)
+			if action != AlertAbort {
+				action = AlertSkip
+			}
+			for _, path := range result.outputFiles() {
+				os.Remove(path)
+			}
+			withholdAttachments(result.Attachments, attachmentDir, cfg)
+			result.AlertAction = action
+			result.OutputPath = ""
+			result.OutputParts = nil
+			result.Error = classify(ErrorClassSecurity, fmt.Errorf("outputs withheld by the output check: %s", cause))
+			return result, result.Error
+		}
+	}
+
+	// Bundle everything written for the message into one file
+	if cfg.PackageZip {
+		path, err := writePackage(emlPath, envelope, result, files)
+		if err != nil {
+			result.Error = classify(ErrorClassIO, err)
+			return result, result.Error
+		}
+		result.PackagePath = path
+	}
+
+	// Describe the message for indexing systems
+	if cfg.WriteSidecar {
+		path, err := writeSidecar(emlPath, envelope, result, files)
+		if err != nil {
+			result.Error = classify(ErrorClassIO, err)
+			return result, result.Error
+		}
+		result.SidecarPath = path
+	}
+
+	// Carry the source's timestamp and ownership over to the outputs
+	if cfg.PreserveTimes != "" || cfg.PreserveOwner {
+		paths := result.outputFiles()
+		for _, path := range []string{result.PackagePath, result.SidecarPath} {
+			if path != "" {
+				paths = append(paths, path)
+			}
+		}
+		for _, att := range result.Attachments {
+			// Deduplicated attachments are shared with other messages
+			if att.SavedPath != "" && att.SHA256 == "" {
+				paths = append(paths, att.SavedPath)
+			}
+		}
+		if err := preserveSource(emlPath, envelope, cfg.PreserveTimes, cfg.PreserveOwner, paths); err != nil && cfg.Verbose {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	if cfg.Hooks != nil && cfg.Hooks.PostWrite != nil {
+		if err := cfg.Hooks.PostWrite(emlPath, result.outputFiles()); err != nil {
+			result.Error = classify(ErrorClassHook, fmt.Errorf("post-write hook failed: %w", err))
+			return result, result.Error
+		}
 	}
 
+	// Detonate the attachments in the sandbox in the background; the
+	// verdicts are merged into the report at the end of the run
+	submitToSandbox(cfg.SandboxClient, emlPath, result.Attachments)
+
 	result.Success = true
 	result.Duration = time.Since(startTime)
 	return result, nil
 }
 
+// PDFPath returns where the PDF for an EML file is written
+func PDFPath(emlPath string) string {
+	return strings.TrimSuffix(emlPath, filepath.Ext(emlPath)) + ".pdf"
+}
+
+// OutputFiles returns the PDF files present for an EML file: the PDF itself,
+// or its numbered parts if it was split. It returns nil if there are none.
+func OutputFiles(emlPath string) []string {
+	pdfPath := PDFPath(emlPath)
+	if _, err := os.Stat(pdfPath); err == nil {
+		return []string{pdfPath}
+	}
+
+	var parts []string
+	for part := 1; ; part++ {
+		path := partPath(pdfPath, part)
+		if _, err := os.Stat(path); err != nil {
+			return parts
+		}
+		parts = append(parts, path)
+	}
+}
+
+// OutputDir reports whether a directory holds what runs write among the
+// sources rather than messages to convert: a PDF's attachment folder, the
+// quarantine or the attachment store, where cfg puts them or by default
+func OutputDir(dir string, cfg *config.Config) bool {
+	if base, ok := strings.CutSuffix(dir, "_attachments"); ok && len(OutputFiles(base+".pdf")) > 0 {
+		return true
+	}
+
+	outputs := []string{cfg.QuarantineDir, cfg.AttachmentStore, cfg.AttachmentDir}
+	for _, source := range cfg.SourceList() {
+		outputs = append(outputs, filepath.Join(source.Dir, defaultQuarantineDir), filepath.Join(source.Dir, defaultStoreDir))
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	for _, output := range outputs {
+		if output == "" {
+			continue
+		}
+		if output, err := filepath.Abs(output); err == nil && output == abs {
+			return true
+		}
+	}
+	return false
+}
+
+// OutputRoots returns every directory a run may write outputs under: the
+// sources, the organized tree, routed and manifest output directories, the
+// quarantine, the attachment store and the attachment directory, each once
+func OutputRoots(cfg *config.Config) []string {
+	var roots []string
+	for _, source := range cfg.SourceList() {
+		roots = append(roots, source.Dir)
+		if cfg.QuarantineDir == "" {
+			roots = append(roots, filepath.Join(source.Dir, defaultQuarantineDir))
+		}
+		if cfg.AttachmentStore == "" {
+			roots = append(roots, filepath.Join(source.Dir, defaultStoreDir))
+		}
+	}
+	roots = append(roots, cfg.OrganizeDir, cfg.QuarantineDir, cfg.AttachmentStore, cfg.AttachmentDir)
+	roots = append(roots, cfg.Routes.OutputDirs()...)
+	roots = append(roots, cfg.Manifest.OutputDirs()...)
+
+	seen := make(map[string]bool)
+	unique := roots[:0]
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+		if !seen[root] {
+			seen[root] = true
+			unique = append(unique, root)
+		}
+	}
+	return unique
+}
+
+// outputFiles returns every PDF file written for the result
+func (r *ConversionResult) outputFiles() []string {
+	if len(r.OutputParts) > 0 {
+		return r.OutputParts
+	}
+	return []string{r.OutputPath}
+}
+
+// setOutputParts records the files written for the PDF, pointing OutputPath at the first
+func (r *ConversionResult) setOutputParts(parts []string) {
+	if len(parts) > 1 {
+		r.OutputParts = parts
+		r.OutputPath = parts[0]
+	}
+}
+
 // buildCompleteHTML creates a well-formed HTML document from email parts
-func buildCompleteHTML(envelope *enmime.Envelope, attachments []AttachmentResult) string {
+func buildCompleteHTML(envelope *enmime.Envelope, content documentContent) string {
 	var buffer bytes.Buffer
 
 	// Start with HTML doctype and basic structure
@@ -120,36 +696,157 @@ func buildCompleteHTML(envelope *enmime.Envelope, attachments []AttachmentResult
 
 	// Add styles for email
 	buffer.WriteString("<style>\n")
-	buffer.WriteString("body { font-family: Arial, sans-serif; margin: 20px; }\n")
+	writeHTMLStyles(&buffer)
+	buffer.WriteString(content.CustomCSS)
+	buffer.WriteString("</style>\n")
+	buffer.WriteString("</head>\n<body>\n")
+
+	writeHTMLHeaderBlock(&buffer, envelope, content)
+	if content.MaxPages > 0 {
+		openPageGuard(&buffer, content.MaxPages)
+		writeHTMLBody(&buffer, envelope, content)
+		closePageGuard(&buffer, content.MaxPages, content.Labels)
+	} else {
+		writeHTMLBody(&buffer, envelope, content)
+	}
+	writeHTMLAppendix(&buffer, envelope, content)
+
+	buffer.WriteString("</body>\n</html>")
+	return buffer.String()
+}
+
+// writeHTMLStyles adds the built-in stylesheet rules to the HTML buffer
+func writeHTMLStyles(buffer *bytes.Buffer) {
+	buffer.WriteString("body { font-family: Arial, Helvetica, \"Noto Sans\", \"DejaVu Sans\", \"Segoe UI\", sans-serif; margin: 20px; }\n")
 	buffer.WriteString(".email-header { margin-bottom: 20px; border-bottom: 1px solid #ccc; padding-bottom: 10px; }\n")
 	buffer.WriteString(".header-row { margin: 5px 0; }\n")
-	buffer.WriteString(".header-label { font-weight: bold; width: 60px; display: inline-block; }\n")
+	buffer.WriteString(".header-label { font-weight: bold; min-width: 60px; display: inline-block; }\n")
+	buffer.WriteString(".journal { margin-bottom: 20px; border-bottom: 1px solid #ccc; padding-bottom: 10px; }\n")
+	buffer.WriteString(".delivery-report { margin-bottom: 20px; border-bottom: 1px solid #ccc; padding-bottom: 10px; }\n")
+	buffer.WriteString(".delivery-recipient { margin: 10px 0; padding-left: 10px; border-left: 3px solid #ccc; }\n")
+	buffer.WriteString(".delivery-failed { border-left-color: #c00; }\n")
 	buffer.WriteString(".email-body { margin-top: 20px; }\n")
 	buffer.WriteString(".attachments { margin-top: 30px; border-top: 1px solid #eee; padding-top: 10px; }\n")
 	buffer.WriteString(".attachment-item { margin: 5px 0; }\n")
 	buffer.WriteString(".security-alert { color: red; font-weight: bold; }\n")
-	buffer.WriteString("</style>\n")
-	buffer.WriteString("</head>\n<body>\n")
+	buffer.WriteString(".alert-list { margin-bottom: 20px; padding: 5px 10px; border: 2px solid #c00; }\n")
+	buffer.WriteString(".alert-list h3 { color: #c00; margin: 5px 0; }\n")
+	buffer.WriteString(".alert-critical { color: #c00; font-weight: bold; }\n")
+	buffer.WriteString(".alert-warning { color: #a60; }\n")
+	buffer.WriteString(".attachment-skipped { color: #777; font-style: italic; }\n")
+	buffer.WriteString(".gallery { margin-top: 30px; border-top: 1px solid #eee; padding-top: 10px; page-break-before: always; }\n")
+	buffer.WriteString(".gallery-item { display: inline-block; width: 30%; margin: 0 1% 15px; text-align: center; vertical-align: top; page-break-inside: avoid; }\n")
+	buffer.WriteString(".gallery-item img { max-width: 100%; max-height: 200px; }\n")
+	buffer.WriteString(".gallery-item figcaption { font-size: 0.8em; word-break: break-all; }\n")
+	buffer.WriteString(".ocr-text { margin-top: 30px; border-top: 1px solid #eee; padding-top: 10px; }\n")
+	buffer.WriteString(".ocr-text pre { white-space: pre-wrap; font-family: inherit; }\n")
+	buffer.WriteString(".html-alternative + .html-alternative { page-break-before: always; }\n")
+	buffer.WriteString(".html-alternative-label { color: #555; border-bottom: 1px solid #eee; padding-bottom: 5px; }\n")
+	buffer.WriteString(".quoted-text { color: #666; border-left: 3px solid #ccc; margin-left: 0; padding-left: 10px; }\n")
+	buffer.WriteString(".quoted-collapsed { color: #888; font-style: italic; margin: 10px 0; }\n")
+	buffer.WriteString(".arc-chain { margin-top: 30px; border-top: 1px solid #eee; padding-top: 10px; font-size: 0.9em; }\n")
+	buffer.WriteString(".arc-set { margin: 10px 0; padding-left: 10px; border-left: 3px solid #ccc; }\n")
+	buffer.WriteString(".arc-broken { border-left-color: #c00; }\n")
+	buffer.WriteString(".received-hops { margin-top: 30px; border-top: 1px solid #eee; padding-top: 10px; font-size: 0.85em; }\n")
+	buffer.WriteString(".received-hops table { border-collapse: collapse; width: 100%; }\n")
+	buffer.WriteString(".received-hops th, .received-hops td { border: 1px solid #ddd; padding: 3px 5px; text-align: left; word-break: break-all; }\n")
+	buffer.WriteString(".raw-source { margin-top: 30px; border-top: 1px solid #eee; padding-top: 10px; page-break-before: always; }\n")
+	buffer.WriteString(".raw-source table { border-collapse: collapse; font-family: monospace; font-size: 0.75em; }\n")
+	buffer.WriteString(".raw-source td { padding: 0 6px; white-space: pre-wrap; word-break: break-all; vertical-align: top; }\n")
+	buffer.WriteString(".raw-source .source-number { color: #999; text-align: right; border-right: 1px solid #ddd; user-select: none; }\n")
+	buffer.WriteString(".source-header td + td { font-weight: bold; }\n")
+	buffer.WriteString(".source-boundary td + td { font-weight: bold; color: #0046a0; }\n")
+	buffer.WriteString(".source-body td + td { color: #444; }\n")
+	buffer.WriteString(".email-title { font-size: 1.3em; margin: 0 0 10px; }\n")
+	buffer.WriteString(".empty-body { color: #666; font-style: italic; }\n")
+	buffer.WriteString(".page-guard { position: relative; overflow: hidden; }\n")
+	buffer.WriteString(".page-guard-notice { position: absolute; left: 0; right: 0; height: 6em; box-sizing: border-box; padding: 1.5em 0; background: #fff; border-top: 2px solid #c00; color: #c00; font-weight: bold; }\n")
+
+	// Normalize email markup so wide layouts fit the printed page
+	buffer.WriteString("@page { margin: 12mm; }\n")
+	buffer.WriteString("html { -webkit-print-color-adjust: exact; print-color-adjust: exact; }\n")
+	buffer.WriteString(".email-body { max-width: 100%; overflow-wrap: anywhere; }\n")
+	buffer.WriteString(".email-body * { max-width: 100% !important; box-sizing: border-box; }\n")
+	buffer.WriteString(".email-body img { height: auto !important; }\n")
+	buffer.WriteString(".email-body table { table-layout: auto; width: auto; border-collapse: collapse; }\n")
+	buffer.WriteString(".email-body td, .email-body th { word-break: break-word; }\n")
+	buffer.WriteString(".email-body pre, .email-body code { white-space: pre-wrap; word-break: break-all; }\n")
+	buffer.WriteString(".email-body tr, .email-body img { page-break-inside: avoid; }\n")
+}
 
-	// Add email headers section
+// writeHTMLHeaderBlock adds the email headers and journal metadata to the HTML buffer
+func writeHTMLHeaderBlock(buffer *bytes.Buffer, envelope *enmime.Envelope, content documentContent) {
+	// Add email headers section, headed by the subject in tagged PDFs
 	buffer.WriteString("<div class=\"email-header\">\n")
-	addHeader(&buffer, "From", envelope.GetHeader("From"))
-	addHeader(&buffer, "To", envelope.GetHeader("To"))
+	labels := content.Labels
+	if content.Accessible {
+		buffer.WriteString("<h1 class=\"email-title\">" + html.EscapeString(envelope.GetHeader("Subject")) + "</h1>\n")
+	}
+	addHeader(buffer, labels.From, envelope.GetHeader("From"))
+	addHeader(buffer, labels.To, envelope.GetHeader("To"))
 	if cc := envelope.GetHeader("Cc"); cc != "" {
-		addHeader(&buffer, "Cc", cc)
+		addHeader(buffer, labels.Cc, cc)
+	}
+	addHeader(buffer, labels.Subject, envelope.GetHeader("Subject"))
+	addHeader(buffer, labels.Date, formatMessageDate(envelope.GetHeader("Date"), defaultDateLayout, content.Zone))
+	for _, field := range content.ExtraHeaders {
+		addHeader(buffer, field.Name, field.Value)
 	}
-	addHeader(&buffer, "Subject", envelope.GetHeader("Subject"))
-	addHeader(&buffer, "Date", formatDate(envelope.GetHeader("Date")))
 	buffer.WriteString("</div>\n")
 
-	// Add email body
-	buffer.WriteString("<div class=\"email-body\">\n")
+	// Warn of the message's security alerts before anything else
+	if len(content.Alerts) > 0 {
+		buffer.WriteString("<div class=\"alert-list\">\n")
+		buffer.WriteString("<h3>" + html.EscapeString(labels.SecurityAlerts) + "</h3>\n<ul>\n")
+		for _, alert := range content.Alerts {
+			buffer.WriteString("<li class=\"alert-" + alert.Severity + "\">" + html.EscapeString(strings.ToUpper(alert.Severity)) +
+				": " + html.EscapeString(alert.Message) + "</li>\n")
+		}
+		buffer.WriteString("</ul>\n</div>\n")
+	}
+
+	// Add envelope recipients recovered from a journal report
+	if content.Journal != nil {
+		writeHTMLJournal(buffer, content.Journal, labels)
+	}
+
+	// Add the structured outcome of a bounce or read receipt
+	if content.Delivery != nil {
+		writeHTMLDelivery(buffer, content.Delivery, labels)
+	}
+}
+
+// writeHTMLBody adds the email body to the HTML buffer
+func writeHTMLBody(buffer *bytes.Buffer, envelope *enmime.Envelope, content documentContent) {
+	// Add email body, letting the browser apply the bidi algorithm for RTL messages
+	buffer.WriteString("<div class=\"email-body\" dir=\"" + content.Direction + "\">\n")
 	// Use original HTML content if available
-	if envelope.HTML != "" {
-		buffer.WriteString(envelope.HTML)
+	if content.EmptyBody {
+		buffer.WriteString("<p class=\"empty-body\">" + html.EscapeString(content.Labels.EmptyBody) + "</p>\n")
+	} else if envelope.HTML != "" {
+		body := transformHTMLQuotes(envelope.HTML, content.QuoteMode, content.Labels)
+		if content.ImageLimits.enabled() {
+			body = embedInlineImages(body, content.InlineImages, content.ImageLimits)
+		}
+		buffer.WriteString(body)
 	} else if envelope.Text != "" {
+		text := envelope.Text
+		switch content.QuoteMode {
+		case QuoteMark:
+			writeTextQuotesHTML(buffer, text)
+			buffer.WriteString("</div>\n")
+			return
+		case QuoteCollapse:
+			text = collapseTextQuotes(text, content.Labels)
+		}
+		if content.Accessible {
+			writeHTMLParagraphs(buffer, text)
+			buffer.WriteString("</div>\n")
+			return
+		}
+
 		// Convert plain text to HTML paragraphs
-		lines := strings.Split(envelope.Text, "\n")
+		lines := strings.Split(text, "\n")
 		for _, line := range lines {
 			if line == "" {
 				buffer.WriteString("<br>\n")
@@ -159,19 +856,28 @@ func buildCompleteHTML(envelope *enmime.Envelope, attachments []AttachmentResult
 		}
 	}
 	buffer.WriteString("</div>\n")
+}
+
+// writeHTMLAppendix adds attachments, thumbnails, recognized text, the ARC
+// chain and the Received route to the HTML buffer
+func writeHTMLAppendix(buffer *bytes.Buffer, envelope *enmime.Envelope, content documentContent) {
+	labels := content.Labels
 
 	// Add attachments if any
-	if len(attachments) > 0 {
+	if len(content.Attachments) > 0 {
 		buffer.WriteString("<div class=\"attachments\">\n")
-		buffer.WriteString("<h3>Attachments (" + fmt.Sprintf("%d", len(attachments)) + ")</h3>\n")
+		buffer.WriteString("<h3>" + html.EscapeString(labels.Attachments) + " (" + fmt.Sprintf("%d", len(content.Attachments)) + ")</h3>\n")
 		buffer.WriteString("<ul>\n")
-		for _, att := range attachments {
+		for _, att := range content.Attachments {
 			buffer.WriteString("<li class=\"attachment-item\">")
 			buffer.WriteString(html.EscapeString(att.Filename) + " (" + formatBytes(att.Size) + ")")
+			if att.Skipped != "" {
+				buffer.WriteString(" <span class=\"attachment-skipped\">" + html.EscapeString(labels.NotSaved) + "</span>")
+			}
 
 			// Add security alerts if present
 			if att.ScanResult != nil && att.ScanResult.Infected {
-				buffer.WriteString(" <span class=\"security-alert\">SECURITY THREAT DETECTED</span>")
+				buffer.WriteString(" <span class=\"security-alert\">" + html.EscapeString(labels.SecurityThreat) + "</span>")
 			}
 
 			buffer.WriteString("</li>\n")
@@ -181,7 +887,7 @@ func buildCompleteHTML(envelope *enmime.Envelope, attachments []AttachmentResult
 	} else if len(envelope.Attachments) > 0 {
 		// Fall back to envelope attachments if no processed attachments
 		buffer.WriteString("<div class=\"attachments\">\n")
-		buffer.WriteString("<h3>Attachments (" + fmt.Sprintf("%d", len(envelope.Attachments)) + ")</h3>\n")
+		buffer.WriteString("<h3>" + html.EscapeString(labels.Attachments) + " (" + fmt.Sprintf("%d", len(envelope.Attachments)) + ")</h3>\n")
 		buffer.WriteString("<ul>\n")
 		for _, att := range envelope.Attachments {
 			buffer.WriteString("<li class=\"attachment-item\">" + html.EscapeString(att.FileName) +
@@ -191,132 +897,296 @@ func buildCompleteHTML(envelope *enmime.Envelope, attachments []AttachmentResult
 		buffer.WriteString("</div>\n")
 	}
 
-	buffer.WriteString("</body>\n</html>")
-	return buffer.String()
+	// Add thumbnail gallery for image attachments
+	if len(content.Thumbnails) > 0 {
+		writeHTMLGallery(buffer, content.Thumbnails, labels)
+	}
+
+	// Add recognized text so image content is searchable
+	if len(content.OCRResults) > 0 {
+		buffer.WriteString("<div class=\"ocr-text\">\n")
+		buffer.WriteString("<h3>" + html.EscapeString(labels.RecognizedText) + "</h3>\n")
+		for _, res := range content.OCRResults {
+			buffer.WriteString("<h4>" + html.EscapeString(ocrSource(res, labels)) + "</h4>\n")
+			buffer.WriteString("<pre>" + html.EscapeString(res.Text) + "</pre>\n")
+		}
+		buffer.WriteString("</div>\n")
+	}
+
+	// Add the servers that forwarded the message and what they authenticated
+	if len(content.ARC) > 0 {
+		writeHTMLARC(buffer, content.ARC, labels)
+	}
+
+	// Add the servers the message passed through, for tracing its delivery
+	if len(content.Hops) > 0 {
+		writeHTMLHops(buffer, content.Hops, labels)
+	}
+
+	// Add the raw source for inspecting boundaries and encodings
+	if content.RawSource != nil {
+		writeHTMLRawSource(buffer, content.RawSource, labels)
+	}
 }
 
-// convertToBasicPDF creates a PDF using gofpdf
-func convertToBasicPDF(envelope *enmime.Envelope, pdfPath string, attachments []AttachmentResult) error {
+// convertToBasicPDF creates a PDF using gofpdf and returns the files written,
+// and whether the body was cut off at the page limit
+func convertToBasicPDF(envelope *enmime.Envelope, pdfPath string, content documentContent, limits splitLimits, files fileIO) ([]string, bool, error) {
+	var truncated bool
+	draw := func(pdf *gofpdf.Fpdf) {
+		truncated = drawBasicPDF(pdf, envelope, content)
+	}
+
+	if limits.enabled() {
+		paths, err := splitBasicPDF(draw, envelope.GetHeader("Subject"), content.Labels.forPDF(), limits, pdfPath, files)
+		return paths, truncated, err
+	}
+
 	// Create a new PDF document
 	pdf := gofpdf.New("P", "mm", "A4", "")
 	pdf.SetMargins(10, 10, 10)
 	pdf.AddPage()
+	draw(pdf)
+
+	// Save the PDF
+	data, err := outputBasicPDF(pdf)
+	if err != nil {
+		return nil, false, err
+	}
+	paths, err := writeParts(pdfPath, [][]byte{data}, files)
+	return paths, truncated, err
+}
+
+// drawBasicPDF draws the email onto a PDF that already has its first page,
+// reporting whether the body was cut off at the page limit
+func drawBasicPDF(pdf *gofpdf.Fpdf, envelope *enmime.Envelope, content documentContent) bool {
+	// Core fonts are cp1252, so labels are translated from UTF-8
+	labels := translateLabels(pdf, content.Labels.forPDF())
 
 	// Set up formatting
 	pdf.SetFont("Arial", "B", 12)
 
+	// Right-to-left text, emoji and, once the script is detected, any text
+	// outside Windows-1252 need a Unicode font the core fonts can't replace
+	bodyText := envelope.Text
+	if envelope.HTML != "" {
+		bodyText = parseHTML(envelope.HTML)
+	}
+	style := textStyle{EmojiDir: content.EmojiDir, Zone: content.Zone}
+	if content.Language.Script != "" {
+		style.Script = content.Language.Script
+		style.DateLayout = dateLayout(content.Language.Code)
+	}
+	headerText := envelope.GetHeader("From") + envelope.GetHeader("To") + envelope.GetHeader("Cc") + envelope.GetHeader("Subject")
+	if content.Direction == directionRTL || hasEmoji(bodyText) || hasEmoji(envelope.GetHeader("Subject")) ||
+		(style.Script != "" && !fitsCoreFonts(bodyText+headerText)) {
+		style.Unicode = registerUnicodeFont(pdf, content.FontFile, style.Script)
+	}
+	style.RTL = style.Unicode && content.Direction == directionRTL
+
 	// Add email header information
-	addEmailHeaders(pdf, envelope)
+	addEmailHeaders(pdf, envelope, labels, style)
+	addExtraHeaders(pdf, content.ExtraHeaders)
+
+	// Warn of the message's security alerts before anything else
+	if len(content.Alerts) > 0 {
+		addPDFAlerts(pdf, content.Alerts, labels)
+	}
+
+	// Add envelope recipients recovered from a journal report
+	if content.Journal != nil {
+		addPDFJournal(pdf, content.Journal, labels)
+	}
+
+	// Add the structured outcome of a bounce or read receipt
+	if content.Delivery != nil {
+		addPDFDelivery(pdf, content.Delivery, labels)
+	}
 
 	// Add a divider line
 	pdf.Line(10, pdf.GetY()+5, 200, pdf.GetY()+5)
 	pdf.SetY(pdf.GetY() + 10)
 
-	// Add email body (try HTML first, then plain text)
-	if envelope.HTML != "" {
-		addEnhancedHTMLContent(pdf, envelope.HTML)
-	} else if envelope.Text != "" {
-		addPlainTextContent(pdf, envelope.Text)
+	// Add email body, up to the page limit
+	truncated := drawTruncated(pdf, content.MaxPages, func() {
+		drawBasicBody(pdf, envelope, content, labels, style, bodyText)
+	})
+	if truncated {
+		addPDFTruncationNotice(pdf, content.MaxPages, labels)
 	}
 
 	// Add attachment information with security alerts
-	if len(attachments) > 0 {
+	if len(content.Attachments) > 0 {
 		pdf.Ln(10)
 		pdf.SetFont("Arial", "B", 12)
-		pdf.Cell(0, 10, fmt.Sprintf("Attachments (%d):", len(attachments)))
+		pdf.Cell(0, 10, fmt.Sprintf("%s (%d):", labels.Attachments, len(content.Attachments)))
 		pdf.Ln(5)
 
 		pdf.SetFont("Arial", "", 10)
-		for _, att := range attachments {
+		for _, att := range content.Attachments {
 			attackInfo := fmt.Sprintf("- %s (%s)", att.Filename, formatBytes(att.Size))
+			if att.Skipped != "" {
+				attackInfo += " - " + labels.NotSaved
+			}
 			pdf.Cell(0, 5, attackInfo)
 			pdf.Ln(5)
 
 			// Add security warnings for infected attachments
 			if att.ScanResult != nil && att.ScanResult.Infected {
 				pdf.SetTextColor(255, 0, 0) // Red text for warning
-				pdf.Cell(0, 5, "  SECURITY ALERT: Malware detected in this attachment")
+				pdf.Cell(0, 5, "  "+labels.MalwareDetected)
 				pdf.SetTextColor(0, 0, 0) // Reset to black
 				pdf.Ln(5)
 			}
 		}
 	} else if len(envelope.Attachments) > 0 {
 		// Fall back to basic attachment list
-		addAttachmentsInfo(pdf, envelope.Attachments)
+		addAttachmentsInfo(pdf, envelope.Attachments, labels)
 	}
 
-	// Save the PDF
-	err := pdf.OutputFileAndClose(pdfPath)
-	if err != nil {
-		return fmt.Errorf("failed to write pdf file: %w", err)
+	// Add thumbnail gallery for image attachments
+	if len(content.Thumbnails) > 0 {
+		addPDFGallery(pdf, content.Thumbnails, labels)
+	}
+
+	// Add recognized text from images
+	if len(content.OCRResults) > 0 {
+		addOCRText(pdf, content.OCRResults, labels)
 	}
 
-	return nil
+	// Add the servers that forwarded the message and what they authenticated
+	if len(content.ARC) > 0 {
+		addPDFARC(pdf, content.ARC, labels)
+	}
+
+	// Add the servers the message passed through, for tracing its delivery
+	if len(content.Hops) > 0 {
+		addPDFHops(pdf, content.Hops, labels)
+	}
+
+	// Add the raw source for inspecting boundaries and encodings
+	if content.RawSource != nil {
+		addPDFRawSource(pdf, content.RawSource, labels)
+	}
+	return truncated
+}
+
+// drawBasicBody draws the email body, trying HTML first, then plain text
+func drawBasicBody(pdf *gofpdf.Fpdf, envelope *enmime.Envelope, content documentContent, labels Labels, style textStyle, bodyText string) {
+	switch {
+	case content.EmptyBody:
+		pdf.SetFont("Arial", "I", 11)
+		pdf.SetTextColor(102, 102, 102)
+		addHeaderValue(pdf, labels.EmptyBody, style)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.SetFont("Arial", "", 11)
+		pdf.Ln(10)
+	case style.RTL:
+		text := bodyText
+		if content.QuoteMode == QuoteCollapse {
+			text = collapseTextQuotes(text, labels)
+		}
+		addRTLContent(pdf, text)
+	case style.wide(bodyText):
+		text := bodyText
+		if content.QuoteMode == QuoteCollapse {
+			text = collapseTextQuotes(text, labels)
+		}
+		addStyledContent(pdf, text, style)
+	case content.QuoteMode == QuoteMark:
+		text := envelope.Text
+		if envelope.HTML != "" {
+			text = htmlQuotesToText(envelope.HTML)
+		}
+		addQuotedTextContent(pdf, text)
+	case style.Unicode && hasEmoji(bodyText):
+		text := bodyText
+		if content.QuoteMode == QuoteCollapse {
+			text = collapseTextQuotes(text, labels)
+		}
+		addStyledContent(pdf, text, style)
+	case envelope.HTML != "":
+		addEnhancedHTMLContent(pdf, transformHTMLQuotes(envelope.HTML, content.QuoteMode, labels), labels)
+	case envelope.Text != "":
+		text := envelope.Text
+		if content.QuoteMode == QuoteCollapse {
+			text = collapseTextQuotes(text, labels)
+		}
+		addPlainTextContent(pdf, text)
+	}
 }
 
 // addEmailHeaders adds email header information to the PDF
-func addEmailHeaders(pdf *gofpdf.Fpdf, envelope *enmime.Envelope) {
+func addEmailHeaders(pdf *gofpdf.Fpdf, envelope *enmime.Envelope, labels Labels, style textStyle) {
 	pdf.SetFont("Arial", "B", 12)
-	pdf.Cell(40, 10, "From:")
+	pdf.Cell(40, 10, labels.From+":")
 	pdf.SetFont("Arial", "", 12)
-	pdf.Cell(0, 10, envelope.GetHeader("From"))
+	addHeaderValue(pdf, envelope.GetHeader("From"), style)
 	pdf.Ln(10)
 
 	pdf.SetFont("Arial", "B", 12)
-	pdf.Cell(40, 10, "To:")
+	pdf.Cell(40, 10, labels.To+":")
 	pdf.SetFont("Arial", "", 12)
-	pdf.Cell(0, 10, envelope.GetHeader("To"))
+	addHeaderValue(pdf, envelope.GetHeader("To"), style)
 	pdf.Ln(10)
 
 	if cc := envelope.GetHeader("Cc"); cc != "" {
 		pdf.SetFont("Arial", "B", 12)
-		pdf.Cell(40, 10, "Cc:")
+		pdf.Cell(40, 10, labels.Cc+":")
 		pdf.SetFont("Arial", "", 12)
-		pdf.Cell(0, 10, cc)
+		addHeaderValue(pdf, cc, style)
 		pdf.Ln(10)
 	}
 
 	pdf.SetFont("Arial", "B", 12)
-	pdf.Cell(40, 10, "Subject:")
+	pdf.Cell(40, 10, labels.Subject+":")
 	pdf.SetFont("Arial", "", 12)
-	pdf.Cell(0, 10, envelope.GetHeader("Subject"))
+	addHeaderValue(pdf, envelope.GetHeader("Subject"), style)
 	pdf.Ln(10)
 
 	pdf.SetFont("Arial", "B", 12)
-	pdf.Cell(40, 10, "Date:")
+	pdf.Cell(40, 10, labels.Date+":")
 	pdf.SetFont("Arial", "", 12)
 
 	// Try to parse and format the date
 	if date := envelope.GetHeader("Date"); date != "" {
-		if t, err := time.Parse(time.RFC1123Z, date); err == nil {
-			date = t.Format("Mon, 02 Jan 2006 15:04:05 -0700")
+		layout := defaultDateLayout
+		if style.DateLayout != "" {
+			layout = style.DateLayout
 		}
-		pdf.Cell(0, 10, date)
+		pdf.Cell(0, 10, formatMessageDate(date, layout, style.Zone))
 	}
 	pdf.Ln(10)
 }
 
+// addHeaderValue adds a header value, drawing right-to-left text, emoji and
+// text outside Windows-1252 with the Unicode font
+func addHeaderValue(pdf *gofpdf.Fpdf, value string, style textStyle) {
+	switch {
+	case style.RTL && containsRTL(value):
+		pdf.SetFont(unicodeFontFamily, "", 12)
+		pdf.Cell(0, 10, visualOrder(shapeArabic(bmpOnly(value))))
+	case style.Unicode && hasEmoji(value), style.wide(value):
+		pdf.SetFont(unicodeFontFamily, "", 12)
+		writeStyledText(pdf, 10, value, style)
+	default:
+		pdf.Cell(0, 10, value)
+		return
+	}
+	pdf.SetFont("Arial", "", 12)
+}
+
 // addEnhancedHTMLContent adds better HTML content to the PDF
-func addEnhancedHTMLContent(pdf *gofpdf.Fpdf, htmlContent string) {
+func addEnhancedHTMLContent(pdf *gofpdf.Fpdf, htmlContent string, labels Labels) {
 	pdf.SetFont("Arial", "", 11)
 
-	// Extract text from HTML with improved formatting
-	text := parseHTML(htmlContent)
-
-	// Split into paragraphs and process each one
-	paragraphs := strings.Split(text, "\n\n")
-	for _, para := range paragraphs {
-		if para == "" {
-			continue
-		}
-
-		// Replace multiple spaces with single space
-		para = strings.Join(strings.Fields(para), " ")
-
-		// Add the paragraph text
-		pdf.MultiCell(0, 5, para, "", "", false)
-		pdf.Ln(3)
+	// Lay out paragraphs, lists, blockquotes, tables and link footnotes from the parsed document
+	doc, err := xhtml.Parse(strings.NewReader(htmlContent))
+	if err != nil {
+		addPlainTextContent(pdf, parseHTML(htmlContent))
+		return
 	}
+	layoutHTML(pdf, doc, labels)
 
 	pdf.Ln(5)
 }
@@ -382,8 +1252,8 @@ func parseHTML(html string) string {
 
 // addHeader adds an email header line to the HTML buffer
 func addHeader(buffer *bytes.Buffer, label, value string) {
-	buffer.WriteString(fmt.Sprintf("<div class=\"header-row\"><span class=\"header-label\">%s</span> %s</div>\n",
-		label, html.EscapeString(value)))
+	buffer.WriteString(fmt.Sprintf("<div class=\"header-row\"><span class=\"header-label\">%s</span> <span dir=\"auto\">%s</span></div>\n",
+		html.EscapeString(label), html.EscapeString(value)))
 }
 
 // addPlainTextContent adds plain text email body to the PDF
@@ -393,11 +1263,86 @@ func addPlainTextContent(pdf *gofpdf.Fpdf, textContent string) {
 	pdf.Ln(5)
 }
 
+// addQuotedTextContent adds a plain text body, drawing quoted blocks in grey
+func addQuotedTextContent(pdf *gofpdf.Fpdf, textContent string) {
+	pdf.SetFont("Arial", "", 11)
+	for _, block := range splitTextQuotes(textContent) {
+		if block.Quoted {
+			pdf.SetTextColor(110, 110, 110)
+			pdf.SetFont("Arial", "I", 10)
+		}
+		pdf.MultiCell(0, 5, strings.Join(block.Lines, "\n"), "", "", false)
+		if block.Quoted {
+			pdf.SetTextColor(0, 0, 0)
+			pdf.SetFont("Arial", "", 11)
+		}
+	}
+	pdf.Ln(5)
+}
+
+// addStyledContent adds a plain text body containing emoji or symbols
+func addStyledContent(pdf *gofpdf.Fpdf, textContent string, style textStyle) {
+	pdf.SetFont(unicodeFontFamily, "", 11)
+	for _, line := range strings.Split(textContent, "\n") {
+		writeStyledText(pdf, 5, line, style)
+		pdf.Ln(5)
+	}
+	pdf.SetFont("Arial", "", 11)
+	pdf.Ln(5)
+}
+
+// addRTLContent adds a right-to-left body, wrapping each paragraph in logical
+// order before reordering the lines for display
+func addRTLContent(pdf *gofpdf.Fpdf, textContent string) {
+	pdf.SetFont(unicodeFontFamily, "", 11)
+
+	left, _, right, _ := pdf.GetMargins()
+	pageWidth, _ := pdf.GetPageSize()
+	width := pageWidth - left - right
+
+	for _, para := range strings.Split(bmpOnly(textContent), "\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			pdf.Ln(5)
+			continue
+		}
+
+		// Paragraphs without RTL characters keep their natural alignment
+		align := "L"
+		if containsRTL(para) {
+			align = "R"
+		}
+		for _, line := range pdf.SplitText(shapeArabic(para), width) {
+			if align == "R" {
+				line = visualOrder(line)
+			}
+			pdf.CellFormat(0, 5, line, "", 1, align, false, 0, "")
+		}
+	}
+
+	pdf.Ln(5)
+}
+
+// addPDFAlerts lists a message's security alerts below its headers
+func addPDFAlerts(pdf *gofpdf.Fpdf, alerts []models.SecurityAlert, labels Labels) {
+	pdf.Ln(5)
+	pdf.SetTextColor(180, 0, 0)
+	pdf.SetFont("Arial", "B", 12)
+	pdf.Cell(0, 10, labels.SecurityAlerts+":")
+	pdf.Ln(10)
+
+	pdf.SetFont("Arial", "", 10)
+	for _, alert := range alerts {
+		pdf.MultiCell(0, 5, "- "+strings.ToUpper(alert.Severity)+": "+alert.Message, "", "", false)
+	}
+	pdf.SetTextColor(0, 0, 0)
+}
+
 // addAttachmentsInfo adds information about attachments to the PDF
-func addAttachmentsInfo(pdf *gofpdf.Fpdf, attachments []*enmime.Part) {
+func addAttachmentsInfo(pdf *gofpdf.Fpdf, attachments []*enmime.Part, labels Labels) {
 	pdf.Ln(10)
 	pdf.SetFont("Arial", "B", 12)
-	pdf.Cell(0, 10, fmt.Sprintf("Attachments (%d):", len(attachments)))
+	pdf.Cell(0, 10, fmt.Sprintf("%s (%d):", labels.Attachments, len(attachments)))
 	pdf.Ln(5)
 
 	pdf.SetFont("Arial", "", 10)
@@ -407,6 +1352,89 @@ func addAttachmentsInfo(pdf *gofpdf.Fpdf, attachments []*enmime.Part) {
 	}
 }
 
+// addOCRText adds text recognized from images to the PDF
+func addOCRText(pdf *gofpdf.Fpdf, ocrResults []ocr.Result, labels Labels) {
+	pdf.Ln(10)
+	pdf.SetFont("Arial", "B", 12)
+	pdf.Cell(0, 10, labels.RecognizedText+":")
+	pdf.Ln(10)
+
+	for _, res := range ocrResults {
+		pdf.SetFont("Arial", "B", 10)
+		pdf.Cell(0, 5, ocrSource(res, labels))
+		pdf.Ln(6)
+		pdf.SetFont("Arial", "", 10)
+		pdf.MultiCell(0, 5, res.Text, "", "", false)
+		pdf.Ln(3)
+	}
+}
+
+// ocrSource returns the heading for a recognized image
+func ocrSource(res ocr.Result, labels Labels) string {
+	if res.Source == "" {
+		return labels.InlineImage
+	}
+	return res.Source
+}
+
+// recognizeImages runs OCR on the inline images of an image-only body and on image attachments
+func recognizeImages(envelope *enmime.Envelope, ocrEngine *ocr.Engine, verbose bool) []ocr.Result {
+	var parts []*enmime.Part
+
+	// Inline images only matter when they are the whole message
+	if isImageOnlyBody(envelope) {
+		parts = append(parts, envelope.Inlines...)
+		parts = append(parts, envelope.OtherParts...)
+	}
+	parts = append(parts, envelope.Attachments...)
+
+	var results []ocr.Result
+	for _, part := range parts {
+		if !ocr.IsSupported(part.ContentType) {
+			continue
+		}
+
+		text, err := ocrEngine.RecognizeBytes(part.Content)
+		if err != nil {
+			if verbose {
+				fmt.Printf("Warning: OCR failed for %s: %v\n", part.FileName, err)
+			}
+			continue
+		}
+		if text == "" {
+			continue
+		}
+
+		results = append(results, ocr.Result{Source: part.FileName, Text: text})
+	}
+
+	return results
+}
+
+// isImageOnlyBody reports whether the message body has no text beyond its images
+func isImageOnlyBody(envelope *enmime.Envelope) bool {
+	if strings.TrimSpace(envelope.Text) != "" && envelope.HTML == "" {
+		return false
+	}
+	if envelope.HTML != "" && strings.TrimSpace(parseHTML(envelope.HTML)) != "" {
+		return false
+	}
+	return len(envelope.Inlines) > 0 || len(envelope.OtherParts) > 0
+}
+
+// isEmptyBody reports whether the message has no body to show: no text, no
+// HTML with text or images in it, and no inline parts. Header-only messages
+// and those whose body is only whitespace or markup are empty.
+func isEmptyBody(envelope *enmime.Envelope) bool {
+	if strings.TrimSpace(envelope.Text) != "" {
+		return false
+	}
+	if envelope.HTML != "" && (strings.TrimSpace(parseHTML(envelope.HTML)) != "" || imgSrcPattern.MatchString(envelope.HTML)) {
+		return false
+	}
+	return len(envelope.Inlines) == 0 && len(envelope.OtherParts) == 0
+}
+
 // formatBytes returns a human-readable byte string
 func formatBytes(bytes int64) string {
 	const unit = 1024
@@ -423,8 +1451,5 @@ func formatBytes(bytes int64) string {
 
 // formatDate parses and formats an email date header
 func formatDate(date string) string {
-	if t, err := time.Parse(time.RFC1123Z, date); err == nil {
-		return t.Format("Mon, 02 Jan 2006 15:04:05 -0700")
-	}
-	return date // return original if parsing fails
+	return formatMessageDate(date, defaultDateLayout, nil)
 }
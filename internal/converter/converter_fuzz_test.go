@@ -0,0 +1,116 @@
+package converter
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Fuzz targets for go test -fuzz (see "Fuzzing" in the README). Each is seeded
+// with the messages in testdata/fuzz/corpus; inputs that fail are written to
+// testdata/fuzz/FuzzMessage (or FuzzHTML) and replayed by every later go test.
+
+// FuzzMessage parses its input as an EML message and takes it through the same
+// steps as ConvertEMLToPDF — journal unwrapping, delivery reports, HTML part
+// selection, buildCompleteHTML and the fallback renderer — writing the PDF
+// to memory
+func FuzzMessage(f *testing.F) {
+	addCorpus(f, func(data []byte) []byte { return data })
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		envelope, err := enmime.ReadEnvelope(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		inner, journal, err := unwrapJournal(envelope)
+		if err == nil {
+			envelope = inner
+		}
+
+		labels := locales["en"]
+		selectHTMLBody(envelope, HTMLPartAll, labels)
+		content := documentContent{
+			Labels:       labels,
+			Direction:    messageDirection(envelope),
+			QuoteMode:    QuoteCollapse,
+			ExtraHeaders: collectExtraHeaders(envelope, []string{"Reply-To", "X-Mailer"}),
+			Journal:      journal,
+			Delivery:     parseDeliveryReport(envelope),
+			ARC:          parseARC(envelope),
+			Hops:         parseReceived(envelope),
+			Language:     detectLanguage(envelope),
+			Thumbnails:   buildThumbnails(envelope),
+			EmptyBody:    isEmptyBody(envelope),
+			RawSource:    buildRawSource(data, 16*1024),
+		}
+		detectAnomalies(envelope, time.Now())
+		if envelope.HTML != "" {
+			document := buildCompleteHTML(envelope, content)
+			makeAccessible(document, envelope, "en", labels)
+		}
+
+		renderBasicTo(envelope, content)
+	})
+}
+
+// FuzzHTML renders its input as the HTML body of a message, exercising the
+// HTML to text conversion of the fallback renderer
+func FuzzHTML(f *testing.F) {
+	addCorpus(f, func(data []byte) []byte {
+		envelope, err := enmime.ReadEnvelope(bytes.NewReader(data))
+		if err != nil || envelope.HTML == "" {
+			return nil
+		}
+		return []byte(envelope.HTML)
+	})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		message := append([]byte("Subject: fuzz\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n"), data...)
+		envelope, err := enmime.ReadEnvelope(bytes.NewReader(message))
+		if err != nil {
+			return
+		}
+		parseHTML(envelope.HTML)
+
+		content := documentContent{Labels: locales["en"], QuoteMode: QuoteMark}
+		buildCompleteHTML(envelope, content)
+		renderBasicTo(envelope, content)
+	})
+}
+
+// addCorpus seeds a fuzz target with each message in testdata/fuzz/corpus,
+// passed through seed; messages it returns nil for are skipped
+func addCorpus(f *testing.F, seed func([]byte) []byte) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "fuzz", "corpus", "*.eml"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	if len(paths) == 0 {
+		f.Fatal("no seed messages in testdata/fuzz/corpus")
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		if input := seed(data); input != nil {
+			f.Add(input)
+		}
+	}
+}
+
+// renderBasicTo draws the fallback PDF of a message and writes it to memory
+func renderBasicTo(envelope *enmime.Envelope, content documentContent) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(10, 10, 10)
+	pdf.AddPage()
+	drawBasicPDF(pdf, envelope, content)
+	// gofpdf reports unencodable text as an error, which is not a crash
+	_ = pdf.Output(io.Discard)
+}
@@ -0,0 +1,226 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"html"
+	"net/textproto"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// DeliveryReport holds the fields of a delivery status notification (RFC 3464)
+// or a message disposition notification, i.e. a read receipt (RFC 8098)
+type DeliveryReport struct {
+	Receipt         bool   // True for a disposition notification, false for a delivery status report
+	ReportingMTA    string // Server that generated the report
+	ArrivalDate     string // When the original message reached the reporting server
+	OriginalSubject string // Subject of the message the report is about
+	OriginalID      string // Message-ID of the message the report is about
+	Disposition     string // Read receipt disposition, e.g. "manual-action/MDN-sent-manually; displayed"
+	Recipients      []DeliveryRecipient
+}
+
+// DeliveryRecipient is the outcome for one recipient of the original message
+type DeliveryRecipient struct {
+	OriginalRecipient string
+	FinalRecipient    string
+	Action            string // failed, delayed, delivered, relayed or expanded
+	Status            string // Enhanced status code, e.g. 5.1.1
+	Diagnostic        string // Remote server response, e.g. "550 5.1.1 User unknown"
+	RemoteMTA         string
+}
+
+// parseDeliveryReport finds and parses the machine-readable part of a bounce
+// or read receipt. It returns nil for ordinary messages.
+func parseDeliveryReport(envelope *enmime.Envelope) *DeliveryReport {
+	if envelope.Root == nil {
+		return nil
+	}
+
+	part := envelope.Root.DepthMatchFirst(func(p *enmime.Part) bool {
+		switch strings.ToLower(p.ContentType) {
+		case "message/delivery-status", "message/global-delivery-status",
+			"message/disposition-notification", "message/global-disposition-notification":
+			return true
+		}
+		return false
+	})
+	if part == nil {
+		return nil
+	}
+
+	blocks := parseFieldBlocks(part.Content)
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	report := &DeliveryReport{
+		Receipt: strings.Contains(strings.ToLower(part.ContentType), "disposition"),
+	}
+
+	// The first block describes the message, the rest one recipient each
+	perMessage := blocks[0]
+	report.ReportingMTA = fieldValue(perMessage.Get("Reporting-MTA"))
+	report.ArrivalDate = perMessage.Get("Arrival-Date")
+	report.OriginalID = perMessage.Get("Original-Message-ID")
+	report.Disposition = perMessage.Get("Disposition")
+
+	if report.Receipt {
+		// A read receipt has a single block covering the reader
+		report.Recipients = append(report.Recipients, DeliveryRecipient{
+			OriginalRecipient: fieldValue(perMessage.Get("Original-Recipient")),
+			FinalRecipient:    fieldValue(perMessage.Get("Final-Recipient")),
+		})
+	}
+
+	for _, block := range blocks[1:] {
+		report.Recipients = append(report.Recipients, DeliveryRecipient{
+			OriginalRecipient: fieldValue(block.Get("Original-Recipient")),
+			FinalRecipient:    fieldValue(block.Get("Final-Recipient")),
+			Action:            block.Get("Action"),
+			Status:            block.Get("Status"),
+			Diagnostic:        fieldValue(block.Get("Diagnostic-Code")),
+			RemoteMTA:         fieldValue(block.Get("Remote-MTA")),
+		})
+	}
+
+	// The returned message or its headers identify what the report is about
+	original := envelope.Root.DepthMatchFirst(func(p *enmime.Part) bool {
+		ct := strings.ToLower(p.ContentType)
+		return ct == "message/rfc822" || ct == "text/rfc822-headers" || ct == "message/global-headers"
+	})
+	if original != nil {
+		if headers := parseFieldBlocks(original.Content); len(headers) > 0 {
+			report.OriginalSubject = headers[0].Get("Subject")
+			if report.OriginalID == "" {
+				report.OriginalID = headers[0].Get("Message-ID")
+			}
+		}
+	}
+
+	return report
+}
+
+// parseFieldBlocks splits "Name: value" content into blocks separated by blank lines
+func parseFieldBlocks(content []byte) []textproto.MIMEHeader {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(content)))
+	var blocks []textproto.MIMEHeader
+
+	for {
+		header, err := reader.ReadMIMEHeader()
+		if len(header) > 0 {
+			blocks = append(blocks, header)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	return blocks
+}
+
+// fieldValue drops the type prefix from values like "rfc822; user@example.com"
+// or "smtp; 550 5.1.1 User unknown"
+func fieldValue(value string) string {
+	if _, rest, ok := strings.Cut(value, ";"); ok {
+		return strings.TrimSpace(rest)
+	}
+	return strings.TrimSpace(value)
+}
+
+// title returns the section heading for the report type
+func (d *DeliveryReport) title(labels Labels) string {
+	if d.Receipt {
+		return labels.ReadReceipt
+	}
+	return labels.DeliveryReport
+}
+
+// fields returns the per-message fields as labelled rows for rendering
+func (d *DeliveryReport) fields() []HeaderField {
+	var fields []HeaderField
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, HeaderField{Name: name, Value: value})
+		}
+	}
+
+	add("Original-Subject", d.OriginalSubject)
+	add("Original-Message-ID", d.OriginalID)
+	add("Disposition", d.Disposition)
+	add("Reporting-MTA", d.ReportingMTA)
+	add("Arrival-Date", d.ArrivalDate)
+	return fields
+}
+
+// fields returns the recipient's fields as labelled rows for rendering
+func (r DeliveryRecipient) fields() []HeaderField {
+	var fields []HeaderField
+	add := func(name, value string) {
+		if value != "" {
+			fields = append(fields, HeaderField{Name: name, Value: value})
+		}
+	}
+
+	add("Final-Recipient", r.FinalRecipient)
+	if r.OriginalRecipient != r.FinalRecipient {
+		add("Original-Recipient", r.OriginalRecipient)
+	}
+	add("Action", r.Action)
+	add("Status", r.Status)
+	add("Diagnostic-Code", r.Diagnostic)
+	add("Remote-MTA", r.RemoteMTA)
+	return fields
+}
+
+// writeHTMLDelivery adds the delivery report section to the HTML buffer
+func writeHTMLDelivery(buffer *bytes.Buffer, report *DeliveryReport, labels Labels) {
+	buffer.WriteString("<div class=\"delivery-report\">\n")
+	buffer.WriteString("<h3>" + html.EscapeString(report.title(labels)) + "</h3>\n")
+	for _, field := range report.fields() {
+		addHeader(buffer, field.Name, field.Value)
+	}
+	for _, recipient := range report.Recipients {
+		class := "delivery-recipient"
+		if recipient.Action == "failed" {
+			class += " delivery-failed"
+		}
+		buffer.WriteString("<div class=\"" + class + "\">\n")
+		for _, field := range recipient.fields() {
+			addHeader(buffer, field.Name, field.Value)
+		}
+		buffer.WriteString("</div>\n")
+	}
+	buffer.WriteString("</div>\n")
+}
+
+// addPDFDelivery adds the delivery report section to the PDF
+func addPDFDelivery(pdf *gofpdf.Fpdf, report *DeliveryReport, labels Labels) {
+	pdf.Ln(5)
+	pdf.SetFont("Arial", "B", 12)
+	pdf.Cell(0, 10, report.title(labels)+":")
+	pdf.Ln(10)
+
+	addPDFFields(pdf, report.fields())
+	for _, recipient := range report.Recipients {
+		pdf.Ln(3)
+		if recipient.Action == "failed" {
+			pdf.SetTextColor(180, 0, 0)
+		}
+		addPDFFields(pdf, recipient.fields())
+		pdf.SetTextColor(0, 0, 0)
+	}
+}
+
+// addPDFFields adds labelled rows in the small metadata style
+func addPDFFields(pdf *gofpdf.Fpdf, fields []HeaderField) {
+	for _, field := range fields {
+		pdf.SetFont("Arial", "B", 10)
+		pdf.Cell(40, 6, field.Name+":")
+		pdf.SetFont("Arial", "", 10)
+		pdf.MultiCell(0, 6, field.Value, "", "", false)
+	}
+}
@@ -0,0 +1,38 @@
+package converter
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+)
+
+// Descriptors kept out of the budget for what emil holds open besides the
+// files conversions read and write: the Go runtime, standard streams, logs
+// and reports, and for each worker the pipes and sockets of its Chrome
+// renders and ClamAV scans
+const (
+	descriptorReserve    = 64
+	descriptorsPerWorker = 8
+)
+
+// SetupDescriptorBudget raises the soft limit on open files to the hard
+// limit where permitted and returns it with the budget of files a run's
+// conversions may hold open at once: what is left after the reserve for its
+// workers. A run bounds its conversions by the budget with
+// Config.DescriptorSlots, so a run with many workers stays under the limit.
+// Both are 0 where the limit can't be read.
+func SetupDescriptorBudget(workers int) (limit, budget int) {
+	limit, ok := raiseFileLimit()
+	if !ok {
+		return 0, 0
+	}
+	budget = max(limit-descriptorReserve-descriptorsPerWorker*workers, 1)
+	return limit, budget
+}
+
+// isDescriptorExhaustion reports whether an error is the process or the
+// system running out of file descriptors
+func isDescriptorExhaustion(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) ||
+		strings.Contains(err.Error(), "too many open files")
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package converter
+
+// raiseFileLimit is not available on this platform, whose handles aren't
+// limited the same way, so no budget is set
+func raiseFileLimit() (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,26 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package converter
+
+import "syscall"
+
+// raiseFileLimit raises the soft limit on open files to the hard limit, if
+// it is lower, and returns the soft limit in effect
+func raiseFileLimit() (int, bool) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0, false
+	}
+	if rlimit.Cur < rlimit.Max {
+		raised := rlimit
+		raised.Cur = rlimit.Max
+		if syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised) == nil {
+			rlimit = raised
+		}
+	}
+	// An unlimited soft limit leaves nothing to budget
+	if rlimit.Cur > 1<<30 {
+		return 0, false
+	}
+	return int(rlimit.Cur), true
+}
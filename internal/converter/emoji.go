@@ -0,0 +1,195 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/text/unicode/runenames"
+)
+
+const (
+	zeroWidthJoiner   = 0x200D
+	variationSelector = 0xFE0F
+)
+
+// textStyle describes how the fallback renderer draws text beyond the core fonts
+type textStyle struct {
+	Unicode  bool   // The Unicode font is registered
+	RTL      bool   // Right-to-left message drawn with the Unicode font
+	EmojiDir string // Directory of emoji PNG sprites named by code point
+
+	// Detected script and date layout of the message (empty = not detected)
+	Script     string
+	DateLayout string
+
+	// Zone the Date header is shown in (nil = as written)
+	Zone *time.Location
+}
+
+// wide reports whether text needs the Unicode font because the core fonts
+// can't draw it. Only messages whose script was detected are checked, so
+// turning detection off keeps the older output.
+func (s textStyle) wide(text string) bool {
+	return s.Unicode && s.Script != "" && !fitsCoreFonts(text)
+}
+
+// isEmojiRune reports whether a rune is an emoji or pictographic symbol
+func isEmojiRune(r rune) bool {
+	return (r >= 0x2300 && r <= 0x23FF) || // Miscellaneous technical, e.g. ⌚ ⏰
+		(r >= 0x2600 && r <= 0x27BF) || // Miscellaneous symbols and dingbats
+		(r >= 0x2B00 && r <= 0x2BFF) || // Arrows and stars, e.g. ⭐
+		(r >= 0x1F000 && r <= 0x1FAFF) // Emoji, pictographs and flags
+}
+
+// isEmojiModifier reports whether a rune modifies the emoji before it
+func isEmojiModifier(r rune) bool {
+	return r == variationSelector || r == zeroWidthJoiner ||
+		(r >= 0x1F3FB && r <= 0x1F3FF) || // Skin tones
+		(r >= 0xE0020 && r <= 0xE007F) // Tag sequences used by subdivision flags
+}
+
+// isRegionalIndicator reports whether a rune is half of a flag
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// hasEmoji reports whether the text contains any emoji
+func hasEmoji(text string) bool {
+	for _, r := range text {
+		if isEmojiRune(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// textSegment is a run of plain text or a single emoji sequence
+type textSegment struct {
+	Text  string
+	Emoji bool
+}
+
+// splitEmoji breaks text into plain runs and emoji sequences, keeping
+// modifiers, ZWJ sequences and flag pairs together
+func splitEmoji(text string) []textSegment {
+	runes := []rune(text)
+	var segments []textSegment
+	var plain []rune
+
+	for i := 0; i < len(runes); {
+		if !isEmojiRune(runes[i]) {
+			plain = append(plain, runes[i])
+			i++
+			continue
+		}
+
+		if len(plain) > 0 {
+			segments = append(segments, textSegment{Text: string(plain)})
+			plain = nil
+		}
+
+		j := i + 1
+		if isRegionalIndicator(runes[i]) && j < len(runes) && isRegionalIndicator(runes[j]) {
+			j++
+		}
+		for j < len(runes) && isEmojiModifier(runes[j]) {
+			if runes[j] == zeroWidthJoiner && j+1 < len(runes) {
+				j++ // The joined emoji belongs to the sequence
+			}
+			j++
+		}
+
+		segments = append(segments, textSegment{Text: string(runes[i:j]), Emoji: true})
+		i = j
+	}
+
+	if len(plain) > 0 {
+		segments = append(segments, textSegment{Text: string(plain)})
+	}
+	return segments
+}
+
+// emojiSprite returns the sprite image for an emoji sequence, or "" if the
+// directory has none. Twemoji ("1f600.png") and Noto ("emoji_u1f600.png")
+// file names are both recognized.
+func emojiSprite(dir, emoji string) string {
+	if dir == "" {
+		return ""
+	}
+
+	var all, withoutVS []string
+	for _, r := range emoji {
+		code := fmt.Sprintf("%x", r)
+		all = append(all, code)
+		if r != variationSelector {
+			withoutVS = append(withoutVS, code)
+		}
+	}
+	first := []string{all[0]}
+
+	for _, codes := range [][]string{withoutVS, all, first} {
+		for _, name := range []string{
+			strings.Join(codes, "-") + ".png",
+			"emoji_u" + strings.Join(codes, "_") + ".png",
+		} {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// emojiName describes an emoji sequence in words, e.g. "[grinning face]"
+func emojiName(emoji string) string {
+	runes := []rune(emoji)
+	if isRegionalIndicator(runes[0]) && len(runes) == 2 {
+		// Flags are named by their country code
+		return "[flag " + string('A'+runes[0]-0x1F1E6) + string('A'+runes[1]-0x1F1E6) + "]"
+	}
+	if name := runenames.Name(runes[0]); name != "" {
+		return "[" + strings.ToLower(name) + "]"
+	}
+	return "[emoji]"
+}
+
+// writeStyledText writes a line of text at the current position, drawing emoji
+// as sprites when available, BMP symbols with the Unicode font, and anything
+// else by name. The Unicode font must be the current font.
+func writeStyledText(pdf *gofpdf.Fpdf, lineHeight float64, text string, style textStyle) {
+	_, fontSize := pdf.GetFontSize()
+	size := fontSize * 1.1
+	pageWidth, _ := pdf.GetPageSize()
+	_, _, right, _ := pdf.GetMargins()
+
+	for _, segment := range splitEmoji(text) {
+		if !segment.Emoji {
+			pdf.Write(lineHeight, bmpOnly(segment.Text))
+			continue
+		}
+
+		if sprite := emojiSprite(style.EmojiDir, segment.Text); sprite != "" {
+			if pdf.GetX()+size > pageWidth-right {
+				pdf.Ln(lineHeight)
+			}
+			x, y := pdf.GetX(), pdf.GetY()
+			pdf.ImageOptions(sprite, x, y+(lineHeight-size)/2, size, size, false,
+				gofpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+			pdf.SetXY(x+size, y)
+			continue
+		}
+
+		// The Unicode font covers most BMP symbols, but not astral emoji
+		symbol := strings.TrimRight(segment.Text, string(rune(variationSelector)))
+		if bmpOnly(symbol) == symbol {
+			pdf.Write(lineHeight, symbol)
+		} else {
+			pdf.Write(lineHeight, emojiName(segment.Text))
+		}
+	}
+}
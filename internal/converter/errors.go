@@ -0,0 +1,93 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Error classes reported in metrics and the run report
+const (
+	ErrorClassIO          = "io"          // The EML file could not be read
+	ErrorClassDescriptors = "descriptors" // The process ran out of file descriptors
+	ErrorClassParse       = "parse"       // The message is not valid MIME
+	ErrorClassConfig      = "config"      // A template, stylesheet or locale could not be loaded
+	ErrorClassHook        = "hook"        // An embedding program's hook failed
+	ErrorClassRender      = "render"      // No renderer produced a PDF
+	ErrorClassCancelled   = "cancelled"   // The run was stopped
+	ErrorClassPanic       = "panic"       // The parser or a renderer panicked
+	ErrorClassSecurity    = "security"    // The security alert policy withheld the outputs
+	ErrorClassOther       = "other"
+)
+
+// DefaultRetryClasses are the error classes retried when none are configured.
+// Parse, config and hook errors, and panics, would only happen again.
+var DefaultRetryClasses = []string{ErrorClassIO, ErrorClassDescriptors, ErrorClassRender, ErrorClassOther}
+
+// CheckRetryClasses reports an error if a class can't be retried
+func CheckRetryClasses(classes []string) error {
+	for _, class := range classes {
+		switch class {
+		case ErrorClassIO, ErrorClassDescriptors, ErrorClassParse, ErrorClassConfig, ErrorClassHook, ErrorClassRender, ErrorClassPanic, ErrorClassOther:
+		case ErrorClassCancelled:
+			return fmt.Errorf("cancelled conversions can't be retried")
+		case ErrorClassSecurity:
+			return fmt.Errorf("conversions withheld by the alert policy can't be retried")
+		default:
+			return fmt.Errorf("unknown error class %q (use io, descriptors, parse, config, hook, render, panic or other)", class)
+		}
+	}
+	return nil
+}
+
+// classifiedError tags a conversion error with its class
+type classifiedError struct {
+	class string
+	err   error
+	stack string // Goroutine stack of a recovered panic
+}
+
+func (e *classifiedError) Error() string { return e.err.Error() }
+func (e *classifiedError) Unwrap() error { return e.err }
+
+// classify tags err with a class for ErrorClass
+func classify(class string, err error) error {
+	return &classifiedError{class: class, err: err}
+}
+
+// PanicError turns a value recovered from a panic during a conversion into
+// an error of class ErrorClassPanic that keeps the stack it was raised on
+func PanicError(value any, stack []byte) error {
+	return &classifiedError{
+		class: ErrorClassPanic,
+		err:   fmt.Errorf("panic: %v", value),
+		stack: string(stack),
+	}
+}
+
+// PanicStack returns the stack trace of an error made by PanicError, or ""
+func PanicStack(err error) string {
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.stack
+	}
+	return ""
+}
+
+// ErrorClass returns the class of a conversion error, one of the ErrorClass
+// constants. Running out of file descriptors is reported as such whatever
+// operation it failed.
+func ErrorClass(err error) string {
+	var classified *classifiedError
+	switch {
+	case err == nil:
+		return ""
+	case isDescriptorExhaustion(err):
+		return ErrorClassDescriptors
+	case errors.As(err, &classified):
+		return classified.class
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassCancelled
+	}
+	return ErrorClassOther
+}
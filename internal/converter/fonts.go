@@ -0,0 +1,137 @@
+package converter
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// unicodeFontFamily is the family name the Unicode font is registered under
+const unicodeFontFamily = "unicode"
+
+// unicodeFontCandidates are common system fonts with broad script coverage,
+// including Hebrew and Arabic
+var unicodeFontCandidates = []string{
+	"/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf",
+	"/usr/share/fonts/TTF/DejaVuSans.ttf",
+	"/usr/share/fonts/dejavu/DejaVuSans.ttf",
+	"/usr/share/fonts/dejavu-sans-fonts/DejaVuSans.ttf",
+	"/usr/share/fonts/truetype/noto/NotoSans-Regular.ttf",
+	"/Library/Fonts/Arial Unicode.ttf",
+	"/System/Library/Fonts/Supplemental/Arial Unicode.ttf",
+	`C:\Windows\Fonts\arial.ttf`,
+}
+
+// scriptFontCandidates are system fonts for scripts the general Unicode
+// fonts don't cover. gofpdf can't read font collections (.ttc), so only
+// single-face files are listed.
+var scriptFontCandidates = map[string][]string{
+	scriptCJK: {
+		"/usr/share/fonts/truetype/droid/DroidSansFallbackFull.ttf",
+		"/usr/share/fonts/google-droid-sans-fonts/DroidSansFallbackFull.ttf",
+		"/usr/share/fonts/truetype/takao-gothic/TakaoPGothic.ttf",
+		"/Library/Fonts/Arial Unicode.ttf",
+		"/System/Library/Fonts/Supplemental/Arial Unicode.ttf",
+		`C:\Windows\Fonts\simhei.ttf`,
+	},
+	scriptHangul: {
+		"/usr/share/fonts/truetype/nanum/NanumGothic.ttf",
+		"/usr/share/fonts/nanum/NanumGothic.ttf",
+		"/usr/share/fonts/truetype/droid/DroidSansFallbackFull.ttf",
+		"/Library/Fonts/Arial Unicode.ttf",
+		"/System/Library/Fonts/Supplemental/Arial Unicode.ttf",
+		`C:\Windows\Fonts\malgun.ttf`,
+	},
+	scriptThai: {
+		"/usr/share/fonts/truetype/tlwg/Garuda.ttf",
+		"/usr/share/fonts/truetype/noto/NotoSansThai-Regular.ttf",
+		"/usr/share/fonts/google-noto/NotoSansThai-Regular.ttf",
+		`C:\Windows\Fonts\tahoma.ttf`,
+	},
+	scriptDevanagari: {
+		"/usr/share/fonts/truetype/noto/NotoSansDevanagari-Regular.ttf",
+		"/usr/share/fonts/google-noto/NotoSansDevanagari-Regular.ttf",
+		"/usr/share/fonts/truetype/lohit-devanagari/Lohit-Devanagari.ttf",
+		"/Library/Fonts/Arial Unicode.ttf",
+		`C:\Windows\Fonts\mangal.ttf`,
+	},
+}
+
+var (
+	// The font file is read once and shared by every conversion
+	unicodeFontOnce sync.Once
+	unicodeFontData []byte
+
+	// Fonts for particular scripts, read once each and keyed by script
+	scriptFonts sync.Map
+)
+
+// loadUnicodeFont reads the configured font, or the first system font found
+func loadUnicodeFont(configured string) []byte {
+	unicodeFontOnce.Do(func() {
+		candidates := unicodeFontCandidates
+		if configured != "" {
+			candidates = append([]string{configured}, candidates...)
+		}
+		for _, path := range candidates {
+			if data, err := os.ReadFile(path); err == nil {
+				unicodeFontData = data
+				return
+			}
+		}
+	})
+	return unicodeFontData
+}
+
+// loadScriptFont reads the first system font found for a script, or returns
+// nil if the script has no fonts of its own or none is installed
+func loadScriptFont(script string) []byte {
+	candidates := scriptFontCandidates[script]
+	if len(candidates) == 0 {
+		return nil
+	}
+	if data, ok := scriptFonts.Load(script); ok {
+		return data.([]byte)
+	}
+
+	var found []byte
+	for _, path := range candidates {
+		if data, err := os.ReadFile(path); err == nil {
+			found = data
+			break
+		}
+	}
+	data, _ := scriptFonts.LoadOrStore(script, found)
+	return data.([]byte)
+}
+
+// registerUnicodeFont adds the Unicode font to the PDF, reporting whether one
+// was available. A font for the message's script, if it has one, is preferred
+// over the configured and general fonts, which lack CJK, Thai and Indic glyphs.
+func registerUnicodeFont(pdf *gofpdf.Fpdf, configured, script string) bool {
+	data := loadScriptFont(script)
+	if data == nil {
+		data = loadUnicodeFont(configured)
+	}
+	if data == nil {
+		return false
+	}
+
+	// The same face serves as bold so bold labels don't fail
+	pdf.AddUTF8FontFromBytes(unicodeFontFamily, "", data)
+	pdf.AddUTF8FontFromBytes(unicodeFontFamily, "B", data)
+	return !pdf.Err()
+}
+
+// bmpOnly replaces characters outside the Basic Multilingual Plane, which
+// gofpdf's UTF-8 font width tables don't cover
+func bmpOnly(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 0xFFFF {
+			return '?'
+		}
+		return r
+	}, text)
+}
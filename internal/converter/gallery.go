@@ -0,0 +1,151 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	_ "image/gif" // Register GIF decoder
+	"image/jpeg"
+	_ "image/png" // Register PNG decoder
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	// Longest edge of a generated thumbnail in pixels
+	thumbnailMaxPixels = 240
+
+	// Number of thumbnails per row in the fallback renderer
+	galleryColumns = 3
+)
+
+// thumbnail is a downscaled image attachment ready to embed in the PDF
+type thumbnail struct {
+	Filename string
+	Size     int64
+	Data     []byte // JPEG encoded
+	Width    int
+	Height   int
+}
+
+// buildThumbnails creates thumbnails for every decodable image attachment
+func buildThumbnails(envelope *enmime.Envelope) []thumbnail {
+	var thumbs []thumbnail
+
+	for _, att := range envelope.Attachments {
+		if !strings.HasPrefix(strings.ToLower(att.ContentType), "image/") {
+			continue
+		}
+
+		data, width, height, err := makeThumbnail(att.Content)
+		if err != nil {
+			// Formats we can't decode are still listed with the attachments
+			continue
+		}
+
+		thumbs = append(thumbs, thumbnail{
+			Filename: att.FileName,
+			Size:     int64(len(att.Content)),
+			Data:     data,
+			Width:    width,
+			Height:   height,
+		})
+	}
+
+	return thumbs
+}
+
+// makeThumbnail decodes an image and re-encodes it as a small JPEG
+func makeThumbnail(content []byte) ([]byte, int, int, error) {
+	src, err := decodeImage(content)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	// Scale the longest edge down to the thumbnail size, never up
+	dst := scaleImage(src, thumbnailMaxPixels)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	return buf.Bytes(), dst.Bounds().Dx(), dst.Bounds().Dy(), nil
+}
+
+// writeHTMLGallery adds a thumbnail grid to the HTML buffer
+func writeHTMLGallery(buffer *bytes.Buffer, thumbs []thumbnail, labels Labels) {
+	buffer.WriteString("<div class=\"gallery\">\n")
+	buffer.WriteString("<h3>" + html.EscapeString(labels.ImageAttachments) + "</h3>\n")
+	for _, thumb := range thumbs {
+		buffer.WriteString("<figure class=\"gallery-item\">")
+		buffer.WriteString("<img src=\"data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(thumb.Data) + "\" alt=\"" + html.EscapeString(thumb.Filename) + "\">")
+		buffer.WriteString("<figcaption>" + html.EscapeString(thumb.Filename) + "<br>" + formatBytes(thumb.Size) + "</figcaption>")
+		buffer.WriteString("</figure>\n")
+	}
+	buffer.WriteString("</div>\n")
+}
+
+// addPDFGallery adds a thumbnail grid page to the PDF
+func addPDFGallery(pdf *gofpdf.Fpdf, thumbs []thumbnail, labels Labels) {
+	pdf.AddPage()
+	pdf.SetFont("Arial", "B", 12)
+	pdf.Cell(0, 10, labels.ImageAttachments+":")
+	pdf.Ln(12)
+
+	const (
+		cellWidth  = 63.0 // mm, three columns across A4 with 10mm margins
+		boxSize    = 55.0 // mm, maximum thumbnail edge
+		cellHeight = boxSize + 14
+	)
+
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottomMargin := pdf.GetMargins()
+
+	for i, thumb := range thumbs {
+		col := i % galleryColumns
+		if col == 0 && i > 0 {
+			pdf.SetY(pdf.GetY() + cellHeight)
+		}
+		if pdf.GetY()+cellHeight > pageHeight-bottomMargin {
+			pdf.AddPage()
+		}
+
+		x := 10 + float64(col)*cellWidth
+		y := pdf.GetY()
+
+		// Fit the thumbnail inside the box while keeping its aspect ratio
+		w, h := boxSize, boxSize
+		if thumb.Width > thumb.Height {
+			h = boxSize * float64(thumb.Height) / float64(thumb.Width)
+		} else {
+			w = boxSize * float64(thumb.Width) / float64(thumb.Height)
+		}
+
+		name := fmt.Sprintf("thumb-%d", i)
+		pdf.RegisterImageOptionsReader(name, gofpdf.ImageOptions{ImageType: "JPG"}, bytes.NewReader(thumb.Data))
+		pdf.ImageOptions(name, x+(cellWidth-w)/2, y+(boxSize-h)/2, w, h, false, gofpdf.ImageOptions{ImageType: "JPG"}, 0, "")
+
+		// Caption below the image
+		pdf.SetFont("Arial", "", 8)
+		pdf.SetXY(x, y+boxSize+1)
+		pdf.CellFormat(cellWidth, 4, truncateText(thumb.Filename, 40), "", 2, "C", false, 0, "")
+		pdf.SetX(x)
+		pdf.CellFormat(cellWidth, 4, formatBytes(thumb.Size), "", 0, "C", false, 0, "")
+		pdf.SetY(y)
+	}
+
+	pdf.SetY(pdf.GetY() + cellHeight)
+}
+
+// truncateText shortens text to at most limit runes, adding an ellipsis
+func truncateText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-3]) + "..."
+}
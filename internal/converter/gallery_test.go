@@ -0,0 +1,69 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// pngWithCanvas returns a small PNG whose header declares width by height
+// pixels, as a decompression bomb does
+func pngWithCanvas(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// The IHDR chunk follows the 8-byte signature: length, type, then width
+	// and height, with its CRC after the 13 bytes of data
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 960, 480))
+	for i := range src.Pix {
+		src.Pix[i] = 0xff
+	}
+	src.Set(0, 0, color.Black)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	data, width, height, err := makeThumbnail(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != thumbnailMaxPixels || height != thumbnailMaxPixels/2 {
+		t.Errorf("thumbnail is %dx%d, want %dx%d", width, height, thumbnailMaxPixels, thumbnailMaxPixels/2)
+	}
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || format != "jpeg" || cfg.Width != width {
+		t.Errorf("thumbnail decodes as %s %v, %v; want a %d pixel wide JPEG", format, cfg, err, width)
+	}
+}
+
+func TestHugeCanvasIsNotDecoded(t *testing.T) {
+	bomb := pngWithCanvas(t, 100_000, 100_000)
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(bomb)); err != nil || cfg.Width != 100_000 || cfg.Height != 100_000 {
+		t.Fatalf("test image reads as %v, %v", cfg, err)
+	}
+
+	if _, err := decodeImage(bomb); err == nil {
+		t.Error("decodeImage decoded a 10 gigapixel image")
+	}
+	if _, _, _, err := makeThumbnail(bomb); err == nil {
+		t.Error("makeThumbnail decoded a 10 gigapixel image")
+	}
+	if _, _, shrunk := shrinkImage(bomb, "image/png", inlineImageLimits{MaxPixels: 100}); shrunk {
+		t.Error("shrinkImage decoded a 10 gigapixel image")
+	}
+}
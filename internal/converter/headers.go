@@ -0,0 +1,49 @@
+package converter
+
+import (
+	"net/textproto"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// HeaderField is a single header line shown in the header block
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// collectExtraHeaders returns the configured extra headers present in the message,
+// one field per value for headers that repeat
+func collectExtraHeaders(envelope *enmime.Envelope, names []string) []HeaderField {
+	var fields []HeaderField
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		for _, value := range envelope.GetHeaderValues(name) {
+			if value = strings.TrimSpace(value); value != "" {
+				fields = append(fields, HeaderField{
+					Name:  textproto.CanonicalMIMEHeaderKey(name),
+					Value: value,
+				})
+			}
+		}
+	}
+
+	return fields
+}
+
+// addExtraHeaders adds the configured extra headers to the PDF header block
+func addExtraHeaders(pdf *gofpdf.Fpdf, fields []HeaderField) {
+	for _, field := range fields {
+		pdf.SetFont("Arial", "B", 12)
+		pdf.Cell(40, 10, field.Name+":")
+		pdf.SetFont("Arial", "", 12)
+		pdf.MultiCell(0, 10, field.Value, "", "", false)
+	}
+}
@@ -0,0 +1,565 @@
+package converter
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	xhtml "golang.org/x/net/html"
+)
+
+// Layout metrics for the fallback HTML renderer, in millimetres
+const (
+	layoutLineHeight  = 5.0
+	layoutIndent      = 7.0 // Indent per list or blockquote level
+	layoutCellPadding = 1.5
+)
+
+// htmlLayout draws an HTML body with the core fonts, keeping enough structure
+// (paragraphs, lists, blockquotes and tables) for the result to stay readable
+type htmlLayout struct {
+	pdf        *gofpdf.Fpdf
+	tr         func(string) string
+	indent     float64  // Left indent of the current block
+	quoteDepth int      // Number of enclosing blockquotes
+	pre        bool     // Inside a <pre> element, where whitespace is kept
+	prefix     string   // List marker drawn before the next line
+	inline     []string // Text collected for the current paragraph
+	style      string   // Font style of the current paragraph
+	size       float64  // Font size of the current paragraph
+	links      []string // Link targets in footnote order
+	linkIndex  map[string]int
+}
+
+// layoutHTML draws the parsed document onto the PDF, followed by footnotes
+// for its links. Labels must already be translated for the core fonts.
+func layoutHTML(pdf *gofpdf.Fpdf, doc *xhtml.Node, labels Labels) {
+	l := &htmlLayout{
+		pdf:       pdf,
+		tr:        pdf.UnicodeTranslatorFromDescriptor(""),
+		style:     "",
+		size:      11,
+		linkIndex: make(map[string]int),
+	}
+	l.walk(doc)
+	l.flush()
+	l.layoutFootnotes(labels)
+}
+
+// walk lays out a node and its children
+func (l *htmlLayout) walk(n *xhtml.Node) {
+	switch n.Type {
+	case xhtml.TextNode:
+		l.inline = append(l.inline, n.Data)
+		return
+	case xhtml.DocumentNode:
+		l.walkChildren(n)
+		return
+	case xhtml.ElementNode:
+		// Handled below
+	default:
+		return
+	}
+
+	switch n.Data {
+	case "head", "script", "style", "title", "template":
+		// Not part of the visible body
+
+	case "br":
+		l.flush()
+
+	case "hr":
+		l.flush()
+		left, _, right, _ := l.pdf.GetMargins()
+		pageWidth, _ := l.pdf.GetPageSize()
+		y := l.pdf.GetY() + 2
+		l.pdf.Line(left+l.indent, y, pageWidth-right, y)
+		l.pdf.SetY(y + 2)
+
+	case "p", "div", "section", "article", "header", "footer", "center", "address", "dl", "dt", "dd":
+		l.flush()
+		l.walkChildren(n)
+		l.flush()
+
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		l.flush()
+		l.style, l.size = "B", 14-float64(n.Data[1]-'1')*0.5
+		l.walkChildren(n)
+		l.flush()
+		l.style, l.size = "", 11
+
+	case "pre":
+		l.flush()
+		l.pre = true
+		l.walkChildren(n)
+		l.flush()
+		l.pre = false
+
+	case "ul", "ol":
+		l.flush()
+		l.layoutList(n)
+
+	case "blockquote":
+		l.flush()
+		l.indent += layoutIndent
+		l.quoteDepth++
+		l.walkChildren(n)
+		l.flush()
+		l.quoteDepth--
+		l.indent -= layoutIndent
+
+	case "table":
+		l.flush()
+		l.layoutTable(n)
+
+	case "a":
+		l.walkChildren(n)
+		if number := l.addLink(n); number > 0 {
+			l.inline = append(l.inline, " "+footnoteMarker(number))
+		}
+
+	default:
+		l.walkChildren(n)
+	}
+}
+
+// walkChildren lays out each child of a node
+func (l *htmlLayout) walkChildren(n *xhtml.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		l.walk(c)
+	}
+}
+
+// flush draws the collected inline text as a wrapped paragraph
+func (l *htmlLayout) flush() {
+	text := strings.Join(l.inline, "")
+	l.inline = nil
+
+	if l.pre {
+		for _, line := range strings.Split(strings.Trim(text, "\n"), "\n") {
+			l.drawLines([]string{l.tr(line)}, "Courier", 9)
+		}
+		return
+	}
+
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return
+	}
+
+	l.pdf.SetFont("Arial", l.style, l.size)
+	l.drawLines(wrapText(l.pdf, l.tr(text), l.contentWidth()), "Arial", l.size)
+}
+
+// drawLines draws wrapped lines at the current indent, with quote bars and any pending list marker
+func (l *htmlLayout) drawLines(lines []string, family string, size float64) {
+	left, _, _, bottom := l.pdf.GetMargins()
+	_, pageHeight := l.pdf.GetPageSize()
+	l.pdf.SetFont(family, l.style, size)
+
+	for _, line := range lines {
+		if l.pdf.GetY()+layoutLineHeight > pageHeight-bottom {
+			l.pdf.AddPage()
+		}
+		y := l.pdf.GetY()
+
+		if l.prefix != "" {
+			l.pdf.SetXY(left+l.indent-layoutIndent, y)
+			l.pdf.CellFormat(layoutIndent-1, layoutLineHeight, l.tr(l.prefix), "", 0, "R", false, 0, "")
+			l.prefix = ""
+		}
+
+		// Draw a bar for each enclosing blockquote
+		if l.quoteDepth > 0 {
+			l.pdf.SetDrawColor(190, 190, 190)
+			for depth := 0; depth < l.quoteDepth; depth++ {
+				x := left + float64(depth)*layoutIndent + 2
+				l.pdf.Line(x, y, x, y+layoutLineHeight)
+			}
+			l.pdf.SetDrawColor(0, 0, 0)
+			l.pdf.SetTextColor(90, 90, 90)
+		}
+
+		l.pdf.SetXY(left+l.indent, y)
+		l.pdf.CellFormat(l.contentWidth(), layoutLineHeight, line, "", 1, "L", false, 0, "")
+		l.pdf.SetTextColor(0, 0, 0)
+		l.linkMarkers(line, left+l.indent, y)
+	}
+	l.pdf.SetX(left)
+}
+
+// addLink records the target of an anchor and returns its footnote number,
+// or 0 when the anchor needs no footnote
+func (l *htmlLayout) addLink(n *xhtml.Node) int {
+	href := strings.TrimSpace(getAttr(n, "href"))
+	lower := strings.ToLower(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(lower, "javascript:") || strings.HasPrefix(lower, "cid:") {
+		return 0
+	}
+
+	// Links that already show their target don't need a footnote
+	text := strings.TrimSpace(nodeText(n))
+	if text == href || "mailto:"+text == href {
+		return 0
+	}
+
+	if number, ok := l.linkIndex[href]; ok {
+		return number
+	}
+	l.links = append(l.links, href)
+	l.linkIndex[href] = len(l.links)
+	return len(l.links)
+}
+
+// footnoteMarker returns the marker placed after link text
+func footnoteMarker(number int) string {
+	return "[" + strconv.Itoa(number) + "]"
+}
+
+// linkMarkers makes the footnote markers in a drawn line clickable
+func (l *htmlLayout) linkMarkers(line string, x, y float64) {
+	cMargin := l.pdf.GetCellMargin()
+	for number, href := range l.links {
+		marker := footnoteMarker(number + 1)
+		if i := strings.Index(line, marker); i >= 0 {
+			offset := l.pdf.GetStringWidth(line[:i])
+			l.pdf.LinkString(x+cMargin+offset, y, l.pdf.GetStringWidth(marker), layoutLineHeight, href)
+		}
+	}
+}
+
+// layoutFootnotes lists the targets of the links in the body
+func (l *htmlLayout) layoutFootnotes(labels Labels) {
+	if len(l.links) == 0 {
+		return
+	}
+
+	l.pdf.Ln(5)
+	l.pdf.SetFont("Arial", "B", 11)
+	l.pdf.CellFormat(0, 7, labels.Links+":", "", 1, "L", false, 0, "")
+
+	left, _, right, _ := l.pdf.GetMargins()
+	pageWidth, _ := l.pdf.GetPageSize()
+	l.pdf.SetFont("Arial", "", 9)
+	for i, href := range l.links {
+		marker := footnoteMarker(i + 1)
+		markerWidth := l.pdf.GetStringWidth(marker) + 3
+		for j, line := range wrapText(l.pdf, l.tr(href), pageWidth-left-right-markerWidth) {
+			if j == 0 {
+				l.pdf.CellFormat(markerWidth, 4.5, marker, "", 0, "L", false, 0, "")
+			} else {
+				l.pdf.SetX(left + markerWidth)
+			}
+			l.pdf.SetTextColor(0, 0, 200)
+			l.pdf.CellFormat(0, 4.5, line, "", 1, "L", false, 0, href)
+			l.pdf.SetTextColor(0, 0, 0)
+		}
+	}
+}
+
+// contentWidth returns the width available at the current indent
+func (l *htmlLayout) contentWidth() float64 {
+	left, _, right, _ := l.pdf.GetMargins()
+	pageWidth, _ := l.pdf.GetPageSize()
+	return pageWidth - left - right - l.indent
+}
+
+// layoutList draws list items with bullets or numbers
+func (l *htmlLayout) layoutList(n *xhtml.Node) {
+	number := 1
+	if start, err := strconv.Atoi(getAttr(n, "start")); err == nil {
+		number = start
+	}
+
+	l.indent += layoutIndent
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != xhtml.ElementNode || c.Data != "li" {
+			l.walk(c)
+			continue
+		}
+
+		l.flush()
+		if n.Data == "ol" {
+			l.prefix = strconv.Itoa(number) + "."
+			number++
+		} else {
+			l.prefix = "•"
+		}
+		l.walkChildren(c)
+		l.flush()
+		l.prefix = ""
+	}
+	l.indent -= layoutIndent
+}
+
+// tableCell is one cell of a data table
+type tableCell struct {
+	Text    string
+	Header  bool
+	Colspan int
+}
+
+// layoutTable draws data tables as a bordered grid. Layout tables, which most
+// HTML email uses for positioning, are laid out as ordinary blocks instead.
+func (l *htmlLayout) layoutTable(table *xhtml.Node) {
+	rows := tableRows(table)
+	columns := 0
+	for _, row := range rows {
+		span := 0
+		for _, cell := range row {
+			span += cell.Colspan
+		}
+		if span > columns {
+			columns = span
+		}
+	}
+
+	if !isDataTable(table, rows, columns) {
+		l.walkChildren(table)
+		return
+	}
+
+	l.pdf.SetFont("Arial", "", 10)
+	widths := l.columnWidths(rows, columns)
+	left, _, _, bottom := l.pdf.GetMargins()
+	_, pageHeight := l.pdf.GetPageSize()
+
+	for _, row := range rows {
+		// Wrap every cell first to find the row height
+		var cellLines [][]string
+		var cellWidths []float64
+		height := 0.0
+		column := 0
+		for _, cell := range row {
+			width := 0.0
+			for i := column; i < column+cell.Colspan && i < columns; i++ {
+				width += widths[i]
+			}
+			column += cell.Colspan
+
+			l.pdf.SetFont("Arial", cellStyle(cell), 10)
+			lines := wrapText(l.pdf, l.tr(cell.Text), width-2*layoutCellPadding)
+			cellLines = append(cellLines, lines)
+			cellWidths = append(cellWidths, width)
+			if h := float64(len(lines))*layoutLineHeight + 2*layoutCellPadding; h > height {
+				height = h
+			}
+		}
+
+		if l.pdf.GetY()+height > pageHeight-bottom {
+			l.pdf.AddPage()
+		}
+
+		x, y := left+l.indent, l.pdf.GetY()
+		for i, cell := range row {
+			if cell.Header {
+				l.pdf.SetFillColor(235, 235, 235)
+				l.pdf.Rect(x, y, cellWidths[i], height, "FD")
+			} else {
+				l.pdf.Rect(x, y, cellWidths[i], height, "D")
+			}
+
+			l.pdf.SetFont("Arial", cellStyle(cell), 10)
+			for j, line := range cellLines[i] {
+				l.pdf.SetXY(x+layoutCellPadding, y+layoutCellPadding+float64(j)*layoutLineHeight)
+				l.pdf.CellFormat(cellWidths[i]-2*layoutCellPadding, layoutLineHeight, line, "", 0, "L", false, 0, "")
+			}
+			x += cellWidths[i]
+		}
+		l.pdf.SetXY(left, y+height)
+	}
+
+	l.pdf.Ln(3)
+}
+
+// cellStyle returns the font style for a table cell
+func cellStyle(cell tableCell) string {
+	if cell.Header {
+		return "B"
+	}
+	return ""
+}
+
+// columnWidths fits the columns to the available width, giving each at least
+// its longest word and sharing the rest in proportion to its content
+func (l *htmlLayout) columnWidths(rows [][]tableCell, columns int) []float64 {
+	natural := make([]float64, columns)
+	minimum := make([]float64, columns)
+
+	for _, row := range rows {
+		column := 0
+		for _, cell := range row {
+			if cell.Colspan == 1 && column < columns {
+				l.pdf.SetFont("Arial", cellStyle(cell), 10)
+				text := l.tr(cell.Text)
+				if w := l.pdf.GetStringWidth(text) + 2*layoutCellPadding; w > natural[column] {
+					natural[column] = w
+				}
+				for _, word := range strings.Fields(text) {
+					if w := l.pdf.GetStringWidth(word) + 2*layoutCellPadding; w > minimum[column] {
+						minimum[column] = w
+					}
+				}
+			}
+			column += cell.Colspan
+		}
+	}
+
+	available := l.contentWidth()
+	var sumNatural, sumMinimum float64
+	for i := range natural {
+		natural[i] = max(natural[i], 2*layoutCellPadding+5)
+		minimum[i] = min(max(minimum[i], 2*layoutCellPadding+5), natural[i])
+		sumNatural += natural[i]
+		sumMinimum += minimum[i]
+	}
+
+	widths := make([]float64, columns)
+	switch {
+	case sumNatural <= available:
+		copy(widths, natural)
+	case sumMinimum >= available:
+		for i := range widths {
+			widths[i] = minimum[i] * available / sumMinimum
+		}
+	default:
+		extra := available - sumMinimum
+		for i := range widths {
+			widths[i] = minimum[i] + extra*(natural[i]-minimum[i])/(sumNatural-sumMinimum)
+		}
+	}
+	return widths
+}
+
+// tableRows collects the cells of a table, skipping any nested tables' rows
+func tableRows(table *xhtml.Node) [][]tableCell {
+	var rows [][]tableCell
+
+	var walk func(n *xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != xhtml.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "thead", "tbody", "tfoot":
+				walk(c)
+			case "tr":
+				var row []tableCell
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type != xhtml.ElementNode || (cell.Data != "td" && cell.Data != "th") {
+						continue
+					}
+					colspan, err := strconv.Atoi(getAttr(cell, "colspan"))
+					if err != nil || colspan < 1 {
+						colspan = 1
+					}
+					row = append(row, tableCell{
+						Text:    strings.Join(strings.Fields(nodeText(cell)), " "),
+						Header:  cell.Data == "th",
+						Colspan: colspan,
+					})
+				}
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+	walk(table)
+
+	return rows
+}
+
+// isDataTable tells tables holding tabular data apart from layout tables
+func isDataTable(table *xhtml.Node, rows [][]tableCell, columns int) bool {
+	if columns < 2 || getAttr(table, "role") == "presentation" || hasNestedTable(table) {
+		return false
+	}
+	if border, err := strconv.Atoi(getAttr(table, "border")); err == nil && border > 0 {
+		return true
+	}
+	for _, row := range rows {
+		for _, cell := range row {
+			if cell.Header {
+				return true
+			}
+		}
+	}
+	return len(rows) > 1
+}
+
+// hasNestedTable reports whether a table contains another table
+func hasNestedTable(table *xhtml.Node) bool {
+	var found bool
+	var walk func(n *xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		for c := n.FirstChild; c != nil && !found; c = c.NextSibling {
+			if c.Type == xhtml.ElementNode && c.Data == "table" {
+				found = true
+				return
+			}
+			walk(c)
+		}
+	}
+	walk(table)
+	return found
+}
+
+// nodeText returns the visible text inside a node
+func nodeText(n *xhtml.Node) string {
+	var b strings.Builder
+	var walk func(n *xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		switch {
+		case n.Type == xhtml.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == xhtml.ElementNode && (n.Data == "script" || n.Data == "style"):
+			return
+		case n.Type == xhtml.ElementNode && (n.Data == "br" || n.Data == "p" || n.Data == "div"):
+			b.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// wrapText splits text already translated for a core font into lines that fit the width
+func wrapText(pdf *gofpdf.Fpdf, text string, width float64) []string {
+	var lines []string
+	var line string
+
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if pdf.GetStringWidth(candidate) <= width {
+			line = candidate
+			continue
+		}
+
+		if line != "" {
+			lines = append(lines, line)
+		}
+
+		// Break words that are wider than the line on their own
+		for pdf.GetStringWidth(word) > width && len(word) > 1 {
+			cut := len(word) - 1
+			for cut > 1 && pdf.GetStringWidth(word[:cut]) > width {
+				cut--
+			}
+			lines = append(lines, word[:cut])
+			word = word[cut:]
+		}
+		line = word
+	}
+
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -2,68 +2,129 @@ package converter
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"html"
 	"os"
 	"path/filepath"
 	"time"
 
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/emulation"
 	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
+
+	"emil/internal/config"
+	"emil/internal/slots"
 )
 
-// renderHTMLToPDF uses headless Chrome to convert HTML to PDF with proper rendering
-func renderHTMLToPDF(htmlContent string, outputPath string) error {
+// How long Chrome may take over a render, and over printing each part of a
+// split document
+const renderTimeout = 30 * time.Second
+
+// Top margin of split parts, in inches, which holds the continuation header
+const partMarginTop = 0.6
+
+// printOptions are the per-run choices that change what Chrome prints, and
+// how the run's renders and files are shared
+type printOptions struct {
+	Tagged        bool // Print a tagged PDF with a structure tree and an outline built from the headings
+	TruncatePages int  // Body pages the document's page guard cuts the body off after (0 = no guard)
+
+	files    fileIO         // How the PDF files are written
+	renders  *slots.Limiter // Renders the run's conversions share (nil = no limit)
+	tempDir  string         // The run's temp directory (empty = system temp dir)
+	tempBase string         // Directory a browser started for the run keeps its files in (empty = system temp dir)
+}
+
+// renderHTMLToPDF uses headless Chrome to convert HTML to PDF with proper rendering,
+// splitting the output into numbered parts when it exceeds the limits. It
+// reports whether the page guard cut the body off. A session's tab is
+// reused rather than opening one for the render.
+func renderHTMLToPDF(b *browser, session *Session, htmlContent string, outputPath string, subject string, labels Labels, limits splitLimits, wait renderWait, chrome config.ChromeOptions, opts printOptions) ([]string, bool, error) {
 	// Create a temporary HTML file to render
-	tmpDir, err := os.MkdirTemp("", "emil-html")
+	if err := checkTempSpace(opts.tempDir, int64(len(htmlContent))); err != nil {
+		return nil, false, err
+	}
+	tmpDir, err := os.MkdirTemp(opts.tempDir, htmlTempPrefix+"*")
 	if err != nil {
-		return fmt.Errorf("failed to create temp directory: %w", err)
+		return nil, false, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 	defer os.RemoveAll(tmpDir)
 
 	tmpHTML := filepath.Join(tmpDir, "email.html")
 	if err := os.WriteFile(tmpHTML, []byte(htmlContent), 0644); err != nil {
-		return fmt.Errorf("failed to write temp HTML file: %w", err)
+		return nil, false, fmt.Errorf("failed to write temp HTML file: %w", err)
 	}
 
 	// Convert file path to URL format
 	fileURL := fmt.Sprintf("file://%s", tmpHTML)
 
-	// Create context with a timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	// Open a tab in the shared browser once a render slot is free
+	opts.renders.Acquire()
+	defer opts.renders.Release()
+	browserCtx, err := b.acquire(chrome, opts.tempBase)
+	if err != nil {
+		return nil, false, err
+	}
+	defer b.release()
 
-	// Create browser instance
-	opts := append(chromedp.DefaultExecAllocatorOptions[:],
-		chromedp.DisableGPU,
-		chromedp.Flag("headless", true),
-		chromedp.Flag("disable-web-security", true),
-		chromedp.Flag("no-sandbox", true),
-	)
+	tabCtx, closeTab, err := session.tab(b, browserCtx)
+	if err != nil {
+		// The browser may have exited; start a new one for the next render
+		b.reset()
+		return nil, false, fmt.Errorf("failed to open browser tab: %w", err)
+	}
+	defer closeTab()
 
-	allocCtx, cancel := chromedp.NewExecAllocator(ctx, opts...)
-	defer cancel()
+	// Give the tab's memory back to Chrome rather than keeping it for the
+	// session's next render while memory is under pressure
+	defer func() {
+		if opts.renders.UnderPressure() {
+			session.discard(b)
+		}
+	}()
 
-	taskCtx, cancel := chromedp.NewContext(allocCtx)
+	// Create context with a timeout
+	taskCtx, cancel := context.WithTimeout(tabCtx, renderTimeout)
 	defer cancel()
 
-	// Ensure that the browser is started
-	if err := chromedp.Run(taskCtx); err != nil {
-		return fmt.Errorf("failed to start browser: %w", err)
-	}
+	// A render that hangs past the timeout usually means Chrome itself is stuck
+	defer func() {
+		if errors.Is(taskCtx.Err(), context.DeadlineExceeded) {
+			b.reset()
+		}
+	}()
+
+	// Count the page's requests so printing can wait for them
+	tracker := trackNetwork(taskCtx)
 
 	// Generate PDF from HTML
 	var pdfBuffer []byte
+	var truncated bool
 	if err := chromedp.Run(taskCtx,
-		chromedp.Navigate(fileURL),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			// Email has no business running scripts
+			return emulation.SetScriptExecutionDisabled(!chrome.JavaScript).Do(ctx)
+		}),
+		loadDocument(b, fileURL, htmlContent),
 		chromedp.WaitReady("body"),
+		waitForRender(wait, tracker, opts.renders),
 		chromedp.ActionFunc(func(ctx context.Context) error {
-			// Wait a bit for any additional resources to load
-			time.Sleep(500 * time.Millisecond)
-			return nil
+			if opts.TruncatePages <= 0 {
+				return nil
+			}
+			height, err := bodyHeight(ctx)
+			truncated = exceedsPageGuard(height, opts.TruncatePages)
+			return err
 		}),
 		chromedp.ActionFunc(func(ctx context.Context) error {
 			// Generate PDF data
-			resp, _, err := page.PrintToPDF().WithPrintBackground(true).Do(ctx)
+			resp, _, err := page.PrintToPDF().
+				WithPrintBackground(true).
+				WithGenerateTaggedPDF(opts.Tagged).
+				WithGenerateDocumentOutline(opts.Tagged).
+				Do(ctx)
 			if err != nil {
 				return err
 			}
@@ -71,13 +132,109 @@ func renderHTMLToPDF(htmlContent string, outputPath string) error {
 			return nil
 		}),
 	); err != nil {
-		return fmt.Errorf("failed to generate PDF: %w", err)
+		// A tab left mid-render isn't reused
+		session.discard(b)
+		return nil, false, fmt.Errorf("failed to generate PDF: %w", err)
 	}
 
-	// Write the PDF file
-	if err := os.WriteFile(outputPath, pdfBuffer, 0644); err != nil {
-		return fmt.Errorf("failed to write PDF file: %w", err)
+	// Write the PDF file whole if it fits within the limits
+	pages := countPDFPages(pdfBuffer)
+	if !limits.enabled() || !limits.exceeded(pages, int64(len(pdfBuffer))) {
+		paths, err := writeParts(outputPath, [][]byte{pdfBuffer}, opts.files)
+		return paths, truncated, err
 	}
 
-	return nil
+	// The parts carry a continuation header in a deeper top margin, which
+	// paginates the document differently, so it's printed again that way to
+	// count the pages the parts are cut from
+	layout, err := printPart(b, session, tabCtx, opts, "", "<span></span>")
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to generate PDF: %w", err)
+	}
+	parts, err := splitPages(countPDFPages(layout), int64(len(layout)), limits, func(first, last, part, parts int) ([]byte, error) {
+		header := fmt.Sprintf(`<div style="font-size:8px;width:100%%;text-align:center;color:#666;">%s</div>`,
+			html.EscapeString(labels.partHeader(subject, part, parts)))
+		return printPart(b, session, tabCtx, opts, fmt.Sprintf("%d-%d", first, last), header)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	paths, err := writeParts(outputPath, parts, opts.files)
+	return paths, truncated, err
+}
+
+// printPart prints the pages in ranges (all of them if empty) of the document
+// loaded in the tab with a continuation header, under its own deadline so the
+// parts of a long document don't share one
+func printPart(b *browser, session *Session, tabCtx context.Context, opts printOptions, ranges, header string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(tabCtx, renderTimeout)
+	defer cancel()
+
+	var data []byte
+	if err := chromedp.Run(ctx,
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			params := page.PrintToPDF().
+				WithPrintBackground(true).
+				WithDisplayHeaderFooter(true).
+				WithHeaderTemplate(header).
+				WithFooterTemplate("<span></span>").
+				WithMarginTop(partMarginTop).
+				WithGenerateTaggedPDF(opts.Tagged).
+				WithGenerateDocumentOutline(opts.Tagged)
+			if ranges != "" {
+				params = params.WithPageRanges(ranges)
+			}
+			resp, _, err := params.Do(ctx)
+			if err != nil {
+				return err
+			}
+			data = resp
+			return nil
+		}),
+	); err != nil {
+		session.discard(b)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			b.reset()
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// bodyHeight measures the laid-out height of the email body in CSS pixels,
+// through the DOM domain since the page may not run scripts. It returns 0
+// for documents without a body block, such as custom templates.
+func bodyHeight(ctx context.Context) (float64, error) {
+	root, err := dom.GetDocument().Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+	node, err := dom.QuerySelector(root.NodeID, ".email-body").Do(ctx)
+	if err != nil || node == 0 {
+		return 0, err
+	}
+	box, err := dom.GetBoxModel().WithNodeID(node).Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return float64(box.Height), nil
+}
+
+// loadDocument opens the rendered HTML in the tab. A remote browser can't
+// read the local temp file, so the document is sent over the protocol instead.
+func loadDocument(b *browser, fileURL, htmlContent string) chromedp.Action {
+	if !b.remote {
+		return chromedp.Navigate(fileURL)
+	}
+
+	return chromedp.Tasks{
+		chromedp.Navigate("about:blank"),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			tree, err := page.GetFrameTree().Do(ctx)
+			if err != nil {
+				return err
+			}
+			return page.SetDocumentContent(tree.Frame.ID, htmlContent).Do(ctx)
+		}),
+	}
 }
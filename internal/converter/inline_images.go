@@ -0,0 +1,231 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+)
+
+const (
+	// Images with more pixels than this are left alone rather than decoded,
+	// so a crafted header can't claim gigabytes of memory
+	maxDecodePixels = 100_000_000
+
+	// JPEG quality of downscaled inline images
+	inlineImageQuality = 85
+)
+
+// imgSrcPattern matches the src attribute of an img element, quoted or not
+var imgSrcPattern = regexp.MustCompile(`(?i)(<img\b[^>]*?\ssrc\s*=\s*)("[^"]*"|'[^']*'|[^\s"'>]+)`)
+
+// inlineImageLimits caps the images embedded in the HTML body. Larger ones
+// are downscaled to JPEG before rendering.
+type inlineImageLimits struct {
+	MaxPixels int   // Longest edge in pixels (0 = no limit)
+	MaxBytes  int64 // Encoded size in bytes (0 = no limit)
+}
+
+func (l inlineImageLimits) enabled() bool {
+	return l.MaxPixels > 0 || l.MaxBytes > 0
+}
+
+// exceeded reports whether an image is over either limit
+func (l inlineImageLimits) exceeded(width, height int, size int64) bool {
+	return (l.MaxPixels > 0 && max(width, height) > l.MaxPixels) ||
+		(l.MaxBytes > 0 && size > l.MaxBytes)
+}
+
+// shrinkInlineImages prepares the images the HTML body refers to by
+// Content-ID as data URIs, keyed by Content-ID, downscaling those over the
+// limits. It returns the parts it downscaled so their originals can be saved
+// with the attachments.
+func shrinkInlineImages(envelope *enmime.Envelope, limits inlineImageLimits) (map[string]string, []*enmime.Part) {
+	images := make(map[string]string)
+	var originals []*enmime.Part
+
+	for _, parts := range [][]*enmime.Part{envelope.Inlines, envelope.OtherParts} {
+		for _, part := range parts {
+			cid := strings.Trim(part.ContentID, "<>")
+			if cid == "" || !strings.HasPrefix(strings.ToLower(part.ContentType), "image/") {
+				continue
+			}
+
+			data, contentType, shrunk := shrinkImage(part.Content, part.ContentType, limits)
+			images[cid] = "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+			if shrunk {
+				originals = append(originals, originalImage(part, len(originals)+1))
+			}
+		}
+	}
+
+	return images, originals
+}
+
+// originalImage returns a copy of an inline image part to save as an
+// attachment, named after its part or numbered if it has no name
+func originalImage(part *enmime.Part, n int) *enmime.Part {
+	original := *part
+	original.Disposition = "attachment"
+	original.FileName = partFilename(part, n)
+	return &original
+}
+
+// embedInlineImages points the body's cid: images at the prepared data URIs
+// and downscales data URI images over the limits
+func embedInlineImages(body string, images map[string]string, limits inlineImageLimits) string {
+	return imgSrcPattern.ReplaceAllStringFunc(body, func(tag string) string {
+		match := imgSrcPattern.FindStringSubmatch(tag)
+		prefix, value := match[1], strings.Trim(match[2], `"'`)
+
+		lower := strings.ToLower(value)
+		switch {
+		case strings.HasPrefix(lower, "cid:"):
+			cid, err := url.PathUnescape(value[len("cid:"):])
+			if err != nil {
+				cid = value[len("cid:"):]
+			}
+			if uri, ok := images[cid]; ok {
+				return prefix + `"` + uri + `"`
+			}
+		case strings.HasPrefix(lower, "data:image/"):
+			if uri, ok := shrinkDataURI(value, limits); ok {
+				return prefix + `"` + uri + `"`
+			}
+		}
+		return tag
+	})
+}
+
+// shrinkDataURI downscales a base64 data URI image over the limits,
+// reporting whether it was changed
+func shrinkDataURI(uri string, limits inlineImageLimits) (string, bool) {
+	header, payload, ok := strings.Cut(uri, ",")
+	if !ok || !strings.HasSuffix(strings.ToLower(header), ";base64") {
+		return uri, false
+	}
+	// Long data URIs are often wrapped across lines
+	payload = strings.Join(strings.Fields(payload), "")
+	content, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return uri, false
+	}
+
+	contentType := strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64")
+	data, contentType, shrunk := shrinkImage(content, contentType, limits)
+	if !shrunk {
+		return uri, false
+	}
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data), true
+}
+
+// shrinkImage downscales an image over the limits to a JPEG that fits them,
+// reporting whether it did. Images that can't be decoded, or are too large
+// to decode safely, are returned unchanged.
+func shrinkImage(content []byte, contentType string, limits inlineImageLimits) ([]byte, string, bool) {
+	width, height, err := imageSize(content)
+	if err != nil || !limits.exceeded(width, height, int64(len(content))) {
+		return content, contentType, false
+	}
+
+	src, err := decodeImage(content)
+	if err != nil {
+		return content, contentType, false
+	}
+
+	edge := max(width, height)
+	if limits.MaxPixels > 0 {
+		edge = min(edge, limits.MaxPixels)
+	}
+
+	// Shrink further while the encoded image is still over the size limit
+	for {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, scaleImage(src, edge), &jpeg.Options{Quality: inlineImageQuality}); err != nil {
+			return content, contentType, false
+		}
+		if limits.MaxBytes == 0 || int64(buf.Len()) <= limits.MaxBytes || edge <= thumbnailMaxPixels {
+			if buf.Len() >= len(content) {
+				// Re-encoding made it no smaller, so keep the original
+				return content, contentType, false
+			}
+			return buf.Bytes(), "image/jpeg", true
+		}
+		edge = max(thumbnailMaxPixels, edge*3/4)
+	}
+}
+
+// imageSize reads an image's dimensions from its header, refusing images with
+// no pixels or more than maxDecodePixels, which a few KB can declare
+func imageSize(content []byte) (int, int, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return 0, 0, fmt.Errorf("image has no pixels")
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxDecodePixels {
+		return 0, 0, fmt.Errorf("image of %dx%d pixels is too large to decode", cfg.Width, cfg.Height)
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// decodeImage decodes an image that imageSize accepts. Every image emil
+// decodes goes through it, so none is decoded unchecked.
+func decodeImage(content []byte) (image.Image, error) {
+	if _, _, err := imageSize(content); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return src, nil
+}
+
+// scaleImage scales an image so its longest edge is at most maxEdge pixels,
+// averaging the source pixels behind each output pixel so photos stay smooth.
+// Transparent areas are flattened onto white, since JPEG has no alpha.
+func scaleImage(src image.Image, maxEdge int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	newWidth, newHeight := width, height
+	if edge := max(width, height); edge > maxEdge {
+		newWidth = max(1, width*maxEdge/edge)
+		newHeight = max(1, height*maxEdge/edge)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	for y := 0; y < newHeight; y++ {
+		y0, y1 := y*height/newHeight, max((y+1)*height/newHeight, y*height/newHeight+1)
+		for x := 0; x < newWidth; x++ {
+			x0, x1 := x*width/newWidth, max((x+1)*width/newWidth, x*width/newWidth+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+
+			// The colors are premultiplied, so adding the missing alpha as
+			// white composites the pixel onto a white page
+			white := 0xffff*n - a
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8((r + white) / n >> 8)
+			dst.Pix[i+1] = uint8((g + white) / n >> 8)
+			dst.Pix[i+2] = uint8((b + white) / n >> 8)
+			dst.Pix[i+3] = 0xff
+		}
+	}
+	return dst
+}
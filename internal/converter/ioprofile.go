@@ -0,0 +1,126 @@
+package converter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"emil/internal/config"
+	"emil/internal/slots"
+)
+
+// Storage profiles, from easiest on shared storage to fastest
+const (
+	IOProfileGentle     = "gentle"
+	IOProfileNormal     = "normal"
+	IOProfileAggressive = "aggressive"
+)
+
+// IOProfile sets how hard conversions press on storage
+type IOProfile struct {
+	ReadAhead  int           // Bytes read from a source message at a time
+	OpenFiles  int           // Source messages and attachments open at once, and directories read at once by discovery (0 = no limit)
+	WriteBurst int64         // Attachment bytes written before pausing (0 = written without pauses)
+	BurstPause time.Duration // Pause after each write burst
+}
+
+// ioProfiles are the profiles by name
+var ioProfiles = map[string]IOProfile{
+	IOProfileGentle:     {ReadAhead: 32 * 1024, OpenFiles: 4, WriteBurst: 256 * 1024, BurstPause: 20 * time.Millisecond},
+	IOProfileNormal:     {ReadAhead: 128 * 1024, OpenFiles: 32},
+	IOProfileAggressive: {ReadAhead: 1024 * 1024},
+}
+
+// LookupIOProfile returns the storage profile with a name (empty = normal)
+func LookupIOProfile(name string) (IOProfile, error) {
+	if name == "" {
+		name = IOProfileNormal
+	}
+	profile, ok := ioProfiles[name]
+	if !ok {
+		return IOProfile{}, fmt.Errorf("invalid I/O profile %q (use %s, %s or %s)", name, IOProfileGentle, IOProfileNormal, IOProfileAggressive)
+	}
+	return profile, nil
+}
+
+// fileIO is how a conversion reads and writes files: paced by the storage
+// profile of its config, taking one of the run's open file slots for each
+// file it holds open, and retrying transient errors as its IORetry says
+type fileIO struct {
+	profile     IOProfile
+	slots       *slots.Limiter // Shared by the run's conversions (nil = no limit)
+	descriptors *slots.Limiter // The run's descriptor budget (nil = no limit)
+	attempts    int            // Attempts at a file operation, including the first
+	backoff     time.Duration  // Delay before the first retry, doubled for each further one
+}
+
+// newFileIO returns how a conversion with cfg reads and writes files. An
+// unknown profile, which the command and library reject up front, reads as
+// normal.
+func newFileIO(cfg *config.Config) fileIO {
+	profile, err := LookupIOProfile(cfg.IOProfile)
+	if err != nil {
+		profile = ioProfiles[IOProfileNormal]
+	}
+	f := fileIO{
+		profile:     profile,
+		slots:       cfg.FileSlots,
+		descriptors: cfg.DescriptorSlots,
+		attempts:    cfg.IORetry.Attempts,
+		backoff:     time.Duration(cfg.IORetry.BackoffMS) * time.Millisecond,
+	}
+	if f.attempts <= 0 {
+		f.attempts = defaultIOAttempts
+	}
+	if f.backoff <= 0 {
+		f.backoff = defaultIOBackoff
+	}
+	return f
+}
+
+// openSlot waits until the open file slots and the descriptor budget allow
+// another file to be opened and returns a function that frees the slot once
+// the file is closed
+func (f fileIO) openSlot() func() {
+	f.slots.Acquire()
+	f.descriptors.Acquire()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			f.descriptors.Release()
+			f.slots.Release()
+		})
+	}
+}
+
+// readAhead wraps a source message in a reader that reads the profile's
+// read-ahead at a time
+func (f fileIO) readAhead(r io.Reader) io.Reader {
+	return bufio.NewReaderSize(r, f.profile.ReadAhead)
+}
+
+// copyInBursts copies r to w, flushing and pausing after each of the
+// profile's write bursts so a storm of large attachments doesn't saturate
+// shared storage
+func (f fileIO) copyInBursts(w *bufio.Writer, r io.Reader) error {
+	profile := f.profile
+	if profile.WriteBurst <= 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	for {
+		_, err := io.CopyN(w, r, profile.WriteBurst)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		time.Sleep(profile.BurstPause)
+	}
+}
@@ -0,0 +1,289 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Journaling systems whose reports are recognized
+const (
+	JournalExchange   = "Exchange"
+	JournalGoogle     = "Google"
+	JournalMimecast   = "Mimecast"
+	JournalProofpoint = "Proofpoint"
+	JournalEnvelope   = "Envelope" // Another archiver using the Exchange envelope layout
+)
+
+// Directions of a journaled message relative to the organization
+const (
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+	DirectionInternal = "internal"
+)
+
+// JournalInfo holds the envelope data recovered from a journal report
+type JournalInfo struct {
+	Format     string   // Journaling system that produced the wrapper
+	Sender     string   // Envelope sender
+	MessageID  string   // Message-ID of the journaled message
+	To         []string // Envelope To recipients
+	Cc         []string // Envelope Cc recipients
+	Bcc        []string // Blind recipients, not visible in the original headers
+	Recipients []string // Every envelope recipient, including expansions
+	Direction  string   // DirectionInbound, DirectionOutbound or DirectionInternal (empty = not recorded)
+}
+
+// unwrapJournal detects a journal report and returns the original message it wraps.
+// If the envelope is not a journal report, it is returned unchanged with nil info.
+// Google's envelope journaling delivers the message itself with its envelope
+// recipients added as headers, so it is returned unchanged with the info.
+func unwrapJournal(envelope *enmime.Envelope) (*enmime.Envelope, *JournalInfo, error) {
+	format := journalFormat(envelope)
+	if format == "" {
+		return envelope, nil, nil
+	}
+	if format == JournalGoogle {
+		return envelope, googleEnvelope(envelope), nil
+	}
+
+	// The original message travels as a message/rfc822 part
+	original := findEmbeddedMessage(envelope)
+	if original == nil {
+		return envelope, nil, fmt.Errorf("journal report has no embedded message")
+	}
+
+	inner, err := enmime.ReadEnvelope(bytes.NewReader(original.Content))
+	if err != nil {
+		return envelope, nil, fmt.Errorf("failed to parse journaled message: %w", err)
+	}
+
+	info := parseEnvelopeReport(envelope.Text)
+	info.Format = format
+	if info.Direction == "" {
+		info.Direction = exchangeDirection(envelope)
+	}
+	if info.Direction == "" {
+		info.Direction = exchangeDirection(inner)
+	}
+	return inner, info, nil
+}
+
+// journalFormat returns the journaling system that produced the envelope, or
+// "" if it isn't a journal report
+func journalFormat(envelope *enmime.Envelope) string {
+	// Exchange sends this header with an empty value, so check for presence
+	if hasHeader(envelope, "X-MS-Journal-Report") {
+		return JournalExchange
+	}
+	if hasHeader(envelope, "X-Gm-Original-To") {
+		return JournalGoogle
+	}
+
+	// Mimecast, Proofpoint and other archivers journal in Exchange's layout: an
+	// envelope block in the body and the original message attached. Require
+	// both a sender and a recipient line so forwarded messages aren't taken
+	// for reports.
+	if findEmbeddedMessage(envelope) == nil {
+		return ""
+	}
+	info := parseEnvelopeReport(envelope.Text)
+	if info.Sender == "" || len(info.Recipients) == 0 {
+		return ""
+	}
+	switch {
+	case hasHeaderPrefix(envelope, "X-Mimecast-") || hasHeaderPrefix(envelope, "X-MC-"):
+		return JournalMimecast
+	case hasHeaderPrefix(envelope, "X-Proofpoint-") || hasHeaderPrefix(envelope, "X-PP-"):
+		return JournalProofpoint
+	}
+	return JournalEnvelope
+}
+
+// googleEnvelope reads the envelope data Google Workspace adds to journaled
+// copies: one X-Gm-Original-To header per envelope recipient
+func googleEnvelope(envelope *enmime.Envelope) *JournalInfo {
+	info := &JournalInfo{
+		Format:    JournalGoogle,
+		Sender:    strings.Trim(strings.TrimSpace(envelope.GetHeader("Return-Path")), "<>"),
+		MessageID: strings.TrimSpace(envelope.GetHeader("Message-ID")),
+	}
+	for _, value := range envelope.GetHeaderValues("X-Gm-Original-To") {
+		for _, address := range strings.Split(value, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				info.Recipients = append(info.Recipients, address)
+			}
+		}
+	}
+	return info
+}
+
+// exchangeDirection returns the direction Exchange recorded on a message,
+// or "" if there is none
+func exchangeDirection(envelope *enmime.Envelope) string {
+	switch strings.ToLower(strings.TrimSpace(envelope.GetHeader("X-MS-Exchange-Organization-MessageDirectionality"))) {
+	case "incoming":
+		return DirectionInbound
+	case "originating":
+		return DirectionOutbound
+	}
+	return ""
+}
+
+// hasHeader reports whether the header is present, even with an empty value
+func hasHeader(envelope *enmime.Envelope, name string) bool {
+	for _, key := range envelope.GetHeaderKeys() {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasHeaderPrefix reports whether any header name starts with the prefix
+func hasHeaderPrefix(envelope *enmime.Envelope, prefix string) bool {
+	for _, key := range envelope.GetHeaderKeys() {
+		if len(key) >= len(prefix) && strings.EqualFold(key[:len(prefix)], prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// findEmbeddedMessage returns the first message/rfc822 part of the envelope
+func findEmbeddedMessage(envelope *enmime.Envelope) *enmime.Part {
+	for _, parts := range [][]*enmime.Part{envelope.Attachments, envelope.Inlines, envelope.OtherParts} {
+		for _, part := range parts {
+			if strings.EqualFold(part.ContentType, "message/rfc822") && len(part.Content) > 0 {
+				return part
+			}
+		}
+	}
+	return nil
+}
+
+// parseEnvelopeReport reads the "Key: value" lines of an envelope journal
+// report body, as written by Exchange and the archivers that copy its layout
+func parseEnvelopeReport(body string) *JournalInfo {
+	info := &JournalInfo{}
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "sender":
+			info.Sender = value
+		case "message-id":
+			info.MessageID = value
+		case "to":
+			info.To = append(info.To, value)
+		case "cc":
+			info.Cc = append(info.Cc, value)
+		case "bcc":
+			info.Bcc = append(info.Bcc, value)
+		case "recipient":
+			// "Recipient: a@example.com, Expanded: dl@example.com" lists the
+			// delivered address first, followed by how it was reached
+			address, _, _ := strings.Cut(value, ",")
+			info.Recipients = append(info.Recipients, strings.TrimSpace(address))
+		case "direction", "message direction":
+			info.Direction = parseDirection(value)
+		}
+	}
+
+	return info
+}
+
+// parseDirection maps the direction names archivers use to ours
+func parseDirection(value string) string {
+	switch strings.ToLower(value) {
+	case "inbound", "incoming", "received":
+		return DirectionInbound
+	case "outbound", "outgoing", "sent", "originating":
+		return DirectionOutbound
+	case "internal":
+		return DirectionInternal
+	}
+	return ""
+}
+
+// ActualRecipients returns everyone the message was delivered to: the
+// envelope recipients, or the To, Cc and Bcc lists if none were recorded
+func (j *JournalInfo) ActualRecipients() []string {
+	if len(j.Recipients) > 0 {
+		return j.Recipients
+	}
+	var recipients []string
+	for _, list := range [][]string{j.To, j.Cc, j.Bcc} {
+		recipients = append(recipients, list...)
+	}
+	return recipients
+}
+
+// xmpProperties returns the journal metadata written into the PDF's XMP
+func (j *JournalInfo) xmpProperties() map[string]string {
+	properties := map[string]string{"journalFormat": j.Format}
+	if j.Sender != "" {
+		properties["journalSender"] = j.Sender
+	}
+	if recipients := j.ActualRecipients(); len(recipients) > 0 {
+		properties["journalRecipients"] = strings.Join(recipients, ", ")
+	}
+	if j.Direction != "" {
+		properties["journalDirection"] = j.Direction
+	}
+	return properties
+}
+
+// fields returns the journal metadata as labelled rows for rendering
+func (j *JournalInfo) fields() []HeaderField {
+	var fields []HeaderField
+	add := func(name string, values ...string) {
+		if joined := strings.Join(values, ", "); joined != "" {
+			fields = append(fields, HeaderField{Name: name, Value: joined})
+		}
+	}
+
+	add("Format", j.Format)
+	add("Sender", j.Sender)
+	add("Message-ID", j.MessageID)
+	add("To", j.To...)
+	add("Cc", j.Cc...)
+	add("Bcc", j.Bcc...)
+	add("Recipients", j.Recipients...)
+	add("Direction", j.Direction)
+	return fields
+}
+
+// writeHTMLJournal adds the journal metadata section to the HTML buffer
+func writeHTMLJournal(buffer *bytes.Buffer, info *JournalInfo, labels Labels) {
+	buffer.WriteString("<div class=\"journal\">\n")
+	buffer.WriteString("<h3>" + html.EscapeString(labels.JournalMetadata) + "</h3>\n")
+	for _, field := range info.fields() {
+		addHeader(buffer, field.Name, field.Value)
+	}
+	buffer.WriteString("</div>\n")
+}
+
+// addPDFJournal adds the journal metadata section to the PDF
+func addPDFJournal(pdf *gofpdf.Fpdf, info *JournalInfo, labels Labels) {
+	pdf.Ln(5)
+	pdf.SetFont("Arial", "B", 12)
+	pdf.Cell(0, 10, labels.JournalMetadata+":")
+	pdf.Ln(10)
+
+	addPDFFields(pdf, info.fields())
+}
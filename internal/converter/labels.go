@@ -0,0 +1,217 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Labels holds the user-visible field labels for one locale
+type Labels struct {
+	From             string
+	To               string
+	Cc               string
+	Subject          string
+	Date             string
+	Attachments      string
+	ImageAttachments string
+	RecognizedText   string
+	JournalMetadata  string
+	SecurityThreat   string
+	MalwareDetected  string
+	SecurityAlerts   string // Heading of the alerts listed at the top of the PDF
+	InlineImage      string
+	Part             string // Format with part number and total, e.g. "Part %d of %d"
+	Continued        string
+	QuotedText       string // Format with line count, e.g. "quoted text (%d lines)"
+	DeliveryReport   string
+	ReadReceipt      string
+	Links            string
+	NotSaved         string // Marks attachments the attachment policy did not save
+	AuthChain        string // Heading of the ARC chain of a forwarded message
+	ReceivedHops     string // Heading of the route traced from the Received headers
+	Truncated        string // Format with page count, e.g. "Truncated after %d pages"
+	EmptyBody        string // Shown in place of the body of a message that has none
+	RawSource        string
+	RawSourcePartial string // Format with the size shown and the message size, e.g. "first %s of %s"
+
+	// latinOnly is false for scripts the fallback renderer's core fonts can't draw
+	latinOnly bool
+}
+
+// locales maps a locale code to its labels
+var locales = map[string]Labels{
+	"en": {
+		From: "From", To: "To", Cc: "Cc", Subject: "Subject", Date: "Date",
+		Attachments: "Attachments", ImageAttachments: "Image attachments",
+		RecognizedText: "Recognized text (OCR)", JournalMetadata: "Journal metadata",
+		SecurityThreat: "SECURITY THREAT DETECTED", MalwareDetected: "SECURITY ALERT: Malware detected in this attachment", SecurityAlerts: "Security alerts",
+		InlineImage: "Inline image", Part: "Part %d of %d", Continued: "continued",
+		QuotedText: "quoted text (%d lines)", DeliveryReport: "Delivery report", ReadReceipt: "Read receipt", Links: "Links", NotSaved: "not saved",
+		AuthChain: "Authentication chain (ARC)", ReceivedHops: "Message route (Received headers)", Truncated: "Truncated after %d pages: the rest of this message is not shown", EmptyBody: "This message has no body content", RawSource: "Message source", RawSourcePartial: "first %s of %s",
+		latinOnly: true,
+	},
+	"de": {
+		From: "Von", To: "An", Cc: "Kopie", Subject: "Betreff", Date: "Datum",
+		Attachments: "Anhänge", ImageAttachments: "Bildanhänge",
+		RecognizedText: "Erkannter Text (OCR)", JournalMetadata: "Journal-Metadaten",
+		SecurityThreat: "SICHERHEITSBEDROHUNG ERKANNT", MalwareDetected: "SICHERHEITSWARNUNG: Schadsoftware in diesem Anhang erkannt", SecurityAlerts: "Sicherheitswarnungen",
+		InlineImage: "Eingebettetes Bild", Part: "Teil %d von %d", Continued: "Fortsetzung",
+		QuotedText: "zitierter Text (%d Zeilen)", DeliveryReport: "Zustellbericht", ReadReceipt: "Lesebestätigung", Links: "Links", NotSaved: "nicht gespeichert",
+		AuthChain: "Authentifizierungskette (ARC)", ReceivedHops: "Nachrichtenweg (Received-Header)", Truncated: "Nach %d Seiten gekürzt: der Rest dieser Nachricht wird nicht angezeigt", EmptyBody: "Diese Nachricht hat keinen Inhalt", RawSource: "Nachrichtenquelltext", RawSourcePartial: "erste %s von %s",
+		latinOnly: true,
+	},
+	"fr": {
+		From: "De", To: "À", Cc: "Cc", Subject: "Objet", Date: "Date",
+		Attachments: "Pièces jointes", ImageAttachments: "Images jointes",
+		RecognizedText: "Texte reconnu (OCR)", JournalMetadata: "Métadonnées de journalisation",
+		SecurityThreat: "MENACE DE SÉCURITÉ DÉTECTÉE", MalwareDetected: "ALERTE DE SÉCURITÉ : logiciel malveillant détecté dans cette pièce jointe", SecurityAlerts: "Alertes de sécurité",
+		InlineImage: "Image intégrée", Part: "Partie %d sur %d", Continued: "suite",
+		QuotedText: "texte cité (%d lignes)", DeliveryReport: "Rapport de remise", ReadReceipt: "Accusé de lecture", Links: "Liens", NotSaved: "non enregistrée",
+		AuthChain: "Chaîne d'authentification (ARC)", ReceivedHops: "Acheminement du message (en-têtes Received)", Truncated: "Tronqué après %d pages : la suite de ce message n'est pas affichée", EmptyBody: "Ce message n'a pas de contenu", RawSource: "Source du message", RawSourcePartial: "premiers %s sur %s",
+		latinOnly: true,
+	},
+	"es": {
+		From: "De", To: "Para", Cc: "CC", Subject: "Asunto", Date: "Fecha",
+		Attachments: "Adjuntos", ImageAttachments: "Imágenes adjuntas",
+		RecognizedText: "Texto reconocido (OCR)", JournalMetadata: "Metadatos de registro en diario",
+		SecurityThreat: "AMENAZA DE SEGURIDAD DETECTADA", MalwareDetected: "ALERTA DE SEGURIDAD: se detectó malware en este adjunto", SecurityAlerts: "Alertas de seguridad",
+		InlineImage: "Imagen insertada", Part: "Parte %d de %d", Continued: "continuación",
+		QuotedText: "texto citado (%d líneas)", DeliveryReport: "Informe de entrega", ReadReceipt: "Confirmación de lectura", Links: "Enlaces", NotSaved: "no guardado",
+		AuthChain: "Cadena de autenticación (ARC)", ReceivedHops: "Ruta del mensaje (encabezados Received)", Truncated: "Truncado tras %d páginas: el resto de este mensaje no se muestra", EmptyBody: "Este mensaje no tiene contenido", RawSource: "Código fuente del mensaje", RawSourcePartial: "primeros %s de %s",
+		latinOnly: true,
+	},
+	"it": {
+		From: "Da", To: "A", Cc: "Cc", Subject: "Oggetto", Date: "Data",
+		Attachments: "Allegati", ImageAttachments: "Immagini allegate",
+		RecognizedText: "Testo riconosciuto (OCR)", JournalMetadata: "Metadati di journaling",
+		SecurityThreat: "MINACCIA ALLA SICUREZZA RILEVATA", MalwareDetected: "AVVISO DI SICUREZZA: malware rilevato in questo allegato", SecurityAlerts: "Avvisi di sicurezza",
+		InlineImage: "Immagine incorporata", Part: "Parte %d di %d", Continued: "continua",
+		QuotedText: "testo citato (%d righe)", DeliveryReport: "Rapporto di consegna", ReadReceipt: "Conferma di lettura", Links: "Collegamenti", NotSaved: "non salvato",
+		AuthChain: "Catena di autenticazione (ARC)", ReceivedHops: "Percorso del messaggio (intestazioni Received)", Truncated: "Troncato dopo %d pagine: il resto di questo messaggio non è mostrato", EmptyBody: "Questo messaggio non ha contenuto", RawSource: "Sorgente del messaggio", RawSourcePartial: "primi %s di %s",
+		latinOnly: true,
+	},
+	"nl": {
+		From: "Van", To: "Aan", Cc: "CC", Subject: "Onderwerp", Date: "Datum",
+		Attachments: "Bijlagen", ImageAttachments: "Afbeeldingsbijlagen",
+		RecognizedText: "Herkende tekst (OCR)", JournalMetadata: "Journaalmetagegevens",
+		SecurityThreat: "BEVEILIGINGSDREIGING GEDETECTEERD", MalwareDetected: "BEVEILIGINGSWAARSCHUWING: malware gedetecteerd in deze bijlage", SecurityAlerts: "Beveiligingswaarschuwingen",
+		InlineImage: "Ingesloten afbeelding", Part: "Deel %d van %d", Continued: "vervolg",
+		QuotedText: "geciteerde tekst (%d regels)", DeliveryReport: "Bezorgrapport", ReadReceipt: "Leesbevestiging", Links: "Koppelingen", NotSaved: "niet opgeslagen",
+		AuthChain: "Authenticatieketen (ARC)", ReceivedHops: "Berichtroute (Received-headers)", Truncated: "Afgekapt na %d pagina's: de rest van dit bericht wordt niet getoond", EmptyBody: "Dit bericht heeft geen inhoud", RawSource: "Berichtbron", RawSourcePartial: "eerste %s van %s",
+		latinOnly: true,
+	},
+	"pt": {
+		From: "De", To: "Para", Cc: "Cc", Subject: "Assunto", Date: "Data",
+		Attachments: "Anexos", ImageAttachments: "Imagens anexadas",
+		RecognizedText: "Texto reconhecido (OCR)", JournalMetadata: "Metadados de registro em diário",
+		SecurityThreat: "AMEAÇA DE SEGURANÇA DETECTADA", MalwareDetected: "ALERTA DE SEGURANÇA: malware detectado neste anexo", SecurityAlerts: "Alertas de segurança",
+		InlineImage: "Imagem incorporada", Part: "Parte %d de %d", Continued: "continuação",
+		QuotedText: "texto citado (%d linhas)", DeliveryReport: "Relatório de entrega", ReadReceipt: "Confirmação de leitura", Links: "Links", NotSaved: "não salvo",
+		AuthChain: "Cadeia de autenticação (ARC)", ReceivedHops: "Rota da mensagem (cabeçalhos Received)", Truncated: "Truncado após %d páginas: o restante desta mensagem não é exibido", EmptyBody: "Esta mensagem não tem conteúdo", RawSource: "Código-fonte da mensagem", RawSourcePartial: "primeiros %s de %s",
+		latinOnly: true,
+	},
+	"ja": {
+		From: "差出人", To: "宛先", Cc: "CC", Subject: "件名", Date: "日付",
+		Attachments: "添付ファイル", ImageAttachments: "画像の添付ファイル",
+		RecognizedText: "認識されたテキスト (OCR)", JournalMetadata: "ジャーナル メタデータ",
+		SecurityThreat: "セキュリティ上の脅威を検出", MalwareDetected: "セキュリティ警告: この添付ファイルでマルウェアが検出されました", SecurityAlerts: "セキュリティ警告",
+		InlineImage: "インライン画像", Part: "パート %d / %d", Continued: "続き",
+		QuotedText: "引用テキスト (%d 行)", DeliveryReport: "配信レポート", ReadReceipt: "開封確認", Links: "リンク", NotSaved: "保存されていません",
+		AuthChain: "認証チェーン (ARC)", ReceivedHops: "配送経路 (Received ヘッダー)", Truncated: "%d ページで切り捨て: このメッセージの残りは表示されません", EmptyBody: "このメッセージには本文がありません", RawSource: "メッセージのソース", RawSourcePartial: "%[2]s のうち先頭 %[1]s",
+	},
+	"zh": {
+		From: "发件人", To: "收件人", Cc: "抄送", Subject: "主题", Date: "日期",
+		Attachments: "附件", ImageAttachments: "图片附件",
+		RecognizedText: "识别的文本 (OCR)", JournalMetadata: "日志元数据",
+		SecurityThreat: "检测到安全威胁", MalwareDetected: "安全警报：在此附件中检测到恶意软件", SecurityAlerts: "安全警报",
+		InlineImage: "内嵌图片", Part: "第 %d 部分，共 %d 部分", Continued: "续",
+		QuotedText: "引用文本（%d 行）", DeliveryReport: "投递报告", ReadReceipt: "已读回执", Links: "链接", NotSaved: "未保存",
+		AuthChain: "认证链 (ARC)", ReceivedHops: "邮件路由 (Received 标头)", Truncated: "已在 %d 页后截断：此邮件的其余部分未显示", EmptyBody: "此邮件没有正文内容", RawSource: "邮件源代码", RawSourcePartial: "%[2]s 中的前 %[1]s",
+	},
+}
+
+// LabelsFor returns the labels for a locale such as "de" or "fr-CA"
+func LabelsFor(locale string) (Labels, error) {
+	code := strings.ToLower(strings.TrimSpace(locale))
+	if code == "" {
+		return locales["en"], nil
+	}
+	if labels, ok := locales[code]; ok {
+		return labels, nil
+	}
+
+	// Fall back from a regional variant to its language
+	language, _, _ := strings.Cut(strings.ReplaceAll(code, "_", "-"), "-")
+	if labels, ok := locales[language]; ok {
+		return labels, nil
+	}
+
+	return Labels{}, fmt.Errorf("unsupported locale %q (available: %s)", locale, strings.Join(SupportedLocales(), ", "))
+}
+
+// SupportedLocales returns the locale codes with built-in labels
+func SupportedLocales() []string {
+	codes := make([]string, 0, len(locales))
+	for code := range locales {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// forPDF returns the labels to use in the fallback renderer, whose core fonts
+// only cover Latin scripts
+func (l Labels) forPDF() Labels {
+	if l.latinOnly {
+		return l
+	}
+	return locales["en"]
+}
+
+// translateLabels converts labels to the encoding of the PDF's core fonts
+func translateLabels(pdf *gofpdf.Fpdf, l Labels) Labels {
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	return Labels{
+		From:             tr(l.From),
+		To:               tr(l.To),
+		Cc:               tr(l.Cc),
+		Subject:          tr(l.Subject),
+		Date:             tr(l.Date),
+		Attachments:      tr(l.Attachments),
+		ImageAttachments: tr(l.ImageAttachments),
+		RecognizedText:   tr(l.RecognizedText),
+		JournalMetadata:  tr(l.JournalMetadata),
+		SecurityThreat:   tr(l.SecurityThreat),
+		MalwareDetected:  tr(l.MalwareDetected),
+		SecurityAlerts:   tr(l.SecurityAlerts),
+		InlineImage:      tr(l.InlineImage),
+		Part:             tr(l.Part),
+		Continued:        tr(l.Continued),
+		QuotedText:       tr(l.QuotedText),
+		DeliveryReport:   tr(l.DeliveryReport),
+		ReadReceipt:      tr(l.ReadReceipt),
+		Links:            tr(l.Links),
+		AuthChain:        tr(l.AuthChain),
+		ReceivedHops:     tr(l.ReceivedHops),
+		Truncated:        tr(l.Truncated),
+		EmptyBody:        tr(l.EmptyBody),
+		RawSource:        tr(l.RawSource),
+		RawSourcePartial: tr(l.RawSourcePartial),
+		latinOnly:        l.latinOnly,
+	}
+}
+
+// partHeader returns the continuation header for a split PDF part
+func (l Labels) partHeader(subject string, part, parts int) string {
+	header := fmt.Sprintf(l.Part, part, parts)
+	if part > 1 {
+		header += " (" + l.Continued + ")"
+	}
+	if subject != "" {
+		header = subject + " - " + header
+	}
+	return header
+}
@@ -0,0 +1,176 @@
+package converter
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// Scripts the fallback renderer chooses fonts for
+const (
+	scriptLatin      = "latin"
+	scriptCyrillic   = "cyrillic"
+	scriptGreek      = "greek"
+	scriptHebrew     = "hebrew"
+	scriptArabic     = "arabic"
+	scriptCJK        = "cjk" // Chinese and Japanese
+	scriptHangul     = "hangul"
+	scriptThai       = "thai"
+	scriptDevanagari = "devanagari"
+)
+
+// language is the dominant script and language of a message
+type language struct {
+	Script string // One of the script constants
+	Code   string // ISO 639-1 code, e.g. "de" (empty = unknown)
+}
+
+// scriptTables are the Unicode scripts counted when detecting the script,
+// with the language assumed when only the script is known
+var scriptTables = []struct {
+	script string
+	table  *unicode.RangeTable
+	code   string
+}{
+	{scriptLatin, unicode.Latin, ""},
+	{scriptCyrillic, unicode.Cyrillic, "ru"},
+	{scriptGreek, unicode.Greek, "el"},
+	{scriptHebrew, unicode.Hebrew, "he"},
+	{scriptArabic, unicode.Arabic, "ar"},
+	{scriptCJK, unicode.Han, "zh"},
+	{scriptCJK, unicode.Hiragana, "ja"},
+	{scriptCJK, unicode.Katakana, "ja"},
+	{scriptHangul, unicode.Hangul, "ko"},
+	{scriptThai, unicode.Thai, "th"},
+	{scriptDevanagari, unicode.Devanagari, "hi"},
+}
+
+// stopWords are frequent short words that tell Latin-script languages apart
+var stopWords = map[string][]string{
+	"en": {"the", "and", "is", "to", "of", "you", "for", "with", "this", "that"},
+	"de": {"der", "die", "und", "ist", "nicht", "mit", "ich", "sie", "das", "für"},
+	"fr": {"le", "la", "les", "et", "est", "vous", "pour", "avec", "une", "des"},
+	"es": {"el", "los", "las", "y", "es", "para", "con", "una", "por", "que"},
+	"it": {"il", "gli", "e", "è", "per", "con", "una", "che", "non", "sono"},
+	"nl": {"de", "het", "een", "en", "is", "niet", "met", "voor", "van", "ik"},
+	"pt": {"os", "as", "e", "é", "para", "com", "uma", "não", "você", "que"},
+}
+
+// detectLanguage finds the dominant script of a message's subject and body,
+// and its language from the Content-Language header, the script, or common
+// words for Latin-script text
+func detectLanguage(envelope *enmime.Envelope) language {
+	text := envelope.Text
+	if text == "" && envelope.HTML != "" {
+		text = parseHTML(envelope.HTML)
+	}
+	text = envelope.GetHeader("Subject") + "\n" + text
+
+	counts := make(map[string]int)
+	codes := make(map[string]string)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for _, entry := range scriptTables {
+			if unicode.Is(entry.table, r) {
+				counts[entry.script]++
+				// Kana marks Han text as Japanese
+				if codes[entry.script] != "ja" {
+					codes[entry.script] = entry.code
+				}
+				break
+			}
+		}
+	}
+
+	detected := language{Script: scriptLatin}
+	for _, entry := range scriptTables {
+		if counts[entry.script] > counts[detected.Script] {
+			detected.Script = entry.script
+		}
+	}
+	detected.Code = codes[detected.Script]
+
+	if header := strings.ToLower(strings.TrimSpace(envelope.GetHeader("Content-Language"))); header != "" {
+		primary, _, _ := strings.Cut(strings.Split(header, ",")[0], "-")
+		detected.Code = strings.TrimSpace(primary)
+	} else if detected.Script == scriptLatin {
+		detected.Code = latinLanguage(text)
+	}
+	return detected
+}
+
+// latinLanguage guesses the language of Latin-script text from its most
+// common words, or returns "" if none of the known languages stands out
+func latinLanguage(text string) string {
+	words := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		words[word]++
+	}
+
+	best, bestScore := "", 0
+	for code, list := range stopWords {
+		score := 0
+		for _, word := range list {
+			score += words[word]
+		}
+		if score > bestScore || (score == bestScore && code < best) {
+			best, bestScore = code, score
+		}
+	}
+	if bestScore < 3 {
+		return ""
+	}
+	return best
+}
+
+// cp1252Extras are the characters of Windows-1252 outside Latin-1
+const cp1252Extras = "€‚ƒ„…†‡ˆ‰Š‹ŒŽ‘’“”•–—˜™š›œžŸ"
+
+// fitsCoreFonts reports whether the core fonts, which are Windows-1252, can
+// draw the text. Emoji are ignored, since they are drawn separately.
+func fitsCoreFonts(text string) bool {
+	for _, r := range text {
+		switch {
+		case r < 0x80, r >= 0xA0 && r <= 0xFF:
+		case isEmojiRune(r), isEmojiModifier(r), isRegionalIndicator(r):
+		case strings.ContainsRune(cp1252Extras, r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// dateLayouts are how the fallback renderer shows the Date header in each
+// language; others use ISO 8601 order
+var dateLayouts = map[string]string{
+	"en": "Mon, 02 Jan 2006 15:04:05 -0700",
+	"de": "02.01.2006 15:04:05 -0700",
+	"ru": "02.01.2006 15:04:05 -0700",
+	"fr": "02/01/2006 15:04:05 -0700",
+	"es": "02/01/2006 15:04:05 -0700",
+	"it": "02/01/2006 15:04:05 -0700",
+	"pt": "02/01/2006 15:04:05 -0700",
+	"el": "02/01/2006 15:04:05 -0700",
+	"nl": "02-01-2006 15:04:05 -0700",
+	"ja": "2006/01/02 15:04:05 -0700",
+	"zh": "2006/01/02 15:04:05 -0700",
+	"ko": "2006. 01. 02. 15:04:05 -0700",
+}
+
+// dateLayout returns the layout of dates for a language code, English when
+// the language wasn't detected
+func dateLayout(code string) string {
+	if code == "" {
+		return dateLayouts["en"]
+	}
+	if layout, ok := dateLayouts[code]; ok {
+		return layout
+	}
+	return "2006-01-02 15:04:05 -0700"
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package converter
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Longest path the Win32 API accepts without the \\?\ prefix
+const maxPath = 259
+
+// longPath returns a path longer than MAX_PATH in its \\?\ form, which the
+// external tools a PDF is handed to need to open it
+func longPath(path string) string {
+	if len(path) <= maxPath || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,188 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Table of contents lines per page of a merged PDF
+const tocLinesPerPage = 40
+
+// MergeEntry is one message in a merged PDF
+type MergeEntry struct {
+	Title string    // Subject shown in the table of contents and bookmarks
+	Date  time.Time // When the message was sent (zero = undated, sorted last)
+	PDFs  []string  // The message's PDF, or all of its parts
+}
+
+// MergeAvailable reports whether the tools needed to merge PDFs are installed
+func MergeAvailable() bool {
+	detectOptimizerTools()
+	return ghostscriptPath != ""
+}
+
+// MergePDFs concatenates the PDFs of several messages, oldest first, into one
+// document that starts with a table of contents and has a bookmark for every
+// message. It needs Ghostscript, and works in tempDir (empty = the system
+// temp directory).
+func MergePDFs(outputPath, title string, entries []MergeEntry, tempDir string) error {
+	detectOptimizerTools()
+	if ghostscriptPath == "" {
+		return fmt.Errorf("merging PDFs requires Ghostscript")
+	}
+
+	entries = append([]MergeEntry(nil), entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i].Date, entries[j].Date
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+		return a.Before(b)
+	})
+
+	workDir, err := os.MkdirTemp(tempDir, "merge-")
+	if err != nil {
+		return fmt.Errorf("failed to create merge directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	// The contents come first, so each message starts after them
+	tocPages := max(1, (len(entries)+tocLinesPerPage-1)/tocLinesPerPage)
+	startPages := make([]int, len(entries))
+	page := tocPages + 1
+	for i, entry := range entries {
+		startPages[i] = page
+		for _, pdf := range entry.PDFs {
+			pages, err := pdfPageCount(pdf)
+			if err != nil {
+				return err
+			}
+			page += pages
+		}
+	}
+
+	tocPath := filepath.Join(workDir, "contents.pdf")
+	if err := writeTableOfContents(tocPath, title, entries, startPages); err != nil {
+		return err
+	}
+
+	var marks bytes.Buffer
+	fmt.Fprintf(&marks, "[/Title %s /DOCINFO pdfmark\n", pdfmarkString(title))
+	fmt.Fprintf(&marks, "[/Title %s /Page 1 /OUT pdfmark\n", pdfmarkString("Contents"))
+	for i, entry := range entries {
+		fmt.Fprintf(&marks, "[/Title %s /Page %d /OUT pdfmark\n", pdfmarkString(mergeEntryLabel(entry)), startPages[i])
+	}
+	marksPath := filepath.Join(workDir, "bookmarks.ps")
+	if err := os.WriteFile(marksPath, marks.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write bookmarks: %w", err)
+	}
+
+	// Arguments go in a file, as a folder can hold more PDFs than a command line
+	tmpPath := outputPath + ".tmp"
+	args := []string{"-sDEVICE=pdfwrite", "-dNOPAUSE", "-dBATCH", "-dQUIET", "-sOutputFile=" + tmpPath, tocPath}
+	for _, entry := range entries {
+		args = append(args, entry.PDFs...)
+	}
+	args = append(args, marksPath)
+	var argFile bytes.Buffer
+	for _, arg := range args {
+		argFile.WriteString(`"` + arg + "\"\n")
+	}
+	argPath := filepath.Join(workDir, "args")
+	if err := os.WriteFile(argPath, argFile.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write merge arguments: %w", err)
+	}
+
+	if err := runTool(ghostscriptPath, "@"+argPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, outputPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write merged pdf: %w", err)
+	}
+	return nil
+}
+
+// writeTableOfContents draws the contents pages of a merged PDF
+func writeTableOfContents(path, title string, entries []MergeEntry, startPages []int) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetAutoPageBreak(false, 0)
+
+	for i, entry := range entries {
+		if i%tocLinesPerPage == 0 {
+			pdf.AddPage()
+			pdf.SetFont("Arial", "B", 14)
+			pdf.CellFormat(0, 10, tr(title), "", 1, "L", false, 0, "")
+			pdf.SetFont("Arial", "", 9)
+		}
+		label := tr(mergeEntryLabel(entry))
+		for pdf.GetStringWidth(label) > 160 && len(label) > 1 {
+			label = label[:len(label)-1]
+		}
+		pdf.CellFormat(170, 6, label, "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 6, strconv.Itoa(startPages[i]), "", 1, "R", false, 0, "")
+	}
+	if len(entries) == 0 {
+		pdf.AddPage()
+	}
+
+	if err := pdf.OutputFileAndClose(path); err != nil {
+		return fmt.Errorf("failed to write table of contents: %w", err)
+	}
+	return nil
+}
+
+// mergeEntryLabel returns the line shown for a message in the contents and bookmarks
+func mergeEntryLabel(entry MergeEntry) string {
+	date := "undated"
+	if !entry.Date.IsZero() {
+		date = entry.Date.Format("2006-01-02 15:04")
+	}
+	title := strings.TrimSpace(entry.Title)
+	if title == "" {
+		title = "(no subject)"
+	}
+	return date + "  " + title
+}
+
+// pdfmarkString encodes text as a UTF-16 hex string, which pdfmark accepts for
+// any script
+func pdfmarkString(text string) string {
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(&b, "%04X", unit)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// pdfPageCount returns the number of pages in a PDF, asking qpdf when it is
+// installed since compressed object streams hide page objects from a scan
+func pdfPageCount(path string) (int, error) {
+	if qpdfPath != "" {
+		output, err := exec.Command(qpdfPath, "--show-npages", path).Output()
+		if err == nil {
+			if pages, err := strconv.Atoi(strings.TrimSpace(string(output))); err == nil {
+				return pages, nil
+			}
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return countPDFPages(data), nil
+}
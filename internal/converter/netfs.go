@@ -0,0 +1,196 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Defaults of the retry policy for transient file errors
+const (
+	defaultIOAttempts = 3
+	defaultIOBackoff  = 100 * time.Millisecond
+)
+
+// isTransientIOError reports whether a file error is one network shares
+// raise while a server fails over or a handle goes stale, rather than one
+// that a retry can't fix
+func isTransientIOError(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	for _, transient := range transientErrnos {
+		if errno == transient {
+			return true
+		}
+	}
+	return false
+}
+
+// retryIO runs a file operation, running it again after a growing delay while
+// it fails with a transient error, as often as the config's IORetry allows.
+// The operation must be safe to repeat.
+func (f fileIO) retryIO(op func() error) error {
+	delay := f.backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = op(); err == nil || attempt >= f.attempts || !isTransientIOError(err) {
+			return err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// openRetry opens a file for reading, retrying transient errors
+func (f fileIO) openRetry(path string) (*os.File, error) {
+	var file *os.File
+	err := f.retryIO(func() (err error) {
+		file, err = os.Open(path)
+		return err
+	})
+	return file, err
+}
+
+// writeFileRetry writes a file whole, retrying transient errors
+func (f fileIO) writeFileRetry(path string, data []byte, perm os.FileMode) error {
+	return f.retryIO(func() error {
+		return os.WriteFile(path, data, perm)
+	})
+}
+
+// removeRetry removes a file, retrying transient errors
+func (f fileIO) removeRetry(path string) error {
+	return f.retryIO(func() error {
+		return os.Remove(path)
+	})
+}
+
+// mkdirAllRetry creates a directory and its parents, retrying transient errors
+func (f fileIO) mkdirAllRetry(dir string) error {
+	return f.retryIO(func() error {
+		return os.MkdirAll(dir, 0755)
+	})
+}
+
+// renameRetry renames a file, retrying transient errors. A rename that
+// reached the server before its reply was lost fails again with the source
+// missing, so that counts as done once the target exists.
+func (f fileIO) renameRetry(from, to string) error {
+	return f.retryIO(func() error {
+		err := os.Rename(from, to)
+		if errors.Is(err, fs.ErrNotExist) {
+			if _, statErr := os.Stat(to); statErr == nil {
+				return nil
+			}
+		}
+		return err
+	})
+}
+
+// uniqueCandidate returns the nth alternative of a path, e.g. "report_2.pdf"
+// for "report.pdf" (0 = the path itself)
+func uniqueCandidate(path string, n int) string {
+	if n == 0 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// createUnique creates a new file at path, or at the first numbered
+// alternative that doesn't exist yet. Creation is exclusive (O_EXCL), so two
+// workers, or two hosts sharing a network filesystem whose directory listings
+// lag, can't both claim a name that a check before writing saw as free.
+func createUnique(path string, perm os.FileMode) (*os.File, error) {
+	for n := 0; ; n++ {
+		file, err := os.OpenFile(uniqueCandidate(path, n), os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if !errors.Is(err, fs.ErrExist) {
+			return file, err
+		}
+	}
+}
+
+// claimUnique claims a name for an output by creating an empty file at path,
+// or at the first numbered alternative that is free, and returns the path
+// claimed with the file's identity for releaseClaim. A name whose numbered
+// parts another conversion has written counts as taken, too.
+func (f fileIO) claimUnique(path string) (string, os.FileInfo, error) {
+	for n := 0; ; n++ {
+		candidate := uniqueCandidate(path, n)
+		var claim os.FileInfo
+		err := f.retryIO(func() error {
+			file, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			claim, err = file.Stat()
+			return err
+		})
+		switch {
+		case errors.Is(err, fs.ErrExist):
+			continue
+		case err != nil:
+			return "", nil, err
+		}
+		if _, err := os.Stat(partPath(candidate, 1)); err == nil {
+			os.Remove(candidate)
+			continue
+		}
+		return candidate, claim, nil
+	}
+}
+
+// releaseClaim removes a file claimUnique created, unless it has since been
+// replaced by another conversion's
+func releaseClaim(path string, claim os.FileInfo) {
+	if info, err := os.Stat(path); err == nil && os.SameFile(info, claim) {
+		os.Remove(path)
+	}
+}
+
+// writeUnique streams content to a new file at path or a numbered
+// alternative, flushed according to the fsync policy, returning the path
+// written. A write that fails transiently is removed and written again.
+func (f fileIO) writeUnique(path string, content []byte, perm os.FileMode, policy string) (string, error) {
+	var written string
+	err := f.retryIO(func() error {
+		release := f.openSlot()
+		defer release()
+		file, err := createUnique(path, perm)
+		if err != nil {
+			return err
+		}
+		if err := f.writeContent(file, content, policy); err != nil {
+			return err
+		}
+		written = file.Name()
+		return nil
+	})
+	return written, err
+}
+
+// linkUnique hard links a stored object to path or a numbered alternative,
+// returning the path linked. Where links aren't possible, e.g. across
+// filesystems, the content is written instead.
+func (f fileIO) linkUnique(stored, path string, content []byte, policy string) (string, error) {
+	for n := 0; ; n++ {
+		candidate := uniqueCandidate(path, n)
+		err := f.retryIO(func() error {
+			return os.Link(stored, candidate)
+		})
+		switch {
+		case err == nil:
+			return candidate, nil
+		case !errors.Is(err, fs.ErrExist):
+			return f.writeUnique(path, content, 0644, policy)
+		}
+	}
+}
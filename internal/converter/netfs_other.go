@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || windows)
+
+package converter
+
+import "syscall"
+
+// transientErrnos are not known on this platform, so nothing is retried
+var transientErrnos []syscall.Errno
@@ -0,0 +1,9 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package converter
+
+import "syscall"
+
+// transientErrnos are the errors NFS and SMB mounts return while a file
+// handle goes stale, the server fails over or the connection drops
+var transientErrnos = []syscall.Errno{syscall.ESTALE, syscall.ETIMEDOUT, syscall.EINTR, syscall.EIO, syscall.EAGAIN}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package converter
+
+import "syscall"
+
+// transientErrnos are the errors SMB shares return while the connection to
+// the server drops or another client briefly holds a file
+var transientErrnos = []syscall.Errno{
+	32,  // ERROR_SHARING_VIOLATION
+	33,  // ERROR_LOCK_VIOLATION
+	59,  // ERROR_UNEXP_NET_ERR
+	64,  // ERROR_NETNAME_DELETED
+	121, // ERROR_SEM_TIMEOUT
+}
@@ -0,0 +1,130 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+var (
+	// Tool availability is checked once per run
+	optimizerToolsOnce sync.Once
+	ghostscriptPath    string
+	qpdfPath           string
+)
+
+// detectOptimizerTools looks for Ghostscript and qpdf in the PATH
+func detectOptimizerTools() {
+	optimizerToolsOnce.Do(func() {
+		for _, name := range []string{"gs", "gswin64c", "gswin32c"} {
+			if path, err := exec.LookPath(name); err == nil {
+				ghostscriptPath = path
+				break
+			}
+		}
+		if path, err := exec.LookPath("qpdf"); err == nil {
+			qpdfPath = path
+		}
+	})
+}
+
+// OptimizerAvailable reports whether any PDF optimization tool is installed
+func OptimizerAvailable() bool {
+	detectOptimizerTools()
+	return ghostscriptPath != "" || qpdfPath != ""
+}
+
+// optimizePDF downsamples images, removes duplicate objects and linearizes a PDF in place.
+// Ghostscript drops the structure tree, so tagged PDFs are only linearized.
+// It returns the number of bytes saved.
+func optimizePDF(pdfPath string, imageDPI int, tagged bool) (int64, error) {
+	detectOptimizerTools()
+
+	info, err := os.Stat(pdfPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat pdf for optimization: %w", err)
+	}
+	originalSize := info.Size()
+
+	// Ghostscript rewrites the file, downsampling images and merging duplicate images
+	if ghostscriptPath != "" && !tagged {
+		tmpPath := pdfPath + ".gs.tmp"
+		args := []string{
+			"-sDEVICE=pdfwrite",
+			"-dCompatibilityLevel=1.5",
+			"-dNOPAUSE", "-dBATCH", "-dQUIET", "-dSAFER",
+			"-dDetectDuplicateImages=true",
+			"-dCompressFonts=true",
+			"-dDownsampleColorImages=true",
+			"-dDownsampleGrayImages=true",
+			"-dDownsampleMonoImages=true",
+			fmt.Sprintf("-dColorImageResolution=%d", imageDPI),
+			fmt.Sprintf("-dGrayImageResolution=%d", imageDPI),
+			fmt.Sprintf("-dMonoImageResolution=%d", imageDPI*2),
+			"-sOutputFile=" + tmpPath,
+			pdfPath,
+		}
+		if err := runTool(ghostscriptPath, args...); err != nil {
+			os.Remove(tmpPath)
+			return 0, err
+		}
+		if err := replaceIfSmaller(tmpPath, pdfPath); err != nil {
+			return 0, err
+		}
+	}
+
+	// qpdf packs objects into streams and linearizes for fast web view
+	if qpdfPath != "" {
+		tmpPath := pdfPath + ".qpdf.tmp"
+		if err := runTool(qpdfPath, "--warning-exit-0", "--linearize", "--object-streams=generate", "--compress-streams=y", pdfPath, tmpPath); err != nil {
+			os.Remove(tmpPath)
+			return 0, err
+		}
+		// Linearized output is kept even if slightly larger
+		if err := os.Rename(tmpPath, pdfPath); err != nil {
+			os.Remove(tmpPath)
+			return 0, fmt.Errorf("failed to replace pdf with linearized copy: %w", err)
+		}
+	}
+
+	info, err = os.Stat(pdfPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat optimized pdf: %w", err)
+	}
+	return originalSize - info.Size(), nil
+}
+
+// replaceIfSmaller moves src over dst if it is smaller, otherwise discards it
+func replaceIfSmaller(src, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to stat optimized pdf: %w", err)
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return fmt.Errorf("failed to stat original pdf: %w", err)
+	}
+
+	if srcInfo.Size() == 0 || srcInfo.Size() >= dstInfo.Size() {
+		return os.Remove(src)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		os.Remove(src)
+		return fmt.Errorf("failed to replace pdf with optimized copy: %w", err)
+	}
+	return nil
+}
+
+// runTool runs an external command, including its stderr in any error
+func runTool(path string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
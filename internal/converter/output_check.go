@@ -0,0 +1,240 @@
+package converter
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"emil/internal/models"
+	"emil/internal/security"
+)
+
+// Most bytes an object stream is inflated to while checking a PDF
+const maxObjectStreamBytes = 64 * 1024 * 1024
+
+// activeContent describes the PDF names that make a PDF run code, submit
+// data or carry files. None of emil's renderers write them, so one in an
+// output means the message smuggled it through the renderer. An embedded
+// file is found by its file specification's /EF entry rather than the
+// catalog's /EmbeddedFiles name tree, which gofpdf writes, empty, into
+// every PDF.
+var activeContent = map[string]string{
+	"JavaScript":   "JavaScript",
+	"JS":           "JavaScript",
+	"Launch":       "a launch action",
+	"SubmitForm":   "a form submission action",
+	"ImportData":   "an import data action",
+	"GoToE":        "a link into an embedded file",
+	"RichMedia":    "rich media",
+	"EF":           "an embedded file",
+	"EmbeddedFile": "an embedded file",
+	"XFA":          "an XFA form",
+}
+
+// checkOutputs checks the PDFs a message was converted to for active
+// content and, when the scanner is on, for malware, returning an alert for
+// each finding. A PDF that can't be read or scanned raises a warning, since
+// it can't be counted as clean.
+func checkOutputs(paths []string, scanner *security.Scanner) []models.SecurityAlert {
+	var alerts []models.SecurityAlert
+	for _, path := range paths {
+		name := filepath.Base(path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			alerts = append(alerts, models.SecurityAlert{
+				Severity: models.SeverityWarning,
+				Message:  fmt.Sprintf("PDF %s could not be checked: %v", name, err),
+			})
+			continue
+		}
+
+		for _, what := range pdfActiveContent(data) {
+			alerts = append(alerts, models.SecurityAlert{
+				Severity: models.SeverityCritical,
+				Message:  fmt.Sprintf("PDF %s contains %s", name, what),
+			})
+		}
+
+		if scanner == nil || !scanner.IsEnabled() {
+			continue
+		}
+		scan, err := scanner.ScanBytes(data)
+		if err != nil {
+			alerts = append(alerts, models.SecurityAlert{
+				Severity: models.SeverityWarning,
+				Message:  fmt.Sprintf("PDF %s could not be scanned: %v", name, err),
+			})
+			continue
+		}
+		sum := sha256.Sum256(data)
+		for _, threat := range scan.Threats {
+			alerts = append(alerts, models.SecurityAlert{
+				Severity: models.SeverityCritical,
+				Message:  fmt.Sprintf("Security threat in PDF %s: %s", name, threat),
+				Threat:   threat,
+				SHA256:   hex.EncodeToString(sum[:]),
+			})
+		}
+	}
+	return alerts
+}
+
+// pdfActiveContent returns the kinds of active content a PDF holds. It
+// walks the PDF's tokens rather than searching its bytes, so text that only
+// mentions JavaScript doesn't count: names are compared with their #xx
+// escapes decoded, strings, comments and stream data are skipped, and
+// compressed object streams, where optimizers move dictionaries, are
+// inflated and walked too.
+func pdfActiveContent(data []byte) []string {
+	var found []string
+	seen := make(map[string]bool)
+
+	var walk func(data []byte)
+	walk = func(data []byte) {
+		// Offset of the outermost dictionary since the last stream, which is
+		// the next stream's (-1 for none), and nesting
+		dict, depth := -1, 0
+		for i := 0; i < len(data); {
+			switch c := data[i]; {
+			case c == '%':
+				for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+					i++
+				}
+			case c == '(':
+				i = skipPDFString(data, i)
+			case c == '<' && i+1 < len(data) && data[i+1] == '<':
+				if depth == 0 {
+					dict = i
+				}
+				depth++
+				i += 2
+			case c == '>' && i+1 < len(data) && data[i+1] == '>':
+				depth = max(depth-1, 0)
+				i += 2
+			case c == '<':
+				for i < len(data) && data[i] != '>' {
+					i++
+				}
+				i++
+			case c == '/':
+				name, next := readPDFName(data, i+1)
+				if what, ok := activeContent[name]; ok && !seen[what] {
+					seen[what] = true
+					found = append(found, what)
+				}
+				i = next
+			case isStreamKeyword(data, i):
+				start := i + len("stream")
+				if start < len(data) && data[start] == '\r' {
+					start++
+				}
+				if start < len(data) && data[start] == '\n' {
+					start++
+				}
+				end := bytes.Index(data[start:], []byte("endstream"))
+				if end < 0 {
+					return
+				}
+				if dict >= 0 {
+					header := data[dict:i]
+					if bytes.Contains(header, []byte("/ObjStm")) && bytes.Contains(header, []byte("/FlateDecode")) {
+						walk(inflateObjectStream(data[start : start+end]))
+					}
+				}
+				dict = -1
+				i = start + end + len("endstream")
+			default:
+				i++
+			}
+		}
+	}
+	walk(data)
+	return found
+}
+
+// isStreamKeyword reports whether the stream keyword, which starts a
+// stream's data, is at offset i
+func isStreamKeyword(data []byte, i int) bool {
+	if !bytes.HasPrefix(data[i:], []byte("stream")) {
+		return false
+	}
+	if i > 0 && !isPDFWhitespace(data[i-1]) && data[i-1] != '>' {
+		return false
+	}
+	next := i + len("stream")
+	return next < len(data) && (data[next] == '\r' || data[next] == '\n')
+}
+
+// skipPDFString returns the offset after the literal string starting at i,
+// which may nest balanced parentheses and escape any character
+func skipPDFString(data []byte, i int) int {
+	depth := 0
+	for ; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return i
+}
+
+// readPDFName reads the name starting at i, after its slash, and returns it
+// with #xx escapes decoded and the offset after it
+func readPDFName(data []byte, i int) (string, int) {
+	var name []byte
+	for ; i < len(data) && !isPDFWhitespace(data[i]) && !isPDFDelimiter(data[i]); i++ {
+		if data[i] == '#' && i+2 < len(data) {
+			if b, err := strconv.ParseUint(string(data[i+1:i+3]), 16, 8); err == nil {
+				name = append(name, byte(b))
+				i += 2
+				continue
+			}
+		}
+		name = append(name, data[i])
+	}
+	return string(name), i
+}
+
+// isPDFWhitespace reports whether c separates PDF tokens
+func isPDFWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+// isPDFDelimiter reports whether c ends a PDF name
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// inflateObjectStream decompresses an object stream, up to
+// maxObjectStreamBytes. A damaged stream gives what could be inflated
+// before the damage.
+func inflateObjectStream(stream []byte) []byte {
+	r, err := zlib.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	objects, _ := io.ReadAll(io.LimitReader(r, maxObjectStreamBytes))
+	return objects
+}
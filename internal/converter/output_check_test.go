@@ -0,0 +1,124 @@
+package converter
+
+import (
+	"bytes"
+	"compress/zlib"
+	"slices"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// deflate compresses data as a FlateDecode stream holds it
+func deflate(data string) string {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte(data))
+	w.Close()
+	return buf.String()
+}
+
+// objectStream returns a PDF object holding objects in a compressed object
+// stream
+func objectStream(objects string) string {
+	return "1 0 obj\n<< /Type /ObjStm /N 1 /First 4 /Filter /FlateDecode >>\nstream\n" +
+		deflate(objects) + "\nendstream\nendobj\n"
+}
+
+func TestPDFActiveContent(t *testing.T) {
+	tests := []struct {
+		name string
+		pdf  string
+		want []string
+	}{
+		{
+			name: "action",
+			pdf:  "1 0 obj\n<< /Type /Action /S /JavaScript /JS (app.alert(1)) >>\nendobj\n",
+			want: []string{"JavaScript"},
+		},
+		{
+			name: "escaped name",
+			pdf:  "1 0 obj\n<< /S /J#61vaScript >>\nendobj\n",
+			want: []string{"JavaScript"},
+		},
+		{
+			name: "launch and embedded file",
+			pdf:  "1 0 obj\n<< /S /Launch /F << /Type /EmbeddedFile >> >>\nendobj\n",
+			want: []string{"a launch action", "an embedded file"},
+		},
+		{
+			name: "file specification",
+			pdf:  "1 0 obj\n<< /Type /Filespec /F (a.exe) /EF << /F 2 0 R >> >>\nendobj\n",
+			want: []string{"an embedded file"},
+		},
+		{
+			name: "empty embedded files name tree",
+			pdf:  "1 0 obj\n<< /Type /Catalog /Names << /EmbeddedFiles << /Names [ ] >> >> >>\nendobj\n",
+		},
+		{
+			name: "name in a string",
+			pdf:  "1 0 obj\n<< /Title (About /JavaScript and /JS \\(nested /Launch\\)) >>\nendobj\n",
+		},
+		{
+			name: "name in a hex string",
+			pdf:  "1 0 obj\n<< /Title <2F4A53> >>\nendobj\n",
+		},
+		{
+			name: "name in a comment",
+			pdf:  "%PDF-1.7\n% /JavaScript /JS\n1 0 obj\n<< /Type /Catalog >>\nendobj\n",
+		},
+		{
+			name: "name in stream data",
+			pdf:  "1 0 obj\n<< /Length 20 >>\nstream\nBT (x) Tj ET /JS /Launch\nendstream\nendobj\n",
+		},
+		{
+			name: "name in an object stream",
+			pdf:  objectStream("2 0 << /S /JavaScript /JS (app.alert(1)) >>"),
+			want: []string{"JavaScript"},
+		},
+		{
+			name: "escaped name in an object stream",
+			pdf:  objectStream("2 0 << /S /#4A#53 >>"),
+			want: []string{"JavaScript"},
+		},
+		{
+			// The object stream's dictionary doesn't carry over to a later
+			// stream, so that stream isn't inflated
+			name: "stream after an object stream",
+			pdf:  objectStream("2 0 << /Type /Page >>") + "3 0 obj\nstream\n" + deflate("/JS (x)") + "\nendstream\nendobj\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pdfActiveContent([]byte(tt.pdf)); !slices.Equal(got, tt.want) {
+				t.Errorf("pdfActiveContent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDFActiveContentOfGofpdfOutput(t *testing.T) {
+	render := func(attachments []gofpdf.Attachment) []byte {
+		pdf := gofpdf.New("P", "mm", "A4", "")
+		pdf.SetTitle("JavaScript and /JS", false)
+		pdf.SetAttachments(attachments)
+		pdf.AddPage()
+		pdf.SetFont("Helvetica", "", 12)
+		pdf.Cell(0, 10, "Mentions of /JavaScript, /Launch and /EmbeddedFile are only text")
+		pdf.Link(10, 10, 50, 10, pdf.AddLink())
+		var out bytes.Buffer
+		if err := pdf.Output(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out.Bytes()
+	}
+
+	if got := pdfActiveContent(render(nil)); len(got) != 0 {
+		t.Errorf("pdfActiveContent of a clean PDF = %q, want none", got)
+	}
+	attached := render([]gofpdf.Attachment{{Content: []byte("MZ"), Filename: "a.exe"}})
+	if got, want := pdfActiveContent(attached), []string{"an embedded file"}; !slices.Equal(got, want) {
+		t.Errorf("pdfActiveContent of a PDF with an attachment = %q, want %q", got, want)
+	}
+}
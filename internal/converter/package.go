@@ -0,0 +1,127 @@
+package converter
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// packageMetadata is the metadata.json written into each package
+type packageMetadata struct {
+	messageRecord
+	Files []string `json:"files"` // Entries of the archive
+}
+
+// packagePath returns where the package of a PDF is written
+func packagePath(pdfPath string) string {
+	return strings.TrimSuffix(pdfPath, ".pdf") + ".zip"
+}
+
+// writePackage bundles the PDF files, saved attachments, raw EML and a
+// metadata.json into one ZIP beside the PDF, for handing a record over as a
+// single file. Infected attachments are left out and only listed.
+func writePackage(emlPath string, envelope *enmime.Envelope, result *ConversionResult, files fileIO) (string, error) {
+	path := packagePath(result.OutputPath)
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create package: %w", err)
+	}
+	defer os.Remove(tmpPath)
+
+	archive := zip.NewWriter(file)
+	meta := packageMetadata{messageRecord: buildRecord(emlPath, envelope, result)}
+
+	add := func(name, source string) error {
+		if err := addToPackage(archive, name, source); err != nil {
+			return fmt.Errorf("failed to add %s to package: %w", name, err)
+		}
+		return nil
+	}
+
+	for _, pdf := range result.outputFiles() {
+		if err := add(filepath.Base(pdf), pdf); err != nil {
+			file.Close()
+			return "", err
+		}
+		meta.Files = append(meta.Files, filepath.Base(pdf))
+	}
+	if err := add(filepath.Base(emlPath), emlPath); err != nil {
+		file.Close()
+		return "", err
+	}
+	meta.Files = append(meta.Files, filepath.Base(emlPath))
+	names := make(map[string]bool)
+	for _, att := range result.Attachments {
+		if att.SavedPath == "" || (att.ScanResult != nil && att.ScanResult.Infected) {
+			continue
+		}
+		// Attachments may share a name, but entries in the archive may not
+		name := "attachments/" + att.Filename
+		for n := 1; names[name]; n++ {
+			ext := filepath.Ext(att.Filename)
+			name = fmt.Sprintf("attachments/%s_%d%s", strings.TrimSuffix(att.Filename, ext), n, ext)
+		}
+		names[name] = true
+		if err := add(name, att.SavedPath); err != nil {
+			file.Close()
+			return "", err
+		}
+		meta.Files = append(meta.Files, name)
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err == nil {
+		var writer io.Writer
+		if writer, err = archive.Create("metadata.json"); err == nil {
+			_, err = writer.Write(data)
+		}
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write package: %w", err)
+	}
+
+	if err := files.renameRetry(tmpPath, path); err != nil {
+		return "", fmt.Errorf("failed to write package: %w", err)
+	}
+	return path, nil
+}
+
+// addToPackage copies a file into the archive under the given name
+func addToPackage(archive *zip.Writer, name, source string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	writer, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, file)
+	return err
+}
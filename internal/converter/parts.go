@@ -0,0 +1,147 @@
+package converter
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// commonExtensions names the types the system's list gives several
+// extensions for, e.g. .jfif and .jpe before .jpg
+var commonExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/tiff": ".tif",
+}
+
+// cidPattern matches the Content-ID references in an HTML body, in img src
+// attributes as well as CSS url() values
+var cidPattern = regexp.MustCompile(`(?i)\bcid:([^"'\s<>()]+)`)
+
+// classifyParts corrects enmime's split of a message's parts into
+// attachments and inline parts, which follows the Content-Disposition
+// headers that mail clients set inconsistently:
+//
+//   - Parts the HTML body refers to by Content-ID are inline, even with an
+//     attachment disposition, as signature images often have
+//   - Parts in both lists, which enmime makes of inline octet-stream parts,
+//     are kept in one
+//   - Inline parts the body doesn't show are attachments if they are
+//     documents, or images of at least imageBytes (0 = never); smaller
+//     images are logos and spacers
+//
+// Text parts stay where they are, since enmime reads the body from them.
+func classifyParts(envelope *enmime.Envelope, imageBytes int64) {
+	referenced := referencedContentIDs(envelope.HTML)
+	isReferenced := func(part *enmime.Part) bool {
+		cid := strings.Trim(part.ContentID, "<>")
+		return cid != "" && referenced[cid]
+	}
+
+	var attachments, inlines []*enmime.Part
+	for _, part := range envelope.Attachments {
+		if isReferenced(part) {
+			if !slices.Contains(envelope.Inlines, part) {
+				inlines = append(inlines, part)
+			}
+			continue
+		}
+		attachments = append(attachments, part)
+	}
+
+	for _, part := range envelope.Inlines {
+		if slices.Contains(envelope.Attachments, part) {
+			if isReferenced(part) {
+				inlines = append(inlines, part)
+			}
+			continue
+		}
+		if !isReferenced(part) && unreferencedAttachment(part, imageBytes) {
+			attachments = append(attachments, part)
+			continue
+		}
+		inlines = append(inlines, part)
+	}
+
+	// Parts without a disposition are shown inline, unless they're documents
+	var others []*enmime.Part
+	for _, part := range envelope.OtherParts {
+		if !isReferenced(part) && part.FileName != "" && unreferencedAttachment(part, imageBytes) {
+			attachments = append(attachments, part)
+			continue
+		}
+		others = append(others, part)
+	}
+
+	envelope.Attachments, envelope.Inlines, envelope.OtherParts = attachments, inlines, others
+}
+
+// unreferencedAttachment reports whether an inline part the body doesn't
+// show is really an attachment
+func unreferencedAttachment(part *enmime.Part, imageBytes int64) bool {
+	contentType := strings.ToLower(part.ContentType)
+	switch {
+	case strings.HasPrefix(contentType, "text/"), strings.HasPrefix(contentType, "multipart/"):
+		return false
+	case strings.HasPrefix(contentType, "image/"):
+		return imageBytes > 0 && int64(len(part.Content)) >= imageBytes
+	}
+	return len(part.Content) > 0
+}
+
+// referencedContentIDs returns the Content-IDs an HTML body refers to
+func referencedContentIDs(body string) map[string]bool {
+	referenced := make(map[string]bool)
+	for _, match := range cidPattern.FindAllStringSubmatch(body, -1) {
+		cid := match[1]
+		if unescaped, err := url.PathUnescape(cid); err == nil {
+			cid = unescaped
+		}
+		referenced[cid] = true
+	}
+	return referenced
+}
+
+// inlineParts returns the inline parts that can be saved beside the
+// attachments, leaving out the text parts the body is read from
+func inlineParts(envelope *enmime.Envelope) []*enmime.Part {
+	var parts []*enmime.Part
+	for _, part := range slices.Concat(envelope.Inlines, envelope.OtherParts) {
+		contentType := strings.ToLower(part.ContentType)
+		if len(part.Content) == 0 || strings.HasPrefix(contentType, "text/") || strings.HasPrefix(contentType, "multipart/") {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// partFilename names a part that has no file name of its own, numbering it
+// and taking the extension from its content type
+func partFilename(part *enmime.Part, n int) string {
+	if part.FileName != "" {
+		return part.FileName
+	}
+	ext, ok := commonExtensions[strings.ToLower(part.ContentType)]
+	if !ok {
+		ext = ".bin"
+		if exts, _ := mime.ExtensionsByType(part.ContentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return fmt.Sprintf("inline-%d%s", n, ext)
+}
+
+// listedAttachments returns the attachments listed in the PDF, leaving out
+// the inline parts saved with them, which the body already shows
+func listedAttachments(results []AttachmentResult) []AttachmentResult {
+	return slices.DeleteFunc(slices.Clone(results), func(att AttachmentResult) bool {
+		return att.Inline
+	})
+}
@@ -0,0 +1,58 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Longest file name most filesystems accept, in bytes
+const maxNameBytes = 255
+
+// Longest extension kept when a name is shortened
+const maxExtBytes = 16
+
+// Device names Windows reserves in every directory, with or without an extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// portableName rewrites a file name Windows can't create, such as CON.txt, and
+// shortens names too long for the filesystem, keeping the extension and
+// adding a hash of the full name so shortened names stay distinct. Archives
+// are often copied between systems, so this applies on every platform.
+func portableName(name string) string {
+	stem, rest, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		name = stem + "_"
+		if rest != "" {
+			name += "." + rest
+		}
+	}
+
+	if len(name) <= maxNameBytes {
+		return name
+	}
+	ext := filepath.Ext(name)
+	if len(ext) > maxExtBytes {
+		ext = ""
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := "_" + hex.EncodeToString(sum[:4]) + ext
+	return truncateUTF8(strings.TrimSuffix(name, ext), maxNameBytes-len(suffix)) + suffix
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,190 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// pageObjectPattern matches page objects (but not the /Pages tree) in a PDF
+var pageObjectPattern = regexp.MustCompile(`/Type\s*/Page[^s]`)
+
+// splitLimits describes the largest PDF a single output file may be
+type splitLimits struct {
+	MaxBytes int64 // 0 means unlimited
+	MaxPages int   // 0 means unlimited
+}
+
+// enabled reports whether any limit is set
+func (l splitLimits) enabled() bool {
+	return l.MaxBytes > 0 || l.MaxPages > 0
+}
+
+// exceeded reports whether a document of the given size breaks a limit
+func (l splitLimits) exceeded(pages int, size int64) bool {
+	return (l.MaxPages > 0 && pages > l.MaxPages) || (l.MaxBytes > 0 && size > l.MaxBytes)
+}
+
+// pagesPerPart returns how many pages each part should hold so no part breaks a limit
+func (l splitLimits) pagesPerPart(pages int, size int64) int {
+	perPart := pages
+	if l.MaxPages > 0 && perPart > l.MaxPages {
+		perPart = l.MaxPages
+	}
+	if l.MaxBytes > 0 && size > l.MaxBytes && pages > 0 {
+		// Assume bytes are spread evenly across pages
+		bySize := int(int64(pages) * l.MaxBytes / size)
+		if bySize < perPart {
+			perPart = bySize
+		}
+	}
+	return max(1, perPart)
+}
+
+// countPDFPages estimates the number of pages in a rendered PDF
+func countPDFPages(data []byte) int {
+	return max(1, len(pageObjectPattern.FindAllIndex(data, -1)))
+}
+
+// partPath returns the output path of a numbered part, e.g. mail_part2.pdf
+func partPath(pdfPath string, part int) string {
+	return fmt.Sprintf("%s_part%d.pdf", strings.TrimSuffix(pdfPath, ".pdf"), part)
+}
+
+// renderPart renders pages first to last (counted from 1) of a document as
+// part of parts
+type renderPart func(first, last, part, parts int) ([]byte, error)
+
+// splitPages renders a document of pages pages as numbered parts that keep
+// within the limits. Parts start with an even share of the pages, but bytes
+// aren't spread evenly across pages, so a part that comes out over MaxBytes
+// is halved and the parts are rendered again, renumbered, until each fits or
+// holds a single page.
+func splitPages(pages int, size int64, limits splitLimits, render renderPart) ([][]byte, error) {
+	perPart := limits.pagesPerPart(pages, size)
+	var ranges [][2]int
+	for first := 1; first <= pages; first += perPart {
+		ranges = append(ranges, [2]int{first, min(first+perPart-1, pages)})
+	}
+
+	for {
+		parts := make([][]byte, len(ranges))
+		var halved [][2]int
+		oversized := false
+		for i, pageRange := range ranges {
+			data, err := render(pageRange[0], pageRange[1], i+1, len(ranges))
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate PDF part %d: %w", i+1, err)
+			}
+			parts[i] = data
+
+			first, last := pageRange[0], pageRange[1]
+			if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes && last > first {
+				middle := (first + last) / 2
+				halved = append(halved, [2]int{first, middle}, [2]int{middle + 1, last})
+				oversized = true
+			} else {
+				halved = append(halved, pageRange)
+			}
+		}
+		if !oversized {
+			return parts, nil
+		}
+		ranges = halved
+	}
+}
+
+// writeParts writes a document's parts: a single part as pdfPath, several as
+// numbered part files. Outputs an earlier conversion left that this one
+// didn't write over, the whole PDF or parts past the last, are removed so
+// they can't be taken for this conversion's.
+func writeParts(pdfPath string, parts [][]byte, files fileIO) ([]string, error) {
+	if len(parts) == 1 {
+		if err := files.writeFileRetry(pdfPath, parts[0], 0644); err != nil {
+			return nil, fmt.Errorf("failed to write PDF file: %w", err)
+		}
+		files.removeParts(pdfPath, 1)
+		return []string{pdfPath}, nil
+	}
+
+	var paths []string
+	for i, data := range parts {
+		path := partPath(pdfPath, i+1)
+		if err := files.writeFileRetry(path, data, 0644); err != nil {
+			return paths, fmt.Errorf("failed to write PDF part %d: %w", i+1, err)
+		}
+		paths = append(paths, path)
+	}
+	files.removeRetry(pdfPath)
+	files.removeParts(pdfPath, len(parts)+1)
+	return paths, nil
+}
+
+// removeParts removes the numbered parts of pdfPath from part from on
+func (f fileIO) removeParts(pdfPath string, from int) {
+	for part := from; ; part++ {
+		if err := f.removeRetry(partPath(pdfPath, part)); err != nil {
+			return
+		}
+	}
+}
+
+// splitBasicPDF renders the fallback document once into a template and writes
+// it out whole, or as numbered parts if it breaks the limits, returning the
+// paths of the files written
+func splitBasicPDF(draw func(pdf *gofpdf.Fpdf), subject string, labels Labels, limits splitLimits, pdfPath string, files fileIO) ([]string, error) {
+	// Draw the whole document into a multi-page template. The continuation
+	// header goes in the top margin, so the parts paginate as the whole does.
+	tpl := gofpdf.CreateTpl(gofpdf.PointType{}, gofpdf.SizeType{Wd: 210, Ht: 297}, "P", "mm", "", func(t *gofpdf.Tpl) {
+		t.SetMargins(10, 10, 10)
+		draw(&t.Fpdf)
+	})
+	pages := tpl.FromPages()
+
+	// Measure the unsplit document
+	wholePDF := gofpdf.New("P", "mm", "A4", "")
+	for _, page := range pages {
+		wholePDF.AddPage()
+		wholePDF.UseTemplate(page)
+	}
+	whole, err := outputBasicPDF(wholePDF)
+	if err != nil {
+		return nil, err
+	}
+	if !limits.exceeded(len(pages), int64(len(whole))) {
+		return writeParts(pdfPath, [][]byte{whole}, files)
+	}
+
+	parts, err := splitPages(len(pages), int64(len(whole)), limits, func(first, last, part, parts int) ([]byte, error) {
+		doc := gofpdf.New("P", "mm", "A4", "")
+		tr := doc.UnicodeTranslatorFromDescriptor("")
+		for _, page := range pages[first-1 : last] {
+			doc.AddPage()
+			doc.UseTemplate(page)
+
+			// Continuation header sits in the top margin
+			doc.SetFont("Arial", "I", 8)
+			doc.SetTextColor(100, 100, 100)
+			doc.SetXY(10, 3)
+			doc.CellFormat(0, 5, tr(labels.partHeader(subject, part, parts)), "", 0, "C", false, 0, "")
+			doc.SetTextColor(0, 0, 0)
+		}
+		return outputBasicPDF(doc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return writeParts(pdfPath, parts, files)
+}
+
+// outputBasicPDF returns the bytes of a finished gofpdf document
+func outputBasicPDF(pdf *gofpdf.Fpdf) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := pdf.Output(&buffer); err != nil {
+		return nil, fmt.Errorf("failed to build pdf: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
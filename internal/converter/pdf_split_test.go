@@ -0,0 +1,82 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSplitPagesHalvesOversizedParts(t *testing.T) {
+	// Page 2 holds a large image, so an even split by size puts too much in
+	// the first part
+	sizes := []int{10, 500, 10, 10, 10, 10}
+	var rendered []string
+	render := func(first, last, part, parts int) ([]byte, error) {
+		rendered = append(rendered, fmt.Sprintf("%d-%d %d/%d", first, last, part, parts))
+		size := 0
+		for _, s := range sizes[first-1 : last] {
+			size += s
+		}
+		return bytes.Repeat([]byte{'x'}, size), nil
+	}
+
+	limits := splitLimits{MaxBytes: 300}
+	parts, err := splitPages(len(sizes), 550, limits, render)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, part := range parts {
+		got = append(got, len(part))
+	}
+	// The single page over the limit can't be split further
+	if want := []int{10, 500, 10, 30}; !slices.Equal(got, want) {
+		t.Errorf("part sizes = %v, want %v (rendered %v)", got, want, rendered)
+	}
+	if last := rendered[len(rendered)-1]; last != "4-6 4/4" {
+		t.Errorf("last part rendered as %s, want 4-6 4/4", last)
+	}
+}
+
+func TestWritePartsRemovesStaleOutputs(t *testing.T) {
+	dir := t.TempDir()
+	pdfPath := filepath.Join(dir, "mail.pdf")
+	files := fileIO{attempts: 1}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	// An earlier conversion wrote three parts
+	if _, err := writeParts(pdfPath, [][]byte{[]byte("1"), []byte("2"), []byte("3")}, files); err != nil {
+		t.Fatal(err)
+	}
+	paths, err := writeParts(pdfPath, [][]byte{[]byte("1"), []byte("2")}, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || exists(partPath(pdfPath, 3)) {
+		t.Errorf("after writing 2 parts over 3: paths %v, part 3 present %v", paths, exists(partPath(pdfPath, 3)))
+	}
+
+	paths, err = writeParts(pdfPath, [][]byte{[]byte("whole")}, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(paths, []string{pdfPath}) || exists(partPath(pdfPath, 1)) || exists(partPath(pdfPath, 2)) {
+		t.Errorf("after writing the whole PDF over parts: paths %v, parts still present", paths)
+	}
+	if got := OutputFiles(filepath.Join(dir, "mail.eml")); !slices.Equal(got, []string{pdfPath}) {
+		t.Errorf("OutputFiles = %v, want %v", got, []string{pdfPath})
+	}
+
+	if _, err := writeParts(pdfPath, [][]byte{[]byte("1"), []byte("2")}, files); err != nil {
+		t.Fatal(err)
+	}
+	if exists(pdfPath) {
+		t.Error("whole PDF left beside its parts")
+	}
+}
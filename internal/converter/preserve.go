@@ -0,0 +1,60 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// Timestamp sources for -preserve-times
+const (
+	PreserveTimesDate   = "date"   // The message's Date header, falling back to the source file's mtime
+	PreserveTimesSource = "source" // The source file's mtime
+)
+
+// CheckPreserveTimes validates a -preserve-times value
+func CheckPreserveTimes(mode string) error {
+	switch mode {
+	case "", PreserveTimesDate, PreserveTimesSource:
+		return nil
+	}
+	return fmt.Errorf("invalid -preserve-times %q (use %s or %s)", mode, PreserveTimesDate, PreserveTimesSource)
+}
+
+// preserveSource copies the timestamp and, if requested, the ownership and
+// permissions of the source file onto the files written for it. It is best
+// effort: files the process has no rights to change are reported and left as
+// they are.
+func preserveSource(emlPath string, envelope *enmime.Envelope, mode string, owner bool, paths []string) error {
+	info, err := os.Stat(emlPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat source: %w", err)
+	}
+
+	modTime := info.ModTime()
+	if mode == PreserveTimesDate {
+		if date, err := envelope.Date(); err == nil {
+			modTime = date
+		}
+	}
+
+	var firstErr error
+	for _, path := range paths {
+		if mode != "" {
+			if err := os.Chtimes(path, time.Now(), modTime); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("failed to set times on %s: %w", path, err)
+			}
+		}
+		if owner {
+			if err := os.Chmod(path, info.Mode().Perm()); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("failed to set permissions on %s: %w", path, err)
+			}
+			if err := chownLike(path, info); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("failed to set owner on %s: %w", path, err)
+			}
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package converter
+
+import "os"
+
+// chownLike is not available on this platform, so ownership is left as is
+func chownLike(path string, source os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package converter
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// chownLike gives the file the owner and group of the source file. Without
+// the rights to do so (usually when not running as root) the owner is kept.
+func chownLike(path string, source os.FileInfo) error {
+	stat, ok := source.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if err := os.Chown(path, int(stat.Uid), int(stat.Gid)); err != nil && !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+	return nil
+}
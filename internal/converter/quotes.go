@@ -0,0 +1,263 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Quote modes control how quoted text from earlier messages is rendered
+const (
+	QuoteShow     = "show"     // Render quoted text unchanged
+	QuoteMark     = "mark"     // Render quoted text in a distinct style
+	QuoteCollapse = "collapse" // Replace quoted text with a line-count marker
+)
+
+// CheckQuoteMode validates a -quotes value
+func CheckQuoteMode(mode string) error {
+	switch mode {
+	case QuoteShow, QuoteMark, QuoteCollapse:
+		return nil
+	}
+	return fmt.Errorf("unsupported quote mode %q (available: %s, %s, %s)", mode, QuoteShow, QuoteMark, QuoteCollapse)
+}
+
+// textBlock is a run of plain text lines that are either all quoted or all not
+type textBlock struct {
+	Lines  []string
+	Quoted bool
+}
+
+// splitTextQuotes groups plain text into quoted (">"-prefixed) and unquoted blocks.
+// Blank lines between two quoted lines stay inside the quote.
+func splitTextQuotes(text string) []textBlock {
+	lines := strings.Split(text, "\n")
+	var blocks []textBlock
+
+	for i := 0; i < len(lines); i++ {
+		quoted := isQuotedLine(lines[i])
+		if !quoted && strings.TrimSpace(lines[i]) == "" && len(blocks) > 0 && blocks[len(blocks)-1].Quoted {
+			// Look ahead to see whether the quote continues after the blank lines
+			j := i
+			for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+				j++
+			}
+			quoted = j < len(lines) && isQuotedLine(lines[j])
+		}
+
+		if len(blocks) == 0 || blocks[len(blocks)-1].Quoted != quoted {
+			blocks = append(blocks, textBlock{Quoted: quoted})
+		}
+		blocks[len(blocks)-1].Lines = append(blocks[len(blocks)-1].Lines, lines[i])
+	}
+
+	return blocks
+}
+
+// isQuotedLine reports whether a plain text line is quoted from an earlier message
+func isQuotedLine(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " \t"), ">")
+}
+
+// collapseTextQuotes replaces each quoted block in plain text with a marker
+func collapseTextQuotes(text string, labels Labels) string {
+	var out []string
+	for _, block := range splitTextQuotes(text) {
+		if block.Quoted {
+			out = append(out, "["+fmt.Sprintf(labels.QuotedText, len(block.Lines))+"]")
+		} else {
+			out = append(out, block.Lines...)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// writeTextQuotesHTML converts plain text to HTML, wrapping quoted blocks in a styled container
+func writeTextQuotesHTML(buffer *bytes.Buffer, text string) {
+	for _, block := range splitTextQuotes(text) {
+		if block.Quoted {
+			buffer.WriteString("<div class=\"quoted-text\">\n")
+		}
+		for _, line := range block.Lines {
+			if line == "" {
+				buffer.WriteString("<br>\n")
+			} else {
+				buffer.WriteString(html.EscapeString(line) + "<br>\n")
+			}
+		}
+		if block.Quoted {
+			buffer.WriteString("</div>\n")
+		}
+	}
+}
+
+// transformHTMLQuotes applies a quote mode to an HTML body. Bodies without
+// recognizable quote containers, or that fail to parse, are returned unchanged.
+func transformHTMLQuotes(body, mode string, labels Labels) string {
+	if mode != QuoteMark && mode != QuoteCollapse {
+		return body
+	}
+
+	doc, err := xhtml.Parse(strings.NewReader(body))
+	if err != nil {
+		return body
+	}
+
+	quotes := findHTMLQuotes(doc)
+	if len(quotes) == 0 {
+		return body
+	}
+
+	for _, quote := range quotes {
+		switch mode {
+		case QuoteMark:
+			for _, node := range quote {
+				if node.Type == xhtml.ElementNode {
+					addClass(node, "quoted-text")
+				}
+			}
+		case QuoteCollapse:
+			marker := &xhtml.Node{
+				Type: xhtml.ElementNode,
+				Data: "div",
+				Attr: []xhtml.Attribute{{Key: "class", Val: "quoted-collapsed"}},
+			}
+			marker.AppendChild(&xhtml.Node{
+				Type: xhtml.TextNode,
+				Data: "[" + fmt.Sprintf(labels.QuotedText, countHTMLLines(quote)) + "]",
+			})
+			quote[0].Parent.InsertBefore(marker, quote[0])
+			for _, node := range quote {
+				node.Parent.RemoveChild(node)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if err := xhtml.Render(&out, doc); err != nil {
+		return body
+	}
+	return out.String()
+}
+
+// quotePlaceholder stands in for ">" while HTML is converted to text, since
+// parseHTML would treat a decoded "&gt;" as the end of a tag
+const quotePlaceholder = "\uE000"
+
+// htmlQuotesToText converts an HTML body to text for the fallback renderer,
+// prefixing lines inside quote containers with ">" so they can be styled
+func htmlQuotesToText(body string) string {
+	doc, err := xhtml.Parse(strings.NewReader(body))
+	if err != nil {
+		return parseHTML(body)
+	}
+
+	for _, quote := range findHTMLQuotes(doc) {
+		replacement := &xhtml.Node{Type: xhtml.ElementNode, Data: "div"}
+		for _, line := range strings.Split(parseHTML(renderNodes(quote)), "\n") {
+			replacement.AppendChild(&xhtml.Node{Type: xhtml.TextNode, Data: quotePlaceholder + " " + line})
+			replacement.AppendChild(&xhtml.Node{Type: xhtml.ElementNode, Data: "br"})
+		}
+		quote[0].Parent.InsertBefore(replacement, quote[0])
+		for _, node := range quote {
+			node.Parent.RemoveChild(node)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := xhtml.Render(&out, doc); err != nil {
+		return parseHTML(body)
+	}
+	return strings.ReplaceAll(parseHTML(out.String()), quotePlaceholder, ">")
+}
+
+// findHTMLQuotes returns the outermost quote containers in the document. Each
+// quote is a list of sibling nodes, since Outlook marks only the start of the
+// quoted message and everything after it belongs to the quote.
+func findHTMLQuotes(doc *xhtml.Node) [][]*xhtml.Node {
+	var quotes [][]*xhtml.Node
+
+	var walk func(n *xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != xhtml.ElementNode {
+				continue
+			}
+
+			if getAttr(c, "id") == "divRplyFwdMsg" || getAttr(c, "id") == "appendonsend" {
+				var quote []*xhtml.Node
+				for s := c; s != nil; s = s.NextSibling {
+					quote = append(quote, s)
+				}
+				quotes = append(quotes, quote)
+				return
+			}
+
+			if isHTMLQuote(c) {
+				quotes = append(quotes, []*xhtml.Node{c})
+				continue
+			}
+
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return quotes
+}
+
+// isHTMLQuote reports whether an element wraps quoted text in common mail clients
+func isHTMLQuote(n *xhtml.Node) bool {
+	class := " " + getAttr(n, "class") + " "
+	switch {
+	case strings.Contains(class, " gmail_quote "): // Gmail
+		return true
+	case strings.Contains(class, " yahoo_quoted "): // Yahoo
+		return true
+	case n.Data == "blockquote" && getAttr(n, "type") == "cite": // Apple Mail, Thunderbird
+		return true
+	}
+	return false
+}
+
+// getAttr returns an attribute value, or "" when it isn't set
+func getAttr(n *xhtml.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// addClass appends a class to an element
+func addClass(n *xhtml.Node, class string) {
+	for i, attr := range n.Attr {
+		if attr.Key == "class" {
+			n.Attr[i].Val = strings.TrimSpace(attr.Val + " " + class)
+			return
+		}
+	}
+	n.Attr = append(n.Attr, xhtml.Attribute{Key: "class", Val: class})
+}
+
+// renderNodes renders a list of sibling nodes back to HTML
+func renderNodes(nodes []*xhtml.Node) string {
+	var out bytes.Buffer
+	for _, node := range nodes {
+		xhtml.Render(&out, node)
+	}
+	return out.String()
+}
+
+// countHTMLLines counts the lines of text inside a quote
+func countHTMLLines(nodes []*xhtml.Node) int {
+	text := parseHTML(renderNodes(nodes))
+	if text == "" {
+		return 0
+	}
+	return strings.Count(text, "\n") + 1
+}
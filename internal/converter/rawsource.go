@@ -0,0 +1,224 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Columns a source line is folded at, which fits the fallback renderer's
+// 7pt Courier beside the line numbers
+const sourceFoldWidth = 100
+
+// Kinds of line in the raw source, styled differently in the appendix
+const (
+	sourceHeader   = "header"
+	sourceBoundary = "boundary"
+	sourceBody     = "body"
+)
+
+// boundaryPattern matches the boundary parameter of a multipart Content-Type
+var boundaryPattern = regexp.MustCompile(`(?i)\bboundary\s*=\s*(?:"([^"]+)"|([^\s;]+))`)
+
+// rawSource is the start of a message's MIME source, laid out for the
+// appendix
+type rawSource struct {
+	Lines []sourceLine
+	Shown int64 // Bytes of the message shown
+	Total int64 // Bytes in the whole message
+}
+
+// sourceLine is one printed line of the source
+type sourceLine struct {
+	Number int    // Line number in the message (0 = folded continuation of the line before)
+	Text   string // Line text, with bytes that aren't UTF-8 shown as \xNN
+	Kind   string // sourceHeader, sourceBoundary or sourceBody
+}
+
+// buildRawSource lays out the first maxBytes of a raw message (0 = all of
+// it), cut at a line end. Lines are classified by following the MIME
+// structure, headers of each part up to its blank line and boundaries
+// declared by the Content-Type headers before them, and folded at a syntax
+// boundary where one falls near the fold width.
+func buildRawSource(raw []byte, maxBytes int64) *rawSource {
+	source := &rawSource{Total: int64(len(raw))}
+	shown := raw
+	if maxBytes > 0 && int64(len(raw)) > maxBytes {
+		shown = raw[:maxBytes]
+		if i := bytes.LastIndexByte(shown, '\n'); i >= 0 {
+			shown = shown[:i+1]
+		}
+	}
+	source.Shown = int64(len(shown))
+
+	text := strings.TrimSuffix(strings.ReplaceAll(string(shown), "\r\n", "\n"), "\n")
+	boundaries := make(map[string]bool)
+	inHeaders := true
+	var header string // Header being read, including its continuation lines
+
+	for i, line := range strings.Split(text, "\n") {
+		kind := sourceBody
+		switch {
+		case inHeaders && line == "":
+			inHeaders = false
+			collectBoundaries(header, boundaries)
+			header = ""
+		case inHeaders:
+			kind = sourceHeader
+			if line[0] != ' ' && line[0] != '\t' {
+				collectBoundaries(header, boundaries)
+				header = ""
+			}
+			header += line
+		case isBoundaryLine(line, boundaries):
+			kind = sourceBoundary
+			// Each part starts with its own headers, the closing boundary ends them
+			inHeaders = !strings.HasSuffix(strings.TrimSpace(line), "--")
+		}
+
+		line = printableSource(line)
+		for n, part := range foldSourceLine(line, kind) {
+			number := 0
+			if n == 0 {
+				number = i + 1
+			}
+			source.Lines = append(source.Lines, sourceLine{Number: number, Text: part, Kind: kind})
+		}
+	}
+	return source
+}
+
+// collectBoundaries adds the boundary a Content-Type header declares
+func collectBoundaries(header string, boundaries map[string]bool) {
+	name, value, ok := strings.Cut(header, ":")
+	if !ok || !strings.EqualFold(strings.TrimSpace(name), "Content-Type") {
+		return
+	}
+	if match := boundaryPattern.FindStringSubmatch(value); match != nil {
+		boundaries[match[1]+match[2]] = true
+	}
+}
+
+// isBoundaryLine reports whether a body line is a delimiter of one of the
+// declared boundaries
+func isBoundaryLine(line string, boundaries map[string]bool) bool {
+	rest, ok := strings.CutPrefix(strings.TrimRight(line, " \t"), "--")
+	if !ok {
+		return false
+	}
+	return boundaries[rest] || boundaries[strings.TrimSuffix(rest, "--")]
+}
+
+// printableSource shows tabs as spaces and the bytes of a line that aren't
+// valid UTF-8, or are control characters, as \xNN escapes
+func printableSource(line string) string {
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		switch {
+		case r == '\t':
+			b.WriteString("    ")
+		case (r == utf8.RuneError && size == 1) || r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, "\\x%02X", line[i])
+		default:
+			b.WriteString(line[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// foldSourceLine splits a line longer than the fold width. Header lines are
+// folded after the last "; ", ", " or space in the second half of the width,
+// like a mail client folds them; body lines, usually encoded data, are cut
+// at the width.
+func foldSourceLine(line, kind string) []string {
+	var parts []string
+	for utf8.RuneCountInString(line) > sourceFoldWidth {
+		cut := runeOffset(line, sourceFoldWidth)
+		if kind == sourceHeader {
+			for _, sep := range []string{"; ", ", ", " "} {
+				if i := strings.LastIndex(line[:cut], sep); i >= runeOffset(line, sourceFoldWidth/2) {
+					cut = i + len(sep)
+					break
+				}
+			}
+		}
+		parts = append(parts, line[:cut])
+		line = line[cut:]
+	}
+	return append(parts, line)
+}
+
+// runeOffset returns the byte offset of the nth rune of s
+func runeOffset(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return len(s)
+}
+
+// heading returns the appendix heading, noting when only the start is shown
+func (s *rawSource) heading(labels Labels) string {
+	if s.Shown < s.Total {
+		return labels.RawSource + " (" + fmt.Sprintf(labels.RawSourcePartial, formatBytes(s.Shown), formatBytes(s.Total)) + ")"
+	}
+	return labels.RawSource
+}
+
+// writeHTMLRawSource adds the line-numbered source to the HTML buffer
+func writeHTMLRawSource(buffer *bytes.Buffer, source *rawSource, labels Labels) {
+	buffer.WriteString("<div class=\"raw-source\">\n")
+	buffer.WriteString("<h3>" + html.EscapeString(source.heading(labels)) + "</h3>\n")
+	buffer.WriteString("<table>\n")
+	for _, line := range source.Lines {
+		number := "&#8618;"
+		if line.Number > 0 {
+			number = fmt.Sprintf("%d", line.Number)
+		}
+		buffer.WriteString(fmt.Sprintf("<tr class=\"source-%s\"><td class=\"source-number\">%s</td><td>%s</td></tr>\n",
+			line.Kind, number, html.EscapeString(line.Text)))
+	}
+	buffer.WriteString("</table>\n</div>\n")
+}
+
+// addPDFRawSource adds the line-numbered source to the PDF in Courier, with
+// headers in bold and boundaries in blue
+func addPDFRawSource(pdf *gofpdf.Fpdf, source *rawSource, labels Labels) {
+	pdf.AddPage()
+	pdf.SetFont("Arial", "B", 12)
+	pdf.Cell(0, 10, source.heading(labels)+":")
+	pdf.Ln(10)
+
+	for _, line := range source.Lines {
+		number := "  ->"
+		if line.Number > 0 {
+			number = fmt.Sprintf("%4d", line.Number)
+		}
+		pdf.SetFont("Courier", "", 7)
+		pdf.SetTextColor(150, 150, 150)
+		pdf.CellFormat(10, 3.5, number, "", 0, "R", false, 0, "")
+
+		switch line.Kind {
+		case sourceHeader:
+			pdf.SetFont("Courier", "B", 7)
+			pdf.SetTextColor(0, 0, 0)
+		case sourceBoundary:
+			pdf.SetFont("Courier", "B", 7)
+			pdf.SetTextColor(0, 70, 160)
+		default:
+			pdf.SetTextColor(60, 60, 60)
+		}
+		pdf.CellFormat(0, 3.5, " "+line.Text, "", 1, "L", false, 0, "")
+	}
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Arial", "", 11)
+}
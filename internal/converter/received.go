@@ -0,0 +1,180 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Hop is one server a message passed through, from its Received header
+type Hop struct {
+	Number       int    `json:"hop"`                     // 1 is the first server, nearest the sender
+	From         string `json:"from,omitempty"`          // Host the message came from, as it introduced itself
+	FromIP       string `json:"from_ip,omitempty"`       // Address the message came from, as the server saw it
+	By           string `json:"by,omitempty"`            // Server that added the header
+	With         string `json:"with,omitempty"`          // Protocol, e.g. "ESMTPS"
+	Time         string `json:"time,omitempty"`          // When the server received the message, RFC 3339 (empty = unparsable)
+	DelaySeconds int64  `json:"delay_seconds,omitempty"` // Time since the previous hop; negative when the servers' clocks disagree
+
+	at         time.Time
+	delayKnown bool // Whether both this hop and the previous one have a time
+}
+
+// receivedIPPattern matches the bracketed address in a Received from clause,
+// e.g. "(mail.example.com [192.0.2.1])" or "[IPv6:2001:db8::1]"
+var receivedIPPattern = regexp.MustCompile(`\[(?:IPv6:)?([0-9A-Fa-f:.]+)\]`)
+
+// parseReceived reads the Received headers of a message into its route,
+// first hop first. It returns nil for messages without Received headers.
+func parseReceived(envelope *enmime.Envelope) []Hop {
+	values := envelope.GetHeaderValues("Received")
+	if len(values) == 0 {
+		return nil
+	}
+
+	// Each server adds its header on top, so the last one is the first hop
+	hops := make([]Hop, 0, len(values))
+	for i := len(values) - 1; i >= 0; i-- {
+		hop := parseReceivedHeader(unfold(values[i]))
+		hop.Number = len(hops) + 1
+		if len(hops) > 0 {
+			if previous := hops[len(hops)-1]; !previous.at.IsZero() && !hop.at.IsZero() {
+				hop.DelaySeconds = int64(hop.at.Sub(previous.at) / time.Second)
+				hop.delayKnown = true
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// parseReceivedHeader reads one Received header, e.g. "from mail.example.com
+// (mail.example.com [192.0.2.1]) by mx.example.org with ESMTPS id abc; Tue,
+// 2 Jan 2024 10:00:00 +0000". Servers vary the layout, so fields that can't
+// be found are left empty.
+func parseReceivedHeader(value string) Hop {
+	var hop Hop
+	clauses, date := value, ""
+	if i := strings.LastIndex(value, ";"); i >= 0 {
+		clauses, date = value[:i], strings.TrimSpace(value[i+1:])
+	}
+	if at, err := mail.ParseDate(date); err == nil {
+		hop.at = at
+		hop.Time = at.Format(time.RFC3339)
+	}
+
+	// The address is in the comment after the from host, before "by"
+	fromClause := clauses
+	if i := strings.Index(strings.ToLower(clauses), " by "); i >= 0 {
+		fromClause = clauses[:i]
+	}
+	if match := receivedIPPattern.FindStringSubmatch(fromClause); match != nil {
+		hop.FromIP = match[1]
+	}
+
+	words := strings.Fields(stripComments(clauses))
+	for i := 0; i+1 < len(words); i++ {
+		switch strings.ToLower(words[i]) {
+		case "from":
+			hop.From = words[i+1]
+		case "by":
+			hop.By = words[i+1]
+		case "with":
+			hop.With = words[i+1]
+		default:
+			continue
+		}
+		i++
+	}
+	return hop
+}
+
+// stripComments removes parenthesized comments, which may nest
+func stripComments(value string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range value {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// delay formats the time since the previous hop, e.g. "+3s"
+func (h Hop) delay() string {
+	if !h.delayKnown {
+		return ""
+	}
+	d := time.Duration(h.DelaySeconds) * time.Second
+	if d < 0 {
+		return d.String()
+	}
+	return "+" + d.String()
+}
+
+// summary returns the hop as one line for the fallback renderer
+func (h Hop) summary() string {
+	line := fmt.Sprintf("%d.", h.Number)
+	if h.From != "" {
+		line += " " + h.From
+	}
+	if h.FromIP != "" {
+		line += " [" + h.FromIP + "]"
+	}
+	if h.By != "" {
+		line += " -> " + h.By
+	}
+	if h.With != "" {
+		line += " (" + h.With + ")"
+	}
+	if h.Time != "" {
+		line += ", " + h.at.Format("2006-01-02 15:04:05 -0700")
+	}
+	if delay := h.delay(); delay != "" {
+		line += " " + delay
+	}
+	return line
+}
+
+// writeHTMLHops adds the route table to the HTML buffer
+func writeHTMLHops(buffer *bytes.Buffer, hops []Hop, labels Labels) {
+	buffer.WriteString("<div class=\"received-hops\">\n")
+	buffer.WriteString("<h3>" + html.EscapeString(labels.ReceivedHops) + "</h3>\n")
+	buffer.WriteString("<table>\n<tr><th>#</th><th>From</th><th>IP</th><th>By</th><th>With</th><th>Time</th><th>Delay</th></tr>\n")
+	for _, hop := range hops {
+		when := ""
+		if hop.Time != "" {
+			when = hop.at.Format("2006-01-02 15:04:05 -0700")
+		}
+		buffer.WriteString(fmt.Sprintf("<tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			hop.Number, html.EscapeString(hop.From), html.EscapeString(hop.FromIP), html.EscapeString(hop.By),
+			html.EscapeString(hop.With), when, hop.delay()))
+	}
+	buffer.WriteString("</table>\n</div>\n")
+}
+
+// addPDFHops adds the route to the PDF, one line per hop
+func addPDFHops(pdf *gofpdf.Fpdf, hops []Hop, labels Labels) {
+	pdf.Ln(10)
+	pdf.SetFont("Arial", "B", 12)
+	pdf.Cell(0, 10, labels.ReceivedHops+":")
+	pdf.Ln(10)
+
+	pdf.SetFont("Arial", "", 9)
+	for _, hop := range hops {
+		pdf.MultiCell(0, 5, hop.summary(), "", "", false)
+	}
+}
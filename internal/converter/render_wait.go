@@ -0,0 +1,141 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+
+	"emil/internal/slots"
+)
+
+// Render wait policies decide when Chrome has finished loading the page
+const (
+	RenderWaitIdle  = "idle"  // No network requests in flight and web fonts loaded
+	RenderWaitFonts = "fonts" // Web fonts loaded, ignoring other requests
+	RenderWaitNone  = "none"  // Print as soon as the DOM is ready
+)
+
+// networkQuietPeriod is how long the page must have no requests in flight
+// before the network counts as idle
+const networkQuietPeriod = 100 * time.Millisecond
+
+// renderWait is the wait policy applied before printing
+type renderWait struct {
+	Policy string
+	Max    time.Duration // Upper bound on the wait; the page is printed as it is when reached
+}
+
+// CheckRenderWait validates a -render-wait value
+func CheckRenderWait(policy string) error {
+	switch policy {
+	case RenderWaitIdle, RenderWaitFonts, RenderWaitNone:
+		return nil
+	}
+	return fmt.Errorf("unsupported render wait policy %q (available: %s, %s, %s)",
+		policy, RenderWaitIdle, RenderWaitFonts, RenderWaitNone)
+}
+
+// networkTracker counts the page's in-flight requests from CDP network events
+type networkTracker struct {
+	mu           sync.Mutex
+	inFlight     map[network.RequestID]bool
+	lastActivity time.Time
+}
+
+// trackNetwork starts counting requests on the browser tab. It must be
+// called before navigating so the page's own requests are seen.
+func trackNetwork(ctx context.Context) *networkTracker {
+	t := &networkTracker{
+		inFlight:     make(map[network.RequestID]bool),
+		lastActivity: time.Now(),
+	}
+
+	chromedp.ListenTarget(ctx, func(ev interface{}) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		switch e := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			t.inFlight[e.RequestID] = true
+		case *network.EventLoadingFinished:
+			delete(t.inFlight, e.RequestID)
+		case *network.EventLoadingFailed:
+			delete(t.inFlight, e.RequestID)
+		default:
+			return
+		}
+		t.lastActivity = time.Now()
+	})
+
+	return t
+}
+
+// idle reports whether no requests have been in flight for the quiet period
+func (t *networkTracker) idle() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.inFlight) == 0 && time.Since(t.lastActivity) >= networkQuietPeriod
+}
+
+// waitForRender waits according to the policy, giving up silently at the cap
+// so slow remote content never stops the message from being printed. It
+// also gives up once the run's renders come under memory pressure, so the tab
+// is printed and closed instead of holding its memory while remote content
+// trickles in.
+func waitForRender(wait renderWait, tracker *networkTracker, renders *slots.Limiter) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if wait.Policy == RenderWaitNone || wait.Max <= 0 {
+			return nil
+		}
+
+		pressureCtx, cancelPressure := cancelOnPressure(ctx, renders)
+		defer cancelPressure()
+		waitCtx, cancel := context.WithTimeout(pressureCtx, wait.Max)
+		defer cancel()
+
+		if wait.Policy == RenderWaitIdle {
+			ticker := time.NewTicker(20 * time.Millisecond)
+			defer ticker.Stop()
+			for !tracker.idle() {
+				select {
+				case <-waitCtx.Done():
+					return ctx.Err()
+				case <-ticker.C:
+				}
+			}
+		}
+
+		// Resolves once every web font in use has loaded or failed
+		var ready bool
+		err := chromedp.Evaluate(`document.fonts.ready.then(() => true)`, &ready,
+			func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+				return p.WithAwaitPromise(true)
+			}).Do(waitCtx)
+		if err != nil && waitCtx.Err() == nil {
+			return fmt.Errorf("failed to wait for fonts: %w", err)
+		}
+
+		// Only the overall render timeout is an error
+		return ctx.Err()
+	})
+}
+
+// cancelOnPressure returns a context that is also cancelled once the run's
+// renders come under memory pressure
+func cancelOnPressure(ctx context.Context, renders *slots.Limiter) (context.Context, context.CancelFunc) {
+	pressureCtx, cancel := context.WithCancel(ctx)
+	felt := renders.Pressured()
+	go func() {
+		select {
+		case <-felt:
+			cancel()
+		case <-pressureCtx.Done():
+		}
+	}()
+	return pressureCtx, cancel
+}
@@ -0,0 +1,265 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"emil/internal/config"
+)
+
+// Rendering backends, listed in the default preference order
+const (
+	RendererChrome      = "chrome"        // Local headless Chrome
+	RendererRemote      = "remote-chrome" // Chrome reached over the DevTools protocol at -chrome-remote
+	RendererGotenberg   = "gotenberg"     // Gotenberg server at -gotenberg
+	RendererWkhtmltopdf = "wkhtmltopdf"   // wkhtmltopdf from the PATH
+	RendererBasic       = "basic"         // Built-in gofpdf layout, always available
+)
+
+// DefaultRendererOrder is the preference order used when none is configured
+var DefaultRendererOrder = []string{RendererChrome, RendererRemote, RendererGotenberg, RendererWkhtmltopdf, RendererBasic}
+
+// probeTimeout bounds each availability check of a remote backend
+const probeTimeout = 3 * time.Second
+
+// remoteBrowser is the Chrome instance reached at -chrome-remote
+var remoteBrowser = browser{remote: true}
+
+// CheckRendererOrder validates a -renderer-order list
+func CheckRendererOrder(order []string) error {
+	if len(order) == 0 {
+		return fmt.Errorf("renderer order is empty (available: %s)", strings.Join(DefaultRendererOrder, ", "))
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range order {
+		known := false
+		for _, renderer := range DefaultRendererOrder {
+			known = known || name == renderer
+		}
+		if !known {
+			return fmt.Errorf("unsupported renderer %q (available: %s)", name, strings.Join(DefaultRendererOrder, ", "))
+		}
+		if seen[name] {
+			return fmt.Errorf("renderer %q is listed twice", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// DetectRenderers probes which backends can be used and returns them in the
+// configured preference order. Each is probed once per run, whose
+// Config.Renderers remembers the answer.
+func DetectRenderers(cfg *config.Config) []string {
+	order := cfg.RendererOrder
+	if len(order) == 0 {
+		order = DefaultRendererOrder
+	}
+
+	var available []string
+	for _, name := range order {
+		ok := cfg.Renderers.Available(name, func() bool { return probeRenderer(name, cfg) })
+		if ok {
+			available = append(available, name)
+		}
+	}
+	return available
+}
+
+// probeRenderer reports whether a backend can be used
+func probeRenderer(name string, cfg *config.Config) bool {
+	switch name {
+	case RendererChrome:
+		return findChrome(cfg.Chrome.ExecPath) != ""
+	case RendererRemote:
+		return cfg.Chrome.RemoteURL != "" && probeHTTP(strings.TrimRight(remoteHTTPURL(cfg.Chrome.RemoteURL), "/")+"/json/version")
+	case RendererGotenberg:
+		return cfg.GotenbergURL != "" && probeHTTP(strings.TrimRight(cfg.GotenbergURL, "/")+"/health")
+	case RendererWkhtmltopdf:
+		_, err := exec.LookPath("wkhtmltopdf")
+		return err == nil
+	case RendererBasic:
+		return true
+	}
+	return false
+}
+
+// findChrome returns the Chrome binary chromedp would run, or "" if there is none
+func findChrome(configured string) string {
+	if configured != "" {
+		if path, err := exec.LookPath(configured); err == nil {
+			return path
+		}
+		return ""
+	}
+
+	var locations []string
+	switch runtime.GOOS {
+	case "darwin":
+		locations = []string{
+			"/Applications/Chromium.app/Contents/MacOS/Chromium",
+			"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+		}
+	case "windows":
+		locations = []string{
+			"chrome",
+			`C:\Program Files (x86)\Google\Chrome\Application\chrome.exe`,
+			`C:\Program Files\Google\Chrome\Application\chrome.exe`,
+			filepath.Join(os.Getenv("USERPROFILE"), `AppData\Local\Google\Chrome\Application\chrome.exe`),
+			filepath.Join(os.Getenv("USERPROFILE"), `AppData\Local\Chromium\Application\chrome.exe`),
+		}
+	default:
+		locations = []string{
+			"headless_shell", "headless-shell", "chromium", "chromium-browser",
+			"google-chrome", "google-chrome-stable", "google-chrome-beta", "google-chrome-unstable",
+			"/usr/bin/google-chrome", "/usr/local/bin/chrome", "/snap/bin/chromium", "chrome",
+		}
+	}
+
+	for _, location := range locations {
+		if path, err := exec.LookPath(location); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// remoteHTTPURL turns a DevTools websocket URL into the HTTP endpoint of the same host
+func remoteHTTPURL(url string) string {
+	if rest, ok := strings.CutPrefix(url, "ws://"); ok {
+		host, _, _ := strings.Cut(rest, "/")
+		return "http://" + host
+	}
+	if rest, ok := strings.CutPrefix(url, "wss://"); ok {
+		host, _, _ := strings.Cut(rest, "/")
+		return "https://" + host
+	}
+	return url
+}
+
+// probeHTTP reports whether a GET request to the URL succeeds
+func probeHTTP(url string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 300
+}
+
+// renderHTMLWith renders the complete HTML document with one of the HTML
+// backends. It reports whether the page guard cut the body off, which only
+// Chrome can measure; the others apply the guard without reporting it.
+// Chrome renders use the session's tab when there is a session.
+func renderHTMLWith(renderer, htmlContent, pdfPath, subject string, labels Labels, limits splitLimits, wait renderWait, cfg *config.Config, session *Session) ([]string, bool, error) {
+	opts := printOptions{Tagged: cfg.PDFUA, TruncatePages: cfg.TruncatePages, files: newFileIO(cfg), renders: cfg.RenderSlots,
+		tempDir: TempDir(cfg), tempBase: cfg.TempDir}
+	switch renderer {
+	case RendererChrome:
+		return renderHTMLToPDF(&sharedBrowser, session, htmlContent, pdfPath, subject, labels, limits, wait, cfg.Chrome, opts)
+	case RendererRemote:
+		return renderHTMLToPDF(&remoteBrowser, session, htmlContent, pdfPath, subject, labels, limits, wait, cfg.Chrome, opts)
+	case RendererGotenberg:
+		paths, err := renderWithGotenberg(cfg.GotenbergURL, htmlContent, pdfPath)
+		return paths, false, err
+	case RendererWkhtmltopdf:
+		paths, err := renderWithWkhtmltopdf(htmlContent, pdfPath, TempDir(cfg), cfg.Chrome.JavaScript)
+		return paths, false, err
+	}
+	return nil, false, fmt.Errorf("renderer %s cannot render HTML", renderer)
+}
+
+// renderWithGotenberg sends the HTML document to a Gotenberg server's Chromium route
+func renderWithGotenberg(serverURL, htmlContent, pdfPath string) ([]string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("files", "index.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Gotenberg request: %w", err)
+	}
+	file.Write([]byte(htmlContent))
+	form.WriteField("printBackground", "true")
+	form.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimRight(serverURL, "/")+"/forms/chromium/convert/html", &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Gotenberg request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("gotenberg request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("gotenberg returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	out, err := os.Create(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PDF file: %w", err)
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		return nil, fmt.Errorf("failed to write PDF file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write PDF file: %w", err)
+	}
+	return []string{pdfPath}, nil
+}
+
+// renderWithWkhtmltopdf converts the HTML document with the wkhtmltopdf
+// binary, writing it to a file in tempDir first
+func renderWithWkhtmltopdf(htmlContent, pdfPath, tempDir string, javaScript bool) ([]string, error) {
+	if err := checkTempSpace(tempDir, int64(len(htmlContent))); err != nil {
+		return nil, err
+	}
+	tmpDir, err := os.MkdirTemp(tempDir, htmlTempPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpHTML := filepath.Join(tmpDir, "email.html")
+	if err := os.WriteFile(tmpHTML, []byte(htmlContent), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write temp HTML file: %w", err)
+	}
+
+	args := []string{"--quiet", "--encoding", "utf-8", "--enable-local-file-access"}
+	if !javaScript {
+		args = append(args, "--disable-javascript")
+	}
+	args = append(args, tmpHTML, pdfPath)
+
+	if err := runTool("wkhtmltopdf", args...); err != nil {
+		os.Remove(pdfPath)
+		return nil, err
+	}
+	return []string{pdfPath}, nil
+}
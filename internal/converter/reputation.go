@@ -0,0 +1,114 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+	xhtml "golang.org/x/net/html"
+
+	"emil/internal/models"
+	"emil/internal/reputation"
+)
+
+// Most distinct links of one message whose reputation is checked, so a
+// newsletter with hundreds doesn't hold its conversion up
+const maxReputationLinks = 50
+
+// textLink finds web links in plain text bodies
+var textLink = regexp.MustCompile(`https?://[^\s<>"'()]+`)
+
+// checkReputation looks the message's links and the names its relays
+// introduced themselves with up in the configured checker's providers and
+// returns a warning for each listing
+func checkReputation(envelope *enmime.Envelope, checker *reputation.Checker, verbose bool) []models.SecurityAlert {
+	if checker == nil {
+		return nil
+	}
+
+	var queries []reputation.Query
+	for _, hop := range parseReceived(envelope) {
+		if hop.From != "" || hop.FromIP != "" {
+			queries = append(queries, reputation.HELOQuery(hop.From, hop.FromIP))
+		}
+	}
+	links := 0
+	for _, link := range messageLinks(envelope) {
+		if query, ok := reputation.URLQuery(link); ok {
+			queries = append(queries, query)
+			if links++; links == maxReputationLinks {
+				break
+			}
+		}
+	}
+
+	listings, err := checker.Check(context.Background(), queries)
+	if err != nil && verbose {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	var alerts []models.SecurityAlert
+	for _, listing := range listings {
+		var message string
+		switch listing.Kind {
+		case reputation.KindHELO:
+			message = fmt.Sprintf("Relay %s is listed by %s", relayName(listing.Query), listing.Source)
+		default:
+			message = fmt.Sprintf("Link to %s is listed by %s", listing.Value, listing.Source)
+		}
+		if listing.Reason != "" {
+			message += ": " + listing.Reason
+		}
+		alerts = append(alerts, models.SecurityAlert{Severity: models.SeverityWarning, Message: message})
+	}
+	return alerts
+}
+
+// relayName describes a relay by its HELO name and address
+func relayName(query reputation.Query) string {
+	if query.IP != "" && query.IP != query.Value {
+		return fmt.Sprintf("%s [%s]", query.Value, query.IP)
+	}
+	return query.Value
+}
+
+// messageLinks returns the distinct links of a message's HTML body, or of
+// its text body when it has no HTML
+func messageLinks(envelope *enmime.Envelope) []string {
+	var links []string
+	seen := make(map[string]bool)
+	add := func(link string) {
+		if link = strings.TrimSpace(link); link != "" && !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+
+	if envelope.HTML == "" {
+		for _, link := range textLink.FindAllString(envelope.Text, -1) {
+			add(strings.TrimRight(link, ".,;:!?"))
+		}
+		return links
+	}
+	doc, err := xhtml.Parse(strings.NewReader(envelope.HTML))
+	if err != nil {
+		return nil
+	}
+	var walk func(n *xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		if n.Type == xhtml.ElementNode {
+			switch n.Data {
+			case "a", "area":
+				add(getAttr(n, "href"))
+			case "form":
+				add(getAttr(n, "action"))
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return links
+}
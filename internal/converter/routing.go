@@ -0,0 +1,159 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"emil/internal/config"
+	"emil/internal/routing"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// Longest value a placeholder contributes to a routed file name, in runes
+const maxPlaceholderRunes = 80
+
+// outputPDFPath returns where the PDF for a message is written: beside the
+// source, in the output directory the manifest gives it, in the tree of the
+// first routing rule that matches it, or in the date-based tree of -organize-by.
+// A name from a template without {name}, which two messages can share, is
+// claimed with an empty file, numbered if it is taken; the claim is returned
+// for releaseClaim (nil = none).
+func outputPDFPath(emlPath string, envelope *enmime.Envelope, cfg *config.Config) (string, os.FileInfo, error) {
+	entry := cfg.Manifest.Lookup(emlPath)
+	routed := entry != nil && entry.OutputDir != ""
+	if cfg.Routes == nil && cfg.OrganizeBy == "" && !routed {
+		return PDFPath(emlPath), nil, nil
+	}
+
+	source := cfg.SourceOf(emlPath)
+	relDir, err := filepath.Rel(source.Dir, filepath.Dir(emlPath))
+	if err != nil || strings.HasPrefix(relDir, "..") {
+		relDir = "."
+	}
+
+	root, filename := cfg.OrganizeDir, routing.DefaultFilename
+	if root == "" {
+		root = source.Dir
+	}
+	if routed {
+		root, filename = entry.OutputDir, entry.Filename
+		if filename == "" {
+			filename = routing.DefaultFilename
+		}
+	} else if cfg.Routes != nil {
+		if rule := cfg.Routes.Find(relDir, envelope); rule != nil {
+			root, filename = rule.OutputDir, rule.Filename
+		} else if cfg.OrganizeBy == "" {
+			return PDFPath(emlPath), nil, nil
+		}
+	}
+
+	sent, dateErr := envelope.Date()
+	if zone := loadZone(cfg.Timezone); zone != nil && dateErr == nil {
+		sent = sent.In(zone)
+	}
+	date := "undated"
+	if dateErr == nil {
+		date = sent.Format("2006-01-02")
+	}
+
+	// Several sources converted into one tree keep their folders apart
+	// under their labels
+	mirrored := relDir
+	if len(cfg.Sources) > 1 && root != source.Dir {
+		mirrored = filepath.Join(source.Label, relDir)
+	}
+
+	// Date folders replace the source's folders, so names from different
+	// folders are kept apart with a short hash of the folder
+	dir := filepath.Join(root, mirrored)
+	base := strings.TrimSuffix(filepath.Base(emlPath), filepath.Ext(emlPath))
+	if cfg.OrganizeBy != "" {
+		dir = filepath.Join(root, dateFolder(sent, dateErr == nil, cfg.OrganizeBy))
+		if mirrored != "." {
+			sum := sha256.Sum256([]byte(filepath.ToSlash(mirrored)))
+			base += "_" + hex.EncodeToString(sum[:4])
+		}
+	}
+
+	from := "unknown"
+	if addresses, err := envelope.AddressList("From"); err == nil && len(addresses) > 0 {
+		from = addresses[0].Address
+	}
+	custodian := "unknown"
+	if entry != nil && entry.Custodian != "" {
+		custodian = entry.Custodian
+	}
+	name := strings.NewReplacer(
+		"{name}", placeholderValue(base),
+		"{date}", date,
+		"{from}", placeholderValue(from),
+		"{subject}", placeholderValue(envelope.GetHeader("Subject")),
+		"{custodian}", placeholderValue(custodian),
+		"{source}", placeholderValue(source.Label),
+	).Replace(filename)
+
+	files := newFileIO(cfg)
+	if err := files.mkdirAllRetry(dir); err != nil {
+		return "", nil, fmt.Errorf("failed to create output directory %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, portableName(name+".pdf"))
+	if strings.Contains(filename, "{name}") {
+		return path, nil, nil
+	}
+	path, claim, err := files.claimUnique(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create output file in %s: %w", dir, err)
+	}
+	return path, claim, nil
+}
+
+// Ways of organizing outputs by date for -organize-by
+const (
+	OrganizeByYear  = "year"
+	OrganizeByMonth = "year/month"
+	OrganizeByDay   = "year/month/day"
+)
+
+// CheckOrganizeBy validates an -organize-by value
+func CheckOrganizeBy(organizeBy string) error {
+	switch organizeBy {
+	case "", OrganizeByYear, OrganizeByMonth, OrganizeByDay:
+		return nil
+	}
+	return fmt.Errorf("invalid -organize-by %q (use %s, %s or %s)", organizeBy, OrganizeByYear, OrganizeByMonth, OrganizeByDay)
+}
+
+// dateFolder returns the folder for a message sent at the given time, e.g.
+// 2024/03 for year/month. Messages without a usable date go to "undated".
+func dateFolder(sent time.Time, ok bool, organizeBy string) string {
+	if !ok {
+		return "undated"
+	}
+	switch organizeBy {
+	case OrganizeByYear:
+		return sent.Format("2006")
+	case OrganizeByMonth:
+		return filepath.Join(sent.Format("2006"), sent.Format("01"))
+	default:
+		return filepath.Join(sent.Format("2006"), sent.Format("01"), sent.Format("02"))
+	}
+}
+
+// placeholderValue makes a header value safe to use in a file name
+func placeholderValue(value string) string {
+	value = cleanFilename(value)
+	if runes := []rune(value); len(runes) > maxPlaceholderRunes {
+		value = string(runes[:maxPlaceholderRunes])
+	}
+	if value == "" {
+		return "untitled"
+	}
+	return value
+}
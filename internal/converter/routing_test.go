@@ -0,0 +1,46 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClaimUniqueNeverReusesAName(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "2024-03-01.pdf")
+	files := fileIO{attempts: 1}
+
+	first, claim, err := files.claimUnique(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := files.claimUnique(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != path || second != filepath.Join(dir, "2024-03-01_1.pdf") {
+		t.Errorf("claimed %s and %s, want the name and then its first alternative", first, second)
+	}
+
+	// Parts written under a name keep it taken after the whole PDF is gone
+	if _, err := writeParts(first, [][]byte{[]byte("1"), []byte("2")}, files); err != nil {
+		t.Fatal(err)
+	}
+	third, _, err := files.claimUnique(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third != filepath.Join(dir, "2024-03-01_2.pdf") {
+		t.Errorf("claimed %s after the first name was split into parts", third)
+	}
+
+	// Only the conversion's own claim is released
+	if err := os.WriteFile(first, []byte("another conversion's"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	releaseClaim(first, claim)
+	if _, err := os.Stat(first); err != nil {
+		t.Errorf("releaseClaim removed a file it didn't create: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package converter
+
+import "emil/internal/sandbox"
+
+// submitToSandbox hands a converted message's saved attachments of the types
+// the client selects to the sandbox, if there is one, without waiting for
+// its verdicts. Attachments ClamAV already found infected aren't submitted.
+func submitToSandbox(client *sandbox.Client, emlPath string, results []AttachmentResult) {
+	if client == nil {
+		return
+	}
+	for _, att := range results {
+		if att.SavedPath == "" || !client.Selects(att.Filename) {
+			continue
+		}
+		if att.ScanResult != nil && att.ScanResult.Infected {
+			continue
+		}
+		sum := att.SHA256
+		if sum == "" {
+			var err error
+			if sum, err = fileSHA256(att.SavedPath); err != nil {
+				continue
+			}
+		}
+		client.Submit(emlPath, sandbox.Sample{SHA256: sum, Filename: att.Filename, Path: att.SavedPath, Size: att.Size})
+	}
+}
@@ -0,0 +1,79 @@
+package converter
+
+import (
+	"context"
+
+	"github.com/chromedp/chromedp"
+
+	"emil/internal/config"
+	"emil/internal/ocr"
+	"emil/internal/security"
+)
+
+// Session converts a batch of files one after another with one Chrome tab
+// per browser, saving the cost of opening a tab for every small message. It
+// is not safe for concurrent use; each worker opens its own.
+type Session struct {
+	tabs map[*browser]*sessionTab
+}
+
+// sessionTab is a tab a session keeps open between renders
+type sessionTab struct {
+	browserCtx context.Context // Browser the tab belongs to, which may have been restarted since
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// NewSession starts a session; call Close when the batch is done
+func NewSession() *Session {
+	return &Session{tabs: make(map[*browser]*sessionTab)}
+}
+
+// Convert converts an EML file like ConvertEMLToPDF, rendering in the
+// session's tab
+func (s *Session) Convert(emlPath string, cfg *config.Config, scanner *security.Scanner, ocrEngine *ocr.Engine) (*ConversionResult, error) {
+	return convertEML(emlPath, cfg, scanner, ocrEngine, s)
+}
+
+// Close closes the session's tabs
+func (s *Session) Close() {
+	for b := range s.tabs {
+		s.discard(b)
+	}
+}
+
+// discard closes the session's tab of a browser, so the next render opens
+// a fresh one
+func (s *Session) discard(b *browser) {
+	if s == nil {
+		return
+	}
+	if tab := s.tabs[b]; tab != nil {
+		tab.cancel()
+		delete(s.tabs, b)
+	}
+}
+
+// tab returns a tab of the browser to render in and a function to call when
+// the render is done. A session keeps its tab open for the next render, and
+// opens a new one once the browser has been restarted; without a session
+// every render opens a tab and closes it afterwards.
+func (s *Session) tab(b *browser, browserCtx context.Context) (context.Context, func(), error) {
+	if s != nil {
+		if tab := s.tabs[b]; tab != nil && tab.browserCtx == browserCtx && tab.ctx.Err() == nil {
+			return tab.ctx, func() {}, nil
+		}
+		s.discard(b)
+	}
+
+	tabCtx, cancel := chromedp.NewContext(browserCtx)
+	if err := chromedp.Run(tabCtx); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if s == nil {
+		return tabCtx, cancel, nil
+	}
+	s.tabs[b] = &sessionTab{browserCtx: browserCtx, ctx: tabCtx, cancel: cancel}
+	return tabCtx, func() {}, nil
+}
@@ -0,0 +1,150 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"emil/internal/metadata"
+	"emil/internal/models"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// messageRecord describes a converted message for indexing systems. It is
+// written as the JSON sidecar of a PDF and as the metadata.json of a package.
+type messageRecord struct {
+	Message        *metadata.Message      `json:"message"`
+	SourceSHA256   string                 `json:"source_sha256,omitempty"`
+	PDFs           []recordFile           `json:"pdfs"`
+	Attachments    []recordAttachment     `json:"saved_attachments,omitempty"`
+	SecurityAlerts []models.SecurityAlert `json:"security_alerts,omitempty"`
+	Renderer       string                 `json:"renderer,omitempty"`
+	BodyPart       string                 `json:"body_part,omitempty"`
+	PackagePath    string                 `json:"package_path,omitempty"`
+	ReceivedHops   []Hop                  `json:"received_hops,omitempty"`
+	Anomalies      []HeaderAnomaly        `json:"header_anomalies,omitempty"`
+	Thread         *models.Thread         `json:"thread,omitempty"`
+	ConvertedAt    time.Time              `json:"converted_at"`
+}
+
+// recordFile is an output file with its hash
+type recordFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// recordAttachment is the outcome of saving and scanning one attachment
+type recordAttachment struct {
+	Filename  string   `json:"filename"`
+	Size      int64    `json:"size"`
+	SavedPath string   `json:"saved_path,omitempty"`
+	Skipped   string   `json:"skipped,omitempty"`
+	Scanned   bool     `json:"scanned"`
+	Infected  bool     `json:"infected,omitempty"`
+	Threats   []string `json:"threats,omitempty"`
+}
+
+// sidecarPath returns where the JSON sidecar of a PDF is written
+func sidecarPath(pdfPath string) string {
+	return strings.TrimSuffix(pdfPath, ".pdf") + ".json"
+}
+
+// buildRecord collects the metadata of a converted message
+func buildRecord(emlPath string, envelope *enmime.Envelope, result *ConversionResult) messageRecord {
+	record := messageRecord{
+		Message:        metadata.FromEnvelope(&metadata.Message{Path: emlPath}, envelope),
+		SecurityAlerts: result.SecurityAlerts,
+		Renderer:       result.Renderer,
+		BodyPart:       result.BodyPart,
+		PackagePath:    result.PackagePath,
+		ReceivedHops:   parseReceived(envelope),
+		Anomalies:      result.Anomalies,
+		ConvertedAt:    time.Now(),
+	}
+	if info, err := os.Stat(emlPath); err == nil {
+		record.Message.Size = info.Size()
+	}
+	record.SourceSHA256, _ = fileSHA256(emlPath)
+
+	for _, pdf := range result.outputFiles() {
+		sum, _ := fileSHA256(pdf)
+		record.PDFs = append(record.PDFs, recordFile{Path: pdf, SHA256: sum})
+	}
+	for _, att := range result.Attachments {
+		saved := recordAttachment{
+			Filename:  att.Filename,
+			Size:      att.Size,
+			SavedPath: att.SavedPath,
+			Skipped:   att.Skipped,
+			Scanned:   att.ScanResult != nil,
+		}
+		if att.ScanResult != nil {
+			saved.Infected = att.ScanResult.Infected
+			saved.Threats = att.ScanResult.Threats
+		}
+		record.Attachments = append(record.Attachments, saved)
+	}
+	return record
+}
+
+// writeSidecar writes the JSON metadata of a converted message next to its PDF
+func writeSidecar(emlPath string, envelope *enmime.Envelope, result *ConversionResult, files fileIO) (string, error) {
+	data, err := json.MarshalIndent(buildRecord(emlPath, envelope, result), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode sidecar: %w", err)
+	}
+	path := sidecarPath(result.OutputPath)
+	if err := files.writeFileRetry(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write sidecar: %w", err)
+	}
+	return path, nil
+}
+
+// AddSidecarThread records a message's thread in its sidecar. Threads are
+// known only once the whole run is converted, so the sidecar written with the
+// PDF is updated in place, keeping its modification time.
+func AddSidecarThread(path string, thread models.Thread) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to update sidecar: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to update sidecar: %w", err)
+	}
+
+	var record messageRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return fmt.Errorf("failed to read sidecar %s: %w", path, err)
+	}
+	record.Thread = &thread
+	if data, err = json.MarshalIndent(record, "", "  "); err != nil {
+		return fmt.Errorf("failed to encode sidecar: %w", err)
+	}
+	if err := os.WriteFile(path, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to update sidecar: %w", err)
+	}
+	return os.Chtimes(path, time.Now(), info.ModTime())
+}
+
+// fileSHA256 returns the hex SHA-256 of a file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
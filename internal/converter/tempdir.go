@@ -0,0 +1,87 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"emil/internal/config"
+)
+
+// runTempPrefix names the directory holding one run's temp files. It is
+// followed by the PID of the emil process, so leftovers from a run that was
+// killed can be recognized.
+const runTempPrefix = "emil-run-"
+
+// Free space below which the temp directory is considered too small, in bytes
+const minTempFreeBytes = 256 * 1024 * 1024
+
+// SetupTempDir creates a run's own temp directory under base (empty = the
+// system temp directory), which the run keeps in Config.RunTempDir. Render
+// files go there and are removed together by RemoveTempDir. A warning is
+// returned when base is short of space.
+func SetupTempDir(base string) (dir, warning string, err error) {
+	if base != "" {
+		if info, err := os.Stat(base); err != nil || !info.IsDir() {
+			return "", "", fmt.Errorf("temp directory %s not found", base)
+		}
+	}
+
+	dir, err = newRunDir(base)
+	if err != nil {
+		return "", "", err
+	}
+
+	if free, ok := freeSpace(dir); ok && free < minTempFreeBytes {
+		warning = fmt.Sprintf("only %s free in temp directory %s; large emails may fail to render (see -temp-dir)",
+			formatBytes(int64(free)), filepath.Dir(dir))
+	}
+	return dir, warning, nil
+}
+
+// newRunDir creates a directory under base that CleanupStaleRenderFiles
+// removes once this process is gone
+func newRunDir(base string) (string, error) {
+	dir, err := os.MkdirTemp(base, ownedTempPattern(runTempPrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	return dir, nil
+}
+
+// TempDir returns the directory a run's temp files are created in
+func TempDir(cfg *config.Config) string {
+	if cfg.RunTempDir != "" {
+		return cfg.RunTempDir
+	}
+	return cfg.TempDir
+}
+
+// RemoveTempDir deletes a run's temp directory and everything left in it
+func RemoveTempDir(dir string) {
+	if dir != "" {
+		os.RemoveAll(dir)
+	}
+}
+
+// CheckFreeSpace fails when the filesystem holding dir has less free space
+// than a large email needs to render
+func CheckFreeSpace(dir string) error {
+	if free, ok := freeSpace(dir); ok && free < minTempFreeBytes {
+		return fmt.Errorf("only %s free in %s", formatBytes(int64(free)), dir)
+	}
+	return nil
+}
+
+// checkTempSpace fails early when a temp file of the given size won't fit in
+// dir (empty = the system temp directory)
+func checkTempSpace(dir string, size int64) error {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if free, ok := freeSpace(dir); ok && uint64(size) > free {
+		return fmt.Errorf("not enough space in temp directory %s for %s (%s free)",
+			dir, formatBytes(size), formatBytes(int64(free)))
+	}
+	return nil
+}
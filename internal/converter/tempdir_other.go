@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package converter
+
+// freeSpace is not available on this platform, so space checks are skipped
+func freeSpace(dir string) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package converter
+
+import "syscall"
+
+// freeSpace returns the bytes available to unprivileged users in the
+// directory's filesystem
+func freeSpace(dir string) (uint64, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, false
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), true
+}
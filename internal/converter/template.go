@@ -0,0 +1,147 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jhillyerd/enmime"
+
+	"emil/internal/ocr"
+)
+
+var (
+	// Parsed templates are cached by path and zone for the whole run
+	templateCache     = make(map[string]*template.Template)
+	templateCacheLock sync.Mutex
+
+	// Custom stylesheets are cached by path for the whole run
+	stylesheetCache     = make(map[string]string)
+	stylesheetCacheLock sync.Mutex
+)
+
+// TemplateData is passed to a custom HTML template.
+//
+// The *HTML fields hold the sections emil would render by default so a template
+// can rearrange or wrap them without rebuilding everything from scratch.
+type TemplateData struct {
+	Subject string
+	From    string
+	To      string
+	Cc      string
+	Date    string
+
+	Direction    string // "rtl" for Hebrew, Arabic and similar messages, otherwise "ltr"
+	Labels       Labels // Field labels for the configured locale
+	ExtraHeaders []HeaderField
+	Journal      *JournalInfo
+	Delivery     *DeliveryReport // Parsed bounce or read receipt, or nil
+	ARC          []ARCSet        // ARC sets of a forwarded message, first hop first
+	Hops         []Hop           // Route from the Received headers with -hops, first hop first
+	Attachments  []AttachmentResult
+	OCRResults   []ocr.Result
+
+	Styles       template.CSS  // Built-in stylesheet rules followed by any -css file
+	HeaderHTML   template.HTML // Built-in header block, including journal and delivery metadata
+	BodyHTML     template.HTML // The email body
+	AppendixHTML template.HTML // Attachment list, thumbnail gallery, recognized text, ARC chain and route
+}
+
+// LoadTemplate parses a custom HTML template file, caching the result
+func LoadTemplate(path string) (*template.Template, error) {
+	return loadTemplate(path, nil)
+}
+
+// loadTemplate parses a custom HTML template file whose formatDate shows
+// dates in a zone (nil = as written). A template can't be given new
+// functions once executed, so each zone has its own parse in the cache.
+func loadTemplate(path string, zone *time.Location) (*template.Template, error) {
+	templateCacheLock.Lock()
+	defer templateCacheLock.Unlock()
+
+	key := path
+	if zone != nil {
+		key += "\x00" + zone.String()
+	}
+	if tmpl, ok := templateCache[key]; ok {
+		return tmpl, nil
+	}
+
+	// ParseFiles names the template after the file, so the root must match
+	tmpl, err := template.New(filepath.Base(path)).Funcs(template.FuncMap{
+		"formatBytes": formatBytes,
+		"formatDate": func(date string) string {
+			return formatMessageDate(date, defaultDateLayout, zone)
+		},
+	}).ParseFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+	}
+
+	templateCache[key] = tmpl
+	return tmpl, nil
+}
+
+// LoadStylesheet reads a custom CSS file, caching the result
+func LoadStylesheet(path string) (string, error) {
+	stylesheetCacheLock.Lock()
+	defer stylesheetCacheLock.Unlock()
+
+	if css, ok := stylesheetCache[path]; ok {
+		return css, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read stylesheet %s: %w", path, err)
+	}
+
+	css := string(data)
+	if !strings.HasSuffix(css, "\n") {
+		css += "\n"
+	}
+	stylesheetCache[path] = css
+	return css, nil
+}
+
+// renderTemplate builds the HTML document using a custom template
+func renderTemplate(tmpl *template.Template, envelope *enmime.Envelope, content documentContent) (string, error) {
+	var styles, header, body, appendix bytes.Buffer
+	writeHTMLStyles(&styles)
+	styles.WriteString(content.CustomCSS)
+	writeHTMLHeaderBlock(&header, envelope, content)
+	writeHTMLBody(&body, envelope, content)
+	writeHTMLAppendix(&appendix, envelope, content)
+
+	data := TemplateData{
+		Subject:      envelope.GetHeader("Subject"),
+		From:         envelope.GetHeader("From"),
+		To:           envelope.GetHeader("To"),
+		Cc:           envelope.GetHeader("Cc"),
+		Date:         formatMessageDate(envelope.GetHeader("Date"), defaultDateLayout, content.Zone),
+		Direction:    content.Direction,
+		Labels:       content.Labels,
+		ExtraHeaders: content.ExtraHeaders,
+		Journal:      content.Journal,
+		Delivery:     content.Delivery,
+		ARC:          content.ARC,
+		Hops:         content.Hops,
+		Attachments:  content.Attachments,
+		OCRResults:   content.OCRResults,
+		Styles:       template.CSS(styles.String()),
+		HeaderHTML:   template.HTML(header.String()),
+		BodyHTML:     template.HTML(body.String()),
+		AppendixHTML: template.HTML(appendix.String()),
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+	return out.String(), nil
+}
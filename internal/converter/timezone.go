@@ -0,0 +1,89 @@
+package converter
+
+import (
+	"fmt"
+	"net/mail"
+	"sync"
+	"time"
+)
+
+// Layout of the Date header when no language layout applies
+const defaultDateLayout = "Mon, 02 Jan 2006 15:04:05 -0700"
+
+// zones caches the locations loaded for -timezone by name
+var zones sync.Map
+
+// CheckTimezone validates a -timezone value, an IANA zone name such as
+// Europe/Berlin, or UTC or Local
+func CheckTimezone(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return fmt.Errorf("invalid -timezone %q (use an IANA zone name such as Europe/Berlin): %w", name, err)
+	}
+	return nil
+}
+
+// loadZone returns the location of a -timezone value, or nil to show dates
+// in the zone they were written in
+func loadZone(name string) *time.Location {
+	if name == "" {
+		return nil
+	}
+	if loc, ok := zones.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	zones.Store(name, loc)
+	return loc
+}
+
+// parseMessageDate parses a Date header, also accepting the variations
+// RFC 5322 allows beyond RFC 1123, such as a missing weekday or a zone comment
+func parseMessageDate(date string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC1123Z, date); err == nil {
+		return t, true
+	}
+	if t, err := mail.ParseDate(date); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// hopsInZone converts the times of a route to a zone, keeping the RFC 3339
+// times of the sidecar as the servers wrote them
+func hopsInZone(hops []Hop, zone *time.Location) []Hop {
+	if zone == nil {
+		return hops
+	}
+	for i := range hops {
+		if !hops[i].at.IsZero() {
+			hops[i].at = hops[i].at.In(zone)
+		}
+	}
+	return hops
+}
+
+// formatMessageDate formats a Date header with a layout. With a zone the
+// time is converted to it and the offset it was written with follows in
+// parentheses, e.g. "Tue, 02 Jan 2024 11:00:00 +0100 (-0500)", unless the
+// two agree. Dates that don't parse are returned as written.
+func formatMessageDate(date, layout string, zone *time.Location) string {
+	t, ok := parseMessageDate(date)
+	if !ok {
+		return date
+	}
+	if zone == nil {
+		return t.Format(layout)
+	}
+	converted := t.In(zone)
+	_, written := t.Zone()
+	if _, offset := converted.Zone(); offset == written {
+		return converted.Format(layout)
+	}
+	return converted.Format(layout) + " (" + t.Format("-0700") + ")"
+}
@@ -0,0 +1,81 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// printPageHeight is the height of the printable area of a page Chrome
+// prints, in CSS pixels: Letter paper, its default, less the 12mm margins of
+// the built-in stylesheet
+const printPageHeight = 965
+
+// pageLimitReached is raised through the fallback renderer's drawing calls
+// to stop drawing a body once it reaches the page limit
+type pageLimitReached struct{}
+
+// drawTruncated runs a drawing function, stopping it when it would start a
+// page after maxPages, and reports whether it was stopped. gofpdf breaks
+// pages inside its text calls, so the only way out of them is a panic, which
+// is recovered here.
+func drawTruncated(pdf *gofpdf.Fpdf, maxPages int, draw func()) (truncated bool) {
+	if maxPages <= 0 {
+		draw()
+		return false
+	}
+
+	pdf.SetAcceptPageBreakFunc(func() bool {
+		if pdf.PageNo() >= maxPages {
+			panic(pageLimitReached{})
+		}
+		return true
+	})
+	defer pdf.SetAcceptPageBreakFunc(func() bool { return true })
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(pageLimitReached); !ok {
+				panic(r)
+			}
+			truncated = true
+		}
+	}()
+
+	draw()
+	return false
+}
+
+// addPDFTruncationNotice starts a page telling the reader the body was cut off
+func addPDFTruncationNotice(pdf *gofpdf.Fpdf, maxPages int, labels Labels) {
+	pdf.AddPage()
+	pdf.SetFont("Arial", "B", 14)
+	pdf.SetTextColor(180, 0, 0)
+	pdf.MultiCell(0, 8, fmt.Sprintf(labels.Truncated, maxPages), "", "L", false)
+	pdf.SetTextColor(0, 0, 0)
+	pdf.SetFont("Arial", "", 11)
+	pdf.Ln(5)
+}
+
+// openPageGuard starts the block that cuts the body off after maxPages in
+// the HTML renderers. It clips the body at that height, and the notice
+// placed just below the cut is clipped away too unless the body reaches it,
+// so the notice only shows on messages that were cut off.
+func openPageGuard(buffer *bytes.Buffer, maxPages int) {
+	height := maxPages * printPageHeight
+	fmt.Fprintf(buffer, "<div class=\"page-guard\" style=\"max-height: calc(%dpx + 6em)\">\n", height)
+}
+
+// closePageGuard adds the truncation notice and ends the guard block
+func closePageGuard(buffer *bytes.Buffer, maxPages int, labels Labels) {
+	height := maxPages * printPageHeight
+	fmt.Fprintf(buffer, "<div class=\"page-guard-notice\" style=\"top: %dpx\">%s</div>\n</div>\n",
+		height, html.EscapeString(fmt.Sprintf(labels.Truncated, maxPages)))
+}
+
+// exceedsPageGuard reports whether a body of the given height, in CSS
+// pixels, was cut off by the guard
+func exceedsPageGuard(height float64, maxPages int) bool {
+	return maxPages > 0 && height > float64(maxPages*printPageHeight)
+}
@@ -0,0 +1,225 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xmpNamespace holds the records-management properties set with -xmp
+const (
+	xmpNamespace = "urn:emil:records:1.0#"
+	xmpPrefix    = "records"
+)
+
+var (
+	startXrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	rootPattern      = regexp.MustCompile(`/Root\s+(\d+)\s+(\d+)\s+R`)
+	sizePattern      = regexp.MustCompile(`/Size\s+(\d+)`)
+	infoPattern      = regexp.MustCompile(`/Info\s+\d+\s+\d+\s+R`)
+	idPattern        = regexp.MustCompile(`/ID\s*\[[^\]]*\]`)
+	metadataPattern  = regexp.MustCompile(`/Metadata\s+\d+\s+\d+\s+R`)
+	pdfLangPattern   = regexp.MustCompile(`/Lang\s*\((?:[^()\\]|\\.)*\)`)
+	viewerPattern    = regexp.MustCompile(`/ViewerPreferences\s*(?:<<[^<>]*>>|\d+\s+\d+\s+R)`)
+	xmpNamePattern   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+)
+
+// CheckXMPProperties validates the names of -xmp properties, which become XML element names
+func CheckXMPProperties(properties map[string]string) error {
+	for name := range properties {
+		if !xmpNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid XMP property name %q (use letters, digits, '-', '_' and '.')", name)
+		}
+	}
+	return nil
+}
+
+// buildXMP returns an XMP packet with the message title and the configured
+// records-management properties, identifying the PDF as PDF/UA-1 if it's
+// tagged
+func buildXMP(title string, properties map[string]string, pdfUA bool) []byte {
+	var b bytes.Buffer
+	escape := func(s string) string {
+		var e bytes.Buffer
+		xml.EscapeText(&e, []byte(s))
+		return e.String()
+	}
+
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString("<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("<rdf:Description rdf:about=\"\"\n")
+	b.WriteString("  xmlns:dc=\"http://purl.org/dc/elements/1.1/\"\n")
+	b.WriteString("  xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"\n")
+	if pdfUA {
+		b.WriteString("  xmlns:pdfuaid=\"http://www.aiim.org/pdfua/ns/id/\"\n")
+	}
+	fmt.Fprintf(&b, "  xmlns:%s=\"%s\">\n", xmpPrefix, xmpNamespace)
+	fmt.Fprintf(&b, "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", escape(title))
+	b.WriteString("<dc:format>application/pdf</dc:format>\n")
+	b.WriteString("<xmp:CreatorTool>emil</xmp:CreatorTool>\n")
+	fmt.Fprintf(&b, "<xmp:MetadataDate>%s</xmp:MetadataDate>\n", time.Now().Format(time.RFC3339))
+	if pdfUA {
+		b.WriteString("<pdfuaid:part>1</pdfuaid:part>\n")
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "<%s:%s>%s</%s:%s>\n", xmpPrefix, name, escape(properties[name]), xmpPrefix, name)
+	}
+
+	b.WriteString("</rdf:Description>\n</rdf:RDF>\n</x:xmpmeta>\n")
+	// Padding lets other tools edit the packet in place
+	b.WriteString(strings.Repeat(strings.Repeat(" ", 99)+"\n", 20))
+	b.WriteString("<?xpacket end=\"w\"?>")
+	return b.Bytes()
+}
+
+// embedXMP attaches an XMP packet to a PDF as its document metadata, along
+// with any extra catalog entries, which replace the ones already there. The
+// file is extended with an incremental update rather than rewritten, so it
+// works on the output of every renderer.
+func embedXMP(pdfPath string, packet []byte, catalogEntries string) error {
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		return fmt.Errorf("failed to read pdf for XMP: %w", err)
+	}
+
+	match := startXrefPattern.FindSubmatch(data)
+	if match == nil {
+		return fmt.Errorf("no cross-reference offset at the end of %s", pdfPath)
+	}
+	prevXref, _ := strconv.Atoi(string(match[1]))
+	if prevXref <= 0 || prevXref >= len(data) {
+		return fmt.Errorf("invalid cross-reference offset in %s", pdfPath)
+	}
+
+	// The trailer is a dictionary after "trailer" for classic tables, or the
+	// dictionary of the cross-reference stream itself
+	trailer := data[prevXref:]
+	if bytes.HasPrefix(trailer, []byte("xref")) {
+		i := bytes.Index(trailer, []byte("trailer"))
+		if i < 0 {
+			return fmt.Errorf("no trailer in %s", pdfPath)
+		}
+		trailer = trailer[i:]
+	}
+	if end := bytes.Index(trailer, []byte("startxref")); end >= 0 {
+		trailer = trailer[:end]
+	}
+	if end := bytes.Index(trailer, []byte("stream")); end >= 0 {
+		trailer = trailer[:end]
+	}
+
+	root := rootPattern.FindSubmatch(trailer)
+	size := sizePattern.FindSubmatch(trailer)
+	if root == nil || size == nil {
+		return fmt.Errorf("no document catalog in the trailer of %s", pdfPath)
+	}
+	rootNum, _ := strconv.Atoi(string(root[1]))
+	rootGen, _ := strconv.Atoi(string(root[2]))
+	objectCount, _ := strconv.Atoi(string(size[1]))
+
+	catalog, err := findDictionary(data, rootNum, rootGen)
+	if err != nil {
+		return fmt.Errorf("%w in %s", err, pdfPath)
+	}
+	catalog = metadataPattern.ReplaceAll(catalog, nil)
+	if catalogEntries != "" {
+		catalog = pdfLangPattern.ReplaceAll(catalog, nil)
+		catalog = viewerPattern.ReplaceAll(catalog, nil)
+		catalog = append(catalog, " "+catalogEntries...)
+	}
+	catalog = bytes.TrimSpace(catalog)
+
+	// Append the metadata stream and a new revision of the catalog
+	metadataNum := objectCount
+	var update bytes.Buffer
+	update.WriteString("\n")
+	metadataOffset := len(data) + update.Len()
+	fmt.Fprintf(&update, "%d 0 obj\n<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n", metadataNum, len(packet))
+	update.Write(packet)
+	update.WriteString("\nendstream\nendobj\n")
+	catalogOffset := len(data) + update.Len()
+	fmt.Fprintf(&update, "%d %d obj\n<< %s /Metadata %d 0 R >>\nendobj\n", rootNum, rootGen, catalog, metadataNum)
+
+	xrefOffset := len(data) + update.Len()
+	update.WriteString("xref\n")
+	fmt.Fprintf(&update, "%d 1\n%010d %05d n \n", rootNum, catalogOffset, rootGen)
+	fmt.Fprintf(&update, "%d 1\n%010d %05d n \n", metadataNum, metadataOffset, 0)
+	fmt.Fprintf(&update, "trailer\n<< /Size %d /Root %d %d R /Prev %d", metadataNum+1, rootNum, rootGen, prevXref)
+	if info := infoPattern.Find(trailer); info != nil {
+		update.WriteString(" " + string(info))
+	}
+	if id := idPattern.Find(trailer); id != nil {
+		update.WriteString(" " + string(id))
+	}
+	fmt.Fprintf(&update, " >>\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+
+	file, err := os.OpenFile(pdfPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open pdf for XMP: %w", err)
+	}
+	if _, err := file.Write(update.Bytes()); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write XMP: %w", err)
+	}
+	return file.Close()
+}
+
+// findDictionary returns the contents of the dictionary of the last
+// definition of an object, without the enclosing << >>
+func findDictionary(data []byte, num, gen int) ([]byte, error) {
+	header := regexp.MustCompile(fmt.Sprintf(`(?:^|[\s>])%d\s+%d\s+obj\s*<<`, num, gen))
+	matches := header.FindAllIndex(data, -1)
+	if matches == nil {
+		return nil, fmt.Errorf("document catalog not found (it may be in a compressed object stream)")
+	}
+	start := matches[len(matches)-1][1]
+
+	depth := 1
+	for i := start; i < len(data)-1; i++ {
+		switch data[i] {
+		case '(':
+			// Skip literal strings, which may contain unbalanced brackets
+			nesting := 0
+		literal:
+			for ; i < len(data); i++ {
+				switch data[i] {
+				case '\\':
+					i++
+				case '(':
+					nesting++
+				case ')':
+					if nesting--; nesting == 0 {
+						break literal
+					}
+				}
+			}
+		case '<':
+			if data[i+1] == '<' {
+				depth++
+				i++
+			}
+		case '>':
+			if data[i+1] == '>' {
+				depth--
+				if depth == 0 {
+					return data[start:i], nil
+				}
+				i++
+			}
+		}
+	}
+	return nil, fmt.Errorf("document catalog is truncated")
+}
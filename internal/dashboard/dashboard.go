@@ -0,0 +1,377 @@
+package dashboard
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"emil/internal/models"
+)
+
+// Snapshot is the state of a run shown on the dashboard
+type Snapshot struct {
+	Stats          models.Stats        `json:"stats"`
+	Elapsed        float64             `json:"elapsed_seconds"`
+	QueueDepth     int                 `json:"queue_depth"`     // Tasks waiting for a worker
+	QueueCapacity  int                 `json:"queue_capacity"`  // Tasks the queues hold
+	Paused         bool                `json:"paused"`          // Whether intake of new files is paused
+	FilesPerSec    float64             `json:"files_per_sec"`   // Over the whole run
+	MemoryUsage    float64             `json:"memory_usage"`    // Percent of system memory
+	RecentFailures []models.FileReport `json:"recent_failures"` // Newest first
+	RecentAlerts   []Alert             `json:"recent_alerts"`   // Newest first
+}
+
+// Alert is a security alert with the file it was found in
+type Alert struct {
+	InputPath string    `json:"input_path"`
+	Severity  string    `json:"severity"` // info, warning or critical
+	Alert     string    `json:"alert"`
+	Time      time.Time `json:"time"`
+}
+
+// Tuning holds the settings that can be changed while a run is in progress.
+// In a request, fields left out are not changed.
+type Tuning struct {
+	Workers      *int `json:"workers,omitempty"`     // Most workers the run scales up to
+	MaxMemoryPct *int `json:"max_mem,omitempty"`     // Memory usage percentage workers are scaled to stay under
+	MaxRenders   *int `json:"max_renders,omitempty"` // Chrome renders running at once (0 = one per worker)
+}
+
+// Server serves the dashboard page and its JSON feed
+type Server struct {
+	server   *http.Server
+	mux      *http.ServeMux
+	token    string // Bearer token the control endpoints, and off loopback every endpoint with data, require (empty = loopback only)
+	loopback bool   // Whether the address is bound to loopback
+}
+
+// Check returns nil when the part of emil it checks is healthy
+type Check func() error
+
+// checkResult is the JSON body of a health endpoint
+type checkResult struct {
+	Status string            `json:"status"` // "ok" or "failing"
+	Checks map[string]string `json:"checks"` // "ok" or the error, by check name
+}
+
+// New creates a dashboard listening on address that shows what snapshot
+// returns. The control endpoints added with HandleAction and HandleTuning
+// require token as a bearer token; without one they are served only when
+// address is bound to loopback. Off loopback, the status feed and the
+// endpoints added with HandleChecks and HandleTuning need the token to be
+// read as well.
+func New(address, token string, snapshot func() Snapshot) *Server {
+	mux := http.NewServeMux()
+	host, _, _ := net.SplitHostPort(address)
+	s := &Server{
+		server:   &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+		mux:      mux,
+		token:    token,
+		loopback: isLoopback(host),
+	}
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	})
+	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorizeRead(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(snapshot())
+	})
+	return s
+}
+
+// Controllable reports whether the control endpoints can be used: a token is
+// set or the dashboard is bound to loopback
+func (s *Server) Controllable() bool {
+	return s.token != "" || s.loopback
+}
+
+// isLoopback reports whether host names the loopback interface
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// authorize checks a request to a control endpoint, answering it with an
+// error if it fails. The body must be JSON, which a page on another site can
+// only send after a CORS preflight the dashboard never grants, so a browser
+// can't be made to forge one. The request must also carry the token or, with
+// none set, reach a loopback-bound dashboard by a loopback host name, so a
+// rebound DNS name can't reach it either.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		return true
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "content type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+	if s.token != "" {
+		return s.checkToken(w, r)
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if !s.loopback || !isLoopback(host) {
+		http.Error(w, "control requires EMIL_DASHBOARD_TOKEN unless the dashboard is bound to loopback", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authorizeRead checks a request for the run's data, answering it with an
+// error if it fails. On loopback anyone who can connect may read; elsewhere
+// the request must carry the token, and with none set nothing is served.
+func (s *Server) authorizeRead(w http.ResponseWriter, r *http.Request) bool {
+	if s.loopback {
+		return true
+	}
+	if s.token == "" {
+		http.Error(w, "the dashboard needs EMIL_DASHBOARD_TOKEN unless it is bound to loopback", http.StatusForbidden)
+		return false
+	}
+	return s.checkToken(w, r)
+}
+
+// checkToken answers a request with 401 unless it carries the token as a
+// bearer token
+func (s *Server) checkToken(w http.ResponseWriter, r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// HandleChecks serves a health endpoint that runs every check on each request,
+// answering 200 when all pass and 503 otherwise. Call it before Start.
+func (s *Server) HandleChecks(pattern string, checks map[string]Check) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorizeRead(w, r) {
+			return
+		}
+		result := checkResult{Status: "ok", Checks: make(map[string]string, len(checks))}
+		for name, check := range checks {
+			if err := check(); err != nil {
+				result.Status = "failing"
+				result.Checks[name] = err.Error()
+			} else {
+				result.Checks[name] = "ok"
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if result.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(result)
+	})
+}
+
+// HandleAction serves an endpoint that runs action on each POST request,
+// whose body must be empty or {}, and answers with whether it changed
+// anything. Call it before Start.
+func (s *Server) HandleAction(pattern string, action func() bool) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !s.authorize(w, r) {
+			return
+		}
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&struct{}{}); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(map[string]bool{"changed": action()})
+	})
+}
+
+// HandleTuning serves an endpoint that returns the current settings on GET
+// and applies the settings in a JSON Tuning body on POST. Call it before Start.
+func (s *Server) HandleTuning(pattern string, current func() Tuning, apply func(Tuning) error) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			if !s.authorizeRead(w, r) {
+				return
+			}
+		case http.MethodPost:
+			if !s.authorize(w, r) {
+				return
+			}
+			var tuning Tuning
+			decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&tuning); err != nil {
+				http.Error(w, fmt.Sprintf("invalid settings: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := apply(tuning); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(current())
+	})
+}
+
+// Start listens in the background until ctx is cancelled. It fails only if
+// the address cannot be bound.
+func (s *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start dashboard: %w", err)
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Warning: dashboard stopped: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		s.server.Shutdown(shutdownCtx)
+	}()
+	return nil
+}
+
+// page polls /api/status and redraws itself
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<title>Emil dashboard</title>
+<style>
+body { font-family: Arial, sans-serif; margin: 30px; color: #222; }
+h1 { margin-bottom: 0; }
+#updated { color: #666; margin-top: 4px; }
+.cards { display: flex; flex-wrap: wrap; gap: 12px; margin: 20px 0; }
+.card { border: 1px solid #ddd; border-radius: 4px; padding: 10px 16px; min-width: 120px; }
+.card .value { font-size: 22px; font-weight: bold; }
+.card .label { color: #666; font-size: 12px; }
+.card.bad .value { color: #b00; }
+progress { width: 100%; height: 18px; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 30px; font-size: 13px; }
+th, td { border: 1px solid #ddd; padding: 5px 8px; text-align: left; vertical-align: top; }
+th { background: #f3f3f3; }
+td.path { word-break: break-all; }
+</style>
+</head>
+<body>
+<h1>Emil dashboard</h1>
+<div id="updated">Connecting...</div>
+<div class="cards" id="cards"></div>
+<progress id="progress" value="0" max="1"></progress>
+<h2>Recent failures</h2>
+<table><thead><tr><th>File</th><th>Error</th><th>Retries</th><th>Finished</th></tr></thead><tbody id="failures"></tbody></table>
+<h2>Recent security alerts</h2>
+<table><thead><tr><th>File</th><th>Severity</th><th>Alert</th><th>Time</th></tr></thead><tbody id="alerts"></tbody></table>
+<script>
+function cell(text, cls) {
+  var td = document.createElement("td");
+  td.textContent = text;
+  if (cls) td.className = cls;
+  return td;
+}
+function rows(id, items, columns) {
+  var body = document.getElementById(id);
+  body.textContent = "";
+  if (!items || items.length === 0) {
+    var tr = document.createElement("tr");
+    var td = cell("None.");
+    td.colSpan = 4;
+    tr.appendChild(td);
+    body.appendChild(tr);
+    return;
+  }
+  items.forEach(function (item) {
+    var tr = document.createElement("tr");
+    columns(item).forEach(function (td) { tr.appendChild(td); });
+    body.appendChild(tr);
+  });
+}
+function card(value, label, bad) {
+  return '<div class="card' + (bad ? ' bad' : '') + '"><div class="value">' + value + '</div><div class="label">' + label + '</div></div>';
+}
+function time(t) { return new Date(t).toLocaleTimeString(); }
+// Off loopback, open the dashboard as /#token=... and the token is sent with
+// each request; a fragment never reaches the server or its logs
+var token = (location.hash.match(/token=([^&]*)/) || [])[1];
+var headers = token ? { Authorization: "Bearer " + decodeURIComponent(token) } : {};
+function refresh() {
+  fetch("api/status", { headers: headers }).then(function (r) {
+    if (!r.ok) { throw new Error(r.statusText); }
+    return r.json();
+  }).then(function (s) {
+    var st = s.stats;
+    document.getElementById("cards").innerHTML =
+      card(st.Processed + " / " + (st.Discovered - st.Deferred), "processed") +
+      card(st.Successful, "converted") +
+      card(st.Failed, "failed", st.Failed > 0) +
+      card(s.queue_depth + " / " + s.queue_capacity, "queued") +
+      card(st.Processing, "in progress") +
+      (s.paused ? card("paused", "intake", true) : "") +
+      card(st.CurrentWorkers, "workers") +
+      card(s.files_per_sec.toFixed(2), "files per second") +
+      card(s.memory_usage.toFixed(1) + "%", "memory") +
+      card((s.recent_alerts || []).length, "recent alerts", (s.recent_alerts || []).length > 0);
+    var progress = document.getElementById("progress");
+    progress.max = Math.max(st.Discovered - st.Deferred, 1);
+    progress.value = st.Processed;
+    rows("failures", s.recent_failures, function (f) {
+      return [cell(f.input_path, "path"), cell(f.error), cell(f.retries), cell(time(f.finished_at))];
+    });
+    rows("alerts", s.recent_alerts, function (a) {
+      return [cell(a.input_path, "path"), cell(a.severity), cell(a.alert), cell(time(a.time))];
+    });
+    document.getElementById("updated").textContent = "Updated " + new Date().toLocaleTimeString() + ", running for " + Math.round(s.elapsed_seconds) + "s";
+  }).catch(function () {
+    document.getElementById("updated").textContent = "Run finished or emil is not reachable";
+  });
+}
+refresh();
+setInterval(refresh, 2000);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package discovery
+
+import "os"
+
+// deviceOf is not available on this platform, so filesystem boundaries are
+// not detected
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,269 @@
+package discovery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Symbolic link policies
+const (
+	SymlinksFiles  = "files"  // Follow links to files, skip links to directories
+	SymlinksFollow = "follow" // Follow links to files and directories, skipping cycles
+	SymlinksSkip   = "skip"   // Skip every link
+)
+
+// Options controls how a directory tree is walked
+type Options struct {
+	Recursive     bool                      // Whether to descend into subdirectories
+	Symlinks      string                    // Symbolic link policy (empty = SymlinksFiles)
+	OneFilesystem bool                      // Whether to stay on the filesystem of the root
+	Skipped       func(path, reason string) // Called for every link or directory left out (may be nil)
+
+	// Directories read at once; above one, Skipped and Match are called
+	// from several goroutines (0 or 1 = one at a time)
+	Parallelism int
+	// Picks the regular files to visit, such as by extension or content,
+	// while directories are still being read (nil = every file)
+	Match func(path string, info os.FileInfo) bool
+	// Picks the directories left out, such as those holding a run's outputs
+	// (nil = none)
+	SkipDir func(path string) bool
+}
+
+// CheckSymlinks validates a symbolic link policy
+func CheckSymlinks(policy string) error {
+	switch policy {
+	case "", SymlinksFiles, SymlinksFollow, SymlinksSkip:
+		return nil
+	}
+	return fmt.Errorf("invalid symlink policy %q (use %s, %s or %s)", policy, SymlinksFiles, SymlinksFollow, SymlinksSkip)
+}
+
+// walker holds the state of one walk
+type walker struct {
+	opts      Options
+	device    uint64
+	visitedMu sync.Mutex
+	visited   map[string]bool
+	visit     func(path string, info os.FileInfo) error
+	slots     chan struct{} // Held by each directory read in its own goroutine (nil = one at a time)
+}
+
+// found is a file a parallel walk will visit
+type found struct {
+	path string
+	info os.FileInfo
+}
+
+// Walk calls visit for every regular file under root, in lexical order,
+// applying the symbolic link and filesystem policies of opts. Followed links
+// are reported with the information of their target. With a Parallelism
+// above one, directories are read concurrently and the files are visited,
+// still in order and one at a time, once the whole tree has been read.
+func Walk(root string, opts Options, visit func(path string, info os.FileInfo) error) error {
+	if opts.Symlinks == "" {
+		opts.Symlinks = SymlinksFiles
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+
+	w := &walker{opts: opts, visited: make(map[string]bool), visit: visit}
+	w.device, _ = deviceOf(info)
+	if opts.Parallelism <= 1 {
+		return w.walkDir(root)
+	}
+
+	w.slots = make(chan struct{}, opts.Parallelism-1)
+	files, err := w.collectDir(root)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := visit(file.path, file.info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkDir visits the entries of a directory the walk has not been in before
+func (w *walker) walkDir(dir string) error {
+	if first, err := w.firstVisit(dir); err != nil || !first {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		info, err := w.entry(path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info == nil:
+		case info.IsDir():
+			if !w.opts.Recursive || w.skipDir(path) {
+				continue
+			}
+			if err := w.walkDir(path); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular() && w.matches(path, info):
+			if err := w.visit(path, info); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// segment is a run of a directory's files, or the files under one of its
+// subdirectories, read in a goroutine that closes done
+type segment struct {
+	files []found
+	err   error
+	done  chan struct{} // nil = read inline
+}
+
+// collectDir returns the files to visit under a directory the walk has not
+// been in before, in lexical order. Subdirectories are read in goroutines
+// of their own while slots are free, and inline otherwise.
+func (w *walker) collectDir(dir string) ([]found, error) {
+	if first, err := w.firstVisit(dir); err != nil || !first {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []*segment
+	var files *segment
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		info, err := w.entry(path)
+		if err != nil {
+			segments = append(segments, &segment{err: err})
+			break
+		}
+
+		switch {
+		case info == nil:
+		case info.IsDir():
+			if !w.opts.Recursive || w.skipDir(path) {
+				continue
+			}
+			sub := &segment{}
+			segments = append(segments, sub)
+			files = nil
+			select {
+			case w.slots <- struct{}{}:
+				sub.done = make(chan struct{})
+				go func() {
+					defer close(sub.done)
+					defer func() { <-w.slots }()
+					sub.files, sub.err = w.collectDir(path)
+				}()
+			default:
+				sub.files, sub.err = w.collectDir(path)
+			}
+		case info.Mode().IsRegular() && w.matches(path, info):
+			if files == nil {
+				files = &segment{}
+				segments = append(segments, files)
+			}
+			files.files = append(files.files, found{path: path, info: info})
+		}
+	}
+
+	var all []found
+	var firstErr error
+	for _, seg := range segments {
+		if seg.done != nil {
+			<-seg.done
+		}
+		if seg.err != nil && firstErr == nil {
+			firstErr = seg.err
+		}
+		all = append(all, seg.files...)
+	}
+	return all, firstErr
+}
+
+// firstVisit reports whether the walk is entering a directory for the first
+// time, skipping it otherwise
+func (w *walker) firstVisit(dir string) (bool, error) {
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return false, err
+	}
+	w.visitedMu.Lock()
+	seen := w.visited[real]
+	w.visited[real] = true
+	w.visitedMu.Unlock()
+	if seen {
+		w.skip(dir, "directory already visited (symlink cycle or duplicate link)")
+		return false, nil
+	}
+	return true, nil
+}
+
+// entry returns the information of a directory entry, that of the target
+// for a followed link, or nil if the walk's policies leave it out
+func (w *walker) entry(path string) (os.FileInfo, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		if w.opts.Symlinks == SymlinksSkip {
+			w.skip(path, "symbolic link")
+			return nil, nil
+		}
+		if info, err = os.Stat(path); err != nil {
+			w.skip(path, "broken symbolic link")
+			return nil, nil
+		}
+		if info.IsDir() && w.opts.Symlinks != SymlinksFollow {
+			w.skip(path, "symbolic link to a directory")
+			return nil, nil
+		}
+	}
+
+	if w.opts.OneFilesystem {
+		if device, ok := deviceOf(info); ok && device != w.device {
+			w.skip(path, "on another filesystem")
+			return nil, nil
+		}
+	}
+	return info, nil
+}
+
+// matches reports whether a regular file is one to visit
+func (w *walker) matches(path string, info os.FileInfo) bool {
+	return w.opts.Match == nil || w.opts.Match(path, info)
+}
+
+// skipDir reports whether a directory is left out by the walk's SkipDir
+func (w *walker) skipDir(path string) bool {
+	return w.opts.SkipDir != nil && w.opts.SkipDir(path)
+}
+
+// skip reports a path left out of the walk
+func (w *walker) skip(path, reason string) {
+	if w.opts.Skipped != nil {
+		w.opts.Skipped(path, reason)
+	}
+}
@@ -0,0 +1,136 @@
+package discovery
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// Bytes read from the start of a file when sniffing its content
+const sniffWindow = 4096
+
+// Bytes read from the start of a message when classifying it as text-only;
+// enough for the structure of most messages, short of large attachments
+const classifyWindow = 64 * 1024
+
+// Headers at least one of which starts nearly every stored message
+var messageHeaders = map[string]bool{
+	"from": true, "to": true, "date": true, "subject": true, "received": true,
+	"message-id": true, "return-path": true, "mime-version": true, "delivered-to": true,
+}
+
+// MatchesExtension reports whether a path has one of the extensions, which
+// may be given with or without leading dots and in any case
+func MatchesExtension(path string, extensions []string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range extensions {
+		if strings.HasSuffix(lower, "."+strings.ToLower(strings.TrimPrefix(ext, "."))) {
+			return true
+		}
+	}
+	return false
+}
+
+// LooksLikeMessage reports whether a file starts like an RFC 822 message: a
+// block of "Name: value" header lines, including at least one header every
+// message is expected to carry. Journaling systems often write messages
+// without an extension, so this finds them by content.
+func LooksLikeMessage(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(io.LimitReader(file, sniffWindow))
+	headers, known := 0, false
+	for {
+		line, err := reader.ReadString('\n')
+		trimmed := strings.TrimRight(line, "\r\n")
+
+		switch {
+		case trimmed == "":
+			// A blank line ends the header block
+			return headers > 0 && known
+		case line[0] == ' ' || line[0] == '\t':
+			// Folded continuation of the previous header
+			if headers == 0 {
+				return false
+			}
+		default:
+			name, _, ok := strings.Cut(trimmed, ":")
+			if !ok || name == "" || strings.ContainsAny(name, " \t") {
+				return false
+			}
+			for _, r := range name {
+				if r < 33 || r > 126 {
+					return false
+				}
+			}
+			headers++
+			known = known || messageHeaders[strings.ToLower(name)]
+		}
+
+		if err != nil {
+			// The whole window was headers
+			return headers > 0 && known
+		}
+	}
+}
+
+// TextOnly reports whether a message has no HTML part, so it can be
+// converted without a browser. The top-level Content-Type is read and, for
+// multipart and message types, the start of the file is searched for an
+// HTML part. Messages whose structure isn't clear from the start, and types
+// that may hide HTML such as encrypted or TNEF mail, are not text-only.
+func TextOnly(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	window := make([]byte, classifyWindow+1)
+	n, err := io.ReadFull(file, window)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false
+	}
+	whole := n <= classifyWindow
+	window = window[:min(n, classifyWindow)]
+
+	mediaType := topContentType(string(window))
+	switch {
+	case mediaType == "" || mediaType == "text/plain":
+		return true
+	case strings.HasPrefix(mediaType, "multipart/") || mediaType == "message/rfc822":
+		return whole && !strings.Contains(strings.ToLower(string(window)), "text/html")
+	}
+	return false
+}
+
+// topContentType returns the lower-cased media type of the Content-Type
+// header in a message's header block, or "" if it has none
+func topContentType(message string) string {
+	var value string
+	inContentType := false
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if inContentType {
+				value += line
+			}
+			continue
+		}
+		name, rest, _ := strings.Cut(line, ":")
+		inContentType = strings.EqualFold(strings.TrimSpace(name), "Content-Type")
+		if inContentType {
+			value = rest
+		}
+	}
+	mediaType, _, _ := strings.Cut(value, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
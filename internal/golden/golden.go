@@ -0,0 +1,106 @@
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// maxDifferences is how many differences are reported per fixture; later ones
+// usually follow from the first
+const maxDifferences = 5
+
+// Features are the parts of a rendered message compared with its golden file:
+// which renderer produced it, how many files it was written as, and the text
+// of every page
+type Features struct {
+	Renderer string     `json:"renderer"`
+	Outputs  int        `json:"outputs"`
+	Pages    [][]string `json:"pages"`
+}
+
+// Extract reads the features of the PDFs written for a message, in order
+func Extract(renderer string, pdfPaths []string) (Features, error) {
+	features := Features{Renderer: renderer, Outputs: len(pdfPaths)}
+	for _, path := range pdfPaths {
+		pages, err := pageText(path)
+		if err != nil {
+			return features, err
+		}
+		features.Pages = append(features.Pages, pages...)
+	}
+	return features, nil
+}
+
+// Load reads a golden file. It returns an error wrapping os.ErrNotExist if
+// the fixture has none yet.
+func Load(path string) (Features, error) {
+	var features Features
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return features, fmt.Errorf("no golden file %s (run with -update to record it): %w", path, err)
+		}
+		return features, fmt.Errorf("failed to read golden file: %w", err)
+	}
+	if err := json.Unmarshal(data, &features); err != nil {
+		return features, fmt.Errorf("invalid golden file %s: %w", path, err)
+	}
+	return features, nil
+}
+
+// Save writes a golden file, indented so changes review well as diffs
+func Save(path string, features Features) error {
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false) // Keep addresses like <a@example.com> readable
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(features); err != nil {
+		return fmt.Errorf("failed to encode golden file: %w", err)
+	}
+	if err := os.WriteFile(path, data.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write golden file: %w", err)
+	}
+	return nil
+}
+
+// Compare returns the differences between the expected and rendered features,
+// at most maxDifferences of them; none means the output matches
+func Compare(want, got Features) []string {
+	var diffs []string
+	if want.Renderer != got.Renderer {
+		diffs = append(diffs, fmt.Sprintf("renderer: want %s, got %s", want.Renderer, got.Renderer))
+	}
+	if want.Outputs != got.Outputs {
+		diffs = append(diffs, fmt.Sprintf("output files: want %d, got %d", want.Outputs, got.Outputs))
+	}
+	if len(want.Pages) != len(got.Pages) {
+		diffs = append(diffs, fmt.Sprintf("pages: want %d, got %d", len(want.Pages), len(got.Pages)))
+	}
+
+	for page := 0; page < min(len(want.Pages), len(got.Pages)); page++ {
+		wantLines, gotLines := want.Pages[page], got.Pages[page]
+		for line := 0; line < max(len(wantLines), len(gotLines)); line++ {
+			var w, g string
+			if line < len(wantLines) {
+				w = wantLines[line]
+			}
+			if line < len(gotLines) {
+				g = gotLines[line]
+			}
+			if w != g {
+				// Lines after an insertion or removal all shift, so report
+				// only the first difference on each page
+				diffs = append(diffs, fmt.Sprintf("page %d line %d: want %q, got %q", page+1, line+1, w, g))
+				break
+			}
+		}
+	}
+
+	if len(diffs) > maxDifferences {
+		diffs = diffs[:maxDifferences]
+	}
+	return diffs
+}
@@ -0,0 +1,351 @@
+package golden
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// Lines whose baselines are closer than this, in points, are read as one
+const lineTolerance = 2.0
+
+// TJ adjustments wider than this, in thousandths of an em, are read as a space
+const wordGap = 250
+
+// matrix is a PDF transformation matrix [a b c d e f]
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m applied before n
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2], m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2], m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4], m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// textRun is text shown at one position on a page
+type textRun struct {
+	x, y float64
+	text string
+}
+
+// pageText returns the lines of text on each page of a PDF, top to bottom,
+// with runs of whitespace collapsed and blank lines dropped so small layout
+// shifts don't count as differences. It is read with a pure Go parser so the
+// golden files can be checked wherever the tests run.
+func pageText(path string) ([][]string, error) {
+	file, reader, err := pdf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	pages := make([][]string, 0, reader.NumPage())
+	for i := 1; i <= reader.NumPage(); i++ {
+		runs, err := pageRuns(reader.Page(i))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read page %d of %s: %w", i, path, err)
+		}
+		pages = append(pages, joinLines(runs))
+	}
+	return pages, nil
+}
+
+// pageRuns interprets a page's content streams and returns the text they show
+func pageRuns(page pdf.Page) (runs []textRun, err error) {
+	// The parser panics on malformed content
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	decoders := make(map[string]func(string) string)
+	var decode func(string) string
+	ctm, tm, tlm := identity, identity, identity
+	var saved []matrix
+	var leading float64
+
+	show := func(raw string) {
+		if decode == nil {
+			return
+		}
+		at := tm.mul(ctm)
+		runs = append(runs, textRun{x: at[4], y: at[5], text: decode(raw)})
+	}
+	moveLine := func(tx, ty float64) {
+		tlm = matrix{1, 0, 0, 1, tx, ty}.mul(tlm)
+		tm = tlm
+	}
+
+	interpret := func(stream pdf.Value) {
+		pdf.Interpret(stream, func(stk *pdf.Stack, op string) {
+			args := make([]pdf.Value, stk.Len())
+			for i := len(args) - 1; i >= 0; i-- {
+				args[i] = stk.Pop()
+			}
+			number := func(i int) float64 {
+				if i < len(args) {
+					return args[i].Float64()
+				}
+				return 0
+			}
+
+			switch op {
+			case "q":
+				saved = append(saved, ctm)
+			case "Q":
+				if n := len(saved); n > 0 {
+					ctm, saved = saved[n-1], saved[:n-1]
+				}
+			case "cm":
+				ctm = matrix{number(0), number(1), number(2), number(3), number(4), number(5)}.mul(ctm)
+			case "BT":
+				tm, tlm = identity, identity
+			case "Tf":
+				if len(args) > 0 {
+					name := args[0].Name()
+					if _, ok := decoders[name]; !ok {
+						decoders[name] = fontDecoder(page, name)
+					}
+					decode = decoders[name]
+				}
+			case "TL":
+				leading = number(0)
+			case "Td":
+				moveLine(number(0), number(1))
+			case "TD":
+				leading = -number(1)
+				moveLine(number(0), number(1))
+			case "Tm":
+				tm = matrix{number(0), number(1), number(2), number(3), number(4), number(5)}
+				tlm = tm
+			case "T*":
+				moveLine(0, -leading)
+			case "Tj":
+				if len(args) > 0 {
+					show(args[0].RawString())
+				}
+			case "'":
+				moveLine(0, -leading)
+				if len(args) > 0 {
+					show(args[0].RawString())
+				}
+			case "\"":
+				moveLine(0, -leading)
+				if len(args) > 2 {
+					show(args[2].RawString())
+				}
+			case "TJ":
+				if len(args) == 0 || decode == nil {
+					return
+				}
+				var text strings.Builder
+				parts := args[0]
+				for i := 0; i < parts.Len(); i++ {
+					part := parts.Index(i)
+					if part.Kind() == pdf.String {
+						text.WriteString(decode(part.RawString()))
+					} else if part.Float64() < -wordGap {
+						text.WriteString(" ")
+					}
+				}
+				at := tm.mul(ctm)
+				runs = append(runs, textRun{x: at[4], y: at[5], text: text.String()})
+			}
+		})
+	}
+
+	contents := page.V.Key("Contents")
+	if contents.Kind() == pdf.Array {
+		for i := 0; i < contents.Len(); i++ {
+			interpret(contents.Index(i))
+		}
+	} else if contents.Kind() == pdf.Stream {
+		interpret(contents)
+	}
+	return runs, nil
+}
+
+// joinLines groups text runs into lines by their baselines, top to bottom
+// and left to right, separating runs shown at different positions with a space
+func joinLines(runs []textRun) []string {
+	sort.SliceStable(runs, func(i, j int) bool {
+		if math.Abs(runs[i].y-runs[j].y) >= lineTolerance {
+			return runs[i].y > runs[j].y
+		}
+		return runs[i].x < runs[j].x
+	})
+
+	lines := []string{}
+	var line []string
+	var lineY float64
+	flush := func() {
+		if text := strings.Join(strings.Fields(strings.Join(line, " ")), " "); text != "" {
+			lines = append(lines, text)
+		}
+		line = nil
+	}
+	for i, run := range runs {
+		if i > 0 && math.Abs(run.y-lineY) >= lineTolerance {
+			flush()
+		}
+		if len(line) == 0 {
+			lineY = run.y
+		}
+		line = append(line, run.text)
+	}
+	flush()
+	return lines
+}
+
+// fontDecoder returns the function turning a font's character codes into
+// text: its ToUnicode map if it has one, else its simple encoding
+func fontDecoder(page pdf.Page, name string) func(string) string {
+	font := page.Resources().Key("Font").Key(name)
+	if toUnicode := font.Key("ToUnicode"); toUnicode.Kind() == pdf.Stream {
+		codeLen := 1
+		if font.Key("Subtype").Name() == "Type0" {
+			codeLen = 2
+		}
+		return readCMap(toUnicode, codeLen).decode
+	}
+	return page.Font(name).Encoder().Decode
+}
+
+// cmap maps a font's character codes to Unicode. The pdf package has its own,
+// but it offsets only the last byte of a range, which garbles the two-byte
+// codes of Identity-H fonts such as the basic renderer's Unicode font.
+type cmap struct {
+	codeLen int
+	chars   map[uint32]string
+	ranges  []cmapRange
+}
+
+// cmapRange maps the codes lo to hi to consecutive characters from the first
+// of dst, or to each of dst in turn when it has several
+type cmapRange struct {
+	lo, hi uint32
+	dst    []string // UTF-16BE
+}
+
+var (
+	cmapSection = regexp.MustCompile(`(?s)begin(bfchar|bfrange)(.*?)endbf(?:char|range)`)
+	cmapEntry   = regexp.MustCompile(`<([0-9A-Fa-f\s]*)>|\[|\]`)
+)
+
+// readCMap parses the bfchar and bfrange sections of a ToUnicode stream for
+// codes of codeLen bytes
+func readCMap(stream pdf.Value, codeLen int) *cmap {
+	m := &cmap{codeLen: codeLen, chars: make(map[uint32]string)}
+	data, err := io.ReadAll(stream.Reader())
+	if err != nil {
+		return m
+	}
+	for _, section := range cmapSection.FindAllSubmatch(data, -1) {
+		// Flatten the section into entries, each a hex string or an array of them
+		var entries [][]string
+		var array []string
+		inArray := false
+		for _, token := range cmapEntry.FindAllSubmatch(section[2], -1) {
+			switch string(token[0]) {
+			case "[":
+				inArray, array = true, nil
+			case "]":
+				inArray = false
+				entries = append(entries, array)
+			default:
+				value := hexString(string(token[1]))
+				if inArray {
+					array = append(array, value)
+				} else {
+					entries = append(entries, []string{value})
+				}
+			}
+		}
+
+		if string(section[1]) == "bfchar" {
+			for i := 0; i+1 < len(entries); i += 2 {
+				m.chars[code(entries[i][0])] = utf16Text(entries[i+1][0], 0)
+			}
+			continue
+		}
+		for i := 0; i+2 < len(entries); i += 3 {
+			m.ranges = append(m.ranges, cmapRange{lo: code(entries[i][0]), hi: code(entries[i+1][0]), dst: entries[i+2]})
+		}
+	}
+	return m
+}
+
+// hexString decodes the digits of a PDF hex string, ignoring whitespace; an
+// odd final digit is followed by 0, as the format says
+func hexString(digits string) string {
+	digits = strings.Join(strings.Fields(digits), "")
+	if len(digits)%2 == 1 {
+		digits += "0"
+	}
+	raw, _ := hex.DecodeString(digits)
+	return string(raw)
+}
+
+// decode returns the text of a string of character codes
+func (m *cmap) decode(raw string) string {
+	var text strings.Builder
+	for len(raw) >= m.codeLen {
+		c := code(raw[:m.codeLen])
+		raw = raw[m.codeLen:]
+		text.WriteString(m.lookup(c))
+	}
+	return text.String()
+}
+
+// lookup returns the text of one character code, or U+FFFD if it isn't mapped
+func (m *cmap) lookup(c uint32) string {
+	if s, ok := m.chars[c]; ok {
+		return s
+	}
+	for _, r := range m.ranges {
+		if c < r.lo || c > r.hi {
+			continue
+		}
+		if len(r.dst) == 1 {
+			return utf16Text(r.dst[0], c-r.lo)
+		}
+		if i := int(c - r.lo); i < len(r.dst) {
+			return utf16Text(r.dst[i], 0)
+		}
+	}
+	return "\uFFFD"
+}
+
+// code reads a big-endian character code
+func code(raw string) uint32 {
+	var c uint32
+	for i := 0; i < len(raw); i++ {
+		c = c<<8 | uint32(raw[i])
+	}
+	return c
+}
+
+// utf16Text decodes UTF-16BE text, adding offset to its last code unit as a
+// ToUnicode range does for each code past its first
+func utf16Text(raw string, offset uint32) string {
+	units := make([]uint16, 0, len(raw)/2)
+	for i := 0; i+1 < len(raw); i += 2 {
+		units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+	}
+	if len(units) > 0 {
+		units[len(units)-1] += uint16(offset)
+	}
+	return string(utf16.Decode(units))
+}
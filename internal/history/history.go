@@ -0,0 +1,260 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"emil/internal/models"
+)
+
+// Thresholds for flagging a run as worse than the one before it
+const (
+	failureRateIncrease = 0.01 // Failure rate up by more than one percentage point
+	throughputDrop      = 0.2  // Files per second down by more than 20%
+)
+
+// Run is the summary kept for one conversion run. The history file holds one
+// JSON object per line, oldest first, so runs can be appended safely. The
+// per-file outcomes of the runs are kept apart in a FilesPath file, so the
+// summaries stay small however large the runs grow.
+type Run struct {
+	ID          string    `json:"id"` // Identifies the run's rows in the files file
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	Version     string    `json:"version"`
+	SourceDir   string    `json:"source_dir"`
+	Workers     int       `json:"workers"`
+	Discovered  int       `json:"discovered"`
+	Successful  int       `json:"successful"`
+	Failed      int       `json:"failed"`
+	TotalBytes  int64     `json:"total_bytes"`
+	FilesPerSec float64   `json:"files_per_sec"`
+	MBPerSec    float64   `json:"mb_per_sec"`
+}
+
+// FileRow is one file's outcome in a run, as kept in the files file
+type FileRow struct {
+	Run string `json:"run"` // ID of the run
+	models.FileReport
+}
+
+// FilesPath returns the file the per-file outcomes of the runs in the
+// history at path are kept in, e.g. emil-history.files.jsonl
+func FilesPath(path string) string {
+	ext := ".jsonl"
+	if strings.HasSuffix(path, ext) {
+		return strings.TrimSuffix(path, ext) + ".files" + ext
+	}
+	return path + ".files"
+}
+
+// FailureRate returns the share of processed files that failed
+func (r Run) FailureRate() float64 {
+	if processed := r.Successful + r.Failed; processed > 0 {
+		return float64(r.Failed) / float64(processed)
+	}
+	return 0
+}
+
+// NewRun builds the history summary for a finished run
+func NewRun(stats models.Stats, sourceDir string, workers int) Run {
+	run := Run{
+		ID:         stats.StartTime.UTC().Format("20060102T150405.000000000Z"),
+		StartTime:  stats.StartTime,
+		EndTime:    stats.EndTime,
+		Version:    Version(),
+		SourceDir:  sourceDir,
+		Workers:    workers,
+		Discovered: stats.Discovered,
+		Successful: stats.Successful,
+		Failed:     stats.Failed,
+		TotalBytes: stats.TotalFileSize,
+	}
+	if seconds := run.EndTime.Sub(run.StartTime).Seconds(); seconds > 0 {
+		run.FilesPerSec = float64(stats.Processed) / seconds
+		run.MBPerSec = float64(stats.TotalFileSize) / seconds / (1024 * 1024)
+	}
+	return run
+}
+
+// Version identifies the emil build, from the module version or VCS revision
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	version := info.Main.Version
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			if version == "" || version == "(devel)" {
+				return setting.Value[:12]
+			}
+		}
+	}
+	if version == "" {
+		return "unknown"
+	}
+	return version
+}
+
+// Append adds a run to the history file and its files' outcomes to the
+// files file, creating them if needed. The outcomes are written first, so a
+// run is only listed once all of them are recorded.
+func Append(path string, run Run, files []models.FileReport) error {
+	if err := appendLines(FilesPath(path), func(encoder *json.Encoder) error {
+		for _, file := range files {
+			if err := encoder.Encode(FileRow{Run: run.ID, FileReport: file}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return appendLines(path, func(encoder *json.Encoder) error { return encoder.Encode(run) })
+}
+
+// appendLines opens a JSON lines file for appending and calls write with an
+// encoder writing to it
+func appendLines(path string, write func(*json.Encoder) error) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open run history: %w", err)
+	}
+	defer file.Close()
+
+	buffered := bufio.NewWriter(file)
+	if err := write(json.NewEncoder(buffered)); err != nil {
+		return fmt.Errorf("failed to write run history: %w", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to write run history: %w", err)
+	}
+	return nil
+}
+
+// Load reads the last runs in the history file, oldest first (last <= 0 =
+// all). The file is streamed, so only the runs returned are held in memory.
+func Load(path string, last int) ([]Run, error) {
+	var runs []Run
+	err := readLines(path, func(decoder *json.Decoder) error {
+		var run Run
+		if err := decoder.Decode(&run); err != nil {
+			return err
+		}
+		runs = append(runs, run)
+		if last > 0 && len(runs) > last {
+			runs = runs[1:]
+		}
+		return nil
+	})
+	return runs, err
+}
+
+// LoadFiles calls fn with each recorded outcome of the run with the given
+// ID, streaming the files file
+func LoadFiles(path, runID string, fn func(models.FileReport) error) error {
+	return readLines(FilesPath(path), func(decoder *json.Decoder) error {
+		var row FileRow
+		if err := decoder.Decode(&row); err != nil {
+			return err
+		}
+		if row.Run != runID {
+			return nil
+		}
+		return fn(row.FileReport)
+	})
+}
+
+// readLines calls read with a decoder positioned at each JSON value of a
+// history file in turn
+func readLines(path string, read func(*json.Decoder) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no run history at %s (record runs with -history)", path)
+		}
+		return fmt.Errorf("failed to open run history: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for entry := 1; decoder.More(); entry++ {
+		if err := read(decoder); err != nil {
+			return fmt.Errorf("run history %s entry %d is corrupt: %w", path, entry, err)
+		}
+	}
+	return nil
+}
+
+// WriteComparison prints the runs as a table, noting failure-rate and
+// throughput regressions against the previous run
+func WriteComparison(w io.Writer, runs []Run) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "RUN\tSTARTED\tVERSION\tFILES\tFAILED\tFAIL %\tFILES/S\tMB/S\tNOTES")
+
+	for i, run := range runs {
+		notes := ""
+		if i > 0 {
+			notes = compare(runs[i-1], run)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\t%d\t%.2f\t%.2f\t%.2f\t%s\n",
+			run.ID, run.StartTime.Local().Format("2006-01-02 15:04"), run.Version,
+			run.Successful+run.Failed, run.Failed, run.FailureRate()*100,
+			run.FilesPerSec, run.MBPerSec, notes)
+	}
+
+	return table.Flush()
+}
+
+// WriteFiles prints the recorded per-file outcomes of a run as a table,
+// streaming them from the files file
+func WriteFiles(w io.Writer, path, runID string) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "FILE\tSTATUS\tMS\tRETRIES\tERROR")
+
+	found := 0
+	err := LoadFiles(path, runID, func(file models.FileReport) error {
+		found++
+		_, err := fmt.Fprintf(table, "%s\t%s\t%d\t%d\t%s\n", file.InputPath, file.Status, file.DurationMS, file.Retries, file.Error)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if found == 0 {
+		return fmt.Errorf("no files recorded for run %s in %s", runID, FilesPath(path))
+	}
+	return table.Flush()
+}
+
+// compare describes how a run regressed against the one before it
+func compare(previous, run Run) string {
+	notes := ""
+	add := func(note string) {
+		if notes != "" {
+			notes += "; "
+		}
+		notes += note
+	}
+
+	if run.FailureRate()-previous.FailureRate() > failureRateIncrease {
+		add(fmt.Sprintf("failure rate up %.1f points", (run.FailureRate()-previous.FailureRate())*100))
+	}
+	if previous.FilesPerSec > 0 && run.FilesPerSec < previous.FilesPerSec*(1-throughputDrop) {
+		add(fmt.Sprintf("throughput down %.0f%%", (1-run.FilesPerSec/previous.FilesPerSec)*100))
+	}
+	if notes != "" && run.Version != previous.Version {
+		add("after upgrade from " + previous.Version)
+	}
+	return notes
+}
@@ -0,0 +1,26 @@
+package hooks
+
+import (
+	"github.com/jhillyerd/enmime"
+)
+
+// Hooks are optional callbacks run around each stage of a conversion. Any
+// hook may be nil. A hook that returns an error fails the conversion of that
+// file, which is then retried and reported like any other failure.
+type Hooks struct {
+	// PreParse receives the raw message before parsing and returns the bytes
+	// to parse, e.g. with sensitive headers removed
+	PreParse func(emlPath string, raw []byte) ([]byte, error)
+
+	// PostParse may modify the parsed message, e.g. to rewrite headers or body
+	// text. Changes here affect every renderer.
+	PostParse func(emlPath string, envelope *enmime.Envelope) error
+
+	// PreRender receives the complete HTML document before it is handed to an
+	// HTML renderer and returns the document to render. The basic renderer
+	// draws from the parsed message instead, so it is not called for it.
+	PreRender func(emlPath string, document string) (string, error)
+
+	// PostWrite runs once the PDF files are written, e.g. to upload them
+	PostWrite func(emlPath string, pdfPaths []string) error
+}
@@ -0,0 +1,41 @@
+package manager
+
+import (
+	"fmt"
+
+	"emil/internal/converter"
+	"emil/internal/models"
+)
+
+// recordAlerts counts a finished file's security alerts and what the alert
+// policy did with its outputs, and stops the run if the policy says to.
+// Callers hold statsLock.
+func (m *Manager) recordAlerts(update models.StatusUpdate, path string) {
+	stats := update.ProcessingStats
+	m.stats.SecurityAlerts += len(stats.SecurityAlerts)
+	for _, alert := range stats.SecurityAlerts {
+		m.stats.AlertCounts.Add(alert)
+	}
+
+	switch stats.AlertAction {
+	case converter.AlertQuarantine:
+		m.stats.Quarantined++
+	case converter.AlertSkip:
+		m.stats.Withheld++
+	case converter.AlertAbort:
+		m.stats.Withheld++
+		if m.stats.Aborted == "" {
+			m.stats.Aborted = fmt.Sprintf("security alert in %s", path)
+			go m.abortRun(path)
+		}
+	}
+}
+
+// abortRun stops taking on files after an alert whose policy is to abort.
+// Conversions in progress finish; the files not yet started are left for
+// the next run.
+func (m *Manager) abortRun(path string) {
+	m.expire()
+	fmt.Printf("\nSecurity alert in %s; aborting the run once conversions in progress finish\n", path)
+	m.deferQueued()
+}
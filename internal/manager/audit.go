@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+
+	"emil/internal/audit"
+	"emil/internal/history"
+	"emil/internal/models"
+)
+
+// Finished files waiting to be hashed into the audit log
+const auditQueueSize = 1000
+
+// startAudit opens the audit log and starts writing entries for finished
+// files, if an audit log is configured
+func (m *Manager) startAudit() error {
+	if m.config.AuditLogFile == "" {
+		return nil
+	}
+
+	auditLog, err := audit.Open(m.config.AuditLogFile, history.Version())
+	if err != nil {
+		return err
+	}
+
+	m.auditQueue = make(chan models.FileReport, auditQueueSize)
+	m.auditDone = make(chan struct{})
+	go func() {
+		defer close(m.auditDone)
+		for file := range m.auditQueue {
+			if err := auditLog.Record(file.InputPath, file.OutputPaths, file.Status, file.Error); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+		sequence, hash := auditLog.Head()
+		m.auditAnchor = &models.AuditAnchor{Log: m.config.AuditLogFile, Sequence: sequence, Hash: hash}
+		if err := auditLog.Close(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}()
+	return nil
+}
+
+// recordAudit queues a finished file for the audit log. Entries are never
+// dropped, so this blocks if hashing falls far behind.
+func (m *Manager) recordAudit(file models.FileReport) {
+	if m.auditQueue != nil {
+		m.auditQueue <- file
+	}
+}
+
+// finishAudit writes the queued entries and closes the audit log, keeping
+// its head for the run report
+func (m *Manager) finishAudit() {
+	if m.auditQueue == nil {
+		return
+	}
+	close(m.auditQueue)
+	<-m.auditDone
+	if m.config.Verbose {
+		fmt.Printf("Audit log written to %s\n", m.config.AuditLogFile)
+	}
+}
@@ -0,0 +1,183 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"emil/internal/checkpoint"
+	"emil/internal/models"
+)
+
+// openCheckpoint reads the files earlier runs converted, if a checkpoint is
+// configured, and keeps it open to record this run's conversions
+func (m *Manager) openCheckpoint() error {
+	if m.config.CheckpointFile == "" {
+		return nil
+	}
+	done, err := checkpoint.Open(m.config.CheckpointFile)
+	if err != nil {
+		return err
+	}
+	m.checkpoint = done
+	return nil
+}
+
+// closeCheckpoint flushes and closes the checkpoint
+func (m *Manager) closeCheckpoint() {
+	if m.checkpoint == nil {
+		return
+	}
+	if err := m.checkpoint.Close(); err != nil {
+		log.Printf("Warning: %v", err)
+	} else if m.config.Verbose {
+		fmt.Printf("Checkpoint %s lists %d converted files\n", m.config.CheckpointFile, m.checkpoint.Len())
+	}
+}
+
+// skipCheckpointed drops the files the checkpoint shows an earlier run
+// converted, unless they changed since
+func (m *Manager) skipCheckpointed(files []FileInfo) []FileInfo {
+	if m.checkpoint == nil {
+		return files
+	}
+	kept := files[:0]
+	for _, file := range files {
+		if !m.checkpoint.Done(file.Path, file.Size, file.ModTime) {
+			kept = append(kept, file)
+		}
+	}
+
+	m.statsLock.Lock()
+	m.stats.Checkpointed = len(files) - len(kept)
+	m.statsLock.Unlock()
+	if skipped := len(files) - len(kept); skipped > 0 {
+		fmt.Printf("Skipping %d files converted by earlier runs (checkpoint %s)\n", skipped, m.config.CheckpointFile)
+	}
+	return kept
+}
+
+// applyBudget splits the files, in the order they will be converted, into
+// those within the run's -max-files and -max-bytes budget and those left for
+// the next run. The first file is always taken, so one larger than the byte
+// budget can't hold up every later run.
+func (m *Manager) applyBudget(files []FileInfo) ([]FileInfo, []FileInfo) {
+	maxFiles, maxBytes := m.config.Budget.MaxFiles, m.config.Budget.MaxBytes
+	if maxFiles <= 0 && maxBytes <= 0 {
+		return files, nil
+	}
+
+	var bytes int64
+	for i, file := range files {
+		if i > 0 && ((maxFiles > 0 && i >= maxFiles) || (maxBytes > 0 && bytes+file.Size > maxBytes)) {
+			return files[:i], files[i:]
+		}
+		bytes += file.Size
+	}
+	return files, nil
+}
+
+// watchDeadline closes m.expired once the run's -max-duration is up, and
+// leaves the files still waiting in the queue for the next run. Conversions
+// in progress finish.
+func (m *Manager) watchDeadline(ctx context.Context) {
+	if m.config.Budget.MaxDuration <= 0 {
+		return
+	}
+	timer := time.NewTimer(time.Until(m.stats.StartTime.Add(m.config.Budget.MaxDuration)))
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		m.expire()
+		fmt.Printf("\nTime budget of %s spent; conversions in progress will finish\n", m.config.Budget.MaxDuration)
+		m.deferQueued()
+	}()
+}
+
+// expire closes m.expired, so no more files are taken on
+func (m *Manager) expire() {
+	m.expireOnce.Do(func() { close(m.expired) })
+}
+
+// budgetSpent reports whether the run's time budget is up
+func (m *Manager) budgetSpent() bool {
+	select {
+	case <-m.expired:
+		return true
+	default:
+		return false
+	}
+}
+
+// deferQueued takes the tasks no worker has started off the queues and
+// leaves them for the next run
+func (m *Manager) deferQueued() {
+	for _, queue := range []chan models.Task{m.taskChan, m.textChan} {
+		m.deferQueue(queue)
+	}
+}
+
+// deferQueue leaves the tasks waiting in one queue for the next run
+func (m *Manager) deferQueue(queue chan models.Task) {
+	for {
+		select {
+		case task, ok := <-queue:
+			if !ok {
+				return
+			}
+			m.deferTask(task)
+		default:
+			return
+		}
+	}
+}
+
+// deferTask leaves an enqueued task for the next run
+func (m *Manager) deferTask(task models.Task) {
+	m.tasksByIDLock.Lock()
+	current, exists := m.tasksByID[task.ID]
+	deferred := exists && m.counts.transition(current.Status, models.StatusDeferred)
+	if deferred {
+		current.Status = models.StatusDeferred
+		m.tasksByID[task.ID] = current
+	}
+	m.tasksByIDLock.Unlock()
+
+	if deferred {
+		m.leaveForNextRun(task.FileSize)
+		m.outstanding.Done()
+	}
+}
+
+// deferFiles leaves files that were never enqueued for the next run
+func (m *Manager) deferFiles(files []FileInfo) {
+	for _, file := range files {
+		m.counts.deferred.Add(1)
+		m.leaveForNextRun(file.Size)
+	}
+}
+
+// leaveForNextRun takes a deferred file out of the run's totals
+func (m *Manager) leaveForNextRun(size int64) {
+	m.statsLock.Lock()
+	m.stats.TotalFileSize -= size
+	m.progress.addTotal(-1, -size)
+	m.statsLock.Unlock()
+}
+
+// recordCheckpoint adds a converted file to the checkpoint, so later runs
+// skip it
+func (m *Manager) recordCheckpoint(task models.Task) {
+	if m.checkpoint == nil || task.FilePath == "" {
+		return
+	}
+	if err := m.checkpoint.Record(task.FilePath, task.FileSize, task.ModTime); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"emil/internal/models"
+)
+
+// taskCounts tracks how many tasks are in each state. A count changes only
+// when a task moves from one state to the next, so repeated, dropped or late
+// progress updates can't skew it, and counts can be read without statsLock.
+type taskCounts struct {
+	discovered atomic.Int64
+	processing atomic.Int64
+	processed  atomic.Int64
+	successful atomic.Int64
+	failed     atomic.Int64
+	requeued   atomic.Int64
+	deferred   atomic.Int64 // Tasks left for the next run when the budget was spent
+	duplicates atomic.Int64 // Final updates for tasks that had already finished
+}
+
+// finished reports whether a status is final
+func finished(status models.TaskStatus) bool {
+	return status == models.StatusComplete || status == models.StatusFailed
+}
+
+// transition counts a task moving from one status to another. It returns
+// false, counting nothing, for updates about a task that already finished.
+func (c *taskCounts) transition(from, to models.TaskStatus) bool {
+	if finished(from) || from == models.StatusDeferred {
+		if finished(to) {
+			c.duplicates.Add(1)
+		}
+		return false
+	}
+	if from == to {
+		return true
+	}
+
+	if from == models.StatusProcessing {
+		c.processing.Add(-1)
+	}
+	switch to {
+	case models.StatusProcessing:
+		c.processing.Add(1)
+	case models.StatusComplete:
+		c.successful.Add(1)
+		c.processed.Add(1)
+	case models.StatusFailed:
+		c.failed.Add(1)
+		c.processed.Add(1)
+	case models.StatusDeferred:
+		c.deferred.Add(1)
+	}
+	return true
+}
+
+// fill copies the counts into stats
+func (c *taskCounts) fill(stats *models.Stats) {
+	stats.Discovered = int(c.discovered.Load())
+	stats.Processing = int(c.processing.Load())
+	stats.Processed = int(c.processed.Load())
+	stats.Successful = int(c.successful.Load())
+	stats.Failed = int(c.failed.Load())
+	stats.Requeued = int(c.requeued.Load())
+	stats.Deferred = int(c.deferred.Load())
+}
+
+// checkInvariants returns the accounting rules a finished run broke, each of
+// which points to a bug in how tasks are counted. Runs that were stopped
+// early leave files unprocessed, so those aren't expected to all finish, and
+// files left for the next run at the budget are never processed.
+func (c *taskCounts) checkInvariants(stopped bool) []string {
+	var stats models.Stats
+	c.fill(&stats)
+
+	var violations []string
+	if stats.Processed != stats.Successful+stats.Failed {
+		violations = append(violations, fmt.Sprintf("processed (%d) is not successful (%d) plus failed (%d)",
+			stats.Processed, stats.Successful, stats.Failed))
+	}
+	if stats.Processed+stats.Deferred > stats.Discovered {
+		violations = append(violations, fmt.Sprintf("processed (%d) plus deferred (%d) is more than discovered (%d)",
+			stats.Processed, stats.Deferred, stats.Discovered))
+	}
+	if !stopped && stats.Processing != 0 {
+		violations = append(violations, fmt.Sprintf("%d files still counted as processing", stats.Processing))
+	}
+	if !stopped && stats.Processed+stats.Deferred < stats.Discovered {
+		violations = append(violations, fmt.Sprintf("%d of %d discovered files were never reported finished",
+			stats.Discovered-stats.Processed-stats.Deferred, stats.Discovered))
+	}
+	if n := c.duplicates.Load(); n > 0 {
+		violations = append(violations, fmt.Sprintf("%d final updates for files that had already finished were ignored", n))
+	}
+	return violations
+}
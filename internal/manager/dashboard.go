@@ -0,0 +1,88 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"emil/internal/dashboard"
+	"emil/internal/models"
+)
+
+// Failures and alerts kept for the dashboard
+const dashboardRecent = 50
+
+// startDashboard serves the live dashboard and health endpoints until ctx is
+// cancelled, if an address is configured
+func (m *Manager) startDashboard(ctx context.Context) {
+	if m.config.DashboardAddress == "" {
+		return
+	}
+
+	server := dashboard.New(m.config.DashboardAddress, m.config.DashboardToken, m.snapshot)
+	server.HandleChecks("/healthz", m.livenessChecks())
+	server.HandleChecks("/readyz", m.readinessChecks())
+	server.HandleAction("/api/pause", m.Pause)
+	server.HandleAction("/api/resume", m.Resume)
+	server.HandleTuning("/api/tune", m.Tuning, m.Tune)
+	if err := server.Start(ctx); err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	fmt.Printf("Dashboard: http://%s/\n", m.config.DashboardAddress)
+	if !server.Controllable() {
+		log.Printf("Warning: the dashboard isn't bound to loopback, so it serves nothing without EMIL_DASHBOARD_TOKEN")
+	}
+}
+
+// snapshot returns the current state of the run for the dashboard
+func (m *Manager) snapshot() dashboard.Snapshot {
+	m.statsLock.RLock()
+	snapshot := dashboard.Snapshot{
+		Stats:          m.statsLocked(),
+		RecentFailures: append([]models.FileReport(nil), m.recentFailures...),
+		RecentAlerts:   append([]dashboard.Alert(nil), m.recentAlerts...),
+	}
+	m.statsLock.RUnlock()
+
+	end := snapshot.Stats.EndTime
+	if end.IsZero() {
+		end = time.Now()
+	}
+	snapshot.Elapsed = end.Sub(snapshot.Stats.StartTime).Seconds()
+	if snapshot.Elapsed > 0 {
+		snapshot.FilesPerSec = float64(snapshot.Stats.Processed) / snapshot.Elapsed
+	}
+	snapshot.QueueDepth, snapshot.QueueCapacity = m.queueLength()
+	snapshot.Paused = m.intake.Paused()
+	if m.resourceMgr != nil {
+		snapshot.MemoryUsage = m.resourceMgr.MemoryUsage()
+	}
+	return snapshot
+}
+
+// recordRecent keeps a finished file's failure and alerts for the dashboard,
+// newest first. Callers hold statsLock.
+func (m *Manager) recordRecent(file models.FileReport) {
+	if file.Status == string(models.StatusFailed) {
+		m.recentFailures = prepend(m.recentFailures, file)
+	}
+	for _, alert := range file.SecurityAlerts {
+		m.recentAlerts = prepend(m.recentAlerts, dashboard.Alert{
+			InputPath: file.InputPath,
+			Severity:  alert.Severity,
+			Alert:     alert.Message,
+			Time:      file.FinishedAt,
+		})
+	}
+}
+
+// prepend adds item to the front of list, dropping the oldest beyond dashboardRecent
+func prepend[T any](list []T, item T) []T {
+	list = append([]T{item}, list...)
+	if len(list) > dashboardRecent {
+		list = list[:dashboardRecent]
+	}
+	return list
+}
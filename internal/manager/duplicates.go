@@ -0,0 +1,124 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"emil/internal/models"
+)
+
+// checkDuplicates audits the run's outputs for distinct sources that were
+// converted to the same path, where the last one overwrote the others, or
+// to byte-identical PDFs, and prints what it finds
+func (m *Manager) checkDuplicates() {
+	m.statsLock.RLock()
+	sources := make(map[string][]string) // Sources of each output path
+	for _, file := range m.fileReports {
+		if file.Status != string(models.StatusComplete) {
+			continue
+		}
+		for _, output := range file.OutputPaths {
+			if !slices.Contains(sources[output], file.InputPath) {
+				sources[output] = append(sources[output], file.InputPath)
+			}
+		}
+	}
+	m.statsLock.RUnlock()
+
+	outputs := make([]string, 0, len(sources))
+	for output := range sources {
+		outputs = append(outputs, output)
+	}
+	sort.Strings(outputs)
+
+	// Only outputs of the same size can be identical, so only those are hashed
+	check := &models.DuplicateCheck{Outputs: len(outputs)}
+	bySize := make(map[int64][]string)
+	for _, output := range outputs {
+		if len(sources[output]) > 1 {
+			check.Collisions = append(check.Collisions, models.DuplicateGroup{Path: output, Sources: sources[output]})
+			continue
+		}
+		info, err := os.Stat(output)
+		if err != nil {
+			log.Printf("Warning: duplicate check skipped %s: %v", output, err)
+			continue
+		}
+		bySize[info.Size()] = append(bySize[info.Size()], output)
+	}
+
+	byHash := make(map[string][]string)
+	for _, group := range bySize {
+		if len(group) < 2 {
+			continue
+		}
+		for _, output := range group {
+			sum, err := hashOutput(output)
+			if err != nil {
+				log.Printf("Warning: duplicate check skipped %s: %v", output, err)
+				continue
+			}
+			byHash[sum] = append(byHash[sum], output)
+		}
+	}
+	for sum, group := range byHash {
+		var groupSources []string
+		for _, output := range group {
+			if source := sources[output][0]; !slices.Contains(groupSources, source) {
+				groupSources = append(groupSources, source)
+			}
+		}
+		// The parts of one split PDF can't be told apart from copies, but
+		// only different sources count
+		if len(groupSources) > 1 {
+			sort.Strings(group)
+			check.Identical = append(check.Identical, models.DuplicateGroup{SHA256: sum, Outputs: group, Sources: groupSources})
+		}
+	}
+	sort.Slice(check.Identical, func(i, j int) bool {
+		return check.Identical[i].Outputs[0] < check.Identical[j].Outputs[0]
+	})
+
+	m.statsLock.Lock()
+	m.stats.Duplicates = check
+	m.statsLock.Unlock()
+
+	fmt.Printf("\nDuplicate check: %d outputs checked\n", check.Outputs)
+	printCheckList("Converted to the same path", describeDuplicates(check.Collisions, func(group models.DuplicateGroup) string {
+		return group.Path
+	}))
+	printCheckList("Byte-identical PDFs", describeDuplicates(check.Identical, func(group models.DuplicateGroup) string {
+		return strings.Join(group.Outputs, ", ")
+	}))
+}
+
+// describeDuplicates formats each group as its outputs followed by their sources
+func describeDuplicates(groups []models.DuplicateGroup, outputs func(models.DuplicateGroup) string) []string {
+	entries := make([]string, 0, len(groups))
+	for _, group := range groups {
+		entries = append(entries, fmt.Sprintf("%s (from %s)", outputs(group), strings.Join(group.Sources, ", ")))
+	}
+	return entries
+}
+
+// hashOutput returns the hex SHA-256 of an output file
+func hashOutput(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
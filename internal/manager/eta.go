@@ -0,0 +1,103 @@
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"emil/internal/models"
+)
+
+const (
+	// Weight of the newest file in each path's moving average
+	etaSmoothing = 0.2
+
+	// Path of files that failed, which usually used up their retries first
+	etaPathFailed = "failed"
+
+	// Path of converted files whose renderer wasn't reported
+	etaPathOther = "other"
+)
+
+// conversionCost is the cost of the files converted along one path
+type conversionCost struct {
+	files   int     // Files finished this way
+	seconds float64 // Moving average of seconds per file, retries included
+}
+
+// etaModel estimates the time left in a run. Rendering an HTML message with
+// Chrome can take 10-50 times as long as laying out a plain text one, so
+// each renderer keeps its own average time per file, and the files left are
+// assumed to split between renderers as the finished ones have.
+type etaModel struct {
+	paths    map[string]*conversionCost
+	finished int
+}
+
+// newETAModel creates a model with no files recorded
+func newETAModel() *etaModel {
+	return &etaModel{paths: make(map[string]*conversionCost)}
+}
+
+// conversionPath returns the path a finished file took: its renderer, or
+// failed
+func conversionPath(update models.StatusUpdate) string {
+	switch {
+	case update.Status == models.StatusFailed:
+		return etaPathFailed
+	case update.ProcessingStats.Renderer == "":
+		return etaPathOther
+	}
+	return update.ProcessingStats.Renderer
+}
+
+// record adds a finished file to the model
+func (e *etaModel) record(update models.StatusUpdate) {
+	path := conversionPath(update)
+	seconds := update.ProcessingStats.Duration.Seconds()
+
+	cost := e.paths[path]
+	if cost == nil {
+		cost = &conversionCost{seconds: seconds}
+		e.paths[path] = cost
+	} else {
+		cost.seconds = cost.seconds*(1-etaSmoothing) + seconds*etaSmoothing
+	}
+	cost.files++
+	e.finished++
+}
+
+// remaining estimates how long the files left will take with the given
+// number of workers converting at once. It returns 0 until a file finishes.
+func (e *etaModel) remaining(files, workers int) time.Duration {
+	if e.finished == 0 || files <= 0 {
+		return 0
+	}
+	var perFile float64
+	for _, cost := range e.paths {
+		perFile += float64(cost.files) / float64(e.finished) * cost.seconds
+	}
+	seconds := perFile * float64(files) / float64(max(workers, 1))
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// mix describes each path's share of the finished files and its average
+// time per file, e.g. "chrome 60% 3.2s, basic 40% 0.1s"
+func (e *etaModel) mix() string {
+	names := make([]string, 0, len(e.paths))
+	for name := range e.paths {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := e.paths[names[i]], e.paths[names[j]]
+		return a.files > b.files || (a.files == b.files && names[i] < names[j])
+	})
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		cost := e.paths[name]
+		parts[i] = fmt.Sprintf("%s %.0f%% %.1fs", name, float64(cost.files)/float64(e.finished)*100, cost.seconds)
+	}
+	return strings.Join(parts, ", ")
+}
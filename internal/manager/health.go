@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"emil/internal/converter"
+	"emil/internal/dashboard"
+)
+
+// livenessChecks are served at /healthz; failing them means emil is wedged and should be restarted
+func (m *Manager) livenessChecks() map[string]dashboard.Check {
+	return map[string]dashboard.Check{
+		"queue": m.checkQueue,
+	}
+}
+
+// readinessChecks are served at /readyz; failing them means conversions would fail or degrade
+func (m *Manager) readinessChecks() map[string]dashboard.Check {
+	checks := map[string]dashboard.Check{
+		"renderer": func() error { return converter.RendererHealth(m.config) },
+		"temp_space": func() error {
+			dir := converter.TempDir(m.config)
+			if dir == "" {
+				dir = os.TempDir()
+			}
+			return converter.CheckFreeSpace(dir)
+		},
+		"output_space": func() error {
+			for _, root := range converter.OutputRoots(m.config) {
+				if _, err := os.Stat(root); os.IsNotExist(err) {
+					continue // Created with the first output written there
+				}
+				if err := converter.CheckFreeSpace(root); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	if m.deps.Scanner != nil && m.deps.Scanner.IsEnabled() {
+		checks["clamd"] = m.deps.Scanner.Ping
+	}
+	return checks
+}
+
+// checkQueue fails when work is waiting but no worker has reported anything
+// for longer than a task may take
+func (m *Manager) checkQueue() error {
+	m.statsLock.RLock()
+	stats := m.statsLocked()
+	pending := stats.Discovered - stats.Processed - stats.Deferred
+	workers := stats.CurrentWorkers
+	lastUpdate := m.lastUpdate
+	m.statsLock.RUnlock()
+
+	if pending <= 0 || m.intake.Paused() {
+		return nil
+	}
+	if workers <= 0 {
+		return fmt.Errorf("%d files pending but no workers running", pending)
+	}
+	if idle := time.Since(lastUpdate); idle > stuckTaskThreshold {
+		return fmt.Errorf("%d files pending but no progress for %s", pending, idle.Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,431 @@
+package manager
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"time"
+
+	"emil/internal/models"
+)
+
+// Layout of the HTML report
+const (
+	reportTopFiles     = 20  // Rows in the largest, slowest and costliest tables
+	reportChartBuckets = 40  // Bars in the throughput chart
+	reportChartWidth   = 800 // Chart size in pixels
+	reportChartHeight  = 160
+)
+
+// htmlReportData is what the HTML report template renders
+type htmlReportData struct {
+	Report      models.Report
+	Duration    time.Duration
+	FilesPerSec float64
+	TotalBytes  int64
+	Failures    []models.FileReport
+	Alerts      []reportAlert
+	Truncated   []models.FileReport
+	Empty       []models.FileReport
+	Anomalies   []reportAlert
+	Largest     []models.FileReport
+	Slowest     []models.FileReport
+	Costliest   []models.FileReport
+	Senders     []senderCost
+	Chart       []chartBar
+	ChartWidth  int
+	ChartHeight int
+	BucketLabel string
+}
+
+// reportAlert is one security alert with the file it was found in
+type reportAlert struct {
+	InputPath string
+	Alert     string
+}
+
+// senderCost is what converting one sender's messages cost
+type senderCost struct {
+	Sender          string
+	Files           int
+	CPUMS           int64
+	PeakRSSDelta    int64
+	AttachmentBytes int64
+}
+
+// chartBar is one time bucket of the throughput chart
+type chartBar struct {
+	X, Width            float64
+	OKHeight, OKY       float64
+	FailedHeight, FailY float64
+	Title               string
+}
+
+// writeHTMLReport writes the self-contained HTML run report
+func (m *Manager) writeHTMLReport() error {
+	m.statsLock.RLock()
+	stats := m.statsLocked()
+	report := models.Report{
+		StartTime:           stats.StartTime,
+		EndTime:             stats.EndTime,
+		Discovered:          stats.Discovered,
+		Successful:          stats.Successful,
+		Failed:              stats.Failed,
+		Truncated:           stats.Truncated,
+		Empty:               stats.EmptyBodies,
+		Anomalous:           stats.Anomalous,
+		Threads:             stats.Threads,
+		Deferred:            stats.Deferred,
+		Checkpointed:        stats.Checkpointed,
+		InvariantViolations: stats.InvariantViolations,
+		Migration:           stats.Migration,
+		Duplicates:          stats.Duplicates,
+		Files:               append([]models.FileReport(nil), m.fileReports...),
+		Sources:             m.sourceReports(),
+	}
+	m.statsLock.RUnlock()
+
+	data := htmlReportData{
+		Report:      report,
+		Duration:    report.EndTime.Sub(report.StartTime).Round(time.Millisecond),
+		ChartWidth:  reportChartWidth,
+		ChartHeight: reportChartHeight,
+	}
+	if seconds := data.Duration.Seconds(); seconds > 0 {
+		data.FilesPerSec = float64(len(report.Files)) / seconds
+	}
+
+	for _, file := range report.Files {
+		data.TotalBytes += file.FileSize
+		if file.Status == string(models.StatusFailed) {
+			data.Failures = append(data.Failures, file)
+		}
+		if file.Truncated {
+			data.Truncated = append(data.Truncated, file)
+		}
+		if file.EmptyBody {
+			data.Empty = append(data.Empty, file)
+		}
+		for _, anomaly := range file.HeaderAnomalies {
+			data.Anomalies = append(data.Anomalies, reportAlert{InputPath: file.InputPath, Alert: anomaly})
+		}
+		for _, alert := range file.SecurityAlerts {
+			data.Alerts = append(data.Alerts, reportAlert{InputPath: file.InputPath, Alert: alert.String()})
+		}
+	}
+
+	data.Largest = topFiles(report.Files, func(a, b models.FileReport) bool { return a.FileSize > b.FileSize })
+	data.Slowest = topFiles(report.Files, func(a, b models.FileReport) bool { return a.DurationMS > b.DurationMS })
+	data.Costliest = topFiles(report.Files, func(a, b models.FileReport) bool { return a.CPUMS > b.CPUMS })
+	data.Senders = costliestSenders(report.Files)
+	data.Chart, data.BucketLabel = throughputChart(report)
+
+	file, err := os.Create(m.config.HTMLReportFile)
+	if err != nil {
+		return fmt.Errorf("failed to write HTML report: %w", err)
+	}
+	defer file.Close()
+
+	if err := htmlReportTemplate.Execute(file, data); err != nil {
+		return fmt.Errorf("failed to write HTML report: %w", err)
+	}
+	return nil
+}
+
+// topFiles returns the first files in the given order
+func topFiles(files []models.FileReport, less func(a, b models.FileReport) bool) []models.FileReport {
+	sorted := append([]models.FileReport(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	if len(sorted) > reportTopFiles {
+		sorted = sorted[:reportTopFiles]
+	}
+	return sorted
+}
+
+// costliestSenders totals the cost of each sender's messages and returns the
+// senders whose messages took the most CPU time
+func costliestSenders(files []models.FileReport) []senderCost {
+	bySender := make(map[string]*senderCost)
+	for _, file := range files {
+		if file.Sender == "" {
+			continue
+		}
+		cost := bySender[file.Sender]
+		if cost == nil {
+			cost = &senderCost{Sender: file.Sender}
+			bySender[file.Sender] = cost
+		}
+		cost.Files++
+		cost.CPUMS += file.CPUMS
+		cost.PeakRSSDelta += file.PeakRSSDelta
+		cost.AttachmentBytes += file.AttachmentBytes
+	}
+
+	senders := make([]senderCost, 0, len(bySender))
+	for _, cost := range bySender {
+		senders = append(senders, *cost)
+	}
+	sort.Slice(senders, func(i, j int) bool {
+		if senders[i].CPUMS != senders[j].CPUMS {
+			return senders[i].CPUMS > senders[j].CPUMS
+		}
+		return senders[i].Sender < senders[j].Sender
+	})
+	if len(senders) > reportTopFiles {
+		senders = senders[:reportTopFiles]
+	}
+	return senders
+}
+
+// throughputChart counts finished files per time bucket and lays them out as
+// stacked bars, returning the bars and a description of the bucket size
+func throughputChart(report models.Report) ([]chartBar, string) {
+	span := report.EndTime.Sub(report.StartTime)
+	if len(report.Files) == 0 || span <= 0 {
+		return nil, ""
+	}
+
+	bucket := span / reportChartBuckets
+	if bucket < time.Second {
+		bucket = time.Second
+	}
+	count := int(span/bucket) + 1
+
+	ok := make([]int, count)
+	failed := make([]int, count)
+	peak := 1
+	for _, file := range report.Files {
+		i := int(file.FinishedAt.Sub(report.StartTime) / bucket)
+		if i < 0 || i >= count {
+			continue
+		}
+		if file.Status == string(models.StatusFailed) {
+			failed[i]++
+		} else {
+			ok[i]++
+		}
+		peak = max(peak, ok[i]+failed[i])
+	}
+
+	width := float64(reportChartWidth) / float64(count)
+	scale := float64(reportChartHeight) / float64(peak)
+	bars := make([]chartBar, count)
+	for i := range bars {
+		okHeight := float64(ok[i]) * scale
+		failedHeight := float64(failed[i]) * scale
+		bars[i] = chartBar{
+			X:            float64(i) * width,
+			Width:        max(width-1, 1),
+			OKHeight:     okHeight,
+			OKY:          reportChartHeight - okHeight,
+			FailedHeight: failedHeight,
+			FailY:        reportChartHeight - okHeight - failedHeight,
+			Title: fmt.Sprintf("%s–%s: %d converted, %d failed",
+				time.Duration(i)*bucket, time.Duration(i+1)*bucket, ok[i], failed[i]),
+		}
+	}
+	return bars, fmt.Sprintf("files finished per %s", bucket)
+}
+
+// htmlReportFuncs are the helpers available to the report template
+var htmlReportFuncs = template.FuncMap{
+	"bytes": func(n int64) string {
+		const unit = 1024
+		if n < unit {
+			return fmt.Sprintf("%d B", n)
+		}
+		div, exp := int64(unit), 0
+		for x := n / unit; x >= unit; x /= unit {
+			div *= unit
+			exp++
+		}
+		return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+	},
+	"ms": func(ms int64) string {
+		return (time.Duration(ms) * time.Millisecond).String()
+	},
+	"when": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05")
+	},
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(htmlReportFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<title>Emil conversion report</title>
+<style>
+body { font-family: Arial, sans-serif; margin: 30px; color: #222; }
+h1 { margin-bottom: 0; }
+.period { color: #666; margin-top: 4px; }
+.cards { display: flex; flex-wrap: wrap; gap: 12px; margin: 20px 0; }
+.card { border: 1px solid #ddd; border-radius: 4px; padding: 10px 16px; min-width: 120px; }
+.card .value { font-size: 22px; font-weight: bold; }
+.card .label { color: #666; font-size: 12px; }
+.card.bad .value { color: #b00; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 30px; font-size: 13px; }
+th, td { border: 1px solid #ddd; padding: 5px 8px; text-align: left; vertical-align: top; }
+th { background: #f3f3f3; cursor: pointer; user-select: none; }
+th::after { content: " \2195"; color: #aaa; }
+td.num { text-align: right; white-space: nowrap; }
+td.path { word-break: break-all; }
+.chart rect.ok { fill: #4a8; }
+.chart rect.failed { fill: #c44; }
+.chart { border-bottom: 1px solid #999; margin-bottom: 4px; }
+.note { color: #666; font-size: 12px; margin-bottom: 30px; }
+</style>
+</head>
+<body>
+<h1>Emil conversion report</h1>
+<div class="period">{{when .Report.StartTime}} to {{when .Report.EndTime}} ({{.Duration}})</div>
+
+<div class="cards">
+<div class="card"><div class="value">{{.Report.Discovered}}</div><div class="label">files found</div></div>
+<div class="card"><div class="value">{{.Report.Successful}}</div><div class="label">converted</div></div>
+<div class="card{{if .Report.Failed}} bad{{end}}"><div class="value">{{.Report.Failed}}</div><div class="label">failed</div></div>
+{{if .Report.Deferred}}<div class="card"><div class="value">{{.Report.Deferred}}</div><div class="label">left for the next run</div></div>
+{{end}}<div class="card{{if .Alerts}} bad{{end}}"><div class="value">{{len .Alerts}}</div><div class="label">security alerts</div></div>
+<div class="card"><div class="value">{{printf "%.2f" .FilesPerSec}}</div><div class="label">files per second</div></div>
+<div class="card"><div class="value">{{bytes .TotalBytes}}</div><div class="label">processed</div></div>
+</div>
+
+{{if .Report.InvariantViolations}}
+<h2>Inconsistent statistics</h2>
+<p>The run's counts don't add up, so the figures above may be wrong:</p>
+<ul>{{range .Report.InvariantViolations}}<li>{{.}}</li>{{end}}</ul>
+{{end}}
+
+{{if .Report.Sources}}
+<h2>Sources</h2>
+<table class="sortable">
+<tr><th>Source</th><th>Directory</th><th>Converted</th><th>Failed</th></tr>
+{{range .Report.Sources}}<tr><td>{{.Label}}</td><td class="path">{{.Dir}}</td><td class="num">{{.Successful}}</td><td class="num">{{.Failed}}</td></tr>
+{{end}}</table>
+{{end}}
+
+{{with .Report.Migration}}
+<h2>Migration check</h2>
+<p>{{.Converted}} of {{.Expected}} expected messages converted.</p>
+{{if .Missing}}<h3>Missing ({{len .Missing}})</h3>
+<ul>{{range .Missing}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .Extra}}<h3>Not expected ({{len .Extra}})</h3>
+<ul>{{range .Extra}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .Duplicates}}<h3>Converted more than once ({{len .Duplicates}})</h3>
+<ul>{{range .Duplicates}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .WithoutID}}<h3>Without a Message-ID ({{len .WithoutID}})</h3>
+<ul>{{range .WithoutID}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{end}}
+
+{{with .Report.Duplicates}}
+<h2>Duplicate check</h2>
+<p>{{.Outputs}} outputs checked{{if not .Found}}, none shared by different sources{{end}}.</p>
+{{if .Collisions}}<h3>Converted to the same path ({{len .Collisions}})</h3>
+<table class="sortable">
+<tr><th>Output</th><th>Sources</th></tr>
+{{range .Collisions}}<tr><td class="path">{{.Path}}</td><td class="path">{{range .Sources}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Identical}}<h3>Byte-identical PDFs ({{len .Identical}})</h3>
+<table class="sortable">
+<tr><th>Outputs</th><th>Sources</th><th>SHA-256</th></tr>
+{{range .Identical}}<tr><td class="path">{{range .Outputs}}{{.}}<br>{{end}}</td><td class="path">{{range .Sources}}{{.}}<br>{{end}}</td><td class="path">{{.SHA256}}</td></tr>
+{{end}}</table>{{end}}
+{{end}}
+
+{{if .Chart}}
+<h2>Throughput</h2>
+<svg class="chart" width="{{.ChartWidth}}" height="{{.ChartHeight}}" viewBox="0 0 {{.ChartWidth}} {{.ChartHeight}}">
+{{range .Chart}}<g><title>{{.Title}}</title><rect class="ok" x="{{.X}}" y="{{.OKY}}" width="{{.Width}}" height="{{.OKHeight}}"/><rect class="failed" x="{{.X}}" y="{{.FailY}}" width="{{.Width}}" height="{{.FailedHeight}}"/></g>
+{{end}}</svg>
+<div class="note">{{.BucketLabel}}; green converted, red failed</div>
+{{end}}
+
+<h2>Failures ({{len .Failures}})</h2>
+{{if .Failures}}
+<table class="sortable">
+<tr><th>File</th><th>Error</th><th>Retries</th><th>Size</th></tr>
+{{range .Failures}}<tr><td class="path">{{.InputPath}}</td><td>{{.Error}}</td><td class="num">{{.Retries}}</td><td class="num" data-sort="{{.FileSize}}">{{bytes .FileSize}}</td></tr>
+{{end}}</table>
+{{else}}<p>None.</p>{{end}}
+
+<h2>Security alerts ({{len .Alerts}})</h2>
+{{if .Alerts}}
+<table class="sortable">
+<tr><th>File</th><th>Alert</th></tr>
+{{range .Alerts}}<tr><td class="path">{{.InputPath}}</td><td>{{.Alert}}</td></tr>
+{{end}}</table>
+{{else}}<p>None.</p>{{end}}
+
+{{if .Truncated}}
+<h2>Truncated at the page limit ({{len .Truncated}})</h2>
+<table class="sortable">
+<tr><th>File</th><th>Size</th><th>Renderer</th></tr>
+{{range .Truncated}}<tr><td class="path">{{.InputPath}}</td><td class="num" data-sort="{{.FileSize}}">{{bytes .FileSize}}</td><td>{{.Renderer}}</td></tr>
+{{end}}</table>
+{{end}}
+
+{{if .Anomalies}}
+<h2>Header anomalies ({{len .Anomalies}})</h2>
+<table class="sortable">
+<tr><th>File</th><th>Anomaly</th></tr>
+{{range .Anomalies}}<tr><td class="path">{{.InputPath}}</td><td>{{.Alert}}</td></tr>
+{{end}}</table>
+{{end}}
+
+{{if .Empty}}
+<h2>Messages with no body ({{len .Empty}})</h2>
+<table class="sortable">
+<tr><th>File</th><th>Size</th><th>Message-ID</th></tr>
+{{range .Empty}}<tr><td class="path">{{.InputPath}}</td><td class="num" data-sort="{{.FileSize}}">{{bytes .FileSize}}</td><td>{{.MessageID}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Largest files</h2>
+<table class="sortable">
+<tr><th>File</th><th>Size</th><th>Time</th><th>Status</th><th>Renderer</th></tr>
+{{range .Largest}}<tr><td class="path">{{.InputPath}}</td><td class="num" data-sort="{{.FileSize}}">{{bytes .FileSize}}</td><td class="num" data-sort="{{.DurationMS}}">{{ms .DurationMS}}</td><td>{{.Status}}</td><td>{{.Renderer}}</td></tr>
+{{end}}</table>
+
+<h2>Slowest conversions</h2>
+<table class="sortable">
+<tr><th>File</th><th>Time</th><th>Size</th><th>Status</th><th>Renderer</th></tr>
+{{range .Slowest}}<tr><td class="path">{{.InputPath}}</td><td class="num" data-sort="{{.DurationMS}}">{{ms .DurationMS}}</td><td class="num" data-sort="{{.FileSize}}">{{bytes .FileSize}}</td><td>{{.Status}}</td><td>{{.Renderer}}</td></tr>
+{{end}}</table>
+
+<h2>Costliest conversions</h2>
+<table class="sortable">
+<tr><th>File</th><th>Sender</th><th>CPU</th><th>Peak memory growth</th><th>Attachments</th><th>Renderer</th></tr>
+{{range .Costliest}}<tr><td class="path">{{.InputPath}}</td><td>{{.Sender}}</td><td class="num" data-sort="{{.CPUMS}}">{{ms .CPUMS}}</td><td class="num" data-sort="{{.PeakRSSDelta}}">{{bytes .PeakRSSDelta}}</td><td class="num" data-sort="{{.AttachmentBytes}}">{{bytes .AttachmentBytes}}</td><td>{{.Renderer}}</td></tr>
+{{end}}</table>
+
+{{if .Senders}}
+<h2>Costliest senders</h2>
+<table class="sortable">
+<tr><th>Sender</th><th>Files</th><th>CPU</th><th>Peak memory growth</th><th>Attachments</th></tr>
+{{range .Senders}}<tr><td>{{.Sender}}</td><td class="num">{{.Files}}</td><td class="num" data-sort="{{.CPUMS}}">{{ms .CPUMS}}</td><td class="num" data-sort="{{.PeakRSSDelta}}">{{bytes .PeakRSSDelta}}</td><td class="num" data-sort="{{.AttachmentBytes}}">{{bytes .AttachmentBytes}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<script>
+// Sort a table by the clicked column, numerically where cells carry data-sort
+document.querySelectorAll("table.sortable th").forEach(function (th) {
+  th.addEventListener("click", function () {
+    var table = th.closest("table");
+    var column = Array.prototype.indexOf.call(th.parentNode.children, th);
+    var rows = Array.prototype.slice.call(table.rows, 1);
+    var descending = th.dataset.order !== "desc";
+    th.dataset.order = descending ? "desc" : "asc";
+    rows.sort(function (a, b) {
+      var x = a.cells[column], y = b.cells[column];
+      var xv = x.dataset.sort !== undefined ? parseFloat(x.dataset.sort) : (isNaN(x.textContent) ? x.textContent : parseFloat(x.textContent));
+      var yv = y.dataset.sort !== undefined ? parseFloat(y.dataset.sort) : (isNaN(y.textContent) ? y.textContent : parseFloat(y.textContent));
+      var order = xv < yv ? -1 : xv > yv ? 1 : 0;
+      return descending ? -order : order;
+    });
+    rows.forEach(function (row) { row.parentNode.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
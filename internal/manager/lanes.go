@@ -0,0 +1,109 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"emil/internal/models"
+	"emil/internal/worker"
+)
+
+// textLane reports whether text-only messages get their own workers. Tagged
+// PDFs come only from Chrome, so with -pdf-ua every message needs it.
+func (m *Manager) textLane() bool {
+	return m.config.TextWorkers > 0 && !m.config.PDFUA
+}
+
+// startTextWorkers starts the workers of the text lane, which take only
+// text-only messages, so renders queued behind Chrome never hold them up
+func (m *Manager) startTextWorkers(ctx context.Context) error {
+	if m.textChan == nil {
+		return nil
+	}
+	for i := 0; i < m.config.TextWorkers; i++ {
+		m.ownersLock.Lock()
+		w, err := worker.NewWorker(m.nextWorkerID, m.textChan, nil, m.statusChan, m.intake, m.deps)
+		if err != nil {
+			m.ownersLock.Unlock()
+			return err
+		}
+		m.liveWorkers[m.nextWorkerID] = w
+		m.textWorkerIDs[m.nextWorkerID] = true
+		m.nextWorkerID++
+		m.ownersLock.Unlock()
+
+		w.Start(ctx, m.resourceMgr.PauseControl())
+		m.textWorkers = append(m.textWorkers, w)
+	}
+	return nil
+}
+
+// queueFor returns the queue of a task's lane
+func (m *Manager) queueFor(task models.Task) chan models.Task {
+	if task.TextOnly && m.textChan != nil {
+		return m.textChan
+	}
+	return m.taskChan
+}
+
+// enqueueLanes queues the files, each lane from its own goroutine, so a full
+// queue of messages waiting for Chrome doesn't hold back text-only ones
+func (m *Manager) enqueueLanes(files []FileInfo) {
+	if m.textChan == nil {
+		m.enqueue(files)
+		return
+	}
+
+	var text, other []FileInfo
+	for _, file := range files {
+		if file.TextOnly {
+			text = append(text, file)
+		} else {
+			other = append(other, file)
+		}
+	}
+	fmt.Printf("Text lane: %d text-only messages for %d text workers\n", len(text), m.config.TextWorkers)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.enqueue(text)
+	}()
+	m.enqueue(other)
+	wg.Wait()
+}
+
+// enqueue queues the files in order, leaving those not yet queued when the
+// time budget is up for the next run
+func (m *Manager) enqueue(files []FileInfo) {
+	for i, fileInfo := range files {
+		if m.budgetSpent() {
+			m.deferFiles(files[i:])
+			return
+		}
+
+		task := models.Task{
+			ID:        fileInfo.Path,
+			FilePath:  fileInfo.Path,
+			Status:    models.StatusPending,
+			FileSize:  fileInfo.Size,
+			ModTime:   fileInfo.ModTime,
+			TextOnly:  fileInfo.TextOnly,
+			StartTime: time.Now(),
+		}
+
+		m.tasksByIDLock.Lock()
+		m.tasksByID[task.ID] = task
+		m.tasksByIDLock.Unlock()
+
+		m.outstanding.Add(1)
+		select {
+		case m.queueFor(task) <- task:
+		case <-m.expired:
+			m.deferTask(task)
+		}
+	}
+}
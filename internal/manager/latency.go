@@ -0,0 +1,112 @@
+package manager
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"emil/internal/models"
+)
+
+const (
+	// Ratio between the bounds of neighbouring histogram buckets, so
+	// percentiles are read to within 5%
+	latencyGrowth = 1.05
+
+	// Slowest files kept for the summary
+	latencySlowest = 10
+)
+
+// latencyHistogram counts conversion times in buckets whose bounds grow
+// geometrically from a millisecond, so a run's percentiles are kept in a
+// few hundred counters however many files it converts
+type latencyHistogram struct {
+	buckets []int // Files per bucket; bucket i holds times up to latencyGrowth^i ms
+	files   int
+	max     time.Duration
+}
+
+// add counts one conversion time
+func (h *latencyHistogram) add(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	bucket := 0
+	if ms > 1 {
+		bucket = int(math.Ceil(math.Log(ms) / math.Log(latencyGrowth)))
+	}
+	if bucket >= len(h.buckets) {
+		h.buckets = append(h.buckets, make([]int, bucket+1-len(h.buckets))...)
+	}
+	h.buckets[bucket]++
+	h.files++
+	h.max = max(h.max, d)
+}
+
+// percentile returns the time within which the fraction q of the files
+// finished, rounded up to its bucket's bound but never above the slowest
+func (h *latencyHistogram) percentile(q float64) time.Duration {
+	rank := int(math.Ceil(q * float64(h.files)))
+	seen := 0
+	for bucket, count := range h.buckets {
+		seen += count
+		if seen >= rank {
+			bound := time.Duration(math.Pow(latencyGrowth, float64(bucket)) * float64(time.Millisecond))
+			return min(bound, h.max)
+		}
+	}
+	return h.max
+}
+
+// latencyTracker records conversion times by renderer path and the slowest
+// files, for the summary at the end of a run
+type latencyTracker struct {
+	paths   map[string]*latencyHistogram
+	slowest []models.SlowFile // Slowest first
+}
+
+// newLatencyTracker creates a tracker with no files recorded
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{paths: make(map[string]*latencyHistogram)}
+}
+
+// record adds a finished file
+func (l *latencyTracker) record(update models.StatusUpdate) {
+	path := conversionPath(update)
+	duration := update.ProcessingStats.Duration
+
+	histogram := l.paths[path]
+	if histogram == nil {
+		histogram = &latencyHistogram{}
+		l.paths[path] = histogram
+	}
+	histogram.add(duration)
+
+	if len(l.slowest) < latencySlowest || duration > l.slowest[len(l.slowest)-1].Duration {
+		at := sort.Search(len(l.slowest), func(i int) bool { return l.slowest[i].Duration < duration })
+		l.slowest = append(l.slowest, models.SlowFile{})
+		copy(l.slowest[at+1:], l.slowest[at:])
+		l.slowest[at] = models.SlowFile{Path: update.FilePath, Renderer: path, Duration: duration}
+		if len(l.slowest) > latencySlowest {
+			l.slowest = l.slowest[:latencySlowest]
+		}
+	}
+}
+
+// summary returns the percentiles of each path, most files first
+func (l *latencyTracker) summary() []models.LatencySummary {
+	summaries := make([]models.LatencySummary, 0, len(l.paths))
+	for path, histogram := range l.paths {
+		summaries = append(summaries, models.LatencySummary{
+			Path:  path,
+			Files: histogram.files,
+			P50:   histogram.percentile(0.50),
+			P90:   histogram.percentile(0.90),
+			P99:   histogram.percentile(0.99),
+			Max:   histogram.max,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		return a.Files > b.Files || (a.Files == b.Files && a.Path < b.Path)
+	})
+	return summaries
+}
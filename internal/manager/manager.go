@@ -5,17 +5,23 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/schollz/progressbar/v3"
-
+	"emil/internal/backends"
+	"emil/internal/checkpoint"
 	"emil/internal/config"
+	"emil/internal/converter"
+	"emil/internal/dashboard"
+	"emil/internal/discovery"
 	"emil/internal/models"
+	"emil/internal/ocr"
 	"emil/internal/resource"
 	"emil/internal/security"
+	"emil/internal/slots"
+	"emil/internal/statsd"
 	"emil/internal/worker"
 )
 
@@ -23,6 +29,9 @@ const (
 	// Time between progress updates when verbose mode is on
 	verboseUpdateInterval = 5 * time.Second
 
+	// Extension of the files discovered when none are configured
+	defaultExtension = ".eml"
+
 	// How long before considering a task stuck
 	stuckTaskThreshold = 3 * time.Minute
 )
@@ -32,26 +41,71 @@ type Manager struct {
 	config        *config.Config
 	workers       []*worker.Worker
 	taskChan      chan models.Task
+	textChan      chan models.Task // Queue of the text lane (nil = no text lane)
+	textWorkers   []*worker.Worker // Workers that take only from textChan
 	statusChan    chan models.StatusUpdate
 	statsLock     sync.RWMutex
 	stats         models.Stats
+	counts        taskCounts // Task counts, kept apart from stats so they are updated atomically
 	cancel        context.CancelFunc
-	progressBar   *progressbar.ProgressBar
+	progress      *progress
+	eta           *etaModel       // Guarded by statsLock
+	latency       *latencyTracker // Guarded by statsLock
 	tasksByID     map[string]models.Task
 	tasksByIDLock sync.RWMutex
 	resourceMgr   *resource.Manager
 	failedTasks   []models.Task
 	stuckTasks    map[string]time.Time
 	stuckTaskLock sync.Mutex
-	scanner       *security.Scanner
+	deps          worker.WorkerDeps // What every worker is started with
+	fileReports   []models.FileReport
+	metrics       *statsd.Client
+
+	// Newest failures and alerts for the dashboard
+	recentFailures []models.FileReport
+	recentAlerts   []dashboard.Alert
+	lastUpdate     time.Time // When a worker last reported, for the liveness check
+
+	// Finished files waiting for the audit log
+	auditQueue  chan models.FileReport
+	auditDone   chan struct{}
+	auditAnchor *models.AuditAnchor // Head of the audit log once auditDone is closed
+
+	// Held closed while an operator has paused intake
+	intake *worker.Gate
+
+	// Task ownership, for requeuing the tasks of workers that stop sending heartbeats
+	owners        map[string]int         // Worker holding each in-flight task
+	liveWorkers   map[int]*worker.Worker // Every worker started, by ID
+	textWorkerIDs map[int]bool           // Workers of the text lane, which can't take other tasks
+	nextWorkerID  int
+	ownersLock    sync.Mutex
+	outstanding   sync.WaitGroup // Tasks enqueued but not yet complete or failed
+	taskChanLock  sync.RWMutex
+	tasksClosed   bool
+
+	// Message-IDs of converted files for the -expect-ids check, guarded by statsLock
+	convertedIDs map[string][]string // Files converted, by normalized Message-ID
+	withoutID    []string            // Files converted without a Message-ID
+
+	// Converted files to group into threads at the end of the run, by path,
+	// guarded by statsLock
+	threadMembers map[string]threadMember
+
+	// Files earlier runs converted, and this run's as they finish (nil = no -checkpoint)
+	checkpoint *checkpoint.Checkpoint
+	expired    chan struct{} // Closed when the run's -max-duration is up or an alert aborts it
+	expireOnce sync.Once
 }
 
-// NewManager creates a new manager instance
-func NewManager(cfg *config.Config, scanner *security.Scanner) *Manager {
-	return &Manager{
+// NewManager creates a new manager instance. It works on its own copy of
+// cfg, so the services it sets up for the run don't leak into the caller's.
+func NewManager(cfg *config.Config, scanner *security.Scanner, ocrEngine *ocr.Engine) *Manager {
+	run := *cfg
+	cfg = &run
+	m := &Manager{
 		config:     cfg,
-		taskChan:   make(chan models.Task, 100),
-		statusChan: make(chan models.StatusUpdate, 100),
+		statusChan: make(chan models.StatusUpdate, statusQueueDepth(cfg.WorkerCount*2+cfg.TextWorkers)),
 		tasksByID:  make(map[string]models.Task),
 		stats: models.Stats{
 			StartTime:      time.Now(),
@@ -59,15 +113,26 @@ func NewManager(cfg *config.Config, scanner *security.Scanner) *Manager {
 			MaxWorkers:     cfg.WorkerCount * 2,
 			MinWorkers:     1,
 		},
-		stuckTasks: make(map[string]time.Time),
-		scanner:    scanner,
+		lastUpdate:  time.Now(),
+		eta:         newETAModel(),
+		latency:     newLatencyTracker(),
+		stuckTasks:  make(map[string]time.Time),
+		deps:        worker.WorkerDeps{Config: cfg, Scanner: scanner, OCR: ocrEngine},
+		intake:      worker.NewGate(),
+		owners:      make(map[string]int),
+		liveWorkers: make(map[int]*worker.Worker),
+		expired:     make(chan struct{}),
+
+		textWorkerIDs: make(map[int]bool),
 	}
+	return m
 }
 
 // Start begins the processing operation
 func (m *Manager) Start() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	m.cancel = cancel
+	defer cancel()
 
 	// Initialize resource manager with config parameters
 	m.resourceMgr = resource.NewManager(
@@ -77,8 +142,74 @@ func (m *Manager) Start() error {
 		80.0,                           // Target CPU percentage
 		m.config.Verbose,               // Verbose logging
 	)
+
+	// Bound Chrome renders separately from workers if asked to
+	if m.config.RenderSlots == nil {
+		m.config.RenderSlots = slots.New(m.config.MaxRenders)
+	}
+	renders := m.config.RenderSlots
+	m.resourceMgr.OnPressure(renders.SetPressure)
+	defer renders.SetPressure(false)
 	m.resourceMgr.Start(ctx)
 
+	// Hold large files back until memory allows
+	if m.config.LargeFileMB > 0 {
+		m.deps.Admission = worker.NewAdmission(int64(m.config.LargeFileMB)*1024*1024, m.resourceMgr.Headroom)
+	}
+
+	// Bound the files the conversions hold open by the I/O profile
+	if m.config.FileSlots == nil {
+		profile, err := converter.LookupIOProfile(m.config.IOProfile)
+		if err != nil {
+			return err
+		}
+		m.config.FileSlots = slots.New(profile.OpenFiles)
+	}
+
+	// Keep the files they hold open under the process's limit
+	if m.config.DescriptorSlots == nil {
+		_, budget := converter.SetupDescriptorBudget(m.config.WorkerCount*2 + m.config.TextWorkers)
+		m.config.DescriptorSlots = slots.New(budget)
+	}
+
+	// Probe the renderers, and give up on failing ones, once per run
+	if m.config.Renderers == nil {
+		m.config.Renderers = backends.New()
+	}
+
+	// Scan each attachment content once per run
+	if m.config.ScanVerdicts == nil {
+		m.config.ScanVerdicts = security.NewVerdicts()
+	}
+
+	// Open the audit log before converting anything, so no conversion goes unrecorded
+	if err := m.startAudit(); err != nil {
+		return err
+	}
+
+	// Connect the metrics sink if configured
+	m.startMetrics()
+	defer m.finishMetrics()
+
+	// Detonate attachments in the sandbox if configured
+	if err := m.startSandbox(); err != nil {
+		return err
+	}
+
+	// Check links and relays against the reputation providers if configured
+	if err := m.startReputation(); err != nil {
+		return err
+	}
+
+	// Serve the live dashboard if configured
+	m.startDashboard(ctx)
+
+	// Read the files earlier runs converted before discovering what's left
+	if err := m.openCheckpoint(); err != nil {
+		return err
+	}
+	defer m.closeCheckpoint()
+
 	// Start monitoring for stuck tasks
 	go m.monitorStuckTasks(ctx)
 
@@ -87,9 +218,19 @@ func (m *Manager) Start() error {
 	if err != nil {
 		return fmt.Errorf("file discovery failed: %w", err)
 	}
+	files = m.skipCheckpointed(files)
+
+	if m.config.Manifest != nil {
+		m.applyManifest(files)
+	}
+
+	// Leave the files past the run's budget for the next run
+	found := len(files)
+	files, deferred := m.applyBudget(files)
+	m.counts.discovered.Store(int64(found))
+	m.counts.deferred.Store(int64(len(deferred)))
 
 	m.statsLock.Lock()
-	m.stats.Discovered = len(files)
 	var totalSize int64
 	for _, fileInfo := range files {
 		totalSize += fileInfo.Size
@@ -97,62 +238,131 @@ func (m *Manager) Start() error {
 	m.stats.TotalFileSize = totalSize
 	m.statsLock.Unlock()
 
-	fmt.Printf("Found %d EML files to process (%.2f MB total)\n",
-		len(files), float64(totalSize)/(1024*1024))
-
-	// Create progress bar
-	m.progressBar = progressbar.NewOptions(len(files),
-		progressbar.OptionSetDescription("Converting"),
-		progressbar.OptionShowCount(),
-		progressbar.OptionShowElapsedTimeOnFinish(),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "=",
-			SaucerHead:    ">",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}),
-	)
+	if len(deferred) > 0 {
+		fmt.Printf("Found %d EML files; converting %d within the budget (%.2f MB total), leaving %d for the next run\n",
+			found, len(files), float64(totalSize)/(1024*1024), len(deferred))
+	} else {
+		fmt.Printf("Found %d EML files to process (%.2f MB total)\n",
+			len(files), float64(totalSize)/(1024*1024))
+	}
+
+	// Create the progress display
+	m.progress = newProgress(m.config.ProgressMode)
+	m.progress.addTotal(len(files), totalSize)
+
+	// Size the task queues for the workers and the files found
+	m.makeQueues(files)
+	go m.reportQueueDepth(ctx)
 
 	// Start workers
-	m.initWorkers(ctx)
+	if err := m.initWorkers(ctx); err != nil {
+		return err
+	}
+	if err := m.startTextWorkers(ctx); err != nil {
+		return err
+	}
 
 	// Start status monitor
 	go m.monitorStatus(ctx)
+	go m.monitorHeartbeats(ctx)
 
 	// If verbose, show more detailed progress updates
 	if m.config.Verbose {
 		go m.verboseProgressUpdates(ctx)
 	}
 
-	// Enqueue tasks
-	for _, fileInfo := range files {
-		task := models.Task{
-			ID:        filepath.Base(fileInfo.Path),
-			FilePath:  fileInfo.Path,
-			Status:    models.StatusPending,
-			FileSize:  fileInfo.Size,
-			StartTime: time.Now(),
-		}
+	// Stop taking on files when the time budget is up
+	m.watchDeadline(ctx)
 
-		m.tasksByIDLock.Lock()
-		m.tasksByID[task.ID] = task
-		m.tasksByIDLock.Unlock()
-
-		m.taskChan <- task
+	// Enqueue tasks, text-only messages in their own lane
+	m.enqueueLanes(files)
+	if m.budgetSpent() {
+		m.deferQueued()
 	}
 
-	// Wait for all tasks to be processed
-	close(m.taskChan)
+	// Wait for all tasks to be processed, requeuing any whose worker is lost
+	m.waitForTasks(ctx)
+	m.closeTasks()
 
 	// Wait for workers to finish
-	for _, w := range m.workers {
+	for _, w := range append(m.workers, m.textWorkers...) {
 		<-w.Done()
 	}
+	m.waitForStatusUpdates()
+	m.progress.finish()
+	m.finishAudit()
+
+	// Group the converted messages into conversations
+	if m.threadsWanted() {
+		m.assignThreads()
+	}
+
+	// Combine each folder's PDFs into one document if requested
+	if m.config.MergePerFolder {
+		m.mergeFolders()
+	}
+
+	// Merge the sandbox's verdicts on the attachments into the report
+	m.collectVerdicts()
 
 	m.statsLock.Lock()
 	m.stats.EndTime = time.Now()
+	m.stats.InvariantViolations = m.counts.checkInvariants(ctx.Err() != nil)
 	m.statsLock.Unlock()
+	for _, violation := range m.stats.InvariantViolations {
+		log.Printf("Warning: run statistics are inconsistent: %s", violation)
+	}
+
+	// Compare the converted messages with those the migration should deliver
+	if m.config.ExpectedIDs != nil {
+		m.checkMigration()
+	}
+	if m.config.CheckDuplicates {
+		m.checkDuplicates()
+	}
+
+	// Write the run report if requested
+	if m.config.ReportFile != "" {
+		if err := m.writeReport(); err != nil {
+			log.Printf("Warning: %v", err)
+		} else if m.config.Verbose {
+			fmt.Printf("Report written to %s\n", m.config.ReportFile)
+		}
+	}
+	if m.config.HTMLReportFile != "" {
+		if err := m.writeHTMLReport(); err != nil {
+			log.Printf("Warning: %v", err)
+		} else if m.config.Verbose {
+			fmt.Printf("HTML report written to %s\n", m.config.HTMLReportFile)
+		}
+	}
+	if m.config.SecurityReport != "" {
+		if err := m.writeSecurityReport(); err != nil {
+			log.Printf("Warning: %v", err)
+		} else if m.config.Verbose {
+			jsonPath, htmlPath := securityReportPaths(m.config.SecurityReport)
+			fmt.Printf("Security report written to %s and %s\n", jsonPath, htmlPath)
+		}
+	}
+	if m.config.SigningKeyFile != "" {
+		if err := m.signReports(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	if m.config.HistoryFile != "" {
+		if err := m.recordHistory(); err != nil {
+			log.Printf("Warning: %v", err)
+		} else if m.config.Verbose {
+			fmt.Printf("Run recorded in %s\n", m.config.HistoryFile)
+		}
+	}
+	if len(m.config.NotifyTo) > 0 {
+		if err := m.sendNotification(); err != nil {
+			log.Printf("Warning: %v", err)
+		} else if m.config.Verbose {
+			fmt.Printf("Run summary emailed to %s\n", strings.Join(m.config.NotifyTo, ", "))
+		}
+	}
 
 	// Show remaining failed tasks if any
 	if len(m.failedTasks) > 0 {
@@ -181,64 +391,113 @@ func (m *Manager) Stop() {
 func (m *Manager) Stats() models.Stats {
 	m.statsLock.RLock()
 	defer m.statsLock.RUnlock()
-	return m.stats
+	return m.statsLocked()
+}
+
+// statsLocked returns the statistics with the current task counts. Callers
+// hold statsLock.
+func (m *Manager) statsLocked() models.Stats {
+	stats := m.stats
+	m.counts.fill(&stats)
+	stats.Latency = m.latency.summary()
+	stats.SlowestFiles = append([]models.SlowFile(nil), m.latency.slowest...)
+	if m.deps.Scanner != nil {
+		stats.Scanning = m.deps.Scanner.Stats()
+	}
+	return stats
 }
 
 // FileInfo represents a discovered file
 type FileInfo struct {
-	Path string
-	Size int64
+	Path     string
+	Size     int64
+	ModTime  time.Time
+	TextOnly bool // Whether the message has no HTML part, when there is a text lane
 }
 
-// discoverFiles finds all EML files in the source directory
+// DiscoveryOptions returns how a run with cfg finds its messages: by
+// extension or, if enabled, by content, applying the symbolic link and
+// filesystem policies and leaving out the directories runs write outputs to
+func DiscoveryOptions(cfg *config.Config) discovery.Options {
+	extensions := cfg.Extensions
+	if len(extensions) == 0 {
+		extensions = []string{defaultExtension}
+	}
+	return discovery.Options{
+		Recursive:     cfg.RecursiveScan,
+		Symlinks:      cfg.Symlinks,
+		OneFilesystem: cfg.OneFilesystem,
+		Match: func(path string, info os.FileInfo) bool {
+			return discovery.MatchesExtension(path, extensions) || (cfg.SniffContent && discovery.LooksLikeMessage(path))
+		},
+		SkipDir: func(path string) bool {
+			return converter.OutputDir(path, cfg)
+		},
+	}
+}
+
+// discoverFiles finds all messages in the source directories with the
+// run's DiscoveryOptions. Files under nested sources are found once.
 func (m *Manager) discoverFiles() ([]FileInfo, error) {
 	var files []FileInfo
+	seen := make(map[string]bool)
 
-	walkFn := func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip directories if not recursive
-		if info.IsDir() && !m.config.RecursiveScan && path != m.config.SourceDir {
-			return filepath.SkipDir
-		}
-
-		// Check if file is an EML file
-		if !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".eml" {
+	opts := DiscoveryOptions(m.config)
+	opts.Skipped = func(path, reason string) {
+		log.Printf("Warning: skipped %s: %s", path, reason)
+	}
+	opts.Parallelism = m.walkWorkers()
+	for _, source := range m.config.SourceList() {
+		err := discovery.Walk(source.Dir, opts, func(path string, info os.FileInfo) error {
+			if seen[path] {
+				return nil
+			}
+			seen[path] = true
 			files = append(files, FileInfo{
-				Path: path,
-				Size: info.Size(),
+				Path:     path,
+				Size:     info.Size(),
+				ModTime:  info.ModTime(),
+				TextOnly: m.textLane() && discovery.TextOnly(path),
 			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
-
-		return nil
-	}
-
-	if err := filepath.Walk(m.config.SourceDir, walkFn); err != nil {
-		return nil, err
 	}
 
 	return files, nil
 }
 
+// walkWorkers returns how many directories discovery reads at once, no more
+// than the I/O profile keeps files open
+func (m *Manager) walkWorkers() int {
+	profile, err := converter.LookupIOProfile(m.config.IOProfile)
+	if err != nil || profile.OpenFiles <= 0 {
+		return m.config.WalkWorkers
+	}
+	return min(m.config.WalkWorkers, profile.OpenFiles)
+}
+
 // initWorkers creates and starts the worker pool
-func (m *Manager) initWorkers(ctx context.Context) {
+func (m *Manager) initWorkers(ctx context.Context) error {
 	m.workers = make([]*worker.Worker, m.config.WorkerCount)
 
 	for i := 0; i < m.config.WorkerCount; i++ {
-		m.workers[i] = worker.NewWorker(i, m.taskChan, m.statusChan, m.config, m.scanner)
-		m.workers[i].Start(ctx, m.resourceMgr.PauseControl())
+		w, err := m.startWorker(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to start workers: %w", err)
+		}
+		m.workers[i] = w
 	}
 
 	// Start goroutine to handle dynamic worker scaling
 	go func() {
 		workerPool := make(map[int]*worker.Worker)
-		nextWorkerID := m.config.WorkerCount
 
 		// Initialize with current workers
-		for i, w := range m.workers {
-			workerPool[i] = w
+		for _, w := range m.workers {
+			workerPool[w.ID()] = w
 		}
 
 		for {
@@ -249,10 +508,12 @@ func (m *Manager) initWorkers(ctx context.Context) {
 			case adjustment := <-m.resourceMgr.WorkerControl():
 				if adjustment > 0 {
 					// Add a worker
-					w := worker.NewWorker(nextWorkerID, m.taskChan, m.statusChan, m.config, m.scanner)
-					w.Start(ctx, m.resourceMgr.PauseControl())
-					workerPool[nextWorkerID] = w
-					nextWorkerID++
+					w, err := m.startWorker(ctx)
+					if err != nil {
+						log.Printf("Failed to add a worker: %v", err)
+						continue
+					}
+					workerPool[w.ID()] = w
 
 					m.statsLock.Lock()
 					m.stats.CurrentWorkers++
@@ -287,6 +548,7 @@ func (m *Manager) initWorkers(ctx context.Context) {
 			}
 		}
 	}()
+	return nil
 }
 
 // monitorStatus processes status updates from workers
@@ -303,8 +565,24 @@ func (m *Manager) monitorStatus(ctx context.Context) {
 
 // handleStatusUpdate processes a worker status update
 func (m *Manager) handleStatusUpdate(update models.StatusUpdate) {
+	// Ignore updates from attempts abandoned when their task was requeued
+	if !m.trackOwner(update) {
+		return
+	}
+
+	// Count the task's move to a new state, ignoring updates about tasks
+	// that already finished
 	m.tasksByIDLock.Lock()
-	if task, exists := m.tasksByID[update.TaskID]; exists {
+	task, exists := m.tasksByID[update.TaskID]
+	if !m.counts.transition(task.Status, update.Status) {
+		m.tasksByIDLock.Unlock()
+		if m.config.Verbose {
+			log.Printf("Warning: ignoring %s update for %s, which already finished", update.Status, update.TaskID)
+		}
+		return
+	}
+	if exists {
+		update.FilePath = task.FilePath
 		task.Status = update.Status
 		task.Error = update.Error
 
@@ -329,15 +607,29 @@ func (m *Manager) handleStatusUpdate(update models.StatusUpdate) {
 	}
 	m.tasksByIDLock.Unlock()
 
+	var audited *models.FileReport
 	m.statsLock.Lock()
+	m.lastUpdate = time.Now()
 	switch update.Status {
-	case models.StatusProcessing:
-		m.stats.Processing++
 	case models.StatusComplete:
-		m.stats.Processed++
-		m.stats.Successful++
-		m.stats.Processing--
-		m.progressBar.Add(1)
+		m.recordAlerts(update, task.FilePath)
+		if update.ProcessingStats.Truncated {
+			m.stats.Truncated++
+		}
+		if update.ProcessingStats.EmptyBody {
+			m.stats.EmptyBodies++
+		}
+		if len(update.ProcessingStats.HeaderAnomalies) > 0 {
+			m.stats.Anomalous++
+		}
+		m.eta.record(update)
+		m.latency.record(update)
+		m.progress.done(update.ProcessingStats.FileSize)
+		audited = m.recordFile(update)
+		m.recordCheckpoint(task)
+		m.recordMessageID(update)
+		m.recordThread(update)
+		m.recordMetrics(update)
 
 		// Update speed calculation
 		duration := update.ProcessingStats.Duration.Seconds()
@@ -352,10 +644,18 @@ func (m *Manager) handleStatusUpdate(update models.StatusUpdate) {
 		}
 
 	case models.StatusFailed:
-		m.stats.Processed++
-		m.stats.Failed++
-		m.stats.Processing--
-		m.progressBar.Add(1)
+		m.recordAlerts(update, task.FilePath)
+		m.eta.record(update)
+		m.latency.record(update)
+		m.progress.done(update.ProcessingStats.FileSize)
+		audited = m.recordFile(update)
+		if converter.ErrorClass(update.Error) == converter.ErrorClassDescriptors {
+			if m.stats.FDExhausted == 0 {
+				log.Printf("Warning: out of file descriptors converting %s; raise ulimit -n or lower -workers", task.FilePath)
+			}
+			m.stats.FDExhausted++
+		}
+		m.recordMetrics(update)
 
 		// Store failed task for final report
 		m.tasksByIDLock.Lock()
@@ -368,7 +668,25 @@ func (m *Manager) handleStatusUpdate(update models.StatusUpdate) {
 			fmt.Printf("\nFailed to convert %s: %v\n", update.TaskID, update.Error)
 		}
 	}
+	if finished(update.Status) {
+		left := m.counts.discovered.Load() - m.counts.processed.Load() - m.counts.deferred.Load()
+		m.progress.setETA(m.eta.remaining(int(left), m.stats.CurrentWorkers))
+	}
 	m.statsLock.Unlock()
+
+	// Queued outside statsLock, which a full queue would otherwise hold
+	if audited != nil {
+		m.recordAudit(*audited)
+	}
+
+	// Pass the update on to an embedding program
+	if m.config.ProgressFunc != nil {
+		m.config.ProgressFunc(update)
+	}
+
+	if update.Status == models.StatusComplete || update.Status == models.StatusFailed {
+		m.outstanding.Done()
+	}
 }
 
 // verboseProgressUpdates shows detailed progress in verbose mode
@@ -383,7 +701,9 @@ func (m *Manager) verboseProgressUpdates(ctx context.Context) {
 
 		case <-ticker.C:
 			m.statsLock.RLock()
-			stats := m.stats
+			stats := m.statsLocked()
+			estRemaining := m.eta.remaining(stats.Discovered-stats.Processed-stats.Deferred, stats.CurrentWorkers)
+			mix := m.eta.mix()
 			m.statsLock.RUnlock()
 
 			elapsed := time.Since(stats.StartTime).Seconds()
@@ -394,24 +714,19 @@ func (m *Manager) verboseProgressUpdates(ctx context.Context) {
 				bytesPerSec = float64(stats.TotalFileSize) / elapsed
 			}
 
-			remainingFiles := stats.Discovered - stats.Processed
-			var estRemaining time.Duration
-			if bytesPerSec > 0 && stats.Processed > 0 {
-				avgFileSize := float64(stats.TotalFileSize) / float64(stats.Discovered)
-				estRemaining = time.Duration(float64(remainingFiles)*avgFileSize/bytesPerSec) * time.Second
-			} else {
-				estRemaining = time.Duration(0)
-			}
-
 			memUsage := m.resourceMgr.MemoryUsage()
+			total := stats.Discovered - stats.Deferred
 
 			fmt.Printf("\nStatus: %d/%d files processed (%.1f%%) | Workers: %d | Memory: %.1f%% | Speed: %.2f KB/s | ETA: %s\n",
-				stats.Processed, stats.Discovered,
-				float64(stats.Processed)/float64(stats.Discovered)*100,
+				stats.Processed, total,
+				float64(stats.Processed)/float64(total)*100,
 				stats.CurrentWorkers,
 				memUsage,
 				bytesPerSec/1024,
 				estRemaining.Round(time.Second).String())
+			if mix != "" {
+				fmt.Printf("Time per file: %s\n", mix)
+			}
 		}
 	}
 }
@@ -444,3 +759,28 @@ func (m *Manager) monitorStuckTasks(ctx context.Context) {
 		}
 	}
 }
+
+// applyManifest orders files so those the manifest gives higher priorities
+// are converted first, keeping discovery order otherwise, and warns about
+// listed files that weren't found
+func (m *Manager) applyManifest(files []FileInfo) {
+	priority := func(file FileInfo) int {
+		if entry := m.config.Manifest.Lookup(file.Path); entry != nil {
+			return entry.Priority
+		}
+		return 0
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return priority(files[i]) > priority(files[j])
+	})
+
+	listed := 0
+	for _, file := range files {
+		if m.config.Manifest.Lookup(file.Path) != nil {
+			listed++
+		}
+	}
+	if missing := m.config.Manifest.Len() - listed; missing > 0 {
+		log.Printf("Warning: %d files listed in the manifest were not found in %s", missing, m.sourceDescription())
+	}
+}
@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"emil/internal/converter"
+	"emil/internal/metadata"
+	"emil/internal/models"
+)
+
+// mergedSuffix is appended to a folder's name to name its merged PDF
+const mergedSuffix = "_merged.pdf"
+
+// mergeFolders writes one merged PDF per output folder holding the messages
+// converted there in this run
+func (m *Manager) mergeFolders() {
+	folders := make(map[string][]converter.MergeEntry)
+
+	// The contents list shows dates in the display zone, like the pages
+	var zone *time.Location
+	if m.config.Timezone != "" {
+		zone, _ = time.LoadLocation(m.config.Timezone)
+	}
+
+	for _, file := range m.fileReports {
+		if file.Status != string(models.StatusComplete) || len(file.OutputPaths) == 0 {
+			continue
+		}
+
+		entry := converter.MergeEntry{PDFs: file.OutputPaths}
+		if msg, err := metadata.Extract(file.InputPath); err == nil {
+			entry.Title = msg.Subject
+			entry.Date, _ = time.Parse(time.RFC3339, msg.Date)
+			if zone != nil && !entry.Date.IsZero() {
+				entry.Date = entry.Date.In(zone)
+			}
+		}
+		dir := filepath.Dir(file.OutputPaths[0])
+		folders[dir] = append(folders[dir], entry)
+	}
+
+	dirs := make([]string, 0, len(folders))
+	for dir := range folders {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		name := filepath.Base(dir)
+		if abs, err := filepath.Abs(dir); err == nil {
+			name = filepath.Base(abs)
+		}
+		path := filepath.Join(dir, name+mergedSuffix)
+		if err := converter.MergePDFs(path, name, folders[dir], converter.TempDir(m.config)); err != nil {
+			log.Printf("Warning: failed to merge %s: %v", dir, err)
+			continue
+		}
+		fmt.Printf("Merged %d messages into %s\n", len(folders[dir]), path)
+	}
+}
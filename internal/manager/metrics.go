@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"log"
+
+	"emil/internal/converter"
+	"emil/internal/models"
+	"emil/internal/security"
+	"emil/internal/statsd"
+)
+
+// startMetrics connects the statsd sink if one is configured. The run goes on
+// without metrics if it cannot connect.
+func (m *Manager) startMetrics() {
+	if m.config.StatsdAddress == "" {
+		return
+	}
+
+	tags := append([]string{statsd.Tag("source_dir", m.config.SourceDir)}, m.config.StatsdTags...)
+	client, err := statsd.New(m.config.StatsdAddress, m.config.StatsdPrefix, m.config.StatsdFormat, tags)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	m.metrics = client
+
+	if scanner := m.deps.Scanner; scanner != nil && scanner.IsEnabled() {
+		scanner.OnScan(m.recordScan)
+	}
+}
+
+// recordScan emits the timing of a virus scan, tagged with the clamd
+// instance it went to
+func (m *Manager) recordScan(timing security.ScanTiming) {
+	instance := statsd.Tag("clamd", timing.Instance)
+	m.metrics.Timing("scan.time", timing.Scan, instance)
+	m.metrics.Timing("scan.wait", timing.Wait, instance)
+	m.metrics.Count("scan.bytes", timing.Bytes, instance)
+	if timing.Err != nil {
+		m.metrics.Count("scan.failed", 1, instance)
+	}
+}
+
+// recordMetrics emits the counts and timing of a finished file
+func (m *Manager) recordMetrics(update models.StatusUpdate) {
+	if m.metrics == nil {
+		return
+	}
+
+	stats := update.ProcessingStats
+	renderer := statsd.Tag("renderer", stats.Renderer)
+	switch update.Status {
+	case models.StatusComplete:
+		m.metrics.Count("files.converted", 1, renderer)
+		m.metrics.Count("bytes.converted", stats.FileSize, renderer)
+		m.metrics.Timing("conversion.time", stats.Duration, renderer, statsd.Tag("status", "complete"))
+	case models.StatusFailed:
+		class := statsd.Tag("error_class", converter.ErrorClass(update.Error))
+		m.metrics.Count("files.failed", 1, class)
+		m.metrics.Timing("conversion.time", stats.Duration, class, statsd.Tag("status", "failed"))
+	}
+	if stats.Retries > 0 {
+		m.metrics.Count("files.retries", int64(stats.Retries))
+	}
+}
+
+// finishMetrics emits the run totals and closes the sink
+func (m *Manager) finishMetrics() {
+	if m.metrics == nil {
+		return
+	}
+
+	stats := m.Stats()
+	m.metrics.Timing("run.time", stats.EndTime.Sub(stats.StartTime))
+	m.metrics.Gauge("run.discovered", float64(stats.Discovered))
+	m.metrics.Gauge("run.successful", float64(stats.Successful))
+	m.metrics.Gauge("run.failed", float64(stats.Failed))
+	if seconds := stats.EndTime.Sub(stats.StartTime).Seconds(); seconds > 0 {
+		m.metrics.Gauge("run.files_per_second", float64(stats.Processed)/seconds)
+	}
+	m.metrics.Close()
+}
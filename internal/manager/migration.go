@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"fmt"
+
+	"emil/internal/migration"
+	"emil/internal/models"
+)
+
+// Entries of each list printed at the end of a run; the report has them all
+const checkListLimit = 10
+
+// recordMessageID notes the Message-ID of a converted file for the
+// -expect-ids check. Callers hold statsLock.
+func (m *Manager) recordMessageID(update models.StatusUpdate) {
+	if m.config.ExpectedIDs == nil {
+		return
+	}
+	id := migration.NormalizeID(update.ProcessingStats.MessageID)
+	if id == "" {
+		m.withoutID = append(m.withoutID, update.FilePath)
+		return
+	}
+	if m.convertedIDs == nil {
+		m.convertedIDs = make(map[string][]string)
+	}
+	m.convertedIDs[id] = append(m.convertedIDs[id], update.FilePath)
+}
+
+// checkMigration compares the converted Message-IDs with the expected ones
+// and prints the differences
+func (m *Manager) checkMigration() {
+	m.statsLock.Lock()
+	check := m.config.ExpectedIDs.Check(m.convertedIDs, m.withoutID)
+	m.stats.Migration = check
+	m.statsLock.Unlock()
+
+	fmt.Printf("\nMigration check: %d of %d expected messages converted\n", check.Converted, check.Expected)
+	printCheckList("Missing (not found or failed to convert)", check.Missing)
+	printCheckList("Not expected", check.Extra)
+	printCheckList("Converted more than once", check.Duplicates)
+	printCheckList("Without a Message-ID", check.WithoutID)
+}
+
+// printCheckList prints the first entries of one list a post-run check found
+func printCheckList(title string, entries []string) {
+	if len(entries) == 0 {
+		return
+	}
+	fmt.Printf("%s: %d\n", title, len(entries))
+	for i, entry := range entries {
+		if i == checkListLimit {
+			fmt.Printf("  - ... and %d more\n", len(entries)-checkListLimit)
+			break
+		}
+		fmt.Printf("  - %s\n", entry)
+	}
+}
@@ -0,0 +1,38 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+)
+
+// Pause stops workers from taking new files, so the host can be yielded to
+// other work; files being converted finish. It returns false if intake was
+// already paused.
+func (m *Manager) Pause() bool {
+	if !m.intake.Pause() {
+		return false
+	}
+	fmt.Println("\nIntake paused; conversions in progress will finish")
+	return true
+}
+
+// Resume lets workers take new files again after Pause. It returns false if
+// intake was not paused.
+func (m *Manager) Resume() bool {
+	if !m.intake.Resume() {
+		return false
+	}
+
+	// Time spent paused is not a stall
+	m.statsLock.Lock()
+	m.lastUpdate = time.Now()
+	m.statsLock.Unlock()
+
+	fmt.Println("\nIntake resumed")
+	return true
+}
+
+// Paused reports whether intake is paused
+func (m *Manager) Paused() bool {
+	return m.intake.Paused()
+}
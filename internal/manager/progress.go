@@ -0,0 +1,114 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+// Progress display modes
+const (
+	ProgressFiles   = "files"   // A bar counting files against the number discovered
+	ProgressBytes   = "bytes"   // A bar counting source bytes, for runs with very uneven file sizes
+	ProgressSpinner = "spinner" // A count without a total, for when the total isn't known up front
+	ProgressNone    = "none"    // No progress display, e.g. when logging to a file
+)
+
+// CheckProgressMode validates a progress display mode
+func CheckProgressMode(mode string) error {
+	switch mode {
+	case "", ProgressFiles, ProgressBytes, ProgressSpinner, ProgressNone:
+		return nil
+	}
+	return fmt.Errorf("invalid progress mode %q (use %s, %s, %s or %s)", mode, ProgressFiles, ProgressBytes, ProgressSpinner, ProgressNone)
+}
+
+// progress shows how far a run is. Totals may grow while the run is under
+// way, as files are discovered; with no total it shows a spinner instead.
+type progress struct {
+	mode       string
+	bar        *progressbar.ProgressBar
+	totalFiles int64
+	totalBytes int64
+}
+
+// newProgress creates the progress display for a mode (empty = files)
+func newProgress(mode string) *progress {
+	if mode == "" {
+		mode = ProgressFiles
+	}
+	p := &progress{mode: mode}
+	if mode == ProgressNone {
+		return p
+	}
+
+	options := []progressbar.Option{
+		progressbar.OptionSetDescription("Converting"),
+		progressbar.OptionShowCount(),
+		progressbar.OptionShowElapsedTimeOnFinish(),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "=",
+			SaucerHead:    ">",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}),
+	}
+	if mode == ProgressBytes {
+		options = append(options, progressbar.OptionShowBytes(true))
+	}
+	if mode != ProgressSpinner {
+		// The bar's own prediction assumes every file costs the same, so
+		// the run's estimate is shown in the description instead
+		options = append(options, progressbar.OptionSetPredictTime(false))
+	}
+	// A maximum of -1 makes the bar an indeterminate spinner
+	p.bar = progressbar.NewOptions64(-1, options...)
+	return p
+}
+
+// addTotal grows the amount of work the bar is measured against
+func (p *progress) addTotal(files int, bytes int64) {
+	p.totalFiles += int64(files)
+	p.totalBytes += bytes
+	if p.bar == nil || p.mode == ProgressSpinner {
+		return
+	}
+	if p.mode == ProgressBytes {
+		p.bar.ChangeMax64(p.totalBytes)
+	} else {
+		p.bar.ChangeMax64(p.totalFiles)
+	}
+}
+
+// done records a finished file of the given size
+func (p *progress) done(bytes int64) {
+	if p.bar == nil {
+		return
+	}
+	if p.mode == ProgressBytes {
+		p.bar.Add64(bytes)
+	} else {
+		p.bar.Add64(1)
+	}
+}
+
+// setETA shows the estimated time left beside the bar
+func (p *progress) setETA(eta time.Duration) {
+	if p.bar == nil || p.mode == ProgressSpinner {
+		return
+	}
+	if eta <= 0 {
+		p.bar.Describe("Converting")
+		return
+	}
+	p.bar.Describe(fmt.Sprintf("Converting (%s left)", eta.Round(time.Second)))
+}
+
+// finish completes the display once the run is over
+func (p *progress) finish() {
+	if p.bar != nil {
+		p.bar.Finish()
+	}
+}
@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"emil/internal/models"
+	"emil/internal/statsd"
+	"emil/internal/worker"
+)
+
+const (
+	// Bounds of the adaptive queue depth
+	queueMinDepth = 16
+	queueMaxDepth = 4096
+
+	// Files queued for each worker the pool can scale to, so a worker that
+	// finishes finds its next file waiting
+	queuePerWorker = 2
+
+	// Status updates buffered for each worker before workers block on the
+	// status monitor; a file sends several
+	statusPerWorker = 8
+	statusMinDepth  = 100
+
+	// How often the queue depth is sent to the metrics sink
+	queueMetricsInterval = 10 * time.Second
+)
+
+// statusQueueDepth returns the buffer of the status channel for the most
+// workers a run scales to
+func statusQueueDepth(workers int) int {
+	return max(workers*statusPerWorker, statusMinDepth)
+}
+
+// queueDepth returns how many tasks each lane queues ahead of the workers:
+// the -queue-depth if set, otherwise a few files for each worker the pool
+// can scale to. When the files are mostly small enough to batch, each
+// worker gets room for whole batches; when they are mostly large enough to
+// wait for memory headroom, for one file each, since queuing more only
+// holds them back.
+func (m *Manager) queueDepth(files []FileInfo) int {
+	if m.config.QueueDepth > 0 {
+		return m.config.QueueDepth
+	}
+
+	perWorker := queuePerWorker
+	if len(files) > 0 {
+		var total int64
+		for _, file := range files {
+			total += file.Size
+		}
+		average := total / int64(len(files))
+		switch {
+		case m.config.BatchSize > 1 && average <= worker.BatchMaxBytes(m.config):
+			perWorker *= m.config.BatchSize
+		case m.deps.Admission.Large(average):
+			perWorker = 1
+		}
+	}
+	workers := m.config.WorkerCount*2 + m.config.TextWorkers
+	return min(max(workers*perWorker, queueMinDepth), queueMaxDepth)
+}
+
+// makeQueues creates the task queues, sized for the files found
+func (m *Manager) makeQueues(files []FileInfo) {
+	depth := m.queueDepth(files)
+	m.taskChanLock.Lock()
+	m.taskChan = make(chan models.Task, depth)
+	if m.textLane() {
+		m.textChan = make(chan models.Task, depth)
+	}
+	m.taskChanLock.Unlock()
+
+	if m.config.Verbose {
+		lanes := ""
+		if m.textChan != nil {
+			lanes = " per lane"
+		}
+		fmt.Printf("Queue depth: %d tasks%s\n", depth, lanes)
+	}
+}
+
+// queueLength returns the tasks waiting for a worker across the lanes, and
+// how many the queues hold
+func (m *Manager) queueLength() (int, int) {
+	m.taskChanLock.RLock()
+	defer m.taskChanLock.RUnlock()
+	length, capacity := len(m.taskChan), cap(m.taskChan)
+	if m.textChan != nil {
+		length += len(m.textChan)
+		capacity += cap(m.textChan)
+	}
+	return length, capacity
+}
+
+// reportQueueDepth sends the queue depth of each lane to the metrics sink
+// until the run ends
+func (m *Manager) reportQueueDepth(ctx context.Context) {
+	if m.metrics == nil {
+		return
+	}
+	ticker := time.NewTicker(queueMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		m.taskChanLock.RLock()
+		lanes := map[string]chan models.Task{"main": m.taskChan, "text": m.textChan}
+		for lane, queue := range lanes {
+			if queue == nil {
+				continue
+			}
+			tag := statsd.Tag("lane", lane)
+			m.metrics.Gauge("queue.depth", float64(len(queue)), tag)
+			m.metrics.Gauge("queue.capacity", float64(cap(queue)), tag)
+		}
+		m.taskChanLock.RUnlock()
+	}
+}
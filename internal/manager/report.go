@@ -0,0 +1,232 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"emil/internal/converter"
+	"emil/internal/history"
+	"emil/internal/models"
+	"emil/internal/notify"
+	"emil/internal/signing"
+)
+
+// recordFile adds a finished task to the run report and dashboard, and
+// returns its entry for the audit log (nil = none). Callers hold statsLock
+// and pass the entry to recordAudit once they have released it, since the
+// audit queue may be full.
+func (m *Manager) recordFile(update models.StatusUpdate) *models.FileReport {
+	keep := m.config.ReportFile != "" || m.config.HTMLReportFile != "" || m.config.SecurityReport != "" || m.config.HistoryFile != "" ||
+		len(m.config.NotifyTo) > 0 || m.config.MergePerFolder || m.config.CheckDuplicates
+	if !keep && m.config.DashboardAddress == "" && m.config.AuditLogFile == "" {
+		return nil
+	}
+
+	m.tasksByIDLock.RLock()
+	task := m.tasksByID[update.TaskID]
+	m.tasksByIDLock.RUnlock()
+
+	stats := update.ProcessingStats
+	file := models.FileReport{
+		InputPath:          task.FilePath,
+		OutputPaths:        stats.OutputPaths,
+		Status:             string(update.Status),
+		DurationMS:         stats.Duration.Milliseconds(),
+		Retries:            stats.Retries,
+		FileSize:           task.FileSize,
+		SecurityAlerts:     stats.SecurityAlerts,
+		AlertAction:        stats.AlertAction,
+		SkippedAttachments: stats.SkippedAttachments,
+		PackagePath:        stats.PackagePath,
+		BodyPart:           stats.BodyPart,
+		Renderer:           stats.Renderer,
+		MessageID:          stats.MessageID,
+		Sender:             stats.Sender,
+		CPUMS:              stats.CPUTime.Milliseconds(),
+		PeakRSSDelta:       stats.PeakRSSDelta,
+		AttachmentBytes:    stats.AttachmentBytes,
+		Tagged:             stats.Tagged,
+		Truncated:          stats.Truncated,
+		EmptyBody:          stats.EmptyBody,
+		HeaderAnomalies:    stats.HeaderAnomalies,
+		JournalFormat:      stats.JournalFormat,
+		JournalDirection:   stats.JournalDirection,
+		JournalRecipients:  stats.JournalRecipients,
+		FinishedAt:         time.Now(),
+	}
+	if len(m.config.Sources) > 1 {
+		file.Source = m.config.SourceOf(task.FilePath).Label
+	}
+	if entry := m.config.Manifest.Lookup(task.FilePath); entry != nil {
+		file.Custodian = entry.Custodian
+		file.Priority = entry.Priority
+	}
+	if update.Error != nil {
+		file.Error = update.Error.Error()
+		file.ErrorClass = converter.ErrorClass(update.Error)
+		file.Stack = converter.PanicStack(update.Error)
+	}
+
+	if m.config.DashboardAddress != "" {
+		m.recordRecent(file)
+	}
+	if keep {
+		m.fileReports = append(m.fileReports, file)
+	}
+	return &file
+}
+
+// waitForStatusUpdates gives the status monitor time to handle updates still queued
+// after the workers finish, so the report covers every file
+func (m *Manager) waitForStatusUpdates() {
+	deadline := time.Now().Add(5 * time.Second)
+	for len(m.statusChan) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeReport writes the JSON run report
+func (m *Manager) writeReport() error {
+	m.statsLock.RLock()
+	stats := m.statsLocked()
+	report := models.Report{
+		StartTime:           stats.StartTime,
+		EndTime:             stats.EndTime,
+		Discovered:          stats.Discovered,
+		Successful:          stats.Successful,
+		Failed:              stats.Failed,
+		Truncated:           stats.Truncated,
+		Empty:               stats.EmptyBodies,
+		Anomalous:           stats.Anomalous,
+		Threads:             stats.Threads,
+		Deferred:            stats.Deferred,
+		Checkpointed:        stats.Checkpointed,
+		InvariantViolations: stats.InvariantViolations,
+		Migration:           stats.Migration,
+		Duplicates:          stats.Duplicates,
+		Files:               m.fileReports,
+		Sources:             m.sourceReports(),
+		Audit:               m.auditAnchor,
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	m.statsLock.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	if err := os.WriteFile(m.config.ReportFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// sourceReports sums up the files of each source directory, when the run
+// has several. Callers hold statsLock.
+func (m *Manager) sourceReports() []models.SourceReport {
+	if len(m.config.Sources) < 2 {
+		return nil
+	}
+	reports := make([]models.SourceReport, len(m.config.Sources))
+	index := make(map[string]int)
+	for i, source := range m.config.Sources {
+		reports[i] = models.SourceReport{Label: source.Label, Dir: source.Dir}
+		index[source.Label] = i
+	}
+	for _, file := range m.fileReports {
+		i, ok := index[file.Source]
+		if !ok {
+			continue
+		}
+		switch file.Status {
+		case string(models.StatusComplete):
+			reports[i].Successful++
+		case string(models.StatusFailed):
+			reports[i].Failed++
+		}
+	}
+	return reports
+}
+
+// sourceDescription names the run's source directories for summaries
+func (m *Manager) sourceDescription() string {
+	sources := m.config.SourceList()
+	if len(sources) == 1 {
+		return sources[0].Dir
+	}
+	dirs := make([]string, len(sources))
+	for i, source := range sources {
+		dirs[i] = source.Dir
+	}
+	return strings.Join(dirs, ", ")
+}
+
+// reportPaths returns the paths of the reports the run writes
+func (m *Manager) reportPaths() []string {
+	paths := []string{m.config.ReportFile, m.config.HTMLReportFile}
+	if m.config.SecurityReport != "" {
+		jsonPath, htmlPath := securityReportPaths(m.config.SecurityReport)
+		paths = append(paths, jsonPath, htmlPath)
+	}
+	return paths
+}
+
+// signReports writes a detached signature next to each report written
+func (m *Manager) signReports() error {
+	key, err := signing.LoadPrivateKey(m.config.SigningKeyFile)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range m.reportPaths() {
+		if path == "" {
+			continue
+		}
+		signature, err := signing.SignFile(key, path)
+		if err != nil {
+			return err
+		}
+		if m.config.Verbose {
+			fmt.Printf("Signature written to %s\n", signature)
+		}
+	}
+	return nil
+}
+
+// recordHistory appends the run's statistics and per-file outcomes to the run history
+func (m *Manager) recordHistory() error {
+	m.statsLock.RLock()
+	run := history.NewRun(m.statsLocked(), m.sourceDescription(), m.config.WorkerCount)
+	files := m.fileReports
+	m.statsLock.RUnlock()
+
+	return history.Append(m.config.HistoryFile, run, files)
+}
+
+// sendNotification emails the run summary with the written reports attached
+func (m *Manager) sendNotification() error {
+	summary := notify.Summary{SourceDir: m.sourceDescription()}
+	m.statsLock.RLock()
+	summary.Stats = m.statsLocked()
+	summary.Files = append([]models.FileReport(nil), m.fileReports...)
+	m.statsLock.RUnlock()
+
+	for _, path := range m.reportPaths() {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			summary.Attachments = append(summary.Attachments, path)
+		}
+	}
+
+	return notify.Send(notify.SMTP{
+		Address:  m.config.SMTPAddress,
+		From:     m.config.NotifyFrom,
+		To:       m.config.NotifyTo,
+		Username: m.config.SMTPUsername,
+		Password: m.config.SMTPPassword,
+	}, summary)
+}
@@ -0,0 +1,25 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+
+	"emil/internal/reputation"
+)
+
+// startReputation sets up the reputation providers links and relay names are
+// checked against, if any are configured and no checker was passed in
+func (m *Manager) startReputation() error {
+	if len(m.config.Reputation) == 0 || m.config.ReputationChecker != nil {
+		return nil
+	}
+	checker, err := reputation.New(m.config.Reputation, m.config.ReputationToken)
+	if err != nil {
+		return err
+	}
+	m.config.ReputationChecker = checker
+	if m.config.Verbose {
+		fmt.Printf("Checking links and relays against %s\n", strings.Join(m.config.Reputation, ", "))
+	}
+	return nil
+}
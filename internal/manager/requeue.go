@@ -0,0 +1,234 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"emil/internal/models"
+	"emil/internal/worker"
+)
+
+const (
+	// How often the owners of in-flight tasks are checked for heartbeats
+	heartbeatCheckInterval = 5 * time.Second
+
+	// How many times a task is requeued after losing its worker before it fails
+	maxRequeues = 2
+)
+
+// startWorker creates, registers and starts a worker with the next free ID
+func (m *Manager) startWorker(ctx context.Context) (*worker.Worker, error) {
+	m.ownersLock.Lock()
+	w, err := worker.NewWorker(m.nextWorkerID, m.taskChan, m.textChan, m.statusChan, m.intake, m.deps)
+	if err != nil {
+		m.ownersLock.Unlock()
+		return nil, err
+	}
+	m.liveWorkers[m.nextWorkerID] = w
+	m.nextWorkerID++
+	m.ownersLock.Unlock()
+
+	w.Start(ctx, m.resourceMgr.PauseControl())
+	return w, nil
+}
+
+// trackOwner records which worker holds each task. It returns false for
+// updates from an attempt that was abandoned when its task was requeued,
+// which must not be counted.
+func (m *Manager) trackOwner(update models.StatusUpdate) bool {
+	m.ownersLock.Lock()
+	defer m.ownersLock.Unlock()
+
+	m.tasksByIDLock.RLock()
+	task, exists := m.tasksByID[update.TaskID]
+	m.tasksByIDLock.RUnlock()
+	if exists && update.Requeues < task.Requeues {
+		if m.config.Verbose {
+			log.Printf("Ignoring %s update for %s from worker %d, which lost the task", update.Status, update.TaskID, update.WorkerID)
+		}
+		return false
+	}
+
+	switch update.Status {
+	case models.StatusProcessing:
+		m.owners[update.TaskID] = update.WorkerID
+	case models.StatusComplete, models.StatusFailed:
+		delete(m.owners, update.TaskID)
+	}
+	return true
+}
+
+// monitorHeartbeats requeues the tasks of workers that stop sending
+// heartbeats, so a worker that dies or is recycled mid-task doesn't lose it
+func (m *Manager) monitorHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(heartbeatCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			for workerID, tasks := range m.takeLostTasks() {
+				for _, task := range tasks {
+					m.requeueTask(ctx, task, workerID)
+				}
+			}
+		}
+	}
+}
+
+// takeLostTasks removes the tasks of workers that missed their heartbeats
+// from those workers, counting the loss as a retry, and returns them by the
+// worker that lost them
+func (m *Manager) takeLostTasks() map[int][]models.Task {
+	m.ownersLock.Lock()
+	defer m.ownersLock.Unlock()
+
+	lost := make(map[int][]models.Task)
+	for taskID, workerID := range m.owners {
+		// A worker that just exited may still have its final update queued, so
+		// only a missed heartbeat counts as losing the task
+		if w := m.liveWorkers[workerID]; w != nil && time.Since(w.LastHeartbeat()) <= worker.HeartbeatTimeout {
+			continue
+		}
+		delete(m.owners, taskID)
+
+		m.tasksByIDLock.Lock()
+		task, exists := m.tasksByID[taskID]
+		exists = exists && m.counts.transition(task.Status, models.StatusPending)
+		if exists {
+			task.Status = models.StatusPending
+			task.Retries++
+			task.Requeues++
+			m.tasksByID[taskID] = task
+		}
+		m.tasksByIDLock.Unlock()
+
+		m.stuckTaskLock.Lock()
+		delete(m.stuckTasks, taskID)
+		m.stuckTaskLock.Unlock()
+
+		if exists {
+			lost[workerID] = append(lost[workerID], task)
+		}
+	}
+	return lost
+}
+
+// requeueTask hands a lost task to another worker, or fails it once it has
+// been requeued too often
+func (m *Manager) requeueTask(ctx context.Context, task models.Task, workerID int) {
+	if task.Requeues > maxRequeues {
+		log.Printf("Warning: worker %d stopped responding while converting %s; giving up after %d requeues",
+			workerID, task.FilePath, maxRequeues)
+
+		now := time.Now()
+		update := models.StatusUpdate{
+			WorkerID: workerID,
+			TaskID:   task.ID,
+			Status:   models.StatusFailed,
+			Message:  "Worker stopped responding",
+			Error:    fmt.Errorf("worker stopped responding %d times", task.Requeues),
+			ProcessingStats: models.ProcessingStats{
+				StartTime: task.StartTime,
+				EndTime:   now,
+				Duration:  now.Sub(task.StartTime),
+				FileSize:  task.FileSize,
+				Retries:   task.Retries,
+				WorkerID:  workerID,
+			},
+			Requeues: task.Requeues,
+		}
+		// Reported through the status channel so updates stay in order
+		go func() {
+			select {
+			case m.statusChan <- update:
+			case <-ctx.Done():
+			}
+		}()
+		return
+	}
+
+	log.Printf("Warning: worker %d stopped responding; requeuing %s (retry %d)",
+		workerID, task.FilePath, task.Retries)
+	m.counts.requeued.Add(1)
+
+	m.ensureWorker(ctx)
+	go func() {
+		m.taskChanLock.RLock()
+		defer m.taskChanLock.RUnlock()
+		if m.tasksClosed {
+			return
+		}
+		select {
+		case m.queueFor(task) <- task:
+		case <-m.expired:
+			m.deferTask(task)
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// ensureWorker starts a worker if none outside the text lane is still
+// sending heartbeats, so a requeued task of either lane is picked up even
+// after the other workers have exited
+func (m *Manager) ensureWorker(ctx context.Context) {
+	m.ownersLock.Lock()
+	for id, w := range m.liveWorkers {
+		if !m.textWorkerIDs[id] && workerAlive(w) {
+			m.ownersLock.Unlock()
+			return
+		}
+	}
+	m.ownersLock.Unlock()
+
+	w, err := m.startWorker(ctx)
+	if err != nil {
+		log.Printf("Failed to start a worker to take over requeued tasks: %v", err)
+		return
+	}
+	if m.config.Verbose {
+		log.Printf("Started worker %d to take over requeued tasks", w.ID())
+	}
+}
+
+// workerAlive reports whether a worker is running and sending heartbeats
+func workerAlive(w *worker.Worker) bool {
+	select {
+	case <-w.Done():
+		return false
+	default:
+	}
+	return time.Since(w.LastHeartbeat()) <= worker.HeartbeatTimeout
+}
+
+// waitForTasks blocks until every enqueued task has completed or failed, or
+// the run is cancelled. Tasks may be requeued until then, so the task
+// channel stays open.
+func (m *Manager) waitForTasks(ctx context.Context) {
+	finished := make(chan struct{})
+	go func() {
+		m.outstanding.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+	}
+}
+
+// closeTasks closes the task channel, telling idle workers to exit
+func (m *Manager) closeTasks() {
+	m.taskChanLock.Lock()
+	defer m.taskChanLock.Unlock()
+	m.tasksClosed = true
+	close(m.taskChan)
+	if m.textChan != nil {
+		close(m.textChan)
+	}
+}
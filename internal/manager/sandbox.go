@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"fmt"
+
+	"emil/internal/models"
+	"emil/internal/sandbox"
+)
+
+// startSandbox connects the sandbox attachments are detonated in, if one is
+// configured and no client was passed in
+func (m *Manager) startSandbox() error {
+	if m.config.SandboxURL == "" || m.config.SandboxClient != nil {
+		return nil
+	}
+	client, err := sandbox.New(sandbox.Options{
+		URL:    m.config.SandboxURL,
+		API:    m.config.SandboxAPI,
+		Submit: m.config.SandboxSubmit,
+		Token:  m.config.SandboxToken,
+		Types:  m.config.SandboxTypes,
+	})
+	if err != nil {
+		return err
+	}
+	m.config.SandboxClient = client
+	if m.config.Verbose {
+		fmt.Printf("Submitting attachments to the sandbox at %s\n", m.config.SandboxURL)
+	}
+	return nil
+}
+
+// collectVerdicts waits up to -sandbox-wait for the sandbox's outstanding
+// verdicts and merges them into the file reports. A malicious verdict raises
+// a critical alert and a suspicious one a warning; the outputs were written
+// long before, so the alert policy can't act on them. Attachments of
+// conversions still running are no longer submitted once it returns.
+func (m *Manager) collectVerdicts() {
+	client := m.config.SandboxClient
+	if client == nil {
+		return
+	}
+	if pending := client.Pending(); pending > 0 && m.config.SandboxWait > 0 {
+		fmt.Printf("Waiting up to %s for the sandbox's verdicts on %d attachments\n", m.config.SandboxWait, pending)
+	}
+	verdicts := client.Finish(m.config.SandboxWait)
+
+	m.statsLock.Lock()
+	defer m.statsLock.Unlock()
+	counted := make(map[string]bool)
+	for _, list := range verdicts {
+		for _, verdict := range list {
+			if alert, ok := sandboxAlert(verdict); ok {
+				m.stats.SecurityAlerts++
+				m.stats.AlertCounts.Add(alert)
+			}
+			if counted[verdict.SHA256] {
+				continue
+			}
+			counted[verdict.SHA256] = true
+			summary := &m.stats.Sandbox
+			summary.Submitted++
+			switch verdict.Verdict {
+			case sandbox.VerdictMalicious:
+				summary.Malicious++
+			case sandbox.VerdictSuspicious:
+				summary.Suspicious++
+			case sandbox.VerdictClean:
+				summary.Clean++
+			case sandbox.VerdictPending:
+				summary.Pending++
+			default:
+				summary.Failed++
+			}
+		}
+	}
+
+	for i := range m.fileReports {
+		file := &m.fileReports[i]
+		file.Sandbox = verdicts[file.InputPath]
+		for _, verdict := range file.Sandbox {
+			if alert, ok := sandboxAlert(verdict); ok {
+				file.SecurityAlerts = append(file.SecurityAlerts, alert)
+			}
+		}
+	}
+}
+
+// sandboxAlert returns the alert a sandbox verdict raises, if any
+func sandboxAlert(verdict models.SandboxVerdict) (models.SecurityAlert, bool) {
+	var severity string
+	switch verdict.Verdict {
+	case sandbox.VerdictMalicious:
+		severity = models.SeverityCritical
+	case sandbox.VerdictSuspicious:
+		severity = models.SeverityWarning
+	default:
+		return models.SecurityAlert{}, false
+	}
+	return models.SecurityAlert{
+		Severity:   severity,
+		Message:    fmt.Sprintf("Sandbox found %s %s (score %.1f)", verdict.Attachment, verdict.Verdict, verdict.Score),
+		Attachment: verdict.Attachment,
+		SHA256:     verdict.SHA256,
+	}, true
+}
@@ -0,0 +1,242 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"emil/internal/models"
+)
+
+// securityReportPaths returns where the JSON and HTML versions of the
+// security report go: the path given, and the same name with an .html
+// extension beside it
+func securityReportPaths(path string) (string, string) {
+	ext := filepath.Ext(path)
+	if strings.EqualFold(ext, ".html") || strings.EqualFold(ext, ".htm") {
+		return strings.TrimSuffix(path, ext) + ".json", path
+	}
+	return path, strings.TrimSuffix(path, ext) + ".html"
+}
+
+// senderDomain returns the domain of a sender address, lower-cased
+func senderDomain(sender string) string {
+	if at := strings.LastIndex(sender, "@"); at >= 0 {
+		return strings.ToLower(sender[at+1:])
+	}
+	return ""
+}
+
+// addOnce appends value to list unless it is empty or already there
+func addOnce(list []string, value string) []string {
+	if value == "" || slices.Contains(list, value) {
+		return list
+	}
+	return append(list, value)
+}
+
+// securityReport indexes the security alerts of the files recorded so far.
+// Callers hold statsLock.
+func (m *Manager) securityReport() models.SecurityReport {
+	stats := m.statsLocked()
+	report := models.SecurityReport{
+		StartTime: stats.StartTime,
+		EndTime:   stats.EndTime,
+		Scanned:   m.config.ScanAttachments,
+		Threats:   []models.ThreatEntry{},
+		Hashes:    []models.HashEntry{},
+		Domains:   []models.DomainEntry{},
+		Findings:  []models.SecurityFinding{},
+	}
+
+	threats := make(map[string]*models.ThreatEntry)
+	hashes := make(map[string]*models.HashEntry)
+	domains := make(map[string]*models.DomainEntry)
+	for _, file := range m.fileReports {
+		if len(file.SecurityAlerts) == 0 {
+			continue
+		}
+		report.Files++
+
+		domain := senderDomain(file.Sender)
+		var byDomain *models.DomainEntry
+		if domain != "" {
+			byDomain = domains[domain]
+			if byDomain == nil {
+				byDomain = &models.DomainEntry{Domain: domain}
+				domains[domain] = byDomain
+			}
+			byDomain.Files++
+		}
+
+		for _, alert := range file.SecurityAlerts {
+			report.Counts.Add(alert)
+			report.Findings = append(report.Findings, models.SecurityFinding{
+				InputPath:     file.InputPath,
+				OutputPaths:   file.OutputPaths,
+				MessageID:     file.MessageID,
+				Sender:        file.Sender,
+				SenderDomain:  domain,
+				Custodian:     file.Custodian,
+				Action:        file.AlertAction,
+				SecurityAlert: alert,
+			})
+
+			if byDomain != nil {
+				byDomain.Findings++
+				byDomain.Threats = addOnce(byDomain.Threats, alert.Threat)
+			}
+			if alert.Threat != "" {
+				threat := threats[alert.Threat]
+				if threat == nil {
+					threat = &models.ThreatEntry{Name: alert.Threat}
+					threats[alert.Threat] = threat
+				}
+				threat.Findings++
+				threat.Files = addOnce(threat.Files, file.InputPath)
+				threat.Hashes = addOnce(threat.Hashes, alert.SHA256)
+				threat.Domains = addOnce(threat.Domains, domain)
+			}
+			if alert.SHA256 != "" {
+				hash := hashes[alert.SHA256]
+				if hash == nil {
+					hash = &models.HashEntry{SHA256: alert.SHA256}
+					hashes[alert.SHA256] = hash
+				}
+				hash.Threats = addOnce(hash.Threats, alert.Threat)
+				hash.Attachments = addOnce(hash.Attachments, alert.Attachment)
+				hash.Files = addOnce(hash.Files, file.InputPath)
+			}
+		}
+	}
+
+	// Most widespread first
+	for _, threat := range threats {
+		report.Threats = append(report.Threats, *threat)
+	}
+	sort.Slice(report.Threats, func(i, j int) bool {
+		a, b := report.Threats[i], report.Threats[j]
+		return len(a.Files) > len(b.Files) || (len(a.Files) == len(b.Files) && a.Name < b.Name)
+	})
+	for _, hash := range hashes {
+		report.Hashes = append(report.Hashes, *hash)
+	}
+	sort.Slice(report.Hashes, func(i, j int) bool {
+		a, b := report.Hashes[i], report.Hashes[j]
+		return len(a.Files) > len(b.Files) || (len(a.Files) == len(b.Files) && a.SHA256 < b.SHA256)
+	})
+	for _, domain := range domains {
+		report.Domains = append(report.Domains, *domain)
+	}
+	sort.Slice(report.Domains, func(i, j int) bool {
+		a, b := report.Domains[i], report.Domains[j]
+		return a.Findings > b.Findings || (a.Findings == b.Findings && a.Domain < b.Domain)
+	})
+	return report
+}
+
+// writeSecurityReport writes the security report as JSON and HTML
+func (m *Manager) writeSecurityReport() error {
+	m.statsLock.RLock()
+	report := m.securityReport()
+	m.statsLock.RUnlock()
+
+	jsonPath, htmlPath := securityReportPaths(m.config.SecurityReport)
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode security report: %w", err)
+	}
+	if err := os.WriteFile(jsonPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write security report: %w", err)
+	}
+
+	file, err := os.Create(htmlPath)
+	if err != nil {
+		return fmt.Errorf("failed to write security report: %w", err)
+	}
+	defer file.Close()
+
+	if err := securityReportTemplate.Execute(file, report); err != nil {
+		return fmt.Errorf("failed to write security report: %w", err)
+	}
+	return nil
+}
+
+var securityReportTemplate = template.Must(template.New("security").Funcs(htmlReportFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<title>Emil security report</title>
+<style>
+body { font-family: Arial, sans-serif; margin: 30px; color: #222; }
+h1 { margin-bottom: 0; }
+.period { color: #666; margin-top: 4px; }
+.cards { display: flex; flex-wrap: wrap; gap: 12px; margin: 20px 0; }
+.card { border: 1px solid #ddd; border-radius: 4px; padding: 10px 16px; min-width: 120px; }
+.card .value { font-size: 22px; font-weight: bold; }
+.card .label { color: #666; font-size: 12px; }
+.card.bad .value { color: #b00; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 30px; font-size: 13px; }
+th, td { border: 1px solid #ddd; padding: 5px 8px; text-align: left; vertical-align: top; }
+th { background: #f3f3f3; }
+td.num { text-align: right; white-space: nowrap; }
+td.path, td.hash { word-break: break-all; }
+td.hash { font-family: monospace; }
+tr.critical td:first-child { border-left: 4px solid #b00; }
+tr.warning td:first-child { border-left: 4px solid #d90; }
+.note { color: #666; font-size: 12px; margin-bottom: 30px; }
+</style>
+</head>
+<body>
+<h1>Emil security report</h1>
+<div class="period">{{when .StartTime}} to {{when .EndTime}}</div>
+
+<div class="cards">
+<div class="card{{if .Files}} bad{{end}}"><div class="value">{{.Files}}</div><div class="label">files with findings</div></div>
+<div class="card{{if .Counts.Critical}} bad{{end}}"><div class="value">{{.Counts.Critical}}</div><div class="label">critical</div></div>
+<div class="card"><div class="value">{{.Counts.Warning}}</div><div class="label">warning</div></div>
+<div class="card"><div class="value">{{.Counts.Info}}</div><div class="label">info</div></div>
+<div class="card"><div class="value">{{len .Threats}}</div><div class="label">distinct threats</div></div>
+<div class="card"><div class="value">{{len .Hashes}}</div><div class="label">distinct infected attachments</div></div>
+</div>
+{{if not .Scanned}}<p class="note">Attachments were not scanned for malware (-scan was off).</p>{{end}}
+
+<h2>Threats ({{len .Threats}})</h2>
+{{if .Threats}}
+<table>
+<tr><th>Threat</th><th>Findings</th><th>Files</th><th>SHA-256</th><th>Sender domains</th></tr>
+{{range .Threats}}<tr><td>{{.Name}}</td><td class="num">{{.Findings}}</td><td class="num">{{len .Files}}</td><td class="hash">{{range .Hashes}}{{.}}<br>{{end}}</td><td>{{range .Domains}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+{{else}}<p>None.</p>{{end}}
+
+{{if .Hashes}}
+<h2>Infected attachments ({{len .Hashes}})</h2>
+<table>
+<tr><th>SHA-256</th><th>Threats</th><th>Attached as</th><th>Files</th></tr>
+{{range .Hashes}}<tr><td class="hash">{{.SHA256}}</td><td>{{range .Threats}}{{.}}<br>{{end}}</td><td>{{range .Attachments}}{{.}}<br>{{end}}</td><td class="path">{{range .Files}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+
+{{if .Domains}}
+<h2>Sender domains ({{len .Domains}})</h2>
+<table>
+<tr><th>Domain</th><th>Files</th><th>Findings</th><th>Threats</th></tr>
+{{range .Domains}}<tr><td>{{.Domain}}</td><td class="num">{{.Files}}</td><td class="num">{{.Findings}}</td><td>{{range .Threats}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Findings ({{len .Findings}})</h2>
+{{if .Findings}}
+<table>
+<tr><th>Severity</th><th>File</th><th>Sender</th><th>Message-ID</th><th>Finding</th><th>Action</th></tr>
+{{range .Findings}}<tr class="{{.Severity}}"><td>{{.Severity}}</td><td class="path">{{.InputPath}}</td><td>{{.Sender}}</td><td>{{.MessageID}}</td><td>{{.Message}}</td><td>{{.Action}}</td></tr>
+{{end}}</table>
+{{else}}<p>None.</p>{{end}}
+</body>
+</html>
+`))
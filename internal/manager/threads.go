@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"log"
+
+	"emil/internal/converter"
+	"emil/internal/models"
+	"emil/internal/threading"
+)
+
+// threadMember is a converted file waiting to be placed in its thread
+type threadMember struct {
+	key     models.ThreadKey
+	sidecar string // Sidecar to record the thread in (empty = none)
+}
+
+// threadsWanted reports whether the run records threads, which only the JSON
+// report and the sidecars show
+func (m *Manager) threadsWanted() bool {
+	return m.config.ReportFile != "" || m.config.WriteSidecar
+}
+
+// recordThread notes what a converted file's thread is worked out from.
+// Callers hold statsLock.
+func (m *Manager) recordThread(update models.StatusUpdate) {
+	if !m.threadsWanted() {
+		return
+	}
+	if m.threadMembers == nil {
+		m.threadMembers = make(map[string]threadMember)
+	}
+	stats := update.ProcessingStats
+	m.threadMembers[update.FilePath] = threadMember{key: stats.Thread, sidecar: stats.SidecarPath}
+}
+
+// assignThreads groups the run's converted files into conversations and
+// records each file's thread in the report and its sidecar
+func (m *Manager) assignThreads() {
+	m.statsLock.Lock()
+	keys := make(map[string]models.ThreadKey, len(m.threadMembers))
+	for path, member := range m.threadMembers {
+		keys[path] = member.key
+	}
+	threads := threading.Assign(keys)
+
+	ids := make(map[string]bool)
+	for _, thread := range threads {
+		ids[thread.ID] = true
+	}
+	m.stats.Threads = len(ids)
+	for i := range m.fileReports {
+		if thread, ok := threads[m.fileReports[i].InputPath]; ok && m.fileReports[i].Status == string(models.StatusComplete) {
+			m.fileReports[i].Thread = &thread
+		}
+	}
+	members := m.threadMembers
+	m.statsLock.Unlock()
+
+	for path, member := range members {
+		if member.sidecar == "" {
+			continue
+		}
+		if err := converter.AddSidecarThread(member.sidecar, threads[path]); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
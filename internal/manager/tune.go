@@ -0,0 +1,52 @@
+package manager
+
+import (
+	"fmt"
+
+	"emil/internal/dashboard"
+)
+
+// Tuning returns the settings that can be changed while the run is in progress
+func (m *Manager) Tuning() dashboard.Tuning {
+	workers := m.resourceMgr.MaxWorkers()
+	maxMemoryPct := int(m.resourceMgr.TargetMemory())
+	maxRenders := m.config.RenderSlots.Limit()
+	return dashboard.Tuning{
+		Workers:      &workers,
+		MaxMemoryPct: &maxMemoryPct,
+		MaxRenders:   &maxRenders,
+	}
+}
+
+// Tune changes the worker count, memory target and render concurrency of a
+// run in progress, keeping its queue. Settings left nil are not changed.
+func (m *Manager) Tune(tuning dashboard.Tuning) error {
+	// The open file budget and the worker control channel are sized for the
+	// run's initial maximum, so the pool can't be tuned past it
+	if limit := m.resourceMgr.WorkerLimit(); tuning.Workers != nil && (*tuning.Workers < 1 || *tuning.Workers > limit) {
+		return fmt.Errorf("workers must be between 1 and %d", limit)
+	}
+	if tuning.MaxMemoryPct != nil && (*tuning.MaxMemoryPct < 1 || *tuning.MaxMemoryPct > 100) {
+		return fmt.Errorf("max_mem must be between 1 and 100")
+	}
+	if tuning.MaxRenders != nil && *tuning.MaxRenders < 0 {
+		return fmt.Errorf("max_renders must not be negative")
+	}
+
+	if tuning.Workers != nil {
+		m.statsLock.RLock()
+		current := m.stats.CurrentWorkers
+		m.statsLock.RUnlock()
+		m.resourceMgr.SetMaxWorkers(*tuning.Workers, current)
+		fmt.Printf("\nWorkers set to %d\n", *tuning.Workers)
+	}
+	if tuning.MaxMemoryPct != nil {
+		m.resourceMgr.SetTargetMemory(float64(*tuning.MaxMemoryPct))
+		fmt.Printf("\nMemory target set to %d%%\n", *tuning.MaxMemoryPct)
+	}
+	if tuning.MaxRenders != nil {
+		m.config.RenderSlots.SetLimit(*tuning.MaxRenders)
+		fmt.Printf("\nConcurrent renders set to %d\n", *tuning.MaxRenders)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package manifest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"emil/internal/routing"
+)
+
+// Entry is what an upstream collection tool recorded about one source file
+type Entry struct {
+	Path      string `json:"path"`                 // Source file, absolute or relative to the source directory
+	Priority  int    `json:"priority,omitempty"`   // Files with higher priorities are converted first (default 0)
+	Custodian string `json:"custodian,omitempty"`  // Person the file was collected from, for file names and reports
+	OutputDir string `json:"output_dir,omitempty"` // Root of the file's output tree (empty = the usual placement)
+	Filename  string `json:"filename,omitempty"`   // Naming template for a file with an output_dir, e.g. "{custodian}_{name}"
+}
+
+// Manifest maps source files to their entries
+type Manifest struct {
+	entries map[string]*Entry
+}
+
+// Load reads a manifest, as a JSON array of entries if the file name ends in
+// .json and as CSV with a header row otherwise. Relative paths in it are
+// resolved against the source directory.
+func Load(path, sourceDir string) (*Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	defer file.Close()
+
+	var entries []*Entry
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.NewDecoder(file).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+		}
+	} else if entries, err = readCSV(file); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("manifest %s lists no files", path)
+	}
+
+	m := &Manifest{entries: make(map[string]*Entry, len(entries))}
+	for i, entry := range entries {
+		if entry.Path == "" {
+			return nil, fmt.Errorf("manifest %s: entry %d has no path", path, i+1)
+		}
+		if entry.Filename != "" {
+			if entry.OutputDir == "" {
+				return nil, fmt.Errorf("manifest %s: %s: filename requires output_dir", path, entry.Path)
+			}
+			if err := routing.CheckFilename(entry.Filename); err != nil {
+				return nil, fmt.Errorf("manifest %s: %s: %w", path, entry.Path, err)
+			}
+		}
+		if !filepath.IsAbs(entry.Path) {
+			entry.Path = filepath.Join(sourceDir, entry.Path)
+		}
+		key, err := lookupKey(entry.Path)
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s: %w", path, err)
+		}
+		if _, dup := m.entries[key]; dup {
+			return nil, fmt.Errorf("manifest %s: %s is listed twice", path, entry.Path)
+		}
+		m.entries[key] = entry
+	}
+	return m, nil
+}
+
+// readCSV reads manifest entries from CSV. The header row names the columns:
+// path is required, priority, custodian, output_dir and filename are
+// optional, and other columns are ignored so exports can be used as they are.
+func readCSV(r io.Reader) ([]*Entry, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns["path"]; !ok {
+		return nil, fmt.Errorf("no path column in the header row")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []*Entry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		entry := &Entry{
+			Path:      field(record, "path"),
+			Custodian: field(record, "custodian"),
+			OutputDir: field(record, "output_dir"),
+			Filename:  field(record, "filename"),
+		}
+		if value := field(record, "priority"); value != "" {
+			if entry.Priority, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("line %d: invalid priority %q", line, value)
+			}
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// Lookup returns the entry for a source file, or nil if the manifest doesn't
+// list it
+func (m *Manifest) Lookup(path string) *Entry {
+	if m == nil {
+		return nil
+	}
+	key, err := lookupKey(path)
+	if err != nil {
+		return nil
+	}
+	return m.entries[key]
+}
+
+// Len returns the number of files listed
+func (m *Manifest) Len() int {
+	return len(m.entries)
+}
+
+// OutputDirs returns the distinct output directories the entries name
+func (m *Manifest) OutputDirs() []string {
+	if m == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, entry := range m.entries {
+		if entry.OutputDir != "" && !seen[entry.OutputDir] {
+			seen[entry.OutputDir] = true
+			dirs = append(dirs, entry.OutputDir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// lookupKey returns the form of a path entries are stored under
+func lookupKey(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	return abs, nil
+}
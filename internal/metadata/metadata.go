@@ -0,0 +1,243 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// Output formats for WriteAll
+const (
+	FormatJSON = "json" // One JSON object per line
+	FormatCSV  = "csv"  // One row per message, lists joined with "; "
+)
+
+// Message holds the searchable metadata of one EML file
+type Message struct {
+	Path        string       `json:"path"`
+	Size        int64        `json:"size"`
+	MessageID   string       `json:"message_id,omitempty"`
+	InReplyTo   string       `json:"in_reply_to,omitempty"`
+	Subject     string       `json:"subject,omitempty"`
+	Date        string       `json:"date,omitempty"` // RFC 3339, empty if missing or unparsable
+	From        []string     `json:"from,omitempty"`
+	To          []string     `json:"to,omitempty"`
+	Cc          []string     `json:"cc,omitempty"`
+	Bcc         []string     `json:"bcc,omitempty"`
+	ReplyTo     []string     `json:"reply_to,omitempty"`
+	HasHTML     bool         `json:"has_html"`
+	HasText     bool         `json:"has_text"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Error       string       `json:"error,omitempty"` // Why the file could not be parsed
+}
+
+// Attachment describes an attached or inline file
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	SHA256      string `json:"sha256"`
+	Inline      bool   `json:"inline,omitempty"`
+}
+
+// CheckFormat validates an output format
+func CheckFormat(format string) error {
+	switch format {
+	case FormatJSON, FormatCSV:
+		return nil
+	}
+	return fmt.Errorf("unsupported index format %q (available: %s, %s)", format, FormatJSON, FormatCSV)
+}
+
+// FindEMLFiles returns the EML files in a directory, descending into
+// subdirectories if recursive is set
+func FindEMLFiles(dir string, recursive bool) ([]string, error) {
+	var files []string
+
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Skip directories if not recursive
+		if info.IsDir() && !recursive && path != dir {
+			return filepath.SkipDir
+		}
+
+		if !info.IsDir() && strings.ToLower(filepath.Ext(path)) == ".eml" {
+			files = append(files, path)
+		}
+		return nil
+	}
+
+	if err := filepath.Walk(dir, walkFn); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Extract parses an EML file and returns its metadata without rendering it
+func Extract(path string) (*Message, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open eml file: %w", err)
+	}
+	defer file.Close()
+
+	msg := &Message{Path: path}
+	if info, err := file.Stat(); err == nil {
+		msg.Size = info.Size()
+	}
+
+	envelope, err := enmime.ReadEnvelope(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse eml content: %w", err)
+	}
+
+	return FromEnvelope(msg, envelope), nil
+}
+
+// FromEnvelope fills in the metadata of an already parsed message
+func FromEnvelope(msg *Message, envelope *enmime.Envelope) *Message {
+	msg.MessageID = envelope.GetHeader("Message-ID")
+	msg.InReplyTo = envelope.GetHeader("In-Reply-To")
+	msg.Subject = envelope.GetHeader("Subject")
+	if date, err := envelope.Date(); err == nil {
+		msg.Date = date.Format(time.RFC3339)
+	}
+
+	msg.From = addresses(envelope, "From")
+	msg.To = addresses(envelope, "To")
+	msg.Cc = addresses(envelope, "Cc")
+	msg.Bcc = addresses(envelope, "Bcc")
+	msg.ReplyTo = addresses(envelope, "Reply-To")
+	msg.HasHTML = envelope.HTML != ""
+	msg.HasText = strings.TrimSpace(envelope.Text) != ""
+
+	for _, part := range envelope.Attachments {
+		msg.Attachments = append(msg.Attachments, describeAttachment(part, false))
+	}
+	for _, part := range envelope.Inlines {
+		msg.Attachments = append(msg.Attachments, describeAttachment(part, true))
+	}
+
+	return msg
+}
+
+// addresses returns the addresses in a header as "Name <address>", falling
+// back to the raw header when it can't be parsed
+func addresses(envelope *enmime.Envelope, header string) []string {
+	list, err := envelope.AddressList(header)
+	if err != nil {
+		if raw := envelope.GetHeader(header); raw != "" {
+			return []string{raw}
+		}
+		return nil
+	}
+
+	var result []string
+	for _, addr := range list {
+		if addr.Name != "" {
+			result = append(result, addr.Name+" <"+addr.Address+">")
+		} else {
+			result = append(result, addr.Address)
+		}
+	}
+	return result
+}
+
+// describeAttachment records the name, type, size and hash of a part
+func describeAttachment(part *enmime.Part, inline bool) Attachment {
+	sum := sha256.Sum256(part.Content)
+	return Attachment{
+		Filename:    part.FileName,
+		ContentType: part.ContentType,
+		Size:        len(part.Content),
+		SHA256:      hex.EncodeToString(sum[:]),
+		Inline:      inline,
+	}
+}
+
+// Writer writes messages in one of the index formats
+type Writer struct {
+	format  string
+	json    *json.Encoder
+	csv     *csv.Writer
+	started bool
+}
+
+// NewWriter creates a writer for the format
+func NewWriter(w io.Writer, format string) *Writer {
+	writer := &Writer{format: format}
+	if format == FormatCSV {
+		writer.csv = csv.NewWriter(w)
+	} else {
+		writer.json = json.NewEncoder(w)
+	}
+	return writer
+}
+
+// csvHeader names the CSV columns
+var csvHeader = []string{
+	"path", "size", "message_id", "in_reply_to", "subject", "date",
+	"from", "to", "cc", "bcc", "reply_to", "has_html", "has_text",
+	"attachments", "attachment_sha256", "error",
+}
+
+// Write adds a message to the index
+func (w *Writer) Write(msg *Message) error {
+	if w.format != FormatCSV {
+		return w.json.Encode(msg)
+	}
+
+	if !w.started {
+		w.started = true
+		if err := w.csv.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+
+	var names, hashes []string
+	for _, att := range msg.Attachments {
+		names = append(names, att.Filename)
+		hashes = append(hashes, att.SHA256)
+	}
+
+	return w.csv.Write([]string{
+		msg.Path,
+		strconv.FormatInt(msg.Size, 10),
+		msg.MessageID,
+		msg.InReplyTo,
+		msg.Subject,
+		msg.Date,
+		strings.Join(msg.From, "; "),
+		strings.Join(msg.To, "; "),
+		strings.Join(msg.Cc, "; "),
+		strings.Join(msg.Bcc, "; "),
+		strings.Join(msg.ReplyTo, "; "),
+		strconv.FormatBool(msg.HasHTML),
+		strconv.FormatBool(msg.HasText),
+		strings.Join(names, "; "),
+		strings.Join(hashes, "; "),
+		msg.Error,
+	})
+}
+
+// Flush writes any buffered output
+func (w *Writer) Flush() error {
+	if w.csv == nil {
+		return nil
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
@@ -0,0 +1,87 @@
+package migration
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"emil/internal/models"
+)
+
+// Checklist is the set of Message-IDs a mailbox migration is expected to
+// deliver, as exported from the source system
+type Checklist struct {
+	ids map[string]bool
+}
+
+// Load reads expected Message-IDs, one per line. Angle brackets are optional,
+// and blank lines and lines starting with # are skipped.
+func Load(path string) (*Checklist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expected Message-IDs: %w", err)
+	}
+	defer file.Close()
+
+	c := &Checklist{ids: make(map[string]bool)}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		c.ids[NormalizeID(line)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read expected Message-IDs from %s: %w", path, err)
+	}
+	if len(c.ids) == 0 {
+		return nil, fmt.Errorf("%s lists no Message-IDs", path)
+	}
+	return c, nil
+}
+
+// NormalizeID returns the form Message-IDs are compared in: without
+// surrounding whitespace or angle brackets
+func NormalizeID(id string) string {
+	id = strings.TrimSpace(id)
+	id = strings.TrimPrefix(id, "<")
+	id = strings.TrimSuffix(id, ">")
+	return strings.TrimSpace(id)
+}
+
+// Len returns the number of expected Message-IDs
+func (c *Checklist) Len() int {
+	return len(c.ids)
+}
+
+// Check compares the converted messages, given as the files each normalized
+// Message-ID was converted from, with the expected ones
+func (c *Checklist) Check(converted map[string][]string, withoutID []string) *models.MigrationCheck {
+	check := &models.MigrationCheck{Expected: len(c.ids)}
+	for id := range c.ids {
+		if len(converted[id]) == 0 {
+			check.Missing = append(check.Missing, id)
+		} else {
+			check.Converted++
+		}
+	}
+	for id, paths := range converted {
+		if !c.ids[id] {
+			check.Extra = append(check.Extra, id)
+		}
+		if len(paths) > 1 {
+			check.Duplicates = append(check.Duplicates, id)
+		}
+	}
+	check.WithoutID = append([]string(nil), withoutID...)
+
+	sort.Strings(check.Missing)
+	sort.Strings(check.Extra)
+	sort.Strings(check.Duplicates)
+	sort.Strings(check.WithoutID)
+	return check
+}
@@ -10,6 +10,7 @@ const (
 	StatusProcessing TaskStatus = "processing"
 	StatusComplete   TaskStatus = "complete"
 	StatusFailed     TaskStatus = "failed"
+	StatusDeferred   TaskStatus = "deferred" // Left for the next run when the run's budget was spent
 )
 
 // Task represents a conversion task from EML to PDF
@@ -19,20 +20,25 @@ type Task struct {
 	Status       TaskStatus
 	Error        error
 	FileSize     int64
+	ModTime      time.Time // Modification time of the source file when it was discovered
+	TextOnly     bool      // Classified at discovery as having no HTML part, so it's queued in the text lane
 	StartTime    time.Time
 	CompleteTime time.Time
 	Retries      int
+	Requeues     int // Times the task was requeued after its worker stopped sending heartbeats
 }
 
 // StatusUpdate represents a message from a worker about task status
 type StatusUpdate struct {
 	WorkerID        int
 	TaskID          string
+	FilePath        string // Filled in by the manager before updates are passed on
 	Status          TaskStatus
 	Progress        float64
 	Message         string
 	Error           error
 	ProcessingStats ProcessingStats
+	Requeues        int // The task's requeue count when the worker took it, so updates from abandoned attempts can be ignored
 }
 
 // ResourceStats tracks system resource usage
@@ -50,6 +56,31 @@ type ProcessingStats struct {
 	Duration  time.Duration
 	WorkerID  int
 	Retries   int
+
+	// What the conversion cost, summed over its attempts
+	CPUTime         time.Duration // CPU time of the worker's thread; Chrome's rendering isn't counted
+	PeakRSSDelta    int64         // Bytes by which the process's peak resident set size grew
+	AttachmentBytes int64         // Bytes of attachments saved
+
+	// Conversion details recorded for the run report
+	OutputPaths        []string
+	SecurityAlerts     []SecurityAlert
+	AlertAction        string // Strongest action the alerts' severities called for (empty = none)
+	SkippedAttachments []string
+	PackagePath        string
+	SidecarPath        string
+	BodyPart           string
+	Renderer           string
+	MessageID          string
+	Sender             string
+	Tagged             bool
+	Truncated          bool
+	EmptyBody          bool
+	HeaderAnomalies    []string
+	JournalFormat      string
+	JournalDirection   string
+	JournalRecipients  []string
+	Thread             ThreadKey
 }
 
 // Stats tracks overall job statistics
@@ -59,6 +90,15 @@ type Stats struct {
 	Processed      int
 	Successful     int
 	Failed         int
+	Requeued       int // Tasks handed to another worker after theirs stopped sending heartbeats
+	FDExhausted    int // Files that failed because the process ran out of file descriptors
+	Deferred       int // Files left for the next run when the run's budget was spent
+	Checkpointed   int // Files skipped because the -checkpoint shows an earlier run converted them
+	SecurityAlerts int // Alerts raised across all files, converted or withheld
+	Truncated      int // Converted files whose body was cut off at the page limit
+	EmptyBodies    int // Converted files with no body, rendered with a notice in its place
+	Anomalous      int // Converted files with header anomalies
+	Threads        int // Conversations the converted files form
 	StartTime      time.Time
 	EndTime        time.Time
 	TotalFileSize  int64
@@ -67,4 +107,311 @@ type Stats struct {
 	MaxWorkers     int
 	MinWorkers     int
 	CurrentWorkers int
+
+	// Accounting rules the counts broke by the end of the run, e.g. processed
+	// not matching successful plus failed; any entry points to a bug
+	InvariantViolations []string
+
+	// Comparison with the Message-IDs a migration was expected to deliver
+	// (nil = not checked)
+	Migration *MigrationCheck
+
+	// Outputs distinct sources shared, found after the run (nil = not checked)
+	Duplicates *DuplicateCheck
+
+	// Security alerts by severity, and what the alert policy did about them
+	AlertCounts AlertCounts
+	Withheld    int    // Files whose outputs were withheld
+	Quarantined int    // Files whose outputs were written to the quarantine directory
+	Aborted     string // Why an alert stopped the run (empty = not stopped)
+
+	// Conversion time percentiles by renderer path, most files first, and
+	// the slowest conversions, slowest first
+	Latency      []LatencySummary
+	SlowestFiles []SlowFile
+
+	// Virus scans of attachments (zero = scanning off)
+	Scanning ScanSummary
+
+	// Verdicts of the attachments detonated in a sandbox (zero = no sandbox)
+	Sandbox SandboxSummary
+}
+
+// ScanSummary describes the attachments a run streamed to clamd
+type ScanSummary struct {
+	Scans  int
+	Failed int // Scans clamd couldn't complete
+	Bytes  int64
+	Time   time.Duration // Spent streaming and waiting for verdicts, summed over scans
+	Wait   time.Duration // Spent waiting for a free clamd stream, summed over scans
+	Max    time.Duration // Longest scan
+}
+
+// Severities of security alerts, from least to most serious
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// SecurityAlert is a security finding in a message
+type SecurityAlert struct {
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Attachment string `json:"attachment,omitempty"` // Attachment the finding is about
+	Threat     string `json:"threat,omitempty"`     // Name the scanner gave the malware
+	SHA256     string `json:"sha256,omitempty"`     // Hash of the attachment's content
+}
+
+func (a SecurityAlert) String() string { return a.Severity + ": " + a.Message }
+
+// AlertCounts counts a run's security alerts by severity
+type AlertCounts struct {
+	Info     int `json:"info"`
+	Warning  int `json:"warning"`
+	Critical int `json:"critical"`
+}
+
+// Add counts an alert
+func (c *AlertCounts) Add(alert SecurityAlert) {
+	switch alert.Severity {
+	case SeverityCritical:
+		c.Critical++
+	case SeverityWarning:
+		c.Warning++
+	default:
+		c.Info++
+	}
+}
+
+// LatencySummary describes the conversion times of the files that took one
+// path: a renderer, or "failed"
+type LatencySummary struct {
+	Path          string
+	Files         int
+	P50, P90, P99 time.Duration
+	Max           time.Duration
+}
+
+// SlowFile is one of a run's slowest conversions
+type SlowFile struct {
+	Path     string
+	Renderer string // Path the file took, as in LatencySummary
+	Duration time.Duration
+}
+
+// FileReport records the outcome of converting a single file
+type FileReport struct {
+	InputPath          string          `json:"input_path"`
+	Source             string          `json:"source,omitempty"` // Label of the -src the file came from, when a run has several
+	OutputPaths        []string        `json:"output_paths,omitempty"`
+	Status             string          `json:"status"`
+	Error              string          `json:"error,omitempty"`
+	ErrorClass         string          `json:"error_class,omitempty"` // Kind of failure, e.g. "parse", "render" or "panic"
+	Stack              string          `json:"stack,omitempty"`       // Stack trace of a panic recovered while converting
+	DurationMS         int64           `json:"duration_ms"`
+	Retries            int             `json:"retries"`
+	FileSize           int64           `json:"file_size"`
+	SecurityAlerts     []SecurityAlert `json:"security_alerts,omitempty"`
+	AlertAction        string          `json:"alert_action,omitempty"`        // What the alert policy did with the outputs, e.g. "quarantine"
+	SkippedAttachments []string        `json:"skipped_attachments,omitempty"` // Attachments listed in the PDF but not saved, with the reason
+	PackagePath        string          `json:"package_path,omitempty"`        // ZIP bundle written with -zip
+	BodyPart           string          `json:"body_part,omitempty"`           // Which HTML part was rendered when there were several
+	Renderer           string          `json:"renderer,omitempty"`            // Backend that produced the PDF
+	Custodian          string          `json:"custodian,omitempty"`           // Custodian given by the -manifest
+	Priority           int             `json:"priority,omitempty"`            // Priority given by the -manifest
+	MessageID          string          `json:"message_id,omitempty"`          // Message-ID of the converted message
+	Sender             string          `json:"sender,omitempty"`              // Address the message is from
+	CPUMS              int64           `json:"cpu_ms,omitempty"`              // CPU time the conversion took on the worker's thread, Chrome's rendering aside
+	PeakRSSDelta       int64           `json:"peak_rss_delta,omitempty"`      // Bytes by which the conversion raised the process's peak memory
+	AttachmentBytes    int64           `json:"attachment_bytes,omitempty"`    // Bytes of attachments saved
+	Tagged             bool            `json:"tagged,omitempty"`              // The PDF is tagged for accessibility (PDF/UA)
+	Truncated          bool            `json:"truncated,omitempty"`           // The body was cut off at the -truncate-pages limit
+	EmptyBody          bool            `json:"empty_body,omitempty"`          // The message had no body, only headers (and perhaps attachments)
+	HeaderAnomalies    []string        `json:"header_anomalies,omitempty"`    // Structural oddities in the headers, e.g. "missing-date: no Date header"
+	Thread             *Thread         `json:"thread,omitempty"`              // Conversation the message belongs to among the run's messages
+	JournalFormat      string          `json:"journal_format,omitempty"`      // Journaling system whose report the message was unwrapped from
+	JournalDirection   string          `json:"journal_direction,omitempty"`   // Direction recorded in the journal report: inbound, outbound or internal
+	JournalRecipients  []string        `json:"journal_recipients,omitempty"`  // Everyone the journaled message was delivered to, including Bcc
+	FinishedAt         time.Time       `json:"finished_at"`
+
+	// Verdicts of the message's attachments detonated in a sandbox, merged
+	// in at the end of the run
+	Sandbox []SandboxVerdict `json:"sandbox,omitempty"`
+}
+
+// Report is the JSON report written at the end of a run
+type Report struct {
+	StartTime  time.Time    `json:"start_time"`
+	EndTime    time.Time    `json:"end_time"`
+	Discovered int          `json:"discovered"`
+	Successful int          `json:"successful"`
+	Failed     int          `json:"failed"`
+	Truncated  int          `json:"truncated,omitempty"` // Converted files whose body was cut off at the page limit
+	Empty      int          `json:"empty,omitempty"`     // Converted files with no body
+	Anomalous  int          `json:"anomalous,omitempty"` // Converted files with header anomalies
+	Threads    int          `json:"threads,omitempty"`   // Conversations the converted files form
+	Deferred   int          `json:"deferred,omitempty"`  // Files left for the next run when the run's budget was spent
+	Files      []FileReport `json:"files"`
+
+	// Files skipped because an earlier run converted them, going by the -checkpoint
+	Checkpointed int `json:"checkpointed,omitempty"`
+
+	// Outcomes of each source directory, when a run has several
+	Sources []SourceReport `json:"sources,omitempty"`
+
+	// Accounting rules the run's counts broke, which point to a bug (empty = consistent)
+	InvariantViolations []string `json:"invariant_violations,omitempty"`
+
+	// Comparison with the Message-IDs expected from a migration (nil = not checked)
+	Migration *MigrationCheck `json:"migration,omitempty"`
+
+	// Outputs distinct sources shared (nil = not checked)
+	Duplicates *DuplicateCheck `json:"duplicates,omitempty"`
+
+	// Last entry of the -audit-log when the run finished (nil = no audit log)
+	Audit *AuditAnchor `json:"audit,omitempty"`
+}
+
+// AuditAnchor records the head of an audit log outside it, so a signed
+// report can show later that the log wasn't cut short or rewritten
+type AuditAnchor struct {
+	Log      string `json:"log"`      // Audit log path as given to -audit-log
+	Sequence int64  `json:"sequence"` // Sequence of the last entry (0 = empty log)
+	Hash     string `json:"hash"`     // Hash of the last entry
+}
+
+// SourceReport sums up the files of one source directory of a run
+type SourceReport struct {
+	Label      string `json:"label"`
+	Dir        string `json:"dir"`
+	Successful int    `json:"successful"`
+	Failed     int    `json:"failed"`
+}
+
+// ThreadKey is what a converted message's conversation is worked out from
+type ThreadKey struct {
+	MessageID  string    // Without angle brackets (empty = none)
+	References []string  // Message-IDs of its ancestors from References and In-Reply-To, oldest first
+	Subject    string    // Subject without reply and forward prefixes or list tags, lower-cased
+	Reply      bool      // The subject had a reply or forward prefix
+	Date       time.Time // Zero if missing or unparsable
+}
+
+// Thread places a converted message in a conversation among the messages of
+// a run
+type Thread struct {
+	ID       string `json:"id"`             // Derived from the Message-ID the thread started with, so runs agree on it
+	Root     string `json:"root,omitempty"` // Message-ID the thread started with, which may not be in the run
+	Position int    `json:"position"`       // Place in the thread by date, 1 = earliest
+	Size     int    `json:"size"`           // Messages of the thread in the run
+}
+
+// MigrationCheck compares the messages a run converted with those a mailbox
+// migration was expected to deliver
+type MigrationCheck struct {
+	Expected   int      `json:"expected"`             // Message-IDs in the expected list
+	Converted  int      `json:"converted"`            // Expected Message-IDs at least one converted file had
+	Missing    []string `json:"missing,omitempty"`    // Expected Message-IDs no converted file had
+	Extra      []string `json:"extra,omitempty"`      // Message-IDs of converted files that weren't expected
+	Duplicates []string `json:"duplicates,omitempty"` // Message-IDs more than one converted file had
+	WithoutID  []string `json:"without_id,omitempty"` // Converted files without a Message-ID header
+}
+
+// DuplicateCheck lists the outputs distinct sources shared in a run, which
+// point to a file name template that doesn't tell messages apart or to
+// sources that are copies of one another
+type DuplicateCheck struct {
+	Outputs    int              `json:"outputs"`              // Output files checked
+	Collisions []DuplicateGroup `json:"collisions,omitempty"` // Paths several sources were converted to; the last one's output remains
+	Identical  []DuplicateGroup `json:"identical,omitempty"`  // Byte-identical outputs of different sources
+}
+
+// Found returns the number of collisions and identical sets found
+func (c *DuplicateCheck) Found() int {
+	return len(c.Collisions) + len(c.Identical)
+}
+
+// DuplicateGroup is one shared output path, or one set of identical outputs,
+// and the sources they came from
+type DuplicateGroup struct {
+	Path    string   `json:"path,omitempty"`    // Output path the sources collided on
+	SHA256  string   `json:"sha256,omitempty"`  // Hash the identical outputs share
+	Outputs []string `json:"outputs,omitempty"` // The identical outputs
+	Sources []string `json:"sources"`
+}
+
+// SecurityReport indexes a run's security findings by threat, attachment
+// hash and sender domain, for incident response
+type SecurityReport struct {
+	StartTime time.Time         `json:"start_time"`
+	EndTime   time.Time         `json:"end_time"`
+	Scanned   bool              `json:"scanned"` // Attachments were scanned for malware
+	Files     int               `json:"files"`   // Files with at least one finding
+	Counts    AlertCounts       `json:"counts"`
+	Threats   []ThreatEntry     `json:"threats"`
+	Hashes    []HashEntry       `json:"hashes"`
+	Domains   []DomainEntry     `json:"sender_domains"`
+	Findings  []SecurityFinding `json:"findings"`
+}
+
+// SecurityFinding is one security alert with the message it was raised for
+type SecurityFinding struct {
+	InputPath    string   `json:"input_path"`
+	OutputPaths  []string `json:"output_paths,omitempty"`
+	MessageID    string   `json:"message_id,omitempty"`
+	Sender       string   `json:"sender,omitempty"`
+	SenderDomain string   `json:"sender_domain,omitempty"`
+	Custodian    string   `json:"custodian,omitempty"`
+	Action       string   `json:"action,omitempty"` // What the alert policy did with the outputs
+	SecurityAlert
+}
+
+// ThreatEntry is one malware name found in the run
+type ThreatEntry struct {
+	Name     string   `json:"name"`
+	Findings int      `json:"findings"`
+	Files    []string `json:"files"`
+	Hashes   []string `json:"hashes,omitempty"`
+	Domains  []string `json:"sender_domains,omitempty"`
+}
+
+// HashEntry is one infected attachment content found in the run, however
+// many messages carried it
+type HashEntry struct {
+	SHA256      string   `json:"sha256"`
+	Threats     []string `json:"threats"`
+	Attachments []string `json:"attachments"` // Names the content was attached under
+	Files       []string `json:"files"`
+}
+
+// DomainEntry sums up the findings in the messages of one sender domain
+type DomainEntry struct {
+	Domain   string   `json:"domain"`
+	Files    int      `json:"files"`
+	Findings int      `json:"findings"`
+	Threats  []string `json:"threats,omitempty"`
+}
+
+// SandboxVerdict is what an external sandbox made of an attachment
+type SandboxVerdict struct {
+	SHA256     string   `json:"sha256"`
+	Attachment string   `json:"attachment"`
+	Verdict    string   `json:"verdict"`         // malicious, suspicious or clean; pending or error when there is none
+	Score      float64  `json:"score,omitempty"` // Out of 10
+	Signatures []string `json:"signatures,omitempty"`
+	Task       string   `json:"task,omitempty"` // The sandbox's task, to look the analysis up by
+	Link       string   `json:"link,omitempty"` // Where the sandbox shows the analysis
+	Error      string   `json:"error,omitempty"`
+}
+
+// SandboxSummary counts the verdicts of the attachments a run submitted to
+// a sandbox
+type SandboxSummary struct {
+	Submitted  int // Distinct attachments
+	Malicious  int
+	Suspicious int
+	Clean      int
+	Pending    int // Still without a verdict when the run stopped waiting
+	Failed     int // The sandbox couldn't analyze them
 }
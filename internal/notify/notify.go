@@ -0,0 +1,176 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"emil/internal/models"
+)
+
+// Most failures and alerts listed in the email body; the attached reports have the rest
+const maxListed = 25
+
+// SMTP is the mail server and envelope used for notifications
+type SMTP struct {
+	Address  string // Server as host:port, e.g. smtp.example.com:587
+	From     string
+	To       []string
+	Username string // Empty = no authentication
+	Password string
+}
+
+// Summary is what a notification reports about a finished run
+type Summary struct {
+	SourceDir   string
+	Stats       models.Stats
+	Files       []models.FileReport // Per-file outcomes, from which failures and alerts are listed
+	Attachments []string            // Report files attached to the email
+}
+
+// Send emails the run summary. STARTTLS is used when the server offers it,
+// and credentials are only sent over TLS or to localhost.
+func Send(server SMTP, summary Summary) error {
+	if len(server.To) == 0 {
+		return nil
+	}
+
+	message, err := compose(server, summary)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if server.Username != "" {
+		host, _, err := net.SplitHostPort(server.Address)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address %q: %w", server.Address, err)
+		}
+		auth = smtp.PlainAuth("", server.Username, server.Password, host)
+	}
+
+	if err := smtp.SendMail(server.Address, auth, server.From, server.To, message); err != nil {
+		return fmt.Errorf("failed to send run notification: %w", err)
+	}
+	return nil
+}
+
+// compose builds the notification as a MIME message with the reports attached
+func compose(server SMTP, summary Summary) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+
+	stats := summary.Stats
+	subject := fmt.Sprintf("emil: %d converted, %d failed in %s", stats.Successful, stats.Failed, summary.SourceDir)
+	fmt.Fprintf(&buffer, "From: %s\r\n", server.From)
+	fmt.Fprintf(&buffer, "To: %s\r\n", strings.Join(server.To, ", "))
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buffer, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buffer, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buffer, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"8bit"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compose run notification: %w", err)
+	}
+	part.Write([]byte(strings.ReplaceAll(body(summary), "\n", "\r\n")))
+
+	for _, path := range summary.Attachments {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to attach %s: %w", path, err)
+		}
+		name := filepath.Base(path)
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to compose run notification: %w", err)
+		}
+		writeBase64(part, data)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compose run notification: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// body is the plain text summary of the run
+func body(summary Summary) string {
+	var b strings.Builder
+	stats := summary.Stats
+	elapsed := stats.EndTime.Sub(stats.StartTime).Round(time.Second)
+
+	fmt.Fprintf(&b, "Emil finished converting %s\n\n", summary.SourceDir)
+	fmt.Fprintf(&b, "Started:    %s\n", stats.StartTime.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(&b, "Duration:   %s\n", elapsed)
+	fmt.Fprintf(&b, "Discovered: %d\n", stats.Discovered)
+	fmt.Fprintf(&b, "Successful: %d\n", stats.Successful)
+	fmt.Fprintf(&b, "Failed:     %d\n", stats.Failed)
+	if stats.Deferred > 0 {
+		fmt.Fprintf(&b, "Deferred:   %d (left for the next run)\n", stats.Deferred)
+	}
+	fmt.Fprintf(&b, "Data:       %.2f MB\n", float64(stats.TotalFileSize)/(1024*1024))
+
+	var failures, alerts []string
+	for _, file := range summary.Files {
+		if file.Status == string(models.StatusFailed) {
+			failures = append(failures, fmt.Sprintf("%s: %s", file.InputPath, file.Error))
+		}
+		for _, alert := range file.SecurityAlerts {
+			alerts = append(alerts, fmt.Sprintf("%s: %s", file.InputPath, alert))
+		}
+	}
+	writeList(&b, "Security alerts", alerts)
+	writeList(&b, "Failures", failures)
+
+	if len(summary.Attachments) > 0 {
+		fmt.Fprintf(&b, "\nThe run reports are attached.\n")
+	}
+	return b.String()
+}
+
+// writeList adds a titled list, cut off after maxListed entries
+func writeList(b *strings.Builder, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n%s (%d):\n", title, len(items))
+	for i, item := range items {
+		if i == maxListed {
+			fmt.Fprintf(b, "  ... and %d more\n", len(items)-maxListed)
+			break
+		}
+		fmt.Fprintf(b, "  - %s\n", item)
+	}
+}
+
+// writeBase64 writes data base64-encoded in 76-character lines
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
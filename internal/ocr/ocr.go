@@ -0,0 +1,112 @@
+package ocr
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Engine provides optical character recognition using Tesseract
+type Engine struct {
+	enabled  bool
+	language string
+	tempDir  string // Directory for images handed to Tesseract (empty = system temp dir)
+}
+
+// Result contains the recognized text for a single image
+type Result struct {
+	Source string // Filename or description of the image that was recognized
+	Text   string
+}
+
+// supportedTypes lists the image content types Tesseract can read
+var supportedTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/jpg":  true,
+	"image/tiff": true,
+	"image/bmp":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// NewEngine creates a new OCR engine
+func NewEngine(enabled bool, language, tempDir string) *Engine {
+	// Use English if no language was given
+	if language == "" {
+		language = "eng"
+	}
+
+	// Check if Tesseract is installed
+	if enabled && !isTesseractAvailable() {
+		fmt.Println("Tesseract is not available, disabling OCR.")
+		enabled = false
+	}
+
+	return &Engine{
+		enabled:  enabled,
+		language: language,
+		tempDir:  tempDir,
+	}
+}
+
+// isTesseractAvailable checks if the tesseract binary is in the PATH
+func isTesseractAvailable() bool {
+	cmd := exec.Command("tesseract", "--version")
+	if err := cmd.Run(); err != nil {
+		return false
+	}
+	return true
+}
+
+// IsEnabled returns whether OCR is enabled
+func (e *Engine) IsEnabled() bool {
+	return e != nil && e.enabled
+}
+
+// IsSupported returns whether the content type can be processed by OCR
+func IsSupported(contentType string) bool {
+	return supportedTypes[strings.ToLower(contentType)]
+}
+
+// RecognizeBytes runs OCR on an image held in memory
+func (e *Engine) RecognizeBytes(data []byte) (string, error) {
+	if !e.IsEnabled() {
+		return "", nil
+	}
+
+	// Tesseract needs a file to read from
+	tmpFile, err := os.CreateTemp(e.tempDir, "emil-ocr-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file for OCR: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return "", fmt.Errorf("failed to write temp file for OCR: %w", err)
+	}
+	tmpFile.Close()
+
+	return e.RecognizeFile(tmpFile.Name())
+}
+
+// RecognizeFile runs OCR on an image file and returns the recognized text
+func (e *Engine) RecognizeFile(path string) (string, error) {
+	if !e.IsEnabled() {
+		return "", nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("tesseract", path, "stdout", "-l", e.language)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
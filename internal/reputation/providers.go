@@ -0,0 +1,236 @@
+package reputation
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// queryHost returns the host name or address a query is about
+func queryHost(query Query) string {
+	if query.Kind == KindURL {
+		if u, err := url.Parse(query.Value); err == nil {
+			return strings.ToLower(u.Hostname())
+		}
+		return ""
+	}
+	return strings.ToLower(strings.TrimSuffix(query.Value, "."))
+}
+
+// list is a local file of blocked domains and URL prefixes, for air-gapped
+// sites. A domain entry also blocks its subdomains.
+type list struct {
+	path     string
+	domains  map[string]bool
+	prefixes []string // Lower-cased URL prefixes
+}
+
+// loadList reads a list file: one domain, address or URL prefix per line,
+// with # starting a comment
+func loadList(path string) (*list, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reputation list: %w", err)
+	}
+	defer file.Close()
+
+	l := &list{path: path, domains: make(map[string]bool)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.ToLower(strings.TrimSpace(line))
+		switch {
+		case line == "":
+		case strings.Contains(line, "://"):
+			l.prefixes = append(l.prefixes, line)
+		default:
+			l.domains[strings.TrimSuffix(line, ".")] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read reputation list: %w", err)
+	}
+	return l, nil
+}
+
+func (l *list) Name() string { return "list:" + l.path }
+
+func (l *list) Check(_ context.Context, query Query) (*Listing, error) {
+	if query.Kind == KindURL {
+		value := strings.ToLower(query.Value)
+		for _, prefix := range l.prefixes {
+			if strings.HasPrefix(value, prefix) {
+				return &Listing{Reason: "matches " + prefix}, nil
+			}
+		}
+	}
+	if query.IP != "" && l.domains[query.IP] {
+		return &Listing{Reason: "address " + query.IP}, nil
+	}
+	for host := queryHost(query); host != ""; {
+		if l.domains[host] {
+			return &Listing{Reason: "matches " + host}, nil
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			break
+		}
+		host = parent
+	}
+	return nil, nil
+}
+
+// dnsbl is a DNS blocklist: domain lists such as SURBL or Spamhaus DBL are
+// asked about the registered domain, and address lists such as Spamhaus ZEN
+// about the relay's address
+type dnsbl struct {
+	zone     string
+	resolver *net.Resolver
+}
+
+// newDNSBL returns a provider asking the blocklist at zone
+func newDNSBL(zone string) *dnsbl {
+	return &dnsbl{zone: strings.Trim(zone, "."), resolver: net.DefaultResolver}
+}
+
+func (d *dnsbl) Name() string { return "dnsbl:" + d.zone }
+
+// address returns the address a blocklist is asked about for a query, if any
+func (d *dnsbl) address(query Query) string {
+	ip := query.IP
+	if host := queryHost(query); ip == "" && net.ParseIP(host) != nil {
+		ip = host
+	}
+	return ip
+}
+
+// cacheKey is all a blocklist is asked: the address and the registered
+// domain, so every link into a domain shares one answer
+func (d *dnsbl) cacheKey(query Query) string {
+	return d.address(query) + " " + query.Domain
+}
+
+func (d *dnsbl) Check(ctx context.Context, query Query) (*Listing, error) {
+	if ip := d.address(query); ip != "" {
+		if reversed := reverseIP(ip); reversed != "" {
+			if listing, err := d.lookup(ctx, reversed); listing != nil || err != nil {
+				return listing, err
+			}
+		}
+	}
+	if query.Domain != "" {
+		return d.lookup(ctx, query.Domain)
+	}
+	return nil, nil
+}
+
+// lookup asks the zone about name. Blocklists answer with an address in
+// 127.0.0.0/8 for listed names; 127.0.0.1 and 127.255.255.x are the codes
+// SURBL and Spamhaus use to refuse a query, e.g. from a public resolver.
+func (d *dnsbl) lookup(ctx context.Context, name string) (*Listing, error) {
+	addrs, err := d.resolver.LookupHost(ctx, name+"."+d.zone)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if addr == "127.0.0.1" || strings.HasPrefix(addr, "127.255.255.") {
+			return nil, fmt.Errorf("%s refused the query (%s)", d.zone, addr)
+		}
+		if strings.HasPrefix(addr, "127.") {
+			return &Listing{Reason: fmt.Sprintf("%s returned %s", name, addr)}, nil
+		}
+	}
+	return nil, nil
+}
+
+// reverseIP returns an address in the reversed form blocklists are asked
+// about: octets for IPv4, nibbles for IPv6
+func reverseIP(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", v4[3], v4[2], v4[1], v4[0])
+	}
+	const digits = "0123456789abcdef"
+	nibbles := make([]string, 0, 32)
+	for i := len(ip) - 1; i >= 0; i-- {
+		nibbles = append(nibbles, string(digits[ip[i]&0xf]), string(digits[ip[i]>>4]))
+	}
+	return strings.Join(nibbles, ".")
+}
+
+// api is a reputation service, usually an adapter to a commercial one,
+// speaking emil's JSON protocol: each name is posted as
+// {"kind", "value", "domain", "ip"} and answered with
+// {"listed": true, "reason": "..."}
+type api struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// newAPI returns a provider posting to endpoint, authenticating with token
+// as a bearer token
+func newAPI(endpoint, token string) (*api, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid reputation API URL %q (use http:// or https://)", endpoint)
+	}
+	return &api{url: endpoint, token: token, client: &http.Client{Timeout: lookupTimeout}}, nil
+}
+
+func (a *api) Name() string { return "http:" + a.url }
+
+func (a *api) Check(ctx context.Context, query Query) (*Listing, error) {
+	body, err := json.Marshal(map[string]string{"kind": query.Kind, "value": query.Value, "domain": query.Domain, "ip": query.IP})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("reputation API returned %s: %s", resp.Status, strings.TrimSpace(string(text)))
+	}
+	var answer struct {
+		Listed bool   `json:"listed"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("failed to decode reputation API response: %w", err)
+	}
+	if !answer.Listed {
+		return nil, nil
+	}
+	return &Listing{Reason: answer.Reason}, nil
+}
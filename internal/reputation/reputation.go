@@ -0,0 +1,273 @@
+package reputation
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Kinds of name checked
+const (
+	KindURL  = "url"  // A link in a message's body
+	KindHELO = "helo" // The name a relay introduced itself with in a Received header
+)
+
+// Bounds on the time reputation checks take
+const (
+	lookupTimeout  = 5 * time.Second  // One provider's answer about one name
+	messageTimeout = 30 * time.Second // All lookups for one message, well inside a worker's stall timeout
+	lookupWorkers  = 8                // Lookups a message runs at once
+)
+
+// Query is a name whose reputation is checked
+type Query struct {
+	Kind   string
+	Value  string // The URL or HELO name as found
+	Domain string // Registered domain the value belongs to, e.g. example.co.uk (empty = none, e.g. an address literal)
+	IP     string // Address the relay connected from, for HELO names (empty = unknown)
+}
+
+// URLQuery returns the query for a link, or false if it isn't a web link
+func URLQuery(link string) (Query, bool) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return Query{}, false
+	}
+	return Query{Kind: KindURL, Value: u.String(), Domain: registeredDomain(u.Hostname())}, true
+}
+
+// HELOQuery returns the query for the name a relay introduced itself with
+// and the address it connected from
+func HELOQuery(name, ip string) Query {
+	name = strings.Trim(name, "[]")
+	if ip == "" && net.ParseIP(name) != nil {
+		ip = name
+	}
+	return Query{Kind: KindHELO, Value: name, Domain: registeredDomain(name), IP: ip}
+}
+
+// registeredDomain returns the domain a host name was registered under, or
+// "" for addresses and names outside the public suffixes, such as a bare
+// "localhost" or "mail.internal"
+func registeredDomain(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	if _, icann := publicsuffix.PublicSuffix(host); !icann {
+		return ""
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return ""
+	}
+	return domain
+}
+
+// Listing is a provider's finding that a name has a bad reputation
+type Listing struct {
+	Query
+	Source string // Provider and list, e.g. "dnsbl:multi.surbl.org"
+	Reason string // What the list says about the name (empty = nothing more)
+}
+
+// Provider looks names up in one reputation source
+type Provider interface {
+	// Name identifies the source in listings, e.g. "list:blocked.txt"
+	Name() string
+
+	// Check returns the listing of a name, or nil if the source doesn't list it
+	Check(ctx context.Context, query Query) (*Listing, error)
+}
+
+// keyed is implemented by providers whose answer depends on less than the
+// whole query, e.g. only the domain of a link, so their answers are shared
+// by every query that asks the same
+type keyed interface {
+	cacheKey(query Query) string
+}
+
+// Checker looks names up in a chain of providers, remembering the answers,
+// failures included, for the run, since the messages of a corpus share most
+// of their domains
+type Checker struct {
+	providers []Provider
+
+	mu    sync.Mutex
+	cache map[string]answer // By provider and what it is asked
+}
+
+// answer is a provider's reply about one name
+type answer struct {
+	listing *Listing // nil = not listed
+	err     error
+}
+
+// New returns a checker for providers given as specs:
+//
+//	list:PATH        domains and URL prefixes, one per line, in a local file
+//	dnsbl:ZONE       a DNS blocklist such as multi.surbl.org or zen.spamhaus.org
+//	http:URL         a reputation API speaking emil's JSON protocol
+//
+// token authenticates with the http providers.
+func New(specs []string, token string) (*Checker, error) {
+	c := &Checker{cache: make(map[string]answer)}
+	for _, spec := range specs {
+		provider, err := newProvider(spec, token)
+		if err != nil {
+			return nil, err
+		}
+		c.providers = append(c.providers, provider)
+	}
+	return c, nil
+}
+
+// newProvider parses one provider spec
+func newProvider(spec, token string) (Provider, error) {
+	kind, arg, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	if arg == "" {
+		return nil, fmt.Errorf("invalid reputation provider %q (use list:PATH, dnsbl:ZONE or http:URL)", spec)
+	}
+	switch kind {
+	case "list":
+		return loadList(arg)
+	case "dnsbl":
+		return newDNSBL(arg), nil
+	case "http":
+		return newAPI(arg, token)
+	}
+	return nil, fmt.Errorf("invalid reputation provider %q (use list:PATH, dnsbl:ZONE or http:URL)", spec)
+}
+
+// Check looks each query up in every provider and returns the listings.
+// Lookups run in parallel and stop after messageTimeout; a provider that
+// fails for a name is skipped for it, and not asked again during the run.
+// err reports the first failure of this call, so it can be logged without
+// losing the listings.
+func (c *Checker) Check(ctx context.Context, queries []Query) ([]Listing, error) {
+	ctx, cancel := context.WithTimeout(ctx, messageTimeout)
+	defer cancel()
+
+	// Each provider is asked once about what it looks at, however many of
+	// the message's queries share it
+	type ask struct {
+		query    Query
+		provider Provider
+		key      string
+	}
+	var asks []ask
+	seen := make(map[string]bool)
+	for _, query := range queries {
+		id := query.Kind + " " + query.Value + " " + query.IP
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		for _, provider := range c.providers {
+			asks = append(asks, ask{query: query, provider: provider, key: cacheKey(provider, query)})
+		}
+	}
+
+	var mu sync.Mutex
+	answers := make(map[string]answer)
+	var firstErr error
+	skipped := 0
+
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, lookupWorkers)
+	started := make(map[string]bool)
+	for _, a := range asks {
+		if started[a.key] {
+			continue
+		}
+		started[a.key] = true
+		if cached, ok := c.cached(a.key); ok {
+			mu.Lock()
+			answers[a.key] = cached
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case workers <- struct{}{}:
+			case <-ctx.Done():
+				mu.Lock()
+				skipped++
+				mu.Unlock()
+				return
+			}
+			defer func() { <-workers }()
+
+			reply := c.lookup(ctx, a.provider, a.query, a.key)
+			mu.Lock()
+			answers[a.key] = reply
+			if reply.err != nil && firstErr == nil {
+				firstErr = reply.err
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	var listings []Listing
+	for _, a := range asks {
+		if reply := answers[a.key]; reply.listing != nil {
+			listing := *reply.listing
+			listing.Query = a.query
+			listing.Source = a.provider.Name()
+			listings = append(listings, listing)
+		}
+	}
+	if skipped > 0 && firstErr == nil {
+		firstErr = fmt.Errorf("reputation lookups stopped after %s with %d left", messageTimeout, skipped)
+	}
+	return listings, firstErr
+}
+
+// cacheKey identifies what a provider is asked about a query
+func cacheKey(provider Provider, query Query) string {
+	if k, ok := provider.(keyed); ok {
+		return provider.Name() + " " + k.cacheKey(query)
+	}
+	return provider.Name() + " " + query.Kind + " " + query.Value + " " + query.IP
+}
+
+// cached returns the answer remembered for a lookup
+func (c *Checker) cached(key string) (answer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reply, ok := c.cache[key]
+	if ok {
+		// Failures were reported when they happened
+		reply.err = nil
+	}
+	return reply, ok
+}
+
+// lookup asks one provider about one name and remembers its answer, unless
+// the message ran out of time, which says nothing about the provider
+func (c *Checker) lookup(ctx context.Context, provider Provider, query Query, key string) answer {
+	lookupCtx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	listing, err := provider.Check(lookupCtx, query)
+	if err != nil {
+		err = fmt.Errorf("%s lookup of %s failed: %w", provider.Name(), query.Value, err)
+	}
+	reply := answer{listing: listing, err: err}
+	if ctx.Err() == nil {
+		c.mu.Lock()
+		c.cache[key] = reply
+		c.mu.Unlock()
+	}
+	return reply
+}
@@ -0,0 +1,84 @@
+package reputation
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeProvider answers from a set of listed domains, asked only about the
+// domain as a blocklist is, and counts the lookups it is asked to make
+type fakeProvider struct {
+	listed  map[string]bool
+	fail    bool
+	lookups atomic.Int32
+}
+
+func (f *fakeProvider) Name() string { return "fake" }
+
+func (f *fakeProvider) cacheKey(query Query) string { return query.Domain }
+
+func (f *fakeProvider) Check(_ context.Context, query Query) (*Listing, error) {
+	f.lookups.Add(1)
+	if f.fail {
+		return nil, errors.New("unreachable")
+	}
+	if f.listed[query.Domain] {
+		return &Listing{Reason: "listed"}, nil
+	}
+	return nil, nil
+}
+
+func urlQueries(t *testing.T, links ...string) []Query {
+	t.Helper()
+	var queries []Query
+	for _, link := range links {
+		query, ok := URLQuery(link)
+		if !ok {
+			t.Fatalf("URLQuery(%s) failed", link)
+		}
+		queries = append(queries, query)
+	}
+	return queries
+}
+
+func TestCheckAsksOncePerDomain(t *testing.T) {
+	provider := &fakeProvider{listed: map[string]bool{"bad.com": true}}
+	checker := &Checker{providers: []Provider{provider}, cache: make(map[string]answer)}
+
+	queries := urlQueries(t, "https://bad.com/a", "https://www.bad.com/b", "https://good.org/")
+	listings, err := checker.Check(context.Background(), queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listings) != 2 {
+		t.Errorf("got %d listings, want one for each link into bad.com", len(listings))
+	}
+	if n := provider.lookups.Load(); n != 2 {
+		t.Errorf("provider asked %d times, want once per domain", n)
+	}
+
+	// A later message reuses the answers
+	if _, err := checker.Check(context.Background(), urlQueries(t, "https://bad.com/c")); err != nil {
+		t.Fatal(err)
+	}
+	if n := provider.lookups.Load(); n != 2 {
+		t.Errorf("provider asked again for a domain already checked in this run")
+	}
+}
+
+func TestCheckRemembersFailures(t *testing.T) {
+	provider := &fakeProvider{fail: true}
+	checker := &Checker{providers: []Provider{provider}, cache: make(map[string]answer)}
+
+	if _, err := checker.Check(context.Background(), urlQueries(t, "https://down.net/")); err == nil {
+		t.Error("Check didn't report the failed lookup")
+	}
+	if _, err := checker.Check(context.Background(), urlQueries(t, "https://down.net/")); err != nil {
+		t.Errorf("Check reported a failure already reported: %v", err)
+	}
+	if n := provider.lookups.Load(); n != 1 {
+		t.Errorf("failing provider asked %d times, want once per run", n)
+	}
+}
@@ -25,12 +25,16 @@ type Manager struct {
 	targetCPU       float64
 	maxWorkers      int
 	minWorkers      int
+	workerLimit     int // Most workers the run may ever be tuned to, which workerControl is sized for
 	currentWorkers  int
 	workerControl   chan int // +1 to add, -1 to remove worker
 	pauseProcessing chan bool
 	lastScaleDown   time.Time
 	scaleUpDelay    time.Duration
 	memUsage        float64
+	headroom        int64 // Bytes that can still be allocated before reaching targetMemory
+	pressure        bool  // Memory is over the target or the high watermark
+	onPressure      func(bool)
 	verbose         bool
 }
 
@@ -41,6 +45,7 @@ func NewManager(minWorkers, maxWorkers int, targetMemory, targetCPU float64, ver
 		targetCPU:       targetCPU,
 		maxWorkers:      maxWorkers,
 		minWorkers:      minWorkers,
+		workerLimit:     maxWorkers,
 		currentWorkers:  maxWorkers,
 		workerControl:   make(chan int, maxWorkers*2),
 		pauseProcessing: make(chan bool, 1),
@@ -66,6 +71,16 @@ func (rm *Manager) Start(ctx context.Context) {
 	}()
 }
 
+// OnPressure sets a function called with true when memory comes under
+// pressure and false when it is relieved, so work already in progress can
+// give memory back rather than only new work being paused. Call it before
+// Start.
+func (rm *Manager) OnPressure(fn func(bool)) {
+	rm.Lock()
+	defer rm.Unlock()
+	rm.onPressure = fn
+}
+
 // WorkerControl returns the channel used to control workers
 func (rm *Manager) WorkerControl() <-chan int {
 	return rm.workerControl
@@ -76,6 +91,46 @@ func (rm *Manager) PauseControl() <-chan bool {
 	return rm.pauseProcessing
 }
 
+// SetMaxWorkers changes the most workers the run scales up to, capped at
+// WorkerLimit, and scales the pool, which has current workers now, to that
+// many; resource pressure can still scale it down
+func (rm *Manager) SetMaxWorkers(count, current int) {
+	rm.Lock()
+	defer rm.Unlock()
+	count = min(count, rm.workerLimit)
+	rm.maxWorkers = count
+	rm.minWorkers = min(rm.minWorkers, count)
+	rm.currentWorkers = current
+	rm.adjustWorkerCount(count)
+}
+
+// WorkerLimit returns the most workers SetMaxWorkers accepts: the maximum
+// the manager was created with
+func (rm *Manager) WorkerLimit() int {
+	return rm.workerLimit
+}
+
+// MaxWorkers returns the most workers the run scales up to
+func (rm *Manager) MaxWorkers() int {
+	rm.Lock()
+	defer rm.Unlock()
+	return rm.maxWorkers
+}
+
+// SetTargetMemory changes the memory usage percentage workers are scaled to stay under
+func (rm *Manager) SetTargetMemory(pct float64) {
+	rm.Lock()
+	defer rm.Unlock()
+	rm.targetMemory = pct
+}
+
+// TargetMemory returns the memory usage percentage workers are scaled to stay under
+func (rm *Manager) TargetMemory() float64 {
+	rm.Lock()
+	defer rm.Unlock()
+	return rm.targetMemory
+}
+
 // CurrentWorkers returns the current number of workers
 func (rm *Manager) CurrentWorkers() int {
 	rm.Lock()
@@ -90,6 +145,15 @@ func (rm *Manager) MemoryUsage() float64 {
 	return rm.memUsage
 }
 
+// Headroom returns how many bytes can still be allocated before memory
+// usage reaches the target, as of the last check; it is negative while usage
+// is over the target
+func (rm *Manager) Headroom() int64 {
+	rm.Lock()
+	defer rm.Unlock()
+	return rm.headroom
+}
+
 // ForceGC triggers garbage collection
 func (rm *Manager) ForceGC() {
 	debug.FreeOSMemory()
@@ -105,6 +169,8 @@ func (rm *Manager) adjustResources() {
 	runtime.ReadMemStats(&m)
 	memUsage := float64(m.Alloc) / float64(m.Sys) * 100
 	rm.memUsage = memUsage
+	rm.headroom = int64(float64(m.Sys)*rm.targetMemory/100) - int64(m.Alloc)
+	rm.setPressure(memUsage > rm.targetMemory || memUsage > memoryHighWatermark)
 
 	// If memory usage is too high, force GC and pause processing
 	if memUsage > rm.targetMemory {
@@ -156,32 +222,63 @@ func (rm *Manager) adjustResources() {
 	}
 }
 
-// adjustWorkerCount changes the number of active workers
+// setPressure records whether memory is under pressure and tells the
+// pressure hook when that changes
+func (rm *Manager) setPressure(on bool) {
+	if on == rm.pressure {
+		return
+	}
+	rm.pressure = on
+	if rm.verbose {
+		if on {
+			log.Printf("Memory under pressure (%.1f%%), deferring new Chrome renders", rm.memUsage)
+		} else {
+			log.Printf("Memory pressure relieved (%.1f%%)", rm.memUsage)
+		}
+	}
+	if rm.onPressure != nil {
+		rm.onPressure(on)
+	}
+}
+
+// adjustWorkerCount changes the number of active workers. Callers hold the
+// lock, so the control messages are sent without blocking: when the pool
+// hasn't caught up with earlier ones, only what fits is sent and the count
+// moves that far, leaving the rest to a later adjustment.
 func (rm *Manager) adjustWorkerCount(newCount int) {
 	if newCount == rm.currentWorkers {
 		return
 	}
 
-	delta := newCount - rm.currentWorkers
-	if delta > 0 {
-		// Adding workers
-		for i := 0; i < delta; i++ {
-			rm.workerControl <- 1
+	step := 1
+	if newCount < rm.currentWorkers {
+		step = -1
+	}
+	reached := rm.currentWorkers
+send:
+	for reached != newCount {
+		select {
+		case rm.workerControl <- step:
+			reached += step
+		default:
+			break send
 		}
+	}
+	if reached == rm.currentWorkers {
+		return
+	}
+
+	if step > 0 {
 		if rm.verbose {
-			log.Printf("Scaling up workers from %d to %d", rm.currentWorkers, newCount)
+			log.Printf("Scaling up workers from %d to %d", rm.currentWorkers, reached)
 		}
 	} else {
-		// Removing workers
-		for i := 0; i < -delta; i++ {
-			rm.workerControl <- -1
-		}
 		rm.lastScaleDown = time.Now()
 		if rm.verbose {
-			log.Printf("Scaling down workers from %d to %d", rm.currentWorkers, newCount)
+			log.Printf("Scaling down workers from %d to %d", rm.currentWorkers, reached)
 		}
 	}
-	rm.currentWorkers = newCount
+	rm.currentWorkers = reached
 }
 
 // monitorMemory checks memory usage and takes action if needed
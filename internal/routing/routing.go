@@ -0,0 +1,177 @@
+package routing
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// DefaultFilename is the naming template used when a rule sets none
+const DefaultFilename = "{name}"
+
+// Placeholders a filename template may use
+var placeholders = regexp.MustCompile(`\{[^{}]*\}`)
+
+var knownPlaceholders = map[string]bool{
+	"{name}": true, "{date}": true, "{from}": true, "{subject}": true, "{custodian}": true, "{source}": true,
+}
+
+// Rule directs the outputs of matching messages to their own directory tree.
+// A rule matches when all of its conditions match; a rule without conditions
+// matches every message.
+type Rule struct {
+	Name       string `json:"name"`                  // Label used in messages, e.g. a custodian's name
+	FromDomain string `json:"from_domain,omitempty"` // Sender domain, also matching its subdomains
+	Folder     string `json:"folder,omitempty"`      // Glob matched against the source's folder or a parent, relative to its -src
+	Header     string `json:"header,omitempty"`      // Header that must be present
+	Match      string `json:"match,omitempty"`       // Regular expression the header value must match (default: any value)
+	OutputDir  string `json:"output_dir"`            // Root of the output tree; the source's folders are mirrored beneath it
+	Filename   string `json:"filename,omitempty"`    // Naming template using {name}, {date}, {from}, {subject}, {custodian} and {source}
+
+	match *regexp.Regexp
+}
+
+// Rules is an ordered list of routing rules; the first matching rule wins
+type Rules struct {
+	rules []*Rule
+}
+
+// Load reads routing rules from a JSON file holding an array of rules
+func Load(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing rules: %w", err)
+	}
+
+	var rules []*Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse routing rules %s: %w", path, err)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("routing rules %s define no rules", path)
+	}
+
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("routing rules %s: %s: %w", path, rule.Name, err)
+		}
+	}
+	return &Rules{rules: rules}, nil
+}
+
+// compile checks a rule and prepares its regular expression
+func (r *Rule) compile() error {
+	if r.OutputDir == "" {
+		return fmt.Errorf("output_dir is required")
+	}
+	if r.Match != "" && r.Header == "" {
+		return fmt.Errorf("match requires header")
+	}
+	if r.Filename == "" {
+		r.Filename = DefaultFilename
+	}
+	if err := CheckFilename(r.Filename); err != nil {
+		return err
+	}
+	if r.Folder != "" {
+		if _, err := filepath.Match(r.Folder, ""); err != nil {
+			return fmt.Errorf("invalid folder pattern: %w", err)
+		}
+	}
+	if r.Match != "" {
+		match, err := regexp.Compile(r.Match)
+		if err != nil {
+			return fmt.Errorf("invalid match expression: %w", err)
+		}
+		r.match = match
+	}
+	r.FromDomain = strings.ToLower(strings.TrimPrefix(r.FromDomain, "@"))
+	return nil
+}
+
+// CheckFilename reports an error if a naming template uses an unknown placeholder
+func CheckFilename(template string) error {
+	for _, placeholder := range placeholders.FindAllString(template, -1) {
+		if !knownPlaceholders[placeholder] {
+			return fmt.Errorf("unknown placeholder %s in filename", placeholder)
+		}
+	}
+	return nil
+}
+
+// Find returns the first rule matching a message, or nil if none does.
+// relDir is the folder of the source file relative to the source directory.
+func (r *Rules) Find(relDir string, envelope *enmime.Envelope) *Rule {
+	for _, rule := range r.rules {
+		if rule.matches(relDir, envelope) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// OutputDirs returns the output directory of every rule
+func (r *Rules) OutputDirs() []string {
+	if r == nil {
+		return nil
+	}
+	dirs := make([]string, 0, len(r.rules))
+	for _, rule := range r.rules {
+		dirs = append(dirs, rule.OutputDir)
+	}
+	return dirs
+}
+
+// matches reports whether all of the rule's conditions hold for a message
+func (r *Rule) matches(relDir string, envelope *enmime.Envelope) bool {
+	if r.FromDomain != "" && !domainMatches(senderDomain(envelope), r.FromDomain) {
+		return false
+	}
+	if r.Folder != "" && !folderMatches(relDir, r.Folder) {
+		return false
+	}
+	if r.Header != "" {
+		value := envelope.GetHeader(r.Header)
+		if value == "" {
+			return false
+		}
+		if r.match != nil && !r.match.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// senderDomain returns the lower-cased domain of the first From address
+func senderDomain(envelope *enmime.Envelope) string {
+	addresses, err := envelope.AddressList("From")
+	if err != nil || len(addresses) == 0 {
+		return ""
+	}
+	_, domain, _ := strings.Cut(addresses[0].Address, "@")
+	return strings.ToLower(domain)
+}
+
+// domainMatches reports whether domain is want or one of its subdomains
+func domainMatches(domain, want string) bool {
+	return domain == want || strings.HasSuffix(domain, "."+want)
+}
+
+// folderMatches reports whether the folder or one of its parents matches the glob
+func folderMatches(relDir, pattern string) bool {
+	relDir = filepath.Clean(relDir)
+	for dir := relDir; dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		if matched, _ := filepath.Match(pattern, dir); matched {
+			return true
+		}
+	}
+	return false
+}
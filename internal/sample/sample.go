@@ -0,0 +1,445 @@
+// Package sample generates synthetic EML messages for benchmarks, tests and
+// demos, so the pipeline can be exercised without sharing real mail
+package sample
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math/rand/v2"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Kinds of generated message
+const (
+	KindPlain       = "plain"       // A plain text message
+	KindHTML        = "html"        // A newsletter-style HTML message with styles and tables
+	KindAttachments = "attachments" // A short message with an image, a spreadsheet and a binary file
+	KindInline      = "inline"      // An HTML message showing images embedded by Content-ID
+	KindCalendar    = "calendar"    // A meeting invitation with a text/calendar part
+	KindCharset     = "charset"     // A message in a legacy charset such as KOI8-R or Shift_JIS
+	KindBroken      = "broken"      // Malformed MIME: a missing boundary, bad base64 or garbled headers
+	KindHuge        = "huge"        // A message with an attachment larger than most mail servers accept
+)
+
+// hugeAttachment is the size of the attachment of a huge message
+const hugeAttachment = 25 * 1024 * 1024
+
+// Kinds lists every kind of message, in the order they are generated
+var Kinds = []string{KindPlain, KindHTML, KindAttachments, KindInline, KindCalendar, KindCharset, KindBroken, KindHuge}
+
+// WorkloadKinds are the kinds that make up most real mail, used for benchmarks
+var WorkloadKinds = []string{KindPlain, KindHTML, KindAttachments}
+
+// First message date; each later message is a little newer
+var baseDate = time.Date(2024, time.March, 4, 9, 30, 0, 0, time.UTC)
+
+var people = []string{
+	"Alice Carter <alice.carter@example.com>",
+	"Bruno Silva <bruno.silva@example.org>",
+	"Chen Wei <chen.wei@example.net>",
+	"Dana Okafor <dana.okafor@example.com>",
+	"Elif Yilmaz <elif.yilmaz@example.org>",
+	"Farid Haddad <farid.haddad@example.net>",
+	"Greta Lindqvist <greta.lindqvist@example.com>",
+	"Hiro Tanaka <hiro.tanaka@example.org>",
+}
+
+var words = strings.Fields(`quarterly budget review meeting agenda project timeline
+	customer feedback release schedule contract renewal invoice shipment warehouse
+	forecast revenue margin headcount onboarding training policy compliance audit
+	deadline milestone proposal draft summary approval vendor pricing discount
+	inventory logistics support ticket escalation roadmap priority estimate
+	the a of to and for with on by from as at please attached see below regarding`)
+
+// CheckKinds reports an error if a kind is unknown
+func CheckKinds(kinds []string) error {
+	if len(kinds) == 0 {
+		return fmt.Errorf("no sample kinds given (available: %s)", strings.Join(Kinds, ", "))
+	}
+	for _, kind := range kinds {
+		known := false
+		for _, k := range Kinds {
+			known = known || kind == k
+		}
+		if !known {
+			return fmt.Errorf("unknown sample kind %q (available: %s)", kind, strings.Join(Kinds, ", "))
+		}
+	}
+	return nil
+}
+
+// Generate writes n messages to dir, cycling through kinds, and returns their
+// paths. The same seed always produces the same messages.
+func Generate(dir string, n int, kinds []string, seed uint64) ([]string, error) {
+	if err := CheckKinds(kinds); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create sample directory: %w", err)
+	}
+
+	rng := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+	paths := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		kind := kinds[i%len(kinds)]
+		date := baseDate.Add(time.Duration(i) * 37 * time.Minute)
+		path := filepath.Join(dir, fmt.Sprintf("%05d-%s.eml", i+1, kind))
+		if err := os.WriteFile(path, Message(kind, i, date, rng), 0644); err != nil {
+			return paths, fmt.Errorf("failed to write sample message: %w", err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// Message returns message number i of a kind, sent at date
+func Message(kind string, i int, date time.Time, rng *rand.Rand) []byte {
+	m := &message{rng: rng, index: i, date: date}
+	switch kind {
+	case KindHTML:
+		m.html()
+	case KindAttachments:
+		m.attachments()
+	case KindInline:
+		m.inline()
+	case KindCalendar:
+		m.calendar()
+	case KindCharset:
+		m.charset()
+	case KindBroken:
+		m.broken()
+	case KindHuge:
+		m.huge()
+	default:
+		m.plain()
+	}
+	return m.buf.Bytes()
+}
+
+// message builds one generated message
+type message struct {
+	buf   bytes.Buffer
+	rng   *rand.Rand
+	index int
+	date  time.Time
+}
+
+// headers writes the message headers, ending with the top-level content type
+func (m *message) headers(subject, contentType string) {
+	from := people[m.rng.IntN(len(people))]
+	to := people[m.rng.IntN(len(people))]
+	fmt.Fprintf(&m.buf, "From: %s\r\n", from)
+	fmt.Fprintf(&m.buf, "To: %s\r\n", to)
+	if m.rng.IntN(3) == 0 {
+		fmt.Fprintf(&m.buf, "Cc: %s\r\n", people[m.rng.IntN(len(people))])
+	}
+	fmt.Fprintf(&m.buf, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&m.buf, "Date: %s\r\n", m.date.Format(time.RFC1123Z))
+	fmt.Fprintf(&m.buf, "Message-ID: <sample.%d.%x@example.com>\r\n", m.index, m.rng.Uint64())
+	fmt.Fprintf(&m.buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&m.buf, "Content-Type: %s\r\n", contentType)
+}
+
+// multipart starts a multipart body of the given subtype with a
+// deterministic boundary
+func (m *message) multipart(subject, subtype string) *multipart.Writer {
+	writer := multipart.NewWriter(&m.buf)
+	writer.SetBoundary(fmt.Sprintf("emil-sample-%d-%x", m.index, m.rng.Uint64()))
+	m.headers(subject, fmt.Sprintf("multipart/%s; boundary=%q", subtype, writer.Boundary()))
+	m.buf.WriteString("\r\nThis is a multi-part message in MIME format.\r\n")
+	return writer
+}
+
+func (m *message) plain() {
+	m.headers(m.subject(), "text/plain; charset=UTF-8")
+	m.buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	writeQuotedPrintable(&m.buf, m.paragraphs(3+m.rng.IntN(5)))
+}
+
+func (m *message) html() {
+	writer := m.multipart(m.subject(), "alternative")
+	text := m.paragraphs(6 + m.rng.IntN(10))
+	writeTextPart(writer, "text/plain; charset=UTF-8", text)
+
+	var html strings.Builder
+	html.WriteString(`<!DOCTYPE html><html><head><style>
+body { font-family: Georgia, serif; background: #f4f4f4; }
+.wrapper { max-width: 640px; margin: 0 auto; background: #fff; padding: 24px; }
+h1 { color: #1a4b7a; } td { padding: 6px 10px; border-bottom: 1px solid #ddd; }
+.button { background: #1a4b7a; color: #fff; padding: 10px 18px; text-decoration: none; }
+</style></head><body><div class="wrapper">`)
+	fmt.Fprintf(&html, "<h1>%s</h1>", m.sentence(5))
+	for _, paragraph := range strings.Split(text, "\r\n\r\n") {
+		fmt.Fprintf(&html, "<p>%s</p>", paragraph)
+	}
+	html.WriteString(`<table width="100%" cellspacing="0"><tr><th align="left">Item</th><th align="right">Quantity</th><th align="right">Amount</th></tr>`)
+	for row := 0; row < 20+m.rng.IntN(30); row++ {
+		fmt.Fprintf(&html, `<tr><td>%s</td><td align="right">%d</td><td align="right">%d.%02d</td></tr>`,
+			m.sentence(3), 1+m.rng.IntN(50), m.rng.IntN(5000), m.rng.IntN(100))
+	}
+	html.WriteString(`</table><blockquote style="border-left: 3px solid #ccc; padding-left: 10px;">`)
+	html.WriteString(m.sentence(20))
+	html.WriteString(`</blockquote><p><a class="button" href="https://example.com/newsletter">Read more</a></p></div></body></html>`)
+	writeTextPart(writer, "text/html; charset=UTF-8", html.String())
+	writer.Close()
+}
+
+func (m *message) attachments() {
+	writer := m.multipart(m.subject(), "mixed")
+	writeTextPart(writer, "text/plain; charset=UTF-8", m.paragraphs(2))
+
+	writeAttachment(writer, "image/png", fmt.Sprintf("chart-%d.png", m.index), m.image(400+m.rng.IntN(400), 300+m.rng.IntN(300)))
+
+	var csv bytes.Buffer
+	csv.WriteString("date,item,quantity,amount\r\n")
+	for row := 0; row < 200+m.rng.IntN(2000); row++ {
+		fmt.Fprintf(&csv, "%s,%s,%d,%d.%02d\r\n", m.date.AddDate(0, 0, -row).Format("2006-01-02"),
+			words[m.rng.IntN(len(words))], m.rng.IntN(100), m.rng.IntN(10000), m.rng.IntN(100))
+	}
+	writeAttachment(writer, "text/csv", fmt.Sprintf("export-%d.csv", m.index), csv.Bytes())
+
+	blob := make([]byte, 64*1024+m.rng.IntN(512*1024))
+	for i := range blob {
+		blob[i] = byte(m.rng.Uint32())
+	}
+	writeAttachment(writer, "application/octet-stream", fmt.Sprintf("archive-%d.bin", m.index), blob)
+	writer.Close()
+}
+
+func (m *message) inline() {
+	writer := m.multipart(m.subject(), `related; type="text/html"`)
+
+	images := 1 + m.rng.IntN(3)
+	var html strings.Builder
+	html.WriteString("<html><body>")
+	fmt.Fprintf(&html, "<p>%s</p>", m.paragraphs(1))
+	for i := 1; i <= images; i++ {
+		fmt.Fprintf(&html, `<p><img src="cid:image%d.%d@example.com" alt="Figure %d"></p><p>%s</p>`, i, m.index, i, m.sentence(12))
+	}
+	html.WriteString("</body></html>")
+	writeTextPart(writer, "text/html; charset=UTF-8", html.String())
+
+	for i := 1; i <= images; i++ {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", "image/png")
+		header.Set("Content-ID", fmt.Sprintf("<image%d.%d@example.com>", i, m.index))
+		header.Set("Content-Disposition", fmt.Sprintf("inline; filename=\"figure%d.png\"", i))
+		header.Set("Content-Transfer-Encoding", "base64")
+		part, _ := writer.CreatePart(header)
+		writeBase64(part, m.image(200+m.rng.IntN(300), 120+m.rng.IntN(200)))
+	}
+	writer.Close()
+}
+
+func (m *message) calendar() {
+	subject := "Invitation: " + m.sentence(4)
+	writer := m.multipart(subject, "alternative")
+
+	start := m.date.AddDate(0, 0, 1+m.rng.IntN(14)).Truncate(time.Hour)
+	end := start.Add(time.Duration(1+m.rng.IntN(3)) * 30 * time.Minute)
+	organizer := people[m.rng.IntN(len(people))]
+	attendee := people[m.rng.IntN(len(people))]
+	when := start.Format("Monday, January 2, 2006 15:04") + " - " + end.Format("15:04 MST")
+	writeTextPart(writer, "text/plain; charset=UTF-8", fmt.Sprintf("%s\r\n\r\nWhen: %s\r\nWhere: Room %d\r\n", subject, when, 100+m.rng.IntN(400)))
+	writeTextPart(writer, "text/html; charset=UTF-8", fmt.Sprintf("<html><body><h2>%s</h2><p><b>When:</b> %s</p><p>%s</p></body></html>", subject, when, m.sentence(15)))
+
+	const stamp = "20060102T150405Z"
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"PRODID:-//emil//sample//EN",
+		"VERSION:2.0",
+		"METHOD:REQUEST",
+		"BEGIN:VEVENT",
+		fmt.Sprintf("UID:sample-%d-%x@example.com", m.index, m.rng.Uint64()),
+		"DTSTAMP:" + m.date.UTC().Format(stamp),
+		"DTSTART:" + start.UTC().Format(stamp),
+		"DTEND:" + end.UTC().Format(stamp),
+		"SUMMARY:" + subject,
+		fmt.Sprintf("LOCATION:Room %d", 100+m.rng.IntN(400)),
+		"ORGANIZER;CN=" + addressName(organizer) + ":mailto:" + addressEmail(organizer),
+		"ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE:mailto:" + addressEmail(attendee),
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	writeTextPart(writer, "text/calendar; charset=UTF-8; method=REQUEST", ics)
+	writer.Close()
+}
+
+// Text in legacy charsets, with a subject encoded in the same charset
+var charsetSamples = []struct {
+	charset, subject, body string
+}{
+	{"koi8-r", "=?koi8-r?B?69fB0tTBzNjO2cogz9Teo9Q=?=", "\xef\xd4\xde\xa3\xd4 \xda\xc1 \xcb\xd7\xc1\xd2\xd4\xc1\xcc \xc7\xcf\xd4\xcf\xd7. \xf0\xcf\xd6\xc1\xcc\xd5\xca\xd3\xd4\xc1, \xd0\xd2\xcf\xd7\xc5\xd2\xd8\xd4\xc5 \xc3\xc9\xc6\xd2\xd9 \xc4\xcf \xd0\xd1\xd4\xce\xc9\xc3\xd9."},
+	{"shift_jis", "=?shift_jis?B?jmyUvIr6lfGNkA==?=", "\x8el\x94\xbc\x8a\xfa\x95\xf1\x8d\x90\x8f\x91\x82\xf0\x93Y\x95t\x82\xb5\x82\xdc\x82\xb7\x81B\x8b\xe0\x97j\x93\xfa\x82\xdc\x82\xc5\x82\xc9\x82\xb2\x8am\x94F\x82\xad\x82\xbe\x82\xb3\x82\xa2\x81B"},
+	{"iso-8859-1", "=?iso-8859-1?B?R3L832UgYXVzIE38bmNoZW4=?=", "Gr\xfc\xdfe aus M\xfcnchen! Die Pr\xe4sentation f\xfcr das Treffen ist fertig, \xe0 bient\xf4t."},
+	{"windows-1252", "=?windows-1252?B?k1F1YXJ0ZXJseZQgliCA?=", "\x93Quarterly\x94 figures are in \x96 total \x8012,500 \x85 please review."},
+}
+
+func (m *message) charset() {
+	sample := charsetSamples[m.rng.IntN(len(charsetSamples))]
+	m.headers(sample.subject, "text/plain; charset="+sample.charset)
+	m.buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	paragraphs := 1 + m.rng.IntN(4)
+	for i := 0; i < paragraphs; i++ {
+		m.buf.WriteString(sample.body + "\r\n\r\n")
+	}
+}
+
+// broken writes one of several kinds of malformed message, as found in old
+// archives and exports from buggy clients
+func (m *message) broken() {
+	switch m.rng.IntN(4) {
+	case 0:
+		// Truncated: the closing boundary and part of the attachment are missing
+		writer := m.multipart(m.subject(), "mixed")
+		writeTextPart(writer, "text/plain; charset=UTF-8", m.paragraphs(2))
+		writeAttachment(writer, "image/png", "truncated.png", m.image(200, 150))
+		m.buf.Truncate(m.buf.Len() - 200)
+	case 1:
+		// The declared boundary never appears in the body
+		m.headers(m.subject(), `multipart/mixed; boundary="declared-but-missing"`)
+		m.buf.WriteString("\r\n--another-boundary\r\nContent-Type: text/plain\r\n\r\n")
+		m.buf.WriteString(m.paragraphs(2) + "\r\n--another-boundary--\r\n")
+	case 2:
+		// An attachment whose base64 is corrupt
+		writer := m.multipart(m.subject(), "mixed")
+		writeTextPart(writer, "text/plain; charset=UTF-8", m.paragraphs(1))
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", `application/pdf; name="corrupt.pdf"`)
+		header.Set("Content-Disposition", `attachment; filename="corrupt.pdf"`)
+		header.Set("Content-Transfer-Encoding", "base64")
+		part, _ := writer.CreatePart(header)
+		io.WriteString(part, "JVBERi0xLjQK!!not*base64@@\r\n%%%%\r\n")
+		writer.Close()
+	default:
+		// Garbled headers: an unparseable date, a line without a colon and an
+		// unknown charset
+		fmt.Fprintf(&m.buf, "From: %s\r\n", people[m.rng.IntN(len(people))])
+		fmt.Fprintf(&m.buf, "To: undisclosed-recipients:;\r\n")
+		fmt.Fprintf(&m.buf, "Subject: %s\r\n", m.subject())
+		fmt.Fprintf(&m.buf, "Date: sometime last %s\r\n", m.date.Weekday())
+		fmt.Fprintf(&m.buf, "this line is not a header\r\n")
+		fmt.Fprintf(&m.buf, "Content-Type: text/plain; charset=x-unknown-charset\r\n\r\n")
+		m.buf.WriteString(m.paragraphs(2) + "\r\n")
+	}
+}
+
+func (m *message) huge() {
+	writer := m.multipart(m.subject(), "mixed")
+	writeTextPart(writer, "text/plain; charset=UTF-8", m.paragraphs(1))
+	blob := make([]byte, hugeAttachment)
+	for i := 0; i < len(blob); i += 8 {
+		binary.LittleEndian.PutUint64(blob[i:], m.rng.Uint64())
+	}
+	writeAttachment(writer, "application/zip", fmt.Sprintf("backup-%d.zip", m.index), blob)
+	writer.Close()
+}
+
+// addressName returns the display name of an address like "Name <email>"
+func addressName(address string) string {
+	name, _, _ := strings.Cut(address, " <")
+	return name
+}
+
+// addressEmail returns the email of an address like "Name <email>"
+func addressEmail(address string) string {
+	_, email, _ := strings.Cut(address, "<")
+	return strings.TrimSuffix(email, ">")
+}
+
+// subject returns a subject line of a few words
+func (m *message) subject() string {
+	return m.sentence(3 + m.rng.IntN(5))
+}
+
+// sentence returns n random words with the first capitalized
+func (m *message) sentence(n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		parts[i] = words[m.rng.IntN(len(words))]
+	}
+	return strings.ToUpper(parts[0][:1]) + strings.Join(parts, " ")[1:]
+}
+
+// paragraphs returns n paragraphs of filler text separated by blank lines
+func (m *message) paragraphs(n int) string {
+	parts := make([]string, n)
+	for i := range parts {
+		var sentences []string
+		for j := 0; j < 2+m.rng.IntN(5); j++ {
+			sentences = append(sentences, m.sentence(6+m.rng.IntN(12))+".")
+		}
+		parts[i] = strings.Join(sentences, " ")
+	}
+	return strings.Join(parts, "\r\n\r\n")
+}
+
+// image returns a PNG gradient with a few random bars, like a small chart
+func (m *message) image(width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / width), uint8(y * 255 / height), 160, 255})
+		}
+	}
+	bars := 5 + m.rng.IntN(6)
+	for bar := 0; bar < bars; bar++ {
+		top := height - 1 - m.rng.IntN(height*3/4)
+		for x := bar * width / bars; x < (bar+1)*width/bars-4; x++ {
+			for y := top; y < height; y++ {
+				img.Set(x, y, color.RGBA{30, 60, 120, 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// writeTextPart adds a quoted-printable text part
+func writeTextPart(writer *multipart.Writer, contentType, text string) {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	part, _ := writer.CreatePart(header)
+	writeQuotedPrintable(part, text)
+}
+
+// writeAttachment adds a base64 attachment
+func writeAttachment(writer *multipart.Writer, contentType, filename string, content []byte) {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", fmt.Sprintf("%s; name=%q", contentType, filename))
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	header.Set("Content-Transfer-Encoding", "base64")
+	part, _ := writer.CreatePart(header)
+	writeBase64(part, content)
+}
+
+func writeQuotedPrintable(w io.Writer, text string) {
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(text))
+	qp.Close()
+	io.WriteString(w, "\r\n")
+}
+
+// writeBase64 writes content as base64 in 76-character lines
+func writeBase64(w io.Writer, content []byte) {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		io.WriteString(w, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(w, encoded+"\r\n")
+}
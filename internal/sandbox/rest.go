@@ -0,0 +1,306 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"emil/internal/models"
+)
+
+// How long one request to the sandbox may take, uploads included
+const requestTimeout = 5 * time.Minute
+
+// Most bytes of an error response quoted in the error
+const maxErrorBody = 512
+
+// restClient makes the JSON requests of a sandbox API
+type restClient struct {
+	base   string // Base URL, without a trailing slash
+	token  string
+	scheme string // Authorization scheme the token is sent with
+	client *http.Client
+}
+
+// newRESTClient returns a client for the API at base, authenticating with
+// token as a bearer token
+func newRESTClient(base, token string) *restClient {
+	return &restClient{
+		base:   strings.TrimSuffix(base, "/"),
+		token:  token,
+		scheme: "Bearer",
+		client: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// get fetches path and decodes its JSON response into out
+func (a *restClient) get(ctx context.Context, path string, out any) error {
+	return a.do(ctx, http.MethodGet, path, nil, "", out)
+}
+
+// postJSON posts body as JSON to path and decodes the response into out
+func (a *restClient) postJSON(ctx context.Context, path string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return a.do(ctx, http.MethodPost, path, bytes.NewReader(data), "application/json", out)
+}
+
+// upload posts a sample's file as the multipart field "file", with the
+// given form fields, and decodes the response into out. The file is
+// streamed from disk rather than read into memory.
+func (a *restClient) upload(ctx context.Context, path string, sample Sample, fields map[string]string, out any) error {
+	file, err := os.Open(sample.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s for the sandbox: %w", sample.Filename, err)
+	}
+	defer file.Close()
+
+	body, w := io.Pipe()
+	form := multipart.NewWriter(w)
+	go func() {
+		for name, value := range fields {
+			if err := form.WriteField(name, value); err != nil {
+				w.CloseWithError(err)
+				return
+			}
+		}
+		part, err := form.CreateFormFile("file", sample.Filename)
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		w.CloseWithError(err)
+	}()
+	err = a.do(ctx, http.MethodPost, path, body, form.FormDataContentType(), out)
+	body.Close()
+	return err
+}
+
+// do makes a request and decodes its JSON response into out
+func (a *restClient) do(ctx context.Context, method, path string, body io.Reader, contentType string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, a.base+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", a.scheme+" "+a.token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sandbox request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("sandbox returned %s for %s: %s", resp.Status, path, strings.TrimSpace(string(text)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode sandbox response for %s: %w", path, err)
+	}
+	return nil
+}
+
+// signature is a behaviour a Cuckoo or CAPE analysis matched
+type signature struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// signatureNames returns the descriptions of the signatures matched, or
+// their names where they have none
+func signatureNames(signatures []signature) []string {
+	var names []string
+	for _, sig := range signatures {
+		if sig.Description != "" {
+			names = append(names, sig.Description)
+		} else if sig.Name != "" {
+			names = append(names, sig.Name)
+		}
+	}
+	return names
+}
+
+// failedStatus reports whether a Cuckoo or CAPE task status means the
+// analysis failed, e.g. failed_analysis or failed_processing
+func failedStatus(status string) bool {
+	return strings.HasPrefix(status, "failed")
+}
+
+// cuckoo speaks Cuckoo Sandbox's REST API
+type cuckoo struct {
+	api *restClient
+}
+
+func (c *cuckoo) Submit(ctx context.Context, sample Sample) (string, *models.SandboxVerdict, error) {
+	var created struct {
+		TaskID int `json:"task_id"`
+	}
+	if err := c.api.upload(ctx, "/tasks/create/file", sample, nil, &created); err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprint(created.TaskID), nil, nil
+}
+
+func (c *cuckoo) Result(ctx context.Context, task string) (*models.SandboxVerdict, error) {
+	var view struct {
+		Task struct {
+			Status string `json:"status"`
+		} `json:"task"`
+	}
+	if err := c.api.get(ctx, "/tasks/view/"+task, &view); err != nil {
+		return nil, err
+	}
+	switch status := view.Task.Status; {
+	case failedStatus(status):
+		return &models.SandboxVerdict{Verdict: VerdictError, Error: "analysis " + status}, nil
+	case status != "reported":
+		return nil, nil
+	}
+
+	var report struct {
+		Info struct {
+			Score float64 `json:"score"`
+		} `json:"info"`
+		Signatures []signature `json:"signatures"`
+	}
+	if err := c.api.get(ctx, "/tasks/report/"+task, &report); err != nil {
+		return nil, err
+	}
+	return &models.SandboxVerdict{
+		Verdict:    scoreVerdict(report.Info.Score),
+		Score:      report.Info.Score,
+		Signatures: signatureNames(report.Signatures),
+	}, nil
+}
+
+// cape speaks CAPEv2's REST API
+type cape struct {
+	api *restClient
+}
+
+// capeResponse wraps the data of every CAPEv2 response
+type capeResponse[T any] struct {
+	Error   bool   `json:"error"`
+	Message string `json:"error_value"`
+	Data    T      `json:"data"`
+}
+
+func (c *cape) Submit(ctx context.Context, sample Sample) (string, *models.SandboxVerdict, error) {
+	var created capeResponse[struct {
+		TaskIDs []int `json:"task_ids"`
+	}]
+	if err := c.api.upload(ctx, "/apiv2/tasks/create/file/", sample, nil, &created); err != nil {
+		return "", nil, err
+	}
+	if created.Error || len(created.Data.TaskIDs) == 0 {
+		return "", nil, fmt.Errorf("sandbox refused %s: %s", sample.Filename, created.Message)
+	}
+	return fmt.Sprint(created.Data.TaskIDs[0]), nil, nil
+}
+
+func (c *cape) Result(ctx context.Context, task string) (*models.SandboxVerdict, error) {
+	var status capeResponse[string]
+	if err := c.api.get(ctx, "/apiv2/tasks/status/"+task+"/", &status); err != nil {
+		return nil, err
+	}
+	switch {
+	case status.Error:
+		return nil, fmt.Errorf("sandbox status for task %s: %s", task, status.Message)
+	case failedStatus(status.Data):
+		return &models.SandboxVerdict{Verdict: VerdictError, Error: "analysis " + status.Data}, nil
+	case status.Data != "reported":
+		return nil, nil
+	}
+
+	var report struct {
+		MalScore   float64     `json:"malscore"`
+		Signatures []signature `json:"signatures"`
+	}
+	if err := c.api.get(ctx, "/apiv2/tasks/get/report/"+task+"/", &report); err != nil {
+		return nil, err
+	}
+	return &models.SandboxVerdict{
+		Verdict:    scoreVerdict(report.MalScore),
+		Score:      report.MalScore,
+		Signatures: signatureNames(report.Signatures),
+		Link:       c.api.base + "/analysis/" + task + "/",
+	}, nil
+}
+
+// generic speaks emil's own sandbox protocol, which adapters to vendor
+// sandboxes implement:
+//
+//	POST {url}/submit   JSON {"sha256", "filename", "size"}, or the same as
+//	                    multipart form fields with the attachment as "file"
+//	GET  {url}/result/{task}
+//
+// Both answer with a genericResult: the task to poll, or the verdict once
+// there is one.
+type generic struct {
+	api   *restClient
+	files bool // Upload attachments rather than only their hashes
+}
+
+// genericResult is the answer to the generic protocol's requests
+type genericResult struct {
+	Task       string   `json:"task"`
+	Verdict    string   `json:"verdict"` // malicious, suspicious, clean or error (empty = still being analyzed)
+	Score      float64  `json:"score"`
+	Signatures []string `json:"signatures"`
+	Link       string   `json:"link"`
+	Error      string   `json:"error"`
+}
+
+// verdict returns the result's verdict, or nil if there is none yet
+func (r genericResult) verdict() *models.SandboxVerdict {
+	if r.Verdict == "" {
+		return nil
+	}
+	return &models.SandboxVerdict{Verdict: r.Verdict, Score: r.Score, Signatures: r.Signatures, Link: r.Link, Error: r.Error}
+}
+
+func (g *generic) Submit(ctx context.Context, sample Sample) (string, *models.SandboxVerdict, error) {
+	var result genericResult
+	var err error
+	if g.files {
+		fields := map[string]string{"sha256": sample.SHA256, "filename": sample.Filename, "size": fmt.Sprint(sample.Size)}
+		err = g.api.upload(ctx, "/submit", sample, fields, &result)
+	} else {
+		err = g.api.postJSON(ctx, "/submit", map[string]any{"sha256": sample.SHA256, "filename": sample.Filename, "size": sample.Size}, &result)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if verdict := result.verdict(); verdict != nil {
+		return result.Task, verdict, nil
+	}
+	if result.Task == "" {
+		return "", nil, fmt.Errorf("sandbox gave neither a task nor a verdict for %s", sample.Filename)
+	}
+	return result.Task, nil, nil
+}
+
+func (g *generic) Result(ctx context.Context, task string) (*models.SandboxVerdict, error) {
+	var result genericResult
+	if err := g.api.get(ctx, "/result/"+url.PathEscape(task), &result); err != nil {
+		return nil, err
+	}
+	return result.verdict(), nil
+}
@@ -0,0 +1,332 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"emil/internal/models"
+)
+
+// APIs the sandbox client speaks
+const (
+	APICuckoo = "cuckoo" // Cuckoo Sandbox's REST API
+	APICAPE   = "cape"   // CAPEv2's REST API
+	APIHTTP   = "http"   // emil's own JSON protocol, for adapters to vendor sandboxes
+)
+
+// What is sent to the sandbox for each attachment
+const (
+	SubmitHash = "hash" // Only the SHA-256, for sandboxes that look up known samples
+	SubmitFile = "file" // The attachment itself
+)
+
+// Verdicts on an attachment
+const (
+	VerdictMalicious  = "malicious"
+	VerdictSuspicious = "suspicious"
+	VerdictClean      = "clean"
+	VerdictPending    = "pending" // No verdict came before the run stopped waiting
+	VerdictError      = "error"   // The sandbox couldn't analyze the attachment
+)
+
+// Scores, out of 10 as Cuckoo and CAPE give them, from which an attachment
+// is suspicious or malicious
+const (
+	suspiciousScore = 4
+	maliciousScore  = 7
+)
+
+const (
+	maxUploads   = 4                // Submissions to the sandbox at once
+	pollInterval = 15 * time.Second // How often outstanding tasks are checked
+)
+
+// DefaultTypes are the attachment extensions submitted when none are
+// configured: executables, scripts, macro documents and the archives and
+// disk images they are smuggled in
+var DefaultTypes = []string{
+	".exe", ".dll", ".scr", ".com", ".bat", ".cmd", ".ps1", ".vbs", ".js", ".jse", ".wsf", ".hta", ".lnk", ".jar", ".msi",
+	".doc", ".docm", ".xls", ".xlsm", ".ppt", ".pptm", ".rtf", ".pdf",
+	".zip", ".rar", ".7z", ".iso", ".img",
+}
+
+// Sample is an attachment handed to the sandbox
+type Sample struct {
+	SHA256   string
+	Filename string
+	Path     string // Where the attachment was saved
+	Size     int64
+}
+
+// Provider submits samples to a sandbox and fetches its verdicts
+type Provider interface {
+	// Submit hands a sample to the sandbox and returns the task to poll for
+	// its verdict, or the verdict itself when the sandbox already has one
+	Submit(ctx context.Context, sample Sample) (string, *models.SandboxVerdict, error)
+
+	// Result returns a task's verdict, or nil while it is being analyzed
+	Result(ctx context.Context, task string) (*models.SandboxVerdict, error)
+}
+
+// Options configure a sandbox client
+type Options struct {
+	URL    string   // Base URL of the sandbox's API
+	API    string   // APICuckoo, APICAPE or APIHTTP (empty = cuckoo)
+	Submit string   // SubmitHash or SubmitFile (empty = hash)
+	Token  string   // API token (empty = none)
+	Types  []string // Attachment extensions submitted (empty = DefaultTypes)
+}
+
+// NewProvider returns the provider for the API the options name
+func NewProvider(opts Options) (Provider, error) {
+	base, err := url.Parse(opts.URL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid sandbox URL %q (use http:// or https://)", opts.URL)
+	}
+	submit := opts.Submit
+	if submit == "" {
+		submit = SubmitHash
+	}
+	if submit != SubmitHash && submit != SubmitFile {
+		return nil, fmt.Errorf("invalid sandbox submission %q (use %s or %s)", submit, SubmitHash, SubmitFile)
+	}
+
+	name := opts.API
+	if name == "" {
+		name = APICuckoo
+	}
+	api := newRESTClient(opts.URL, opts.Token)
+	switch name {
+	case APICuckoo, APICAPE:
+		// Uploading attachments to a sandbox has to be asked for explicitly
+		if submit != SubmitFile {
+			return nil, fmt.Errorf("the %s API analyzes files, not hashes; submitting attachments has to be enabled with -sandbox-submit %s", name, SubmitFile)
+		}
+		if name == APICAPE {
+			api.scheme = "Token"
+			return &cape{api: api}, nil
+		}
+		return &cuckoo{api: api}, nil
+	case APIHTTP:
+		return &generic{api: api, files: submit == SubmitFile}, nil
+	}
+	return nil, fmt.Errorf("invalid sandbox API %q (use %s, %s or %s)", opts.API, APICuckoo, APICAPE, APIHTTP)
+}
+
+// CheckOptions validates sandbox options without connecting to the sandbox
+func CheckOptions(opts Options) error {
+	_, err := NewProvider(opts)
+	return err
+}
+
+// New returns a client submitting attachments to the sandbox the options
+// describe
+func New(opts Options) (*Client, error) {
+	provider, err := NewProvider(opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(provider, opts.Types), nil
+}
+
+// scoreVerdict turns a score out of 10 into a verdict
+func scoreVerdict(score float64) string {
+	switch {
+	case score >= maliciousScore:
+		return VerdictMalicious
+	case score >= suspiciousScore:
+		return VerdictSuspicious
+	}
+	return VerdictClean
+}
+
+// Client submits a run's attachments to a sandbox in the background, once
+// per distinct content, and collects the verdicts for the report
+type Client struct {
+	provider Provider
+	types    []string
+	uploads  chan struct{} // One entry per submission in flight
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup // Submissions and the poller
+
+	mu      sync.Mutex
+	samples map[string]*sample // By SHA-256
+	order   []*sample
+}
+
+// sample is a submitted attachment and the messages it came in
+type sample struct {
+	Sample
+	files   []string
+	task    string
+	verdict *models.SandboxVerdict
+	err     error // Last error submitting or polling
+}
+
+// NewClient returns a client submitting attachments of the given types
+// (empty = DefaultTypes) to a provider
+func NewClient(provider Provider, types []string) *Client {
+	if len(types) == 0 {
+		types = DefaultTypes
+	}
+	c := &Client{
+		provider: provider,
+		uploads:  make(chan struct{}, maxUploads),
+		samples:  make(map[string]*sample),
+	}
+	for _, ext := range types {
+		if ext = strings.ToLower(strings.TrimSpace(ext)); ext != "" {
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			c.types = append(c.types, ext)
+		}
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.wg.Add(1)
+	go c.poll()
+	return c
+}
+
+// Selects reports whether an attachment with this name is submitted
+func (c *Client) Selects(filename string) bool {
+	return slices.Contains(c.types, strings.ToLower(filepath.Ext(filename)))
+}
+
+// Submit queues an attachment of a message for the sandbox without waiting.
+// An attachment already submitted in this run isn't submitted again; its
+// verdict is reported for each message carrying it.
+func (c *Client) Submit(emlPath string, s Sample) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ctx.Err() != nil {
+		return // Finished
+	}
+	if existing := c.samples[s.SHA256]; existing != nil {
+		if !slices.Contains(existing.files, emlPath) {
+			existing.files = append(existing.files, emlPath)
+		}
+		return
+	}
+	e := &sample{Sample: s, files: []string{emlPath}}
+	c.samples[s.SHA256] = e
+	c.order = append(c.order, e)
+
+	c.wg.Add(1)
+	go c.submit(e)
+}
+
+// submit hands a sample to the sandbox, a few at a time
+func (c *Client) submit(e *sample) {
+	defer c.wg.Done()
+	select {
+	case c.uploads <- struct{}{}:
+	case <-c.ctx.Done():
+		return
+	}
+	defer func() { <-c.uploads }()
+
+	task, verdict, err := c.provider.Submit(c.ctx, e.Sample)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case err != nil && c.ctx.Err() != nil:
+		// The run stopped waiting; reported as pending
+	case err != nil:
+		e.err = err
+		e.verdict = &models.SandboxVerdict{Verdict: VerdictError, Error: err.Error()}
+	default:
+		e.task, e.verdict = task, verdict
+	}
+}
+
+// poll checks the tasks awaiting a verdict until the client is finished
+func (c *Client) poll() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, e := range c.outstanding() {
+			verdict, err := c.provider.Result(c.ctx, e.task)
+			c.mu.Lock()
+			if err != nil {
+				e.err = err // Kept trying until the run stops waiting
+			} else if verdict != nil {
+				e.verdict = verdict
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// outstanding returns the submitted samples still awaiting a verdict
+func (c *Client) outstanding() []*sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var waiting []*sample
+	for _, e := range c.order {
+		if e.task != "" && e.verdict == nil {
+			waiting = append(waiting, e)
+		}
+	}
+	return waiting
+}
+
+// Pending returns the number of attachments without a verdict yet
+func (c *Client) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pending := 0
+	for _, e := range c.order {
+		if e.verdict == nil {
+			pending++
+		}
+	}
+	return pending
+}
+
+// Finish waits up to wait for the outstanding verdicts, stops submitting
+// and polling, and returns the verdicts by the path of each message the
+// attachments came in. Attachments still without one are reported as
+// pending, with the task to look them up by.
+func (c *Client) Finish(wait time.Duration) map[string][]models.SandboxVerdict {
+	deadline := time.Now().Add(wait)
+	for c.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Second)
+	}
+	c.cancel()
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	verdicts := make(map[string][]models.SandboxVerdict)
+	for _, e := range c.order {
+		verdict := models.SandboxVerdict{Verdict: VerdictPending}
+		if e.verdict != nil {
+			verdict = *e.verdict
+		} else if e.err != nil {
+			verdict.Error = e.err.Error()
+		}
+		verdict.SHA256 = e.SHA256
+		verdict.Attachment = e.Filename
+		verdict.Task = e.task
+		for _, file := range e.files {
+			verdicts[file] = append(verdicts[file], verdict)
+		}
+	}
+	return verdicts
+}
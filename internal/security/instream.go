@@ -0,0 +1,130 @@
+package security
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// How long connecting to clamd may take
+	clamdDialTimeout = 2 * time.Second
+
+	// How long one scan may take, streaming included, before clamd is
+	// given up on
+	clamdScanTimeout = 2 * time.Minute
+)
+
+// clamdURL returns a clamd address in the form go-clamd expects: host:port
+// becomes a tcp:// URL, while URLs and socket paths are left as they are
+func clamdURL(address string) string {
+	if strings.Contains(address, "://") || strings.HasPrefix(address, "/") {
+		return address
+	}
+	return "tcp://" + address
+}
+
+// dialClamd connects to a clamd address as returned by clamdURL
+func dialClamd(address string) (net.Conn, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clamd address %q: %w", address, err)
+	}
+	switch u.Scheme {
+	case "tcp":
+		return net.DialTimeout("tcp", u.Host, clamdDialTimeout)
+	case "unix":
+		return net.DialTimeout("unix", u.Path, clamdDialTimeout)
+	default:
+		return net.DialTimeout("unix", address, clamdDialTimeout)
+	}
+}
+
+// instream scans r with clamd's INSTREAM command, sending it in chunks of
+// chunkSize bytes read straight from r, so a large attachment is never held
+// in memory. It returns the threats found and the bytes sent.
+func instream(address string, r io.Reader, chunkSize int) ([]string, int64, error) {
+	conn, err := dialClamd(address)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(clamdScanTimeout))
+
+	w := bufio.NewWriterSize(conn, chunkSize+4)
+	if _, err := w.WriteString("nINSTREAM\n"); err != nil {
+		return nil, 0, err
+	}
+
+	var sent int64
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := w.Write(buf[:4+n]); err != nil {
+				return nil, sent, streamFailed(conn, sent, err)
+			}
+			sent += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return nil, sent, readErr
+		}
+	}
+
+	// A zero-length chunk ends the stream
+	binary.BigEndian.PutUint32(buf[:4], 0)
+	if _, err := w.Write(buf[:4]); err != nil {
+		return nil, sent, streamFailed(conn, sent, err)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, sent, streamFailed(conn, sent, err)
+	}
+
+	var threats []string
+	replied := false
+	replies := bufio.NewScanner(conn)
+	for replies.Scan() {
+		replied = true
+		reply := strings.TrimPrefix(strings.TrimSpace(replies.Text()), "stream: ")
+		switch {
+		case strings.HasSuffix(reply, " FOUND"):
+			threats = append(threats, strings.TrimSuffix(reply, " FOUND")+": FOUND")
+		case strings.Contains(reply, "size limit exceeded"):
+			return nil, sent, errStreamLimit(sent)
+		case strings.HasSuffix(reply, " ERROR"):
+			return nil, sent, fmt.Errorf("clamd: %s", strings.TrimSuffix(reply, " ERROR"))
+		}
+	}
+	if err := replies.Err(); err != nil {
+		return nil, sent, fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	if !replied {
+		return nil, sent, fmt.Errorf("clamd closed the connection without a reply")
+	}
+	return threats, sent, nil
+}
+
+// streamFailed explains a failed write to clamd. clamd closes the
+// connection on a stream over its StreamMaxLength, after saying so.
+func streamFailed(conn net.Conn, sent int64, err error) error {
+	conn.SetReadDeadline(time.Now().Add(clamdDialTimeout))
+	if reply, _ := bufio.NewReader(conn).ReadString('\n'); strings.Contains(reply, "size limit exceeded") {
+		return errStreamLimit(sent)
+	}
+	return fmt.Errorf("failed to stream to clamd: %w", err)
+}
+
+// errStreamLimit is the error for a file over clamd's StreamMaxLength, which
+// can't be scanned at all rather than being clean
+func errStreamLimit(sent int64) error {
+	return fmt.Errorf("clamd refused the stream after %d bytes; raise StreamMaxLength in clamd.conf", sent)
+}
@@ -6,14 +6,48 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
+	"time"
 
 	clamd "github.com/dutchcoders/go-clamd"
+
+	"emil/internal/models"
 )
 
-// Scanner provides virus scanning capabilities
+// Scanner provides virus scanning capabilities. Scans are streamed to one
+// or more clamd instances, several at once to each.
 type Scanner struct {
-	enabled bool
-	client  *clamd.Clamd
+	enabled   bool
+	client    *clamd.Clamd
+	instances []string         // clamd addresses, as URLs
+	streams   chan string      // One entry per free stream, holding its instance's address
+	chunkSize int              // Bytes sent in each INSTREAM chunk
+	onScan    func(ScanTiming) // Called after each scan (nil = none)
+
+	statsMu sync.Mutex
+	stats   models.ScanSummary
+}
+
+// ScanOptions sets how much scanning clamd is given at once
+type ScanOptions struct {
+	Streams   int // Scans streamed to each clamd instance at once (0 = 4)
+	ChunkSize int // Bytes sent in each INSTREAM chunk (0 = 64 KB)
+}
+
+// Defaults for ScanOptions
+const (
+	defaultScanStreams   = 4
+	defaultScanChunkSize = 64 * 1024
+)
+
+// ScanTiming describes one scan, for metrics
+type ScanTiming struct {
+	Instance string        // clamd address the scan went to
+	Bytes    int64         // Bytes streamed
+	Wait     time.Duration // Time waiting for a free stream
+	Scan     time.Duration // Time streaming and waiting for clamd's verdict
+	Err      error
 }
 
 // ScanResult contains the result of a virus scan
@@ -23,15 +57,26 @@ type ScanResult struct {
 	Threats  []string
 }
 
-// NewScanner creates a new virus scanner
-func NewScanner(enabled bool, clamdAddress string) (*Scanner, error) {
+// NewScanner creates a new virus scanner. clamdAddress lists one or more
+// clamd instances, separated by commas, as host:port, a socket path or a
+// tcp:// or unix:// URL; scans are spread across them.
+func NewScanner(enabled bool, clamdAddress string, opts ScanOptions) (*Scanner, error) {
 	// Use default address if empty
 	if clamdAddress == "" {
 		clamdAddress = "localhost:3310"
 	}
+	var instances []string
+	for _, address := range strings.Split(clamdAddress, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			instances = append(instances, clamdURL(address))
+		}
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no clamd address given")
+	}
 
 	// Check if ClamAV is installed and running
-	if !isClamAVAvailable() {
+	if !isClamAVAvailable(instances[0]) {
 		if enabled {
 			fmt.Println("ClamAV is not available, disabling virus scanning.")
 		}
@@ -39,7 +84,7 @@ func NewScanner(enabled bool, clamdAddress string) (*Scanner, error) {
 	}
 
 	// Create ClamAV client
-	client := clamd.NewClamd(clamdAddress)
+	client := clamd.NewClamd(instances[0])
 
 	// Test connection
 	version, err := client.Version()
@@ -49,9 +94,27 @@ func NewScanner(enabled bool, clamdAddress string) (*Scanner, error) {
 
 	// Successfully connected
 	if len(version) > 0 {
+		if opts.Streams <= 0 {
+			opts.Streams = defaultScanStreams
+		}
+		if opts.ChunkSize <= 0 {
+			opts.ChunkSize = defaultScanChunkSize
+		}
+
+		// Interleave the instances, so scans spread across them while
+		// each has free streams
+		streams := make(chan string, opts.Streams*len(instances))
+		for i := 0; i < opts.Streams; i++ {
+			for _, instance := range instances {
+				streams <- instance
+			}
+		}
 		return &Scanner{
-			enabled: true,
-			client:  client,
+			enabled:   true,
+			client:    client,
+			instances: instances,
+			streams:   streams,
+			chunkSize: opts.ChunkSize,
 		}, nil
 	}
 
@@ -59,7 +122,7 @@ func NewScanner(enabled bool, clamdAddress string) (*Scanner, error) {
 }
 
 // isClamAVAvailable checks if ClamAV is installed and the daemon is running
-func isClamAVAvailable() bool {
+func isClamAVAvailable(address string) bool {
 	// Check if clamscan is in the PATH
 	cmd := exec.Command("clamscan", "--version")
 	if err := cmd.Run(); err != nil {
@@ -67,7 +130,7 @@ func isClamAVAvailable() bool {
 	}
 
 	// Check if we can connect to clamd
-	client := clamd.NewClamd("localhost:3310")
+	client := clamd.NewClamd(address)
 	if err := client.Ping(); err != nil {
 		return false
 	}
@@ -80,6 +143,43 @@ func (s *Scanner) IsEnabled() bool {
 	return s.enabled
 }
 
+// Instances returns how many clamd instances scans are spread across
+func (s *Scanner) Instances() int {
+	return len(s.instances)
+}
+
+// Streams returns how many scans may be streamed to clamd at once, across
+// the instances
+func (s *Scanner) Streams() int {
+	return max(cap(s.streams), 1)
+}
+
+// OnScan sets a function called after each scan, e.g. to send its timing to
+// a metrics sink. Call it before the first scan.
+func (s *Scanner) OnScan(fn func(ScanTiming)) {
+	s.onScan = fn
+}
+
+// Stats returns the scans made so far
+func (s *Scanner) Stats() models.ScanSummary {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return s.stats
+}
+
+// Ping checks that every ClamAV daemon still answers
+func (s *Scanner) Ping() error {
+	if !s.enabled {
+		return nil
+	}
+	for _, instance := range s.instances {
+		if err := clamd.NewClamd(instance).Ping(); err != nil {
+			return fmt.Errorf("ClamAV at %s is not responding: %w", instance, err)
+		}
+	}
+	return nil
+}
+
 // ScanFile scans a file for viruses
 func (s *Scanner) ScanFile(filePath string) (*ScanResult, error) {
 	if !s.enabled {
@@ -115,19 +215,44 @@ func (s *Scanner) ScanReader(reader io.Reader) (*ScanResult, error) {
 		Threats: []string{},
 	}
 
+	// Wait for a free stream on one of the instances
+	waitStart := time.Now()
+	instance := <-s.streams
+	defer func() { s.streams <- instance }()
+	timing := ScanTiming{Instance: instance, Wait: time.Since(waitStart)}
+
 	// Scan the reader
-	scanResults, err := s.client.ScanStream(reader, make(chan bool))
+	scanStart := time.Now()
+	threats, sent, err := instream(instance, reader, s.chunkSize)
+	timing.Scan, timing.Bytes, timing.Err = time.Since(scanStart), sent, err
+	s.record(timing)
 	if err != nil {
 		return nil, fmt.Errorf("scan failed: %w", err)
 	}
 
 	// Process scan results
-	for sr := range scanResults {
-		if sr.Status == "FOUND" {
-			result.Infected = true
-			result.Threats = append(result.Threats, fmt.Sprintf("%s: %s", sr.Description, sr.Status))
-		}
+	if len(threats) > 0 {
+		result.Infected = true
+		result.Threats = append(result.Threats, threats...)
 	}
 
 	return result, nil
 }
+
+// record adds a scan to the run's totals and reports it
+func (s *Scanner) record(timing ScanTiming) {
+	s.statsMu.Lock()
+	s.stats.Scans++
+	if timing.Err != nil {
+		s.stats.Failed++
+	}
+	s.stats.Bytes += timing.Bytes
+	s.stats.Time += timing.Scan
+	s.stats.Wait += timing.Wait
+	s.stats.Max = max(s.stats.Max, timing.Scan)
+	s.statsMu.Unlock()
+
+	if s.onScan != nil {
+		s.onScan(timing)
+	}
+}
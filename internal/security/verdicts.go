@@ -0,0 +1,36 @@
+package security
+
+import "sync"
+
+// Verdicts caches scan results by the SHA-256 of the content scanned, so
+// content many messages carry is scanned once. A run keeps its own, since
+// signatures change between runs. It is safe for concurrent use, and a nil
+// Verdicts keeps nothing.
+type Verdicts struct {
+	results sync.Map
+}
+
+// NewVerdicts returns an empty cache
+func NewVerdicts() *Verdicts {
+	return &Verdicts{}
+}
+
+// Lookup returns the result recorded for content with the digest
+func (v *Verdicts) Lookup(digest string) (*ScanResult, bool) {
+	if v == nil || digest == "" {
+		return nil, false
+	}
+	result, ok := v.results.Load(digest)
+	if !ok {
+		return nil, false
+	}
+	return result.(*ScanResult), true
+}
+
+// Record keeps the result of scanning content with the digest
+func (v *Verdicts) Record(digest string, result *ScanResult) {
+	if v == nil || digest == "" {
+		return
+	}
+	v.results.Store(digest, result)
+}
@@ -0,0 +1,99 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// SignatureSuffix is appended to a file's path to name its detached signature
+const SignatureSuffix = ".sig"
+
+// LoadPrivateKey reads an Ed25519 private key in PKCS#8 PEM form, as written
+// by "openssl genpkey -algorithm ed25519"
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an Ed25519 key", path)
+	}
+	return private, nil
+}
+
+// LoadPublicKey reads an Ed25519 public key in PKIX PEM form, as written by
+// "openssl pkey -pubout"
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an Ed25519 key", path)
+	}
+	return public, nil
+}
+
+// SignFile writes a detached signature of the file next to it and returns
+// the signature's path. The signature is the raw 64-byte Ed25519 signature,
+// which "openssl pkeyutl -verify -rawin" also checks.
+func SignFile(key ed25519.PrivateKey, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s for signing: %w", path, err)
+	}
+	signature, err := key.Sign(nil, data, crypto.Hash(0))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign %s: %w", path, err)
+	}
+
+	signaturePath := path + SignatureSuffix
+	if err := os.WriteFile(signaturePath, signature, 0644); err != nil {
+		return "", fmt.Errorf("failed to write signature: %w", err)
+	}
+	return signaturePath, nil
+}
+
+// VerifyFile checks the file against its detached signature
+func VerifyFile(key ed25519.PublicKey, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	signature, err := os.ReadFile(path + SignatureSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+	if !ed25519.Verify(key, data, signature) {
+		return errors.New("signature does not match; the file was altered or signed with another key")
+	}
+	return nil
+}
+
+// readPEM reads the first PEM block of a key file
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key file %s is not PEM encoded", path)
+	}
+	return block, nil
+}
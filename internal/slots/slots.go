@@ -0,0 +1,110 @@
+// Package slots bounds how many of something a run has in use at once, such
+// as open files or Chrome renders, shared by all of its conversions.
+package slots
+
+import "sync"
+
+// Limiter hands out a limited number of slots. The limit can be changed
+// while slots are in use. A nil Limiter imposes no limit.
+type Limiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int // 0 = no limit
+	active   int
+	pressure bool          // Memory is under pressure; one at a time until it ends
+	felt     chan struct{} // Closed while under pressure, replaced when it ends
+}
+
+// New returns a limiter handing out up to limit slots at once (0 = no limit)
+func New(limit int) *Limiter {
+	l := &Limiter{limit: max(limit, 0), felt: make(chan struct{})}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// Acquire waits for a free slot. Under memory pressure a slot is free only
+// once no other is in use, so the run keeps moving without taking more.
+func (l *Limiter) Acquire() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for (l.limit > 0 && l.active >= l.limit) || (l.pressure && l.active > 0) {
+		l.cond.Wait()
+	}
+	l.active++
+}
+
+// Release frees a slot
+func (l *Limiter) Release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.cond.Broadcast()
+}
+
+// SetLimit changes how many slots are handed out at once (0 = no limit).
+// Lowering it lets the holders of slots in use finish.
+func (l *Limiter) SetLimit(limit int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = max(limit, 0)
+	l.cond.Broadcast()
+}
+
+// Limit returns how many slots are handed out at once (0 = no limit)
+func (l *Limiter) Limit() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+// SetPressure tells the limiter, and the holders of its slots watching
+// Pressured, whether memory is under pressure
+func (l *Limiter) SetPressure(on bool) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if on != l.pressure {
+		if on {
+			close(l.felt)
+		} else {
+			l.felt = make(chan struct{})
+		}
+	}
+	l.pressure = on
+	l.cond.Broadcast()
+}
+
+// Pressured returns a channel that is closed once memory comes under
+// pressure (nil, which never closes, for a nil Limiter)
+func (l *Limiter) Pressured() <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.felt
+}
+
+// UnderPressure reports whether memory is under pressure now
+func (l *Limiter) UnderPressure() bool {
+	if l == nil {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pressure
+}
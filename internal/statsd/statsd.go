@@ -0,0 +1,86 @@
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Wire formats for Client
+const (
+	FormatDogStatsD = "dogstatsd" // Tags appended as |#key:value,...
+	FormatStatsd    = "statsd"    // Plain statsd, which has no tags
+)
+
+// Client sends metrics to a statsd or DogStatsD server over UDP. Sends never
+// block the caller; a metric that cannot be delivered is dropped.
+type Client struct {
+	conn   net.Conn
+	prefix string
+	format string
+	tags   []string
+}
+
+// CheckFormat validates a wire format
+func CheckFormat(format string) error {
+	switch format {
+	case FormatDogStatsD, FormatStatsd:
+		return nil
+	}
+	return fmt.Errorf("unsupported statsd format %q (available: %s, %s)", format, FormatDogStatsD, FormatStatsd)
+}
+
+// New creates a client sending to address, e.g. localhost:8125. Metric names
+// are prefixed with prefix and a dot, and tags are added to every metric.
+func New(address, prefix, format string, tags []string) (*Client, error) {
+	if err := CheckFormat(format); err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd at %s: %w", address, err)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+	return &Client{conn: conn, prefix: prefix, format: format, tags: tags}, nil
+}
+
+// Count adds value to a counter
+func (c *Client) Count(name string, value int64, tags ...string) {
+	c.send(name, fmt.Sprintf("%d|c", value), tags)
+}
+
+// Timing records a duration in milliseconds
+func (c *Client) Timing(name string, d time.Duration, tags ...string) {
+	c.send(name, fmt.Sprintf("%d|ms", d.Milliseconds()), tags)
+}
+
+// Gauge sets a gauge to value
+func (c *Client) Gauge(name string, value float64, tags ...string) {
+	c.send(name, fmt.Sprintf("%g|g", value), tags)
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// send writes one metric line
+func (c *Client) send(name, value string, tags []string) {
+	line := c.prefix + name + ":" + value
+	if c.format == FormatDogStatsD {
+		if all := append(append([]string(nil), c.tags...), tags...); len(all) > 0 {
+			line += "|#" + strings.Join(all, ",")
+		}
+	}
+	// UDP writes fail only locally, e.g. when nothing listens on the port
+	c.conn.Write([]byte(line))
+}
+
+// Tag formats a DogStatsD tag, replacing characters the protocol reserves
+func Tag(key, value string) string {
+	value = strings.NewReplacer(",", "_", "|", "_", "#", "_").Replace(value)
+	return key + ":" + value
+}
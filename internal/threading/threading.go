@@ -0,0 +1,186 @@
+package threading
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jhillyerd/enmime"
+
+	"emil/internal/models"
+)
+
+var (
+	// messageIDPattern matches one bracketed Message-ID in a References or
+	// In-Reply-To header
+	messageIDPattern = regexp.MustCompile(`<([^<>\s]+)>`)
+
+	// replyPrefixPattern matches a reply or forward prefix as mail clients
+	// write them in several languages, e.g. "Re:", "Fwd:", "AW:" or "Re[2]:"
+	replyPrefixPattern = regexp.MustCompile(`(?i)^(?:re|fwd?|aw|wg|sv|vs|antw|tr|rif|r)\s*(?:\[\d+\]|\(\d+\))?\s*:\s*`)
+
+	// listTagPattern matches the tag a mailing list puts before the subject,
+	// e.g. "[golang-nuts]"
+	listTagPattern = regexp.MustCompile(`^\[[^\]]*\]\s*`)
+)
+
+// KeyOf reads what a message's conversation is worked out from
+func KeyOf(envelope *enmime.Envelope) models.ThreadKey {
+	key := models.ThreadKey{}
+	if ids := messageIDs(envelope.GetHeader("Message-ID")); len(ids) > 0 {
+		key.MessageID = ids[0]
+	}
+
+	// In-Reply-To names the parent, which some clients leave out of References
+	seen := map[string]bool{key.MessageID: true}
+	references := messageIDs(envelope.GetHeader("References"))
+	if parents := messageIDs(envelope.GetHeader("In-Reply-To")); len(parents) > 0 {
+		references = append(references, parents[0])
+	}
+	for _, id := range references {
+		if !seen[id] {
+			seen[id] = true
+			key.References = append(key.References, id)
+		}
+	}
+
+	key.Subject, key.Reply = NormalizeSubject(envelope.GetHeader("Subject"))
+	if date, err := envelope.Date(); err == nil {
+		key.Date = date
+	}
+	return key
+}
+
+// messageIDs returns the Message-IDs in a header without angle brackets. A
+// lone ID without brackets, as some clients write, is accepted too.
+func messageIDs(value string) []string {
+	var ids []string
+	for _, match := range messageIDPattern.FindAllStringSubmatch(value, -1) {
+		ids = append(ids, match[1])
+	}
+	if value = strings.TrimSpace(value); len(ids) == 0 && value != "" && !strings.ContainsAny(value, " \t<>") {
+		ids = append(ids, value)
+	}
+	return ids
+}
+
+// NormalizeSubject returns the subject messages of a thread share, without
+// reply and forward prefixes or list tags, with spaces collapsed and
+// lower-cased, and whether it had a reply or forward prefix
+func NormalizeSubject(subject string) (string, bool) {
+	s := strings.TrimSpace(subject)
+	reply := false
+	for {
+		if match := listTagPattern.FindString(s); match != "" {
+			s = s[len(match):]
+		} else if match := replyPrefixPattern.FindString(s); match != "" {
+			s = s[len(match):]
+			reply = true
+		} else {
+			break
+		}
+	}
+	s = strings.TrimSuffix(strings.TrimSpace(s), "(fwd)")
+	return strings.ToLower(strings.Join(strings.Fields(s), " ")), reply
+}
+
+// Assign groups messages, keyed by path, into threads. Messages are linked
+// through the Message-IDs in their References and In-Reply-To headers, even
+// when the messages between them aren't in the run. Replies whose client
+// dropped those headers join the earliest message with the same normalized
+// subject; other messages sharing only a subject stay apart, since subjects
+// like "Meeting" recur. A thread is identified by the Message-ID its
+// earliest message names as the start, so later runs over more of the
+// conversation agree on it.
+func Assign(keys map[string]models.ThreadKey) map[string]models.Thread {
+	// Earliest first, then by path; undated messages go last
+	paths := make([]string, 0, len(keys))
+	for path := range keys {
+		paths = append(paths, path)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		a, b := keys[paths[i]].Date, keys[paths[j]].Date
+		if a.IsZero() != b.IsZero() {
+			return b.IsZero()
+		}
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return paths[i] < paths[j]
+	})
+
+	// Union-find over files and the Message-IDs they mention
+	parent := make(map[string]string)
+	var find func(node string) string
+	find = func(node string) string {
+		next, ok := parent[node]
+		if !ok || next == node {
+			return node
+		}
+		root := find(next)
+		parent[node] = root
+		return root
+	}
+	union := func(a, b string) {
+		if ra, rb := find(a), find(b); ra != rb {
+			parent[ra] = rb
+		}
+	}
+
+	firstWithSubject := make(map[string]string)
+	for _, path := range paths {
+		key := keys[path]
+		node := "file:" + path
+		if key.MessageID != "" {
+			union(node, "id:"+key.MessageID)
+		}
+		for _, id := range key.References {
+			union(node, "id:"+id)
+		}
+		if _, ok := firstWithSubject[key.Subject]; !ok && key.Subject != "" {
+			firstWithSubject[key.Subject] = node
+		}
+	}
+	for _, path := range paths {
+		if key := keys[path]; key.Reply && len(key.References) == 0 && key.Subject != "" {
+			union("file:"+path, firstWithSubject[key.Subject])
+		}
+	}
+
+	members := make(map[string][]string)
+	for _, path := range paths {
+		root := find("file:" + path)
+		members[root] = append(members[root], path)
+	}
+
+	threads := make(map[string]models.Thread, len(keys))
+	for _, thread := range members {
+		root, id := threadRoot(thread[0], keys[thread[0]])
+		for i, path := range thread {
+			threads[path] = models.Thread{ID: id, Root: root, Position: i + 1, Size: len(thread)}
+		}
+	}
+	return threads
+}
+
+// threadRoot returns the Message-ID a thread started with, as its earliest
+// message names it, and the thread ID derived from it. Threads without
+// Message-IDs are identified by their subject, or failing that the file.
+func threadRoot(path string, first models.ThreadKey) (string, string) {
+	root := first.MessageID
+	if len(first.References) > 0 {
+		root = first.References[0]
+	}
+
+	basis := "file:" + path
+	switch {
+	case root != "":
+		basis = "id:" + root
+	case first.Subject != "":
+		basis = "subject:" + first.Subject
+	}
+	sum := sha256.Sum256([]byte(basis))
+	return root, hex.EncodeToString(sum[:8])
+}
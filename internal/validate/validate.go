@@ -0,0 +1,202 @@
+package validate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jhillyerd/enmime"
+)
+
+// Issue severities
+const (
+	SeverityError   = "error"   // The message, or part of it, cannot be converted faithfully
+	SeverityWarning = "warning" // The message converts but deserves a look
+)
+
+// Issue kinds
+const (
+	KindParse      = "parse"      // The file is not a readable message
+	KindEncoding   = "encoding"   // Charset or transfer encoding problems
+	KindStructure  = "structure"  // Malformed or unusual MIME structure
+	KindHeaders    = "headers"    // Missing or malformed headers
+	KindAttachment = "attachment" // Attachments that look like they hide executables
+)
+
+// Thresholds for unusual MIME structures
+const (
+	maxNormalDepth = 10
+	maxNormalParts = 500
+)
+
+// executableExtensions are attachment types that run code when opened
+var executableExtensions = map[string]bool{
+	".exe": true, ".scr": true, ".com": true, ".bat": true, ".cmd": true, ".pif": true,
+	".js": true, ".jse": true, ".vbs": true, ".vbe": true, ".wsf": true, ".hta": true,
+	".msi": true, ".ps1": true, ".jar": true, ".lnk": true,
+}
+
+// Issue is a single problem found in a file
+type Issue struct {
+	Severity string `json:"severity"`
+	Kind     string `json:"kind"`
+	Detail   string `json:"detail"`
+}
+
+// Result lists the problems found in one file
+type Result struct {
+	Path   string  `json:"path"`
+	Issues []Issue `json:"issues,omitempty"`
+}
+
+// HasErrors reports whether any issue is an error
+func (r *Result) HasErrors() bool {
+	for _, issue := range r.Issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// add records an issue, once
+func (r *Result) add(severity, kind, format string, args ...interface{}) {
+	issue := Issue{Severity: severity, Kind: kind, Detail: fmt.Sprintf(format, args...)}
+	for _, existing := range r.Issues {
+		if existing == issue {
+			return
+		}
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// Check parses an EML file and reports parse errors, encoding problems and
+// suspicious structures. Nothing is written.
+func Check(path string) Result {
+	result := Result{Path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		result.add(SeverityError, KindParse, "failed to read file: %v", err)
+		return result
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		result.add(SeverityError, KindParse, "file is empty")
+		return result
+	}
+
+	envelope, err := enmime.ReadEnvelope(bytes.NewReader(data))
+	if err != nil {
+		result.add(SeverityError, KindParse, "%v", err)
+		return result
+	}
+
+	checkParserErrors(&result, envelope)
+	checkHeaders(&result, envelope)
+	checkStructure(&result, envelope)
+	checkAttachments(&result, envelope)
+	return result
+}
+
+// checkParserErrors turns the parser's own errors and warnings into issues
+func checkParserErrors(result *Result, envelope *enmime.Envelope) {
+	for _, perr := range envelope.Errors {
+		kind := KindEncoding
+		switch perr.Name {
+		case enmime.ErrorPlainTextFromHTML:
+			continue // Normal for HTML-only mail
+		case enmime.ErrorMissingRecipient:
+			kind = KindHeaders
+		case enmime.ErrorMissingBoundary, enmime.ErrorMissingContentType, enmime.ErrorMalformedChildPart:
+			kind = KindStructure
+		case enmime.ErrorMalformedHeader:
+			kind = KindHeaders
+		}
+
+		severity := SeverityWarning
+		if perr.Severe {
+			severity = SeverityError
+		}
+		detail := perr.Name
+		if perr.Detail != "" {
+			detail += ": " + perr.Detail
+		}
+		result.add(severity, kind, "%s", detail)
+	}
+}
+
+// checkHeaders looks for missing and undecodable headers
+func checkHeaders(result *Result, envelope *enmime.Envelope) {
+	if envelope.GetHeader("From") == "" {
+		result.add(SeverityWarning, KindHeaders, "no From header")
+	}
+	if envelope.GetHeader("Date") == "" {
+		result.add(SeverityWarning, KindHeaders, "no Date header")
+	} else if _, err := envelope.Date(); err != nil {
+		result.add(SeverityWarning, KindHeaders, "unparsable Date header %q", envelope.GetHeader("Date"))
+	}
+
+	for _, name := range []string{"Subject", "From", "To"} {
+		if value := envelope.GetHeader(name); !utf8.ValidString(value) {
+			result.add(SeverityWarning, KindEncoding, "%s header is not valid UTF-8 after decoding", name)
+		}
+	}
+}
+
+// checkStructure flags empty messages and unusually deep or large MIME trees
+func checkStructure(result *Result, envelope *enmime.Envelope) {
+	if strings.TrimSpace(envelope.Text) == "" && strings.TrimSpace(envelope.HTML) == "" &&
+		len(envelope.Attachments) == 0 && len(envelope.Inlines) == 0 {
+		result.add(SeverityWarning, KindStructure, "message has no body and no attachments")
+	}
+
+	if envelope.Root == nil {
+		return
+	}
+	depth, parts := measure(envelope.Root, 1)
+	if depth > maxNormalDepth {
+		result.add(SeverityWarning, KindStructure, "MIME parts nested %d levels deep", depth)
+	}
+	if parts > maxNormalParts {
+		result.add(SeverityWarning, KindStructure, "message has %d MIME parts", parts)
+	}
+}
+
+// measure returns the depth and number of parts of a MIME tree
+func measure(part *enmime.Part, level int) (depth, parts int) {
+	depth, parts = level, 1
+	for child := part.FirstChild; child != nil; child = child.NextSibling {
+		childDepth, childParts := measure(child, level+1)
+		depth = max(depth, childDepth)
+		parts += childParts
+	}
+	return depth, parts
+}
+
+// checkAttachments flags executables, double extensions and content that
+// doesn't match its declared type
+func checkAttachments(result *Result, envelope *enmime.Envelope) {
+	parts := append(append([]*enmime.Part{}, envelope.Attachments...), envelope.Inlines...)
+	for _, part := range parts {
+		name := part.FileName
+		ext := strings.ToLower(filepath.Ext(name))
+
+		if executableExtensions[ext] {
+			inner := strings.ToLower(filepath.Ext(strings.TrimSuffix(name, filepath.Ext(name))))
+			if inner != "" && !executableExtensions[inner] {
+				result.add(SeverityWarning, KindAttachment, "%s hides an executable behind a double extension", name)
+			} else {
+				result.add(SeverityWarning, KindAttachment, "%s is an executable", name)
+			}
+			continue
+		}
+
+		// Windows executables start with "MZ" whatever their name says
+		if bytes.HasPrefix(part.Content, []byte("MZ")) {
+			result.add(SeverityWarning, KindAttachment, "%s (%s) contains a Windows executable", name, part.ContentType)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory a large message takes while it is converted, as a multiple of its
+// size: the parsed MIME tree, decoded attachments and the rendered HTML
+const largeFileFootprint = 4
+
+// How often a large file waiting for headroom checks memory again
+const admissionRecheck = 500 * time.Millisecond
+
+// Admission holds large files back until there is memory headroom for
+// them, so several giant messages don't start at once and push the run into
+// pauses and forced GCs. A large file always starts when no other is being
+// converted, so the run can't stall on them.
+type Admission struct {
+	mu       sync.Mutex
+	minSize  int64         // Files at least this large wait for headroom
+	headroom func() int64  // Bytes of memory the run may still use
+	reserved int64         // Estimated memory of the large files converting
+	inFlight int           // Large files converting
+	released chan struct{} // Closed, and replaced, when a large file finishes
+}
+
+// NewAdmission returns an admission control for files of at least minSize
+// bytes, which start while headroom reports room for them
+func NewAdmission(minSize int64, headroom func() int64) *Admission {
+	return &Admission{minSize: minSize, headroom: headroom, released: make(chan struct{})}
+}
+
+// Large reports whether a file of size bytes has to wait for headroom. A
+// nil Admission admits every file at once.
+func (a *Admission) Large(size int64) bool {
+	return a != nil && a.minSize > 0 && size >= a.minSize
+}
+
+// Admit waits until a file of size bytes may start and returns a function to
+// call once it is converted. waiting is called once if the file has to wait.
+// It returns false if ctx is done first.
+func (a *Admission) Admit(ctx context.Context, size int64, waiting func()) (func(), bool) {
+	if !a.Large(size) {
+		return func() {}, true
+	}
+	need := size * largeFileFootprint
+
+	ticker := time.NewTicker(admissionRecheck)
+	defer ticker.Stop()
+	for {
+		a.mu.Lock()
+		if a.inFlight == 0 || a.reserved+need <= a.headroom() {
+			a.inFlight++
+			a.reserved += need
+			a.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(func() { a.release(need) }) }, true
+		}
+		released := a.released
+		a.mu.Unlock()
+
+		if waiting != nil {
+			waiting()
+			waiting = nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-released:
+		case <-ticker.C:
+		}
+	}
+}
+
+// release takes a finished large file off the reservation and wakes the
+// files waiting for headroom
+func (a *Admission) release(need int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.inFlight--
+	a.reserved -= need
+	close(a.released)
+	a.released = make(chan struct{})
+}
@@ -0,0 +1,30 @@
+package worker
+
+import (
+	"runtime"
+	"time"
+)
+
+// costMeter measures what one conversion attempt costs the process
+type costMeter struct {
+	cpu    time.Duration // CPU time of the worker's thread when the attempt started
+	maxRSS int64         // Peak resident set size of the process when the attempt started
+}
+
+// startCost starts measuring an attempt, keeping the worker's goroutine on
+// its thread so the thread's CPU time is the attempt's. Work the attempt
+// hands to other goroutines, and Chrome's rendering in its own processes,
+// isn't counted.
+func startCost() costMeter {
+	runtime.LockOSThread()
+	return costMeter{cpu: threadCPUTime(), maxRSS: peakRSS()}
+}
+
+// finish ends the measurement, returning the CPU time the attempt used and
+// how far it raised the process's peak RSS
+func (c costMeter) finish() (time.Duration, int64) {
+	cpu := threadCPUTime() - c.cpu
+	rss := peakRSS() - c.maxRSS
+	runtime.UnlockOSThread()
+	return max(cpu, 0), max(rss, 0)
+}
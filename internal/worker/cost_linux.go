@@ -0,0 +1,27 @@
+package worker
+
+import (
+	"syscall"
+	"time"
+)
+
+// rusageThread selects the calling thread in getrusage
+const rusageThread = 1
+
+// threadCPUTime returns the user and system CPU time of the calling thread
+func threadCPUTime() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(rusageThread, &usage); err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// peakRSS returns the process's peak resident set size in bytes
+func peakRSS() int64 {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	return usage.Maxrss * 1024
+}
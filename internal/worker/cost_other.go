@@ -0,0 +1,16 @@
+//go:build !linux
+
+package worker
+
+import "time"
+
+// threadCPUTime can't be read per thread on this platform, so no CPU time
+// is recorded
+func threadCPUTime() time.Duration {
+	return 0
+}
+
+// peakRSS isn't read on this platform, so no memory growth is recorded
+func peakRSS() int64 {
+	return 0
+}
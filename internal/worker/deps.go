@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"errors"
+	"log"
+
+	"emil/internal/config"
+	"emil/internal/converter"
+	"emil/internal/ocr"
+	"emil/internal/security"
+)
+
+// ConvertFunc converts one EML file to PDF
+type ConvertFunc func(emlPath string, cfg *config.Config, scanner *security.Scanner, ocrEngine *ocr.Engine) (*converter.ConversionResult, error)
+
+// The default conversion must keep matching ConvertFunc
+var _ ConvertFunc = converter.ConvertEMLToPDF
+
+// WorkerDeps holds everything a worker uses besides its channels. Workers
+// reach options and collaborators only through it, so they are wired in one
+// place and a mismatch between packages fails to compile.
+type WorkerDeps struct {
+	Config  *config.Config    // Conversion, retry and logging options (required)
+	Scanner *security.Scanner // Virus scanner for attachments (nil = not scanned)
+	OCR     *ocr.Engine       // Text recognition for image-only messages (nil = none)
+	Convert ConvertFunc       // Converts each file (nil = converter.ConvertEMLToPDF)
+	Logger  *log.Logger       // Where worker messages are logged (nil = the standard logger)
+
+	// Holds large files back until memory allows, shared by all workers (nil = none)
+	Admission *Admission
+
+	// Whether Convert is the converter's own, so batches can share a session
+	builtinConvert bool
+}
+
+// errNoConfig is returned for dependencies without the required Config
+var errNoConfig = errors.New("worker: WorkerDeps.Config is required")
+
+// withDefaults returns the dependencies with unset optional ones filled in,
+// or an error if a required one is missing
+func (d WorkerDeps) withDefaults() (WorkerDeps, error) {
+	if d.Config == nil {
+		return d, errNoConfig
+	}
+	if d.Convert == nil {
+		d.Convert = converter.ConvertEMLToPDF
+		d.builtinConvert = true
+	}
+	if d.Logger == nil {
+		d.Logger = log.Default()
+	}
+	return d, nil
+}
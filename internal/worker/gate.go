@@ -0,0 +1,60 @@
+package worker
+
+import "sync"
+
+// Gate holds workers back from taking new tasks while it is paused. Tasks
+// already being converted carry on.
+type Gate struct {
+	mu   sync.Mutex
+	open chan struct{} // Closed while the gate is open
+}
+
+// NewGate returns an open gate
+func NewGate() *Gate {
+	open := make(chan struct{})
+	close(open)
+	return &Gate{open: open}
+}
+
+// Pause closes the gate, returning false if it was already paused
+func (g *Gate) Pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-g.open:
+		g.open = make(chan struct{})
+		return true
+	default:
+		return false
+	}
+}
+
+// Resume opens the gate, returning false if it was not paused
+func (g *Gate) Resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-g.open:
+		return false
+	default:
+		close(g.open)
+		return true
+	}
+}
+
+// Paused reports whether the gate is holding workers back
+func (g *Gate) Paused() bool {
+	select {
+	case <-g.Open():
+		return false
+	default:
+		return true
+	}
+}
+
+// Open returns a channel that is closed once the gate is open
+func (g *Gate) Open() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.open
+}
@@ -3,58 +3,105 @@ package worker
 import (
 	"context"
 	"fmt"
-	"log"
+	"math/rand/v2"
 	"runtime/debug"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"emil/internal/config"
 	"emil/internal/converter"
 	"emil/internal/models"
-	"emil/internal/security"
 )
 
 // Constants for worker behavior
 const (
 	maxConsecutiveFailures = 5    // Maximum number of consecutive failures before self-healing
-	maxRetries             = 3    // Maximum retries per task
-	backoffBase            = 500  // Base backoff in milliseconds
+	maxRetries             = 3    // Retries per task when not configured
+	backoffBase            = 500  // Delay before the first retry in milliseconds when not configured
+	maxBackoffShift        = 16   // Most times the retry delay is doubled
 	heartbeatInterval      = 5000 // Milliseconds between worker heartbeats
+	defaultBatchMaxKB      = 16   // Largest file batched when not configured
+
+	// HeartbeatTimeout is how long a worker may go without a heartbeat
+	// before it is considered gone
+	HeartbeatTimeout = time.Duration(heartbeatInterval*3) * time.Millisecond
+
+	// How long a conversion may go without progress before its worker is
+	// considered hung and stops sending heartbeats, well past the slowest
+	// render's own timeout
+	stallTimeout = 3 * time.Minute
 )
 
 // Worker represents a conversion worker
 type Worker struct {
 	id                int
 	taskChan          <-chan models.Task
+	spareChan         <-chan models.Task // Second queue the worker also takes from (nil = none)
 	statusChan        chan<- models.StatusUpdate
 	done              chan struct{}
 	failCount         int
 	consecutiveErrors int
 	maxRetries        int
+	retryClasses      []string
 	wg                sync.WaitGroup
 	stopChan          chan struct{}
+	stopOnce          sync.Once
 	verbose           bool
-	lastActivity      time.Time
-	config            *config.Config
-	scanner           *security.Scanner
+	busy              atomic.Bool  // Whether a conversion attempt is running
+	lastActivity      atomic.Int64 // Unix nanoseconds when the worker last started, progressed with or finished a task
+	lastHeartbeat     atomic.Int64 // Unix nanoseconds of the latest heartbeat
+	intake            *Gate
+	deps              WorkerDeps
 }
 
-// NewWorker creates a new worker
-func NewWorker(id int, taskChan <-chan models.Task, statusChan chan<- models.StatusUpdate,
-	cfg *config.Config, scanner *security.Scanner) *Worker {
-	return &Worker{
+// NewWorker creates a new worker that takes tasks while intake is open, from
+// taskChan and, if it isn't nil, spareChan, such as the queue of a lane for
+// cheaper files that the worker helps with. It fails if deps lacks a
+// required dependency.
+func NewWorker(id int, taskChan, spareChan <-chan models.Task, statusChan chan<- models.StatusUpdate, intake *Gate, deps WorkerDeps) (*Worker, error) {
+	deps, err := deps.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	cfg := deps.Config
+	w := &Worker{
 		id:           id,
 		taskChan:     taskChan,
+		spareChan:    spareChan,
 		statusChan:   statusChan,
 		done:         make(chan struct{}),
 		maxRetries:   maxRetries,
+		retryClasses: cfg.Retry.Classes,
 		stopChan:     make(chan struct{}),
 		verbose:      cfg.Verbose,
-		lastActivity: time.Now(),
-		config:       cfg,
-		scanner:      scanner,
+		intake:       intake,
+		deps:         deps,
 	}
+	if cfg.Retry.MaxAttempts > 0 {
+		w.maxRetries = cfg.Retry.MaxAttempts - 1
+	}
+	if len(w.retryClasses) == 0 {
+		w.retryClasses = converter.DefaultRetryClasses
+	}
+	w.lastActivity.Store(time.Now().UnixNano())
+	w.lastHeartbeat.Store(time.Now().UnixNano())
+	return w, nil
+}
+
+// ID returns the worker's identifier
+func (w *Worker) ID() int {
+	return w.id
+}
+
+// LastHeartbeat returns when the worker last showed it was alive. Heartbeats
+// stop when the worker's processing loop exits, and while a conversion has
+// made no progress for stallTimeout, so the task of a hung worker is
+// requeued.
+func (w *Worker) LastHeartbeat() time.Time {
+	return time.Unix(0, w.lastHeartbeat.Load())
 }
 
 // Start begins the worker's processing loop
@@ -71,32 +118,41 @@ func (w *Worker) Start(ctx context.Context, pauseChan <-chan bool) {
 		go w.heartbeat(heartbeatCtx)
 
 		for {
+			// Take no new task while intake is paused
+			select {
+			case <-w.intake.Open():
+			case <-ctx.Done():
+				return
+			case <-w.stopChan:
+				return
+			}
+
 			select {
 			case <-ctx.Done():
 				return
 
 			case <-w.stopChan:
 				if w.verbose {
-					log.Printf("Worker %d stopping on request", w.id)
+					w.deps.Logger.Printf("Worker %d stopping on request", w.id)
 				}
 				return
 
 			case pause := <-pauseChan:
 				if pause {
 					if w.verbose {
-						log.Printf("Worker %d pausing due to resource constraints", w.id)
+						w.deps.Logger.Printf("Worker %d pausing due to resource constraints", w.id)
 					}
 					// Wait for unpause signal or context cancellation
 					select {
 					case <-pauseChan:
 						if w.verbose {
-							log.Printf("Worker %d resuming", w.id)
+							w.deps.Logger.Printf("Worker %d resuming", w.id)
 						}
 					case <-ctx.Done():
 						return
 					case <-w.stopChan:
 						if w.verbose {
-							log.Printf("Worker %d stopping while paused", w.id)
+							w.deps.Logger.Printf("Worker %d stopping while paused", w.id)
 						}
 						return
 					}
@@ -107,40 +163,135 @@ func (w *Worker) Start(ctx context.Context, pauseChan <-chan bool) {
 					// Channel closed, no more tasks
 					return
 				}
-				w.processTask(ctx, task)
+				w.runBatch(ctx, w.claimBatch(task, w.taskChan))
 
-				// Update last activity time
-				w.lastActivity = time.Now()
-
-				// Self-healing: If worker has too many consecutive failures, restart it
-				if w.consecutiveErrors > maxConsecutiveFailures {
-					if w.verbose {
-						log.Printf("Worker %d self-healing after %d consecutive failures",
-							w.id, w.consecutiveErrors)
-					}
-					// Reset error counters
-					w.consecutiveErrors = 0
-					w.failCount = 0
-
-					// Force garbage collection
-					debug.FreeOSMemory()
+			case task, ok := <-w.spareChan:
+				if !ok {
+					// Keep taking from the worker's own queue
+					w.spareChan = nil
+					continue
 				}
+				w.runBatch(ctx, w.claimBatch(task, w.spareChan))
 			}
 		}
 	}()
 }
 
+// batch is what the tasks a worker claimed together share
+type batch struct {
+	size    int                // Tasks claimed together
+	session *converter.Session // Chrome tab the batch renders in (nil = a tab per render)
+}
+
+// BatchMaxBytes returns the size of the largest file batched with others
+func BatchMaxBytes(cfg *config.Config) int64 {
+	if cfg.BatchMaxKB <= 0 {
+		return defaultBatchMaxKB * 1024
+	}
+	return int64(cfg.BatchMaxKB) * 1024
+}
+
+// claimBatch takes more small files off the queue the first came from, up to
+// the batch size, without waiting for any. A large file taken ends the batch
+// and is converted last. Each claimed file is reported as processing, so it
+// is requeued like the rest if the worker is lost.
+func (w *Worker) claimBatch(first models.Task, queue <-chan models.Task) []models.Task {
+	tasks := []models.Task{first}
+	size := w.deps.Config.BatchSize
+	limit := BatchMaxBytes(w.deps.Config)
+	if size <= 1 || first.FileSize > limit {
+		return tasks
+	}
+
+	for len(tasks) < size && tasks[len(tasks)-1].FileSize <= limit {
+		var task models.Task
+		select {
+		case next, ok := <-queue:
+			if !ok {
+				return tasks
+			}
+			task = next
+		default:
+			return tasks
+		}
+		tasks = append(tasks, task)
+		w.sendStatus(task, models.StatusProcessing, 0, "Claimed in a batch",
+			models.ProcessingStats{FileSize: task.FileSize, WorkerID: w.id}, nil)
+	}
+	return tasks
+}
+
+// runBatch converts the tasks claimed together in turn. Claimed tasks are
+// converted even if the worker is asked to stop meanwhile.
+func (w *Worker) runBatch(ctx context.Context, tasks []models.Task) {
+	var b *batch
+	if len(tasks) > 1 {
+		b = &batch{size: len(tasks)}
+		if w.deps.builtinConvert {
+			b.session = converter.NewSession()
+			defer b.session.Close()
+		}
+		if w.verbose {
+			w.deps.Logger.Printf("Worker %d claimed a batch of %d small files", w.id, len(tasks))
+		}
+	}
+
+	for _, task := range tasks {
+		release, ok := w.admit(ctx, task)
+		if !ok {
+			return
+		}
+		w.lastActivity.Store(time.Now().UnixNano())
+		w.processTask(ctx, task, b)
+		release()
+
+		// Update last activity time
+		w.lastActivity.Store(time.Now().UnixNano())
+
+		// Self-healing: If worker has too many consecutive failures, restart it
+		if w.consecutiveErrors > maxConsecutiveFailures {
+			if w.verbose {
+				w.deps.Logger.Printf("Worker %d self-healing after %d consecutive failures",
+					w.id, w.consecutiveErrors)
+			}
+			// Reset error counters
+			w.consecutiveErrors = 0
+			w.failCount = 0
+
+			// Force garbage collection
+			debug.FreeOSMemory()
+		}
+	}
+}
+
+// admit waits until there is memory headroom to convert a large file,
+// reporting the task as waiting meanwhile, and returns a function to call
+// once it is converted. It returns false if the run is cancelled first.
+func (w *Worker) admit(ctx context.Context, task models.Task) (func(), bool) {
+	return w.deps.Admission.Admit(ctx, task.FileSize, func() {
+		w.sendStatus(task, models.StatusProcessing, 0, "Waiting for memory headroom",
+			models.ProcessingStats{FileSize: task.FileSize, WorkerID: w.id}, nil)
+		if w.verbose {
+			w.deps.Logger.Printf("Worker %d holding %s (%.1f MB) until memory allows",
+				w.id, task.FilePath, float64(task.FileSize)/(1024*1024))
+		}
+	})
+}
+
 // Done returns a channel that is closed when the worker completes
 func (w *Worker) Done() <-chan struct{} {
 	return w.done
 }
 
-// Stop requests the worker to stop
+// Stop requests the worker to stop; it is safe to call more than once
 func (w *Worker) Stop() {
-	close(w.stopChan)
+	w.stopOnce.Do(func() { close(w.stopChan) })
 }
 
-// heartbeat periodically checks worker health
+// heartbeat stamps the worker's heartbeat while it is healthy. A worker
+// stuck in a conversion withholds it, so the manager requeues the task, and
+// is stopped so it takes nothing new should the conversion ever return.
+// Idle, paused and retry-waiting workers are fine.
 func (w *Worker) heartbeat(ctx context.Context) {
 	ticker := time.NewTicker(time.Duration(heartbeatInterval) * time.Millisecond)
 	defer ticker.Stop()
@@ -150,19 +301,23 @@ func (w *Worker) heartbeat(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			// Check for worker unresponsiveness
-			if time.Since(w.lastActivity) > time.Duration(heartbeatInterval*3)*time.Millisecond {
-				if w.verbose {
-					log.Printf("Worker %d detected as unresponsive, attempting recovery", w.id)
+			if w.busy.Load() && time.Since(time.Unix(0, w.lastActivity.Load())) > stallTimeout {
+				select {
+				case <-w.stopChan:
+				default:
+					w.deps.Logger.Printf("Worker %d made no progress for %s, giving up its task", w.id, stallTimeout)
+					w.Stop()
 				}
-				w.Stop()
+				continue
 			}
+			w.lastHeartbeat.Store(time.Now().UnixNano())
 		}
 	}
 }
 
-// processTask handles a single conversion task with retries
-func (w *Worker) processTask(ctx context.Context, task models.Task) {
+// processTask handles a single conversion task with retries, as part of a
+// batch or alone (b = nil)
+func (w *Worker) processTask(ctx context.Context, task models.Task, b *batch) {
 	// Initialize processing stats
 	stats := models.ProcessingStats{
 		StartTime: time.Now(),
@@ -171,10 +326,16 @@ func (w *Worker) processTask(ctx context.Context, task models.Task) {
 	}
 
 	// Update status to processing
-	w.sendStatus(task.ID, models.StatusProcessing, 0, "Started processing", stats, nil)
+	message := "Started processing"
+	if b != nil {
+		message = fmt.Sprintf("Started processing in a batch of %d", b.size)
+	}
+	w.sendStatus(task, models.StatusProcessing, 0, message, stats, nil)
 
+	// A requeued task has already used a retry for each worker it lost, but
+	// is always attempted at least once
 	var err error
-	var retries int
+	retries := min(task.Retries, w.maxRetries)
 
 	for retries <= w.maxRetries {
 		// Handle context cancellation
@@ -183,7 +344,7 @@ func (w *Worker) processTask(ctx context.Context, task models.Task) {
 			stats.EndTime = time.Now()
 			stats.Duration = stats.EndTime.Sub(stats.StartTime)
 			stats.Retries = retries
-			w.sendStatus(task.ID, models.StatusFailed, 0, "Cancelled", stats, ctx.Err())
+			w.sendFinalStatus(ctx, task, models.StatusFailed, "Cancelled", stats, ctx.Err())
 			return
 		default:
 			// Continue processing
@@ -191,15 +352,50 @@ func (w *Worker) processTask(ctx context.Context, task models.Task) {
 
 		// Attempt conversion
 		startConvert := time.Now()
-		err = w.convertFile(ctx, task)
+		cost := startCost()
+		var result *converter.ConversionResult
+		result, err = w.convertSafely(ctx, task, b)
+		cpu, rss := cost.finish()
+		stats.CPUTime += cpu
+		stats.PeakRSSDelta += rss
 		conversionTime := time.Since(startConvert)
 
 		if err == nil {
 			// Success!
+			stats.OutputPaths = result.OutputParts
+			if len(stats.OutputPaths) == 0 {
+				stats.OutputPaths = []string{result.OutputPath}
+			}
+			stats.SecurityAlerts = result.SecurityAlerts
+			stats.AlertAction = result.AlertAction
+			stats.SkippedAttachments = result.SkippedAttachments
+			stats.PackagePath = result.PackagePath
+			stats.SidecarPath = result.SidecarPath
+			stats.BodyPart = result.BodyPart
+			stats.Renderer = result.Renderer
+			stats.MessageID = result.MessageID
+			stats.Sender = result.Sender
+			for _, att := range result.Attachments {
+				if att.Skipped == "" {
+					stats.AttachmentBytes += att.Size
+				}
+			}
+			stats.Tagged = result.Tagged
+			stats.Truncated = result.Truncated
+			stats.EmptyBody = result.EmptyBody
+			stats.Thread = result.Thread
+			for _, anomaly := range result.Anomalies {
+				stats.HeaderAnomalies = append(stats.HeaderAnomalies, anomaly.String())
+			}
+			if result.Journal != nil {
+				stats.JournalFormat = result.Journal.Format
+				stats.JournalDirection = result.Journal.Direction
+				stats.JournalRecipients = result.Journal.ActualRecipients()
+			}
 			stats.EndTime = time.Now()
 			stats.Duration = stats.EndTime.Sub(stats.StartTime)
 			stats.Retries = retries
-			w.sendStatus(task.ID, models.StatusComplete, 1.0,
+			w.sendFinalStatus(ctx, task, models.StatusComplete,
 				fmt.Sprintf("Conversion complete in %s", conversionTime.Round(time.Millisecond)),
 				stats, nil)
 
@@ -213,11 +409,34 @@ func (w *Worker) processTask(ctx context.Context, task models.Task) {
 		w.failCount++
 		w.consecutiveErrors++
 
+		// Deterministic failures, such as a message that doesn't parse, would
+		// only happen again
+		if class := converter.ErrorClass(err); !slices.Contains(w.retryClasses, class) {
+			message := fmt.Sprintf("Failed with a %s error, not retried", class)
+			switch class {
+			case converter.ErrorClassPanic:
+				message = "Recovered from a panic"
+			case converter.ErrorClassSecurity:
+				message = "Outputs withheld by the security alert policy"
+				if result != nil {
+					stats.SecurityAlerts = result.SecurityAlerts
+					stats.AlertAction = result.AlertAction
+					stats.MessageID = result.MessageID
+					stats.Sender = result.Sender
+				}
+			}
+			stats.EndTime = time.Now()
+			stats.Duration = stats.EndTime.Sub(stats.StartTime)
+			stats.Retries = retries - 1
+			w.sendFinalStatus(ctx, task, models.StatusFailed, message, stats, err)
+			return
+		}
+
 		if retries <= w.maxRetries {
-			backoff := time.Duration(retries*backoffBase) * time.Millisecond
+			backoff := retryDelay(w.deps.Config.Retry, retries)
 
 			stats.Retries = retries
-			w.sendStatus(task.ID, models.StatusProcessing, 0,
+			w.sendStatus(task, models.StatusProcessing, 0,
 				fmt.Sprintf("Retrying (%d/%d) after %v: %v", retries, w.maxRetries, backoff, err),
 				stats, nil)
 
@@ -226,7 +445,7 @@ func (w *Worker) processTask(ctx context.Context, task models.Task) {
 			case <-ctx.Done():
 				stats.EndTime = time.Now()
 				stats.Duration = stats.EndTime.Sub(stats.StartTime)
-				w.sendStatus(task.ID, models.StatusFailed, 0, "Cancelled during retry", stats, ctx.Err())
+				w.sendFinalStatus(ctx, task, models.StatusFailed, "Cancelled during retry", stats, ctx.Err())
 				return
 			case <-time.After(backoff):
 				// Continue to retry
@@ -238,75 +457,155 @@ func (w *Worker) processTask(ctx context.Context, task models.Task) {
 	stats.EndTime = time.Now()
 	stats.Duration = stats.EndTime.Sub(stats.StartTime)
 	stats.Retries = retries
-	w.sendStatus(task.ID, models.StatusFailed, 0, "All retries failed", stats, err)
+	w.sendFinalStatus(ctx, task, models.StatusFailed, "All retries failed", stats, err)
 }
 
-// convertFile performs the EML to PDF conversion
-func (w *Worker) convertFile(ctx context.Context, task models.Task) error {
+// retryDelay returns how long to wait before a retry: the base delay doubled
+// for each earlier retry, capped, with the configured fraction randomized
+func retryDelay(opts config.RetryOptions, retry int) time.Duration {
+	base := opts.BackoffMS
+	if base <= 0 {
+		base = backoffBase
+	}
+	delay := time.Duration(base) * time.Millisecond << min(retry-1, maxBackoffShift)
+	if limit := time.Duration(opts.MaxBackoffMS) * time.Millisecond; limit > 0 && delay > limit {
+		delay = limit
+	}
+	if jitter := min(max(opts.Jitter, 0), 1); jitter > 0 {
+		delay -= time.Duration(rand.Float64() * jitter * float64(delay))
+	}
+	return delay
+}
+
+// convertSafely converts a file, turning a panic in the parser or a renderer
+// into a failure of the task so the worker and the run carry on. Panics in
+// goroutines the libraries start themselves cannot be caught here.
+func (w *Worker) convertSafely(ctx context.Context, task models.Task, b *batch) (result *converter.ConversionResult, err error) {
+	w.lastActivity.Store(time.Now().UnixNano())
+	w.busy.Store(true)
+	defer w.busy.Store(false)
+	defer func() {
+		if r := recover(); r != nil {
+			err = converter.PanicError(r, debug.Stack())
+			w.deps.Logger.Printf("Worker %d recovered from a panic converting %s: %v", w.id, task.FilePath, r)
+		}
+	}()
+	return w.convertFile(ctx, task, b)
+}
+
+// convertFile performs the EML to PDF conversion. Files in a batch are too
+// small for progress updates to be worth sending.
+func (w *Worker) convertFile(ctx context.Context, task models.Task, b *batch) (*converter.ConversionResult, error) {
 	// Create intermediate status updates to show progress
-	w.sendStatus(task.ID, models.StatusProcessing, 0.25,
-		"Reading EML file", models.ProcessingStats{}, nil)
+	if b == nil {
+		w.sendStatus(task, models.StatusProcessing, 0.25,
+			"Reading EML file", models.ProcessingStats{}, nil)
+	}
 
 	// Check for context cancellation
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	default:
 		// Continue processing
 	}
 
 	// Perform the actual conversion
-	result, err := converter.ConvertEMLToPDF(task.FilePath, w.config, w.scanner)
+	convert := w.deps.Convert
+	if b != nil && b.session != nil {
+		convert = b.session.Convert
+	}
+	result, err := convert(task.FilePath, w.deps.Config, w.deps.Scanner, w.deps.OCR)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check for context cancellation again
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
 	default:
 		// Continue
 	}
 
 	// Report security alerts if any
+	if b != nil {
+		return result, nil
+	}
 	if len(result.SecurityAlerts) > 0 {
-		alerts := strings.Join(result.SecurityAlerts, ", ")
-		w.sendStatus(task.ID, models.StatusProcessing, 0.9,
-			fmt.Sprintf("Security alerts: %s", alerts), models.ProcessingStats{}, nil)
+		alerts := make([]string, len(result.SecurityAlerts))
+		for i, alert := range result.SecurityAlerts {
+			alerts[i] = alert.String()
+		}
+		w.sendStatus(task, models.StatusProcessing, 0.9,
+			fmt.Sprintf("Security alerts: %s", strings.Join(alerts, ", ")), models.ProcessingStats{}, nil)
 	} else {
 		// Report 90% progress after conversion
-		w.sendStatus(task.ID, models.StatusProcessing, 0.9,
+		w.sendStatus(task, models.StatusProcessing, 0.9,
 			"PDF created, finalizing", models.ProcessingStats{}, nil)
 	}
 
-	return nil
+	return result, nil
 }
 
 // sendStatus sends a status update to the manager
-func (w *Worker) sendStatus(taskID string, status models.TaskStatus, progress float64,
+func (w *Worker) sendStatus(task models.Task, status models.TaskStatus, progress float64,
 	message string, stats models.ProcessingStats, err error) {
 
+	// Progress reported from the conversion keeps the heartbeat going
+	w.lastActivity.Store(time.Now().UnixNano())
+	update := w.statusUpdate(task, status, progress, message, stats, err)
+
+	select {
+	case w.statusChan <- update:
+		// Status sent successfully
+	default:
+		// Channel is full, log this issue
+		if w.verbose {
+			w.deps.Logger.Printf("Worker %d: Status channel full, update dropped for task %s", w.id, task.ID)
+		}
+	}
+}
+
+// sendFinalStatus reports that a task completed or failed. Unlike progress
+// updates it is never dropped, as the manager waits for every task to finish.
+func (w *Worker) sendFinalStatus(ctx context.Context, task models.Task, status models.TaskStatus,
+	message string, stats models.ProcessingStats, err error) {
+
+	progress := 0.0
+	if status == models.StatusComplete {
+		progress = 1.0
+	}
+	update := w.statusUpdate(task, status, progress, message, stats, err)
+
+	// Cancelled tasks are still reported when there is room
+	select {
+	case w.statusChan <- update:
+		return
+	default:
+	}
+	select {
+	case w.statusChan <- update:
+	case <-ctx.Done():
+	}
+}
+
+// statusUpdate builds a status update for a task
+func (w *Worker) statusUpdate(task models.Task, status models.TaskStatus, progress float64,
+	message string, stats models.ProcessingStats, err error) models.StatusUpdate {
+
 	update := models.StatusUpdate{
 		WorkerID:        w.id,
-		TaskID:          taskID,
+		TaskID:          task.ID,
 		Status:          status,
 		Progress:        progress,
 		Message:         message,
 		ProcessingStats: stats,
+		Requeues:        task.Requeues,
 	}
 
 	if err != nil {
 		update.Error = err
 	}
-
-	select {
-	case w.statusChan <- update:
-		// Status sent successfully
-	default:
-		// Channel is full, log this issue
-		if w.verbose {
-			log.Printf("Worker %d: Status channel full, update dropped for task %s", w.id, taskID)
-		}
-	}
+	return update
 }
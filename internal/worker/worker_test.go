@@ -0,0 +1,179 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"emil/internal/config"
+	"emil/internal/converter"
+	"emil/internal/models"
+	"emil/internal/ocr"
+	"emil/internal/security"
+)
+
+// testWorker is a started worker converting with a fake ConvertFunc
+type testWorker struct {
+	*Worker
+	tasks    chan models.Task
+	statuses chan models.StatusUpdate
+}
+
+// startTestWorker starts a worker that converts with convert and retries
+// after a millisecond, up to attempts times per task
+func startTestWorker(t *testing.T, attempts int, convert ConvertFunc) *testWorker {
+	t.Helper()
+	cfg := &config.Config{Retry: config.RetryOptions{MaxAttempts: attempts, BackoffMS: 1}}
+	tw := &testWorker{
+		tasks:    make(chan models.Task, 4),
+		statuses: make(chan models.StatusUpdate, 64),
+	}
+	w, err := NewWorker(1, tw.tasks, nil, tw.statuses, NewGate(), WorkerDeps{
+		Config:  cfg,
+		Convert: convert,
+		Logger:  log.New(io.Discard, "", 0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw.Worker = w
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		<-w.Done()
+	})
+	w.Start(ctx, nil)
+	return tw
+}
+
+// final returns the completed or failed status of a task
+func (tw *testWorker) final(t *testing.T, taskID string) models.StatusUpdate {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case update := <-tw.statuses:
+			if update.TaskID == taskID && (update.Status == models.StatusComplete || update.Status == models.StatusFailed) {
+				return update
+			}
+		case <-timeout:
+			t.Fatalf("no final status for task %s", taskID)
+		}
+	}
+}
+
+// converted is the result of a successful fake conversion
+func converted(emlPath string, _ *config.Config, _ *security.Scanner, _ *ocr.Engine) (*converter.ConversionResult, error) {
+	return &converter.ConversionResult{OutputPath: emlPath + ".pdf"}, nil
+}
+
+func TestNewWorkerRequiresConfig(t *testing.T) {
+	w, err := NewWorker(1, nil, nil, nil, NewGate(), WorkerDeps{})
+	if err == nil || w != nil {
+		t.Fatalf("NewWorker without a Config = %v, %v; want an error", w, err)
+	}
+}
+
+func TestWorkerRetriesUntilSuccess(t *testing.T) {
+	var calls atomic.Int32
+	tw := startTestWorker(t, 4, func(emlPath string, cfg *config.Config, scanner *security.Scanner, ocrEngine *ocr.Engine) (*converter.ConversionResult, error) {
+		if calls.Add(1) < 3 {
+			return nil, errors.New("renderer unavailable")
+		}
+		return converted(emlPath, cfg, scanner, ocrEngine)
+	})
+
+	tw.tasks <- models.Task{ID: "a", FilePath: "a.eml"}
+	update := tw.final(t, "a")
+	if update.Status != models.StatusComplete {
+		t.Fatalf("status = %s (%v), want complete", update.Status, update.Error)
+	}
+	if update.ProcessingStats.Retries != 2 || calls.Load() != 3 {
+		t.Errorf("retries = %d after %d attempts, want 2 after 3", update.ProcessingStats.Retries, calls.Load())
+	}
+	if got := update.ProcessingStats.OutputPaths; len(got) != 1 || got[0] != "a.eml.pdf" {
+		t.Errorf("output paths = %v, want [a.eml.pdf]", got)
+	}
+}
+
+func TestWorkerGivesUpAfterMaxAttempts(t *testing.T) {
+	var calls atomic.Int32
+	failure := errors.New("renderer unavailable")
+	tw := startTestWorker(t, 2, func(string, *config.Config, *security.Scanner, *ocr.Engine) (*converter.ConversionResult, error) {
+		calls.Add(1)
+		return nil, failure
+	})
+
+	tw.tasks <- models.Task{ID: "a", FilePath: "a.eml"}
+	update := tw.final(t, "a")
+	if update.Status != models.StatusFailed || !errors.Is(update.Error, failure) {
+		t.Fatalf("status = %s (%v), want failed with %v", update.Status, update.Error, failure)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("converted %d times, want 2", calls.Load())
+	}
+}
+
+func TestWorkerDoesNotRetryUnretriedClasses(t *testing.T) {
+	var calls atomic.Int32
+	tw := startTestWorker(t, 4, func(string, *config.Config, *security.Scanner, *ocr.Engine) (*converter.ConversionResult, error) {
+		calls.Add(1)
+		return nil, context.Canceled
+	})
+
+	tw.tasks <- models.Task{ID: "a", FilePath: "a.eml"}
+	if update := tw.final(t, "a"); update.Status != models.StatusFailed {
+		t.Fatalf("status = %s, want failed", update.Status)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("converted %d times, want 1", calls.Load())
+	}
+}
+
+func TestWorkerRecoversFromPanic(t *testing.T) {
+	tw := startTestWorker(t, 4, func(emlPath string, cfg *config.Config, scanner *security.Scanner, ocrEngine *ocr.Engine) (*converter.ConversionResult, error) {
+		if emlPath == "bad.eml" {
+			panic("malformed part")
+		}
+		return converted(emlPath, cfg, scanner, ocrEngine)
+	})
+
+	tw.tasks <- models.Task{ID: "bad", FilePath: "bad.eml"}
+	update := tw.final(t, "bad")
+	if update.Status != models.StatusFailed || converter.ErrorClass(update.Error) != converter.ErrorClassPanic {
+		t.Fatalf("status = %s (%v), want failed with a panic error", update.Status, update.Error)
+	}
+
+	// The worker carries on with the next task
+	tw.tasks <- models.Task{ID: "good", FilePath: "good.eml"}
+	if update := tw.final(t, "good"); update.Status != models.StatusComplete {
+		t.Fatalf("status after a panic = %s (%v), want complete", update.Status, update.Error)
+	}
+}
+
+func TestWorkerStop(t *testing.T) {
+	var calls atomic.Int32
+	tw := startTestWorker(t, 1, func(emlPath string, cfg *config.Config, scanner *security.Scanner, ocrEngine *ocr.Engine) (*converter.ConversionResult, error) {
+		calls.Add(1)
+		return converted(emlPath, cfg, scanner, ocrEngine)
+	})
+
+	tw.Stop()
+	tw.Stop() // Safe to repeat
+	select {
+	case <-tw.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker did not stop")
+	}
+
+	tw.tasks <- models.Task{ID: "a", FilePath: "a.eml"}
+	time.Sleep(10 * time.Millisecond)
+	if calls.Load() != 0 {
+		t.Errorf("stopped worker converted %d files", calls.Load())
+	}
+}
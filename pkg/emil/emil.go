@@ -0,0 +1,267 @@
+// Package emil converts EML files to PDF from other Go programs. It wraps the
+// same converter and worker pool the emil command uses.
+package emil
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"emil/internal/backends"
+	"emil/internal/config"
+	"emil/internal/converter"
+	"emil/internal/discovery"
+	"emil/internal/hooks"
+	"emil/internal/manager"
+	"emil/internal/metadata"
+	"emil/internal/models"
+	"emil/internal/ocr"
+	"emil/internal/security"
+	"emil/internal/statsd"
+)
+
+// Config holds the conversion options; see DefaultConfig
+type Config = config.Config
+
+// ChromeOptions configures the headless Chrome used for rendering
+type ChromeOptions = config.ChromeOptions
+
+// RetryOptions controls how failed conversions are retried
+type RetryOptions = config.RetryOptions
+
+// IORetryOptions controls how file operations on network shares are retried
+type IORetryOptions = config.IORetryOptions
+
+// BudgetOptions limits how much one run converts; set Config.CheckpointFile
+// too, so the next run continues where it stopped
+type BudgetOptions = config.BudgetOptions
+
+// Hooks are callbacks run around each stage of a conversion, set in Config.Hooks
+type Hooks = hooks.Hooks
+
+// Result describes the conversion of a single file
+type Result = converter.ConversionResult
+
+// Stats summarizes a run over a directory
+type Stats = models.Stats
+
+// StatusUpdate reports progress on one file, passed to Config.ProgressFunc
+type StatusUpdate = models.StatusUpdate
+
+// TaskStatus is the state of a file in a StatusUpdate
+type TaskStatus = models.TaskStatus
+
+// Task states reported in status updates
+const (
+	StatusProcessing = models.StatusProcessing
+	StatusComplete   = models.StatusComplete
+	StatusFailed     = models.StatusFailed
+)
+
+// Metadata holds the searchable metadata of one EML file
+type Metadata = metadata.Message
+
+// ExtractMetadata parses an EML file and returns its headers, participants,
+// dates and attachment hashes without rendering it
+func ExtractMetadata(emlPath string) (*Metadata, error) {
+	return metadata.Extract(emlPath)
+}
+
+// DefaultConfig returns the options the emil command uses when no flags are given
+func DefaultConfig() *Config {
+	return &Config{
+		SourceDir:        ".",
+		WorkerCount:      runtime.NumCPU(),
+		RecursiveScan:    true,
+		Symlinks:         discovery.SymlinksFiles,
+		WalkWorkers:      8,
+		MaxMemoryPct:     75,
+		LargeFileMB:      32,
+		UnwrapJournals:   true,
+		ShowARC:          true,
+		Locale:           "en",
+		HTMLPartPolicy:   converter.HTMLPartFirst,
+		QuoteMode:        converter.QuoteShow,
+		DetectLanguage:   true,
+		RendererOrder:    append([]string(nil), converter.DefaultRendererOrder...),
+		RenderWait:       converter.RenderWaitIdle,
+		RenderWaitMS:     5000,
+		Chrome:           ChromeOptions{MaxFailures: 3},
+		Retry:            RetryOptions{MaxAttempts: 4, BackoffMS: 500, MaxBackoffMS: 30000, Jitter: 0.2},
+		IORetry:          IORetryOptions{Attempts: 3, BackoffMS: 100},
+		SaveAttachments:  true,
+		ThumbnailImages:  true,
+		InlineAttachKB:   64,
+		HeaderAnomalies:  true,
+		OptimizeImageDPI: 150,
+		ClamdAddress:     "localhost:3310",
+		ClamdStreams:     4,
+		ClamdChunkKB:     64,
+		OCRLanguage:      "eng",
+		NotifyFrom:       "emil@localhost",
+		SMTPAddress:      "localhost:25",
+		StatsdPrefix:     "emil",
+		StatsdFormat:     statsd.FormatDogStatsD,
+	}
+}
+
+// Convert converts a single EML file, writing the PDF next to it. The virus
+// scanner and OCR engine the options ask for are set up by the first call
+// and reused by later ones, which also share what it found out about the
+// renderers. Call Close when done converting to shut down the shared Chrome
+// instance.
+func Convert(emlPath string, cfg *Config) (*Result, error) {
+	if err := checkOptions(cfg); err != nil {
+		return nil, err
+	}
+	built, err := sharedServices(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Renderers == nil {
+		withRenderers := *cfg
+		withRenderers.Renderers = built.renderers
+		cfg = &withRenderers
+	}
+	return converter.ConvertEMLToPDF(emlPath, cfg, built.scanner, built.ocr)
+}
+
+// Run converts every EML file under cfg.SourceDir, or each of cfg.Sources,
+// with a pool of workers. Runs may share cfg and run at the same time; each
+// has its own temp directory, descriptor budget and render slots.
+func Run(cfg *Config) (Stats, error) {
+	if err := checkOptions(cfg); err != nil {
+		return Stats{}, err
+	}
+	if _, err := converter.LookupIOProfile(cfg.IOProfile); err != nil {
+		return Stats{}, err
+	}
+
+	// The run's own state is kept on a copy of the options
+	run := *cfg
+	runTemp, _, err := converter.SetupTempDir(cfg.TempDir)
+	if err != nil {
+		return Stats{}, err
+	}
+	run.RunTempDir = runTemp
+	defer converter.RemoveTempDir(runTemp)
+	release := converter.HoldBrowser()
+	defer release()
+
+	scanner, ocrEngine, err := newServices(&run)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	mgr := manager.NewManager(&run, scanner, ocrEngine)
+	if err := mgr.Start(); err != nil {
+		return mgr.Stats(), err
+	}
+	return mgr.Stats(), nil
+}
+
+// Close shuts down the Chrome instance shared by conversions and forgets the
+// services Convert set up, so the next call probes for them again
+func Close() {
+	converter.CloseBrowser()
+
+	services.mu.Lock()
+	clear(services.built)
+	services.mu.Unlock()
+}
+
+// serviceKey holds the options the virus scanner, OCR engine and renderers
+// are set up from
+type serviceKey struct {
+	scan         bool
+	clamdAddress string
+	clamdStreams int
+	clamdChunkKB int
+	ocr          bool
+	ocrLanguage  string
+	tempDir      string
+	chromePath   string
+	chromeRemote string
+	gotenbergURL string
+}
+
+// builtServices are the virus scanner, OCR engine and renderer tracker set
+// up for a serviceKey
+type builtServices struct {
+	scanner   *security.Scanner
+	ocr       *ocr.Engine
+	renderers *backends.Tracker
+}
+
+// services holds what Convert has set up, so clamd and tesseract are probed
+// once for each set of options rather than on every call
+var services = struct {
+	mu    sync.Mutex
+	built map[serviceKey]builtServices
+}{built: make(map[serviceKey]builtServices)}
+
+// sharedServices returns the virus scanner, OCR engine and renderer tracker
+// for cfg, setting them up on first use
+func sharedServices(cfg *Config) (builtServices, error) {
+	key := serviceKey{
+		scan:         cfg.ScanAttachments,
+		clamdAddress: cfg.ClamdAddress,
+		clamdStreams: cfg.ClamdStreams,
+		clamdChunkKB: cfg.ClamdChunkKB,
+		ocr:          cfg.OCREnabled,
+		ocrLanguage:  cfg.OCRLanguage,
+		tempDir:      converter.TempDir(cfg),
+		chromePath:   cfg.Chrome.ExecPath,
+		chromeRemote: cfg.Chrome.RemoteURL,
+		gotenbergURL: cfg.GotenbergURL,
+	}
+
+	services.mu.Lock()
+	defer services.mu.Unlock()
+	if built, ok := services.built[key]; ok {
+		return built, nil
+	}
+	scanner, ocrEngine, err := newServices(cfg)
+	if err != nil {
+		return builtServices{}, err
+	}
+	built := builtServices{scanner: scanner, ocr: ocrEngine, renderers: backends.New()}
+	services.built[key] = built
+	return built, nil
+}
+
+// checkOptions validates the options the converter can't check itself
+func checkOptions(cfg *Config) error {
+	if _, err := converter.LabelsFor(cfg.Locale); err != nil {
+		return err
+	}
+	if err := converter.CheckRendererOrder(cfg.RendererOrder); err != nil {
+		return err
+	}
+	if err := converter.CheckHTMLPartPolicy(cfg.HTMLPartPolicy); err != nil {
+		return err
+	}
+	if err := converter.CheckQuoteMode(cfg.QuoteMode); err != nil {
+		return err
+	}
+	return converter.CheckRenderWait(cfg.RenderWait)
+}
+
+// newServices starts the virus scanner and OCR engine the options ask for
+func newServices(cfg *Config) (*security.Scanner, *ocr.Engine, error) {
+	var scanner *security.Scanner
+	if cfg.ScanAttachments {
+		var err error
+		opts := security.ScanOptions{Streams: cfg.ClamdStreams, ChunkSize: cfg.ClamdChunkKB * 1024}
+		if scanner, err = security.NewScanner(true, cfg.ClamdAddress, opts); err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize virus scanner: %w", err)
+		}
+	}
+
+	var ocrEngine *ocr.Engine
+	if cfg.OCREnabled {
+		ocrEngine = ocr.NewEngine(true, cfg.OCRLanguage, converter.TempDir(cfg))
+	}
+
+	return scanner, ocrEngine, nil
+}